@@ -0,0 +1,618 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"resume-centre/common/storage"
+)
+
+// 横幅状态，只有active状态且在投放时间内的横幅会展示
+const (
+	BannerDraft    = "draft"
+	BannerActive   = "active"
+	BannerPaused   = "paused"
+	BannerArchived = "archived"
+)
+
+var (
+	ErrBannerNotFound     = errors.New("banner not found")
+	ErrBannerSlotNotFound = errors.New("banner slot not found")
+	ErrBannerInvalid      = errors.New("invalid banner request")
+	ErrBannerConflict     = errors.New("banner conflict")
+)
+
+// BannerConfig 横幅服务配置
+type BannerConfig struct {
+	// CacheTTL 公开读取的缓存有效期，本实例的管理操作会立即刷新缓存，其他实例的修改最迟在此时间后生效
+	CacheTTL time.Duration
+	// DedupWindow 同一访客对同一横幅的曝光或点击，距上次记录不足该时长的不再记录
+	DedupWindow time.Duration
+	// VisitorSecret 签名匿名访客Cookie的密钥，为空时每次启动随机生成，重启后已签发的Cookie失效
+	VisitorSecret []byte
+	Storage       storage.StorageConfig
+}
+
+// DefaultBannerConfig 默认配置，可通过BANNER_CACHE_TTL、BANNER_DEDUP_WINDOW、BANNER_VISITOR_SECRET和BANNER_UPLOAD_DIR覆盖
+func DefaultBannerConfig() BannerConfig {
+	config := BannerConfig{
+		CacheTTL:    30 * time.Second,
+		DedupWindow: 30 * time.Minute,
+		Storage: storage.StorageConfig{
+			Type:        storage.StorageTypeLocal,
+			BasePath:    "./uploads/banners",
+			MaxFileSize: 5 * 1024 * 1024,
+			AllowedExts: []string{".jpg", ".jpeg", ".png", ".gif", ".webp"},
+			URLPrefix:   "/uploads/banners",
+		},
+	}
+	if d, err := time.ParseDuration(os.Getenv("BANNER_CACHE_TTL")); err == nil && d > 0 {
+		config.CacheTTL = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("BANNER_DEDUP_WINDOW")); err == nil && d > 0 {
+		config.DedupWindow = d
+	}
+	if secret := os.Getenv("BANNER_VISITOR_SECRET"); secret != "" {
+		config.VisitorSecret = []byte(secret)
+	}
+	if dir := os.Getenv("BANNER_UPLOAD_DIR"); dir != "" {
+		config.Storage.BasePath = dir
+	}
+	return config
+}
+
+// BannerSlot 横幅位，例如首页顶部轮播，MaxItems为该位置同时展示的横幅数
+type BannerSlot struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Code        string    `json:"code" gorm:"size:64;uniqueIndex;not null"`
+	Name        string    `json:"name" gorm:"size:100;not null"`
+	Description string    `json:"description" gorm:"type:text"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	MaxItems    int       `json:"max_items" gorm:"default:1"`
+	IsActive    bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (BannerSlot) TableName() string {
+	return "banner_slots"
+}
+
+// BannerAudience 投放人群，每个维度为空表示不限；多个维度同时设置时需全部满足
+type BannerAudience struct {
+	Roles    []string `json:"roles,omitempty"`    // 用户角色，未登录访客为guest
+	Cities   []string `json:"cities,omitempty"`   // 城市
+	Segments []string `json:"segments,omitempty"` // 用户分群，访客属于任一分群即可
+}
+
+// Banner 横幅，Priority越大越靠前
+type Banner struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	SlotID      uint           `json:"slot_id" gorm:"not null;index"`
+	Title       string         `json:"title" gorm:"size:200;not null"`
+	Description string         `json:"description" gorm:"type:text"`
+	ImageURL    string         `json:"image_url" gorm:"size:500"`
+	ImagePath   string         `json:"-" gorm:"size:500"`
+	LinkURL     string         `json:"link_url" gorm:"size:500"`
+	Priority    int            `json:"priority" gorm:"default:0"`
+	StartAt     *time.Time     `json:"start_at"`
+	EndAt       *time.Time     `json:"end_at"`
+	Status      string         `json:"status" gorm:"size:20;not null;index"`
+	Targeting   string         `json:"-" gorm:"type:json"`
+	Audience    BannerAudience `json:"audience" gorm:"-"`
+	CreatedBy   uint           `json:"created_by"`
+	UpdatedBy   uint           `json:"updated_by"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+
+	Variants []BannerVariant `json:"variants,omitempty" gorm:"foreignKey:BannerID"`
+}
+
+// TableName 指定表名
+func (Banner) TableName() string {
+	return "banners"
+}
+
+// AfterFind 解析投放人群
+func (b *Banner) AfterFind(tx *gorm.DB) error {
+	if b.Targeting != "" {
+		return json.Unmarshal([]byte(b.Targeting), &b.Audience)
+	}
+	return nil
+}
+
+// live 横幅在now时刻是否投放中
+func (b *Banner) live(now time.Time) bool {
+	return b.Status == BannerActive &&
+		(b.StartAt == nil || !now.Before(*b.StartAt)) &&
+		(b.EndAt == nil || now.Before(*b.EndAt))
+}
+
+// BannerVariant A/B测试的变体，非空字段覆盖横幅的标题、图片和链接，按Weight分配访客
+type BannerVariant struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	BannerID  uint      `json:"banner_id" gorm:"not null;uniqueIndex:idx_banner_variant_key"`
+	Key       string    `json:"key" gorm:"column:variant_key;size:32;not null;uniqueIndex:idx_banner_variant_key"`
+	Title     string    `json:"title" gorm:"size:200"`
+	ImageURL  string    `json:"image_url" gorm:"size:500"`
+	ImagePath string    `json:"-" gorm:"size:500"`
+	LinkURL   string    `json:"link_url" gorm:"size:500"`
+	Weight    int       `json:"weight" gorm:"default:1"`
+	IsActive  bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (BannerVariant) TableName() string {
+	return "banner_variants"
+}
+
+// BannerService 横幅和推广位管理：横幅位、投放时间、优先级、人群定向、A/B变体和曝光点击统计
+type BannerService struct {
+	db      *gorm.DB
+	config  BannerConfig
+	storage *storage.StorageManager
+
+	mu         sync.RWMutex
+	snapshot   *bannerSnapshot
+	generation uint64 // 管理操作使缓存失效时递增
+	refreshMu  sync.Mutex
+}
+
+// timeNow 服务内统一取当前时间的入口，测试中替换为固定时钟
+var timeNow = time.Now
+
+// NewBannerService 创建横幅服务
+func NewBannerService(db *gorm.DB, config BannerConfig) *BannerService {
+	if len(config.VisitorSecret) == 0 {
+		config.VisitorSecret = make([]byte, 32)
+		if _, err := rand.Read(config.VisitorSecret); err != nil {
+			log.Fatalf("生成访客Cookie密钥失败: %v", err)
+		}
+		log.Printf("未配置BANNER_VISITOR_SECRET，访客Cookie使用随机密钥，服务重启或多实例部署时访客标识不稳定")
+	}
+	storageConfig := config.Storage
+	return &BannerService{
+		db:      db,
+		config:  config,
+		storage: storage.NewStorageManager(&storageConfig),
+	}
+}
+
+// AutoMigrate 创建横幅相关的表
+func (s *BannerService) AutoMigrate() error {
+	return s.db.AutoMigrate(&BannerSlot{}, &Banner{}, &BannerVariant{}, &BannerEvent{}, &BannerUserSegment{})
+}
+
+// BannerSlotInput 创建或修改横幅位
+type BannerSlotInput struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	MaxItems    int    `json:"max_items"`
+	IsActive    *bool  `json:"is_active"`
+}
+
+func (in *BannerSlotInput) apply(slot *BannerSlot) error {
+	in.Code = strings.TrimSpace(in.Code)
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Code == "" || in.Name == "" {
+		return fmt.Errorf("%w: 横幅位编码和名称不能为空", ErrBannerInvalid)
+	}
+	if in.MaxItems < 0 || in.Width < 0 || in.Height < 0 {
+		return fmt.Errorf("%w: 尺寸和展示数量不能为负", ErrBannerInvalid)
+	}
+	slot.Code, slot.Name, slot.Description = in.Code, in.Name, in.Description
+	slot.Width, slot.Height, slot.MaxItems = in.Width, in.Height, in.MaxItems
+	if slot.MaxItems == 0 {
+		slot.MaxItems = 1
+	}
+	if in.IsActive != nil {
+		slot.IsActive = *in.IsActive
+	}
+	return nil
+}
+
+// ListSlots 所有横幅位
+func (s *BannerService) ListSlots() ([]BannerSlot, error) {
+	var slots []BannerSlot
+	err := s.db.Order("code").Find(&slots).Error
+	return slots, err
+}
+
+// CreateSlot 创建横幅位
+func (s *BannerService) CreateSlot(in BannerSlotInput) (*BannerSlot, error) {
+	slot := BannerSlot{IsActive: true}
+	if err := in.apply(&slot); err != nil {
+		return nil, err
+	}
+	var count int64
+	if err := s.db.Model(&BannerSlot{}).Where("code = ?", slot.Code).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("%w: 横幅位编码%s已存在", ErrBannerConflict, slot.Code)
+	}
+	if err := s.db.Create(&slot).Error; err != nil {
+		return nil, err
+	}
+	if !slot.IsActive {
+		// is_active有默认值，创建时false会被默认值替换
+		if err := s.db.Model(&slot).Update("is_active", false).Error; err != nil {
+			return nil, err
+		}
+	}
+	s.invalidate()
+	return &slot, nil
+}
+
+// UpdateSlot 修改横幅位
+func (s *BannerService) UpdateSlot(id uint, in BannerSlotInput) (*BannerSlot, error) {
+	var slot BannerSlot
+	if err := s.db.First(&slot, id).Error; err != nil {
+		return nil, slotLookupError(err)
+	}
+	if err := in.apply(&slot); err != nil {
+		return nil, err
+	}
+	var count int64
+	if err := s.db.Model(&BannerSlot{}).Where("code = ? AND id <> ?", slot.Code, id).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("%w: 横幅位编码%s已存在", ErrBannerConflict, slot.Code)
+	}
+	if err := s.db.Save(&slot).Error; err != nil {
+		return nil, err
+	}
+	s.invalidate()
+	return &slot, nil
+}
+
+// DeleteSlot 删除横幅位，仍有未归档的横幅时拒绝
+func (s *BannerService) DeleteSlot(id uint) error {
+	var count int64
+	if err := s.db.Model(&Banner{}).Where("slot_id = ? AND status <> ?", id, BannerArchived).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: 横幅位下还有%d个横幅", ErrBannerConflict, count)
+	}
+	result := s.db.Delete(&BannerSlot{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrBannerSlotNotFound
+	}
+	s.invalidate()
+	return nil
+}
+
+// BannerInput 创建或修改横幅，修改时整体替换
+type BannerInput struct {
+	SlotID      uint           `json:"slot_id"`
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	LinkURL     string         `json:"link_url"`
+	Priority    int            `json:"priority"`
+	StartAt     *time.Time     `json:"start_at"`
+	EndAt       *time.Time     `json:"end_at"`
+	Status      string         `json:"status"`
+	Audience    BannerAudience `json:"audience"`
+}
+
+func (s *BannerService) applyBanner(banner *Banner, in BannerInput) error {
+	in.Title = strings.TrimSpace(in.Title)
+	if in.Title == "" {
+		return fmt.Errorf("%w: 标题不能为空", ErrBannerInvalid)
+	}
+	if in.Status == "" {
+		in.Status = BannerDraft
+	}
+	switch in.Status {
+	case BannerDraft, BannerActive, BannerPaused, BannerArchived:
+	default:
+		return fmt.Errorf("%w: 未知的状态%s", ErrBannerInvalid, in.Status)
+	}
+	if in.StartAt != nil && in.EndAt != nil && !in.EndAt.After(*in.StartAt) {
+		return fmt.Errorf("%w: 结束时间必须晚于开始时间", ErrBannerInvalid)
+	}
+	var slot BannerSlot
+	if err := s.db.First(&slot, in.SlotID).Error; err != nil {
+		return slotLookupError(err)
+	}
+
+	audience := BannerAudience{
+		Roles:    normalizeTargets(in.Audience.Roles),
+		Cities:   normalizeTargets(in.Audience.Cities),
+		Segments: normalizeTargets(in.Audience.Segments),
+	}
+	encoded, err := json.Marshal(audience)
+	if err != nil {
+		return err
+	}
+	banner.SlotID, banner.Title, banner.Description, banner.LinkURL = in.SlotID, in.Title, in.Description, in.LinkURL
+	banner.Priority, banner.StartAt, banner.EndAt, banner.Status = in.Priority, in.StartAt, in.EndAt, in.Status
+	banner.Audience, banner.Targeting = audience, string(encoded)
+	return nil
+}
+
+// ListBanners 横幅列表，slotID为0或status为空时不过滤
+func (s *BannerService) ListBanners(slotID uint, status string) ([]Banner, error) {
+	query := s.db.Preload("Variants")
+	if slotID != 0 {
+		query = query.Where("slot_id = ?", slotID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var banners []Banner
+	err := query.Order("slot_id, priority DESC, id DESC").Find(&banners).Error
+	return banners, err
+}
+
+// GetBanner 横幅详情，包含变体
+func (s *BannerService) GetBanner(id uint) (*Banner, error) {
+	var banner Banner
+	if err := s.db.Preload("Variants").First(&banner, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBannerNotFound
+		}
+		return nil, err
+	}
+	return &banner, nil
+}
+
+// CreateBanner 创建横幅
+func (s *BannerService) CreateBanner(userID uint, in BannerInput) (*Banner, error) {
+	banner := Banner{CreatedBy: userID, UpdatedBy: userID}
+	if err := s.applyBanner(&banner, in); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(&banner).Error; err != nil {
+		return nil, err
+	}
+	s.invalidate()
+	return &banner, nil
+}
+
+// UpdateBanner 修改横幅
+func (s *BannerService) UpdateBanner(id, userID uint, in BannerInput) (*Banner, error) {
+	banner, err := s.GetBanner(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyBanner(banner, in); err != nil {
+		return nil, err
+	}
+	banner.UpdatedBy = userID
+	if err := s.db.Omit("Variants").Save(banner).Error; err != nil {
+		return nil, err
+	}
+	s.invalidate()
+	return banner, nil
+}
+
+// DeleteBanner 删除横幅、变体和图片，保留曝光点击记录
+func (s *BannerService) DeleteBanner(id uint) error {
+	banner, err := s.GetBanner(id)
+	if err != nil {
+		return err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("banner_id = ?", id).Delete(&BannerVariant{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Banner{}, id).Error
+	})
+	if err != nil {
+		return err
+	}
+	s.invalidate()
+	s.removeImage(banner.ImagePath)
+	for _, variant := range banner.Variants {
+		s.removeImage(variant.ImagePath)
+	}
+	return nil
+}
+
+// BannerVariantInput 创建或修改变体
+type BannerVariantInput struct {
+	Key      string `json:"key"`
+	Title    string `json:"title"`
+	LinkURL  string `json:"link_url"`
+	Weight   int    `json:"weight"`
+	IsActive *bool  `json:"is_active"`
+}
+
+func (in *BannerVariantInput) apply(variant *BannerVariant) error {
+	in.Key = strings.TrimSpace(in.Key)
+	if in.Key == "" {
+		return fmt.Errorf("%w: 变体标识不能为空", ErrBannerInvalid)
+	}
+	if in.Weight < 0 {
+		return fmt.Errorf("%w: 权重不能为负", ErrBannerInvalid)
+	}
+	variant.Key, variant.Title, variant.LinkURL, variant.Weight = in.Key, in.Title, in.LinkURL, in.Weight
+	if variant.Weight == 0 {
+		variant.Weight = 1
+	}
+	if in.IsActive != nil {
+		variant.IsActive = *in.IsActive
+	}
+	return nil
+}
+
+// AddVariant 为横幅添加A/B变体
+func (s *BannerService) AddVariant(bannerID uint, in BannerVariantInput) (*BannerVariant, error) {
+	if _, err := s.GetBanner(bannerID); err != nil {
+		return nil, err
+	}
+	variant := BannerVariant{BannerID: bannerID, IsActive: true}
+	if err := in.apply(&variant); err != nil {
+		return nil, err
+	}
+	var count int64
+	if err := s.db.Model(&BannerVariant{}).Where("banner_id = ? AND variant_key = ?", bannerID, variant.Key).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("%w: 变体%s已存在", ErrBannerConflict, variant.Key)
+	}
+	if err := s.db.Create(&variant).Error; err != nil {
+		return nil, err
+	}
+	if !variant.IsActive {
+		if err := s.db.Model(&variant).Update("is_active", false).Error; err != nil {
+			return nil, err
+		}
+	}
+	s.invalidate()
+	return &variant, nil
+}
+
+// UpdateVariant 修改变体
+func (s *BannerService) UpdateVariant(bannerID, variantID uint, in BannerVariantInput) (*BannerVariant, error) {
+	variant, err := s.getVariant(bannerID, variantID)
+	if err != nil {
+		return nil, err
+	}
+	if err := in.apply(variant); err != nil {
+		return nil, err
+	}
+	var count int64
+	if err := s.db.Model(&BannerVariant{}).Where("banner_id = ? AND variant_key = ? AND id <> ?", bannerID, variant.Key, variantID).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("%w: 变体%s已存在", ErrBannerConflict, variant.Key)
+	}
+	if err := s.db.Save(variant).Error; err != nil {
+		return nil, err
+	}
+	s.invalidate()
+	return variant, nil
+}
+
+// DeleteVariant 删除变体，已有的曝光点击记录保留在报表中
+func (s *BannerService) DeleteVariant(bannerID, variantID uint) error {
+	variant, err := s.getVariant(bannerID, variantID)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Delete(variant).Error; err != nil {
+		return err
+	}
+	s.invalidate()
+	s.removeImage(variant.ImagePath)
+	return nil
+}
+
+func (s *BannerService) getVariant(bannerID, variantID uint) (*BannerVariant, error) {
+	var variant BannerVariant
+	if err := s.db.Where("id = ? AND banner_id = ?", variantID, bannerID).First(&variant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: 变体%d不存在", ErrBannerNotFound, variantID)
+		}
+		return nil, err
+	}
+	return &variant, nil
+}
+
+// SetImage 上传横幅图片，variantID不为0时设置变体的图片。替换后删除旧图片
+func (s *BannerService) SetImage(ctx context.Context, bannerID, variantID uint, file *multipart.FileHeader) (*storage.FileInfo, error) {
+	var model interface{}
+	var oldPath string
+	if variantID != 0 {
+		variant, err := s.getVariant(bannerID, variantID)
+		if err != nil {
+			return nil, err
+		}
+		model, oldPath = variant, variant.ImagePath
+	} else {
+		banner, err := s.GetBanner(bannerID)
+		if err != nil {
+			return nil, err
+		}
+		model, oldPath = &Banner{ID: banner.ID}, banner.ImagePath
+	}
+
+	if err := checkImageContent(file); err != nil {
+		return nil, err
+	}
+	info, err := s.storage.UploadFile(ctx, file, fmt.Sprintf("%d", bannerID))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBannerInvalid, err)
+	}
+	if err := s.db.Model(model).Updates(map[string]interface{}{"image_url": info.URL, "image_path": info.Path}).Error; err != nil {
+		s.removeImage(info.Path)
+		return nil, err
+	}
+	s.invalidate()
+	s.removeImage(oldPath)
+	return info, nil
+}
+
+// checkImageContent 按文件内容判断是否为图片，存储层只检查扩展名
+func checkImageContent(file *multipart.FileHeader) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(src, head)
+	if !strings.HasPrefix(http.DetectContentType(head[:n]), "image/") {
+		return fmt.Errorf("%w: 上传的文件不是图片", ErrBannerInvalid)
+	}
+	return nil
+}
+
+func (s *BannerService) removeImage(path string) {
+	if path == "" {
+		return
+	}
+	if err := s.storage.DeleteFile(context.Background(), path); err != nil && !os.IsNotExist(err) {
+		log.Printf("删除横幅图片%s失败: %v", path, err)
+	}
+}
+
+func slotLookupError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrBannerSlotNotFound
+	}
+	return err
+}
+
+// normalizeTargets 去掉空白和重复值，统一小写后比较
+func normalizeTargets(values []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value != "" && !seen[value] {
+			seen[value] = true
+			out = append(out, value)
+		}
+	}
+	return out
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jobfirst/jobfirst-core"
+)
+
+// 匿名访客Cookie：服务端生成的随机ID加HMAC签名，有效期一年
+const (
+	bannerVisitorCookie = "banner_visitor"
+	visitorCookieMaxAge = 365 * 24 * 60 * 60
+)
+
+// setupBannerRoutes 设置横幅路由：公开读取和曝光点击上报，以及横幅位、横幅、变体和报表管理
+func setupBannerRoutes(r *gin.Engine, core *jobfirst.Core, service *BannerService) {
+	r.Static(service.config.Storage.URLPrefix, service.config.Storage.BasePath)
+
+	// 公开接口，登录用户按角色定向，未登录访客按guest处理
+	public := r.Group("/api/v1/banner/public")
+	public.Use(core.AuthMiddleware.OptionalAuth())
+	{
+		// 单个横幅位
+		public.GET("/slots/:code", func(c *gin.Context) {
+			served, err := service.Serve(c.Param("code"), bannerViewer(c, service))
+			if err != nil {
+				respondBannerError(c, err)
+				return
+			}
+			setBannerCacheHeader(c, service)
+			standardSuccessResponse(c, served, "Banners retrieved successfully")
+		})
+
+		// 一次读取多个横幅位，首页用 ?slots=home_top,home_side
+		public.GET("/placements", func(c *gin.Context) {
+			codes := splitQueryList(c.Query("slots"))
+			if len(codes) == 0 {
+				standardErrorResponse(c, http.StatusBadRequest, "slots is required", "")
+				return
+			}
+			served, err := service.ServeSlots(codes, bannerViewer(c, service))
+			if err != nil {
+				respondBannerError(c, err)
+				return
+			}
+			setBannerCacheHeader(c, service)
+			standardSuccessResponse(c, served, "Banners retrieved successfully")
+		})
+
+		// 批量上报曝光和点击
+		public.POST("/events", func(c *gin.Context) {
+			var request struct {
+				Events []BannerEventInput `json:"events"`
+			}
+			if err := c.ShouldBindJSON(&request); err != nil {
+				standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+				return
+			}
+			result, err := service.Track(request.Events, visitorKey(c, service), bannerUserID(c))
+			if err != nil {
+				respondBannerError(c, err)
+				return
+			}
+			standardSuccessResponse(c, result, "Events recorded successfully")
+		})
+
+		// 点击跳转：记录点击后重定向到横幅链接
+		public.GET("/banners/:id/click", func(c *gin.Context) {
+			bannerID, ok := bannerParamID(c, "id")
+			if !ok {
+				return
+			}
+			var variantID *uint
+			if raw := c.Query("variant_id"); raw != "" {
+				id, err := strconv.ParseUint(raw, 10, 32)
+				if err != nil {
+					standardErrorResponse(c, http.StatusBadRequest, "Invalid variant ID", "")
+					return
+				}
+				v := uint(id)
+				variantID = &v
+			}
+			link, err := service.TrackClick(bannerID, variantID, c.Query("slot"), visitorKey(c, service), bannerUserID(c))
+			if err != nil {
+				respondBannerError(c, err)
+				return
+			}
+			c.Redirect(http.StatusFound, link)
+		})
+	}
+
+	// 管理接口，需要管理员或运营角色
+	admin := r.Group("/api/v1/banner/admin")
+	admin.Use(core.AuthMiddleware.RequireAuth(), requireBannerAdmin())
+	{
+		admin.GET("/slots", func(c *gin.Context) {
+			slots, err := service.ListSlots()
+			if err != nil {
+				respondBannerError(c, err)
+				return
+			}
+			standardSuccessResponse(c, slots, "Banner slots retrieved successfully")
+		})
+
+		admin.POST("/slots", func(c *gin.Context) {
+			var input BannerSlotInput
+			if err := c.ShouldBindJSON(&input); err != nil {
+				standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+				return
+			}
+			slot, err := service.CreateSlot(input)
+			if err != nil {
+				respondBannerError(c, err)
+				return
+			}
+			standardSuccessResponse(c, slot, "Banner slot created successfully")
+		})
+
+		admin.PUT("/slots/:id", func(c *gin.Context) {
+			slotID, ok := bannerParamID(c, "id")
+			if !ok {
+				return
+			}
+			var input BannerSlotInput
+			if err := c.ShouldBindJSON(&input); err != nil {
+				standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+				return
+			}
+			slot, err := service.UpdateSlot(slotID, input)
+			if err != nil {
+				respondBannerError(c, err)
+				return
+			}
+			standardSuccessResponse(c, slot, "Banner slot updated successfully")
+		})
+
+		admin.DELETE("/slots/:id", func(c *gin.Context) {
+			slotID, ok := bannerParamID(c, "id")
+			if !ok {
+				return
+			}
+			if err := service.DeleteSlot(slotID); err != nil {
+				respondBannerError(c, err)
+				return
+			}
+			standardSuccessResponse(c, nil, "Banner slot deleted successfully")
+		})
+
+		admin.GET("/banners", func(c *gin.Context) {
+			slotID, _ := strconv.ParseUint(c.Query("slot_id"), 10, 32)
+			banners, err := service.ListBanners(uint(slotID), c.Query("status"))
+			if err != nil {
+				respondBannerError(c, err)
+				return
+			}
+			standardSuccessResponse(c, banners, "Banners retrieved successfully")
+		})
+
+		admin.POST("/banners", func(c *gin.Context) {
+			var input BannerInput
+			if err := c.ShouldBindJSON(&input); err != nil {
+				standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+				return
+			}
+			banner, err := service.CreateBanner(c.GetUint("user_id"), input)
+			if err != nil {
+				respondBannerError(c, err)
+				return
+			}
+			standardSuccessResponse(c, banner, "Banner created successfully")
+		})
+
+		admin.GET("/banners/:id", func(c *gin.Context) {
+			bannerID, ok := bannerParamID(c, "id")
+			if !ok {
+				return
+			}
+			banner, err := service.GetBanner(bannerID)
+			if err != nil {
+				respondBannerError(c, err)
+				return
+			}
+			standardSuccessResponse(c, banner, "Banner retrieved successfully")
+		})
+
+		admin.PUT("/banners/:id", func(c *gin.Context) {
+			bannerID, ok := bannerParamID(c, "id")
+			if !ok {
+				return
+			}
+			var input BannerInput
+			if err := c.ShouldBindJSON(&input); err != nil {
+				standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+				return
+			}
+			banner, err := service.UpdateBanner(bannerID, c.GetUint("user_id"), input)
+			if err != nil {
+				respondBannerError(c, err)
+				return
+			}
+			standardSuccessResponse(c, banner, "Banner updated successfully")
+		})
+
+		admin.DELETE("/banners/:id", func(c *gin.Context) {
+			bannerID, ok := bannerParamID(c, "id")
+			if !ok {
+				return
+			}
+			if err := service.DeleteBanner(bannerID); err != nil {
+				respondBannerError(c, err)
+				return
+			}
+			standardSuccessResponse(c, nil, "Banner deleted successfully")
+		})
+
+		// 上传横幅图片，表单字段image；带variant_id时设置变体的图片
+		admin.POST("/banners/:id/image", func(c *gin.Context) {
+			bannerID, ok := bannerParamID(c, "id")
+			if !ok {
+				return
+			}
+			var variantID uint
+			if raw := c.PostForm("variant_id"); raw != "" {
+				id, err := strconv.ParseUint(raw, 10, 32)
+				if err != nil {
+					standardErrorResponse(c, http.StatusBadRequest, "Invalid variant ID", "")
+					return
+				}
+				variantID = uint(id)
+			}
+			file, err := c.FormFile("image")
+			if err != nil {
+				standardErrorResponse(c, http.StatusBadRequest, "image is required", err.Error())
+				return
+			}
+			info, err := service.SetImage(c.Request.Context(), bannerID, variantID, file)
+			if err != nil {
+				respondBannerError(c, err)
+				return
+			}
+			standardSuccessResponse(c, info, "Banner image uploaded successfully")
+		})
+
+		admin.POST("/banners/:id/variants", func(c *gin.Context) {
+			bannerID, ok := bannerParamID(c, "id")
+			if !ok {
+				return
+			}
+			var input BannerVariantInput
+			if err := c.ShouldBindJSON(&input); err != nil {
+				standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+				return
+			}
+			variant, err := service.AddVariant(bannerID, input)
+			if err != nil {
+				respondBannerError(c, err)
+				return
+			}
+			standardSuccessResponse(c, variant, "Banner variant created successfully")
+		})
+
+		admin.PUT("/banners/:id/variants/:variant_id", func(c *gin.Context) {
+			bannerID, ok := bannerParamID(c, "id")
+			if !ok {
+				return
+			}
+			variantID, ok := bannerParamID(c, "variant_id")
+			if !ok {
+				return
+			}
+			var input BannerVariantInput
+			if err := c.ShouldBindJSON(&input); err != nil {
+				standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+				return
+			}
+			variant, err := service.UpdateVariant(bannerID, variantID, input)
+			if err != nil {
+				respondBannerError(c, err)
+				return
+			}
+			standardSuccessResponse(c, variant, "Banner variant updated successfully")
+		})
+
+		admin.DELETE("/banners/:id/variants/:variant_id", func(c *gin.Context) {
+			bannerID, ok := bannerParamID(c, "id")
+			if !ok {
+				return
+			}
+			variantID, ok := bannerParamID(c, "variant_id")
+			if !ok {
+				return
+			}
+			if err := service.DeleteVariant(bannerID, variantID); err != nil {
+				respondBannerError(c, err)
+				return
+			}
+			standardSuccessResponse(c, nil, "Banner variant deleted successfully")
+		})
+
+		// 按变体的点击率报表，from和to为日期（含），默认最近7天
+		admin.GET("/banners/:id/report", func(c *gin.Context) {
+			bannerID, ok := bannerParamID(c, "id")
+			if !ok {
+				return
+			}
+			from, to, err := reportRange(c.Query("from"), c.Query("to"), timeNow())
+			if err != nil {
+				respondBannerError(c, err)
+				return
+			}
+			report, err := service.VariantReport(bannerID, from, to)
+			if err != nil {
+				respondBannerError(c, err)
+				return
+			}
+			standardSuccessResponse(c, report, "Banner report retrieved successfully")
+		})
+
+		// 用户分群，公开接口按这里的分群定向登录用户
+		admin.GET("/users/:user_id/segments", func(c *gin.Context) {
+			userID, ok := bannerParamID(c, "user_id")
+			if !ok {
+				return
+			}
+			segments, err := service.UserSegments(userID)
+			if err != nil {
+				respondBannerError(c, err)
+				return
+			}
+			standardSuccessResponse(c, gin.H{"user_id": userID, "segments": segments}, "User segments retrieved successfully")
+		})
+
+		admin.PUT("/users/:user_id/segments", func(c *gin.Context) {
+			userID, ok := bannerParamID(c, "user_id")
+			if !ok {
+				return
+			}
+			var request struct {
+				Segments []string `json:"segments"`
+			}
+			if err := c.ShouldBindJSON(&request); err != nil {
+				standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+				return
+			}
+			segments, err := service.SetUserSegments(userID, request.Segments)
+			if err != nil {
+				respondBannerError(c, err)
+				return
+			}
+			standardSuccessResponse(c, gin.H{"user_id": userID, "segments": segments}, "User segments updated successfully")
+		})
+	}
+}
+
+// requireBannerAdmin 管理员或运营人员
+func requireBannerAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.GetString("role") {
+		case "admin", "super_admin", "marketing":
+			c.Next()
+		default:
+			standardErrorResponse(c, http.StatusForbidden, "Insufficient permissions", "")
+			c.Abort()
+		}
+	}
+}
+
+// bannerViewer 从请求构造访客：角色取自登录信息，登录用户的分群由服务端查询，城市由前端按用户资料传入
+func bannerViewer(c *gin.Context, service *BannerService) BannerViewer {
+	viewer := BannerViewer{
+		Role:       c.GetString("role"),
+		City:       c.Query("city"),
+		VisitorKey: visitorKey(c, service),
+	}
+	if userID := bannerUserID(c); userID != nil {
+		segments, err := service.UserSegments(*userID)
+		if err != nil {
+			// 分群查询失败时按不属于任何分群处理，不影响其他横幅展示
+			log.Printf("查询用户%d的横幅分群失败: %v", *userID, err)
+		}
+		viewer.Segments = segments
+	}
+	return viewer
+}
+
+// visitorKey 登录用户按用户ID；未登录访客按服务端签发的访客Cookie，没有有效Cookie时签发新的
+func visitorKey(c *gin.Context, service *BannerService) string {
+	if userID := bannerUserID(c); userID != nil {
+		return fmt.Sprintf("u:%d", *userID)
+	}
+	if cookie, err := c.Cookie(bannerVisitorCookie); err == nil {
+		if id, ok := parseVisitorCookie(service.config.VisitorSecret, cookie); ok {
+			return "v:" + id
+		}
+	}
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		log.Printf("生成访客标识失败: %v", err)
+		return ""
+	}
+	id := hex.EncodeToString(raw)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(bannerVisitorCookie, signVisitorID(service.config.VisitorSecret, id), visitorCookieMaxAge, "/", "",
+		c.Request.TLS != nil, true)
+	return "v:" + id
+}
+
+// signVisitorID 访客Cookie的值：ID.签名
+func signVisitorID(secret []byte, id string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(id))
+	return id + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// parseVisitorCookie 校验签名，返回Cookie中的访客ID
+func parseVisitorCookie(secret []byte, value string) (string, bool) {
+	id, _, ok := strings.Cut(value, ".")
+	if !ok || id == "" || !hmac.Equal([]byte(signVisitorID(secret, id)), []byte(value)) {
+		return "", false
+	}
+	return id, true
+}
+
+func bannerUserID(c *gin.Context) *uint {
+	if userID := c.GetUint("user_id"); userID != 0 {
+		return &userID
+	}
+	return nil
+}
+
+// setBannerCacheHeader 结果按访客定向，只允许浏览器缓存
+func setBannerCacheHeader(c *gin.Context, service *BannerService) {
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(service.config.CacheTTL.Seconds())))
+}
+
+func bannerParamID(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 32)
+	if err != nil || id == 0 {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid "+strings.ReplaceAll(name, "_", " "), "")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func splitQueryList(raw string) []string {
+	var values []string
+	for _, value := range strings.Split(raw, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// reportRange 解析报表日期范围，to当天计入
+func reportRange(fromRaw, toRaw string, now time.Time) (time.Time, time.Time, error) {
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1)
+	if toRaw != "" {
+		day, err := time.ParseInLocation("2006-01-02", toRaw, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: to日期格式应为YYYY-MM-DD", ErrBannerInvalid)
+		}
+		to = day.AddDate(0, 0, 1)
+	}
+	from := to.AddDate(0, 0, -7)
+	if fromRaw != "" {
+		day, err := time.ParseInLocation("2006-01-02", fromRaw, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: from日期格式应为YYYY-MM-DD", ErrBannerInvalid)
+		}
+		from = day
+	}
+	return from, to, nil
+}
+
+// respondBannerError 将横幅操作的错误映射为HTTP状态码
+func respondBannerError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrBannerSlotNotFound):
+		standardErrorResponse(c, http.StatusNotFound, "Banner slot not found", err.Error())
+	case errors.Is(err, ErrBannerNotFound):
+		standardErrorResponse(c, http.StatusNotFound, "Banner not found", err.Error())
+	case errors.Is(err, ErrBannerInvalid):
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid banner request", err.Error())
+	case errors.Is(err, ErrBannerConflict):
+		standardErrorResponse(c, http.StatusConflict, "Banner conflict", err.Error())
+	default:
+		standardErrorResponse(c, http.StatusInternalServerError, "Banner operation failed", err.Error())
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// bannerSnapshot 公开读取使用的快照：启用的横幅位及其未结束的active横幅，按展示顺序排好。
+// 开始和结束时间在读取时按当前时间判断，投放时间到达时无需刷新快照
+type bannerSnapshot struct {
+	loadedAt time.Time
+	slots    map[string]*slotBanners
+}
+
+type slotBanners struct {
+	slot    BannerSlot
+	banners []Banner
+}
+
+// BannerViewer 请求横幅的访客，Segments由服务端按登录用户查询，VisitorKey用于稳定地分配A/B变体
+type BannerViewer struct {
+	Role       string
+	City       string
+	Segments   []string
+	VisitorKey string
+}
+
+// ServedBanner 展示给访客的横幅，已合并变体的覆盖字段
+type ServedBanner struct {
+	BannerID    uint   `json:"banner_id"`
+	VariantID   *uint  `json:"variant_id,omitempty"`
+	VariantKey  string `json:"variant_key,omitempty"`
+	SlotCode    string `json:"slot_code"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"image_url"`
+	LinkURL     string `json:"link_url"`
+	Priority    int    `json:"priority"`
+}
+
+// Serve 横幅位当前对该访客展示的横幅，读取缓存快照，不访问数据库
+func (s *BannerService) Serve(slotCode string, viewer BannerViewer) ([]ServedBanner, error) {
+	snapshot, err := s.currentSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	entry, ok := snapshot.slots[slotCode]
+	if !ok {
+		return nil, ErrBannerSlotNotFound
+	}
+
+	now := timeNow()
+	served := make([]ServedBanner, 0, entry.slot.MaxItems)
+	for i := range entry.banners {
+		banner := &entry.banners[i]
+		if !banner.live(now) || !audienceMatches(banner.Audience, viewer) {
+			continue
+		}
+		served = append(served, serveBanner(entry.slot.Code, banner, viewer.VisitorKey))
+		if len(served) == entry.slot.MaxItems {
+			break
+		}
+	}
+	return served, nil
+}
+
+// ServeSlots 一次读取多个横幅位，不存在或已停用的横幅位不出现在结果中
+func (s *BannerService) ServeSlots(slotCodes []string, viewer BannerViewer) (map[string][]ServedBanner, error) {
+	result := make(map[string][]ServedBanner, len(slotCodes))
+	for _, code := range slotCodes {
+		served, err := s.Serve(code, viewer)
+		if errors.Is(err, ErrBannerSlotNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result[code] = served
+	}
+	return result, nil
+}
+
+func serveBanner(slotCode string, banner *Banner, visitorKey string) ServedBanner {
+	served := ServedBanner{
+		BannerID:    banner.ID,
+		SlotCode:    slotCode,
+		Title:       banner.Title,
+		Description: banner.Description,
+		ImageURL:    banner.ImageURL,
+		LinkURL:     banner.LinkURL,
+		Priority:    banner.Priority,
+	}
+	if variant := chooseVariant(banner, visitorKey); variant != nil {
+		id := variant.ID
+		served.VariantID, served.VariantKey = &id, variant.Key
+		if variant.Title != "" {
+			served.Title = variant.Title
+		}
+		if variant.ImageURL != "" {
+			served.ImageURL = variant.ImageURL
+		}
+		if variant.LinkURL != "" {
+			served.LinkURL = variant.LinkURL
+		}
+	}
+	return served
+}
+
+// chooseVariant 按权重选择变体。有访客标识时按标识哈希，同一访客始终看到同一变体
+func chooseVariant(banner *Banner, visitorKey string) *BannerVariant {
+	total := 0
+	for _, variant := range banner.Variants {
+		total += variant.Weight
+	}
+	if total <= 0 {
+		return nil
+	}
+
+	var pick int
+	if visitorKey != "" {
+		h := fnv.New32a()
+		h.Write([]byte(visitorKey + ":" + strconv.FormatUint(uint64(banner.ID), 10)))
+		pick = int(h.Sum32() % uint32(total))
+	} else {
+		pick = rand.Intn(total)
+	}
+	for i := range banner.Variants {
+		pick -= banner.Variants[i].Weight
+		if pick < 0 {
+			return &banner.Variants[i]
+		}
+	}
+	return nil
+}
+
+// audienceMatches 访客是否属于横幅的投放人群
+func audienceMatches(audience BannerAudience, viewer BannerViewer) bool {
+	role := strings.ToLower(strings.TrimSpace(viewer.Role))
+	if role == "" {
+		role = "guest"
+	}
+	if len(audience.Roles) > 0 && !containsTarget(audience.Roles, role) {
+		return false
+	}
+	if len(audience.Cities) > 0 && !containsTarget(audience.Cities, strings.ToLower(strings.TrimSpace(viewer.City))) {
+		return false
+	}
+	if len(audience.Segments) > 0 {
+		for _, segment := range viewer.Segments {
+			if containsTarget(audience.Segments, strings.ToLower(strings.TrimSpace(segment))) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsTarget(targets []string, value string) bool {
+	for _, target := range targets {
+		if target == value {
+			return true
+		}
+	}
+	return false
+}
+
+// BannerUserSegment 登录用户所属的分群，由运营维护。公开接口只按这里的记录判断分群，不接受前端传入
+type BannerUserSegment struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_banner_user_segment"`
+	Segment   string    `json:"segment" gorm:"size:64;not null;uniqueIndex:idx_banner_user_segment"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (BannerUserSegment) TableName() string {
+	return "banner_user_segments"
+}
+
+// UserSegments 用户所属的分群
+func (s *BannerService) UserSegments(userID uint) ([]string, error) {
+	segments := []string{}
+	err := s.db.Model(&BannerUserSegment{}).Where("user_id = ?", userID).Order("segment").Pluck("segment", &segments).Error
+	return segments, err
+}
+
+// SetUserSegments 用给定的分群替换用户的全部分群
+func (s *BannerService) SetUserSegments(userID uint, segments []string) ([]string, error) {
+	if userID == 0 {
+		return nil, fmt.Errorf("%w: 缺少用户ID", ErrBannerInvalid)
+	}
+	segments = normalizeTargets(segments)
+	for _, segment := range segments {
+		if len(segment) > 64 {
+			return nil, fmt.Errorf("%w: 分群名称不能超过64个字符", ErrBannerInvalid)
+		}
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&BannerUserSegment{}).Error; err != nil {
+			return err
+		}
+		now := timeNow()
+		for _, segment := range segments {
+			if err := tx.Create(&BannerUserSegment{UserID: userID, Segment: segment, CreatedAt: now}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.UserSegments(userID)
+}
+
+// currentSnapshot 返回未过期的快照，过期时只有一个请求去数据库加载，其他请求等待后共用结果
+func (s *BannerService) currentSnapshot() (*bannerSnapshot, error) {
+	s.mu.RLock()
+	snapshot := s.snapshot
+	s.mu.RUnlock()
+	if snapshot != nil && timeNow().Sub(snapshot.loadedAt) < s.config.CacheTTL {
+		return snapshot, nil
+	}
+
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+	s.mu.RLock()
+	current, generation := s.snapshot, s.generation
+	s.mu.RUnlock()
+	if current != nil && timeNow().Sub(current.loadedAt) < s.config.CacheTTL {
+		return current, nil
+	}
+
+	loaded, err := s.loadSnapshot()
+	if err != nil {
+		if current == nil {
+			return nil, err
+		}
+		// 数据库暂时不可用时继续使用旧快照，并推迟下一次重试
+		log.Printf("刷新横幅缓存失败，继续使用旧数据: %v", err)
+		stale := *current
+		stale.loadedAt = timeNow()
+		loaded = &stale
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 加载期间有管理操作使缓存失效时，本次结果只用于当前请求
+	if s.generation == generation {
+		s.snapshot = loaded
+	}
+	return loaded, nil
+}
+
+// invalidate 管理操作后清空缓存，下一次读取重新加载
+func (s *BannerService) invalidate() {
+	s.mu.Lock()
+	s.generation++
+	s.snapshot = nil
+	s.mu.Unlock()
+}
+
+func (s *BannerService) loadSnapshot() (*bannerSnapshot, error) {
+	now := timeNow()
+	var slots []BannerSlot
+	if err := s.db.Where("is_active = ?", true).Find(&slots).Error; err != nil {
+		return nil, err
+	}
+	var banners []Banner
+	if err := s.db.Preload("Variants", "is_active = ?", true).
+		Where("status = ? AND (end_at IS NULL OR end_at > ?)", BannerActive, now).
+		Find(&banners).Error; err != nil {
+		return nil, err
+	}
+
+	snapshot := &bannerSnapshot{loadedAt: now, slots: make(map[string]*slotBanners, len(slots))}
+	byID := make(map[uint]*slotBanners, len(slots))
+	for _, slot := range slots {
+		entry := &slotBanners{slot: slot}
+		snapshot.slots[slot.Code] = entry
+		byID[slot.ID] = entry
+	}
+	for _, banner := range banners {
+		if entry, ok := byID[banner.SlotID]; ok {
+			sort.Slice(banner.Variants, func(i, j int) bool { return banner.Variants[i].ID < banner.Variants[j].ID })
+			entry.banners = append(entry.banners, banner)
+		}
+	}
+	for _, entry := range snapshot.slots {
+		sort.Slice(entry.banners, func(i, j int) bool {
+			if entry.banners[i].Priority != entry.banners[j].Priority {
+				return entry.banners[i].Priority > entry.banners[j].Priority
+			}
+			return entry.banners[i].ID > entry.banners[j].ID
+		})
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestBannerService(t *testing.T) (*BannerService, *time.Time) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	config := DefaultBannerConfig()
+	config.CacheTTL = 24 * time.Hour
+	config.Storage.BasePath = t.TempDir()
+	config.VisitorSecret = []byte("test-visitor-secret")
+	service := NewBannerService(db, config)
+	if err := service.AutoMigrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, time.March, 10, 9, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	t.Cleanup(func() { timeNow = time.Now })
+	return service, &now
+}
+
+func createTestBanner(t *testing.T, service *BannerService, in BannerInput) *Banner {
+	t.Helper()
+	banner, err := service.CreateBanner(1, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return banner
+}
+
+func servedIDs(t *testing.T, service *BannerService, slot string, viewer BannerViewer) []uint {
+	t.Helper()
+	served, err := service.Serve(slot, viewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []uint{}
+	for _, banner := range served {
+		ids = append(ids, banner.BannerID)
+	}
+	return ids
+}
+
+func TestBannerServingSchedulesTargetsAndOrders(t *testing.T) {
+	service, now := newTestBannerService(t)
+	slot, err := service.CreateSlot(BannerSlotInput{Code: "home_top", Name: "首页顶部", MaxItems: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.CreateSlot(BannerSlotInput{Code: "home_top", Name: "重复"}); !errors.Is(err, ErrBannerConflict) {
+		t.Fatalf("duplicate slot err = %v", err)
+	}
+
+	later, ended := now.Add(time.Hour), now.Add(3*time.Hour)
+	a := createTestBanner(t, service, BannerInput{SlotID: slot.ID, Title: "通用", Priority: 1, Status: BannerActive})
+	b := createTestBanner(t, service, BannerInput{SlotID: slot.ID, Title: "一小时后开始", Priority: 5, Status: BannerActive, StartAt: &later})
+	c := createTestBanner(t, service, BannerInput{SlotID: slot.ID, Title: "上海求职者", Priority: 3, Status: BannerActive,
+		Audience: BannerAudience{Roles: []string{"JobSeeker"}, Cities: []string{" Shanghai "}}})
+	createTestBanner(t, service, BannerInput{SlotID: slot.ID, Title: "已暂停", Priority: 9, Status: BannerPaused})
+	e := createTestBanner(t, service, BannerInput{SlotID: slot.ID, Title: "会员专享", Priority: 2, Status: BannerActive,
+		EndAt: &ended, Audience: BannerAudience{Segments: []string{"vip"}}})
+	if _, err := service.CreateBanner(1, BannerInput{SlotID: slot.ID, Title: "时间错误", StartAt: &ended, EndAt: &later}); !errors.Is(err, ErrBannerInvalid) {
+		t.Fatalf("invalid schedule err = %v", err)
+	}
+
+	guest := BannerViewer{}
+	member := BannerViewer{Role: "jobseeker", City: "shanghai", Segments: []string{"new", "VIP"}, VisitorKey: "u:7"}
+	if ids := servedIDs(t, service, "home_top", guest); !reflect.DeepEqual(ids, []uint{a.ID}) {
+		t.Fatalf("guest = %v", ids)
+	}
+	if ids := servedIDs(t, service, "home_top", member); !reflect.DeepEqual(ids, []uint{c.ID, e.ID}) {
+		t.Fatalf("member = %v", ids)
+	}
+	if _, err := service.Serve("missing", guest); !errors.Is(err, ErrBannerSlotNotFound) {
+		t.Fatalf("missing slot err = %v", err)
+	}
+
+	// 开始和结束时间在读取时判断，缓存未过期也按时生效
+	*now = later
+	if ids := servedIDs(t, service, "home_top", member); !reflect.DeepEqual(ids, []uint{b.ID, c.ID}) {
+		t.Fatalf("after start = %v", ids)
+	}
+	*now = ended
+	if ids := servedIDs(t, service, "home_top", guest); !reflect.DeepEqual(ids, []uint{b.ID, a.ID}) {
+		t.Fatalf("after end = %v", ids)
+	}
+
+	// 绕过服务直接改库不会立即生效，说明读取走缓存；通过服务修改会立即生效
+	if err := service.db.Model(&Banner{}).Where("id = ?", b.ID).Update("status", BannerPaused).Error; err != nil {
+		t.Fatal(err)
+	}
+	if ids := servedIDs(t, service, "home_top", guest); !reflect.DeepEqual(ids, []uint{b.ID, a.ID}) {
+		t.Fatalf("cached = %v", ids)
+	}
+	if _, err := service.UpdateBanner(a.ID, 2, BannerInput{SlotID: slot.ID, Title: "通用", Priority: 10, Status: BannerActive}); err != nil {
+		t.Fatal(err)
+	}
+	if ids := servedIDs(t, service, "home_top", guest); !reflect.DeepEqual(ids, []uint{a.ID}) {
+		t.Fatalf("after update = %v", ids)
+	}
+	placements, err := service.ServeSlots([]string{"home_top", "missing"}, guest)
+	if err != nil || len(placements) != 1 || len(placements["home_top"]) != 1 {
+		t.Fatalf("placements = %v, %v", placements, err)
+	}
+
+	if err := service.DeleteSlot(slot.ID); !errors.Is(err, ErrBannerConflict) {
+		t.Fatalf("delete used slot err = %v", err)
+	}
+}
+
+func TestBannerVariantsTrackingAndReport(t *testing.T) {
+	service, now := newTestBannerService(t)
+	slot, _ := service.CreateSlot(BannerSlotInput{Code: "home_side", Name: "首页侧栏"})
+	banner := createTestBanner(t, service, BannerInput{SlotID: slot.ID, Title: "春招", LinkURL: "/jobs", Status: BannerActive})
+	control, err := service.AddVariant(banner.ID, BannerVariantInput{Key: "A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	treatment, err := service.AddVariant(banner.ID, BannerVariantInput{Key: "B", Title: "春招火热进行中", LinkURL: "/jobs?from=b", Weight: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.AddVariant(banner.ID, BannerVariantInput{Key: "B"}); !errors.Is(err, ErrBannerConflict) {
+		t.Fatalf("duplicate variant err = %v", err)
+	}
+
+	// 同一访客始终分到同一变体，整体按权重分配
+	assigned := map[uint]int{}
+	for i := 0; i < 400; i++ {
+		viewer := BannerViewer{VisitorKey: "v:visitor-" + strconv.Itoa(i)}
+		first, _ := service.Serve("home_side", viewer)
+		again, _ := service.Serve("home_side", viewer)
+		if *first[0].VariantID != *again[0].VariantID {
+			t.Fatalf("visitor %d switched variants", i)
+		}
+		assigned[*first[0].VariantID]++
+	}
+	if share := float64(assigned[treatment.ID]) / 400; share < 0.65 || share > 0.85 {
+		t.Fatalf("treatment share = %.2f", share)
+	}
+	served, _ := service.Serve("home_side", BannerViewer{VisitorKey: "v:x"})
+	if served[0].VariantKey == "B" && (served[0].Title != "春招火热进行中" || served[0].LinkURL != "/jobs?from=b") {
+		t.Fatalf("variant overrides = %+v", served[0])
+	}
+
+	impression := func(variant *BannerVariant) BannerEventInput {
+		id := variant.ID
+		return BannerEventInput{BannerID: banner.ID, VariantID: &id, Type: BannerImpression, SlotCode: "home_side"}
+	}
+	result, err := service.Track([]BannerEventInput{impression(control), impression(control)}, "v:1", nil)
+	if err != nil || result.Recorded != 1 || result.Duplicates != 1 {
+		t.Fatalf("dedup = %+v, %v", result, err)
+	}
+	for i, visitor := range []string{"v:2", "v:3", "v:4"} {
+		events := []BannerEventInput{impression(treatment)}
+		if i < 2 {
+			click := impression(treatment)
+			click.Type = BannerClick
+			events = append(events, click)
+		}
+		if _, err := service.Track(events, visitor, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := service.Track([]BannerEventInput{impression(control)}, "v:5", nil); err != nil {
+		t.Fatal(err)
+	}
+	link, err := service.TrackClick(banner.ID, &control.ID, "home_side", "v:1", nil)
+	if err != nil || link != "/jobs" {
+		t.Fatalf("click = %s, %v", link, err)
+	}
+	if link, _ := service.TrackClick(banner.ID, &treatment.ID, "home_side", "v:2", nil); link != "/jobs?from=b" {
+		t.Fatalf("variant click link = %s", link)
+	}
+
+	// 去重窗口过后再次曝光会被记录
+	*now = now.Add(31 * time.Minute)
+	if result, _ := service.Track([]BannerEventInput{impression(control)}, "v:1", nil); result.Recorded != 1 {
+		t.Fatalf("next window = %+v", result)
+	}
+	if _, err := service.Track([]BannerEventInput{impression(control)}, "", nil); !errors.Is(err, ErrBannerInvalid) {
+		t.Fatalf("anonymous err = %v", err)
+	}
+	other := uint(999)
+	if _, err := service.Track([]BannerEventInput{{BannerID: banner.ID, VariantID: &other, Type: BannerClick}}, "v:1", nil); !errors.Is(err, ErrBannerInvalid) {
+		t.Fatalf("foreign variant err = %v", err)
+	}
+
+	report, err := service.VariantReport(banner.ID, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 对照组：3次曝光1次点击；实验组：3次曝光2次点击（跳转点击与同窗口上报的点击去重）
+	if len(report.Variants) != 2 || report.Variants[0].Impressions != 3 || report.Variants[0].Clicks != 1 ||
+		report.Variants[1].Impressions != 3 || report.Variants[1].Clicks != 2 {
+		t.Fatalf("report = %+v", report.Variants)
+	}
+	if report.Variants[1].Lift == nil || *report.Variants[1].Lift < 0.99 || *report.Variants[1].Lift > 1.01 ||
+		report.Total.Impressions != 6 || report.Total.Clicks != 3 {
+		t.Fatalf("lift/total = %+v %+v", report.Variants[1], report.Total)
+	}
+
+	// 删除的变体仍然出现在报表中
+	if err := service.DeleteVariant(banner.ID, treatment.ID); err != nil {
+		t.Fatal(err)
+	}
+	report, _ = service.VariantReport(banner.ID, now.Add(-time.Hour), now.Add(time.Hour))
+	if len(report.Variants) != 2 || !report.Variants[1].Deleted || report.Variants[1].Clicks != 2 {
+		t.Fatalf("report after delete = %+v", report.Variants)
+	}
+}
+
+func TestBannerDedupSlidesAcrossWindowBoundaries(t *testing.T) {
+	service, now := newTestBannerService(t)
+	slot, _ := service.CreateSlot(BannerSlotInput{Code: "home_side", Name: "首页侧栏"})
+	banner := createTestBanner(t, service, BannerInput{SlotID: slot.ID, Title: "春招", LinkURL: "/jobs", Status: BannerActive})
+	impression := []BannerEventInput{{BannerID: banner.ID, Type: BannerImpression}}
+	track := func(at time.Time) BannerTrackResult {
+		t.Helper()
+		*now = at
+		result, err := service.Track(impression, "v:1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *result
+	}
+
+	// 默认30分钟去重，9:30是固定窗口的边界
+	if result := track(time.Date(2026, time.March, 10, 9, 29, 59, 0, time.UTC)); result.Recorded != 1 {
+		t.Fatalf("first = %+v", result)
+	}
+	if result := track(time.Date(2026, time.March, 10, 9, 30, 0, 0, time.UTC)); result.Recorded != 0 || result.Duplicates != 1 {
+		t.Fatalf("across boundary = %+v", result)
+	}
+	if result := track(time.Date(2026, time.March, 10, 9, 59, 58, 0, time.UTC)); result.Recorded != 0 {
+		t.Fatalf("within window = %+v", result)
+	}
+	if result := track(time.Date(2026, time.March, 10, 9, 59, 59, 0, time.UTC)); result.Recorded != 1 {
+		t.Fatalf("after window = %+v", result)
+	}
+	// 其他访客不受影响
+	if result, _ := service.Track(impression, "v:2", nil); result.Recorded != 1 {
+		t.Fatalf("other visitor = %+v", result)
+	}
+}
+
+func TestBannerViewerTrustsOnlyServerState(t *testing.T) {
+	service, _ := newTestBannerService(t)
+	slot, _ := service.CreateSlot(BannerSlotInput{Code: "home_top", Name: "首页顶部"})
+	vip := createTestBanner(t, service, BannerInput{SlotID: slot.ID, Title: "会员专享", Status: BannerActive,
+		Audience: BannerAudience{Segments: []string{"vip"}}})
+	if _, err := service.SetUserSegments(7, []string{" VIP ", "vip", "new"}); err != nil {
+		t.Fatal(err)
+	}
+	if segments, _ := service.UserSegments(7); !reflect.DeepEqual(segments, []string{"new", "vip"}) {
+		t.Fatalf("segments = %v", segments)
+	}
+
+	gin.SetMode(gin.TestMode)
+	request := func(userID uint, cookie *http.Cookie) (*gin.Context, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/api/v1/banner/public/slots/home_top?segments=vip&visitor_id=spoofed", nil)
+		if cookie != nil {
+			c.Request.AddCookie(cookie)
+		}
+		if userID != 0 {
+			c.Set("user_id", userID)
+		}
+		return c, w
+	}
+
+	// 匿名访客忽略前端传入的分群和visitor_id，签发签名Cookie
+	c, w := request(0, nil)
+	viewer := bannerViewer(c, service)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != bannerVisitorCookie || !cookies[0].HttpOnly {
+		t.Fatalf("cookies = %+v", cookies)
+	}
+	if len(viewer.Segments) != 0 || viewer.VisitorKey == "v:spoofed" || !strings.HasPrefix(viewer.VisitorKey, "v:") {
+		t.Fatalf("anonymous viewer = %+v", viewer)
+	}
+	if ids := servedIDs(t, service, "home_top", viewer); len(ids) != 0 {
+		t.Fatalf("anonymous served = %v", ids)
+	}
+
+	// 带有效Cookie的访客保持同一标识，不再签发
+	c, w = request(0, cookies[0])
+	if again := visitorKey(c, service); again != viewer.VisitorKey || len(w.Result().Cookies()) != 0 {
+		t.Fatalf("returning visitor = %s, cookies = %v", again, w.Result().Cookies())
+	}
+	// 篡改的Cookie换发新的标识
+	forged := &http.Cookie{Name: bannerVisitorCookie, Value: "attacker." + strings.Split(cookies[0].Value, ".")[1]}
+	c, w = request(0, forged)
+	if key := visitorKey(c, service); key == "v:attacker" || len(w.Result().Cookies()) != 1 {
+		t.Fatalf("forged cookie key = %s", key)
+	}
+
+	// 登录用户按用户ID，分群来自服务端
+	c, w = request(7, nil)
+	member := bannerViewer(c, service)
+	if member.VisitorKey != "u:7" || !reflect.DeepEqual(member.Segments, []string{"new", "vip"}) || len(w.Result().Cookies()) != 0 {
+		t.Fatalf("member = %+v", member)
+	}
+	if ids := servedIDs(t, service, "home_top", member); !reflect.DeepEqual(ids, []uint{vip.ID}) {
+		t.Fatalf("member served = %v", ids)
+	}
+	c, _ = request(8, nil)
+	if other := bannerViewer(c, service); len(other.Segments) != 0 {
+		t.Fatalf("user without segments = %+v", other)
+	}
+}
+
+func testImageHeader(t *testing.T, name string, content []byte) *multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("image", name)
+	part.Write(content)
+	writer.Close()
+	form, err := multipart.NewReader(&body, writer.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+	return form.File["image"][0]
+}
+
+func TestBannerImageUpload(t *testing.T) {
+	service, _ := newTestBannerService(t)
+	slot, _ := service.CreateSlot(BannerSlotInput{Code: "home_top", Name: "首页顶部"})
+	banner := createTestBanner(t, service, BannerInput{SlotID: slot.ID, Title: "春招", Status: BannerActive})
+
+	var encoded bytes.Buffer
+	png.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	ctx := context.Background()
+	first, err := service.SetImage(ctx, banner.ID, 0, testImageHeader(t, "a.png", encoded.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := service.SetImage(ctx, banner.ID, 0, testImageHeader(t, "b.png", encoded.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := service.config.Storage.BasePath
+	if _, err := os.Stat(filepath.Join(base, first.Path)); !os.IsNotExist(err) {
+		t.Fatalf("replaced image still exists: %v", err)
+	}
+	if served, _ := service.Serve("home_top", BannerViewer{}); served[0].ImageURL != second.URL {
+		t.Fatalf("served image = %+v", served)
+	}
+	if _, err := service.SetImage(ctx, banner.ID, 0, testImageHeader(t, "fake.png", []byte("<html>not an image</html>"))); !errors.Is(err, ErrBannerInvalid) {
+		t.Fatalf("fake image err = %v", err)
+	}
+	if _, err := service.SetImage(ctx, banner.ID, 0, testImageHeader(t, "a.svg", encoded.Bytes())); !errors.Is(err, ErrBannerInvalid) {
+		t.Fatalf("disallowed extension err = %v", err)
+	}
+
+	if err := service.DeleteBanner(banner.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(base, second.Path)); !os.IsNotExist(err) {
+		t.Fatalf("deleted banner image still exists: %v", err)
+	}
+}
+
+func TestBannerServingUnderConcurrentUpdates(t *testing.T) {
+	service, _ := newTestBannerService(t)
+	slot, _ := service.CreateSlot(BannerSlotInput{Code: "home_top", Name: "首页顶部", MaxItems: 3})
+	banner := createTestBanner(t, service, BannerInput{SlotID: slot.ID, Title: "春招", Status: BannerActive})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if served, err := service.Serve("home_top", BannerViewer{}); err != nil || len(served) != 1 {
+					t.Errorf("serve = %v, %v", served, err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := service.UpdateBanner(banner.ID, 1, BannerInput{SlotID: slot.ID, Title: "春招", Priority: i, Status: BannerActive}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if served, _ := service.Serve("home_top", BannerViewer{}); served[0].Priority != 9 {
+		t.Fatalf("final = %+v", served)
+	}
+}
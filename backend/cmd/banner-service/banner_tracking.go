@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// 横幅事件类型
+const (
+	BannerImpression = "impression"
+	BannerClick      = "click"
+)
+
+// maxBannerEventBatch 一次上报的事件数上限
+const maxBannerEventBatch = 100
+
+// BannerEvent 曝光或点击记录。写入前检查同一访客在去重时长内是否已有相同事件；
+// DedupKey由事件类型、横幅、变体、访客和固定时间窗口计算，唯一索引拦截并发的重复上报
+type BannerEvent struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	BannerID   uint      `json:"banner_id" gorm:"not null;index:idx_banner_event_banner"`
+	VariantID  *uint     `json:"variant_id,omitempty"`
+	SlotCode   string    `json:"slot_code" gorm:"size:64"`
+	EventType  string    `json:"event_type" gorm:"size:20;not null"`
+	VisitorKey string    `json:"visitor_key" gorm:"size:80;not null;index:idx_banner_event_visitor"`
+	UserID     *uint     `json:"user_id,omitempty"`
+	DedupKey   string    `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	OccurredAt time.Time `json:"occurred_at" gorm:"not null;index:idx_banner_event_banner;index:idx_banner_event_visitor"`
+}
+
+// TableName 指定表名
+func (BannerEvent) TableName() string {
+	return "banner_events"
+}
+
+// BannerEventInput 前端上报的一次曝光或点击
+type BannerEventInput struct {
+	BannerID  uint   `json:"banner_id"`
+	VariantID *uint  `json:"variant_id"`
+	Type      string `json:"type"`
+	SlotCode  string `json:"slot_code"`
+}
+
+// BannerTrackResult 上报结果，Duplicates为去重丢弃的事件数
+type BannerTrackResult struct {
+	Recorded   int `json:"recorded"`
+	Duplicates int `json:"duplicates"`
+}
+
+// Track 记录一批曝光和点击，事件时间取服务端时间
+func (s *BannerService) Track(events []BannerEventInput, visitorKey string, userID *uint) (*BannerTrackResult, error) {
+	if visitorKey == "" {
+		return nil, fmt.Errorf("%w: 缺少访客标识", ErrBannerInvalid)
+	}
+	if len(events) == 0 || len(events) > maxBannerEventBatch {
+		return nil, fmt.Errorf("%w: 每次上报1到%d个事件", ErrBannerInvalid, maxBannerEventBatch)
+	}
+
+	bannerIDs := make([]uint, 0, len(events))
+	for _, event := range events {
+		if event.Type != BannerImpression && event.Type != BannerClick {
+			return nil, fmt.Errorf("%w: 未知的事件类型%s", ErrBannerInvalid, event.Type)
+		}
+		bannerIDs = append(bannerIDs, event.BannerID)
+	}
+	var banners []Banner
+	if err := s.db.Preload("Variants").Where("id IN ?", bannerIDs).Find(&banners).Error; err != nil {
+		return nil, err
+	}
+	variantsByBanner := make(map[uint]map[uint]bool, len(banners))
+	for _, banner := range banners {
+		variants := make(map[uint]bool, len(banner.Variants))
+		for _, variant := range banner.Variants {
+			variants[variant.ID] = true
+		}
+		variantsByBanner[banner.ID] = variants
+	}
+
+	// 按距上次记录的时长去重，跨过固定窗口边界的连续上报也只记录一次
+	now := timeNow()
+	var recent []BannerEvent
+	if err := s.db.Select("banner_id", "variant_id", "event_type").
+		Where("visitor_key = ? AND banner_id IN ? AND occurred_at > ?", visitorKey, bannerIDs, now.Add(-s.config.DedupWindow)).
+		Find(&recent).Error; err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(recent))
+	for _, event := range recent {
+		seen[eventIdentity(event.EventType, event.BannerID, event.VariantID, visitorKey)] = true
+	}
+
+	rows := make([]BannerEvent, 0, len(events))
+	for _, event := range events {
+		variants, ok := variantsByBanner[event.BannerID]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d", ErrBannerNotFound, event.BannerID)
+		}
+		if event.VariantID != nil && !variants[*event.VariantID] {
+			return nil, fmt.Errorf("%w: 变体%d不属于横幅%d", ErrBannerInvalid, *event.VariantID, event.BannerID)
+		}
+		if seen[eventIdentity(event.Type, event.BannerID, event.VariantID, visitorKey)] {
+			continue
+		}
+		rows = append(rows, BannerEvent{
+			BannerID:   event.BannerID,
+			VariantID:  event.VariantID,
+			SlotCode:   event.SlotCode,
+			EventType:  event.Type,
+			VisitorKey: visitorKey,
+			UserID:     userID,
+			DedupKey:   s.dedupKey(event, visitorKey, now),
+			OccurredAt: now,
+		})
+	}
+
+	if len(rows) == 0 {
+		return &BannerTrackResult{Duplicates: len(events)}, nil
+	}
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &BannerTrackResult{Recorded: int(result.RowsAffected), Duplicates: len(events) - int(result.RowsAffected)}, nil
+}
+
+// TrackClick 记录点击并返回跳转链接，有变体链接时跳转到变体链接。没有访客标识时只跳转不记录
+func (s *BannerService) TrackClick(bannerID uint, variantID *uint, slotCode, visitorKey string, userID *uint) (string, error) {
+	banner, err := s.GetBanner(bannerID)
+	if err != nil {
+		return "", err
+	}
+	link := banner.LinkURL
+	if variantID != nil {
+		for _, variant := range banner.Variants {
+			if variant.ID == *variantID && variant.LinkURL != "" {
+				link = variant.LinkURL
+			}
+		}
+	}
+	if link == "" {
+		return "", fmt.Errorf("%w: 横幅没有跳转链接", ErrBannerInvalid)
+	}
+	if visitorKey != "" {
+		event := BannerEventInput{BannerID: bannerID, VariantID: variantID, Type: BannerClick, SlotCode: slotCode}
+		if _, err := s.Track([]BannerEventInput{event}, visitorKey, userID); err != nil {
+			return "", err
+		}
+	}
+	return link, nil
+}
+
+// dedupKey 同一访客、同一横幅变体、同一事件类型在同一固定窗口内得到相同的键。
+// 窗口长度等于去重时长，Track的时长检查放行的事件不会落在同一窗口，唯一索引只拦截并发写入的重复事件
+func (s *BannerService) dedupKey(event BannerEventInput, visitorKey string, at time.Time) string {
+	window := at.UTC().Truncate(s.config.DedupWindow).Unix()
+	identity := eventIdentity(event.Type, event.BannerID, event.VariantID, visitorKey)
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d", identity, window)))
+	return hex.EncodeToString(sum[:])
+}
+
+// eventIdentity 事件类型、横幅、变体和访客组成的去重标识
+func eventIdentity(eventType string, bannerID uint, variantID *uint, visitorKey string) string {
+	variant := "-"
+	if variantID != nil {
+		variant = strconv.FormatUint(uint64(*variantID), 10)
+	}
+	return fmt.Sprintf("%s|%d|%s|%s", eventType, bannerID, variant, visitorKey)
+}
+
+// BannerVariantStats 变体的曝光、点击和点击率，Lift为相对对照组（第一个变体）点击率的提升
+type BannerVariantStats struct {
+	VariantID   *uint    `json:"variant_id,omitempty"`
+	Key         string   `json:"key"`
+	Deleted     bool     `json:"deleted,omitempty"`
+	Impressions int64    `json:"impressions"`
+	Clicks      int64    `json:"clicks"`
+	CTR         float64  `json:"ctr"`
+	Lift        *float64 `json:"lift,omitempty"`
+}
+
+// BannerReport 横幅在[From, To)期间按变体统计的点击率
+type BannerReport struct {
+	BannerID uint                 `json:"banner_id"`
+	From     time.Time            `json:"from"`
+	To       time.Time            `json:"to"`
+	Variants []BannerVariantStats `json:"variants"`
+	Total    BannerVariantStats   `json:"total"`
+}
+
+// VariantReport 按变体统计横幅的曝光和点击，没有变体的横幅统计为default
+func (s *BannerService) VariantReport(bannerID uint, from, to time.Time) (*BannerReport, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("%w: 结束时间必须晚于开始时间", ErrBannerInvalid)
+	}
+	banner, err := s.GetBanner(bannerID)
+	if err != nil {
+		return nil, err
+	}
+
+	var counts []struct {
+		VariantID *uint
+		EventType string
+		Count     int64
+	}
+	if err := s.db.Model(&BannerEvent{}).
+		Select("variant_id, event_type, COUNT(*) AS count").
+		Where("banner_id = ? AND occurred_at >= ? AND occurred_at < ?", bannerID, from, to).
+		Group("variant_id, event_type").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+
+	// 当前变体按ID排在前面，其后是未分配变体的事件和已删除变体的事件
+	stats := make(map[uint]*BannerVariantStats)
+	var ordered []*BannerVariantStats
+	sort.Slice(banner.Variants, func(i, j int) bool { return banner.Variants[i].ID < banner.Variants[j].ID })
+	for _, variant := range banner.Variants {
+		id := variant.ID
+		entry := &BannerVariantStats{VariantID: &id, Key: variant.Key}
+		stats[id] = entry
+		ordered = append(ordered, entry)
+	}
+	defaultStats := &BannerVariantStats{Key: "default"}
+	var deleted []*BannerVariantStats
+	for _, count := range counts {
+		entry := defaultStats
+		if count.VariantID != nil {
+			var ok bool
+			if entry, ok = stats[*count.VariantID]; !ok {
+				id := *count.VariantID
+				entry = &BannerVariantStats{VariantID: &id, Key: fmt.Sprintf("deleted-%d", id), Deleted: true}
+				stats[id] = entry
+				deleted = append(deleted, entry)
+			}
+		}
+		switch count.EventType {
+		case BannerImpression:
+			entry.Impressions += count.Count
+		case BannerClick:
+			entry.Clicks += count.Count
+		}
+	}
+	if len(banner.Variants) == 0 || defaultStats.Impressions > 0 || defaultStats.Clicks > 0 {
+		ordered = append(ordered, defaultStats)
+	}
+	sort.Slice(deleted, func(i, j int) bool { return *deleted[i].VariantID < *deleted[j].VariantID })
+	ordered = append(ordered, deleted...)
+
+	report := &BannerReport{BannerID: bannerID, From: from, To: to, Total: BannerVariantStats{Key: "total"}}
+	for i, entry := range ordered {
+		entry.CTR = clickThroughRate(entry.Clicks, entry.Impressions)
+		if i > 0 && ordered[0].CTR > 0 {
+			lift := entry.CTR/ordered[0].CTR - 1
+			entry.Lift = &lift
+		}
+		report.Total.Impressions += entry.Impressions
+		report.Total.Clicks += entry.Clicks
+		report.Variants = append(report.Variants, *entry)
+	}
+	report.Total.CTR = clickThroughRate(report.Total.Clicks, report.Total.Impressions)
+	return report, nil
+}
+
+func clickThroughRate(clicks, impressions int64) float64 {
+	if impressions == 0 {
+		return 0
+	}
+	return float64(clicks) / float64(impressions)
+}
@@ -43,6 +43,13 @@ func main() {
 	r.GET("/health", healthCheck)
 	r.GET("/info", serviceInfo)
 
+	// 横幅和推广位管理
+	bannerService := NewBannerService(core.GetDB(), DefaultBannerConfig())
+	if err := bannerService.AutoMigrate(); err != nil {
+		log.Printf("横幅数据表迁移失败: %v", err)
+	}
+	setupBannerRoutes(r, core, bannerService)
+
 	// 注册到Consul
 	registerToConsul("banner-service", "127.0.0.1", portInt)
 
@@ -111,3 +118,31 @@ func serviceInfo(c *gin.Context) {
 		"timestamp": time.Now().Format(time.RFC3339),
 	})
 }
+
+// standardSuccessResponse 标准成功响应
+func standardSuccessResponse(c *gin.Context, data interface{}, message ...string) {
+	response := gin.H{
+		"success": true,
+		"data":    data,
+		"service": "banner-service",
+		"time":    time.Now().Format(time.RFC3339),
+	}
+	if len(message) > 0 {
+		response["message"] = message[0]
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// standardErrorResponse 标准错误响应
+func standardErrorResponse(c *gin.Context, statusCode int, message string, details ...string) {
+	response := gin.H{
+		"success": false,
+		"error":   message,
+		"service": "banner-service",
+		"time":    time.Now().Format(time.RFC3339),
+	}
+	if len(details) > 0 {
+		response["details"] = details[0]
+	}
+	c.JSON(statusCode, response)
+}
@@ -0,0 +1,1095 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBillingNotFound         = errors.New("billing record not found")
+	ErrBillingInvalid          = errors.New("invalid billing request")
+	ErrBillingConflict         = errors.New("billing event conflicts with an existing record")
+	ErrBillingNothingToInvoice = errors.New("nothing to invoice for this period")
+)
+
+// 账单状态
+const (
+	AIInvoicePreview           = "preview" // 当前账期的预估，不落库
+	AIInvoiceIssued            = "issued"
+	AIInvoicePartiallyRefunded = "partially_refunded"
+	AIInvoiceRefunded          = "refunded"
+)
+
+// 账单明细类型
+const (
+	AIInvoiceLineSubscription = "subscription" // 套餐月费，按账期内的使用时长折算
+	AIInvoiceLineUsage        = "usage"
+	AIInvoiceLineDiscount     = "discount" // 阶梯折扣，金额为负
+	AIInvoiceLineData         = "data"     // 数据处理费
+	AIInvoiceLineCredit       = "credit"   // 账户抵扣，金额为负
+)
+
+// 抵扣额度来源
+const (
+	AICreditManual = "manual"
+	AICreditRefund = "refund" // 账单退款转为抵扣额度
+)
+
+const (
+	aiBillingCurrency       = "CNY"
+	aiBillingPeriodLayout   = "2006-01"
+	aiBillingDataCentsPerMB = 1 // 数据处理费每MB 0.01元
+	aiBillingDefaultPlan    = "basic"
+)
+
+// aiServiceLevelNames 可订阅的服务层级
+var aiServiceLevelNames = map[string]string{
+	"basic":      "基础版",
+	"premium":    "高级版",
+	"enterprise": "企业版",
+}
+
+// AIBillingSubscription 用户的套餐区间，变更套餐时结束当前区间并开始新区间，
+// 没有记录的用户按基础版计
+type AIBillingSubscription struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	EventID   string     `json:"event_id" gorm:"size:64;uniqueIndex"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	Plan      string     `json:"plan" gorm:"size:20;not null"`
+	StartAt   time.Time  `json:"start_at" gorm:"not null"`
+	EndAt     *time.Time `json:"end_at" gorm:"index"`
+	ChangedBy uint       `json:"changed_by"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (AIBillingSubscription) TableName() string {
+	return "ai_billing_subscriptions"
+}
+
+// AIBillingCredit 账户抵扣额度，出账时按发放先后抵扣账单金额，金额单位为分
+type AIBillingCredit struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	EventID   string    `json:"event_id" gorm:"size:80;uniqueIndex"` // 退款转入的额度为"refund:"加退款事件ID
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	Source    string    `json:"source" gorm:"size:20;not null"`
+	Amount    int64     `json:"amount" gorm:"not null"`
+	Remaining int64     `json:"remaining" gorm:"not null"`
+	Reason    string    `json:"reason" gorm:"size:255"`
+	InvoiceID *uint     `json:"invoice_id"` // 退款转入时对应的账单
+	CreatedBy uint      `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (AIBillingCredit) TableName() string {
+	return "ai_billing_credits"
+}
+
+// AIBillingInvoice 月度账单，每个用户每个账期一张，金额单位为分
+type AIBillingInvoice struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	Number        string    `json:"number" gorm:"size:32;uniqueIndex"`
+	UserID        uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_ai_invoice_user_period"`
+	Period        string    `json:"period" gorm:"size:7;not null;uniqueIndex:idx_ai_invoice_user_period"`
+	PeriodStart   time.Time `json:"period_start"`
+	PeriodEnd     time.Time `json:"period_end"`
+	Currency      string    `json:"currency" gorm:"size:3"`
+	Subtotal      int64     `json:"subtotal"`       // 折扣和抵扣前的金额
+	Discount      int64     `json:"discount"`       // 阶梯折扣
+	CreditApplied int64     `json:"credit_applied"` // 账户抵扣
+	Total         int64     `json:"total"`          // 应付金额
+	Refunded      int64     `json:"refunded"`
+	Status        string    `json:"status" gorm:"size:20;not null;index"`
+	IssuedAt      time.Time `json:"issued_at"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	Lines   []AIBillingInvoiceLine `json:"lines" gorm:"foreignKey:InvoiceID"`
+	Refunds []AIBillingRefund      `json:"refunds,omitempty" gorm:"foreignKey:InvoiceID"`
+}
+
+// TableName 指定表名
+func (AIBillingInvoice) TableName() string {
+	return "ai_billing_invoices"
+}
+
+// AIBillingInvoiceLine 账单明细
+type AIBillingInvoiceLine struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	InvoiceID   uint       `json:"invoice_id" gorm:"not null;index"`
+	Type        string     `json:"type" gorm:"size:20;not null"`
+	ServiceID   string     `json:"service_id,omitempty" gorm:"size:100"`
+	FeatureID   string     `json:"feature_id,omitempty" gorm:"size:100"`
+	Description string     `json:"description" gorm:"size:255"`
+	Quantity    int64      `json:"quantity"`
+	UnitPrice   int64      `json:"unit_price"`
+	Amount      int64      `json:"amount"`
+	PeriodStart *time.Time `json:"period_start,omitempty"`
+	PeriodEnd   *time.Time `json:"period_end,omitempty"`
+	CreditID    *uint      `json:"credit_id,omitempty"`
+}
+
+// TableName 指定表名
+func (AIBillingInvoiceLine) TableName() string {
+	return "ai_billing_invoice_lines"
+}
+
+// AIBillingRefund 账单退款，原路退回或转为账户抵扣额度
+type AIBillingRefund struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	EventID   string    `json:"event_id" gorm:"size:64;uniqueIndex"`
+	InvoiceID uint      `json:"invoice_id" gorm:"not null;index"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	Amount    int64     `json:"amount" gorm:"not null"`
+	Reason    string    `json:"reason" gorm:"size:255"`
+	AsCredit  bool      `json:"as_credit"`
+	CreditID  *uint     `json:"credit_id,omitempty"`
+	CreatedBy uint      `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (AIBillingRefund) TableName() string {
+	return "ai_billing_refunds"
+}
+
+// AIBillingConfig 计费配置
+type AIBillingConfig struct {
+	Location *time.Location // 账期按该时区的自然月划分
+}
+
+// DefaultAIBillingConfig 默认按北京时间划分账期，可通过AI_BILLING_TIMEZONE配置
+func DefaultAIBillingConfig() AIBillingConfig {
+	name := os.Getenv("AI_BILLING_TIMEZONE")
+	if name == "" {
+		name = "Asia/Shanghai"
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		location = time.FixedZone("CST", 8*3600)
+	}
+	return AIBillingConfig{Location: location}
+}
+
+// AIBillingService AI服务计费：用量事件按价目表计价，按月出账，处理套餐变更折算、
+// 抵扣额度和退款。用量、套餐变更、抵扣和退款都以事件ID去重，重放不会重复计费
+type AIBillingService struct {
+	db     *gorm.DB
+	prices *AIServiceLayeringManager
+	config AIBillingConfig
+}
+
+// NewAIBillingService 创建计费服务，prices提供服务价目表
+func NewAIBillingService(db *gorm.DB, prices *AIServiceLayeringManager, config AIBillingConfig) *AIBillingService {
+	if config.Location == nil {
+		config.Location = time.UTC
+	}
+	return &AIBillingService{db: db, prices: prices, config: config}
+}
+
+// AutoMigrate 创建计费相关的表
+func (s *AIBillingService) AutoMigrate() error {
+	return s.db.AutoMigrate(&UserServiceUsage{}, &AIBillingSubscription{}, &AIBillingCredit{},
+		&AIBillingInvoice{}, &AIBillingInvoiceLine{}, &AIBillingRefund{})
+}
+
+// StartScheduler 定期为上一个账期出账，已出账的用户会被跳过
+func (s *AIBillingService) StartScheduler(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		lastPeriod := ""
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				current, _, _ := s.periodBounds(s.periodOf(timeNow()))
+				period := s.periodOf(current.AddDate(0, -1, 0))
+				if period == lastPeriod {
+					continue
+				}
+				result, err := s.RunBillingCycle(period)
+				if err != nil {
+					log.Printf("AI服务账期%s出账失败: %v", period, err)
+					continue
+				}
+				if result.Generated > 0 || len(result.Failed) > 0 {
+					log.Printf("AI服务账期%s出账: %d张新账单, %d个用户失败", period, result.Generated, len(result.Failed))
+				}
+				if len(result.Failed) == 0 {
+					lastPeriod = period
+				}
+			}
+		}
+	}()
+}
+
+// periodOf 时间所在的账期
+func (s *AIBillingService) periodOf(t time.Time) string {
+	return t.In(s.config.Location).Format(aiBillingPeriodLayout)
+}
+
+// periodBounds 账期的起止时间，period格式为YYYY-MM
+func (s *AIBillingService) periodBounds(period string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation(aiBillingPeriodLayout, period, s.config.Location)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: 账期格式应为YYYY-MM", ErrBillingInvalid)
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// UsageEventInput 一次AI服务调用的用量事件
+type UsageEventInput struct {
+	EventID            string     `json:"event_id" binding:"required,max=64"`
+	UserID             uint       `json:"user_id"`
+	ServiceID          string     `json:"service_id" binding:"required"`
+	FeatureID          string     `json:"feature_id"`
+	RequestType        string     `json:"request_type"`
+	DataSize           int64      `json:"data_size"`
+	ProcessingTime     int64      `json:"processing_time"`
+	AuthorizationLevel string     `json:"authorization_level"`
+	Anonymized         bool       `json:"anonymized"`
+	OccurredAt         *time.Time `json:"occurred_at"` // 为空时取接收时间
+}
+
+// RecordUsage 记录用量事件。相同事件ID重放时返回已有记录且duplicate为true，
+// 同一事件ID的内容不一致时返回ErrBillingConflict
+func (s *AIBillingService) RecordUsage(input UsageEventInput) (*UserServiceUsage, bool, error) {
+	if input.EventID == "" || len(input.EventID) > 64 {
+		return nil, false, fmt.Errorf("%w: 事件ID不能为空且不超过64个字符", ErrBillingInvalid)
+	}
+	if input.UserID == 0 {
+		return nil, false, fmt.Errorf("%w: 缺少用户ID", ErrBillingInvalid)
+	}
+	if input.DataSize < 0 || input.ProcessingTime < 0 {
+		return nil, false, fmt.Errorf("%w: 数据大小和处理时间不能为负", ErrBillingInvalid)
+	}
+	service, exists := s.prices.GetService(input.ServiceID)
+	if !exists {
+		return nil, false, fmt.Errorf("%w: 服务不存在: %s", ErrBillingInvalid, input.ServiceID)
+	}
+	if input.FeatureID != "" {
+		if _, priced := service.Pricing.PricePerFeature[input.FeatureID]; !priced {
+			return nil, false, fmt.Errorf("%w: 服务%s没有功能%s", ErrBillingInvalid, input.ServiceID, input.FeatureID)
+		}
+	}
+	now := timeNow()
+	occurredAt := now
+	if input.OccurredAt != nil {
+		occurredAt = *input.OccurredAt
+		if occurredAt.After(now.Add(5 * time.Minute)) {
+			return nil, false, fmt.Errorf("%w: 事件时间晚于当前时间", ErrBillingInvalid)
+		}
+	}
+
+	if existing, err := s.findUsage(input.EventID); err != nil || existing != nil {
+		if err != nil {
+			return nil, false, err
+		}
+		return existing, true, sameUsage(existing, input)
+	}
+
+	usage := UserServiceUsage{
+		EventID:            input.EventID,
+		UserID:             input.UserID,
+		ServiceID:          input.ServiceID,
+		FeatureID:          input.FeatureID,
+		RequestType:        input.RequestType,
+		DataSize:           input.DataSize,
+		ProcessingTime:     input.ProcessingTime,
+		Cost:               float64(usageUnitPrice(service, input.FeatureID)) / 100,
+		AuthorizationLevel: input.AuthorizationLevel,
+		Anonymized:         input.Anonymized,
+		CreatedAt:          occurredAt,
+	}
+	if err := s.db.Create(&usage).Error; err != nil {
+		// 并发重放撞上唯一索引时返回先写入的记录
+		if existing, findErr := s.findUsage(input.EventID); findErr == nil && existing != nil {
+			return existing, true, sameUsage(existing, input)
+		}
+		return nil, false, err
+	}
+	return &usage, false, nil
+}
+
+func (s *AIBillingService) findUsage(eventID string) (*UserServiceUsage, error) {
+	var usage UserServiceUsage
+	err := s.db.Where("event_id = ?", eventID).First(&usage).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// sameUsage 重放的事件必须与已记录的计费要素一致
+func sameUsage(existing *UserServiceUsage, input UsageEventInput) error {
+	if existing.UserID != input.UserID || existing.ServiceID != input.ServiceID ||
+		existing.FeatureID != input.FeatureID || existing.DataSize != input.DataSize {
+		return fmt.Errorf("%w: 事件%s已以不同内容记录", ErrBillingConflict, input.EventID)
+	}
+	return nil
+}
+
+// yuanToCents 价目表以元为单位，计费统一换算为分
+func yuanToCents(v float64) int64 {
+	return int64(math.Round(v * 100))
+}
+
+// usageUnitPrice 单次请求的标价（分）：按请求价格加功能价格
+func usageUnitPrice(service AIService, featureID string) int64 {
+	return yuanToCents(service.Pricing.PricePerRequest) + yuanToCents(service.Pricing.PricePerFeature[featureID])
+}
+
+// discountTierFor 账期内第n次请求所在的折扣层级，MaxRequests为0表示不设上限
+func discountTierFor(tiers []DiscountTier, n int) (int, bool) {
+	for i, tier := range tiers {
+		if n >= tier.MinRequests && (tier.MaxRequests == 0 || n <= tier.MaxRequests) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+type usageAggregate struct {
+	total, free, billable int64
+	unitPrice, amount     int64
+}
+
+type discountAggregate struct {
+	count int64
+	cents float64
+}
+
+// rateUsage 按价目表计价。每个服务的用量按发生先后编号，前FreeRequests次免费，
+// 之后每次按编号所在的阶梯享受折扣；数据处理费按服务汇总后向上取整到MB。
+// prior为各服务在同一账期内已计价的次数，编号接着已计价的用量继续
+func (s *AIBillingService) rateUsage(usages []UserServiceUsage, prior map[string]int) []AIBillingInvoiceLine {
+	sort.SliceStable(usages, func(i, j int) bool {
+		if !usages[i].CreatedAt.Equal(usages[j].CreatedAt) {
+			return usages[i].CreatedAt.Before(usages[j].CreatedAt)
+		}
+		return usages[i].ID < usages[j].ID
+	})
+	byService := make(map[string][]UserServiceUsage)
+	var serviceIDs []string
+	for _, usage := range usages {
+		if _, seen := byService[usage.ServiceID]; !seen {
+			serviceIDs = append(serviceIDs, usage.ServiceID)
+		}
+		byService[usage.ServiceID] = append(byService[usage.ServiceID], usage)
+	}
+	sort.Strings(serviceIDs)
+
+	var lines []AIBillingInvoiceLine
+	for _, serviceID := range serviceIDs {
+		service, exists := s.prices.GetService(serviceID)
+		if !exists {
+			service = AIService{ServiceID: serviceID, ServiceName: serviceID}
+		}
+		features := make(map[string]*usageAggregate)
+		var featureIDs []string
+		discounts := make(map[int]*discountAggregate)
+		var dataBytes int64
+
+		for i, usage := range byService[serviceID] {
+			n := prior[serviceID] + i
+			agg, seen := features[usage.FeatureID]
+			if !seen {
+				agg = &usageAggregate{unitPrice: usageUnitPrice(service, usage.FeatureID)}
+				features[usage.FeatureID] = agg
+				featureIDs = append(featureIDs, usage.FeatureID)
+			}
+			dataBytes += usage.DataSize
+			agg.total++
+			if n < service.Pricing.FreeRequests {
+				agg.free++
+				continue
+			}
+			agg.billable++
+			agg.amount += agg.unitPrice
+			if tier, ok := discountTierFor(service.Pricing.DiscountTiers, n+1); ok && service.Pricing.DiscountTiers[tier].DiscountRate > 0 {
+				d, seen := discounts[tier]
+				if !seen {
+					d = &discountAggregate{}
+					discounts[tier] = d
+				}
+				d.count++
+				d.cents += float64(agg.unitPrice) * service.Pricing.DiscountTiers[tier].DiscountRate
+			}
+		}
+
+		sort.Strings(featureIDs)
+		for _, featureID := range featureIDs {
+			agg := features[featureID]
+			description := service.ServiceName
+			if name := featureName(service, featureID); name != "" {
+				description += " - " + name
+			}
+			description += fmt.Sprintf("（共%d次", agg.total)
+			if agg.free > 0 {
+				description += fmt.Sprintf("，免费%d次", agg.free)
+			}
+			description += "）"
+			lines = append(lines, AIBillingInvoiceLine{
+				Type:        AIInvoiceLineUsage,
+				ServiceID:   serviceID,
+				FeatureID:   featureID,
+				Description: description,
+				Quantity:    agg.billable,
+				UnitPrice:   agg.unitPrice,
+				Amount:      agg.amount,
+			})
+		}
+
+		for tier, tierDef := range service.Pricing.DiscountTiers {
+			d, ok := discounts[tier]
+			if !ok {
+				continue
+			}
+			description := tierDef.Description
+			if description == "" {
+				description = fmt.Sprintf("阶梯折扣%.0f%%", tierDef.DiscountRate*100)
+			}
+			lines = append(lines, AIBillingInvoiceLine{
+				Type:        AIInvoiceLineDiscount,
+				ServiceID:   serviceID,
+				Description: service.ServiceName + " - " + description,
+				Quantity:    d.count,
+				Amount:      -int64(math.Round(d.cents)),
+			})
+		}
+
+		if dataBytes > 0 {
+			mb := (dataBytes + 1024*1024 - 1) / (1024 * 1024)
+			lines = append(lines, AIBillingInvoiceLine{
+				Type:        AIInvoiceLineData,
+				ServiceID:   serviceID,
+				Description: service.ServiceName + " - 数据处理（MB）",
+				Quantity:    mb,
+				UnitPrice:   aiBillingDataCentsPerMB,
+				Amount:      mb * aiBillingDataCentsPerMB,
+			})
+		}
+	}
+	return lines
+}
+
+func featureName(service AIService, featureID string) string {
+	for _, feature := range service.Features {
+		if feature.FeatureID == featureID {
+			return feature.FeatureName
+		}
+	}
+	return featureID
+}
+
+// subscriptionLines 账期内的各套餐区间按使用时长占账期的比例折算月费
+func (s *AIBillingService) subscriptionLines(subscriptions []AIBillingSubscription, start, end time.Time) []AIBillingInvoiceLine {
+	var lines []AIBillingInvoiceLine
+	cycle := end.Sub(start)
+	for _, sub := range subscriptions {
+		from, to := sub.StartAt, end
+		if sub.EndAt != nil && sub.EndAt.Before(end) {
+			to = *sub.EndAt
+		}
+		if from.Before(start) {
+			from = start
+		}
+		fee := yuanToCents(s.prices.PlanFee(sub.Plan))
+		if !to.After(from) || fee == 0 {
+			continue
+		}
+		used := to.Sub(from)
+		amount := int64(math.Round(float64(fee) * float64(used) / float64(cycle)))
+		description := fmt.Sprintf("%s月费 %s至%s", aiServiceLevelNames[sub.Plan],
+			from.In(s.config.Location).Format("01-02"), to.Add(-time.Second).In(s.config.Location).Format("01-02"))
+		if used < cycle {
+			description += fmt.Sprintf("（按%.1f/%.0f天折算）", used.Hours()/24, cycle.Hours()/24)
+		}
+		periodStart, periodEnd := from, to
+		lines = append(lines, AIBillingInvoiceLine{
+			Type:        AIInvoiceLineSubscription,
+			Description: description,
+			Quantity:    1,
+			UnitPrice:   fee,
+			Amount:      amount,
+			PeriodStart: &periodStart,
+			PeriodEnd:   &periodEnd,
+		})
+	}
+	return lines
+}
+
+// invoiceDraft 计算出的账单及出账时需要标记的用量和抵扣
+type invoiceDraft struct {
+	invoice  AIBillingInvoice
+	usageIDs []uint
+	credits  map[uint]int64 // 抵扣额度ID -> 本次抵扣金额
+}
+
+// buildInvoice 计算账单：账期内的套餐费用、截至账期结束尚未出账的用量以及可用的抵扣额度。
+// 迟到的上期用量按所属账期计价，免费次数和阶梯接着该账期已出账的用量编号，单独列为补计明细
+func (s *AIBillingService) buildInvoice(tx *gorm.DB, userID uint, start, end time.Time) (*invoiceDraft, error) {
+	var usages []UserServiceUsage
+	if err := tx.Where("user_id = ? AND invoice_id IS NULL AND created_at < ?", userID, end).
+		Order("created_at, id").Find(&usages).Error; err != nil {
+		return nil, err
+	}
+	var subscriptions []AIBillingSubscription
+	if err := tx.Where("user_id = ? AND start_at < ? AND (end_at IS NULL OR end_at > ?)", userID, end, start).
+		Order("start_at, id").Find(&subscriptions).Error; err != nil {
+		return nil, err
+	}
+
+	draft := &invoiceDraft{credits: make(map[uint]int64)}
+	invoice := &draft.invoice
+	invoice.UserID = userID
+	invoice.Period = s.periodOf(start)
+	invoice.PeriodStart = start
+	invoice.PeriodEnd = end
+	invoice.Currency = aiBillingCurrency
+	var current []UserServiceUsage
+	late := make(map[string][]UserServiceUsage)
+	var latePeriods []string
+	for _, usage := range usages {
+		draft.usageIDs = append(draft.usageIDs, usage.ID)
+		if !usage.CreatedAt.Before(start) {
+			current = append(current, usage)
+			continue
+		}
+		period := s.periodOf(usage.CreatedAt)
+		if _, seen := late[period]; !seen {
+			latePeriods = append(latePeriods, period)
+		}
+		late[period] = append(late[period], usage)
+	}
+	invoice.Lines = append(s.subscriptionLines(subscriptions, start, end), s.rateUsage(current, nil)...)
+	sort.Strings(latePeriods)
+	for _, period := range latePeriods {
+		lines, err := s.rateLateUsage(tx, userID, period, late[period])
+		if err != nil {
+			return nil, err
+		}
+		invoice.Lines = append(invoice.Lines, lines...)
+	}
+	for _, line := range invoice.Lines {
+		if line.Type == AIInvoiceLineDiscount {
+			invoice.Discount -= line.Amount
+		} else {
+			invoice.Subtotal += line.Amount
+		}
+	}
+	invoice.Total = invoice.Subtotal - invoice.Discount
+
+	if invoice.Total > 0 {
+		var credits []AIBillingCredit
+		if err := tx.Where("user_id = ? AND remaining > 0", userID).Order("created_at, id").Find(&credits).Error; err != nil {
+			return nil, err
+		}
+		for _, credit := range credits {
+			if invoice.Total == 0 {
+				break
+			}
+			applied := credit.Remaining
+			if applied > invoice.Total {
+				applied = invoice.Total
+			}
+			creditID := credit.ID
+			invoice.Lines = append(invoice.Lines, AIBillingInvoiceLine{
+				Type:        AIInvoiceLineCredit,
+				Description: "账户抵扣：" + credit.Reason,
+				Quantity:    1,
+				UnitPrice:   -applied,
+				Amount:      -applied,
+				CreditID:    &creditID,
+			})
+			draft.credits[credit.ID] = applied
+			invoice.CreditApplied += applied
+			invoice.Total -= applied
+		}
+	}
+	return draft, nil
+}
+
+// rateLateUsage 按所属账期计价迟到的用量，明细注明补计的账期
+func (s *AIBillingService) rateLateUsage(tx *gorm.DB, userID uint, period string, usages []UserServiceUsage) ([]AIBillingInvoiceLine, error) {
+	start, end, err := s.periodBounds(period)
+	if err != nil {
+		return nil, err
+	}
+	var counts []struct {
+		ServiceID string
+		Count     int
+	}
+	if err := tx.Model(&UserServiceUsage{}).Select("service_id, COUNT(*) AS count").
+		Where("user_id = ? AND invoice_id IS NOT NULL AND created_at >= ? AND created_at < ?", userID, start, end).
+		Group("service_id").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	prior := make(map[string]int, len(counts))
+	for _, c := range counts {
+		prior[c.ServiceID] = c.Count
+	}
+
+	lines := s.rateUsage(usages, prior)
+	for i := range lines {
+		lines[i].Description = fmt.Sprintf("%s账期补计：%s", period, lines[i].Description)
+		lines[i].PeriodStart, lines[i].PeriodEnd = &start, &end
+	}
+	return lines, nil
+}
+
+// PreviewInvoice 当前账期截至目前的预估账单，不落库也不占用抵扣额度
+func (s *AIBillingService) PreviewInvoice(userID uint) (*AIBillingInvoice, error) {
+	start, end, _ := s.periodBounds(s.periodOf(timeNow()))
+	draft, err := s.buildInvoice(s.db, userID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	draft.invoice.Status = AIInvoicePreview
+	return &draft.invoice, nil
+}
+
+// GenerateInvoice 为已结束的账期出账。账单已存在时直接返回，重复调用不会重复计费
+func (s *AIBillingService) GenerateInvoice(userID uint, period string) (*AIBillingInvoice, error) {
+	start, end, err := s.periodBounds(period)
+	if err != nil {
+		return nil, err
+	}
+	if end.After(timeNow()) {
+		return nil, fmt.Errorf("%w: 账期%s尚未结束", ErrBillingInvalid, period)
+	}
+	if existing, err := s.findInvoice(userID, period); err != nil || existing != nil {
+		return existing, err
+	}
+
+	var invoiceID uint
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		draft, err := s.buildInvoice(tx, userID, start, end)
+		if err != nil {
+			return err
+		}
+		if len(draft.invoice.Lines) == 0 {
+			return ErrBillingNothingToInvoice
+		}
+		invoice := draft.invoice
+		invoice.Number = fmt.Sprintf("AI%s%08d", start.Format("200601"), userID)
+		invoice.Status = AIInvoiceIssued
+		invoice.IssuedAt = timeNow()
+		if err := tx.Create(&invoice).Error; err != nil {
+			return err
+		}
+
+		// 条件更新保证并发出账时用量和抵扣额度只被一张账单占用
+		if len(draft.usageIDs) > 0 {
+			result := tx.Model(&UserServiceUsage{}).Where("id IN ? AND invoice_id IS NULL", draft.usageIDs).
+				Update("invoice_id", invoice.ID)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected != int64(len(draft.usageIDs)) {
+				return fmt.Errorf("%w: 用量已被其他账单计入", ErrBillingConflict)
+			}
+		}
+		for creditID, applied := range draft.credits {
+			result := tx.Model(&AIBillingCredit{}).Where("id = ? AND remaining >= ?", creditID, applied).
+				Update("remaining", gorm.Expr("remaining - ?", applied))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected != 1 {
+				return fmt.Errorf("%w: 抵扣额度已被使用", ErrBillingConflict)
+			}
+		}
+		invoiceID = invoice.ID
+		return nil
+	})
+	if err != nil {
+		// 并发出账时另一方已经写入了账单
+		if existing, findErr := s.findInvoice(userID, period); findErr == nil && existing != nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return s.GetInvoice(invoiceID)
+}
+
+func (s *AIBillingService) findInvoice(userID uint, period string) (*AIBillingInvoice, error) {
+	var invoice AIBillingInvoice
+	err := s.db.Where("user_id = ? AND period = ?", userID, period).First(&invoice).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetInvoice(invoice.ID)
+}
+
+// BillingCycleResult 一次批量出账的结果
+type BillingCycleResult struct {
+	Period    string          `json:"period"`
+	Generated int             `json:"generated"`
+	Existing  int             `json:"existing"`
+	Failed    map[uint]string `json:"failed,omitempty"`
+}
+
+// RunBillingCycle 为账期内有用量或付费套餐的所有用户出账，可重复执行
+func (s *AIBillingService) RunBillingCycle(period string) (*BillingCycleResult, error) {
+	start, end, err := s.periodBounds(period)
+	if err != nil {
+		return nil, err
+	}
+	if end.After(timeNow()) {
+		return nil, fmt.Errorf("%w: 账期%s尚未结束", ErrBillingInvalid, period)
+	}
+
+	var usageUsers, subscriptionUsers, invoicedUsers []uint
+	if err := s.db.Model(&UserServiceUsage{}).Where("invoice_id IS NULL AND created_at < ?", end).
+		Distinct().Pluck("user_id", &usageUsers).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&AIBillingSubscription{}).Where("start_at < ? AND (end_at IS NULL OR end_at > ?)", end, start).
+		Distinct().Pluck("user_id", &subscriptionUsers).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&AIBillingInvoice{}).Where("period = ?", period).Pluck("user_id", &invoicedUsers).Error; err != nil {
+		return nil, err
+	}
+
+	invoiced := make(map[uint]bool, len(invoicedUsers))
+	for _, userID := range invoicedUsers {
+		invoiced[userID] = true
+	}
+	result := &BillingCycleResult{Period: period, Existing: len(invoicedUsers)}
+	seen := make(map[uint]bool)
+	for _, userID := range append(usageUsers, subscriptionUsers...) {
+		if seen[userID] || invoiced[userID] {
+			continue
+		}
+		seen[userID] = true
+		if _, err := s.GenerateInvoice(userID, period); err != nil {
+			if errors.Is(err, ErrBillingNothingToInvoice) {
+				continue
+			}
+			if result.Failed == nil {
+				result.Failed = make(map[uint]string)
+			}
+			result.Failed[userID] = err.Error()
+			continue
+		}
+		result.Generated++
+	}
+	return result, nil
+}
+
+// GetInvoice 账单详情，包括明细和退款
+func (s *AIBillingService) GetInvoice(invoiceID uint) (*AIBillingInvoice, error) {
+	var invoice AIBillingInvoice
+	err := s.db.Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Refunds", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		First(&invoice, invoiceID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: 账单%d不存在", ErrBillingNotFound, invoiceID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// ListInvoices 用户的账单，最近的账期在前
+func (s *AIBillingService) ListInvoices(userID uint) ([]AIBillingInvoice, error) {
+	var invoices []AIBillingInvoice
+	err := s.db.Where("user_id = ?", userID).Order("period DESC").Find(&invoices).Error
+	return invoices, err
+}
+
+// PlanChangeInput 套餐变更
+type PlanChangeInput struct {
+	EventID     string     `json:"event_id" binding:"required,max=64"`
+	Plan        string     `json:"plan" binding:"required,oneof=basic premium enterprise"`
+	EffectiveAt *time.Time `json:"effective_at"` // 为空时立即生效，不能早于已出账的账期
+}
+
+// CurrentPlan 用户当前的套餐，没有订阅记录时为基础版
+func (s *AIBillingService) CurrentPlan(userID uint) (string, error) {
+	var sub AIBillingSubscription
+	err := s.db.Where("user_id = ? AND end_at IS NULL", userID).First(&sub).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return aiBillingDefaultPlan, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return sub.Plan, nil
+}
+
+// ChangePlan 变更套餐：结束当前套餐区间并开始新区间，出账时两个区间按时长折算月费。
+// 相同事件ID重放时返回已有记录
+func (s *AIBillingService) ChangePlan(userID, actorID uint, input PlanChangeInput) (*AIBillingSubscription, error) {
+	if input.EventID == "" || len(input.EventID) > 64 {
+		return nil, fmt.Errorf("%w: 事件ID不能为空且不超过64个字符", ErrBillingInvalid)
+	}
+	if _, ok := aiServiceLevelNames[input.Plan]; !ok {
+		return nil, fmt.Errorf("%w: 未知套餐%s", ErrBillingInvalid, input.Plan)
+	}
+	var existing AIBillingSubscription
+	if err := s.db.Where("event_id = ?", input.EventID).First(&existing).Error; err == nil {
+		if existing.UserID != userID || existing.Plan != input.Plan {
+			return nil, fmt.Errorf("%w: 事件%s已以不同内容记录", ErrBillingConflict, input.EventID)
+		}
+		return &existing, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	now := timeNow()
+	effectiveAt := now
+	if input.EffectiveAt != nil {
+		effectiveAt = *input.EffectiveAt
+		if effectiveAt.After(now) {
+			return nil, fmt.Errorf("%w: 不支持预约变更套餐", ErrBillingInvalid)
+		}
+	}
+	var invoiced int64
+	if err := s.db.Model(&AIBillingInvoice{}).Where("user_id = ? AND period_end > ?", userID, effectiveAt).
+		Count(&invoiced).Error; err != nil {
+		return nil, err
+	}
+	if invoiced > 0 {
+		return nil, fmt.Errorf("%w: 生效时间所在账期已出账", ErrBillingInvalid)
+	}
+
+	var sub *AIBillingSubscription
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var current AIBillingSubscription
+		err := tx.Where("user_id = ? AND end_at IS NULL", userID).First(&current).Error
+		switch {
+		case err == nil:
+			if current.Plan == input.Plan {
+				sub = &current
+				return nil
+			}
+			if !effectiveAt.After(current.StartAt) {
+				return fmt.Errorf("%w: 生效时间早于当前套餐开始时间", ErrBillingInvalid)
+			}
+			result := tx.Model(&AIBillingSubscription{}).Where("id = ? AND end_at IS NULL", current.ID).
+				Update("end_at", effectiveAt)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected != 1 {
+				return fmt.Errorf("%w: 套餐正在被同时变更", ErrBillingConflict)
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if input.Plan == aiBillingDefaultPlan {
+				return nil
+			}
+		default:
+			return err
+		}
+		sub = &AIBillingSubscription{
+			EventID:   input.EventID,
+			UserID:    userID,
+			Plan:      input.Plan,
+			StartAt:   effectiveAt,
+			ChangedBy: actorID,
+		}
+		return tx.Create(sub).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrBillingInvalid) || errors.Is(err, ErrBillingConflict) {
+			return nil, err
+		}
+		// 并发重放撞上唯一索引
+		if s.db.Where("event_id = ?", input.EventID).First(&existing).Error == nil {
+			return &existing, nil
+		}
+		return nil, err
+	}
+	if sub == nil {
+		// 从未订阅的用户变更为基础版，无需记录
+		return &AIBillingSubscription{UserID: userID, Plan: aiBillingDefaultPlan, StartAt: effectiveAt}, nil
+	}
+	return sub, nil
+}
+
+// ListSubscriptions 用户的套餐区间
+func (s *AIBillingService) ListSubscriptions(userID uint) ([]AIBillingSubscription, error) {
+	var subs []AIBillingSubscription
+	err := s.db.Where("user_id = ?", userID).Order("start_at, id").Find(&subs).Error
+	return subs, err
+}
+
+// CreditInput 发放抵扣额度，金额单位为分
+type CreditInput struct {
+	EventID string `json:"event_id" binding:"required,max=64"`
+	Amount  int64  `json:"amount" binding:"required,gt=0"`
+	Reason  string `json:"reason" binding:"required,max=255"`
+}
+
+// GrantCredit 发放账户抵扣额度，下次出账时抵扣。相同事件ID重放时返回已有记录
+func (s *AIBillingService) GrantCredit(userID, actorID uint, input CreditInput) (*AIBillingCredit, error) {
+	if input.EventID == "" || len(input.EventID) > 64 {
+		return nil, fmt.Errorf("%w: 事件ID不能为空且不超过64个字符", ErrBillingInvalid)
+	}
+	if input.Amount <= 0 {
+		return nil, fmt.Errorf("%w: 抵扣金额必须大于0", ErrBillingInvalid)
+	}
+	credit := &AIBillingCredit{
+		EventID:   input.EventID,
+		UserID:    userID,
+		Source:    AICreditManual,
+		Amount:    input.Amount,
+		Remaining: input.Amount,
+		Reason:    input.Reason,
+		CreatedBy: actorID,
+	}
+	if err := s.db.Create(credit).Error; err != nil {
+		var existing AIBillingCredit
+		if s.db.Where("event_id = ?", input.EventID).First(&existing).Error != nil {
+			return nil, err
+		}
+		if existing.UserID != userID || existing.Amount != input.Amount {
+			return nil, fmt.Errorf("%w: 事件%s已以不同内容记录", ErrBillingConflict, input.EventID)
+		}
+		return &existing, nil
+	}
+	return credit, nil
+}
+
+// ListCredits 用户的抵扣额度和可用余额
+func (s *AIBillingService) ListCredits(userID uint) ([]AIBillingCredit, int64, error) {
+	var credits []AIBillingCredit
+	if err := s.db.Where("user_id = ?", userID).Order("created_at, id").Find(&credits).Error; err != nil {
+		return nil, 0, err
+	}
+	var balance int64
+	for _, credit := range credits {
+		balance += credit.Remaining
+	}
+	return credits, balance, nil
+}
+
+// RefundInput 账单退款，金额单位为分
+type RefundInput struct {
+	EventID  string `json:"event_id" binding:"required,max=64"`
+	Amount   int64  `json:"amount"` // 为0时退还全部可退金额
+	Reason   string `json:"reason" binding:"required,max=255"`
+	AsCredit bool   `json:"as_credit"` // 转为账户抵扣额度而不是原路退回
+}
+
+// RefundInvoice 账单退款，累计退款不超过应付金额。相同事件ID重放时返回已有记录
+func (s *AIBillingService) RefundInvoice(invoiceID, actorID uint, input RefundInput) (*AIBillingRefund, error) {
+	if input.EventID == "" || len(input.EventID) > 64 {
+		return nil, fmt.Errorf("%w: 事件ID不能为空且不超过64个字符", ErrBillingInvalid)
+	}
+	if input.Amount < 0 {
+		return nil, fmt.Errorf("%w: 退款金额不能为负", ErrBillingInvalid)
+	}
+	if existing, err := s.findRefund(input.EventID); err != nil || existing != nil {
+		if err != nil {
+			return nil, err
+		}
+		if existing.InvoiceID != invoiceID || (input.Amount != 0 && existing.Amount != input.Amount) || existing.AsCredit != input.AsCredit {
+			return nil, fmt.Errorf("%w: 事件%s已以不同内容记录", ErrBillingConflict, input.EventID)
+		}
+		return existing, nil
+	}
+
+	var refund *AIBillingRefund
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var invoice AIBillingInvoice
+		if err := tx.First(&invoice, invoiceID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: 账单%d不存在", ErrBillingNotFound, invoiceID)
+			}
+			return err
+		}
+		refundable := invoice.Total - invoice.Refunded
+		amount := input.Amount
+		if amount == 0 {
+			amount = refundable
+		}
+		if amount <= 0 || amount > refundable {
+			return fmt.Errorf("%w: 退款金额超过可退金额%d分", ErrBillingInvalid, refundable)
+		}
+
+		status := AIInvoicePartiallyRefunded
+		if amount == refundable {
+			status = AIInvoiceRefunded
+		}
+		result := tx.Model(&AIBillingInvoice{}).Where("id = ? AND refunded = ?", invoice.ID, invoice.Refunded).
+			Updates(map[string]interface{}{"refunded": invoice.Refunded + amount, "status": status})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return fmt.Errorf("%w: 账单正在被同时退款", ErrBillingConflict)
+		}
+
+		refund = &AIBillingRefund{
+			EventID:   input.EventID,
+			InvoiceID: invoice.ID,
+			UserID:    invoice.UserID,
+			Amount:    amount,
+			Reason:    input.Reason,
+			AsCredit:  input.AsCredit,
+			CreatedBy: actorID,
+		}
+		if input.AsCredit {
+			invoiceID := invoice.ID
+			credit := AIBillingCredit{
+				EventID:   "refund:" + input.EventID,
+				UserID:    invoice.UserID,
+				Source:    AICreditRefund,
+				Amount:    amount,
+				Remaining: amount,
+				Reason:    fmt.Sprintf("账单%s退款", invoice.Number),
+				InvoiceID: &invoiceID,
+				CreatedBy: actorID,
+			}
+			if err := tx.Create(&credit).Error; err != nil {
+				return err
+			}
+			refund.CreditID = &credit.ID
+		}
+		return tx.Create(refund).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrBillingInvalid) || errors.Is(err, ErrBillingNotFound) || errors.Is(err, ErrBillingConflict) {
+			return nil, err
+		}
+		if existing, findErr := s.findRefund(input.EventID); findErr == nil && existing != nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return refund, nil
+}
+
+func (s *AIBillingService) findRefund(eventID string) (*AIBillingRefund, error) {
+	var refund AIBillingRefund
+	err := s.db.Where("event_id = ?", eventID).First(&refund).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
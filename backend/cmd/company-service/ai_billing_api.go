@@ -0,0 +1,408 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jobfirst/jobfirst-core"
+)
+
+// aiBillingCycleInterval 检查上一个账期是否已出账的间隔
+const aiBillingCycleInterval = time.Hour
+
+// aiBillingMaxReplayEvents 单次批量上报的用量事件上限
+const aiBillingMaxReplayEvents = 1000
+
+// AIBillingAPI AI服务计费API
+type AIBillingAPI struct {
+	service *AIBillingService
+}
+
+// NewAIBillingAPI 创建计费API
+func NewAIBillingAPI(service *AIBillingService) *AIBillingAPI {
+	return &AIBillingAPI{service: service}
+}
+
+// SetupAIBillingRoutes 设置计费路由：用户查看套餐和账单，管理员出账、发放抵扣和退款
+func (api *AIBillingAPI) SetupAIBillingRoutes(r *gin.Engine, core *jobfirst.Core) {
+	billing := r.Group("/api/v1/ai/billing")
+	billing.Use(core.AuthMiddleware.RequireAuth())
+	{
+		billing.GET("/plan", api.getPlan)
+		billing.PUT("/plan", api.changePlan)
+		billing.GET("/preview", api.previewInvoice)
+		billing.GET("/invoices", api.listInvoices)
+		billing.GET("/invoices/:id", api.getInvoice)
+		billing.GET("/invoices/:id/export", api.exportInvoice)
+		billing.GET("/credits", api.listCredits)
+	}
+
+	admin := r.Group("/api/v1/admin/ai-billing")
+	admin.Use(core.AuthMiddleware.RequireAuth(), core.AuthMiddleware.RequireAdmin())
+	{
+		admin.POST("/usage", api.replayUsage)
+		admin.POST("/cycles/:period/run", api.runBillingCycle)
+		admin.POST("/users/:user_id/invoices/:period", api.generateInvoice)
+		admin.GET("/users/:user_id/invoices", api.listUserInvoices)
+		admin.PUT("/users/:user_id/plan", api.changeUserPlan)
+		admin.POST("/users/:user_id/credits", api.grantCredit)
+		admin.GET("/invoices/:id", api.getAnyInvoice)
+		admin.GET("/invoices/:id/export", api.exportAnyInvoice)
+		admin.POST("/invoices/:id/refunds", api.refundInvoice)
+	}
+}
+
+// getPlan 当前套餐和套餐变更记录
+func (api *AIBillingAPI) getPlan(c *gin.Context) {
+	userID, ok := billingUserID(c)
+	if !ok {
+		return
+	}
+	plan, err := api.service.CurrentPlan(userID)
+	if err != nil {
+		respondBillingError(c, err)
+		return
+	}
+	subscriptions, err := api.service.ListSubscriptions(userID)
+	if err != nil {
+		respondBillingError(c, err)
+		return
+	}
+	standardSuccessResponse(c, gin.H{"plan": plan, "subscriptions": subscriptions})
+}
+
+// changePlan 变更自己的套餐，账期内按时长折算月费
+func (api *AIBillingAPI) changePlan(c *gin.Context) {
+	userID, ok := billingUserID(c)
+	if !ok {
+		return
+	}
+	api.applyPlanChange(c, userID, userID)
+}
+
+func (api *AIBillingAPI) applyPlanChange(c *gin.Context, userID, actorID uint) {
+	var request PlanChangeInput
+	if err := c.ShouldBindJSON(&request); err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	sub, err := api.service.ChangePlan(userID, actorID, request)
+	if err != nil {
+		respondBillingError(c, err)
+		return
+	}
+	standardSuccessResponse(c, sub, "Plan changed successfully")
+}
+
+// previewInvoice 当前账期的预估账单
+func (api *AIBillingAPI) previewInvoice(c *gin.Context) {
+	userID, ok := billingUserID(c)
+	if !ok {
+		return
+	}
+	invoice, err := api.service.PreviewInvoice(userID)
+	if err != nil {
+		respondBillingError(c, err)
+		return
+	}
+	standardSuccessResponse(c, invoice)
+}
+
+// listInvoices 自己的账单
+func (api *AIBillingAPI) listInvoices(c *gin.Context) {
+	userID, ok := billingUserID(c)
+	if !ok {
+		return
+	}
+	invoices, err := api.service.ListInvoices(userID)
+	if err != nil {
+		respondBillingError(c, err)
+		return
+	}
+	standardSuccessResponse(c, invoices)
+}
+
+// getInvoice 自己的账单详情
+func (api *AIBillingAPI) getInvoice(c *gin.Context) {
+	invoice, ok := api.loadOwnInvoice(c)
+	if !ok {
+		return
+	}
+	standardSuccessResponse(c, invoice)
+}
+
+// exportInvoice 导出自己的账单
+func (api *AIBillingAPI) exportInvoice(c *gin.Context) {
+	invoice, ok := api.loadOwnInvoice(c)
+	if !ok {
+		return
+	}
+	writeInvoiceExport(c, invoice)
+}
+
+// listCredits 自己的抵扣额度和余额
+func (api *AIBillingAPI) listCredits(c *gin.Context) {
+	userID, ok := billingUserID(c)
+	if !ok {
+		return
+	}
+	credits, balance, err := api.service.ListCredits(userID)
+	if err != nil {
+		respondBillingError(c, err)
+		return
+	}
+	standardSuccessResponse(c, gin.H{"balance": balance, "credits": credits})
+}
+
+// replayUsage 批量上报或重放用量事件，已记录的事件ID不会重复计费
+func (api *AIBillingAPI) replayUsage(c *gin.Context) {
+	var request struct {
+		Events []UsageEventInput `json:"events" binding:"required,min=1,dive"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if len(request.Events) > aiBillingMaxReplayEvents {
+		standardErrorResponse(c, http.StatusBadRequest, "Too many events", fmt.Sprintf("每次最多%d个事件", aiBillingMaxReplayEvents))
+		return
+	}
+
+	recorded, duplicates := 0, 0
+	failed := make(map[string]string)
+	for _, event := range request.Events {
+		_, duplicate, err := api.service.RecordUsage(event)
+		switch {
+		case err != nil:
+			failed[event.EventID] = err.Error()
+		case duplicate:
+			duplicates++
+		default:
+			recorded++
+		}
+	}
+	standardSuccessResponse(c, gin.H{"recorded": recorded, "duplicates": duplicates, "failed": failed})
+}
+
+// runBillingCycle 为账期内的所有用户出账
+func (api *AIBillingAPI) runBillingCycle(c *gin.Context) {
+	result, err := api.service.RunBillingCycle(c.Param("period"))
+	if err != nil {
+		respondBillingError(c, err)
+		return
+	}
+	standardSuccessResponse(c, result, "Billing cycle completed")
+}
+
+// generateInvoice 为单个用户出账
+func (api *AIBillingAPI) generateInvoice(c *gin.Context) {
+	userID, ok := billingParamID(c, "user_id")
+	if !ok {
+		return
+	}
+	invoice, err := api.service.GenerateInvoice(userID, c.Param("period"))
+	if err != nil {
+		respondBillingError(c, err)
+		return
+	}
+	standardSuccessResponse(c, invoice, "Invoice generated successfully")
+}
+
+// listUserInvoices 用户的账单
+func (api *AIBillingAPI) listUserInvoices(c *gin.Context) {
+	userID, ok := billingParamID(c, "user_id")
+	if !ok {
+		return
+	}
+	invoices, err := api.service.ListInvoices(userID)
+	if err != nil {
+		respondBillingError(c, err)
+		return
+	}
+	standardSuccessResponse(c, invoices)
+}
+
+// changeUserPlan 管理员为用户变更套餐
+func (api *AIBillingAPI) changeUserPlan(c *gin.Context) {
+	userID, ok := billingParamID(c, "user_id")
+	if !ok {
+		return
+	}
+	actorID, ok := billingUserID(c)
+	if !ok {
+		return
+	}
+	api.applyPlanChange(c, userID, actorID)
+}
+
+// grantCredit 发放抵扣额度
+func (api *AIBillingAPI) grantCredit(c *gin.Context) {
+	userID, ok := billingParamID(c, "user_id")
+	if !ok {
+		return
+	}
+	actorID, ok := billingUserID(c)
+	if !ok {
+		return
+	}
+	var request CreditInput
+	if err := c.ShouldBindJSON(&request); err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	credit, err := api.service.GrantCredit(userID, actorID, request)
+	if err != nil {
+		respondBillingError(c, err)
+		return
+	}
+	standardSuccessResponse(c, credit, "Credit granted successfully")
+}
+
+// getAnyInvoice 管理员查看账单
+func (api *AIBillingAPI) getAnyInvoice(c *gin.Context) {
+	invoice, ok := api.loadInvoice(c)
+	if !ok {
+		return
+	}
+	standardSuccessResponse(c, invoice)
+}
+
+// exportAnyInvoice 管理员导出账单
+func (api *AIBillingAPI) exportAnyInvoice(c *gin.Context) {
+	invoice, ok := api.loadInvoice(c)
+	if !ok {
+		return
+	}
+	writeInvoiceExport(c, invoice)
+}
+
+// refundInvoice 账单退款
+func (api *AIBillingAPI) refundInvoice(c *gin.Context) {
+	invoiceID, ok := billingParamID(c, "id")
+	if !ok {
+		return
+	}
+	actorID, ok := billingUserID(c)
+	if !ok {
+		return
+	}
+	var request RefundInput
+	if err := c.ShouldBindJSON(&request); err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	refund, err := api.service.RefundInvoice(invoiceID, actorID, request)
+	if err != nil {
+		respondBillingError(c, err)
+		return
+	}
+	standardSuccessResponse(c, refund, "Invoice refunded successfully")
+}
+
+func (api *AIBillingAPI) loadInvoice(c *gin.Context) (*AIBillingInvoice, bool) {
+	invoiceID, ok := billingParamID(c, "id")
+	if !ok {
+		return nil, false
+	}
+	invoice, err := api.service.GetInvoice(invoiceID)
+	if err != nil {
+		respondBillingError(c, err)
+		return nil, false
+	}
+	return invoice, true
+}
+
+// loadOwnInvoice 加载当前用户的账单，其他用户的账单按不存在处理
+func (api *AIBillingAPI) loadOwnInvoice(c *gin.Context) (*AIBillingInvoice, bool) {
+	userID, ok := billingUserID(c)
+	if !ok {
+		return nil, false
+	}
+	invoice, ok := api.loadInvoice(c)
+	if !ok {
+		return nil, false
+	}
+	if invoice.UserID != userID {
+		respondBillingError(c, fmt.Errorf("%w: 账单%d不存在", ErrBillingNotFound, invoice.ID))
+		return nil, false
+	}
+	return invoice, true
+}
+
+// writeInvoiceExport 按format参数导出账单，默认PDF；PDF中文字体通过AI_BILLING_INVOICE_FONT配置
+func writeInvoiceExport(c *gin.Context, invoice *AIBillingInvoice) {
+	format := c.DefaultQuery("format", InvoiceFormatPDF)
+	var (
+		data        []byte
+		err         error
+		contentType string
+	)
+	switch format {
+	case InvoiceFormatJSON:
+		data, err = RenderAIInvoiceJSON(invoice)
+		contentType = "application/json"
+	case InvoiceFormatPDF:
+		data, err = RenderAIInvoicePDF(invoice, os.Getenv("AI_BILLING_INVOICE_FONT"))
+		contentType = "application/pdf"
+	default:
+		standardErrorResponse(c, http.StatusBadRequest, "Unsupported export format", "仅支持json和pdf格式")
+		return
+	}
+	if err != nil {
+		standardErrorResponse(c, http.StatusInternalServerError, "Failed to export invoice", err.Error())
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, invoice.Number, format))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// billingEventID 请求体中的事件ID，其次为Idempotency-Key请求头，都没有时生成一个，此时重试无法去重
+func billingEventID(c *gin.Context, eventID string) string {
+	if eventID != "" {
+		return eventID
+	}
+	if key := c.GetHeader("Idempotency-Key"); key != "" {
+		return key
+	}
+	return uuid.NewString()
+}
+
+func billingUserID(c *gin.Context) (uint, bool) {
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		standardErrorResponse(c, http.StatusUnauthorized, "User ID not found", "")
+		return 0, false
+	}
+	return userIDInterface.(uint), true
+}
+
+func billingParamID(c *gin.Context, param string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(param), 10, 64)
+	if err != nil || id == 0 {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid ID", c.Param(param))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondBillingError 将计费错误映射为HTTP状态码
+func respondBillingError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrBillingNotFound):
+		standardErrorResponse(c, http.StatusNotFound, "Billing record not found", err.Error())
+	case errors.Is(err, ErrBillingConflict):
+		standardErrorResponse(c, http.StatusConflict, "Billing event conflict", err.Error())
+	case errors.Is(err, ErrBillingNothingToInvoice):
+		standardErrorResponse(c, http.StatusUnprocessableEntity, "Nothing to invoice", err.Error())
+	case errors.Is(err, ErrBillingInvalid):
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid billing request", err.Error())
+	default:
+		standardErrorResponse(c, http.StatusInternalServerError, "Billing operation failed", err.Error())
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// 账单导出格式
+const (
+	InvoiceFormatJSON = "json"
+	InvoiceFormatPDF  = "pdf"
+)
+
+// formatCents 将以分为单位的金额格式化为元，如-1234 -> -12.34
+func formatCents(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// RenderAIInvoiceJSON 导出账单JSON，金额单位为分
+func RenderAIInvoiceJSON(invoice *AIBillingInvoice) ([]byte, error) {
+	return json.MarshalIndent(invoice, "", "  ")
+}
+
+// RenderAIInvoicePDF 导出账单PDF。fontFile为支持中文的TTF字体，为空时使用内置字体，中文显示为?
+func RenderAIInvoicePDF(invoice *AIBillingInvoice, fontFile string) ([]byte, error) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetAutoPageBreak(true, 15)
+
+	family := "Helvetica"
+	text := invoiceLatinText(pdf)
+	if fontFile != "" {
+		family = "invoice"
+		pdf.AddUTF8Font(family, "", fontFile)
+		text = func(s string) string { return s }
+	}
+
+	pdf.AddPage()
+	pageW, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	width := pageW - left - right
+
+	pdf.SetFont(family, "", 16)
+	pdf.CellFormat(width, 10, text("AI服务账单 Invoice "+invoice.Number), "", 1, "L", false, 0, "")
+	pdf.SetFont(family, "", 9)
+	pdf.SetTextColor(100, 100, 100)
+	meta := fmt.Sprintf("Period %s  |  User %d  |  Issued %s  |  Status %s  |  %s",
+		invoice.Period, invoice.UserID, invoice.IssuedAt.Format("2006-01-02"), invoice.Status, invoice.Currency)
+	pdf.CellFormat(width, 5, text(meta), "", 1, "L", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+	pdf.Ln(6)
+
+	widths := []float64{width * 0.55, width * 0.13, width * 0.16, width * 0.16}
+	headers := []string{"项目 Item", "数量 Qty", "单价 Unit", "金额 Amount"}
+	pdf.SetFont(family, "", 9)
+	pdf.SetFillColor(230, 230, 230)
+	for i, header := range headers {
+		align := "R"
+		if i == 0 {
+			align = "L"
+		}
+		pdf.CellFormat(widths[i], 7, text(header), "1", 0, align, true, 0, "")
+	}
+	pdf.Ln(-1)
+	for _, line := range invoice.Lines {
+		unit := ""
+		if line.UnitPrice != 0 {
+			unit = formatCents(line.UnitPrice)
+		}
+		cells := []string{line.Description, fmt.Sprint(line.Quantity), unit, formatCents(line.Amount)}
+		for i, cell := range cells {
+			align := "R"
+			if i == 0 {
+				align = "L"
+			}
+			pdf.CellFormat(widths[i], 6, text(cell), "1", 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+
+	pdf.Ln(4)
+	totals := [][2]string{
+		{"小计 Subtotal", formatCents(invoice.Subtotal)},
+		{"折扣 Discount", formatCents(-invoice.Discount)},
+		{"抵扣 Credit", formatCents(-invoice.CreditApplied)},
+		{"应付 Total", formatCents(invoice.Total)},
+	}
+	if invoice.Refunded > 0 {
+		totals = append(totals, [2]string{"已退款 Refunded", formatCents(-invoice.Refunded)})
+	}
+	for _, row := range totals {
+		pdf.CellFormat(widths[0]+widths[1]+widths[2], 6, text(row[0]), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[3], 6, text(row[1]), "", 1, "R", false, 0, "")
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("生成PDF失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// invoiceLatinText 内置字体只支持cp1252，其他字符替换为?
+func invoiceLatinText(pdf *fpdf.Fpdf) func(string) string {
+	translate := pdf.UnicodeTranslatorFromDescriptor("")
+	return func(s string) string {
+		return translate(strings.Map(func(r rune) rune {
+			if r > 0xFF {
+				return '?'
+			}
+			return r
+		}, s))
+	}
+}
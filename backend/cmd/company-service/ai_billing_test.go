@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestBillingService(t *testing.T) (*AIBillingService, *time.Time) {
+	t.Helper()
+	service := NewAIBillingService(newTestDB(t), NewAIServiceLayeringManager(), AIBillingConfig{Location: time.UTC})
+	if err := service.AutoMigrate(); err != nil {
+		t.Fatal(err)
+	}
+	return service, useTestClock(t)
+}
+
+func billingDate(month time.Month, day int) time.Time {
+	return time.Date(2026, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func recordTestUsage(t *testing.T, service *AIBillingService, input UsageEventInput) {
+	t.Helper()
+	if _, duplicate, err := service.RecordUsage(input); err != nil || duplicate {
+		t.Fatalf("record %s: duplicate=%v err=%v", input.EventID, duplicate, err)
+	}
+}
+
+func TestAIBillingRatesUsageAndReplaysIdempotently(t *testing.T) {
+	service, now := newTestBillingService(t)
+	*now = billingDate(time.March, 31)
+
+	// 企业服务：前3次免费，第21-100次九折，第101次起七五折；职业路径分析每次6元
+	for i := 1; i <= 110; i++ {
+		at := billingDate(time.March, 1).Add(time.Duration(i) * time.Minute)
+		input := UsageEventInput{EventID: fmt.Sprintf("e-%d", i), UserID: 1, ServiceID: "career_guidance_enterprise",
+			FeatureID: "career_path_analysis", OccurredAt: &at}
+		if i == 50 {
+			input.DataSize = 1536 * 1024
+		}
+		recordTestUsage(t, service, input)
+	}
+	at := billingDate(time.March, 2)
+	replay := UsageEventInput{EventID: "e-5", UserID: 1, ServiceID: "career_guidance_enterprise", FeatureID: "career_path_analysis", OccurredAt: &at}
+	if _, duplicate, err := service.RecordUsage(replay); err != nil || !duplicate {
+		t.Fatalf("replay: duplicate=%v err=%v", duplicate, err)
+	}
+	replay.FeatureID = "skill_gap_analysis"
+	if _, _, err := service.RecordUsage(replay); !errors.Is(err, ErrBillingConflict) {
+		t.Fatalf("conflicting replay err = %v", err)
+	}
+
+	preview, err := service.PreviewInvoice(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.GenerateInvoice(1, "2026-03"); !errors.Is(err, ErrBillingInvalid) {
+		t.Fatalf("open period err = %v", err)
+	}
+
+	*now = billingDate(time.April, 2)
+	var wg sync.WaitGroup
+	invoices := make([]*AIBillingInvoice, 4)
+	for i := range invoices {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			invoice, err := service.GenerateInvoice(1, "2026-03")
+			if err != nil {
+				t.Error(err)
+			}
+			invoices[i] = invoice
+		}(i)
+	}
+	wg.Wait()
+	invoice := invoices[0]
+	for _, other := range invoices[1:] {
+		if other == nil || other.ID != invoice.ID {
+			t.Fatalf("concurrent generation produced different invoices: %+v", other)
+		}
+	}
+
+	// 107次收费 x 600分，折扣 80x60 + 10x150，数据处理1.5MB向上取整为2MB
+	if invoice.Subtotal != 107*600+2 || invoice.Discount != 80*60+10*150 || invoice.Total != 107*600+2-6300 {
+		t.Fatalf("invoice = %+v", invoice)
+	}
+	if preview.Total != invoice.Total || preview.Status != AIInvoicePreview {
+		t.Fatalf("preview = %+v", preview)
+	}
+	if len(invoice.Lines) != 4 || invoice.Lines[0].Quantity != 107 || invoice.Lines[0].UnitPrice != 600 ||
+		invoice.Lines[1].Type != AIInvoiceLineDiscount || invoice.Lines[3].Type != AIInvoiceLineData {
+		t.Fatalf("lines = %+v", invoice.Lines)
+	}
+
+	// 出账后迟到的上期用量计入下一张账单，按3月的第111次计价，不占用4月的免费次数
+	late := billingDate(time.March, 31)
+	recordTestUsage(t, service, UsageEventInput{EventID: "late-1", UserID: 1, ServiceID: "career_guidance_enterprise",
+		FeatureID: "career_path_analysis", OccurredAt: &late})
+	again, err := service.GenerateInvoice(1, "2026-03")
+	if err != nil || again.ID != invoice.ID || again.Total != invoice.Total {
+		t.Fatalf("regenerate = %+v, %v", again, err)
+	}
+	for i := 1; i <= 3; i++ {
+		at := billingDate(time.April, 1).Add(time.Duration(i) * time.Hour)
+		recordTestUsage(t, service, UsageEventInput{EventID: fmt.Sprintf("a-%d", i), UserID: 1, ServiceID: "career_guidance_enterprise",
+			FeatureID: "career_path_analysis", OccurredAt: &at})
+	}
+	*now = billingDate(time.May, 1)
+	result, err := service.RunBillingCycle("2026-04")
+	if err != nil || result.Generated != 1 {
+		t.Fatalf("cycle = %+v, %v", result, err)
+	}
+	april, _ := service.findInvoice(1, "2026-04")
+	if april == nil || len(april.Lines) != 3 || april.Lines[0].Quantity != 0 || april.Lines[0].PeriodStart != nil || april.Total != 600-150 {
+		t.Fatalf("april = %+v", april)
+	}
+	if line := april.Lines[1]; line.Quantity != 1 || line.PeriodStart == nil || !line.PeriodStart.Equal(billingDate(time.March, 1)) ||
+		!strings.HasPrefix(line.Description, "2026-03账期补计") {
+		t.Fatalf("late usage line = %+v", line)
+	}
+	if result, _ := service.RunBillingCycle("2026-04"); result.Generated != 0 || result.Existing != 1 {
+		t.Fatalf("second cycle = %+v", result)
+	}
+}
+
+func TestAIBillingProratesPlanChanges(t *testing.T) {
+	service, now := newTestBillingService(t)
+	*now = billingDate(time.March, 10)
+
+	start := billingDate(time.March, 1)
+	if _, err := service.ChangePlan(2, 2, PlanChangeInput{EventID: "p-1", Plan: "premium", EffectiveAt: &start}); err != nil {
+		t.Fatal(err)
+	}
+	*now = billingDate(time.March, 16)
+	upgrade, err := service.ChangePlan(2, 2, PlanChangeInput{EventID: "p-2", Plan: "enterprise"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := service.ChangePlan(2, 2, PlanChangeInput{EventID: "p-2", Plan: "enterprise"})
+	if err != nil || replayed.ID != upgrade.ID {
+		t.Fatalf("replay = %+v, %v", replayed, err)
+	}
+	if _, err := service.ChangePlan(2, 2, PlanChangeInput{EventID: "p-3", Plan: "premium", EffectiveAt: &start}); !errors.Is(err, ErrBillingInvalid) {
+		t.Fatalf("backdated change err = %v", err)
+	}
+	if plan, _ := service.CurrentPlan(2); plan != "enterprise" {
+		t.Fatalf("plan = %s", plan)
+	}
+
+	*now = billingDate(time.April, 1)
+	march, err := service.GenerateInvoice(2, "2026-03")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 高级版15/31天，企业版16/31天
+	if len(march.Lines) != 2 || march.Lines[0].Amount != 483 || march.Lines[1].Amount != 1548 || march.Total != 2031 {
+		t.Fatalf("march = %+v", march)
+	}
+	if _, err := service.ChangePlan(2, 2, PlanChangeInput{EventID: "p-4", Plan: "basic", EffectiveAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	mid := billingDate(time.March, 20)
+	if _, err := service.ChangePlan(2, 2, PlanChangeInput{EventID: "p-5", Plan: "premium", EffectiveAt: &mid}); !errors.Is(err, ErrBillingInvalid) {
+		t.Fatalf("change in invoiced period err = %v", err)
+	}
+	*now = billingDate(time.May, 1)
+	if _, err := service.GenerateInvoice(2, "2026-04"); !errors.Is(err, ErrBillingNothingToInvoice) {
+		t.Fatalf("basic plan invoice err = %v", err)
+	}
+}
+
+func TestAIBillingCreditsRefundsAndExport(t *testing.T) {
+	service, now := newTestBillingService(t)
+	*now = billingDate(time.March, 1)
+
+	if _, err := service.ChangePlan(3, 3, PlanChangeInput{EventID: "p-1", Plan: "premium"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := service.GrantCredit(3, 100, CreditInput{EventID: "c-1", Amount: 300, Reason: "服务补偿"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := service.GrantCredit(3, 100, CreditInput{EventID: "c-1", Amount: 500, Reason: "服务补偿"}); !errors.Is(err, ErrBillingConflict) {
+		t.Fatalf("conflicting credit err = %v", err)
+	}
+
+	*now = billingDate(time.April, 1)
+	invoice, err := service.GenerateInvoice(3, "2026-03")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invoice.Subtotal != 999 || invoice.CreditApplied != 300 || invoice.Total != 699 {
+		t.Fatalf("invoice = %+v", invoice)
+	}
+	if _, balance, _ := service.ListCredits(3); balance != 0 {
+		t.Fatalf("balance after invoice = %d", balance)
+	}
+
+	refund := RefundInput{EventID: "r-1", Amount: 200, Reason: "服务中断", AsCredit: true}
+	first, err := service.RefundInvoice(invoice.ID, 100, refund)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := service.RefundInvoice(invoice.ID, 100, refund)
+	if err != nil || second.ID != first.ID {
+		t.Fatalf("replayed refund = %+v, %v", second, err)
+	}
+	if _, err := service.RefundInvoice(invoice.ID, 100, RefundInput{EventID: "r-2", Amount: 600, Reason: "x"}); !errors.Is(err, ErrBillingInvalid) {
+		t.Fatalf("over-refund err = %v", err)
+	}
+	if _, err := service.RefundInvoice(invoice.ID, 100, RefundInput{EventID: "r-3", Reason: "退订"}); err != nil {
+		t.Fatal(err)
+	}
+	invoice, _ = service.GetInvoice(invoice.ID)
+	if invoice.Refunded != 699 || invoice.Status != AIInvoiceRefunded || len(invoice.Refunds) != 2 {
+		t.Fatalf("refunded invoice = %+v", invoice)
+	}
+
+	// 转为抵扣额度的退款在下一张账单中抵扣
+	*now = billingDate(time.May, 1)
+	april, err := service.GenerateInvoice(3, "2026-04")
+	if err != nil || april.CreditApplied != 200 || april.Total != 799 {
+		t.Fatalf("april = %+v, %v", april, err)
+	}
+
+	data, err := RenderAIInvoiceJSON(april)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded AIBillingInvoice
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Number != april.Number || len(decoded.Lines) != len(april.Lines) {
+		t.Fatalf("json export = %+v, %v", decoded, err)
+	}
+	pdf, err := RenderAIInvoicePDF(april, "")
+	if err != nil || !bytes.HasPrefix(pdf, []byte("%PDF")) {
+		t.Fatalf("pdf export err = %v", err)
+	}
+	if formatCents(-1234) != "-12.34" || formatCents(5) != "0.05" {
+		t.Fatal("formatCents")
+	}
+}
@@ -9,8 +9,8 @@ import (
 	"github.com/jobfirst/jobfirst-core"
 )
 
-// AI优化功能API路由设置
-func setupAIOptimizationRoutes(r *gin.Engine, core *jobfirst.Core) {
+// AI优化功能API路由设置，服务使用和层级升级通过计费服务记录
+func setupAIOptimizationRoutes(r *gin.Engine, core *jobfirst.Core, billing *AIBillingService) {
 	authMiddleware := core.AuthMiddleware.RequireAuth()
 
 	// AI服务分层API路由组
@@ -22,13 +22,13 @@ func setupAIOptimizationRoutes(r *gin.Engine, core *jobfirst.Core) {
 		// 获取服务分层信息
 		aiLayering.GET("/info", func(c *gin.Context) { getServiceLayeringInfo(c, core) })
 		// 升级用户服务层级
-		aiLayering.PUT("/upgrade", func(c *gin.Context) { upgradeUserServiceLevel(c, core) })
+		aiLayering.PUT("/upgrade", func(c *gin.Context) { upgradeUserServiceLevel(c, core, billing) })
 		// 获取用户使用统计
 		aiLayering.GET("/usage", func(c *gin.Context) { getUserUsageStats(c, core) })
 		// 检查服务限制
 		aiLayering.GET("/limits", func(c *gin.Context) { checkServiceLimits(c, core) })
 		// 记录服务使用
-		aiLayering.POST("/usage", func(c *gin.Context) { recordServiceUsage(c, core) })
+		aiLayering.POST("/usage", func(c *gin.Context) { recordServiceUsage(c, core, billing) })
 	}
 
 	// 个性化分析API路由组
@@ -112,7 +112,7 @@ func getServiceLayeringInfo(c *gin.Context, core *jobfirst.Core) {
 }
 
 // 升级用户服务层级
-func upgradeUserServiceLevel(c *gin.Context, core *jobfirst.Core) {
+func upgradeUserServiceLevel(c *gin.Context, core *jobfirst.Core, billing *AIBillingService) {
 	userIDInterface, exists := c.Get("user_id")
 	if !exists {
 		standardErrorResponse(c, http.StatusUnauthorized, "User ID not found", "")
@@ -121,6 +121,7 @@ func upgradeUserServiceLevel(c *gin.Context, core *jobfirst.Core) {
 	userID := userIDInterface.(uint)
 
 	var request struct {
+		EventID            string `json:"event_id"`
 		ServiceLevel       string `json:"service_level"`
 		AuthorizationLevel string `json:"authorization_level"`
 	}
@@ -137,7 +138,17 @@ func upgradeUserServiceLevel(c *gin.Context, core *jobfirst.Core) {
 		return
 	}
 
-	standardSuccessResponse(c, nil, "Service level upgraded successfully")
+	// 套餐变更计入账单，账期内按时长折算月费
+	subscription, err := billing.ChangePlan(userID, userID, PlanChangeInput{
+		EventID: billingEventID(c, request.EventID),
+		Plan:    request.ServiceLevel,
+	})
+	if err != nil {
+		respondBillingError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, subscription, "Service level upgraded successfully")
 }
 
 // 获取用户使用统计
@@ -190,7 +201,7 @@ func checkServiceLimits(c *gin.Context, core *jobfirst.Core) {
 }
 
 // 记录服务使用
-func recordServiceUsage(c *gin.Context, core *jobfirst.Core) {
+func recordServiceUsage(c *gin.Context, core *jobfirst.Core, billing *AIBillingService) {
 	userIDInterface, exists := c.Get("user_id")
 	if !exists {
 		standardErrorResponse(c, http.StatusUnauthorized, "User ID not found", "")
@@ -199,6 +210,7 @@ func recordServiceUsage(c *gin.Context, core *jobfirst.Core) {
 	userID := userIDInterface.(uint)
 
 	var request struct {
+		EventID            string `json:"event_id"`
 		ServiceID          string `json:"service_id"`
 		FeatureID          string `json:"feature_id"`
 		RequestType        string `json:"request_type"`
@@ -213,23 +225,28 @@ func recordServiceUsage(c *gin.Context, core *jobfirst.Core) {
 		return
 	}
 
-	manager := NewAIServiceLayeringManager()
-	err := manager.RecordServiceUsage(
-		userID,
-		request.ServiceID,
-		request.FeatureID,
-		request.RequestType,
-		request.DataSize,
-		request.ProcessingTime,
-		request.AuthorizationLevel,
-		request.Anonymized,
-	)
+	// 相同事件ID重放时不会重复计费
+	usage, duplicate, err := billing.RecordUsage(UsageEventInput{
+		EventID:            billingEventID(c, request.EventID),
+		UserID:             userID,
+		ServiceID:          request.ServiceID,
+		FeatureID:          request.FeatureID,
+		RequestType:        request.RequestType,
+		DataSize:           request.DataSize,
+		ProcessingTime:     request.ProcessingTime,
+		AuthorizationLevel: request.AuthorizationLevel,
+		Anonymized:         request.Anonymized,
+	})
 	if err != nil {
-		standardErrorResponse(c, http.StatusInternalServerError, "Failed to record service usage", err.Error())
+		respondBillingError(c, err)
+		return
+	}
+	if duplicate {
+		standardSuccessResponse(c, usage, "Service usage already recorded")
 		return
 	}
 
-	standardSuccessResponse(c, nil, "Service usage recorded successfully")
+	standardSuccessResponse(c, usage, "Service usage recorded successfully")
 }
 
 // 个性化分析相关函数
@@ -83,16 +83,23 @@ type DiscountTier struct {
 // 用户服务使用记录
 type UserServiceUsage struct {
 	ID                 uint      `json:"id" gorm:"primaryKey"`
-	UserID             uint      `json:"user_id" gorm:"not null"`
-	ServiceID          string    `json:"service_id" gorm:"not null"`
-	FeatureID          string    `json:"feature_id"`
+	EventID            string    `json:"event_id" gorm:"size:64;uniqueIndex"` // 调用方的事件ID，重放时据此去重
+	UserID             uint      `json:"user_id" gorm:"not null;index"`
+	ServiceID          string    `json:"service_id" gorm:"size:100;not null"`
+	FeatureID          string    `json:"feature_id" gorm:"size:100"`
 	RequestType        string    `json:"request_type"`    // resume_analysis, job_matching, career_guidance
 	DataSize           int64     `json:"data_size"`       // bytes
 	ProcessingTime     int64     `json:"processing_time"` // milliseconds
 	Cost               float64   `json:"cost"`
 	AuthorizationLevel string    `json:"authorization_level"`
 	Anonymized         bool      `json:"anonymized"`
-	CreatedAt          time.Time `json:"created_at"`
+	InvoiceID          *uint     `json:"invoice_id" gorm:"index"` // 计入的账单，未出账为空
+	CreatedAt          time.Time `json:"created_at" gorm:"index"`
+}
+
+// TableName 指定表名
+func (UserServiceUsage) TableName() string {
+	return "ai_billing_usage_events"
 }
 
 // 服务分层管理器
@@ -203,6 +210,10 @@ func (m *AIServiceLayeringManager) initializeDefaultServices() {
 				"format_optimization":  0.50,
 			},
 			FreeRequests: 5,
+			DiscountTiers: []DiscountTier{
+				{MinRequests: 51, MaxRequests: 200, DiscountRate: 0.10, Description: "月用量51-200次九折"},
+				{MinRequests: 201, DiscountRate: 0.20, Description: "月用量200次以上八折"},
+			},
 		},
 		Availability: true,
 		Description:  "高级简历优化服务，提供AI驱动的优化建议",
@@ -253,12 +264,33 @@ func (m *AIServiceLayeringManager) initializeDefaultServices() {
 				"learning_recommendations": 2.00,
 			},
 			FreeRequests: 3,
+			DiscountTiers: []DiscountTier{
+				{MinRequests: 21, MaxRequests: 100, DiscountRate: 0.10, Description: "月用量21-100次九折"},
+				{MinRequests: 101, DiscountRate: 0.25, Description: "月用量100次以上七五折"},
+			},
 		},
 		Availability: true,
 		Description:  "企业级职业发展指导服务，提供全面的职业规划支持",
 	}
 }
 
+// GetService 按服务ID获取服务定义和定价
+func (m *AIServiceLayeringManager) GetService(serviceID string) (AIService, bool) {
+	service, exists := m.services[serviceID]
+	return service, exists
+}
+
+// PlanFee 服务层级的月费，即该层级各服务基础价格之和
+func (m *AIServiceLayeringManager) PlanFee(level string) float64 {
+	fee := 0.0
+	for _, service := range m.services {
+		if service.RequiredLevel == level {
+			fee += service.Pricing.BasePrice
+		}
+	}
+	return fee
+}
+
 // 获取用户可用的服务
 func (m *AIServiceLayeringManager) GetUserAvailableServices(userID uint, authorizationLevel string) ([]AIService, error) {
 	var availableServices []AIService
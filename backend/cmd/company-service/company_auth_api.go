@@ -36,8 +36,9 @@ func (api *CompanyAuthAPI) SetupCompanyAuthRoutes(r *gin.Engine) {
 		auth.POST("/users", api.addAuthorizedUser)
 		auth.GET("/users/:company_id", api.getAuthorizedUsers)
 		auth.DELETE("/users/:company_id/:user_id", api.removeAuthorizedUser)
-		auth.PUT("/users/:company_id/:user_id", api.updateUserRole)
-		auth.PUT("/legal-rep/:company_id", api.setLegalRepresentative)
+		// 角色变更和设置法定代表人属于敏感操作，需要MFA二次验证
+		auth.PUT("/users/:company_id/:user_id", api.core.AuthMiddleware.RequireMFA(), api.updateUserRole)
+		auth.PUT("/legal-rep/:company_id", api.core.AuthMiddleware.RequireMFA(), api.setLegalRepresentative)
 
 		// 企业权限查询API
 		auth.GET("/permissions/:user_id", api.getUserCompanyPermissions)
@@ -58,6 +59,9 @@ func (api *CompanyAuthAPI) SetupCompanyAuthRoutes(r *gin.Engine) {
 
 		// 权限审计API
 		auth.GET("/audit/:company_id", api.getPermissionAuditLogs)
+
+		// 授权期限、转授权、访问申请和访问审查
+		api.setupGrantRoutes(auth)
 	}
 }
 
@@ -71,10 +75,8 @@ func (api *CompanyAuthAPI) addAuthorizedUser(c *gin.Context) {
 	userID := userIDInterface.(uint)
 
 	var req struct {
-		CompanyID   uint     `json:"company_id" binding:"required"`
-		UserID      uint     `json:"user_id" binding:"required"`
-		Role        string   `json:"role" binding:"required"`
-		Permissions []string `json:"permissions"`
+		CompanyID uint `json:"company_id" binding:"required"`
+		GrantInput
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -82,14 +84,15 @@ func (api *CompanyAuthAPI) addAuthorizedUser(c *gin.Context) {
 		return
 	}
 
-	// 检查权限：只有企业创建者或法定代表人可以添加授权用户
+	// 检查权限：企业创建者、法定代表人直接授权，持有可转授权授权的用户在限制内转授
 	if !api.permissionManager.CheckCompanyAccess(userID, req.CompanyID, "add_authorized_user", c) {
 		return
 	}
 
 	// 添加授权用户
-	if err := api.permissionManager.AddAuthorizedUser(req.CompanyID, req.UserID, CompanyRole(req.Role), req.Permissions); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	grant, err := api.permissionManager.GrantAccess(req.CompanyID, userID, req.GrantInput, c)
+	if err != nil {
+		respondGrantError(c, err)
 		return
 	}
 
@@ -99,6 +102,7 @@ func (api *CompanyAuthAPI) addAuthorizedUser(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
 		"message": "授权用户添加成功",
+		"data":    grant,
 	})
 }
 
@@ -162,8 +166,8 @@ func (api *CompanyAuthAPI) removeAuthorizedUser(c *gin.Context) {
 	}
 
 	// 移除授权用户
-	if err := api.permissionManager.RemoveAuthorizedUser(uint(companyID), uint(targetUserID)); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := api.permissionManager.RemoveAuthorizedUser(uint(companyID), uint(targetUserID), userID, c); err != nil {
+		respondGrantError(c, err)
 		return
 	}
 
@@ -213,8 +217,8 @@ func (api *CompanyAuthAPI) updateUserRole(c *gin.Context) {
 	}
 
 	// 更新用户角色
-	if err := api.permissionManager.UpdateUserRole(uint(companyID), uint(targetUserID), CompanyRole(req.Role), req.Permissions); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := api.permissionManager.UpdateUserRole(uint(companyID), uint(targetUserID), CompanyRole(req.Role), req.Permissions, userID, c); err != nil {
+		respondGrantError(c, err)
 		return
 	}
 
@@ -257,7 +261,7 @@ func (api *CompanyAuthAPI) setLegalRepresentative(c *gin.Context) {
 	}
 
 	// 设置法定代表人
-	if err := api.permissionManager.SetLegalRepresentative(uint(companyID), req.UserID); err != nil {
+	if err := api.permissionManager.SetLegalRepresentative(uint(companyID), req.UserID, userID, c); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
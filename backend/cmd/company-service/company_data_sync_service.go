@@ -5,11 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"math"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/xiajason/zervi-basic/basic/backend/pkg/geo"
+	"github.com/xiajason/zervi-basic/basic/backend/pkg/graph"
 	"gorm.io/gorm"
 )
 
@@ -19,16 +20,46 @@ type CompanyDataSyncService struct {
 	postgresDB  *gorm.DB
 	neo4jDriver neo4j.Driver
 	redisClient *redis.Client
+	geoIndex    *CompanyGeoIndex
+	graphStore  CompanyGraphStore
 }
 
 // NewCompanyDataSyncService 创建企业数据同步服务
 func NewCompanyDataSyncService(mysqlDB *gorm.DB, postgresDB *gorm.DB, neo4jDriver neo4j.Driver, redisClient *redis.Client) *CompanyDataSyncService {
+	graphStore := NewMemoryCompanyGraphStore()
+	if neo4jDriver != nil {
+		graphStore = NewNeo4jCompanyGraphStore(neo4jDriver)
+	}
 	return &CompanyDataSyncService{
 		mysqlDB:     mysqlDB,
 		postgresDB:  postgresDB,
 		neo4jDriver: neo4jDriver,
 		redisClient: redisClient,
+		graphStore:  graphStore,
+	}
+}
+
+// GraphStore 返回企业关系图存储，未连接Neo4j时为内存图
+func (s *CompanyDataSyncService) GraphStore() CompanyGraphStore {
+	return s.graphStore
+}
+
+// LoadCompanyGraph 未连接Neo4j时从MySQL重建内存关系图
+func (s *CompanyDataSyncService) LoadCompanyGraph() error {
+	if s.graphStore.Backend() != CompanyGraphBackendMemory {
+		return nil
 	}
+	return LoadCompanyGraph(s.mysqlDB, s.graphStore)
+}
+
+// SetGeoIndex 设置企业空间索引，用于附近企业推荐
+func (s *CompanyDataSyncService) SetGeoIndex(index *CompanyGeoIndex) {
+	s.geoIndex = index
+}
+
+// GeoIndex 返回企业空间索引，未设置时为nil
+func (s *CompanyDataSyncService) GeoIndex() *CompanyGeoIndex {
+	return s.geoIndex
 }
 
 // SyncCompanyData 同步企业数据到所有数据库
@@ -54,6 +85,9 @@ func (s *CompanyDataSyncService) SyncCompanyData(companyID uint) error {
 	} else {
 		s.updateSyncStatus(companyID, SyncTargetNeo4j, SyncStatusSuccess, "")
 	}
+	if s.graphStore.Backend() == CompanyGraphBackendMemory {
+		s.syncToMemoryGraph(company)
+	}
 
 	// 4. 同步到Redis（缓存数据）
 	if err := s.syncToRedis(company); err != nil {
@@ -322,6 +356,19 @@ func (s *CompanyDataSyncService) syncToNeo4j(company EnhancedCompany) error {
 	return nil
 }
 
+// syncToMemoryGraph 未连接Neo4j时把企业节点同步到内存关系图，非活跃企业从图中移除
+func (s *CompanyDataSyncService) syncToMemoryGraph(company EnhancedCompany) {
+	memory, ok := s.graphStore.(*memoryCompanyGraphStore)
+	if !ok {
+		return
+	}
+	if company.Status != "active" {
+		memory.graph.RemoveNode(company.ID)
+		return
+	}
+	memory.graph.AddNode(graph.Node{ID: company.ID, Name: company.Name, Industry: company.Industry})
+}
+
 // syncToRedis 同步到Redis
 func (s *CompanyDataSyncService) syncToRedis(company EnhancedCompany) error {
 	if s.redisClient == nil {
@@ -510,33 +557,18 @@ func (s *CompanyDataSyncService) GetSyncStatus(companyID uint) ([]CompanySyncInf
 
 // GetCompanyRelationships 获取企业关系
 func (s *CompanyDataSyncService) GetCompanyRelationships(companyID uint) ([]CompanyRelationship, error) {
-	if s.neo4jDriver == nil {
-		return nil, fmt.Errorf("Neo4j未连接，无法获取关系")
-	}
-
-	session := s.neo4jDriver.NewSession(neo4j.SessionConfig{})
-	defer session.Close()
-
-	result, err := session.Run(`
-		MATCH (source:Company {id: $companyID})-[r:RELATED_TO]->(target:Company)
-		RETURN target.id as target_id, r.type as relationship, r.weight as weight
-		ORDER BY r.weight DESC
-	`, map[string]interface{}{
-		"companyID": companyID,
-	})
-
+	edges, err := s.graphStore.Relationships(companyID)
 	if err != nil {
 		return nil, err
 	}
 
 	var relationships []CompanyRelationship
-	for result.Next() {
-		record := result.Record()
+	for _, edge := range edges {
 		rel := CompanyRelationship{
 			CompanyID:          companyID,
-			RelatedCompanyName: fmt.Sprintf("Company_%d", record.Values[0].(int64)),
-			RelationshipType:   record.Values[1].(string),
-			InvestmentAmount:   record.Values[2].(float64),
+			RelatedCompanyName: fmt.Sprintf("Company_%d", edge.To),
+			RelationshipType:   edge.Type,
+			InvestmentAmount:   edge.Weight,
 		}
 		relationships = append(relationships, rel)
 	}
@@ -546,27 +578,23 @@ func (s *CompanyDataSyncService) GetCompanyRelationships(companyID uint) ([]Comp
 
 // CreateCompanyRelationship 创建企业关系
 func (s *CompanyDataSyncService) CreateCompanyRelationship(sourceID, targetID uint, relationship string, weight float64) error {
-	if s.neo4jDriver == nil {
-		return fmt.Errorf("Neo4j未连接，无法创建关系")
+	// 内存图中的节点可能尚未同步，先从MySQL补齐
+	if s.graphStore.Backend() == CompanyGraphBackendMemory {
+		var companies []EnhancedCompany
+		if err := s.mysqlDB.Select("id", "name", "industry").Where("id IN ?", []uint{sourceID, targetID}).Find(&companies).Error; err != nil {
+			return err
+		}
+		if len(companies) != 2 {
+			return fmt.Errorf("企业不存在")
+		}
+		for _, company := range companies {
+			if err := s.graphStore.UpsertCompany(graph.Node{ID: company.ID, Name: company.Name, Industry: company.Industry}); err != nil {
+				return err
+			}
+		}
 	}
 
-	session := s.neo4jDriver.NewSession(neo4j.SessionConfig{})
-	defer session.Close()
-
-	// 创建关系
-	_, err := session.Run(`
-		MATCH (source:Company {id: $sourceID})
-		MATCH (target:Company {id: $targetID})
-		MERGE (source)-[r:RELATED_TO {type: $relationship}]->(target)
-		SET r.weight = $weight, r.created_at = datetime()
-	`, map[string]interface{}{
-		"sourceID":     sourceID,
-		"targetID":     targetID,
-		"relationship": relationship,
-		"weight":       weight,
-	})
-
-	return err
+	return s.graphStore.UpsertRelationship(graph.Edge{From: sourceID, To: targetID, Type: relationship, Weight: weight})
 }
 
 // GetCachedCompany 从Redis获取缓存的企业
@@ -609,8 +637,8 @@ func (s *CompanyDataSyncService) AnalyzeCompanyData(companyID uint) (map[string]
 		"view_count": company.ViewCount,
 	}
 
-	// 从Neo4j获取关系分析
-	if s.neo4jDriver != nil {
+	// 从关系图获取关系分析
+	if s.graphStore != nil {
 		relationships, err := s.GetCompanyRelationships(companyID)
 		if err == nil {
 			analysis["relationships"] = relationships
@@ -628,8 +656,12 @@ func (s *CompanyDataSyncService) AnalyzeCompanyData(companyID uint) (map[string]
 	return analysis, nil
 }
 
-// GetLocationBasedRecommendations 获取基于地理位置的推荐
-func (s *CompanyDataSyncService) GetLocationBasedRecommendations(companyID uint, radius float64, limit int) ([]EnhancedCompany, error) {
+// GetLocationBasedRecommendations 获取基于地理位置的推荐：通过空间索引查找半径内的企业，按距离由近到远分页返回
+func (s *CompanyDataSyncService) GetLocationBasedRecommendations(companyID uint, radius float64, cursor string, limit int, output geo.CoordSystem) (*NearbyCompanyPage, error) {
+	if s.geoIndex == nil {
+		return nil, fmt.Errorf("空间索引未初始化")
+	}
+
 	// 获取目标企业的地理位置
 	var targetCompany EnhancedCompany
 	if err := s.mysqlDB.First(&targetCompany, companyID).Error; err != nil {
@@ -639,40 +671,15 @@ func (s *CompanyDataSyncService) GetLocationBasedRecommendations(companyID uint,
 	if targetCompany.BDLatitude == nil || targetCompany.BDLongitude == nil {
 		return nil, fmt.Errorf("企业地理位置信息不完整")
 	}
+	center := geo.ToWGS84(geo.Point{Lat: *targetCompany.BDLatitude, Lng: *targetCompany.BDLongitude}, s.geoIndex.StoredSystem())
 
-	// 查找附近的企业
-	var companies []EnhancedCompany
-	err := s.mysqlDB.Where(`
-		bd_latitude IS NOT NULL 
-		AND bd_longitude IS NOT NULL 
-		AND id != ? 
-		AND status = 'active'
-	`, companyID).Find(&companies).Error
-
-	if err != nil {
-		return nil, err
-	}
-
-	// 计算距离并筛选
-	var nearbyCompanies []EnhancedCompany
-	for _, company := range companies {
-		if company.BDLatitude != nil && company.BDLongitude != nil {
-			distance := calculateDistance(
-				*targetCompany.BDLatitude, *targetCompany.BDLongitude,
-				*company.BDLatitude, *company.BDLongitude,
-			)
-			if distance <= radius {
-				nearbyCompanies = append(nearbyCompanies, company)
-			}
-		}
-	}
-
-	// 限制返回数量
-	if len(nearbyCompanies) > limit {
-		nearbyCompanies = nearbyCompanies[:limit]
-	}
-
-	return nearbyCompanies, nil
+	return s.geoIndex.Search(geo.Query{
+		Center:   center,
+		RadiusKm: radius,
+		Filter:   func(id uint) bool { return id != companyID },
+		Cursor:   cursor,
+		Limit:    limit,
+	}, output)
 }
 
 // GetIndustryBasedRecommendations 获取基于行业关系的推荐
@@ -698,20 +705,6 @@ func (s *CompanyDataSyncService) GetIndustryBasedRecommendations(companyID uint,
 	return companies, nil
 }
 
-// calculateDistance 计算两点间距离（公里）
-func calculateDistance(lat1, lon1, lat2, lon2 float64) float64 {
-	const R = 6371 // 地球半径（公里）
-
-	dLat := (lat2 - lat1) * 3.14159265359 / 180
-	dLon := (lon2 - lon1) * 3.14159265359 / 180
-
-	a := 0.5 - 0.5*math.Cos(dLat) +
-		0.5*math.Cos(lat1*3.14159265359/180)*math.Cos(lat2*3.14159265359/180)*
-			(1-math.Cos(dLon))
-
-	return R * math.Asin(math.Sqrt(a))
-}
-
 // 辅助函数
 func getFloat64Value(ptr *float64) float64 {
 	if ptr == nil {
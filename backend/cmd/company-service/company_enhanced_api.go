@@ -1,12 +1,14 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jobfirst/jobfirst-core"
+	"github.com/xiajason/zervi-basic/basic/backend/pkg/geo"
 )
 
 // JobData 职位数据模型（PostgreSQL）
@@ -25,6 +27,9 @@ type JobData struct {
 
 // setupCompanyEnhancedRoutes 设置Company服务增强API路由
 func setupCompanyEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, dataSyncService *CompanyDataSyncService) {
+	geoIndex := dataSyncService.GeoIndex()
+	graphService := NewCompanyGraphService(dataSyncService.GraphStore(), core.GetDB())
+
 	// 需要认证的增强API路由
 	authMiddleware := core.AuthMiddleware.RequireAuth()
 	enhanced := r.Group("/api/v1/company/enhanced")
@@ -157,6 +162,66 @@ func setupCompanyEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, dataSyncServ
 		// 企业地理位置API
 		location := enhanced.Group("/location")
 		{
+			// 附近企业：以给定坐标为圆心按半径查询，按距离排序并用游标分页
+			location.GET("/nearby", func(c *gin.Context) {
+				input, output, ok := parseCoordSystems(c)
+				if !ok {
+					return
+				}
+				lat, errLat := strconv.ParseFloat(c.Query("latitude"), 64)
+				lng, errLng := strconv.ParseFloat(c.Query("longitude"), 64)
+				center := geo.Point{Lat: lat, Lng: lng}
+				if errLat != nil || errLng != nil || !center.Valid() {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "无效的经纬度"})
+					return
+				}
+				radius, _ := strconv.ParseFloat(c.DefaultQuery("radius_km", "5"), 64)
+				if radius <= 0 || radius > 200 {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "搜索半径必须在0到200公里之间"})
+					return
+				}
+
+				page, err := geoIndex.Search(geo.Query{
+					Center:   geo.ToWGS84(center, input),
+					RadiusKm: radius,
+					Cursor:   c.Query("cursor"),
+					Limit:    geoPageLimit(c),
+				}, output)
+				respondNearbyCompanies(c, page, err)
+			})
+
+			// 矩形范围内的企业（地图视野），按到中心点的距离排序
+			location.GET("/within", func(c *gin.Context) {
+				input, output, ok := parseCoordSystems(c)
+				if !ok {
+					return
+				}
+				var bounds [4]float64
+				for i, key := range []string{"min_latitude", "min_longitude", "max_latitude", "max_longitude"} {
+					value, err := strconv.ParseFloat(c.Query(key), 64)
+					if err != nil {
+						c.JSON(http.StatusBadRequest, gin.H{"error": "无效的参数: " + key})
+						return
+					}
+					bounds[i] = value
+				}
+				min := geo.ToWGS84(geo.Point{Lat: bounds[0], Lng: bounds[1]}, input)
+				max := geo.ToWGS84(geo.Point{Lat: bounds[2], Lng: bounds[3]}, input)
+				box := geo.BBox{MinLat: min.Lat, MinLng: min.Lng, MaxLat: max.Lat, MaxLng: max.Lng}
+				if !box.Valid() {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "无效的矩形范围"})
+					return
+				}
+
+				page, err := geoIndex.Search(geo.Query{
+					Center: box.Center(),
+					BBox:   &box,
+					Cursor: c.Query("cursor"),
+					Limit:  geoPageLimit(c),
+				}, output)
+				respondNearbyCompanies(c, page, err)
+			})
+
 			// 获取企业地理位置信息
 			location.GET("/:id", func(c *gin.Context) {
 				companyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -171,6 +236,12 @@ func setupCompanyEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, dataSyncServ
 					return
 				}
 
+				output, err := geo.ParseCoordSystem(c.Query("coord_system"))
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+
 				locationData := map[string]interface{}{
 					"company_id":   company.ID,
 					"company_name": company.Name,
@@ -193,6 +264,12 @@ func setupCompanyEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, dataSyncServ
 						"area_code":     company.AreaCode,
 					},
 				}
+				// 按请求的坐标系返回坐标，便于直接在高德、百度等地图上展示
+				if company.BDLatitude != nil && company.BDLongitude != nil {
+					stored := geoIndex.StoredSystem()
+					locationData["coordinates"] = geo.Convert(geo.Point{Lat: *company.BDLatitude, Lng: *company.BDLongitude}, stored, output)
+					locationData["coord_system"] = output
+				}
 
 				c.JSON(http.StatusOK, gin.H{
 					"status": "success",
@@ -222,6 +299,7 @@ func setupCompanyEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, dataSyncServ
 					CityCode     string   `json:"city_code"`
 					DistrictCode string   `json:"district_code"`
 					AreaCode     string   `json:"area_code"`
+					CoordSystem  string   `json:"coord_system"` // 提交坐标的坐标系，默认与存储一致
 				}
 
 				if err := c.ShouldBindJSON(&updateData); err != nil {
@@ -229,6 +307,28 @@ func setupCompanyEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, dataSyncServ
 					return
 				}
 
+				// 转换为存储坐标系
+				if (updateData.BDLatitude == nil) != (updateData.BDLongitude == nil) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "经纬度必须同时提供"})
+					return
+				}
+				if updateData.BDLatitude != nil {
+					point := geo.Point{Lat: *updateData.BDLatitude, Lng: *updateData.BDLongitude}
+					if !point.Valid() {
+						c.JSON(http.StatusBadRequest, gin.H{"error": "经纬度超出范围"})
+						return
+					}
+					if updateData.CoordSystem != "" {
+						input, err := geo.ParseCoordSystem(updateData.CoordSystem)
+						if err != nil {
+							c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+							return
+						}
+						point = geo.Convert(point, input, geoIndex.StoredSystem())
+					}
+					updateData.BDLatitude, updateData.BDLongitude = &point.Lat, &point.Lng
+				}
+
 				var company EnhancedCompany
 				if err := core.GetDB().First(&company, companyID).Error; err != nil {
 					c.JSON(http.StatusNotFound, gin.H{"error": "企业不存在"})
@@ -255,6 +355,7 @@ func setupCompanyEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, dataSyncServ
 					c.JSON(http.StatusInternalServerError, gin.H{"error": "更新地理位置信息失败"})
 					return
 				}
+				geoIndex.Sync(&company)
 
 				c.JSON(http.StatusOK, gin.H{
 					"status":  "success",
@@ -318,6 +419,9 @@ func setupCompanyEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, dataSyncServ
 			})
 		}
 
+		// 企业关系图分析API
+		setupCompanyGraphRoutes(enhanced, graphService)
+
 		// 企业分析API
 		analysis := enhanced.Group("/analysis")
 		{
@@ -348,9 +452,11 @@ func setupCompanyEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, dataSyncServ
 			// 基于地理位置的推荐
 			recommendations.POST("/location-based", func(c *gin.Context) {
 				var req struct {
-					CompanyID uint    `json:"company_id" binding:"required"`
-					Radius    float64 `json:"radius,omitempty"` // 搜索半径(公里)
-					Limit     int     `json:"limit,omitempty"`
+					CompanyID   uint    `json:"company_id" binding:"required"`
+					Radius      float64 `json:"radius,omitempty"` // 搜索半径(公里)
+					Limit       int     `json:"limit,omitempty"`
+					Cursor      string  `json:"cursor,omitempty"`       // 上一页返回的next_cursor
+					CoordSystem string  `json:"coord_system,omitempty"` // 返回坐标使用的坐标系
 				}
 
 				if err := c.ShouldBindJSON(&req); err != nil {
@@ -368,8 +474,18 @@ func setupCompanyEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, dataSyncServ
 					limit = 10
 				}
 
-				recommendations, err := dataSyncService.GetLocationBasedRecommendations(req.CompanyID, radius, limit)
+				output, err := geo.ParseCoordSystem(req.CoordSystem)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+
+				recommendations, err := dataSyncService.GetLocationBasedRecommendations(req.CompanyID, radius, req.Cursor, limit, output)
 				if err != nil {
+					if errors.Is(err, geo.ErrInvalidCursor) {
+						c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分页游标"})
+						return
+					}
 					c.JSON(http.StatusInternalServerError, gin.H{"error": "推荐失败: " + err.Error()})
 					return
 				}
@@ -377,8 +493,9 @@ func setupCompanyEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, dataSyncServ
 				c.JSON(http.StatusOK, gin.H{
 					"status": "success",
 					"data": gin.H{
-						"recommendations": recommendations,
-						"count":           len(recommendations),
+						"recommendations": recommendations.Companies,
+						"count":           len(recommendations.Companies),
+						"next_cursor":     recommendations.NextCursor,
 						"type":            "location-based",
 						"radius":          radius,
 					},
@@ -417,6 +534,86 @@ func setupCompanyEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, dataSyncServ
 					},
 				})
 			})
+
+			// 基于关系网络的推荐：间接关联、尚无直接关系的企业，不限行业
+			recommendations.POST("/network-based", func(c *gin.Context) {
+				var req struct {
+					CompanyID uint `json:"company_id" binding:"required"`
+					Depth     int  `json:"depth,omitempty"` // 最大跳数，默认3
+					Limit     int  `json:"limit,omitempty"`
+				}
+
+				if err := c.ShouldBindJSON(&req); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+
+				limit := req.Limit
+				if limit <= 0 || limit > 20 {
+					limit = 10
+				}
+
+				recommendations, err := graphService.Recommend(req.CompanyID, req.Depth, limit)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "推荐失败: " + err.Error()})
+					return
+				}
+
+				c.JSON(http.StatusOK, gin.H{
+					"status": "success",
+					"data": gin.H{
+						"recommendations": recommendations,
+						"count":           len(recommendations),
+						"type":            "network-based",
+					},
+				})
+			})
+		}
+	}
+}
+
+// parseCoordSystems 解析请求坐标（coord_system）和返回坐标（output_coord_system，默认与请求一致）的坐标系
+func parseCoordSystems(c *gin.Context) (geo.CoordSystem, geo.CoordSystem, bool) {
+	input, err := geo.ParseCoordSystem(c.Query("coord_system"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", "", false
+	}
+	output := input
+	if name := c.Query("output_coord_system"); name != "" {
+		if output, err = geo.ParseCoordSystem(name); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return "", "", false
+		}
+	}
+	return input, output, true
+}
+
+// geoPageLimit 每页条数，默认20，最多100
+func geoPageLimit(c *gin.Context) int {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	return limit
+}
+
+func respondNearbyCompanies(c *gin.Context, page *NearbyCompanyPage, err error) {
+	if err != nil {
+		if errors.Is(err, geo.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分页游标"})
+			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询附近企业失败: " + err.Error()})
+		return
 	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"companies":   page.Companies,
+			"count":       len(page.Companies),
+			"next_cursor": page.NextCursor,
+		},
+	})
 }
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/xiajason/zervi-basic/basic/backend/pkg/geo"
+	"gorm.io/gorm"
+)
+
+// 空间索引的增量同步和全量重建间隔
+const (
+	companyGeoRefreshInterval = 30 * time.Second
+	companyGeoRebuildInterval = time.Hour
+)
+
+// CompanyGeoIndex 企业位置空间索引。索引内统一使用WGS-84，
+// 企业表中的坐标按storedSystem解释（默认北斗CGCS2000）
+type CompanyGeoIndex struct {
+	db           *gorm.DB
+	index        *geo.Index
+	syncer       *geo.Syncer
+	storedSystem geo.CoordSystem
+}
+
+// NewCompanyGeoIndex 创建企业空间索引，存储坐标系可通过COMPANY_COORD_SYSTEM配置
+func NewCompanyGeoIndex(db *gorm.DB) *CompanyGeoIndex {
+	stored := geo.CGCS2000
+	if name := os.Getenv("COMPANY_COORD_SYSTEM"); name != "" {
+		system, err := geo.ParseCoordSystem(name)
+		if err != nil {
+			log.Printf("COMPANY_COORD_SYSTEM无效，使用北斗坐标系: %v", err)
+		} else {
+			stored = system
+		}
+	}
+	idx := &CompanyGeoIndex{db: db, index: geo.NewIndex(), storedSystem: stored}
+	idx.syncer = geo.NewSyncer(idx.index, idx)
+	return idx
+}
+
+// Start 全量加载后在后台保持同步，其他实例或其他接口对企业位置的修改在一个同步周期内生效
+func (g *CompanyGeoIndex) Start(ctx context.Context) {
+	g.syncer.Run(ctx, companyGeoRefreshInterval, companyGeoRebuildInterval)
+}
+
+// companyLocationRow 同步索引所需的企业字段
+type companyLocationRow struct {
+	ID          uint
+	BDLatitude  *float64
+	BDLongitude *float64
+	Status      string
+}
+
+// LoadAll 实现geo.Source
+func (g *CompanyGeoIndex) LoadAll(ctx context.Context) ([]geo.Record, error) {
+	var rows []companyLocationRow
+	err := g.db.WithContext(ctx).Model(&EnhancedCompany{}).
+		Select("id", "bd_latitude", "bd_longitude", "status").
+		Where("status = ? AND bd_latitude IS NOT NULL AND bd_longitude IS NOT NULL", "active").
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return g.records(rows), nil
+}
+
+// LoadChanged 实现geo.Source
+func (g *CompanyGeoIndex) LoadChanged(ctx context.Context, since time.Time) ([]geo.Record, error) {
+	var rows []companyLocationRow
+	err := g.db.WithContext(ctx).Model(&EnhancedCompany{}).
+		Select("id", "bd_latitude", "bd_longitude", "status").
+		Where("updated_at >= ?", since).
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return g.records(rows), nil
+}
+
+func (g *CompanyGeoIndex) records(rows []companyLocationRow) []geo.Record {
+	records := make([]geo.Record, len(rows))
+	for i, row := range rows {
+		records[i] = g.record(row.ID, row.BDLatitude, row.BDLongitude, row.Status)
+	}
+	return records
+}
+
+func (g *CompanyGeoIndex) record(id uint, lat, lng *float64, status string) geo.Record {
+	r := geo.Record{ID: id, Active: status == "active"}
+	if lat != nil && lng != nil {
+		p := geo.ToWGS84(geo.Point{Lat: *lat, Lng: *lng}, g.storedSystem)
+		r.Point = &p
+	}
+	return r
+}
+
+// Sync 企业保存后立即更新索引
+func (g *CompanyGeoIndex) Sync(company *EnhancedCompany) {
+	g.syncer.Apply(g.record(company.ID, company.BDLatitude, company.BDLongitude, company.Status))
+}
+
+// StoredSystem 企业表中坐标使用的坐标系
+func (g *CompanyGeoIndex) StoredSystem() geo.CoordSystem {
+	return g.storedSystem
+}
+
+// Position 企业在索引中的位置（WGS-84）
+func (g *CompanyGeoIndex) Position(companyID uint) (geo.Point, bool) {
+	return g.index.Get(companyID)
+}
+
+// NearbyCompany 附近企业，Coordinates使用请求的坐标系
+type NearbyCompany struct {
+	EnhancedCompany
+	DistanceKm  float64         `json:"distance_km"`
+	Coordinates geo.Point       `json:"coordinates"`
+	CoordSystem geo.CoordSystem `json:"coord_system"`
+}
+
+// NearbyCompanyPage 附近企业分页结果
+type NearbyCompanyPage struct {
+	Companies  []NearbyCompany `json:"companies"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// Search 执行空间查询并读取企业详情，结果按距离排序。
+// 同步周期内被停用的企业会被跳过，因此一页可能少于limit条
+func (g *CompanyGeoIndex) Search(q geo.Query, output geo.CoordSystem) (*NearbyCompanyPage, error) {
+	page, err := g.index.Search(q)
+	if err != nil {
+		return nil, err
+	}
+	result := &NearbyCompanyPage{Companies: []NearbyCompany{}, NextCursor: page.NextCursor}
+	if len(page.Hits) == 0 {
+		return result, nil
+	}
+
+	ids := make([]uint, len(page.Hits))
+	for i, hit := range page.Hits {
+		ids[i] = hit.ID
+	}
+	var companies []EnhancedCompany
+	if err := g.db.Where("id IN ? AND status = ?", ids, "active").Find(&companies).Error; err != nil {
+		return nil, fmt.Errorf("读取企业失败: %w", err)
+	}
+	byID := make(map[uint]EnhancedCompany, len(companies))
+	for _, company := range companies {
+		byID[company.ID] = company
+	}
+	for _, hit := range page.Hits {
+		company, ok := byID[hit.ID]
+		if !ok {
+			continue
+		}
+		result.Companies = append(result.Companies, NearbyCompany{
+			EnhancedCompany: company,
+			DistanceKm:      hit.DistanceKm,
+			Coordinates:     geo.FromWGS84(hit.Point, output),
+			CoordSystem:     output,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/xiajason/zervi-basic/basic/backend/pkg/graph"
+	"gorm.io/gorm"
+)
+
+// 图查询的深度限制
+const (
+	companyGraphMaxDepth     = 6
+	companyGraphDefaultDepth = 3
+)
+
+// 关系图后端
+const (
+	CompanyGraphBackendNeo4j  = "neo4j"
+	CompanyGraphBackendMemory = "memory"
+)
+
+var (
+	// ErrCompanyPathNotFound 两家企业在限定跳数内没有关系路径
+	ErrCompanyPathNotFound = errors.New("company path not found")
+	// ErrCompanyGraphQuery 图查询参数无效
+	ErrCompanyGraphQuery = errors.New("invalid company graph query")
+)
+
+// companyRelationshipKinds 关系链对应的边类型，边的方向均为 上游 -> 下游：
+// 供应链中供应商指向客户，股权链中股东指向被投资企业
+var companyRelationshipKinds = map[string][]string{
+	"supply_chain": {"供应", "supplier", "supply"},
+	"shareholding": {"投资", "控股", "参股", "investment", "holding"},
+}
+
+// CompanyGraphStore 企业关系图的存储后端。未配置Neo4j时使用内存图
+type CompanyGraphStore interface {
+	Backend() string
+	UpsertCompany(node graph.Node) error
+	UpsertRelationship(edge graph.Edge) error
+	// Relationships 读取企业的直接出边
+	Relationships(companyID uint) ([]graph.Edge, error)
+	// Neighborhood 读取距离企业depth跳以内的企业及它们之间的全部关系
+	Neighborhood(companyID uint, depth int, filter graph.Filter) (*graph.Graph, error)
+	// Industry 读取某行业的企业及它们之间的关系
+	Industry(industry string) (*graph.Graph, error)
+}
+
+// memoryCompanyGraphStore 内存关系图，进程重启后由LoadCompanyGraph从MySQL重建
+type memoryCompanyGraphStore struct {
+	graph *graph.Graph
+}
+
+// NewMemoryCompanyGraphStore 创建内存关系图
+func NewMemoryCompanyGraphStore() CompanyGraphStore {
+	return &memoryCompanyGraphStore{graph: graph.New()}
+}
+
+func (m *memoryCompanyGraphStore) Backend() string { return CompanyGraphBackendMemory }
+
+func (m *memoryCompanyGraphStore) UpsertCompany(node graph.Node) error {
+	m.graph.AddNode(node)
+	return nil
+}
+
+func (m *memoryCompanyGraphStore) UpsertRelationship(edge graph.Edge) error {
+	m.graph.AddEdge(edge)
+	return nil
+}
+
+func (m *memoryCompanyGraphStore) Relationships(companyID uint) ([]graph.Edge, error) {
+	edges := m.graph.EdgesOf(companyID, graph.Filter{Direction: graph.Outgoing})
+	sort.SliceStable(edges, func(i, j int) bool { return edges[i].Weight > edges[j].Weight })
+	return edges, nil
+}
+
+func (m *memoryCompanyGraphStore) Neighborhood(companyID uint, depth int, filter graph.Filter) (*graph.Graph, error) {
+	return m.graph.Neighborhood(companyID, depth, filter), nil
+}
+
+func (m *memoryCompanyGraphStore) Industry(industry string) (*graph.Graph, error) {
+	var ids []uint
+	for _, n := range m.graph.Nodes() {
+		if n.Industry == industry {
+			ids = append(ids, n.ID)
+		}
+	}
+	return m.graph.Subgraph(ids), nil
+}
+
+// neo4jCompanyGraphStore 基于Neo4j的关系图，节点和边由syncToNeo4j和CreateCompanyRelationship写入
+type neo4jCompanyGraphStore struct {
+	driver neo4j.Driver
+}
+
+// NewNeo4jCompanyGraphStore 创建Neo4j关系图
+func NewNeo4jCompanyGraphStore(driver neo4j.Driver) CompanyGraphStore {
+	return &neo4jCompanyGraphStore{driver: driver}
+}
+
+func (n *neo4jCompanyGraphStore) Backend() string { return CompanyGraphBackendNeo4j }
+
+func (n *neo4jCompanyGraphStore) UpsertCompany(node graph.Node) error {
+	return n.run(`
+		MERGE (c:Company {id: $id})
+		SET c.name = $name, c.industry = $industry
+	`, map[string]interface{}{"id": int64(node.ID), "name": node.Name, "industry": node.Industry})
+}
+
+func (n *neo4jCompanyGraphStore) UpsertRelationship(edge graph.Edge) error {
+	return n.run(`
+		MATCH (source:Company {id: $sourceID})
+		MATCH (target:Company {id: $targetID})
+		MERGE (source)-[r:RELATED_TO {type: $relationship}]->(target)
+		SET r.weight = $weight, r.created_at = datetime()
+	`, map[string]interface{}{
+		"sourceID":     int64(edge.From),
+		"targetID":     int64(edge.To),
+		"relationship": edge.Type,
+		"weight":       edge.Weight,
+	})
+}
+
+func (n *neo4jCompanyGraphStore) Relationships(companyID uint) ([]graph.Edge, error) {
+	session := n.driver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+
+	result, err := session.Run(`
+		MATCH (source:Company {id: $companyID})-[r:RELATED_TO]->(target:Company)
+		RETURN target.id, r.type, r.weight
+		ORDER BY r.weight DESC
+	`, map[string]interface{}{"companyID": int64(companyID)})
+	if err != nil {
+		return nil, err
+	}
+	var edges []graph.Edge
+	for result.Next() {
+		values := result.Record().Values
+		edges = append(edges, graph.Edge{From: companyID, To: neo4jUint(values[0]), Type: neo4jString(values[1]), Weight: neo4jFloat(values[2])})
+	}
+	return edges, result.Err()
+}
+
+func (n *neo4jCompanyGraphStore) Neighborhood(companyID uint, depth int, filter graph.Filter) (*graph.Graph, error) {
+	left, right := "-", "-"
+	switch filter.Direction {
+	case graph.Outgoing:
+		right = "->"
+	case graph.Incoming:
+		left = "<-"
+	}
+	// 变长关系的深度不能参数化，depth已由调用方限制在1~companyGraphMaxDepth
+	query := fmt.Sprintf(`
+		MATCH (c:Company {id: $id})
+		OPTIONAL MATCH p = (c)%s[:RELATED_TO*1..%d]%s(other:Company)
+		WHERE size($types) = 0 OR all(r IN relationships(p) WHERE r.type IN $types)
+		RETURN c.id AS id, collect(DISTINCT other.id) AS others
+	`, left, depth, right)
+
+	session := n.driver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	types := filter.Types
+	if types == nil {
+		types = []string{}
+	}
+	result, err := session.Run(query, map[string]interface{}{"id": int64(companyID), "types": types})
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	if result.Next() {
+		values := result.Record().Values
+		ids = append(ids, int64(neo4jUint(values[0])))
+		if others, ok := values[1].([]interface{}); ok {
+			for _, other := range others {
+				ids = append(ids, int64(neo4jUint(other)))
+			}
+		}
+	}
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
+	return n.load(session, `MATCH (a:Company) WHERE a.id IN $ids`, map[string]interface{}{"ids": ids})
+}
+
+func (n *neo4jCompanyGraphStore) Industry(industry string) (*graph.Graph, error) {
+	session := n.driver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	return n.load(session, `MATCH (a:Company) WHERE a.industry = $industry`, map[string]interface{}{"industry": industry})
+}
+
+// load 读取match选出的企业节点和它们之间的RELATED_TO关系
+func (n *neo4jCompanyGraphStore) load(session neo4j.Session, match string, params map[string]interface{}) (*graph.Graph, error) {
+	g := graph.New()
+	result, err := session.Run(match+`
+		WITH collect(a) AS nodes
+		UNWIND nodes AS a
+		OPTIONAL MATCH (a)-[r:RELATED_TO]->(b:Company) WHERE b IN nodes
+		RETURN a.id, a.name, a.industry, b.id, r.type, r.weight
+	`, params)
+	if err != nil {
+		return nil, err
+	}
+	for result.Next() {
+		values := result.Record().Values
+		g.AddNode(graph.Node{ID: neo4jUint(values[0]), Name: neo4jString(values[1]), Industry: neo4jString(values[2])})
+		if values[3] != nil {
+			g.AddEdge(graph.Edge{From: neo4jUint(values[0]), To: neo4jUint(values[3]), Type: neo4jString(values[4]), Weight: neo4jFloat(values[5])})
+		}
+	}
+	return g, result.Err()
+}
+
+func (n *neo4jCompanyGraphStore) run(query string, params map[string]interface{}) error {
+	session := n.driver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	result, err := session.Run(query, params)
+	if err != nil {
+		return err
+	}
+	_, err = result.Consume()
+	return err
+}
+
+func neo4jUint(v interface{}) uint {
+	if id, ok := v.(int64); ok && id > 0 {
+		return uint(id)
+	}
+	return 0
+}
+
+func neo4jString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func neo4jFloat(v interface{}) float64 {
+	switch x := v.(type) {
+	case float64:
+		return x
+	case int64:
+		return float64(x)
+	}
+	return 0
+}
+
+// LoadCompanyGraph 从MySQL重建内存关系图：活跃企业作为节点，
+// 企业画像中关联企业名称能匹配到平台企业的关系作为边
+func LoadCompanyGraph(db *gorm.DB, store CompanyGraphStore) error {
+	var companies []EnhancedCompany
+	if err := db.Select("id", "name", "industry").Where("status = ?", "active").Find(&companies).Error; err != nil {
+		return err
+	}
+	byName := make(map[string]uint, len(companies))
+	for _, company := range companies {
+		if err := store.UpsertCompany(graph.Node{ID: company.ID, Name: company.Name, Industry: company.Industry}); err != nil {
+			return err
+		}
+		byName[strings.TrimSpace(company.Name)] = company.ID
+	}
+
+	var relationships []CompanyRelationship
+	if err := db.Find(&relationships).Error; err != nil {
+		return err
+	}
+	linked := 0
+	for _, rel := range relationships {
+		target, ok := byName[strings.TrimSpace(rel.RelatedCompanyName)]
+		if !ok || target == rel.CompanyID {
+			continue
+		}
+		if err := store.UpsertRelationship(graph.Edge{
+			From:   rel.CompanyID,
+			To:     target,
+			Type:   rel.RelationshipType,
+			Weight: rel.InvestmentRatio / 100,
+		}); err != nil {
+			return err
+		}
+		linked++
+	}
+	log.Printf("企业关系图已加载: %d家企业, %d条关系", len(companies), linked)
+	return nil
+}
+
+// CompanyGraphService 企业关系图分析
+type CompanyGraphService struct {
+	store CompanyGraphStore
+	db    *gorm.DB
+}
+
+// NewCompanyGraphService 创建关系图分析服务，db用于过滤非活跃企业，可以为nil
+func NewCompanyGraphService(store CompanyGraphStore, db *gorm.DB) *CompanyGraphService {
+	return &CompanyGraphService{store: store, db: db}
+}
+
+// Backend 当前使用的图后端
+func (s *CompanyGraphService) Backend() string {
+	return s.store.Backend()
+}
+
+// clampGraphDepth 深度为0时取默认值，超出上限时取上限
+func clampGraphDepth(depth, fallback int) int {
+	if depth <= 0 {
+		return fallback
+	}
+	if depth > companyGraphMaxDepth {
+		return companyGraphMaxDepth
+	}
+	return depth
+}
+
+// ShortestPath 两家企业之间跳数最少的关系路径，types为空时经过任意类型的关系
+func (s *CompanyGraphService) ShortestPath(from, to uint, maxDepth int, types []string) (*graph.Path, error) {
+	if from == 0 || to == 0 || from == to {
+		return nil, fmt.Errorf("%w: 需要两家不同的企业", ErrCompanyGraphQuery)
+	}
+	filter := graph.Filter{Types: types}
+	g, err := s.store.Neighborhood(from, clampGraphDepth(maxDepth, companyGraphDefaultDepth+1), filter)
+	if err != nil {
+		return nil, err
+	}
+	path, ok := g.ShortestPath(from, to, clampGraphDepth(maxDepth, companyGraphDefaultDepth+1), filter)
+	if !ok {
+		return nil, ErrCompanyPathNotFound
+	}
+	return path, nil
+}
+
+// Traverse 沿供应链（supply_chain）或股权链（shareholding）遍历，
+// direction为upstream（供应商/股东）、downstream（客户/被投资企业）或both
+func (s *CompanyGraphService) Traverse(companyID uint, kind, direction string, depth int) ([]graph.Reached, error) {
+	types, ok := companyRelationshipKinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("%w: 不支持的关系链 %s", ErrCompanyGraphQuery, kind)
+	}
+	filter := graph.Filter{Types: types}
+	switch direction {
+	case "downstream":
+		filter.Direction = graph.Outgoing
+	case "upstream":
+		filter.Direction = graph.Incoming
+	case "", "both":
+	default:
+		return nil, fmt.Errorf("%w: 不支持的方向 %s", ErrCompanyGraphQuery, direction)
+	}
+	depth = clampGraphDepth(depth, companyGraphDefaultDepth)
+	g, err := s.store.Neighborhood(companyID, depth, filter)
+	if err != nil {
+		return nil, err
+	}
+	return g.Traverse(companyID, depth, filter), nil
+}
+
+// Communities 社区发现，范围为某行业或某企业depth跳以内的关系网络
+func (s *CompanyGraphService) Communities(industry string, companyID uint, depth int) (graph.CommunityResult, error) {
+	var g *graph.Graph
+	var err error
+	switch {
+	case industry != "":
+		g, err = s.store.Industry(industry)
+	case companyID != 0:
+		g, err = s.store.Neighborhood(companyID, clampGraphDepth(depth, companyGraphDefaultDepth), graph.Filter{})
+	default:
+		return graph.CommunityResult{}, fmt.Errorf("%w: 需要指定行业或企业", ErrCompanyGraphQuery)
+	}
+	if err != nil {
+		return graph.CommunityResult{}, err
+	}
+	return g.Communities(), nil
+}
+
+// Centrality 行业内企业的中心性排名
+func (s *CompanyGraphService) Centrality(industry, metric string, limit int) ([]graph.Centrality, error) {
+	if industry == "" {
+		return nil, fmt.Errorf("%w: 需要指定行业", ErrCompanyGraphQuery)
+	}
+	metric, err := graph.ParseMetric(metric)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCompanyGraphQuery, err)
+	}
+	g, err := s.store.Industry(industry)
+	if err != nil {
+		return nil, err
+	}
+	ranked := g.Centralities(metric)
+	if limit > 0 && len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked, nil
+}
+
+// Recommend 推荐关系网络中间接相连、尚无直接关系的活跃企业
+func (s *CompanyGraphService) Recommend(companyID uint, depth, limit int) ([]graph.Recommendation, error) {
+	depth = clampGraphDepth(depth, companyGraphDefaultDepth)
+	if depth < 2 {
+		depth = 2
+	}
+	g, err := s.store.Neighborhood(companyID, depth, graph.Filter{})
+	if err != nil {
+		return nil, err
+	}
+	active, err := s.activeCompanies(g.Nodes())
+	if err != nil {
+		return nil, err
+	}
+	return g.Recommend(companyID, depth, limit, func(n graph.Node) bool {
+		return active != nil && !active[n.ID]
+	}), nil
+}
+
+// activeCompanies 返回节点中状态为active的企业，db为nil时返回nil表示不过滤
+func (s *CompanyGraphService) activeCompanies(nodes []graph.Node) (map[uint]bool, error) {
+	if s.db == nil {
+		return nil, nil
+	}
+	ids := make([]uint, len(nodes))
+	for i, n := range nodes {
+		ids[i] = n.ID
+	}
+	var activeIDs []uint
+	if err := s.db.Model(&EnhancedCompany{}).Where("id IN ? AND status = ?", ids, "active").Pluck("id", &activeIDs).Error; err != nil {
+		return nil, err
+	}
+	active := make(map[uint]bool, len(activeIDs))
+	for _, id := range activeIDs {
+		active[id] = true
+	}
+	return active, nil
+}
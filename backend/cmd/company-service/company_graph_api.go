@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupCompanyGraphRoutes 设置企业关系图分析路由
+func setupCompanyGraphRoutes(enhanced *gin.RouterGroup, graphService *CompanyGraphService) {
+	graphGroup := enhanced.Group("/graph")
+	{
+		// 两家企业之间的最短关系路径
+		graphGroup.GET("/path", func(c *gin.Context) {
+			from, err1 := strconv.ParseUint(c.Query("from"), 10, 32)
+			to, err2 := strconv.ParseUint(c.Query("to"), 10, 32)
+			if err1 != nil || err2 != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "无效的企业ID"})
+				return
+			}
+			maxDepth, _ := strconv.Atoi(c.Query("max_depth"))
+
+			path, err := graphService.ShortestPath(uint(from), uint(to), maxDepth, splitGraphTypes(c.Query("types")))
+			if err != nil {
+				respondCompanyGraphError(c, err)
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "success",
+				"data":    path,
+				"backend": graphService.Backend(),
+			})
+		})
+
+		// 沿供应链或股权链遍历
+		graphGroup.GET("/:id/traverse", func(c *gin.Context) {
+			companyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "无效的企业ID"})
+				return
+			}
+			depth, _ := strconv.Atoi(c.Query("depth"))
+			kind := c.DefaultQuery("kind", "supply_chain")
+			direction := c.DefaultQuery("direction", "both")
+
+			reached, err := graphService.Traverse(uint(companyID), kind, direction, depth)
+			if err != nil {
+				respondCompanyGraphError(c, err)
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"status": "success",
+				"data": gin.H{
+					"companies": reached,
+					"count":     len(reached),
+					"kind":      kind,
+					"direction": direction,
+				},
+				"backend": graphService.Backend(),
+			})
+		})
+
+		// 社区发现
+		graphGroup.GET("/communities", func(c *gin.Context) {
+			companyID, _ := strconv.ParseUint(c.Query("company_id"), 10, 32)
+			depth, _ := strconv.Atoi(c.Query("depth"))
+
+			result, err := graphService.Communities(c.Query("industry"), uint(companyID), depth)
+			if err != nil {
+				respondCompanyGraphError(c, err)
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "success",
+				"data":    result,
+				"count":   len(result.Communities),
+				"backend": graphService.Backend(),
+			})
+		})
+
+		// 行业内中心性排名
+		graphGroup.GET("/centrality", func(c *gin.Context) {
+			limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+			if limit <= 0 || limit > 100 {
+				limit = 20
+			}
+
+			ranked, err := graphService.Centrality(c.Query("industry"), c.Query("metric"), limit)
+			if err != nil {
+				respondCompanyGraphError(c, err)
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "success",
+				"data":    ranked,
+				"count":   len(ranked),
+				"backend": graphService.Backend(),
+			})
+		})
+	}
+}
+
+// splitGraphTypes 解析逗号分隔的关系类型
+func splitGraphTypes(raw string) []string {
+	var types []string
+	for _, t := range strings.Split(raw, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+func respondCompanyGraphError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrCompanyGraphQuery):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrCompanyPathNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "限定跳数内没有关系路径"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "关系图查询失败: " + err.Error()})
+	}
+}
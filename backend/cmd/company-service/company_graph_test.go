@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/xiajason/zervi-basic/basic/backend/pkg/graph"
+	"gorm.io/gorm"
+)
+
+func newTestCompanyGraph(t *testing.T) (*CompanyDataSyncService, *gorm.DB) {
+	t.Helper()
+	db := newTestProfileDB(t)
+	if err := db.AutoMigrate(&EnhancedCompany{}); err != nil {
+		t.Fatal(err)
+	}
+	companies := []EnhancedCompany{
+		{ID: 1, Name: "华星控股", UnifiedSocialCreditCode: "91440300000000001X", Industry: "投资", Status: "active"},
+		{ID: 2, Name: "华星电子", UnifiedSocialCreditCode: "91440300000000002X", Industry: "电子", Status: "active"},
+		{ID: 3, Name: "晶芯半导体", UnifiedSocialCreditCode: "91440300000000003X", Industry: "电子", Status: "active"},
+		{ID: 4, Name: "远航物流", UnifiedSocialCreditCode: "91440300000000004X", Industry: "物流", Status: "active"},
+		{ID: 5, Name: "已注销贸易", UnifiedSocialCreditCode: "91440300000000005X", Industry: "电子", Status: "inactive"},
+		{ID: 6, Name: "蓝海软件", UnifiedSocialCreditCode: "91440300000000006X", Industry: "软件", Status: "active"},
+	}
+	if err := db.Create(&companies).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 企业画像中的关联企业，名称匹配不到平台企业的关系不会进入关系图
+	relationships := []CompanyRelationship{
+		{CompanyID: 1, RelatedCompanyName: "华星电子", RelationshipType: "控股", InvestmentRatio: 80},
+		{CompanyID: 1, RelatedCompanyName: "未入驻企业", RelationshipType: "参股", InvestmentRatio: 10},
+	}
+	if err := db.Create(&relationships).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewCompanyDataSyncService(db, nil, nil, nil)
+	if err := service.LoadCompanyGraph(); err != nil {
+		t.Fatal(err)
+	}
+	for _, rel := range []struct {
+		from, to uint
+		kind     string
+		weight   float64
+	}{
+		{3, 2, "供应", 0.9},
+		{2, 4, "合作", 0.6},
+		{4, 6, "合作", 0.8},
+	} {
+		if err := service.CreateCompanyRelationship(rel.from, rel.to, rel.kind, rel.weight); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return service, db
+}
+
+func TestCompanyGraphMemoryFallback(t *testing.T) {
+	service, _ := newTestCompanyGraph(t)
+	if service.GraphStore().Backend() != CompanyGraphBackendMemory {
+		t.Fatalf("backend = %s, want memory", service.GraphStore().Backend())
+	}
+	if err := service.CreateCompanyRelationship(1, 99, "投资", 0.5); err == nil {
+		t.Fatal("expected error for unknown company")
+	}
+
+	relationships, err := service.GetCompanyRelationships(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(relationships) != 1 || relationships[0].RelationshipType != "控股" || relationships[0].InvestmentAmount != 0.8 {
+		t.Fatalf("relationships = %+v", relationships)
+	}
+}
+
+func TestCompanyGraphTraversal(t *testing.T) {
+	service, db := newTestCompanyGraph(t)
+	graphService := NewCompanyGraphService(service.GraphStore(), db)
+
+	// 晶芯半导体供货给华星电子，华星电子由华星控股控股
+	reached, err := graphService.Traverse(2, "supply_chain", "upstream", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reached) != 1 || reached[0].Node.ID != 3 {
+		t.Fatalf("suppliers = %+v", reached)
+	}
+	reached, err = graphService.Traverse(2, "shareholding", "upstream", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reached) != 1 || reached[0].Node.Name != "华星控股" {
+		t.Fatalf("shareholders = %+v", reached)
+	}
+	if _, err := graphService.Traverse(2, "family", "upstream", 0); !errors.Is(err, ErrCompanyGraphQuery) {
+		t.Fatalf("got %v, want ErrCompanyGraphQuery", err)
+	}
+
+	path, err := graphService.ShortestPath(3, 6, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path.Hops != 3 || path.Nodes[1].ID != 2 {
+		t.Fatalf("path = %+v", path)
+	}
+	if _, err := graphService.ShortestPath(3, 6, 0, []string{"供应"}); !errors.Is(err, ErrCompanyPathNotFound) {
+		t.Fatalf("got %v, want ErrCompanyPathNotFound", err)
+	}
+}
+
+func TestCompanyGraphRecommendationsSkipInactive(t *testing.T) {
+	service, db := newTestCompanyGraph(t)
+	graphService := NewCompanyGraphService(service.GraphStore(), db)
+	// 已注销企业重新同步前仍在图中
+	if err := service.GraphStore().UpsertRelationship(graph.Edge{From: 5, To: 2, Type: "合作", Weight: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	recommendations, err := graphService.Recommend(3, 3, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []uint
+	for _, r := range recommendations {
+		ids = append(ids, r.Node.ID)
+	}
+	// 1和4经华星电子间接相连，6在三跳外；5已注销
+	if len(ids) != 3 || ids[2] != 6 {
+		t.Fatalf("recommendations = %v", ids)
+	}
+	for _, id := range ids {
+		if id == 5 || id == 2 {
+			t.Fatalf("recommendations = %v should skip direct partners and inactive companies", ids)
+		}
+	}
+
+	ranked, err := graphService.Centrality("电子", "degree", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ranked) != 2 || ranked[0].Node.ID != 2 {
+		t.Fatalf("centrality = %+v", ranked)
+	}
+	result, err := graphService.Communities("", 3, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Communities) == 0 {
+		t.Fatal("expected communities around company 3")
+	}
+}
@@ -0,0 +1,1086 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrPermissionGrantNotFound  = errors.New("permission grant not found")
+	ErrPermissionGrantForbidden = errors.New("no authority to manage this permission")
+	ErrPermissionGrantInvalid   = errors.New("invalid permission grant")
+	ErrPermissionGrantConflict  = errors.New("permission grant conflicts with current state")
+)
+
+// 企业用户授权状态，结束的授权保留记录，不再删除
+const (
+	CompanyUserActive  = "active"
+	CompanyUserExpired = "expired" // 到期自动收回
+	CompanyUserRevoked = "revoked" // 被授权人、上级授权人或访问审查撤销
+	CompanyUserLeft    = "left"    // 用户离开企业
+)
+
+// 访问申请状态
+const (
+	AccessRequestPending   = "pending"
+	AccessRequestApproved  = "approved"
+	AccessRequestRejected  = "rejected"
+	AccessRequestCancelled = "cancelled"
+	AccessRequestExpired   = "expired" // 超过有效期无人处理
+)
+
+// 访问审查状态
+const (
+	AccessReviewOpen      = "open"
+	AccessReviewCompleted = "completed"
+	AccessReviewLapsed    = "lapsed" // 到期时仍有未处理的授权
+)
+
+// 访问审查中每条授权的处理结果
+const (
+	AccessReviewItemPending   = "pending"
+	AccessReviewItemConfirmed = "confirmed"
+	AccessReviewItemRevoked   = "revoked"
+)
+
+// CompanyGrantConfig 企业授权的期限、转授权和审查规则
+type CompanyGrantConfig struct {
+	MaxDelegationDepth int           // 授权链最大层级，企业所有者直接授权为第1层
+	RequestTTL         time.Duration // 访问申请无人处理时自动过期
+	ReviewInterval     time.Duration // 授权距上次确认超过此时间时发起访问审查
+	ReviewWindow       time.Duration // 审查须在此时间内完成
+	RevokeUnreviewed   bool          // 审查到期时撤销仍未确认的授权
+}
+
+// DefaultCompanyGrantConfig 默认最多3层授权、申请14天过期、每90天审查一次，可通过环境变量配置
+func DefaultCompanyGrantConfig() CompanyGrantConfig {
+	config := CompanyGrantConfig{
+		MaxDelegationDepth: 3,
+		RequestTTL:         14 * 24 * time.Hour,
+		ReviewInterval:     90 * 24 * time.Hour,
+		ReviewWindow:       14 * 24 * time.Hour,
+		RevokeUnreviewed:   true,
+	}
+	if n, err := strconv.Atoi(os.Getenv("COMPANY_GRANT_MAX_DELEGATION_DEPTH")); err == nil && n > 0 {
+		config.MaxDelegationDepth = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("COMPANY_ACCESS_REVIEW_INTERVAL")); err == nil && d > 0 {
+		config.ReviewInterval = d
+	}
+	return config
+}
+
+// CompanyAccessRequest 用户申请企业访问权限，由企业的审批人处理
+type CompanyAccessRequest struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	CompanyID      uint       `json:"company_id" gorm:"not null;index"`
+	RequesterID    uint       `json:"requester_id" gorm:"not null;index"`
+	Role           string     `json:"role" gorm:"size:50;not null"`
+	Permissions    string     `json:"-" gorm:"type:json"`
+	PermissionList []string   `json:"permissions" gorm:"-"`
+	Reason         string     `json:"reason" gorm:"type:text"`
+	ExpiresAt      *time.Time `json:"expires_at"`                        // 申请的授权截止时间
+	ApproverID     uint       `json:"approver_id" gorm:"not null;index"` // 法定代表人，未设置时为企业创建者
+	Status         string     `json:"status" gorm:"size:20;not null;index"`
+	DecidedBy      *uint      `json:"decided_by"`
+	DecidedAt      *time.Time `json:"decided_at"`
+	DecisionNote   string     `json:"decision_note" gorm:"type:text"`
+	GrantID        *uint      `json:"grant_id"` // 批准后创建的授权记录
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (CompanyAccessRequest) TableName() string {
+	return "company_access_requests"
+}
+
+// AfterFind 解析申请的权限列表
+func (r *CompanyAccessRequest) AfterFind(tx *gorm.DB) error {
+	if r.Permissions != "" {
+		return json.Unmarshal([]byte(r.Permissions), &r.PermissionList)
+	}
+	return nil
+}
+
+// CompanyAccessReview 定期访问审查：企业所有者逐条确认或撤销有效授权
+type CompanyAccessReview struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	CompanyID   uint       `json:"company_id" gorm:"not null;index"`
+	ReviewerID  uint       `json:"reviewer_id" gorm:"not null"`
+	StartedBy   uint       `json:"started_by"` // 0表示定期任务发起
+	Status      string     `json:"status" gorm:"size:20;not null;index"`
+	DueAt       time.Time  `json:"due_at" gorm:"index"`
+	CompletedAt *time.Time `json:"completed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	Items []CompanyAccessReviewItem `json:"items,omitempty" gorm:"foreignKey:ReviewID"`
+}
+
+// TableName 指定表名
+func (CompanyAccessReview) TableName() string {
+	return "company_access_reviews"
+}
+
+// CompanyAccessReviewItem 审查中的一条授权
+type CompanyAccessReviewItem struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	ReviewID  uint       `json:"review_id" gorm:"not null;index"`
+	GrantID   uint       `json:"grant_id" gorm:"not null;index"`
+	UserID    uint       `json:"user_id" gorm:"not null"`
+	Role      string     `json:"role" gorm:"size:50"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Decision  string     `json:"decision" gorm:"size:20;not null"`
+	DecidedBy *uint      `json:"decided_by"` // 为空表示授权在审查期间已结束
+	DecidedAt *time.Time `json:"decided_at"`
+	Note      string     `json:"note" gorm:"size:500"`
+}
+
+// TableName 指定表名
+func (CompanyAccessReviewItem) TableName() string {
+	return "company_access_review_items"
+}
+
+// GrantInput 授予或转授企业权限
+type GrantInput struct {
+	UserID      uint       `json:"user_id" binding:"required"`
+	Role        string     `json:"role" binding:"required"`
+	Permissions []string   `json:"permissions"`
+	ExpiresAt   *time.Time `json:"expires_at"` // 为空时长期有效；转授权时默认与授权人自己的授权同时到期
+	Delegable   bool       `json:"delegable"`
+}
+
+// AccessRequestInput 访问申请
+type AccessRequestInput struct {
+	Role        string     `json:"role" binding:"required"`
+	Permissions []string   `json:"permissions"`
+	Reason      string     `json:"reason" binding:"required"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+// AccessDecisionInput 审批访问申请，批准时可以调整授权截止时间
+type AccessDecisionInput struct {
+	ExpiresAt *time.Time `json:"expires_at"`
+	Note      string     `json:"note"`
+}
+
+// GrantSweepResult 一次定期处理的结果
+type GrantSweepResult struct {
+	Expired         int `json:"expired"`
+	RequestsExpired int `json:"requests_expired"`
+	ReviewsStarted  int `json:"reviews_started"`
+	ReviewsLapsed   int `json:"reviews_lapsed"`
+}
+
+// endedGrant 事务提交后需要同步RBAC和清除缓存的授权
+type endedGrant struct {
+	companyID uint
+	userID    uint
+}
+
+// grantAuthority 操作者管理企业授权的能力
+type grantAuthority struct {
+	company *EnhancedCompany
+	root    bool         // 系统、系统管理员、企业创建者或法定代表人
+	grant   *CompanyUser // 操作者自己的有效授权，root时可能为空
+}
+
+// AutoMigrateGrants 创建授权期限、访问申请和访问审查相关的表
+func (cpm *CompanyPermissionManager) AutoMigrateGrants() error {
+	return cpm.mysqlDB.AutoMigrate(&CompanyUser{}, &CompanyPermissionAuditLog{},
+		&CompanyAccessRequest{}, &CompanyAccessReview{}, &CompanyAccessReviewItem{})
+}
+
+// StartGrantScheduler 定期收回到期授权、过期无人处理的申请并发起和结束访问审查
+func (cpm *CompanyPermissionManager) StartGrantScheduler(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				result, err := cpm.SweepGrants()
+				if err != nil {
+					log.Printf("处理企业授权到期失败: %v", err)
+				} else if result.Expired+result.RequestsExpired+result.ReviewsStarted+result.ReviewsLapsed > 0 {
+					log.Printf("企业授权定期处理: %d个授权到期, %d个申请过期, 发起%d个审查, %d个审查到期",
+						result.Expired, result.RequestsExpired, result.ReviewsStarted, result.ReviewsLapsed)
+				}
+			}
+		}
+	}()
+}
+
+// activeGrants 有效且未到期的授权
+func (cpm *CompanyPermissionManager) activeGrants(tx *gorm.DB) *gorm.DB {
+	return tx.Model(&CompanyUser{}).Where("status = ? AND (expires_at IS NULL OR expires_at > ?)", CompanyUserActive, timeNow())
+}
+
+// authority 判断操作者对企业授权的管理能力，actorID为0表示系统
+func (cpm *CompanyPermissionManager) authority(tx *gorm.DB, companyID, actorID uint) (*grantAuthority, error) {
+	var company EnhancedCompany
+	if err := tx.First(&company, companyID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: 企业不存在", ErrPermissionGrantNotFound)
+		}
+		return nil, err
+	}
+	auth := &grantAuthority{company: &company}
+	if actorID == 0 || company.CreatedBy == actorID || company.LegalRepUserID == actorID {
+		auth.root = true
+	} else {
+		var user User
+		if err := tx.First(&user, actorID).Error; err == nil && (user.Role == "admin" || user.Role == "super_admin") {
+			auth.root = true
+		}
+	}
+	var grant CompanyUser
+	if err := cpm.activeGrants(tx).Where("company_id = ? AND user_id = ?", companyID, actorID).First(&grant).Error; err == nil {
+		auth.grant = &grant
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return auth, nil
+}
+
+// canManage 操作者是否可以管理某条授权：企业所有者，或授权链上的上级授权人
+func (cpm *CompanyPermissionManager) canManage(tx *gorm.DB, auth *grantAuthority, grant *CompanyUser) (bool, error) {
+	if auth.root {
+		return true, nil
+	}
+	if auth.grant == nil {
+		return false, nil
+	}
+	for parentID := grant.ParentID; parentID != nil; {
+		if *parentID == auth.grant.ID {
+			return true, nil
+		}
+		var parent CompanyUser
+		if err := tx.Select("id", "parent_id").First(&parent, *parentID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+		parentID = parent.ParentID
+	}
+	return false, nil
+}
+
+// GrantAccess 授予企业权限。企业所有者直接授权；持有可转授权授权的用户可以在自己的权限、期限和层级限制内转授
+func (cpm *CompanyPermissionManager) GrantAccess(companyID, actorID uint, in GrantInput, c *gin.Context) (*CompanyUser, error) {
+	var created *CompanyUser
+	err := cpm.mysqlDB.Transaction(func(tx *gorm.DB) error {
+		auth, err := cpm.authority(tx, companyID, actorID)
+		if err != nil {
+			return err
+		}
+		var parent *CompanyUser
+		if !auth.root {
+			if auth.grant == nil || !auth.grant.Delegable {
+				return fmt.Errorf("%w: 只有企业所有者或持有可转授权授权的用户可以授权", ErrPermissionGrantForbidden)
+			}
+			parent = auth.grant
+		}
+		if in.UserID == actorID {
+			return fmt.Errorf("%w: 不能给自己授权", ErrPermissionGrantInvalid)
+		}
+		created, err = cpm.createGrant(tx, companyID, actorID, parent, in, c)
+		return err
+	})
+	if err != nil {
+		cpm.auditDenied(companyID, actorID, "grant_access", err, c)
+		return nil, err
+	}
+	cpm.syncCompanyRole(companyID, created.UserID, CompanyRole(created.Role))
+	cpm.clearCompanyPermissionCache(companyID)
+	return created, nil
+}
+
+// createGrant 创建授权记录，parent为空表示企业所有者直接授权
+func (cpm *CompanyPermissionManager) createGrant(tx *gorm.DB, companyID, actorID uint, parent *CompanyUser, in GrantInput, c *gin.Context) (*CompanyUser, error) {
+	now := timeNow()
+	in.Role = strings.TrimSpace(in.Role)
+	switch {
+	case in.Role == "":
+		return nil, fmt.Errorf("%w: 角色不能为空", ErrPermissionGrantInvalid)
+	case in.Role == string(RoleLegalRepresentative):
+		return nil, fmt.Errorf("%w: 法定代表人需单独设置", ErrPermissionGrantInvalid)
+	case in.ExpiresAt != nil && !in.ExpiresAt.After(now):
+		return nil, fmt.Errorf("%w: 截止时间必须晚于当前时间", ErrPermissionGrantInvalid)
+	}
+	var user User
+	if err := tx.First(&user, in.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: 用户不存在", ErrPermissionGrantNotFound)
+		}
+		return nil, err
+	}
+	var existing int64
+	if err := cpm.activeGrants(tx).Where("company_id = ? AND user_id = ?", companyID, in.UserID).Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, fmt.Errorf("%w: 用户已有该企业的有效授权", ErrPermissionGrantConflict)
+	}
+
+	grant := CompanyUser{
+		CompanyID:       companyID,
+		UserID:          in.UserID,
+		Role:            in.Role,
+		Status:          CompanyUserActive,
+		GrantedBy:       actorID,
+		DelegationDepth: 1,
+		Delegable:       in.Delegable,
+		ExpiresAt:       in.ExpiresAt,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	grant.SetPermissions(in.Permissions)
+	action := "grant_access"
+	if parent != nil {
+		action = "delegate_access"
+		grant.ParentID = &parent.ID
+		grant.DelegationDepth = parent.DelegationDepth + 1
+		if grant.DelegationDepth > cpm.grantConfig.MaxDelegationDepth {
+			return nil, fmt.Errorf("%w: 授权链已达最大层级%d", ErrPermissionGrantForbidden, cpm.grantConfig.MaxDelegationDepth)
+		}
+		if !coversPermissions(parent.GetPermissions(), in.Permissions) {
+			return nil, fmt.Errorf("%w: 转授的权限超出了授权人自己的权限", ErrPermissionGrantForbidden)
+		}
+		if in.Role == string(RoleAdmin) && parent.Role != string(RoleAdmin) {
+			return nil, fmt.Errorf("%w: 只有管理员可以转授管理员角色", ErrPermissionGrantForbidden)
+		}
+		if parent.ExpiresAt != nil {
+			if grant.ExpiresAt == nil {
+				grant.ExpiresAt = parent.ExpiresAt
+			} else if grant.ExpiresAt.After(*parent.ExpiresAt) {
+				return nil, fmt.Errorf("%w: 转授权不能晚于授权人自己的授权到期", ErrPermissionGrantInvalid)
+			}
+		}
+	}
+	if grant.Delegable && grant.DelegationDepth >= cpm.grantConfig.MaxDelegationDepth {
+		return nil, fmt.Errorf("%w: 第%d层授权不能再允许转授权", ErrPermissionGrantInvalid, grant.DelegationDepth)
+	}
+	if err := tx.Omit(clause.Associations).Create(&grant).Error; err != nil {
+		return nil, err
+	}
+	return &grant, cpm.recordGrantAudit(tx, companyID, actorID, action, "company_user", grant.ID, map[string]interface{}{
+		"target_user_id":   grant.UserID,
+		"role":             grant.Role,
+		"permissions":      grant.GetPermissions(),
+		"expires_at":       grant.ExpiresAt,
+		"delegable":        grant.Delegable,
+		"delegation_depth": grant.DelegationDepth,
+		"parent_id":        grant.ParentID,
+	}, c)
+}
+
+// coversPermissions 授权人的权限是否包含转授的全部权限，"*"表示全部权限
+func coversPermissions(held, requested []string) bool {
+	set := make(map[string]bool, len(held))
+	for _, p := range held {
+		if p == "*" {
+			return true
+		}
+		set[p] = true
+	}
+	for _, p := range requested {
+		if !set[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// RevokeGrant 撤销授权及其下游的全部转授权
+func (cpm *CompanyPermissionManager) RevokeGrant(companyID, grantID, actorID uint, reason string, c *gin.Context) (*CompanyUser, error) {
+	var ended []endedGrant
+	var revoked CompanyUser
+	err := cpm.mysqlDB.Transaction(func(tx *gorm.DB) error {
+		auth, err := cpm.authority(tx, companyID, actorID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("id = ? AND company_id = ?", grantID, companyID).First(&revoked).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: 授权记录不存在", ErrPermissionGrantNotFound)
+			}
+			return err
+		}
+		if revoked.Status != CompanyUserActive {
+			return fmt.Errorf("%w: 授权已结束", ErrPermissionGrantConflict)
+		}
+		allowed, err := cpm.canManage(tx, auth, &revoked)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return fmt.Errorf("%w: 只能撤销自己授出的授权", ErrPermissionGrantForbidden)
+		}
+		if reason == "" {
+			reason = "授权人撤销"
+		}
+		ended, err = cpm.endGrant(tx, &revoked, CompanyUserRevoked, reason, actorID, c)
+		return err
+	})
+	if err != nil {
+		cpm.auditDenied(companyID, actorID, "revoke_access", err, c)
+		return nil, err
+	}
+	cpm.afterGrantsEnded(ended)
+	return &revoked, nil
+}
+
+// endGrant 结束一条授权，并级联撤销从它转授出去的授权。返回所有被结束的授权
+func (cpm *CompanyPermissionManager) endGrant(tx *gorm.DB, grant *CompanyUser, status, reason string, actorID uint, c *gin.Context) ([]endedGrant, error) {
+	now := timeNow()
+	result := tx.Model(&CompanyUser{}).Where("id = ? AND status = ?", grant.ID, CompanyUserActive).Updates(map[string]interface{}{
+		"status":     status,
+		"ended_at":   now,
+		"end_reason": reason,
+		"updated_at": now,
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	grant.Status, grant.EndedAt, grant.EndReason = status, &now, reason
+
+	action := map[string]string{
+		CompanyUserExpired: "expire_access",
+		CompanyUserRevoked: "revoke_access",
+		CompanyUserLeft:    "leave_company",
+	}[status]
+	if err := cpm.recordGrantAudit(tx, grant.CompanyID, actorID, action, "company_user", grant.ID, map[string]interface{}{
+		"target_user_id": grant.UserID,
+		"role":           grant.Role,
+		"reason":         reason,
+		"parent_id":      grant.ParentID,
+	}, c); err != nil {
+		return nil, err
+	}
+	// 审查中尚未处理的这条授权不再需要处理
+	if err := tx.Model(&CompanyAccessReviewItem{}).Where("grant_id = ? AND decision = ?", grant.ID, AccessReviewItemPending).
+		Updates(map[string]interface{}{"decision": AccessReviewItemRevoked, "decided_at": now, "note": reason}).Error; err != nil {
+		return nil, err
+	}
+
+	ended := []endedGrant{{grant.CompanyID, grant.UserID}}
+	var children []CompanyUser
+	if err := tx.Where("parent_id = ? AND status = ?", grant.ID, CompanyUserActive).Find(&children).Error; err != nil {
+		return nil, err
+	}
+	for i := range children {
+		more, err := cpm.endGrant(tx, &children[i], CompanyUserRevoked, fmt.Sprintf("上级授权#%d已结束", grant.ID), actorID, c)
+		if err != nil {
+			return nil, err
+		}
+		ended = append(ended, more...)
+	}
+	return ended, nil
+}
+
+// afterGrantsEnded 授权结束后移除RBAC企业域角色并清除权限缓存
+func (cpm *CompanyPermissionManager) afterGrantsEnded(grants []endedGrant) {
+	cleared := make(map[uint]bool)
+	for _, g := range grants {
+		cpm.syncCompanyRole(g.companyID, g.userID, "")
+		if !cleared[g.companyID] {
+			cleared[g.companyID] = true
+			cpm.clearCompanyPermissionCache(g.companyID)
+		}
+	}
+}
+
+// UserLeftCompany 用户离开企业：结束其授权并撤销其转授出去的全部授权，取消其未处理的访问申请
+func (cpm *CompanyPermissionManager) UserLeftCompany(companyID, userID, actorID uint, c *gin.Context) error {
+	var ended []endedGrant
+	err := cpm.mysqlDB.Transaction(func(tx *gorm.DB) error {
+		auth, err := cpm.authority(tx, companyID, actorID)
+		if err != nil {
+			return err
+		}
+		if !auth.root && actorID != userID {
+			return fmt.Errorf("%w: 只有企业所有者或用户本人可以办理离开企业", ErrPermissionGrantForbidden)
+		}
+		if auth.company.LegalRepUserID == userID {
+			return fmt.Errorf("%w: 法定代表人离开前需先变更法定代表人", ErrPermissionGrantInvalid)
+		}
+		var grants []CompanyUser
+		if err := tx.Where("company_id = ? AND user_id = ? AND status = ?", companyID, userID, CompanyUserActive).Find(&grants).Error; err != nil {
+			return err
+		}
+		if len(grants) == 0 {
+			return fmt.Errorf("%w: 用户没有该企业的有效授权", ErrPermissionGrantNotFound)
+		}
+		for i := range grants {
+			more, err := cpm.endGrant(tx, &grants[i], CompanyUserLeft, "用户离开企业", actorID, c)
+			if err != nil {
+				return err
+			}
+			ended = append(ended, more...)
+		}
+		now := timeNow()
+		return tx.Model(&CompanyAccessRequest{}).Where("company_id = ? AND requester_id = ? AND status = ?",
+			companyID, userID, AccessRequestPending).Updates(map[string]interface{}{
+			"status": AccessRequestCancelled, "decision_note": "用户离开企业", "decided_at": now, "updated_at": now,
+		}).Error
+	})
+	if err != nil {
+		cpm.auditDenied(companyID, actorID, "leave_company", err, c)
+		return err
+	}
+	cpm.afterGrantsEnded(ended)
+	return nil
+}
+
+// ListGrants 企业的授权记录，status为空时返回全部
+func (cpm *CompanyPermissionManager) ListGrants(companyID uint, status string) ([]CompanyUser, error) {
+	var grants []CompanyUser
+	query := cpm.mysqlDB.Preload("User").Where("company_id = ?", companyID).Order("id")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	return grants, query.Find(&grants).Error
+}
+
+// RequestAccess 提交访问申请，申请转给企业法定代表人（未设置时为企业创建者）审批
+func (cpm *CompanyPermissionManager) RequestAccess(companyID, requesterID uint, in AccessRequestInput, c *gin.Context) (*CompanyAccessRequest, error) {
+	var request *CompanyAccessRequest
+	err := cpm.mysqlDB.Transaction(func(tx *gorm.DB) error {
+		auth, err := cpm.authority(tx, companyID, requesterID)
+		if err != nil {
+			return err
+		}
+		now := timeNow()
+		in.Role = strings.TrimSpace(in.Role)
+		switch {
+		case auth.root || auth.grant != nil:
+			return fmt.Errorf("%w: 已有该企业的访问权限", ErrPermissionGrantConflict)
+		case in.Role == "" || in.Role == string(RoleLegalRepresentative):
+			return fmt.Errorf("%w: 无效的角色", ErrPermissionGrantInvalid)
+		case in.ExpiresAt != nil && !in.ExpiresAt.After(now):
+			return fmt.Errorf("%w: 截止时间必须晚于当前时间", ErrPermissionGrantInvalid)
+		}
+		var pending int64
+		if err := tx.Model(&CompanyAccessRequest{}).Where("company_id = ? AND requester_id = ? AND status = ?",
+			companyID, requesterID, AccessRequestPending).Count(&pending).Error; err != nil {
+			return err
+		}
+		if pending > 0 {
+			return fmt.Errorf("%w: 已有等待审批的申请", ErrPermissionGrantConflict)
+		}
+
+		approver := auth.company.LegalRepUserID
+		if approver == 0 {
+			approver = auth.company.CreatedBy
+		}
+		request = &CompanyAccessRequest{
+			CompanyID:      companyID,
+			RequesterID:    requesterID,
+			Role:           in.Role,
+			PermissionList: in.Permissions,
+			Reason:         strings.TrimSpace(in.Reason),
+			ExpiresAt:      in.ExpiresAt,
+			ApproverID:     approver,
+			Status:         AccessRequestPending,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if len(in.Permissions) > 0 {
+			permissions, _ := json.Marshal(in.Permissions)
+			request.Permissions = string(permissions)
+		}
+		if err := tx.Create(request).Error; err != nil {
+			return err
+		}
+		return cpm.recordGrantAudit(tx, companyID, requesterID, "request_access", "access_request", request.ID, map[string]interface{}{
+			"role":        request.Role,
+			"permissions": in.Permissions,
+			"expires_at":  request.ExpiresAt,
+			"approver_id": approver,
+		}, c)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// GetAccessRequest 获取访问申请
+func (cpm *CompanyPermissionManager) GetAccessRequest(requestID uint) (*CompanyAccessRequest, error) {
+	var request CompanyAccessRequest
+	if err := cpm.mysqlDB.First(&request, requestID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: 访问申请不存在", ErrPermissionGrantNotFound)
+		}
+		return nil, err
+	}
+	return &request, nil
+}
+
+// ListAccessRequests 按企业或申请人查询访问申请，status为空时返回全部
+func (cpm *CompanyPermissionManager) ListAccessRequests(companyID, requesterID uint, status string) ([]CompanyAccessRequest, error) {
+	var requests []CompanyAccessRequest
+	query := cpm.mysqlDB.Order("id DESC")
+	if companyID > 0 {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if requesterID > 0 {
+		query = query.Where("requester_id = ?", requesterID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	return requests, query.Find(&requests).Error
+}
+
+// DecideAccessRequest 审批访问申请。审批人或企业所有者可以处理，批准后按申请创建授权
+func (cpm *CompanyPermissionManager) DecideAccessRequest(requestID, actorID uint, approve bool, in AccessDecisionInput, c *gin.Context) (*CompanyAccessRequest, error) {
+	var request CompanyAccessRequest
+	var grant *CompanyUser
+	err := cpm.mysqlDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&request, requestID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: 访问申请不存在", ErrPermissionGrantNotFound)
+			}
+			return err
+		}
+		auth, err := cpm.authority(tx, request.CompanyID, actorID)
+		if err != nil {
+			return err
+		}
+		if !auth.root && request.ApproverID != actorID {
+			return fmt.Errorf("%w: 只有审批人或企业所有者可以处理访问申请", ErrPermissionGrantForbidden)
+		}
+		if request.Status != AccessRequestPending {
+			return fmt.Errorf("%w: 申请已处理", ErrPermissionGrantConflict)
+		}
+
+		now := timeNow()
+		status, action := AccessRequestRejected, "reject_access_request"
+		values := map[string]interface{}{"decided_by": actorID, "decided_at": now, "decision_note": in.Note, "updated_at": now}
+		if approve {
+			status, action = AccessRequestApproved, "approve_access_request"
+			expiresAt := request.ExpiresAt
+			if in.ExpiresAt != nil {
+				expiresAt = in.ExpiresAt
+			}
+			grant, err = cpm.createGrant(tx, request.CompanyID, actorID, nil, GrantInput{
+				UserID:      request.RequesterID,
+				Role:        request.Role,
+				Permissions: request.PermissionList,
+				ExpiresAt:   expiresAt,
+			}, c)
+			if err != nil {
+				return err
+			}
+			values["grant_id"] = grant.ID
+		}
+		values["status"] = status
+		result := tx.Model(&CompanyAccessRequest{}).Where("id = ? AND status = ?", request.ID, AccessRequestPending).Updates(values)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w: 申请已被并发处理", ErrPermissionGrantConflict)
+		}
+		return cpm.recordGrantAudit(tx, request.CompanyID, actorID, action, "access_request", request.ID, map[string]interface{}{
+			"requester_id": request.RequesterID,
+			"note":         in.Note,
+			"grant_id":     values["grant_id"],
+		}, c)
+	})
+	if err != nil {
+		cpm.auditDenied(request.CompanyID, actorID, "decide_access_request", err, c)
+		return nil, err
+	}
+	if grant != nil {
+		cpm.syncCompanyRole(grant.CompanyID, grant.UserID, CompanyRole(grant.Role))
+		cpm.clearCompanyPermissionCache(grant.CompanyID)
+	}
+	return cpm.GetAccessRequest(requestID)
+}
+
+// CancelAccessRequest 申请人撤回未处理的访问申请
+func (cpm *CompanyPermissionManager) CancelAccessRequest(requestID, actorID uint, c *gin.Context) (*CompanyAccessRequest, error) {
+	err := cpm.mysqlDB.Transaction(func(tx *gorm.DB) error {
+		var request CompanyAccessRequest
+		if err := tx.First(&request, requestID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: 访问申请不存在", ErrPermissionGrantNotFound)
+			}
+			return err
+		}
+		if request.RequesterID != actorID {
+			return fmt.Errorf("%w: 只有申请人可以撤回申请", ErrPermissionGrantForbidden)
+		}
+		now := timeNow()
+		result := tx.Model(&CompanyAccessRequest{}).Where("id = ? AND status = ?", request.ID, AccessRequestPending).
+			Updates(map[string]interface{}{"status": AccessRequestCancelled, "decided_at": now, "updated_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w: 申请已处理", ErrPermissionGrantConflict)
+		}
+		return cpm.recordGrantAudit(tx, request.CompanyID, actorID, "cancel_access_request", "access_request", request.ID, nil, c)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cpm.GetAccessRequest(requestID)
+}
+
+// StartAccessReview 发起访问审查，列出企业当前全部有效授权。actorID为0表示定期任务发起
+func (cpm *CompanyPermissionManager) StartAccessReview(companyID, actorID uint, c *gin.Context) (*CompanyAccessReview, error) {
+	var review CompanyAccessReview
+	err := cpm.mysqlDB.Transaction(func(tx *gorm.DB) error {
+		auth, err := cpm.authority(tx, companyID, actorID)
+		if err != nil {
+			return err
+		}
+		if !auth.root {
+			return fmt.Errorf("%w: 只有企业所有者可以发起访问审查", ErrPermissionGrantForbidden)
+		}
+		var open int64
+		if err := tx.Model(&CompanyAccessReview{}).Where("company_id = ? AND status = ?", companyID, AccessReviewOpen).Count(&open).Error; err != nil {
+			return err
+		}
+		if open > 0 {
+			return fmt.Errorf("%w: 已有进行中的访问审查", ErrPermissionGrantConflict)
+		}
+		var grants []CompanyUser
+		if err := cpm.activeGrants(tx).Where("company_id = ? AND role <> ?", companyID, string(RoleLegalRepresentative)).
+			Order("id").Find(&grants).Error; err != nil {
+			return err
+		}
+		if len(grants) == 0 {
+			return fmt.Errorf("%w: 没有需要审查的授权", ErrPermissionGrantInvalid)
+		}
+
+		now := timeNow()
+		reviewer := auth.company.LegalRepUserID
+		if reviewer == 0 {
+			reviewer = auth.company.CreatedBy
+		}
+		review = CompanyAccessReview{
+			CompanyID:  companyID,
+			ReviewerID: reviewer,
+			StartedBy:  actorID,
+			Status:     AccessReviewOpen,
+			DueAt:      now.Add(cpm.grantConfig.ReviewWindow),
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		for _, g := range grants {
+			review.Items = append(review.Items, CompanyAccessReviewItem{
+				GrantID: g.ID, UserID: g.UserID, Role: g.Role, ExpiresAt: g.ExpiresAt, Decision: AccessReviewItemPending,
+			})
+		}
+		if err := tx.Create(&review).Error; err != nil {
+			return err
+		}
+		return cpm.recordGrantAudit(tx, companyID, actorID, "start_access_review", "access_review", review.ID, map[string]interface{}{
+			"items":  len(review.Items),
+			"due_at": review.DueAt,
+		}, c)
+	})
+	if err != nil {
+		cpm.auditDenied(companyID, actorID, "start_access_review", err, c)
+		return nil, err
+	}
+	return cpm.GetAccessReview(review.ID)
+}
+
+// GetAccessReview 获取访问审查及其全部授权项
+func (cpm *CompanyPermissionManager) GetAccessReview(reviewID uint) (*CompanyAccessReview, error) {
+	var review CompanyAccessReview
+	if err := cpm.mysqlDB.Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).First(&review, reviewID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: 访问审查不存在", ErrPermissionGrantNotFound)
+		}
+		return nil, err
+	}
+	return &review, nil
+}
+
+// ListAccessReviews 企业的访问审查记录
+func (cpm *CompanyPermissionManager) ListAccessReviews(companyID uint) ([]CompanyAccessReview, error) {
+	var reviews []CompanyAccessReview
+	return reviews, cpm.mysqlDB.Where("company_id = ?", companyID).Order("id DESC").Find(&reviews).Error
+}
+
+// DecideReviewItem 企业所有者确认或撤销审查中的一条授权，全部处理完后审查结束
+func (cpm *CompanyPermissionManager) DecideReviewItem(reviewID, itemID, actorID uint, confirm bool, note string, c *gin.Context) (*CompanyAccessReview, error) {
+	var ended []endedGrant
+	var companyID uint
+	err := cpm.mysqlDB.Transaction(func(tx *gorm.DB) error {
+		var review CompanyAccessReview
+		if err := tx.First(&review, reviewID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: 访问审查不存在", ErrPermissionGrantNotFound)
+			}
+			return err
+		}
+		companyID = review.CompanyID
+		auth, err := cpm.authority(tx, review.CompanyID, actorID)
+		if err != nil {
+			return err
+		}
+		if !auth.root {
+			return fmt.Errorf("%w: 只有企业所有者可以处理访问审查", ErrPermissionGrantForbidden)
+		}
+		if review.Status != AccessReviewOpen {
+			return fmt.Errorf("%w: 访问审查已结束", ErrPermissionGrantConflict)
+		}
+		var item CompanyAccessReviewItem
+		if err := tx.Where("id = ? AND review_id = ?", itemID, reviewID).First(&item).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: 审查项不存在", ErrPermissionGrantNotFound)
+			}
+			return err
+		}
+		if item.Decision != AccessReviewItemPending {
+			return fmt.Errorf("%w: 审查项已处理", ErrPermissionGrantConflict)
+		}
+
+		now := timeNow()
+		decision := AccessReviewItemConfirmed
+		if confirm {
+			if err := tx.Model(&CompanyUser{}).Where("id = ?", item.GrantID).
+				Updates(map[string]interface{}{"last_reviewed_at": now, "updated_at": now}).Error; err != nil {
+				return err
+			}
+			if err := cpm.recordGrantAudit(tx, review.CompanyID, actorID, "confirm_access", "company_user", item.GrantID, map[string]interface{}{
+				"target_user_id": item.UserID,
+				"review_id":      review.ID,
+				"note":           note,
+			}, c); err != nil {
+				return err
+			}
+		} else {
+			decision = AccessReviewItemRevoked
+			var grant CompanyUser
+			if err := tx.First(&grant, item.GrantID).Error; err != nil {
+				return err
+			}
+			reason := fmt.Sprintf("访问审查#%d撤销", review.ID)
+			if note != "" {
+				reason += ": " + note
+			}
+			if ended, err = cpm.endGrant(tx, &grant, CompanyUserRevoked, reason, actorID, c); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&item).Updates(map[string]interface{}{
+			"decision": decision, "decided_by": actorID, "decided_at": now, "note": note,
+		}).Error; err != nil {
+			return err
+		}
+		return cpm.completeReviewIfDone(tx, &review, actorID, c)
+	})
+	if err != nil {
+		cpm.auditDenied(companyID, actorID, "decide_access_review", err, c)
+		return nil, err
+	}
+	cpm.afterGrantsEnded(ended)
+	return cpm.GetAccessReview(reviewID)
+}
+
+// completeReviewIfDone 全部授权项都已处理时结束审查
+func (cpm *CompanyPermissionManager) completeReviewIfDone(tx *gorm.DB, review *CompanyAccessReview, actorID uint, c *gin.Context) error {
+	var pending int64
+	if err := tx.Model(&CompanyAccessReviewItem{}).Where("review_id = ? AND decision = ?", review.ID, AccessReviewItemPending).
+		Count(&pending).Error; err != nil {
+		return err
+	}
+	if pending > 0 {
+		return nil
+	}
+	now := timeNow()
+	if err := tx.Model(review).Updates(map[string]interface{}{
+		"status": AccessReviewCompleted, "completed_at": now, "updated_at": now,
+	}).Error; err != nil {
+		return err
+	}
+	return cpm.recordGrantAudit(tx, review.CompanyID, actorID, "complete_access_review", "access_review", review.ID, nil, c)
+}
+
+// SweepGrants 定期处理：收回到期授权、过期无人处理的申请、结束到期的审查、发起新一轮审查
+func (cpm *CompanyPermissionManager) SweepGrants() (GrantSweepResult, error) {
+	var result GrantSweepResult
+	now := timeNow()
+
+	var expiring []CompanyUser
+	if err := cpm.mysqlDB.Where("status = ? AND expires_at <= ?", CompanyUserActive, now).Order("delegation_depth, id").
+		Find(&expiring).Error; err != nil {
+		return result, err
+	}
+	for i := range expiring {
+		var ended []endedGrant
+		err := cpm.mysqlDB.Transaction(func(tx *gorm.DB) error {
+			var err error
+			ended, err = cpm.endGrant(tx, &expiring[i], CompanyUserExpired, "授权到期", 0, nil)
+			return err
+		})
+		if err != nil {
+			return result, err
+		}
+		if len(ended) > 0 {
+			result.Expired++
+			cpm.afterGrantsEnded(ended)
+		}
+	}
+
+	var stale []CompanyAccessRequest
+	if err := cpm.mysqlDB.Where("status = ? AND created_at < ?", AccessRequestPending, now.Add(-cpm.grantConfig.RequestTTL)).
+		Find(&stale).Error; err != nil {
+		return result, err
+	}
+	for _, request := range stale {
+		err := cpm.mysqlDB.Transaction(func(tx *gorm.DB) error {
+			updated := tx.Model(&CompanyAccessRequest{}).Where("id = ? AND status = ?", request.ID, AccessRequestPending).
+				Updates(map[string]interface{}{"status": AccessRequestExpired, "decided_at": now, "updated_at": now})
+			if updated.Error != nil || updated.RowsAffected == 0 {
+				return updated.Error
+			}
+			result.RequestsExpired++
+			return cpm.recordGrantAudit(tx, request.CompanyID, 0, "expire_access_request", "access_request", request.ID, nil, nil)
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+
+	var overdue []CompanyAccessReview
+	if err := cpm.mysqlDB.Where("status = ? AND due_at < ?", AccessReviewOpen, now).Find(&overdue).Error; err != nil {
+		return result, err
+	}
+	for i := range overdue {
+		ended, err := cpm.lapseReview(&overdue[i])
+		if err != nil {
+			return result, err
+		}
+		result.ReviewsLapsed++
+		cpm.afterGrantsEnded(ended)
+	}
+
+	// 有授权超过审查周期未确认、且没有进行中审查的企业发起新一轮审查
+	cutoff := now.Add(-cpm.grantConfig.ReviewInterval)
+	var companyIDs []uint
+	if err := cpm.activeGrants(cpm.mysqlDB).
+		Where("role <> ? AND (last_reviewed_at < ? OR (last_reviewed_at IS NULL AND created_at < ?))", string(RoleLegalRepresentative), cutoff, cutoff).
+		Where("company_id NOT IN (?)", cpm.mysqlDB.Model(&CompanyAccessReview{}).Select("company_id").Where("status = ?", AccessReviewOpen)).
+		Distinct("company_id").Pluck("company_id", &companyIDs).Error; err != nil {
+		return result, err
+	}
+	for _, companyID := range companyIDs {
+		if _, err := cpm.StartAccessReview(companyID, 0, nil); err != nil {
+			log.Printf("发起企业%d访问审查失败: %v", companyID, err)
+			continue
+		}
+		result.ReviewsStarted++
+	}
+	return result, nil
+}
+
+// lapseReview 审查到期：按配置撤销仍未确认的授权
+func (cpm *CompanyPermissionManager) lapseReview(review *CompanyAccessReview) ([]endedGrant, error) {
+	var ended []endedGrant
+	err := cpm.mysqlDB.Transaction(func(tx *gorm.DB) error {
+		now := timeNow()
+		updated := tx.Model(&CompanyAccessReview{}).Where("id = ? AND status = ?", review.ID, AccessReviewOpen).
+			Updates(map[string]interface{}{"status": AccessReviewLapsed, "completed_at": now, "updated_at": now})
+		if updated.Error != nil || updated.RowsAffected == 0 {
+			return updated.Error
+		}
+		var items []CompanyAccessReviewItem
+		if err := tx.Where("review_id = ? AND decision = ?", review.ID, AccessReviewItemPending).Find(&items).Error; err != nil {
+			return err
+		}
+		if err := cpm.recordGrantAudit(tx, review.CompanyID, 0, "lapse_access_review", "access_review", review.ID, map[string]interface{}{
+			"unreviewed":        len(items),
+			"revoke_unreviewed": cpm.grantConfig.RevokeUnreviewed,
+		}, nil); err != nil {
+			return err
+		}
+		if !cpm.grantConfig.RevokeUnreviewed {
+			return nil
+		}
+		for _, item := range items {
+			var grant CompanyUser
+			if err := tx.First(&grant, item.GrantID).Error; err != nil {
+				return err
+			}
+			more, err := cpm.endGrant(tx, &grant, CompanyUserRevoked, fmt.Sprintf("访问审查#%d到期未确认", review.ID), 0, nil)
+			if err != nil {
+				return err
+			}
+			ended = append(ended, more...)
+		}
+		return nil
+	})
+	return ended, err
+}
+
+// recordGrantAudit 授权变更写入企业权限审计日志，actorID为0表示系统
+func (cpm *CompanyPermissionManager) recordGrantAudit(tx *gorm.DB, companyID, actorID uint, action, resourceType string, resourceID uint, details map[string]interface{}, c *gin.Context) error {
+	entry := CompanyPermissionAuditLog{
+		CompanyID:        companyID,
+		UserID:           actorID,
+		Action:           action,
+		ResourceType:     resourceType,
+		ResourceID:       &resourceID,
+		PermissionResult: true,
+		CreatedAt:        timeNow(),
+	}
+	if len(details) > 0 {
+		detailsJSON, _ := json.Marshal(details)
+		entry.Details = string(detailsJSON)
+	}
+	if c != nil {
+		entry.IPAddress = c.ClientIP()
+		entry.UserAgent = c.GetHeader("User-Agent")
+	}
+	return tx.Omit(clause.Associations).Create(&entry).Error
+}
+
+// auditDenied 记录被拒绝的授权操作
+func (cpm *CompanyPermissionManager) auditDenied(companyID, actorID uint, action string, err error, c *gin.Context) {
+	if companyID == 0 || !errors.Is(err, ErrPermissionGrantForbidden) {
+		return
+	}
+	entry := CompanyPermissionAuditLog{
+		CompanyID:    companyID,
+		UserID:       actorID,
+		Action:       action,
+		ResourceType: "company_user",
+		Details:      fmt.Sprintf(`{"error":%q}`, err.Error()),
+		CreatedAt:    timeNow(),
+	}
+	if c != nil {
+		entry.IPAddress = c.ClientIP()
+		entry.UserAgent = c.GetHeader("User-Agent")
+	}
+	if err := cpm.mysqlDB.Omit(clause.Associations).Create(&entry).Error; err != nil {
+		log.Printf("记录授权审计日志失败: %v", err)
+	}
+}
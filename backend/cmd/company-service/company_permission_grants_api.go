@@ -0,0 +1,352 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// companyGrantSweepInterval 授权到期和访问审查检查间隔
+const companyGrantSweepInterval = time.Minute
+
+// setupGrantRoutes 设置授权期限、转授权、访问申请和访问审查路由
+func (api *CompanyAuthAPI) setupGrantRoutes(auth *gin.RouterGroup) {
+	// 授权记录与撤销
+	auth.GET("/company/:company_id/grants", api.listGrants)
+	auth.POST("/company/:company_id/grants/:grant_id/revoke", api.revokeGrant)
+	auth.POST("/company/:company_id/members/:user_id/leave", api.leaveCompany)
+
+	// 访问申请
+	auth.POST("/company/:company_id/access-requests", api.requestAccess)
+	auth.GET("/company/:company_id/access-requests", api.listCompanyAccessRequests)
+	auth.GET("/access-requests/mine", api.listMyAccessRequests)
+	auth.POST("/access-requests/:id/approve", api.approveAccessRequest)
+	auth.POST("/access-requests/:id/reject", api.rejectAccessRequest)
+	auth.POST("/access-requests/:id/cancel", api.cancelAccessRequest)
+
+	// 访问审查
+	auth.POST("/company/:company_id/access-reviews", api.startAccessReview)
+	auth.GET("/company/:company_id/access-reviews", api.listAccessReviews)
+	auth.GET("/access-reviews/:id", api.getAccessReview)
+	auth.PUT("/access-reviews/:id/items/:item_id", api.decideReviewItem)
+}
+
+// listGrants 企业的授权记录，包括已结束的授权
+func (api *CompanyAuthAPI) listGrants(c *gin.Context) {
+	companyID, userID, ok := grantRequestContext(c, "company_id")
+	if !ok {
+		return
+	}
+	if !api.permissionManager.CheckCompanyAccess(userID, companyID, "view_authorized_users", c) {
+		return
+	}
+
+	grants, err := api.permissionManager.ListGrants(companyID, c.Query("status"))
+	if err != nil {
+		respondGrantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   grants,
+	})
+}
+
+// revokeGrant 撤销授权，从它转授出去的授权一并撤销
+func (api *CompanyAuthAPI) revokeGrant(c *gin.Context) {
+	companyID, userID, ok := grantRequestContext(c, "company_id")
+	if !ok {
+		return
+	}
+	grantID, err := strconv.ParseUint(c.Param("grant_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的授权ID"})
+		return
+	}
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	_ = c.ShouldBindJSON(&req)
+
+	grant, err := api.permissionManager.RevokeGrant(companyID, uint(grantID), userID, req.Reason, c)
+	if err != nil {
+		respondGrantError(c, err)
+		return
+	}
+
+	// 触发数据同步
+	go api.dataSyncService.SyncCompanyData(companyID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "授权已撤销",
+		"data":    grant,
+	})
+}
+
+// leaveCompany 用户离开企业，收回其授权和转授出去的授权
+func (api *CompanyAuthAPI) leaveCompany(c *gin.Context) {
+	companyID, userID, ok := grantRequestContext(c, "company_id")
+	if !ok {
+		return
+	}
+	memberID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	if err := api.permissionManager.UserLeftCompany(companyID, uint(memberID), userID, c); err != nil {
+		respondGrantError(c, err)
+		return
+	}
+
+	// 触发数据同步
+	go api.dataSyncService.SyncCompanyData(companyID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "已收回该用户的企业授权",
+	})
+}
+
+// requestAccess 申请企业访问权限
+func (api *CompanyAuthAPI) requestAccess(c *gin.Context) {
+	companyID, userID, ok := grantRequestContext(c, "company_id")
+	if !ok {
+		return
+	}
+	var req AccessRequestInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	request, err := api.permissionManager.RequestAccess(companyID, userID, req, c)
+	if err != nil {
+		respondGrantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "访问申请已提交",
+		"data":    request,
+	})
+}
+
+// listCompanyAccessRequests 企业收到的访问申请
+func (api *CompanyAuthAPI) listCompanyAccessRequests(c *gin.Context) {
+	companyID, userID, ok := grantRequestContext(c, "company_id")
+	if !ok {
+		return
+	}
+	if !api.permissionManager.CheckCompanyAccess(userID, companyID, "view_access_requests", c) {
+		return
+	}
+
+	requests, err := api.permissionManager.ListAccessRequests(companyID, 0, c.Query("status"))
+	if err != nil {
+		respondGrantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   requests,
+	})
+}
+
+// listMyAccessRequests 当前用户提交的访问申请
+func (api *CompanyAuthAPI) listMyAccessRequests(c *gin.Context) {
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户ID不存在"})
+		return
+	}
+
+	requests, err := api.permissionManager.ListAccessRequests(0, userIDInterface.(uint), c.Query("status"))
+	if err != nil {
+		respondGrantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   requests,
+	})
+}
+
+// approveAccessRequest 批准访问申请并创建授权
+func (api *CompanyAuthAPI) approveAccessRequest(c *gin.Context) {
+	api.decideAccessRequest(c, true)
+}
+
+// rejectAccessRequest 驳回访问申请
+func (api *CompanyAuthAPI) rejectAccessRequest(c *gin.Context) {
+	api.decideAccessRequest(c, false)
+}
+
+func (api *CompanyAuthAPI) decideAccessRequest(c *gin.Context, approve bool) {
+	requestID, userID, ok := grantRequestContext(c, "id")
+	if !ok {
+		return
+	}
+	var req AccessDecisionInput
+	_ = c.ShouldBindJSON(&req)
+
+	request, err := api.permissionManager.DecideAccessRequest(requestID, userID, approve, req, c)
+	if err != nil {
+		respondGrantError(c, err)
+		return
+	}
+	if approve {
+		go api.dataSyncService.SyncCompanyData(request.CompanyID)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   request,
+	})
+}
+
+// cancelAccessRequest 撤回自己的访问申请
+func (api *CompanyAuthAPI) cancelAccessRequest(c *gin.Context) {
+	requestID, userID, ok := grantRequestContext(c, "id")
+	if !ok {
+		return
+	}
+
+	request, err := api.permissionManager.CancelAccessRequest(requestID, userID, c)
+	if err != nil {
+		respondGrantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   request,
+	})
+}
+
+// startAccessReview 发起访问审查
+func (api *CompanyAuthAPI) startAccessReview(c *gin.Context) {
+	companyID, userID, ok := grantRequestContext(c, "company_id")
+	if !ok {
+		return
+	}
+
+	review, err := api.permissionManager.StartAccessReview(companyID, userID, c)
+	if err != nil {
+		respondGrantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "访问审查已发起",
+		"data":    review,
+	})
+}
+
+// listAccessReviews 企业的访问审查记录
+func (api *CompanyAuthAPI) listAccessReviews(c *gin.Context) {
+	companyID, userID, ok := grantRequestContext(c, "company_id")
+	if !ok {
+		return
+	}
+	if !api.permissionManager.CheckCompanyAccess(userID, companyID, "view_access_reviews", c) {
+		return
+	}
+
+	reviews, err := api.permissionManager.ListAccessReviews(companyID)
+	if err != nil {
+		respondGrantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   reviews,
+	})
+}
+
+// getAccessReview 访问审查详情
+func (api *CompanyAuthAPI) getAccessReview(c *gin.Context) {
+	reviewID, userID, ok := grantRequestContext(c, "id")
+	if !ok {
+		return
+	}
+	review, err := api.permissionManager.GetAccessReview(reviewID)
+	if err != nil {
+		respondGrantError(c, err)
+		return
+	}
+	if !api.permissionManager.CheckCompanyAccess(userID, review.CompanyID, "view_access_reviews", c) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   review,
+	})
+}
+
+// decideReviewItem 确认或撤销审查中的一条授权
+func (api *CompanyAuthAPI) decideReviewItem(c *gin.Context) {
+	reviewID, userID, ok := grantRequestContext(c, "id")
+	if !ok {
+		return
+	}
+	itemID, err := strconv.ParseUint(c.Param("item_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的审查项ID"})
+		return
+	}
+	var req struct {
+		Decision string `json:"decision" binding:"required,oneof=confirm revoke"`
+		Note     string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	review, err := api.permissionManager.DecideReviewItem(reviewID, uint(itemID), userID, req.Decision == "confirm", req.Note, c)
+	if err != nil {
+		respondGrantError(c, err)
+		return
+	}
+	if req.Decision == "revoke" {
+		go api.dataSyncService.SyncCompanyData(review.CompanyID)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   review,
+	})
+}
+
+func grantRequestContext(c *gin.Context, param string) (uint, uint, bool) {
+	id, err := strconv.ParseUint(c.Param(param), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+		return 0, 0, false
+	}
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户ID不存在"})
+		return 0, 0, false
+	}
+	return uint(id), userIDInterface.(uint), true
+}
+
+// respondGrantError 将授权流程错误映射为HTTP状态码
+func respondGrantError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrPermissionGrantNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrPermissionGrantForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, ErrPermissionGrantConflict):
+		status = http.StatusConflict
+	case errors.Is(err, ErrPermissionGrantInvalid):
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
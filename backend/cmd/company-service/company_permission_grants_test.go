@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func newTestGrantManager(t *testing.T) (*CompanyPermissionManager, *gorm.DB, *time.Time) {
+	t.Helper()
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&User{}); err != nil {
+		t.Fatal(err)
+	}
+	// 10创建企业，11为法定代表人，其余为普通用户
+	for _, id := range []uint{10, 11, 20, 21, 22, 23} {
+		if err := db.Create(&User{ID: id, Username: "user", Email: "user@example.com", Role: "user"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	createTestCompanies(t, db, testCompany())
+
+	manager := NewCompanyPermissionManager(db, nil)
+	manager.grantConfig = CompanyGrantConfig{
+		MaxDelegationDepth: 3,
+		RequestTTL:         14 * 24 * time.Hour,
+		ReviewInterval:     90 * 24 * time.Hour,
+		ReviewWindow:       14 * 24 * time.Hour,
+		RevokeUnreviewed:   true,
+	}
+	if err := manager.AutoMigrateGrants(); err != nil {
+		t.Fatal(err)
+	}
+	return manager, db, useTestClock(t)
+}
+
+func grantStatus(t *testing.T, db *gorm.DB, id uint) string {
+	t.Helper()
+	var grant CompanyUser
+	if err := db.First(&grant, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return grant.Status
+}
+
+func auditCount(db *gorm.DB, action string, result bool) int64 {
+	var n int64
+	db.Model(&CompanyPermissionAuditLog{}).Where("action = ? AND permission_result = ?", action, result).Count(&n)
+	return n
+}
+
+func TestGrantDelegationChain(t *testing.T) {
+	manager, db, now := newTestGrantManager(t)
+	expires := now.Add(30 * 24 * time.Hour)
+
+	first, err := manager.GrantAccess(1, 10, GrantInput{UserID: 20, Role: "authorized_user",
+		Permissions: []string{"read", "write"}, ExpiresAt: &expires, Delegable: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.GrantAccess(1, 10, GrantInput{UserID: 20, Role: "authorized_user"}, nil); !errors.Is(err, ErrPermissionGrantConflict) {
+		t.Fatalf("duplicate grant err = %v", err)
+	}
+
+	// 转授权默认与上级同时到期
+	second, err := manager.GrantAccess(1, 20, GrantInput{UserID: 21, Role: "authorized_user", Permissions: []string{"read"}, Delegable: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.DelegationDepth != 2 || second.ParentID == nil || *second.ParentID != first.ID || !second.ExpiresAt.Equal(expires) {
+		t.Fatalf("second = %+v", second)
+	}
+
+	for name, tc := range map[string]struct {
+		actor uint
+		in    GrantInput
+		want  error
+	}{
+		"exceeds permissions": {20, GrantInput{UserID: 23, Role: "authorized_user", Permissions: []string{"manage_users"}}, ErrPermissionGrantForbidden},
+		"outlives parent":     {20, GrantInput{UserID: 23, Role: "authorized_user", ExpiresAt: timePtr(expires.Add(time.Hour))}, ErrPermissionGrantInvalid},
+		"admin role":          {20, GrantInput{UserID: 23, Role: string(RoleAdmin)}, ErrPermissionGrantForbidden},
+		"delegable at limit":  {21, GrantInput{UserID: 22, Role: "authorized_user", Delegable: true}, ErrPermissionGrantInvalid},
+		"no grant":            {23, GrantInput{UserID: 22, Role: "authorized_user"}, ErrPermissionGrantForbidden},
+	} {
+		if _, err := manager.GrantAccess(1, tc.actor, tc.in, nil); !errors.Is(err, tc.want) {
+			t.Errorf("%s: err = %v, want %v", name, err, tc.want)
+		}
+	}
+
+	third, err := manager.GrantAccess(1, 21, GrantInput{UserID: 22, Role: "authorized_user", Permissions: []string{"read"}}, nil)
+	if err != nil || third.DelegationDepth != 3 {
+		t.Fatalf("third = %+v, err = %v", third, err)
+	}
+	if _, err := manager.GrantAccess(1, 22, GrantInput{UserID: 23, Role: "authorized_user"}, nil); !errors.Is(err, ErrPermissionGrantForbidden) {
+		t.Fatalf("non-delegable grant err = %v", err)
+	}
+
+	// 下游不能撤销上游；上游撤销时级联撤销全部下游
+	if _, err := manager.RevokeGrant(1, first.ID, 22, "", nil); !errors.Is(err, ErrPermissionGrantForbidden) {
+		t.Fatalf("revoke upstream err = %v", err)
+	}
+	if _, err := manager.RevokeGrant(1, second.ID, 20, "岗位调整", nil); err != nil {
+		t.Fatal(err)
+	}
+	if grantStatus(t, db, first.ID) != CompanyUserActive || grantStatus(t, db, second.ID) != CompanyUserRevoked ||
+		grantStatus(t, db, third.ID) != CompanyUserRevoked {
+		t.Fatal("revocation did not cascade")
+	}
+
+	if n := auditCount(db, "grant_access", true); n != 1 {
+		t.Errorf("grant_access = %d", n)
+	}
+	if n := auditCount(db, "delegate_access", true); n != 2 {
+		t.Errorf("delegate_access = %d", n)
+	}
+	if n := auditCount(db, "revoke_access", true); n != 2 {
+		t.Errorf("revoke_access = %d", n)
+	}
+	if n := auditCount(db, "grant_access", false) + auditCount(db, "revoke_access", false); n != 5 {
+		t.Errorf("denied attempts logged = %d", n)
+	}
+}
+
+func TestAccessRequestApproval(t *testing.T) {
+	manager, db, now := newTestGrantManager(t)
+
+	request, err := manager.RequestAccess(1, 23, AccessRequestInput{Role: "authorized_user", Permissions: []string{"read"}, Reason: "负责招聘"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.ApproverID != 11 || request.Status != AccessRequestPending {
+		t.Fatalf("request = %+v", request)
+	}
+	if _, err := manager.RequestAccess(1, 23, AccessRequestInput{Role: "authorized_user", Reason: "再次申请"}, nil); !errors.Is(err, ErrPermissionGrantConflict) {
+		t.Fatalf("duplicate request err = %v", err)
+	}
+	if _, err := manager.DecideAccessRequest(request.ID, 20, true, AccessDecisionInput{}, nil); !errors.Is(err, ErrPermissionGrantForbidden) {
+		t.Fatalf("approve by outsider err = %v", err)
+	}
+
+	expires := now.Add(7 * 24 * time.Hour)
+	approved, err := manager.DecideAccessRequest(request.ID, 11, true, AccessDecisionInput{ExpiresAt: &expires, Note: "试用一周"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approved.Status != AccessRequestApproved || approved.GrantID == nil || *approved.DecidedBy != 11 {
+		t.Fatalf("approved = %+v", approved)
+	}
+	var grant CompanyUser
+	db.First(&grant, *approved.GrantID)
+	if grant.UserID != 23 || grant.GrantedBy != 11 || !grant.ExpiresAt.Equal(expires) || grant.GetPermissions()[0] != "read" {
+		t.Fatalf("grant = %+v", grant)
+	}
+	if _, err := manager.DecideAccessRequest(request.ID, 11, false, AccessDecisionInput{}, nil); !errors.Is(err, ErrPermissionGrantConflict) {
+		t.Fatalf("decide twice err = %v", err)
+	}
+	if _, err := manager.RequestAccess(1, 23, AccessRequestInput{Role: "authorized_user", Reason: "已有权限"}, nil); !errors.Is(err, ErrPermissionGrantConflict) {
+		t.Fatalf("request with access err = %v", err)
+	}
+
+	rejected, _ := manager.RequestAccess(1, 22, AccessRequestInput{Role: "authorized_user", Reason: "查看数据"}, nil)
+	if rejected, err = manager.DecideAccessRequest(rejected.ID, 10, false, AccessDecisionInput{Note: "不需要"}, nil); err != nil || rejected.Status != AccessRequestRejected {
+		t.Fatalf("rejected = %+v, err = %v", rejected, err)
+	}
+	cancelled, _ := manager.RequestAccess(1, 21, AccessRequestInput{Role: "authorized_user", Reason: "查看数据"}, nil)
+	if _, err := manager.CancelAccessRequest(cancelled.ID, 22, nil); !errors.Is(err, ErrPermissionGrantForbidden) {
+		t.Fatalf("cancel by other err = %v", err)
+	}
+	if cancelled, err = manager.CancelAccessRequest(cancelled.ID, 21, nil); err != nil || cancelled.Status != AccessRequestCancelled {
+		t.Fatalf("cancelled = %+v, err = %v", cancelled, err)
+	}
+
+	for _, action := range []string{"request_access", "approve_access_request", "grant_access", "reject_access_request", "cancel_access_request"} {
+		if auditCount(db, action, true) == 0 {
+			t.Errorf("%s not audited", action)
+		}
+	}
+}
+
+func TestGrantExpiryReviewsAndLeaving(t *testing.T) {
+	manager, db, now := newTestGrantManager(t)
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+
+	shortTerm := now.Add(time.Hour)
+	temp, _ := manager.GrantAccess(1, 10, GrantInput{UserID: 20, Role: "authorized_user", ExpiresAt: &shortTerm, Delegable: true}, nil)
+	delegated, _ := manager.GrantAccess(1, 20, GrantInput{UserID: 21, Role: "authorized_user"}, nil)
+	staff, _ := manager.GrantAccess(1, 10, GrantInput{UserID: 22, Role: "authorized_user"}, nil)
+	leaver, _ := manager.GrantAccess(1, 11, GrantInput{UserID: 23, Role: "authorized_user", Delegable: true}, nil)
+
+	// 到期后即使定期任务还没运行也不再生效
+	*now = now.Add(2 * time.Hour)
+	if manager.CheckCompanyAccess(20, 1, "read", c) {
+		t.Fatal("expired grant still grants access")
+	}
+	result, err := manager.SweepGrants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Expired != 1 || grantStatus(t, db, temp.ID) != CompanyUserExpired || grantStatus(t, db, delegated.ID) != CompanyUserRevoked {
+		t.Fatalf("result = %+v", result)
+	}
+	if !manager.CheckCompanyAccess(22, 1, "read", c) {
+		t.Fatal("active grant lost access")
+	}
+
+	// 离开企业时收回授权及其转授出去的授权
+	leaverDelegate, err := manager.GrantAccess(1, 23, GrantInput{UserID: 21, Role: "authorized_user"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.UserLeftCompany(1, 23, 22, nil); !errors.Is(err, ErrPermissionGrantForbidden) {
+		t.Fatalf("leave by other member err = %v", err)
+	}
+	if err := manager.UserLeftCompany(1, 11, 10, nil); !errors.Is(err, ErrPermissionGrantInvalid) {
+		t.Fatalf("legal representative leave err = %v", err)
+	}
+
+	// 超过审查周期后定期任务发起审查，离开企业的用户的审查项自动结束
+	*now = now.Add(91 * 24 * time.Hour)
+	result, err = manager.SweepGrants()
+	if err != nil || result.ReviewsStarted != 1 {
+		t.Fatalf("result = %+v, err = %v", result, err)
+	}
+	reviews, _ := manager.ListAccessReviews(1)
+	review, _ := manager.GetAccessReview(reviews[0].ID)
+	if review.ReviewerID != 11 || review.StartedBy != 0 || len(review.Items) != 3 {
+		t.Fatalf("review = %+v", review)
+	}
+	if err := manager.UserLeftCompany(1, 23, 23, nil); err != nil {
+		t.Fatal(err)
+	}
+	if grantStatus(t, db, leaver.ID) != CompanyUserLeft || grantStatus(t, db, leaverDelegate.ID) != CompanyUserRevoked {
+		t.Fatal("leaving did not revoke delegated grants")
+	}
+	var staffItem uint
+	for _, item := range review.Items {
+		if item.GrantID == staff.ID {
+			staffItem = item.ID
+		}
+	}
+	if _, err := manager.DecideReviewItem(review.ID, staffItem, 22, true, "", nil); !errors.Is(err, ErrPermissionGrantForbidden) {
+		t.Fatalf("review by member err = %v", err)
+	}
+	review, err = manager.DecideReviewItem(review.ID, staffItem, 11, true, "仍在职", nil)
+	if err != nil || review.Status != AccessReviewCompleted {
+		t.Fatalf("review = %+v, err = %v", review, err)
+	}
+
+	// 下一轮审查到期未确认，授权被撤销
+	*now = now.Add(91 * 24 * time.Hour)
+	if result, err = manager.SweepGrants(); err != nil || result.ReviewsStarted != 1 {
+		t.Fatalf("result = %+v, err = %v", result, err)
+	}
+	*now = now.Add(15 * 24 * time.Hour)
+	if result, err = manager.SweepGrants(); err != nil || result.ReviewsLapsed != 1 {
+		t.Fatalf("result = %+v, err = %v", result, err)
+	}
+	if grantStatus(t, db, staff.ID) != CompanyUserRevoked {
+		t.Fatal("unreviewed grant not revoked")
+	}
+
+	pending, _ := manager.RequestAccess(1, 20, AccessRequestInput{Role: "authorized_user", Reason: "重新申请"}, nil)
+	*now = now.Add(15 * 24 * time.Hour)
+	if result, err = manager.SweepGrants(); err != nil || result.RequestsExpired != 1 {
+		t.Fatalf("result = %+v, err = %v", result, err)
+	}
+	if expired, _ := manager.GetAccessRequest(pending.ID); expired.Status != AccessRequestExpired {
+		t.Fatalf("request = %+v", expired)
+	}
+
+	for _, action := range []string{"expire_access", "leave_company", "start_access_review", "confirm_access", "complete_access_review",
+		"lapse_access_review", "expire_access_request"} {
+		if auditCount(db, action, true) == 0 {
+			t.Errorf("%s not audited", action)
+		}
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
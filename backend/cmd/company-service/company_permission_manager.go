@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,7 +11,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
+	"github.com/xiajason/zervi-basic/basic/backend/pkg/rbac"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // CompanyPermissionManager 企业权限管理器
@@ -18,6 +21,8 @@ type CompanyPermissionManager struct {
 	mysqlDB     *gorm.DB
 	redisClient *redis.Client
 	cacheTTL    time.Duration
+	rbacManager *rbac.Manager
+	grantConfig CompanyGrantConfig
 }
 
 // NewCompanyPermissionManager 创建企业权限管理器
@@ -26,6 +31,36 @@ func NewCompanyPermissionManager(mysqlDB *gorm.DB, redisClient *redis.Client) *C
 		mysqlDB:     mysqlDB,
 		redisClient: redisClient,
 		cacheTTL:    time.Hour, // 缓存1小时
+		grantConfig: DefaultCompanyGrantConfig(),
+	}
+}
+
+// SetRBACManager 设置RBAC管理器，企业角色变更同步到对应企业域
+func (cpm *CompanyPermissionManager) SetRBACManager(manager *rbac.Manager) {
+	cpm.rbacManager = manager
+}
+
+// syncCompanyRole 将用户在企业内的角色同步到RBAC企业域（role为空表示移除）
+func (cpm *CompanyPermissionManager) syncCompanyRole(companyID uint, userID uint, role CompanyRole) {
+	if cpm.rbacManager == nil {
+		return
+	}
+
+	domain := rbac.CompanyDomain(companyID)
+	subject := fmt.Sprintf("%d", userID)
+	for _, existing := range cpm.rbacManager.GetRolesForUserInDomain(subject, domain) {
+		if existing == string(role) {
+			continue
+		}
+		if err := cpm.rbacManager.RemoveRoleForUserInDomain(subject, existing, domain); err != nil {
+			log.Printf("移除RBAC企业角色失败: %v", err)
+		}
+	}
+	if role == "" {
+		return
+	}
+	if err := cpm.rbacManager.AddRoleForUserInDomain(subject, string(role), domain); err != nil {
+		log.Printf("同步RBAC企业角色失败: %v", err)
 	}
 }
 
@@ -82,10 +117,10 @@ func (cpm *CompanyPermissionManager) CheckCompanyAccess(userID uint, companyID u
 		return true
 	}
 
-	// 6. 检查企业用户关联权限
+	// 6. 检查企业用户关联权限（已到期但尚未被定期任务收回的授权不再生效）
 	var companyUser CompanyUser
-	if err := cpm.mysqlDB.Where("company_id = ? AND user_id = ? AND status = ?",
-		companyID, userID, "active").First(&companyUser).Error; err == nil {
+	if err := cpm.activeGrants(cpm.mysqlDB).Where("company_id = ? AND user_id = ?",
+		companyID, userID).First(&companyUser).Error; err == nil {
 		if cpm.redisClient != nil {
 			cpm.redisClient.Set(context.Background(), cacheKey, "true", cpm.cacheTTL)
 		}
@@ -184,7 +219,7 @@ func (cpm *CompanyPermissionManager) GetUserCompanyPermissions(userID uint) ([]C
 
 	// 5. 获取用户作为授权用户的企业
 	var companyUsers []CompanyUser
-	if err := cpm.mysqlDB.Preload("Company").Where("user_id = ? AND status = ?", userID, "active").Find(&companyUsers).Error; err != nil {
+	if err := cpm.activeGrants(cpm.mysqlDB).Preload("Company").Where("user_id = ?", userID).Find(&companyUsers).Error; err != nil {
 		return nil, err
 	}
 
@@ -202,68 +237,76 @@ func (cpm *CompanyPermissionManager) GetUserCompanyPermissions(userID uint) ([]C
 	return permissions, nil
 }
 
-// AddAuthorizedUser 添加授权用户
+// AddAuthorizedUser 以系统身份添加长期有效的授权用户，用户操作请使用GrantAccess
 func (cpm *CompanyPermissionManager) AddAuthorizedUser(companyID uint, userID uint, role CompanyRole, permissions []string) error {
-	// 检查企业是否存在
-	var company EnhancedCompany
-	if err := cpm.mysqlDB.First(&company, companyID).Error; err != nil {
-		return fmt.Errorf("企业不存在: %v", err)
-	}
-
-	// 检查用户是否存在
-	var user User
-	if err := cpm.mysqlDB.First(&user, userID).Error; err != nil {
-		return fmt.Errorf("用户不存在: %v", err)
-	}
-
-	// 创建企业用户关联
-	companyUser := CompanyUser{
-		CompanyID: companyID,
-		UserID:    userID,
-		Role:      string(role),
-		Status:    "active",
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	}
-	companyUser.SetPermissions(permissions)
-
-	if err := cpm.mysqlDB.Create(&companyUser).Error; err != nil {
-		return fmt.Errorf("添加授权用户失败: %v", err)
-	}
-
-	// 清除相关缓存
-	cpm.clearCompanyPermissionCache(companyID)
-
-	return nil
+	_, err := cpm.GrantAccess(companyID, 0, GrantInput{UserID: userID, Role: string(role), Permissions: permissions}, nil)
+	return err
 }
 
-// RemoveAuthorizedUser 移除授权用户
-func (cpm *CompanyPermissionManager) RemoveAuthorizedUser(companyID uint, userID uint) error {
-	// 删除企业用户关联
-	if err := cpm.mysqlDB.Where("company_id = ? AND user_id = ?", companyID, userID).Delete(&CompanyUser{}).Error; err != nil {
-		return fmt.Errorf("移除授权用户失败: %v", err)
+// RemoveAuthorizedUser 撤销用户在企业的有效授权，其转授出去的授权一并撤销
+func (cpm *CompanyPermissionManager) RemoveAuthorizedUser(companyID uint, userID uint, actorID uint, c *gin.Context) error {
+	var grant CompanyUser
+	if err := cpm.activeGrants(cpm.mysqlDB).Where("company_id = ? AND user_id = ?", companyID, userID).First(&grant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: 用户没有该企业的有效授权", ErrPermissionGrantNotFound)
+		}
+		return err
 	}
-
-	// 清除相关缓存
-	cpm.clearCompanyPermissionCache(companyID)
-
-	return nil
+	_, err := cpm.RevokeGrant(companyID, grant.ID, actorID, "移除授权用户", c)
+	return err
 }
 
-// UpdateUserRole 更新用户角色
-func (cpm *CompanyPermissionManager) UpdateUserRole(companyID uint, userID uint, role CompanyRole, permissions []string) error {
-	var companyUser CompanyUser
-	if err := cpm.mysqlDB.Where("company_id = ? AND user_id = ?", companyID, userID).First(&companyUser).Error; err != nil {
-		return fmt.Errorf("企业用户关联不存在: %v", err)
-	}
-
-	companyUser.Role = string(role)
-	companyUser.SetPermissions(permissions)
-	companyUser.UpdatedAt = time.Now()
+// UpdateUserRole 更新用户角色，转授权的权限不能超出上级授权
+func (cpm *CompanyPermissionManager) UpdateUserRole(companyID uint, userID uint, role CompanyRole, permissions []string, actorID uint, c *gin.Context) error {
+	err := cpm.mysqlDB.Transaction(func(tx *gorm.DB) error {
+		auth, err := cpm.authority(tx, companyID, actorID)
+		if err != nil {
+			return err
+		}
+		var companyUser CompanyUser
+		if err := cpm.activeGrants(tx).Where("company_id = ? AND user_id = ?", companyID, userID).First(&companyUser).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: 企业用户关联不存在", ErrPermissionGrantNotFound)
+			}
+			return err
+		}
+		allowed, err := cpm.canManage(tx, auth, &companyUser)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return fmt.Errorf("%w: 只能修改自己授出的授权", ErrPermissionGrantForbidden)
+		}
+		if companyUser.ParentID != nil {
+			var parent CompanyUser
+			if err := tx.First(&parent, *companyUser.ParentID).Error; err != nil {
+				return err
+			}
+			if !coversPermissions(parent.GetPermissions(), permissions) {
+				return fmt.Errorf("%w: 权限超出了上级授权", ErrPermissionGrantForbidden)
+			}
+		}
 
-	if err := cpm.mysqlDB.Save(&companyUser).Error; err != nil {
-		return fmt.Errorf("更新用户角色失败: %v", err)
+		before := map[string]interface{}{"role": companyUser.Role, "permissions": companyUser.GetPermissions()}
+		companyUser.Role = string(role)
+		companyUser.Permissions = ""
+		companyUser.SetPermissions(permissions)
+		companyUser.UpdatedAt = timeNow()
+		if err := tx.Omit(clause.Associations).Save(&companyUser).Error; err != nil {
+			return fmt.Errorf("更新用户角色失败: %v", err)
+		}
+		return cpm.recordGrantAudit(tx, companyID, actorID, "update_access", "company_user", companyUser.ID, map[string]interface{}{
+			"target_user_id": userID,
+			"before":         before,
+			"role":           companyUser.Role,
+			"permissions":    permissions,
+		}, c)
+	})
+	if err != nil {
+		cpm.auditDenied(companyID, actorID, "update_access", err, c)
+		return err
 	}
+	cpm.syncCompanyRole(companyID, userID, role)
 
 	// 清除相关缓存
 	cpm.clearCompanyPermissionCache(companyID)
@@ -272,7 +315,7 @@ func (cpm *CompanyPermissionManager) UpdateUserRole(companyID uint, userID uint,
 }
 
 // SetLegalRepresentative 设置法定代表人
-func (cpm *CompanyPermissionManager) SetLegalRepresentative(companyID uint, userID uint) error {
+func (cpm *CompanyPermissionManager) SetLegalRepresentative(companyID uint, userID uint, actorID uint, c *gin.Context) error {
 	// 检查企业是否存在
 	var company EnhancedCompany
 	if err := cpm.mysqlDB.First(&company, companyID).Error; err != nil {
@@ -286,6 +329,7 @@ func (cpm *CompanyPermissionManager) SetLegalRepresentative(companyID uint, user
 	}
 
 	// 更新企业法定代表人
+	previous := company.LegalRepUserID
 	company.LegalRepUserID = userID
 	company.UpdatedAt = time.Now()
 
@@ -295,7 +339,7 @@ func (cpm *CompanyPermissionManager) SetLegalRepresentative(companyID uint, user
 
 	// 确保用户在企业用户关联表中
 	var companyUser CompanyUser
-	if err := cpm.mysqlDB.Where("company_id = ? AND user_id = ?", companyID, userID).First(&companyUser).Error; err != nil {
+	if err := cpm.activeGrants(cpm.mysqlDB).Where("company_id = ? AND user_id = ?", companyID, userID).First(&companyUser).Error; err != nil {
 		// 如果不存在，创建关联
 		companyUser = CompanyUser{
 			CompanyID: companyID,
@@ -311,15 +355,21 @@ func (cpm *CompanyPermissionManager) SetLegalRepresentative(companyID uint, user
 			return fmt.Errorf("创建企业用户关联失败: %v", err)
 		}
 	} else {
-		// 如果存在，更新角色
+		// 如果存在，更新角色，法定代表人的授权长期有效
 		companyUser.Role = string(RoleLegalRepresentative)
 		companyUser.SetPermissions([]string{"read", "write", "manage_users"})
+		companyUser.ExpiresAt = nil
 		companyUser.UpdatedAt = time.Now()
 
 		if err := cpm.mysqlDB.Save(&companyUser).Error; err != nil {
 			return fmt.Errorf("更新企业用户关联失败: %v", err)
 		}
 	}
+	cpm.syncCompanyRole(companyID, userID, RoleLegalRepresentative)
+	if err := cpm.recordGrantAudit(cpm.mysqlDB, companyID, actorID, "set_legal_representative", "company_user", companyUser.ID,
+		map[string]interface{}{"target_user_id": userID, "previous_user_id": previous}, c); err != nil {
+		log.Printf("记录授权审计日志失败: %v", err)
+	}
 
 	// 清除相关缓存
 	cpm.clearCompanyPermissionCache(companyID)
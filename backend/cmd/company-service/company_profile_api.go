@@ -1,8 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -11,7 +18,8 @@ import (
 
 // CompanyProfileAPI 企业画像API处理器
 type CompanyProfileAPI struct {
-	core *jobfirst.Core
+	core              *jobfirst.Core
+	permissionManager *CompanyPermissionManager
 }
 
 // CompanyProfileSummary 企业画像摘要
@@ -37,6 +45,12 @@ func NewCompanyProfileAPI(core *jobfirst.Core) *CompanyProfileAPI {
 	}
 }
 
+// SetPermissionManager 设置企业权限管理器，导入导出按企业权限控制可访问的分区；
+// 未设置时只允许管理员和企业创建者导入导出
+func (api *CompanyProfileAPI) SetPermissionManager(manager *CompanyPermissionManager) {
+	api.permissionManager = manager
+}
+
 // SetupCompanyProfileRoutes 设置企业画像相关路由
 func (api *CompanyProfileAPI) SetupCompanyProfileRoutes(r *gin.Engine) {
 	// 需要认证的企业画像API
@@ -68,6 +82,9 @@ func (api *CompanyProfileAPI) SetupCompanyProfileRoutes(r *gin.Engine) {
 		// 批量导入企业画像数据
 		profile.POST("/import", api.importCompanyProfile)
 
+		// 下载空白导入模板
+		profile.GET("/import/template", api.getCompanyProfileImportTemplate)
+
 		// 导出企业画像数据
 		profile.GET("/export/:company_id", api.exportCompanyProfile)
 	}
@@ -160,59 +177,7 @@ func (api *CompanyProfileAPI) getCompanyProfile(c *gin.Context) {
 		return
 	}
 
-	db := api.core.GetDB()
-	profileData := &CompanyProfileData{}
-
-	// 查询基本信息
-	var basicInfo CompanyProfileBasicInfo
-	if err := db.Where("company_id = ?", companyID).First(&basicInfo).Error; err == nil {
-		profileData.BasicInfo = &basicInfo
-	}
-
-	// 查询资质许可信息
-	var qualifications []QualificationLicense
-	db.Where("company_id = ?", companyID).Find(&qualifications)
-	profileData.Qualifications = qualifications
-
-	// 查询人员竞争力信息
-	var personnel PersonnelCompetitiveness
-	if err := db.Where("company_id = ?", companyID).First(&personnel).Error; err == nil {
-		profileData.Personnel = &personnel
-	}
-
-	// 查询公积金信息
-	var providentFund ProvidentFund
-	if err := db.Where("company_id = ?", companyID).First(&providentFund).Error; err == nil {
-		profileData.ProvidentFund = &providentFund
-	}
-
-	// 查询资助补贴信息
-	var subsidies []SubsidyInfo
-	db.Where("company_id = ?", companyID).Find(&subsidies)
-	profileData.Subsidies = subsidies
-
-	// 查询企业关系信息
-	var relationships []CompanyRelationship
-	db.Where("company_id = ?", companyID).Find(&relationships)
-	profileData.Relationships = relationships
-
-	// 查询科创评分信息
-	var techInnovation TechInnovationScore
-	if err := db.Where("company_id = ?", companyID).First(&techInnovation).Error; err == nil {
-		profileData.TechInnovation = &techInnovation
-	}
-
-	// 查询财务信息
-	var financialInfo CompanyProfileFinancialInfo
-	if err := db.Where("company_id = ?", companyID).First(&financialInfo).Error; err == nil {
-		profileData.FinancialInfo = &financialInfo
-	}
-
-	// 查询风险信息
-	var riskInfo CompanyProfileRiskInfo
-	if err := db.Where("company_id = ?", companyID).First(&riskInfo).Error; err == nil {
-		profileData.RiskInfo = &riskInfo
-	}
+	profileData := LoadCompanyProfile(api.core.GetDB(), uint(companyID))
 
 	c.JSON(http.StatusOK, gin.H{
 		"status": "success",
@@ -476,7 +441,11 @@ func (api *CompanyProfileAPI) createOrUpdateRisk(c *gin.Context) {
 	})
 }
 
-// importCompanyProfile 批量导入企业画像数据
+// maxProfileImportSize 导入文件大小上限
+const maxProfileImportSize = 10 << 20
+
+// importCompanyProfile 导入企业画像数据。支持上传JSON/XLSX文件（file字段）或直接提交JSON，
+// 参数: company_id, format（默认按文件扩展名）, mode（all_or_nothing/partial）, dry_run
 func (api *CompanyProfileAPI) importCompanyProfile(c *gin.Context) {
 	// 获取用户信息
 	userIDInterface, exists := c.Get("user_id")
@@ -486,65 +455,120 @@ func (api *CompanyProfileAPI) importCompanyProfile(c *gin.Context) {
 	}
 	userID := userIDInterface.(uint)
 
-	var profileData CompanyProfileData
-	if err := c.ShouldBindJSON(&profileData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	format := c.Query("format")
+	if format == "" {
+		format = c.PostForm("format")
+	}
+	var data []byte
+	if file, err := c.FormFile("file"); err == nil {
+		if file.Size > maxProfileImportSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "导入文件不能超过10MB"})
+			return
+		}
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(file.Filename)), ".")
+		}
+		src, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "读取导入文件失败"})
+			return
+		}
+		defer src.Close()
+		data, err = io.ReadAll(src)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "读取导入文件失败"})
+			return
+		}
+	} else {
+		data, err = io.ReadAll(io.LimitReader(c.Request.Body, maxProfileImportSize+1))
+		if err != nil || len(data) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请上传导入文件或提交JSON数据"})
+			return
+		}
+		if len(data) > maxProfileImportSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "导入数据不能超过10MB"})
+			return
+		}
+		if format == "" {
+			format = ProfileFormatJSON
+		}
+	}
+	if format != ProfileFormatJSON && format != ProfileFormatXLSX {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "仅支持json和xlsx格式"})
 		return
 	}
 
-	// 检查权限
-	if profileData.BasicInfo != nil && !api.checkCompanyAccess(userID, profileData.BasicInfo.CompanyID, c) {
+	mode := c.DefaultQuery("mode", c.DefaultPostForm("mode", ProfileImportAllOrNothing))
+	if mode != ProfileImportAllOrNothing && mode != ProfileImportPartial {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode仅支持all_or_nothing和partial"})
 		return
 	}
+	dryRun := c.DefaultQuery("dry_run", c.PostForm("dry_run")) == "true"
 
-	db := api.core.GetDB()
-
-	// 开始事务
-	tx := db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	// 导入基本信息
-	if profileData.BasicInfo != nil {
-		profileData.BasicInfo.CreatedAt = time.Now()
-		profileData.BasicInfo.UpdatedAt = time.Now()
-		if err := tx.Create(profileData.BasicInfo).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "导入基本信息失败"})
-			return
+	// 目标企业，兼容旧版在basic_info中给出company_id的JSON
+	companyIDParam := c.Query("company_id")
+	if companyIDParam == "" {
+		companyIDParam = c.PostForm("company_id")
+	}
+	companyID, err := strconv.ParseUint(companyIDParam, 10, 64)
+	if err != nil && format == ProfileFormatJSON {
+		var legacy CompanyProfileData
+		if json.Unmarshal(data, &legacy) == nil && legacy.BasicInfo != nil {
+			companyID, err = uint64(legacy.BasicInfo.CompanyID), nil
 		}
 	}
+	if err != nil || companyID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "企业ID格式错误"})
+		return
+	}
 
-	// 导入资质许可信息
-	for _, qualification := range profileData.Qualifications {
-		qualification.CreatedAt = time.Now()
-		qualification.UpdatedAt = time.Now()
-		if err := tx.Create(&qualification).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "导入资质许可信息失败"})
+	// 检查权限
+	allowed, ok := api.profileSectionAccess(userID, uint(companyID), "profile_import", c)
+	if !ok {
+		return
+	}
+
+	report, err := ImportCompanyProfile(api.core.GetDB(), data, ProfileImportOptions{
+		CompanyID: uint(companyID),
+		Format:    format,
+		Mode:      mode,
+		DryRun:    dryRun,
+		Allowed:   allowed,
+	})
+	if err != nil {
+		if errors.Is(err, ErrProfileImportFormat) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导入企业画像数据失败"})
+		return
 	}
 
-	// 导入其他信息...
-	// (类似的处理逻辑)
-
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "导入企业画像数据失败"})
+	if report.HasErrors() && mode == ProfileImportAllOrNothing && !dryRun {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "error",
+			"error":  "导入数据校验失败，未写入任何数据",
+			"data":   report,
+		})
 		return
 	}
 
+	message := "企业画像数据导入成功"
+	switch {
+	case dryRun:
+		message = "企业画像数据导入预览"
+	case report.HasErrors():
+		message = "企业画像数据部分导入成功"
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
-		"message": "企业画像数据导入成功",
+		"message": message,
+		"data":    report,
 	})
 }
 
-// exportCompanyProfile 导出企业画像数据
+// exportCompanyProfile 导出企业画像数据，format为json（默认）或xlsx，
+// 用户无权访问的分区不导出，并在X-Profile-Omitted-Sections响应头中列出
 func (api *CompanyProfileAPI) exportCompanyProfile(c *gin.Context) {
 	// 获取用户信息
 	userIDInterface, exists := c.Get("user_id")
@@ -561,18 +585,108 @@ func (api *CompanyProfileAPI) exportCompanyProfile(c *gin.Context) {
 		return
 	}
 
+	format := c.DefaultQuery("format", ProfileFormatJSON)
+	if format != ProfileFormatJSON && format != ProfileFormatXLSX {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "仅支持json和xlsx格式"})
+		return
+	}
+
 	// 检查权限
-	if !api.checkCompanyAccess(userID, uint(companyID), c) {
+	allowed, ok := api.profileSectionAccess(userID, uint(companyID), "profile_export", c)
+	if !ok {
 		return
 	}
 
 	// 获取完整企业画像数据
-	// (使用getCompanyProfile的逻辑)
+	profileData := LoadCompanyProfile(api.core.GetDB(), uint(companyID))
+	omitted, err := FilterProfileSections(profileData, allowed)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导出企业画像数据失败"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"status":  "success",
-		"message": "企业画像数据导出成功",
-	})
+	filename := fmt.Sprintf("company_profile_%d_%s.%s", companyID, time.Now().Format("20060102"), format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("X-Profile-Omitted-Sections", strings.Join(omitted, ","))
+
+	if format == ProfileFormatJSON {
+		c.IndentedJSON(http.StatusOK, profileData)
+		return
+	}
+	var buf bytes.Buffer
+	if err := WriteCompanyProfileXLSX(&buf, profileData, allowed); err != nil {
+		c.Header("Content-Disposition", "")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导出企业画像数据失败"})
+		return
+	}
+	c.Data(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", buf.Bytes())
+}
+
+// getCompanyProfileImportTemplate 下载空白导入模板，format为xlsx（默认）或json
+func (api *CompanyProfileAPI) getCompanyProfileImportTemplate(c *gin.Context) {
+	switch c.DefaultQuery("format", ProfileFormatXLSX) {
+	case ProfileFormatXLSX:
+		var buf bytes.Buffer
+		if err := WriteCompanyProfileXLSX(&buf, nil, nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成导入模板失败"})
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="company_profile_template.xlsx"`)
+		c.Data(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", buf.Bytes())
+	case ProfileFormatJSON:
+		c.Header("Content-Disposition", `attachment; filename="company_profile_template.json"`)
+		c.IndentedJSON(http.StatusOK, CompanyProfileJSONTemplate())
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "仅支持json和xlsx格式"})
+	}
+}
+
+// profileSectionAccess 用户可访问的画像分区。系统管理员、企业创建者和法定代表人可访问全部分区；
+// 授权用户可访问基础分区，人员、财务和风险分区须拥有对应的企业权限，导入还需要write权限。
+// 无权访问时写入错误响应并返回false
+func (api *CompanyProfileAPI) profileSectionAccess(userID, companyID uint, action string, c *gin.Context) (map[string]bool, bool) {
+	role := c.GetString("role")
+	if role == "admin" || role == "super_admin" {
+		return nil, true
+	}
+	if api.permissionManager == nil {
+		return nil, api.checkCompanyAccess(userID, companyID, c)
+	}
+	if !api.permissionManager.CheckCompanyAccess(userID, companyID, action, c) {
+		return nil, false
+	}
+
+	permissions, err := api.permissionManager.GetUserCompanyPermissions(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取企业权限失败"})
+		return nil, false
+	}
+	granted := map[string]bool{ProfilePermissionRead: true}
+	for _, permission := range permissions {
+		if permission.CompanyID != companyID {
+			continue
+		}
+		switch permission.EffectivePermissionLevel {
+		case PermissionSystemAdmin, PermissionCompanyOwner, PermissionLegalRepresentative:
+			return nil, true
+		}
+		for _, p := range permission.Permissions {
+			if p == "*" {
+				return nil, true
+			}
+			granted[p] = true
+		}
+	}
+	if action == "profile_import" && !granted[ProfilePermissionWrite] {
+		c.JSON(http.StatusForbidden, gin.H{"error": "权限不足，导入企业画像需要写权限"})
+		return nil, false
+	}
+
+	allowed := make(map[string]bool)
+	for _, section := range profileSections {
+		allowed[section.Key] = granted[section.Permission]
+	}
+	return allowed, true
 }
 
 // checkCompanyAccess 检查企业访问权限
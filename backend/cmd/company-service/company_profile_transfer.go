@@ -0,0 +1,959 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+// 企业画像导入导出格式
+const (
+	ProfileFormatJSON = "json"
+	ProfileFormatXLSX = "xlsx"
+)
+
+// 导入模式
+const (
+	// ProfileImportAllOrNothing 任一行校验或写入失败则整体不写入
+	ProfileImportAllOrNothing = "all_or_nothing"
+	// ProfileImportPartial 写入所有通过校验的行，失败的行在报告中列出
+	ProfileImportPartial = "partial"
+)
+
+// 画像分区的访问权限，授权用户须在企业内拥有对应权限才能导出或导入该分区
+const (
+	ProfilePermissionRead      = "read"
+	ProfilePermissionWrite     = "write"
+	ProfilePermissionPersonnel = "profile_personnel"
+	ProfilePermissionFinancial = "profile_financial"
+	ProfilePermissionRisk      = "profile_risk"
+)
+
+// profileGuideSheet XLSX模板中的填写说明工作表
+const profileGuideSheet = "填写说明"
+
+// ErrProfileImportFormat 导入文件无法解析
+var ErrProfileImportFormat = errors.New("无法解析导入文件")
+
+// ErrProfileSchema 分区定义与模型不一致（未知的分区或字段），属于程序错误而不是导入数据错误
+var ErrProfileSchema = errors.New("企业画像分区定义错误")
+
+// profileColumn 画像分区中的一列，由模型字段的json和gorm标签推导
+type profileColumn struct {
+	Key      string
+	index    int
+	kind     reflect.Kind
+	date     bool
+	required bool
+	maxLen   int
+	enum     []string
+	jsonText bool
+	maxAbs   float64
+}
+
+// profileSection 画像的一个分区，对应CompanyProfileData的一个字段和XLSX的一个工作表
+type profileSection struct {
+	Key        string
+	Sheet      string
+	Multiple   bool
+	Permission string
+	// matchKeys 与company_id一起确定已有记录，导入时据此更新而不是重复创建
+	matchKeys []string
+	model     reflect.Type
+	columns   []profileColumn
+	validate  func(values map[string]string) map[string]string
+}
+
+var enumTagPattern = regexp.MustCompile(`enum\((.*)\)`)
+var decimalTagPattern = regexp.MustCompile(`decimal\((\d+),(\d+)\)`)
+var creditCodePattern = regexp.MustCompile(`^[0-9A-HJ-NPQRTUWXY]{2}\d{6}[0-9A-HJ-NPQRTUWXY]{10}$`)
+
+// 由系统维护、不参与导入导出的字段
+var profileSystemFields = map[string]bool{
+	"ID": true, "CompanyID": true, "CreatedAt": true, "UpdatedAt": true, "DataUpdateTime": true,
+}
+
+// profileSections 按CompanyProfileData字段顺序排列的分区
+var profileSections = []*profileSection{
+	newProfileSection("basic_info", "基本信息", CompanyProfileBasicInfo{}, false, ProfilePermissionRead, nil, validateProfileBasicInfo),
+	newProfileSection("qualifications", "资质许可", QualificationLicense{}, true, ProfilePermissionRead, []string{"type", "name"}, nil),
+	newProfileSection("personnel", "人员竞争力", PersonnelCompetitiveness{}, false, ProfilePermissionPersonnel, nil, validateProfileRates("turnover_rate", "entry_rate")),
+	newProfileSection("provident_fund", "公积金", ProvidentFund{}, false, ProfilePermissionPersonnel, nil, nil),
+	newProfileSection("subsidies", "资助补贴", SubsidyInfo{}, true, ProfilePermissionFinancial, []string{"subsidy_year", "source"}, nil),
+	newProfileSection("relationships", "企业关系", CompanyRelationship{}, true, ProfilePermissionRead, []string{"related_company_name", "relationship_type"}, validateProfileRates("investment_ratio")),
+	newProfileSection("tech_innovation", "科创评分", TechInnovationScore{}, false, ProfilePermissionRead, nil, nil),
+	newProfileSection("financial_info", "财务信息", CompanyProfileFinancialInfo{}, false, ProfilePermissionFinancial, []string{"financial_year"}, validateProfileFinancial),
+	newProfileSection("risk_info", "风险信息", CompanyProfileRiskInfo{}, false, ProfilePermissionRisk, nil, nil),
+}
+
+func newProfileSection(key, sheet string, model interface{}, multiple bool, permission string, matchKeys []string, validate func(map[string]string) map[string]string) *profileSection {
+	section := &profileSection{
+		Key:        key,
+		Sheet:      sheet,
+		Multiple:   multiple,
+		Permission: permission,
+		matchKeys:  matchKeys,
+		model:      reflect.TypeOf(model),
+		validate:   validate,
+	}
+	for i := 0; i < section.model.NumField(); i++ {
+		field := section.model.Field(i)
+		if profileSystemFields[field.Name] {
+			continue
+		}
+		col := profileColumn{Key: strings.Split(field.Tag.Get("json"), ",")[0], index: i, kind: field.Type.Kind()}
+		if field.Type == reflect.TypeOf(time.Time{}) || field.Type == reflect.TypeOf(&time.Time{}) {
+			col.date = true
+		}
+		for _, part := range strings.Split(field.Tag.Get("gorm"), ";") {
+			part = strings.TrimSpace(part)
+			switch {
+			case part == "not null":
+				col.required = true
+			case strings.HasPrefix(part, "size:"):
+				col.maxLen, _ = strconv.Atoi(strings.TrimPrefix(part, "size:"))
+			case part == "type:json":
+				col.jsonText = true
+			case enumTagPattern.MatchString(part):
+				for _, v := range strings.Split(enumTagPattern.FindStringSubmatch(part)[1], ",") {
+					col.enum = append(col.enum, strings.Trim(v, "' "))
+				}
+			case decimalTagPattern.MatchString(part):
+				m := decimalTagPattern.FindStringSubmatch(part)
+				precision, _ := strconv.Atoi(m[1])
+				scale, _ := strconv.Atoi(m[2])
+				col.maxAbs = math.Pow10(precision - scale)
+			}
+		}
+		section.columns = append(section.columns, col)
+	}
+	return section
+}
+
+func profileSectionBySheet(sheet string) *profileSection {
+	for _, section := range profileSections {
+		if section.Sheet == sheet || section.Key == sheet {
+			return section
+		}
+	}
+	return nil
+}
+
+// describe 填写说明中的列描述
+func (col profileColumn) describe() (string, string) {
+	var kind string
+	switch {
+	case col.date:
+		kind = "日期(YYYY-MM-DD)"
+	case col.jsonText:
+		kind = "JSON文本"
+	case col.kind == reflect.Int:
+		kind = "整数"
+	case col.kind == reflect.Float64:
+		kind = "数字"
+	default:
+		kind = "文本"
+	}
+	var rules []string
+	if col.required {
+		rules = append(rules, "必填")
+	}
+	if len(col.enum) > 0 {
+		rules = append(rules, "可选值: "+strings.Join(col.enum, "/"))
+	}
+	if col.maxLen > 0 {
+		rules = append(rules, fmt.Sprintf("最多%d字", col.maxLen))
+	}
+	return kind, strings.Join(rules, "；")
+}
+
+// ProfileImportIssue 导入时发现的问题，Row为XLSX中的行号或JSON数组中的序号（从1开始）
+type ProfileImportIssue struct {
+	Section string `json:"section"`
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
+
+// ProfileImportRowResult 一行的处理结果，dry run时即为预览
+type ProfileImportRowResult struct {
+	Section string `json:"section"`
+	Row     int    `json:"row"`
+	Action  string `json:"action"` // create, update, failed
+	ID      uint   `json:"id,omitempty"`
+}
+
+// ProfileImportSectionSummary 分区汇总
+type ProfileImportSectionSummary struct {
+	Total   int `json:"total"`
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Failed  int `json:"failed"`
+}
+
+// ProfileImportReport 导入报告
+type ProfileImportReport struct {
+	CompanyID uint                                    `json:"company_id"`
+	Format    string                                  `json:"format"`
+	Mode      string                                  `json:"mode"`
+	DryRun    bool                                    `json:"dry_run"`
+	Committed bool                                    `json:"committed"`
+	Summary   map[string]*ProfileImportSectionSummary `json:"summary"`
+	Rows      []ProfileImportRowResult                `json:"rows"`
+	Errors    []ProfileImportIssue                    `json:"errors"`
+}
+
+// HasErrors 是否存在失败的行
+func (r *ProfileImportReport) HasErrors() bool {
+	return len(r.Errors) > 0
+}
+
+// profileRow 从JSON或XLSX中读出的一行原始数据
+type profileRow struct {
+	section *profileSection
+	row     int
+	cells   map[string]string
+	// companyID 行中显式给出的company_id，0表示未给出
+	companyID uint
+}
+
+// ProfileImportOptions 导入选项
+type ProfileImportOptions struct {
+	CompanyID uint
+	Format    string
+	Mode      string
+	DryRun    bool
+	// Allowed 允许导入的分区，nil表示全部允许
+	Allowed map[string]bool
+}
+
+// ImportCompanyProfile 校验并导入企业画像。dry run在事务中执行全部写入后回滚，
+// 预览结果与实际导入一致；all_or_nothing模式下任一行失败则不写入任何数据
+func ImportCompanyProfile(db *gorm.DB, data []byte, opts ProfileImportOptions) (*ProfileImportReport, error) {
+	if opts.Mode == "" {
+		opts.Mode = ProfileImportAllOrNothing
+	}
+	if opts.Mode != ProfileImportAllOrNothing && opts.Mode != ProfileImportPartial {
+		return nil, fmt.Errorf("不支持的导入模式: %s", opts.Mode)
+	}
+
+	var rows []profileRow
+	var issues []ProfileImportIssue
+	var err error
+	switch opts.Format {
+	case ProfileFormatJSON:
+		rows, issues, err = readProfileJSON(data)
+	case ProfileFormatXLSX:
+		rows, issues, err = readProfileXLSX(data)
+	default:
+		return nil, fmt.Errorf("不支持的导入格式: %s", opts.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ProfileImportReport{
+		CompanyID: opts.CompanyID,
+		Format:    opts.Format,
+		Mode:      opts.Mode,
+		DryRun:    opts.DryRun,
+		Summary:   make(map[string]*ProfileImportSectionSummary),
+		Rows:      []ProfileImportRowResult{},
+		Errors:    issues,
+	}
+	for _, section := range profileSections {
+		report.Summary[section.Key] = &ProfileImportSectionSummary{}
+	}
+
+	// 先校验全部行，记录在XLSX中出现多行的单记录分区
+	type parsedRow struct {
+		profileRow
+		value reflect.Value
+	}
+	var valid []parsedRow
+	seen := make(map[string]int)
+	for _, row := range rows {
+		summary := report.Summary[row.section.Key]
+		summary.Total++
+		rowIssues := validateProfileRow(row, opts)
+		if !row.section.Multiple {
+			if first, ok := seen[row.section.Key]; ok {
+				rowIssues = append(rowIssues, ProfileImportIssue{Message: fmt.Sprintf("该部分只能有一条记录，已在第%d行给出", first)})
+			}
+			seen[row.section.Key] = row.row
+		}
+		var value reflect.Value
+		if len(rowIssues) == 0 {
+			var cellIssues []ProfileImportIssue
+			value, cellIssues = row.section.decode(row.cells)
+			rowIssues = append(rowIssues, cellIssues...)
+		}
+		if len(rowIssues) > 0 {
+			for i := range rowIssues {
+				rowIssues[i].Section = row.section.Key
+				rowIssues[i].Row = row.row
+			}
+			report.Errors = append(report.Errors, rowIssues...)
+			summary.Failed++
+			report.Rows = append(report.Rows, ProfileImportRowResult{Section: row.section.Key, Row: row.row, Action: "failed"})
+			continue
+		}
+		value.FieldByName("CompanyID").SetUint(uint64(opts.CompanyID))
+		valid = append(valid, parsedRow{profileRow: row, value: value})
+	}
+	if opts.Mode == ProfileImportAllOrNothing && report.HasErrors() {
+		return report, nil
+	}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	for i, row := range valid {
+		summary := report.Summary[row.section.Key]
+		savepoint := fmt.Sprintf("profile_row_%d", i)
+		if opts.Mode == ProfileImportPartial {
+			tx.SavePoint(savepoint)
+		}
+		action, id, err := row.section.upsert(tx, opts.CompanyID, row.value)
+		if errors.Is(err, ErrProfileSchema) {
+			tx.Rollback()
+			return nil, err
+		}
+		if err != nil {
+			if opts.Mode == ProfileImportPartial {
+				tx.RollbackTo(savepoint)
+			}
+			report.Errors = append(report.Errors, ProfileImportIssue{Section: row.section.Key, Row: row.row, Message: "写入失败: " + err.Error()})
+			summary.Failed++
+			report.Rows = append(report.Rows, ProfileImportRowResult{Section: row.section.Key, Row: row.row, Action: "failed"})
+			if opts.Mode == ProfileImportAllOrNothing {
+				tx.Rollback()
+				return report, nil
+			}
+			continue
+		}
+		if action == "create" {
+			summary.Created++
+		} else {
+			summary.Updated++
+		}
+		report.Rows = append(report.Rows, ProfileImportRowResult{Section: row.section.Key, Row: row.row, Action: action, ID: id})
+	}
+	sort.SliceStable(report.Rows, func(i, j int) bool {
+		return profileSectionOrder(report.Rows[i].Section) < profileSectionOrder(report.Rows[j].Section) ||
+			report.Rows[i].Section == report.Rows[j].Section && report.Rows[i].Row < report.Rows[j].Row
+	})
+
+	if opts.DryRun {
+		tx.Rollback()
+		return report, nil
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	report.Committed = true
+	return report, nil
+}
+
+func profileSectionOrder(key string) int {
+	for i, section := range profileSections {
+		if section.Key == key {
+			return i
+		}
+	}
+	return len(profileSections)
+}
+
+// validateProfileRow 校验行的归属和分区权限
+func validateProfileRow(row profileRow, opts ProfileImportOptions) []ProfileImportIssue {
+	var issues []ProfileImportIssue
+	if opts.Allowed != nil && !opts.Allowed[row.section.Key] {
+		issues = append(issues, ProfileImportIssue{Message: "没有导入该部分的权限"})
+	}
+	if row.companyID != 0 && row.companyID != opts.CompanyID {
+		issues = append(issues, ProfileImportIssue{
+			Column:  "company_id",
+			Value:   strconv.FormatUint(uint64(row.companyID), 10),
+			Message: fmt.Sprintf("企业ID与导入目标企业%d不一致", opts.CompanyID),
+		})
+	}
+	return issues
+}
+
+// decode 将一行文本转换为模型，返回逐列的校验错误
+func (s *profileSection) decode(cells map[string]string) (reflect.Value, []ProfileImportIssue) {
+	value := reflect.New(s.model).Elem()
+	var issues []ProfileImportIssue
+	fail := func(col profileColumn, raw, message string) {
+		issues = append(issues, ProfileImportIssue{Column: col.Key, Value: raw, Message: message})
+	}
+	for _, col := range s.columns {
+		raw := strings.TrimSpace(cells[col.Key])
+		if raw == "" {
+			if col.required {
+				fail(col, raw, "必填")
+			}
+			continue
+		}
+		field := value.Field(col.index)
+		switch {
+		case col.date:
+			t, err := parseProfileDate(raw)
+			if err != nil {
+				fail(col, raw, "日期格式应为YYYY-MM-DD")
+				continue
+			}
+			if field.Kind() == reflect.Ptr {
+				field.Set(reflect.ValueOf(&t))
+			} else {
+				field.Set(reflect.ValueOf(t))
+			}
+		case col.kind == reflect.Int:
+			n, err := strconv.Atoi(strings.TrimSuffix(raw, ".0"))
+			if err != nil {
+				fail(col, raw, "应为整数")
+				continue
+			}
+			if n < 0 {
+				fail(col, raw, "不能为负数")
+				continue
+			}
+			field.SetInt(int64(n))
+		case col.kind == reflect.Float64:
+			f, err := strconv.ParseFloat(strings.ReplaceAll(raw, ",", ""), 64)
+			if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+				fail(col, raw, "应为数字")
+				continue
+			}
+			if col.maxAbs > 0 && math.Abs(f) >= col.maxAbs {
+				fail(col, raw, fmt.Sprintf("超出范围，绝对值须小于%g", col.maxAbs))
+				continue
+			}
+			field.SetFloat(f)
+		default:
+			if col.maxLen > 0 && utf8.RuneCountInString(raw) > col.maxLen {
+				fail(col, raw, fmt.Sprintf("长度不能超过%d", col.maxLen))
+				continue
+			}
+			if len(col.enum) > 0 && !containsString(col.enum, raw) {
+				fail(col, raw, "可选值为: "+strings.Join(col.enum, "/"))
+				continue
+			}
+			if col.jsonText && !json.Valid([]byte(raw)) {
+				fail(col, raw, "不是有效的JSON")
+				continue
+			}
+			field.SetString(raw)
+		}
+	}
+	if len(issues) == 0 && s.validate != nil {
+		keys := make([]string, 0)
+		messages := s.validate(cells)
+		for key := range messages {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			issues = append(issues, ProfileImportIssue{Column: key, Value: cells[key], Message: messages[key]})
+		}
+	}
+	// JSON列在MySQL中不能为空字符串
+	for _, col := range s.columns {
+		if col.jsonText && value.Field(col.index).String() == "" {
+			value.Field(col.index).SetString("null")
+		}
+	}
+	return value, issues
+}
+
+// upsert 按company_id和matchKeys更新已有记录，不存在时创建
+func (s *profileSection) upsert(tx *gorm.DB, companyID uint, value reflect.Value) (string, uint, error) {
+	query := tx.Where("company_id = ?", companyID)
+	for _, key := range s.matchKeys {
+		col, err := s.column(key)
+		if err != nil {
+			return "", 0, err
+		}
+		query = query.Where(key+" = ?", value.Field(col.index).Interface())
+	}
+	existing := reflect.New(s.model)
+	err := query.Order("id").Take(existing.Interface()).Error
+	record := reflect.New(s.model)
+	record.Elem().Set(value)
+	now := timeNow()
+	record.Elem().FieldByName("UpdatedAt").Set(reflect.ValueOf(now))
+	if s.Key == "basic_info" {
+		var current *reflect.Value
+		if err == nil {
+			current = &existing
+		}
+		if err := assignProfileReportID(tx, companyID, record.Elem(), current, now); err != nil {
+			return "", 0, err
+		}
+	}
+
+	switch {
+	case err == nil:
+		record.Elem().FieldByName("ID").Set(existing.Elem().FieldByName("ID"))
+		record.Elem().FieldByName("CreatedAt").Set(existing.Elem().FieldByName("CreatedAt"))
+		if err := tx.Save(record.Interface()).Error; err != nil {
+			return "", 0, err
+		}
+		return "update", uint(record.Elem().FieldByName("ID").Uint()), nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		record.Elem().FieldByName("CreatedAt").Set(reflect.ValueOf(now))
+		if err := tx.Create(record.Interface()).Error; err != nil {
+			return "", 0, err
+		}
+		return "create", uint(record.Elem().FieldByName("ID").Uint()), nil
+	default:
+		return "", 0, err
+	}
+}
+
+// assignProfileReportID 报告编号全局唯一：留空时沿用已有编号或重新生成，
+// 导入其他企业导出的画像时也重新生成
+func assignProfileReportID(tx *gorm.DB, companyID uint, record reflect.Value, existing *reflect.Value, now time.Time) error {
+	field := record.FieldByName("ReportID")
+	if field.String() != "" {
+		var owner CompanyProfileBasicInfo
+		err := tx.Select("company_id").Where("report_id = ?", field.String()).Take(&owner).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) || err == nil && owner.CompanyID == companyID {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if existing != nil && existing.Elem().FieldByName("ReportID").String() != "" {
+		field.SetString(existing.Elem().FieldByName("ReportID").String())
+		return nil
+	}
+	field.SetString(fmt.Sprintf("FSCR%s%06d", now.Format("20060102150405"), companyID))
+	return nil
+}
+
+// column 按列名查找分区中的列
+func (s *profileSection) column(key string) (profileColumn, error) {
+	for _, col := range s.columns {
+		if col.Key == key {
+			return col, nil
+		}
+	}
+	return profileColumn{}, fmt.Errorf("%w: 分区%s没有字段%s", ErrProfileSchema, s.Key, key)
+}
+
+// cells 将模型转换为一行文本，与decode互逆
+func (s *profileSection) cells(record reflect.Value) []string {
+	cells := make([]string, len(s.columns))
+	for i, col := range s.columns {
+		field := record.Field(col.index)
+		switch {
+		case col.date:
+			if field.Kind() == reflect.Ptr {
+				if field.IsNil() {
+					continue
+				}
+				field = field.Elem()
+			}
+			if t := field.Interface().(time.Time); !t.IsZero() {
+				cells[i] = t.Format("2006-01-02")
+			}
+		case col.kind == reflect.Int:
+			cells[i] = strconv.FormatInt(field.Int(), 10)
+		case col.kind == reflect.Float64:
+			cells[i] = strconv.FormatFloat(field.Float(), 'f', -1, 64)
+		default:
+			if v := field.String(); !(col.jsonText && v == "null") {
+				cells[i] = v
+			}
+		}
+	}
+	return cells
+}
+
+func parseProfileDate(raw string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", time.RFC3339, "2006/01/02", "2006-01-02 15:04:05", "2006-01", "2006/1/2"} {
+		if t, err := time.ParseInLocation(layout, raw, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	// Excel中按日期格式输入的单元格可能以序列号读出
+	if serial, err := strconv.ParseFloat(raw, 64); err == nil && serial > 0 && serial < 100000 {
+		return excelize.ExcelDateToTime(serial, false)
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", raw)
+}
+
+func validateProfileBasicInfo(values map[string]string) map[string]string {
+	errs := make(map[string]string)
+	if code := strings.TrimSpace(values["unified_social_credit_code"]); code != "" && !creditCodePattern.MatchString(strings.ToUpper(code)) {
+		errs["unified_social_credit_code"] = "统一社会信用代码应为18位"
+	}
+	if capital, err := strconv.ParseFloat(values["registered_capital"], 64); err == nil && capital < 0 {
+		errs["registered_capital"] = "注册资本不能为负数"
+	}
+	return errs
+}
+
+func validateProfileFinancial(values map[string]string) map[string]string {
+	errs := make(map[string]string)
+	year, err := strconv.Atoi(strings.TrimSpace(values["financial_year"]))
+	if err != nil {
+		errs["financial_year"] = "必填"
+	} else if year < 1900 || year > timeNow().Year()+1 {
+		errs["financial_year"] = "财务年度超出范围"
+	}
+	return errs
+}
+
+// validateProfileRates 百分比字段须在0~100之间
+func validateProfileRates(keys ...string) func(map[string]string) map[string]string {
+	return func(values map[string]string) map[string]string {
+		errs := make(map[string]string)
+		for _, key := range keys {
+			if v, err := strconv.ParseFloat(values[key], 64); err == nil && (v < 0 || v > 100) {
+				errs[key] = "应在0~100之间"
+			}
+		}
+		return errs
+	}
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
+// readProfileJSON 读取与CompanyProfileData结构相同的JSON
+func readProfileJSON(data []byte) ([]profileRow, []ProfileImportIssue, error) {
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrProfileImportFormat, err)
+	}
+	var rows []profileRow
+	var issues []ProfileImportIssue
+	for _, section := range profileSections {
+		raw, ok := document[section.Key]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+		var items []map[string]interface{}
+		if section.Multiple {
+			if err := json.Unmarshal(raw, &items); err != nil {
+				issues = append(issues, ProfileImportIssue{Section: section.Key, Message: "应为数组"})
+				continue
+			}
+		} else {
+			var item map[string]interface{}
+			if err := json.Unmarshal(raw, &item); err != nil {
+				issues = append(issues, ProfileImportIssue{Section: section.Key, Message: "应为对象"})
+				continue
+			}
+			items = append(items, item)
+		}
+		for i, item := range items {
+			row := profileRow{section: section, row: i + 1, cells: make(map[string]string)}
+			for key, v := range item {
+				row.cells[key] = jsonCellString(v)
+			}
+			if id, err := strconv.ParseUint(row.cells["company_id"], 10, 64); err == nil {
+				row.companyID = uint(id)
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows, issues, nil
+}
+
+func jsonCellString(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	default:
+		// 嵌套对象或数组原样作为JSON文本
+		data, _ := json.Marshal(value)
+		return string(data)
+	}
+}
+
+// readProfileXLSX 读取每个分区一个工作表、首行为列名的XLSX，行号与Excel一致，未知的列被忽略
+func readProfileXLSX(data []byte) ([]profileRow, []ProfileImportIssue, error) {
+	f, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrProfileImportFormat, err)
+	}
+	defer f.Close()
+
+	var rows []profileRow
+	var issues []ProfileImportIssue
+	for _, sheet := range f.GetSheetList() {
+		if sheet == profileGuideSheet {
+			continue
+		}
+		section := profileSectionBySheet(sheet)
+		if section == nil {
+			issues = append(issues, ProfileImportIssue{Section: sheet, Message: "无法识别的工作表"})
+			continue
+		}
+		sheetRows, err := f.GetRows(sheet)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrProfileImportFormat, err)
+		}
+		if len(sheetRows) == 0 {
+			continue
+		}
+		header := sheetRows[0]
+		for r, values := range sheetRows[1:] {
+			row := profileRow{section: section, row: r + 2, cells: make(map[string]string)}
+			empty := true
+			for i, v := range values {
+				if i < len(header) && strings.TrimSpace(v) != "" {
+					row.cells[strings.TrimSpace(header[i])] = v
+					empty = false
+				}
+			}
+			if empty {
+				continue
+			}
+			if id, err := strconv.ParseUint(strings.TrimSpace(row.cells["company_id"]), 10, 64); err == nil {
+				row.companyID = uint(id)
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows, issues, nil
+}
+
+// LoadCompanyProfile 读取企业画像的全部分区，财务信息取最近的财务年度
+func LoadCompanyProfile(db *gorm.DB, companyID uint) *CompanyProfileData {
+	profileData := &CompanyProfileData{}
+
+	var basicInfo CompanyProfileBasicInfo
+	if err := db.Where("company_id = ?", companyID).First(&basicInfo).Error; err == nil {
+		profileData.BasicInfo = &basicInfo
+	}
+
+	var qualifications []QualificationLicense
+	db.Where("company_id = ?", companyID).Order("id").Find(&qualifications)
+	profileData.Qualifications = qualifications
+
+	var personnel PersonnelCompetitiveness
+	if err := db.Where("company_id = ?", companyID).First(&personnel).Error; err == nil {
+		profileData.Personnel = &personnel
+	}
+
+	var providentFund ProvidentFund
+	if err := db.Where("company_id = ?", companyID).First(&providentFund).Error; err == nil {
+		profileData.ProvidentFund = &providentFund
+	}
+
+	var subsidies []SubsidyInfo
+	db.Where("company_id = ?", companyID).Order("id").Find(&subsidies)
+	profileData.Subsidies = subsidies
+
+	var relationships []CompanyRelationship
+	db.Where("company_id = ?", companyID).Order("id").Find(&relationships)
+	profileData.Relationships = relationships
+
+	var techInnovation TechInnovationScore
+	if err := db.Where("company_id = ?", companyID).First(&techInnovation).Error; err == nil {
+		profileData.TechInnovation = &techInnovation
+	}
+
+	var financialInfo CompanyProfileFinancialInfo
+	if err := db.Where("company_id = ?", companyID).Order("financial_year DESC").First(&financialInfo).Error; err == nil {
+		profileData.FinancialInfo = &financialInfo
+	}
+
+	var riskInfo CompanyProfileRiskInfo
+	if err := db.Where("company_id = ?", companyID).First(&riskInfo).Error; err == nil {
+		profileData.RiskInfo = &riskInfo
+	}
+
+	return profileData
+}
+
+// FilterProfileSections 清空不允许访问的分区，返回被清空的分区
+func FilterProfileSections(profile *CompanyProfileData, allowed map[string]bool) ([]string, error) {
+	var omitted []string
+	for _, section := range profileSections {
+		if allowed == nil || allowed[section.Key] {
+			continue
+		}
+		field, err := profileDataField(profile, section.Key)
+		if err != nil {
+			return nil, err
+		}
+		field.Set(reflect.Zero(field.Type()))
+		omitted = append(omitted, section.Key)
+	}
+	return omitted, nil
+}
+
+// profileDataField CompanyProfileData中与分区同名（json标签）的字段
+func profileDataField(profile *CompanyProfileData, key string) (reflect.Value, error) {
+	value := reflect.ValueOf(profile).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		if strings.Split(value.Type().Field(i).Tag.Get("json"), ",")[0] == key {
+			return value.Field(i), nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("%w: 画像数据中没有分区%s", ErrProfileSchema, key)
+}
+
+// profileSectionRecords 分区中的记录
+func profileSectionRecords(profile *CompanyProfileData, key string) ([]reflect.Value, error) {
+	field, err := profileDataField(profile, key)
+	if err != nil {
+		return nil, err
+	}
+	switch field.Kind() {
+	case reflect.Ptr:
+		if field.IsNil() {
+			return nil, nil
+		}
+		return []reflect.Value{field.Elem()}, nil
+	case reflect.Slice:
+		records := make([]reflect.Value, field.Len())
+		for j := range records {
+			records[j] = field.Index(j)
+		}
+		return records, nil
+	}
+	return nil, nil
+}
+
+// WriteCompanyProfileXLSX 导出为XLSX，profile为nil时生成空白模板。
+// 每个分区一个工作表，首行为列名，附带填写说明工作表
+func WriteCompanyProfileXLSX(w io.Writer, profile *CompanyProfileData, allowed map[string]bool) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	headerStyle, err := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Bold: true},
+		Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"DDEBF7"}},
+	})
+	if err != nil {
+		return err
+	}
+
+	first := true
+	for _, section := range profileSections {
+		if allowed != nil && !allowed[section.Key] {
+			continue
+		}
+		if first {
+			f.SetSheetName("Sheet1", section.Sheet)
+			first = false
+		} else if _, err := f.NewSheet(section.Sheet); err != nil {
+			return err
+		}
+		header := make([]interface{}, len(section.columns))
+		for c, col := range section.columns {
+			header[c] = col.Key
+		}
+		if err := f.SetSheetRow(section.Sheet, "A1", &header); err != nil {
+			return err
+		}
+		lastCol, _ := excelize.ColumnNumberToName(len(section.columns))
+		f.SetCellStyle(section.Sheet, "A1", lastCol+"1", headerStyle)
+		f.SetColWidth(section.Sheet, "A", lastCol, 18)
+		f.SetPanes(section.Sheet, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"})
+
+		if profile == nil {
+			continue
+		}
+		records, err := profileSectionRecords(profile, section.Key)
+		if err != nil {
+			return err
+		}
+		for r, record := range records {
+			cells := section.cells(record)
+			row := make([]interface{}, len(cells))
+			for c := range cells {
+				row[c] = cells[c]
+			}
+			cell, _ := excelize.CoordinatesToCellName(1, r+2)
+			if err := f.SetSheetRow(section.Sheet, cell, &row); err != nil {
+				return err
+			}
+		}
+	}
+	if first {
+		return errors.New("没有可导出的画像分区")
+	}
+
+	if _, err := f.NewSheet(profileGuideSheet); err != nil {
+		return err
+	}
+	guide := [][]interface{}{{"工作表", "列名", "类型", "规则"}}
+	for _, section := range profileSections {
+		if allowed != nil && !allowed[section.Key] {
+			continue
+		}
+		for _, col := range section.columns {
+			kind, rules := col.describe()
+			guide = append(guide, []interface{}{section.Sheet, col.Key, kind, rules})
+		}
+	}
+	for r, row := range guide {
+		cell, _ := excelize.CoordinatesToCellName(1, r+1)
+		if err := f.SetSheetRow(profileGuideSheet, cell, &row); err != nil {
+			return err
+		}
+	}
+	f.SetCellStyle(profileGuideSheet, "A1", "D1", headerStyle)
+	f.SetColWidth(profileGuideSheet, "A", "C", 18)
+	f.SetColWidth(profileGuideSheet, "D", "D", 60)
+	f.SetActiveSheet(0)
+	return f.Write(w)
+}
+
+// CompanyProfileJSONTemplate 空白JSON模板，列出每个分区的全部字段
+func CompanyProfileJSONTemplate() map[string]interface{} {
+	template := make(map[string]interface{})
+	for _, section := range profileSections {
+		fields := make(map[string]interface{})
+		for _, col := range section.columns {
+			switch {
+			case col.date || col.jsonText || col.kind == reflect.String:
+				fields[col.Key] = ""
+			default:
+				fields[col.Key] = 0
+			}
+		}
+		if section.Multiple {
+			template[section.Key] = []interface{}{fields}
+		} else {
+			template[section.Key] = fields
+		}
+	}
+	return template
+}
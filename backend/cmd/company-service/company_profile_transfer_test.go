@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+// newTestProfileDB 建好企业画像各分区表的测试库
+func newTestProfileDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&CompanyProfileBasicInfo{}, &PersonnelCompetitiveness{}, &ProvidentFund{}, &SubsidyInfo{},
+		&TechInnovationScore{}, &CompanyProfileFinancialInfo{}, &CompanyProfileRiskInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	// SQLite不支持enum列类型，这两张表手工建表
+	for _, ddl := range []string{
+		`CREATE TABLE qualification_license (id integer PRIMARY KEY AUTOINCREMENT, company_id integer NOT NULL, report_id text, type text NOT NULL,
+			name text NOT NULL, status text, certificate_number text, issue_date datetime, issuing_authority text, validity_period datetime,
+			content text, created_at datetime, updated_at datetime)`,
+		`CREATE TABLE company_relationships (id integer PRIMARY KEY AUTOINCREMENT, company_id integer NOT NULL, report_id text,
+			related_company_name text, relationship_type text NOT NULL, investment_amount real, investment_ratio real, position text,
+			created_at datetime, updated_at datetime)`,
+	} {
+		if err := db.Exec(ddl).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func testProfileDocument() []byte {
+	return []byte(`{
+		"basic_info": {"company_name": "深圳示例科技有限公司", "unified_social_credit_code": "91440300MA5EXAMP1X",
+			"registration_date": "2015-06-01", "registered_capital": 1000, "tags": "[\"高新技术\"]"},
+		"qualifications": [
+			{"type": "资质", "name": "高新技术企业证书", "certificate_number": "GR2023001", "issue_date": "2023-01-01"},
+			{"type": "许可", "name": "增值电信业务经营许可证"}
+		],
+		"personnel": {"total_employees": 320, "turnover_rate": 12.5},
+		"financial_info": {"financial_year": 2025, "annual_revenue": 5000000, "debt_ratio": 35.2},
+		"risk_info": {"risk_level": "低风险", "risk_factors": "[]"}
+	}`)
+}
+
+func TestImportCompanyProfileJSONRoundTrip(t *testing.T) {
+	db := newTestProfileDB(t)
+
+	report, err := ImportCompanyProfile(db, testProfileDocument(), ProfileImportOptions{CompanyID: 7, Format: ProfileFormatJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.HasErrors() || !report.Committed {
+		t.Fatalf("unexpected report: %+v", report.Errors)
+	}
+	if report.Summary["qualifications"].Created != 2 || report.Summary["financial_info"].Created != 1 {
+		t.Fatalf("unexpected summary: %+v", report.Summary["qualifications"])
+	}
+
+	profile := LoadCompanyProfile(db, 7)
+	if profile.BasicInfo == nil || profile.BasicInfo.CompanyID != 7 || profile.BasicInfo.RegistrationDate.Format("2006-01-02") != "2015-06-01" {
+		t.Fatalf("unexpected basic info: %+v", profile.BasicInfo)
+	}
+
+	// 导出的JSON重新导入只更新已有记录
+	exported, _ := json.Marshal(profile)
+	report, err = ImportCompanyProfile(db, exported, ProfileImportOptions{CompanyID: 7, Format: ProfileFormatJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.HasErrors() {
+		t.Fatalf("re-import errors: %+v", report.Errors)
+	}
+	for key, summary := range report.Summary {
+		if summary.Created != 0 {
+			t.Fatalf("re-import created %d %s records", summary.Created, key)
+		}
+	}
+	var count int64
+	db.Model(&QualificationLicense{}).Where("company_id = ?", 7).Count(&count)
+	if count != 2 {
+		t.Fatalf("qualification count = %d, want 2", count)
+	}
+}
+
+func TestImportCompanyProfileXLSXRoundTrip(t *testing.T) {
+	db := newTestProfileDB(t)
+	if _, err := ImportCompanyProfile(db, testProfileDocument(), ProfileImportOptions{CompanyID: 7, Format: ProfileFormatJSON}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCompanyProfileXLSX(&buf, LoadCompanyProfile(db, 7), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// 导入到另一家企业后两者内容一致
+	report, err := ImportCompanyProfile(db, buf.Bytes(), ProfileImportOptions{CompanyID: 8, Format: ProfileFormatXLSX})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.HasErrors() {
+		t.Fatalf("xlsx import errors: %+v", report.Errors)
+	}
+	original, copied := LoadCompanyProfile(db, 7), LoadCompanyProfile(db, 8)
+	if copied.BasicInfo.CompanyName != original.BasicInfo.CompanyName ||
+		copied.Personnel.TurnoverRate != original.Personnel.TurnoverRate ||
+		copied.FinancialInfo.DebtRatio != original.FinancialInfo.DebtRatio ||
+		len(copied.Qualifications) != len(original.Qualifications) ||
+		!copied.Qualifications[0].IssueDate.Equal(*original.Qualifications[0].IssueDate) {
+		t.Fatalf("xlsx round trip mismatch:\n%+v\n%+v", original, copied)
+	}
+}
+
+func xlsxWithRows(t *testing.T, sheet string, rows [][]interface{}) []byte {
+	t.Helper()
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", sheet)
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		f.SetSheetRow(sheet, cell, &row)
+	}
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImportCompanyProfileValidationModes(t *testing.T) {
+	db := newTestProfileDB(t)
+	data := xlsxWithRows(t, "资质许可", [][]interface{}{
+		{"type", "name", "issue_date", "company_id"},
+		{"资质", "ISO9001认证", "2024-03-01"},
+		{"证书", "", "2024-13-01"},
+		{},
+		{"许可", "网络文化经营许可证", "", 99},
+	})
+
+	report, err := ImportCompanyProfile(db, data, ProfileImportOptions{CompanyID: 7, Format: ProfileFormatXLSX})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Committed || report.Summary["qualifications"].Failed != 2 {
+		t.Fatalf("all_or_nothing report: %+v", report.Summary["qualifications"])
+	}
+	want := map[int][]string{3: {"type", "name", "issue_date"}, 5: {"company_id"}}
+	got := make(map[int][]string)
+	for _, issue := range report.Errors {
+		got[issue.Row] = append(got[issue.Row], issue.Column)
+	}
+	for row, columns := range want {
+		if len(got[row]) != len(columns) {
+			t.Fatalf("row %d errors = %v, want %v (all: %+v)", row, got[row], columns, report.Errors)
+		}
+	}
+	var count int64
+	db.Model(&QualificationLicense{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("all_or_nothing wrote %d rows", count)
+	}
+
+	// dry run预览不写入
+	report, err = ImportCompanyProfile(db, data, ProfileImportOptions{CompanyID: 7, Format: ProfileFormatXLSX, Mode: ProfileImportPartial, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Committed || report.Summary["qualifications"].Created != 1 {
+		t.Fatalf("dry run report: %+v", report.Summary["qualifications"])
+	}
+	db.Model(&QualificationLicense{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("dry run wrote %d rows", count)
+	}
+
+	report, err = ImportCompanyProfile(db, data, ProfileImportOptions{CompanyID: 7, Format: ProfileFormatXLSX, Mode: ProfileImportPartial})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Model(&QualificationLicense{}).Count(&count)
+	if !report.Committed || count != 1 {
+		t.Fatalf("partial import committed=%v rows=%d", report.Committed, count)
+	}
+}
+
+func TestImportCompanyProfileSectionPermissions(t *testing.T) {
+	db := newTestProfileDB(t)
+	allowed := map[string]bool{"basic_info": true, "qualifications": true}
+
+	report, err := ImportCompanyProfile(db, testProfileDocument(), ProfileImportOptions{
+		CompanyID: 7, Format: ProfileFormatJSON, Mode: ProfileImportPartial, Allowed: allowed,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Summary["financial_info"].Failed != 1 || report.Summary["basic_info"].Created != 1 {
+		t.Fatalf("unexpected summary: financial=%+v basic=%+v", report.Summary["financial_info"], report.Summary["basic_info"])
+	}
+
+	profile := LoadCompanyProfile(db, 7)
+	omitted, err := FilterProfileSections(profile, allowed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.FinancialInfo != nil || profile.Personnel != nil || len(omitted) != len(profileSections)-2 {
+		t.Fatalf("filtered profile still has restricted sections, omitted=%v", omitted)
+	}
+	var buf bytes.Buffer
+	if err := WriteCompanyProfileXLSX(&buf, profile, allowed); err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sheets := f.GetSheetList(); len(sheets) != 3 {
+		t.Fatalf("sheets = %v, want two sections and the guide", sheets)
+	}
+}
+
+func TestProfileTemplates(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCompanyProfileXLSX(&buf, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	db := newTestProfileDB(t)
+	report, err := ImportCompanyProfile(db, buf.Bytes(), ProfileImportOptions{CompanyID: 1, Format: ProfileFormatXLSX})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Rows) != 0 || report.HasErrors() {
+		t.Fatalf("blank template should import nothing: %+v", report)
+	}
+
+	template := CompanyProfileJSONTemplate()
+	if _, ok := template["qualifications"].([]interface{}); !ok {
+		t.Fatal("list sections should be arrays in the JSON template")
+	}
+	if _, err := parseProfileDate("45292"); err != nil {
+		t.Fatal("excel serial dates should be accepted")
+	}
+	if d, _ := parseProfileDate("2024-01-01T00:00:00+08:00"); d.Year() != 2024 || d.Month() != time.January {
+		t.Fatalf("RFC3339 date parsed as %v", d)
+	}
+}
+
+// TestImportCompanyProfileSchemaError 分区定义错误不按行失败处理，整个导入回滚并返回错误
+func TestImportCompanyProfileSchemaError(t *testing.T) {
+	db := newTestProfileDB(t)
+	section := profileSectionBySheet("资质许可")
+	original := section.matchKeys
+	section.matchKeys = []string{"no_such_column"}
+	t.Cleanup(func() { section.matchKeys = original })
+
+	report, err := ImportCompanyProfile(db, testProfileDocument(), ProfileImportOptions{CompanyID: 7, Format: ProfileFormatJSON, Mode: ProfileImportPartial})
+	if !errors.Is(err, ErrProfileSchema) || report != nil {
+		t.Fatalf("expected schema error, got report=%v err=%v", report, err)
+	}
+	var count int64
+	db.Model(&CompanyProfileBasicInfo{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("import should roll back, found %d basic info rows", count)
+	}
+
+	if _, err := profileDataField(&CompanyProfileData{}, "unknown"); !errors.Is(err, ErrProfileSchema) {
+		t.Fatalf("unknown section should return schema error, got %v", err)
+	}
+}
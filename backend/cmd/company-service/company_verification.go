@@ -0,0 +1,933 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrVerificationNotFound  = errors.New("verification case not found")
+	ErrVerificationState     = errors.New("operation not allowed in current verification state")
+	ErrVerificationForbidden = errors.New("no permission for this verification case")
+	ErrVerificationInvalid   = errors.New("invalid verification request")
+	ErrVerificationQueueIdle = errors.New("no verification case waiting for review")
+)
+
+// 认证案件状态
+const (
+	VerificationCaseSubmitted = "submitted" // 已提交，等待审核员领取
+	VerificationCaseInReview  = "in_review" // 审核中
+	VerificationCaseNeedsInfo = "needs_info"
+	VerificationCaseApproved  = "approved"
+	VerificationCaseRejected  = "rejected"
+	VerificationCaseWithdrawn = "withdrawn"
+	VerificationCaseRevoked   = "revoked" // 通过后被撤销
+)
+
+// 证明材料项
+const (
+	EvidenceBusinessLicense  = "business_license"
+	EvidenceLegalRepIdentity = "legal_rep_identity"
+	EvidenceCreditCode       = "credit_code"
+)
+
+// 证明材料审核状态
+const (
+	EvidencePending  = "pending"
+	EvidenceAccepted = "accepted"
+	EvidenceRejected = "rejected"
+)
+
+// requiredEvidenceItems 通过认证必须有被采纳的材料的项目
+var requiredEvidenceItems = []string{EvidenceBusinessLicense, EvidenceLegalRepIdentity}
+
+// openVerificationStatuses 尚未结束的案件状态，同一企业同时只能有一个
+var openVerificationStatuses = []string{VerificationCaseSubmitted, VerificationCaseInReview, VerificationCaseNeedsInfo}
+
+// CompanyVerificationCase 企业认证案件：营业执照、法定代表人身份和统一社会信用代码
+type CompanyVerificationCase struct {
+	ID               uint                `json:"id" gorm:"primaryKey"`
+	CompanyID        uint                `json:"company_id" gorm:"not null;index"`
+	Status           string              `json:"status" gorm:"size:20;not null;index"`
+	SubmittedBy      uint                `json:"submitted_by" gorm:"not null"`
+	CreditCode       string              `json:"unified_social_credit_code" gorm:"size:18;not null"`
+	LegalRepName     string              `json:"legal_representative" gorm:"size:100;not null"`
+	LegalRepIDNumber string              `json:"-" gorm:"size:18;not null"`
+	LegalRepIDMasked string              `json:"legal_representative_id" gorm:"-"`
+	Checks           string              `json:"-" gorm:"type:json"`
+	CheckResults     []VerificationCheck `json:"checks" gorm:"-"`
+	ReviewerID       *uint               `json:"reviewer_id" gorm:"index"`
+	AssignedAt       *time.Time          `json:"assigned_at"`
+	DueAt            *time.Time          `json:"due_at" gorm:"index"`            // 审核SLA截止时间，等待补充材料时暂停
+	ResponseDueAt    *time.Time          `json:"response_due_at"`                // 申请方补充材料的截止时间
+	Escalated        bool                `json:"escalated" gorm:"default:false"` // 审核超过SLA
+	InfoRounds       int                 `json:"info_rounds" gorm:"default:0"`
+	DecidedBy        *uint               `json:"decided_by"`
+	DecidedAt        *time.Time          `json:"decided_at"`
+	DecisionReason   string              `json:"decision_reason" gorm:"type:text"`
+	CreatedAt        time.Time           `json:"created_at"`
+	UpdatedAt        time.Time           `json:"updated_at"`
+
+	Evidence []CompanyVerificationEvidence `json:"evidence,omitempty" gorm:"foreignKey:CaseID"`
+}
+
+// TableName 指定表名
+func (CompanyVerificationCase) TableName() string {
+	return "company_verification_cases"
+}
+
+// AfterFind 解析自动校验结果并脱敏身份证号
+func (v *CompanyVerificationCase) AfterFind(tx *gorm.DB) error {
+	v.LegalRepIDMasked = maskIDNumber(v.LegalRepIDNumber)
+	if v.Checks != "" {
+		return json.Unmarshal([]byte(v.Checks), &v.CheckResults)
+	}
+	return nil
+}
+
+// CompanyVerificationEvidence 案件关联的证明材料，指向已上传的企业文档
+type CompanyVerificationEvidence struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	CaseID     uint      `json:"case_id" gorm:"not null;index"`
+	Item       string    `json:"item" gorm:"size:30;not null"`
+	DocumentID uint      `json:"document_id" gorm:"not null"`
+	Note       string    `json:"note" gorm:"size:500"`
+	Status     string    `json:"status" gorm:"size:20;default:pending"`
+	ReviewNote string    `json:"review_note" gorm:"size:500"`
+	CreatedBy  uint      `json:"created_by" gorm:"not null"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (CompanyVerificationEvidence) TableName() string {
+	return "company_verification_evidence"
+}
+
+// CompanyVerificationEvent 案件处理记录
+type CompanyVerificationEvent struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	CaseID     uint      `json:"case_id" gorm:"not null;index"`
+	ActorID    uint      `json:"actor_id"` // 0表示系统
+	Action     string    `json:"action" gorm:"size:30;not null"`
+	FromStatus string    `json:"from_status" gorm:"size:20"`
+	ToStatus   string    `json:"to_status" gorm:"size:20"`
+	Comment    string    `json:"comment" gorm:"type:text"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (CompanyVerificationEvent) TableName() string {
+	return "company_verification_events"
+}
+
+// VerificationCheck 一项自动校验的结果
+type VerificationCheck struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+// VerificationCheckError 自动校验未通过，案件不会被创建
+type VerificationCheckError struct {
+	Checks []VerificationCheck
+}
+
+func (e *VerificationCheckError) Error() string {
+	var failed []string
+	for _, check := range e.Checks {
+		if !check.Passed {
+			failed = append(failed, check.Name)
+		}
+	}
+	return "verification checks failed: " + strings.Join(failed, ", ")
+}
+
+// CompanyVerificationConfig 审核SLA
+type CompanyVerificationConfig struct {
+	ReviewSLA   time.Duration // 提交或补充材料后审核员须在此时间内处理
+	ResponseSLA time.Duration // 申请方须在此时间内补充材料，超时自动驳回
+}
+
+// DefaultCompanyVerificationConfig 默认审核48小时、补充材料7天，可通过环境变量配置
+func DefaultCompanyVerificationConfig() CompanyVerificationConfig {
+	config := CompanyVerificationConfig{ReviewSLA: 48 * time.Hour, ResponseSLA: 7 * 24 * time.Hour}
+	if d, err := time.ParseDuration(os.Getenv("COMPANY_VERIFICATION_REVIEW_SLA")); err == nil && d > 0 {
+		config.ReviewSLA = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("COMPANY_VERIFICATION_RESPONSE_SLA")); err == nil && d > 0 {
+		config.ResponseSLA = d
+	}
+	return config
+}
+
+// CompanyVerificationService 企业认证流程：提交、审核队列、补充材料、决定，
+// 决定结果写回企业的verification_level，控制认证标识和职位发布权限
+type CompanyVerificationService struct {
+	db     *gorm.DB
+	config CompanyVerificationConfig
+
+	// OnDecision 案件通过、驳回或撤销后调用，用于触发企业数据同步
+	OnDecision func(c *CompanyVerificationCase)
+}
+
+// NewCompanyVerificationService 创建认证服务
+func NewCompanyVerificationService(db *gorm.DB, config CompanyVerificationConfig) *CompanyVerificationService {
+	return &CompanyVerificationService{db: db, config: config}
+}
+
+// AutoMigrate 创建认证相关的表
+func (s *CompanyVerificationService) AutoMigrate() error {
+	return s.db.AutoMigrate(&CompanyVerificationCase{}, &CompanyVerificationEvidence{}, &CompanyVerificationEvent{})
+}
+
+// StartScheduler 定期处理超过SLA的案件
+func (s *CompanyVerificationService) StartScheduler(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if escalated, expired, err := s.SweepOverdue(); err != nil {
+					log.Printf("处理超时认证案件失败: %v", err)
+				} else if escalated+expired > 0 {
+					log.Printf("认证案件超时处理: %d个升级, %d个补充材料超时驳回", escalated, expired)
+				}
+			}
+		}
+	}()
+}
+
+// EvidenceInput 提交的证明材料
+type EvidenceInput struct {
+	Item       string `json:"item" binding:"required"`
+	DocumentID uint   `json:"document_id" binding:"required"`
+	Note       string `json:"note"`
+}
+
+// VerificationSubmission 认证申请
+type VerificationSubmission struct {
+	CreditCode       string          `json:"unified_social_credit_code" binding:"required"`
+	LegalRepName     string          `json:"legal_representative" binding:"required"`
+	LegalRepIDNumber string          `json:"legal_representative_id" binding:"required"`
+	Evidence         []EvidenceInput `json:"evidence" binding:"required,min=1"`
+}
+
+// Submit 提交认证申请。自动校验全部通过后才创建案件并进入审核队列
+func (s *CompanyVerificationService) Submit(companyID, userID uint, in VerificationSubmission) (*CompanyVerificationCase, error) {
+	in.CreditCode = strings.ToUpper(strings.TrimSpace(in.CreditCode))
+	in.LegalRepIDNumber = strings.ToUpper(strings.TrimSpace(in.LegalRepIDNumber))
+	in.LegalRepName = strings.TrimSpace(in.LegalRepName)
+
+	var created CompanyVerificationCase
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var company EnhancedCompany
+		if err := tx.Select("id").First(&company, companyID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: 企业不存在", ErrVerificationInvalid)
+			}
+			return err
+		}
+		var open int64
+		if err := tx.Model(&CompanyVerificationCase{}).
+			Where("company_id = ? AND status IN ?", companyID, openVerificationStatuses).Count(&open).Error; err != nil {
+			return err
+		}
+		if open > 0 {
+			return fmt.Errorf("%w: 企业已有进行中的认证案件", ErrVerificationState)
+		}
+		if err := s.validateEvidence(tx, companyID, in.Evidence); err != nil {
+			return err
+		}
+
+		checks, err := s.runChecks(tx, companyID, in)
+		if err != nil {
+			return err
+		}
+		for _, check := range checks {
+			if !check.Passed {
+				return &VerificationCheckError{Checks: checks}
+			}
+		}
+		encoded, _ := json.Marshal(checks)
+
+		now := timeNow()
+		due := now.Add(s.config.ReviewSLA)
+		created = CompanyVerificationCase{
+			CompanyID:        companyID,
+			Status:           VerificationCaseSubmitted,
+			SubmittedBy:      userID,
+			CreditCode:       in.CreditCode,
+			LegalRepName:     in.LegalRepName,
+			LegalRepIDNumber: in.LegalRepIDNumber,
+			Checks:           string(encoded),
+			DueAt:            &due,
+			CreatedAt:        now,
+			UpdatedAt:        now,
+		}
+		if err := tx.Create(&created).Error; err != nil {
+			return err
+		}
+		if err := s.addEvidence(tx, created.ID, userID, in.Evidence); err != nil {
+			return err
+		}
+		return s.recordEvent(tx, created.ID, userID, "submit", "", VerificationCaseSubmitted, "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(created.ID)
+}
+
+// runChecks 自动校验：信用代码和身份证号校验位、信用代码未被其他已认证企业使用、必需材料齐全
+func (s *CompanyVerificationService) runChecks(tx *gorm.DB, companyID uint, in VerificationSubmission) ([]VerificationCheck, error) {
+	checks := []VerificationCheck{
+		{Name: "credit_code_checksum", Passed: ValidateCreditCode(in.CreditCode)},
+		{Name: "legal_rep_id_checksum", Passed: ValidateResidentID(in.LegalRepIDNumber)},
+	}
+	if !checks[0].Passed {
+		checks[0].Message = "统一社会信用代码格式或校验位错误"
+	}
+	if !checks[1].Passed {
+		checks[1].Message = "法定代表人身份证号格式、出生日期或校验位错误"
+	}
+
+	var taken int64
+	if err := tx.Model(&EnhancedCompany{}).
+		Where("unified_social_credit_code = ? AND id <> ? AND verification_level IN ?", in.CreditCode, companyID,
+			[]string{string(VerificationVerified), string(VerificationPremium)}).
+		Count(&taken).Error; err != nil {
+		return nil, err
+	}
+	unique := VerificationCheck{Name: "credit_code_unique", Passed: taken == 0}
+	if !unique.Passed {
+		unique.Message = "该统一社会信用代码已被其他已认证企业使用"
+	}
+
+	provided := make(map[string]bool)
+	for _, e := range in.Evidence {
+		provided[e.Item] = true
+	}
+	var missing []string
+	for _, item := range requiredEvidenceItems {
+		if !provided[item] {
+			missing = append(missing, item)
+		}
+	}
+	evidence := VerificationCheck{Name: "required_evidence", Passed: len(missing) == 0}
+	if !evidence.Passed {
+		evidence.Message = "缺少证明材料: " + strings.Join(missing, ", ")
+	}
+	return append(checks, unique, evidence), nil
+}
+
+// validateEvidence 材料项须有效，文档须属于该企业
+func (s *CompanyVerificationService) validateEvidence(tx *gorm.DB, companyID uint, evidence []EvidenceInput) error {
+	ids := make([]uint, 0, len(evidence))
+	for _, e := range evidence {
+		switch e.Item {
+		case EvidenceBusinessLicense, EvidenceLegalRepIdentity, EvidenceCreditCode:
+		default:
+			return fmt.Errorf("%w: 未知的材料项 %s", ErrVerificationInvalid, e.Item)
+		}
+		ids = append(ids, e.DocumentID)
+	}
+	var owned []uint
+	if err := tx.Model(&CompanyDocument{}).Where("id IN ? AND company_id = ?", ids, companyID).Pluck("id", &owned).Error; err != nil {
+		return err
+	}
+	found := make(map[uint]bool, len(owned))
+	for _, id := range owned {
+		found[id] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return fmt.Errorf("%w: 文档%d不存在或不属于该企业", ErrVerificationInvalid, id)
+		}
+	}
+	return nil
+}
+
+func (s *CompanyVerificationService) addEvidence(tx *gorm.DB, caseID, userID uint, evidence []EvidenceInput) error {
+	now := timeNow()
+	for _, e := range evidence {
+		record := CompanyVerificationEvidence{
+			CaseID:     caseID,
+			Item:       e.Item,
+			DocumentID: e.DocumentID,
+			Note:       e.Note,
+			Status:     EvidencePending,
+			CreatedBy:  userID,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get 读取案件及其证明材料
+func (s *CompanyVerificationService) Get(caseID uint) (*CompanyVerificationCase, error) {
+	var vc CompanyVerificationCase
+	if err := s.db.Preload("Evidence").First(&vc, caseID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVerificationNotFound
+		}
+		return nil, err
+	}
+	return &vc, nil
+}
+
+// ListCompanyCases 企业的全部认证案件，最新的在前
+func (s *CompanyVerificationService) ListCompanyCases(companyID uint) ([]CompanyVerificationCase, error) {
+	var cases []CompanyVerificationCase
+	err := s.db.Preload("Evidence").Where("company_id = ?", companyID).Order("id DESC").Find(&cases).Error
+	return cases, err
+}
+
+// ListEvents 案件处理记录
+func (s *CompanyVerificationService) ListEvents(caseID uint) ([]CompanyVerificationEvent, error) {
+	var events []CompanyVerificationEvent
+	err := s.db.Where("case_id = ?", caseID).Order("id").Find(&events).Error
+	return events, err
+}
+
+// VerificationQueueFilter 审核队列筛选条件
+type VerificationQueueFilter struct {
+	Status     string
+	ReviewerID uint
+	Unassigned bool
+	Overdue    bool
+}
+
+// ListQueue 审核队列：默认包含全部未结束的案件，超过SLA的在前，其余按截止时间排序
+func (s *CompanyVerificationService) ListQueue(filter VerificationQueueFilter, offset, limit int) ([]CompanyVerificationCase, int64, error) {
+	query := s.db.Model(&CompanyVerificationCase{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	} else {
+		query = query.Where("status IN ?", openVerificationStatuses)
+	}
+	if filter.ReviewerID != 0 {
+		query = query.Where("reviewer_id = ?", filter.ReviewerID)
+	}
+	if filter.Unassigned {
+		query = query.Where("reviewer_id IS NULL")
+	}
+	if filter.Overdue {
+		query = query.Where("due_at < ?", timeNow())
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var cases []CompanyVerificationCase
+	err := query.Order("escalated DESC").Order("due_at IS NULL").Order("due_at").Order("id").
+		Offset(offset).Limit(limit).Find(&cases).Error
+	return cases, total, err
+}
+
+// ClaimNext 审核员从队列领取截止时间最早的未分配案件
+func (s *CompanyVerificationService) ClaimNext(reviewerID uint) (*CompanyVerificationCase, error) {
+	// 并发领取时条件更新失败的一方重试下一个案件
+	for attempt := 0; attempt < 5; attempt++ {
+		var next CompanyVerificationCase
+		err := s.db.Where("status = ? AND reviewer_id IS NULL", VerificationCaseSubmitted).
+			Order("escalated DESC").Order("due_at").Order("id").First(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVerificationQueueIdle
+		}
+		if err != nil {
+			return nil, err
+		}
+		claimed, err := s.assign(next.ID, reviewerID, reviewerID, true)
+		if errors.Is(err, ErrVerificationState) {
+			continue
+		}
+		return claimed, err
+	}
+	return nil, ErrVerificationQueueIdle
+}
+
+// Assign 管理员把案件分配给审核员，可以改派
+func (s *CompanyVerificationService) Assign(caseID, reviewerID, actorID uint) (*CompanyVerificationCase, error) {
+	return s.assign(caseID, reviewerID, actorID, false)
+}
+
+func (s *CompanyVerificationService) assign(caseID, reviewerID, actorID uint, onlyUnassigned bool) (*CompanyVerificationCase, error) {
+	if reviewerID == 0 {
+		return nil, fmt.Errorf("%w: 需要指定审核员", ErrVerificationInvalid)
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		vc, err := s.find(tx, caseID)
+		if err != nil {
+			return err
+		}
+		if vc.Status != VerificationCaseSubmitted && vc.Status != VerificationCaseInReview && vc.Status != VerificationCaseNeedsInfo {
+			return fmt.Errorf("%w: 案件状态为%s", ErrVerificationState, vc.Status)
+		}
+		now := timeNow()
+		update := tx.Model(&CompanyVerificationCase{}).Where("id = ? AND status = ?", caseID, vc.Status)
+		if onlyUnassigned {
+			update = update.Where("reviewer_id IS NULL")
+		}
+		status := vc.Status
+		if status == VerificationCaseSubmitted {
+			status = VerificationCaseInReview
+		}
+		result := update.Updates(map[string]interface{}{
+			"reviewer_id": reviewerID,
+			"assigned_at": now,
+			"status":      status,
+			"updated_at":  now,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w: 案件已被其他审核员领取", ErrVerificationState)
+		}
+		return s.recordEvent(tx, caseID, actorID, "assign", vc.Status, status, fmt.Sprintf("reviewer=%d", reviewerID))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(caseID)
+}
+
+// RequestInfo 审核员要求补充材料，审核SLA暂停，申请方须在ResponseSLA内答复
+func (s *CompanyVerificationService) RequestInfo(caseID, reviewerID uint, comment string) (*CompanyVerificationCase, error) {
+	if strings.TrimSpace(comment) == "" {
+		return nil, fmt.Errorf("%w: 需要说明补充哪些材料", ErrVerificationInvalid)
+	}
+	return s.transition(caseID, func(tx *gorm.DB, vc *CompanyVerificationCase) error {
+		if err := s.requireReviewer(vc, reviewerID, VerificationCaseInReview); err != nil {
+			return err
+		}
+		responseDue := timeNow().Add(s.config.ResponseSLA)
+		if err := s.update(tx, vc, map[string]interface{}{
+			"status":          VerificationCaseNeedsInfo,
+			"due_at":          nil,
+			"response_due_at": responseDue,
+			"escalated":       false,
+		}); err != nil {
+			return err
+		}
+		return s.recordEvent(tx, vc.ID, reviewerID, "request_info", VerificationCaseInReview, VerificationCaseNeedsInfo, comment)
+	})
+}
+
+// Respond 申请方补充材料，案件回到原审核员，审核SLA重新计时
+func (s *CompanyVerificationService) Respond(caseID, userID uint, comment string, evidence []EvidenceInput) (*CompanyVerificationCase, error) {
+	return s.transition(caseID, func(tx *gorm.DB, vc *CompanyVerificationCase) error {
+		if vc.Status != VerificationCaseNeedsInfo {
+			return fmt.Errorf("%w: 案件状态为%s", ErrVerificationState, vc.Status)
+		}
+		if len(evidence) == 0 && strings.TrimSpace(comment) == "" {
+			return fmt.Errorf("%w: 需要补充材料或说明", ErrVerificationInvalid)
+		}
+		if len(evidence) > 0 {
+			if err := s.validateEvidence(tx, vc.CompanyID, evidence); err != nil {
+				return err
+			}
+			if err := s.addEvidence(tx, vc.ID, userID, evidence); err != nil {
+				return err
+			}
+		}
+		status := VerificationCaseInReview
+		if vc.ReviewerID == nil {
+			status = VerificationCaseSubmitted
+		}
+		due := timeNow().Add(s.config.ReviewSLA)
+		if err := s.update(tx, vc, map[string]interface{}{
+			"status":          status,
+			"due_at":          due,
+			"response_due_at": nil,
+			"info_rounds":     vc.InfoRounds + 1,
+		}); err != nil {
+			return err
+		}
+		return s.recordEvent(tx, vc.ID, userID, "respond", VerificationCaseNeedsInfo, status, comment)
+	})
+}
+
+// ReviewEvidence 审核员采纳或退回一份证明材料
+func (s *CompanyVerificationService) ReviewEvidence(caseID, evidenceID, reviewerID uint, status, note string) (*CompanyVerificationCase, error) {
+	if status != EvidenceAccepted && status != EvidenceRejected {
+		return nil, fmt.Errorf("%w: 材料审核结果须为accepted或rejected", ErrVerificationInvalid)
+	}
+	return s.transition(caseID, func(tx *gorm.DB, vc *CompanyVerificationCase) error {
+		if err := s.requireReviewer(vc, reviewerID, VerificationCaseInReview); err != nil {
+			return err
+		}
+		result := tx.Model(&CompanyVerificationEvidence{}).Where("id = ? AND case_id = ?", evidenceID, caseID).
+			Updates(map[string]interface{}{"status": status, "review_note": note, "updated_at": timeNow()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrVerificationNotFound
+		}
+		return s.recordEvent(tx, vc.ID, reviewerID, "review_evidence", vc.Status, vc.Status, fmt.Sprintf("evidence=%d %s %s", evidenceID, status, note))
+	})
+}
+
+// Decide 审核员作出决定。通过要求每个必需材料项都至少有一份被采纳的材料，
+// 通过后企业获得认证标识并可以发布职位
+func (s *CompanyVerificationService) Decide(caseID, reviewerID uint, approve bool, reason string) (*CompanyVerificationCase, error) {
+	decided, err := s.transition(caseID, func(tx *gorm.DB, vc *CompanyVerificationCase) error {
+		if err := s.requireReviewer(vc, reviewerID, VerificationCaseInReview); err != nil {
+			return err
+		}
+		status, action := VerificationCaseRejected, "reject"
+		if approve {
+			status, action = VerificationCaseApproved, "approve"
+			if missing := missingAcceptedEvidence(vc.Evidence); len(missing) > 0 {
+				return fmt.Errorf("%w: 以下材料尚未采纳: %s", ErrVerificationState, strings.Join(missing, ", "))
+			}
+		} else if strings.TrimSpace(reason) == "" {
+			return fmt.Errorf("%w: 驳回需要说明原因", ErrVerificationInvalid)
+		}
+		if err := s.finish(tx, vc, status, reviewerID, reason); err != nil {
+			return err
+		}
+		if approve {
+			if err := s.applyVerification(tx, vc); err != nil {
+				return err
+			}
+		}
+		return s.recordEvent(tx, vc.ID, reviewerID, action, VerificationCaseInReview, status, reason)
+	})
+	if err == nil && s.OnDecision != nil {
+		s.OnDecision(decided)
+	}
+	return decided, err
+}
+
+// Withdraw 申请方撤回未结束的案件
+func (s *CompanyVerificationService) Withdraw(caseID, userID uint, reason string) (*CompanyVerificationCase, error) {
+	return s.transition(caseID, func(tx *gorm.DB, vc *CompanyVerificationCase) error {
+		if !isOpenVerificationStatus(vc.Status) {
+			return fmt.Errorf("%w: 案件状态为%s", ErrVerificationState, vc.Status)
+		}
+		from := vc.Status
+		if err := s.finish(tx, vc, VerificationCaseWithdrawn, userID, reason); err != nil {
+			return err
+		}
+		return s.recordEvent(tx, vc.ID, userID, "withdraw", from, VerificationCaseWithdrawn, reason)
+	})
+}
+
+// Revoke 撤销企业当前的认证，企业失去认证标识和职位发布权限
+func (s *CompanyVerificationService) Revoke(companyID, actorID uint, reason string) (*CompanyVerificationCase, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, fmt.Errorf("%w: 撤销认证需要说明原因", ErrVerificationInvalid)
+	}
+	var approved CompanyVerificationCase
+	if err := s.db.Where("company_id = ? AND status = ?", companyID, VerificationCaseApproved).
+		Order("id DESC").First(&approved).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: 企业没有已通过的认证", ErrVerificationState)
+		}
+		return nil, err
+	}
+	revoked, err := s.transition(approved.ID, func(tx *gorm.DB, vc *CompanyVerificationCase) error {
+		if vc.Status != VerificationCaseApproved {
+			return fmt.Errorf("%w: 案件状态为%s", ErrVerificationState, vc.Status)
+		}
+		if err := s.update(tx, vc, map[string]interface{}{"status": VerificationCaseRevoked}); err != nil {
+			return err
+		}
+		if err := tx.Model(&EnhancedCompany{}).Where("id = ?", companyID).Updates(map[string]interface{}{
+			"verification_level": string(VerificationUnverified),
+			"updated_at":         timeNow(),
+		}).Error; err != nil {
+			return err
+		}
+		return s.recordEvent(tx, vc.ID, actorID, "revoke", VerificationCaseApproved, VerificationCaseRevoked, reason)
+	})
+	if err == nil && s.OnDecision != nil {
+		s.OnDecision(revoked)
+	}
+	return revoked, err
+}
+
+// SweepOverdue 审核超过SLA的案件标记为升级，补充材料超时的案件自动驳回
+func (s *CompanyVerificationService) SweepOverdue() (escalated, expired int, err error) {
+	now := timeNow()
+	var late []CompanyVerificationCase
+	if err := s.db.Where("status IN ? AND escalated = ? AND due_at < ?",
+		[]string{VerificationCaseSubmitted, VerificationCaseInReview}, false, now).Find(&late).Error; err != nil {
+		return 0, 0, err
+	}
+	for _, vc := range late {
+		_, err := s.transition(vc.ID, func(tx *gorm.DB, locked *CompanyVerificationCase) error {
+			if locked.Escalated || locked.DueAt == nil || !locked.DueAt.Before(now) {
+				return nil
+			}
+			if err := s.update(tx, locked, map[string]interface{}{"escalated": true}); err != nil {
+				return err
+			}
+			escalated++
+			return s.recordEvent(tx, locked.ID, 0, "sla_breached", locked.Status, locked.Status, "审核超过SLA")
+		})
+		if err != nil {
+			return escalated, expired, err
+		}
+	}
+
+	var waiting []CompanyVerificationCase
+	if err := s.db.Where("status = ? AND response_due_at < ?", VerificationCaseNeedsInfo, now).Find(&waiting).Error; err != nil {
+		return escalated, expired, err
+	}
+	for _, vc := range waiting {
+		decided, err := s.transition(vc.ID, func(tx *gorm.DB, locked *CompanyVerificationCase) error {
+			if locked.Status != VerificationCaseNeedsInfo {
+				return nil
+			}
+			reason := "未在期限内补充材料"
+			if err := s.finish(tx, locked, VerificationCaseRejected, 0, reason); err != nil {
+				return err
+			}
+			expired++
+			return s.recordEvent(tx, locked.ID, 0, "expire", VerificationCaseNeedsInfo, VerificationCaseRejected, reason)
+		})
+		if err != nil {
+			return escalated, expired, err
+		}
+		if decided.Status == VerificationCaseRejected && s.OnDecision != nil {
+			s.OnDecision(decided)
+		}
+	}
+	return escalated, expired, nil
+}
+
+// VerificationBadge 企业的公开认证标识
+type VerificationBadge struct {
+	CompanyID         uint       `json:"company_id"`
+	Verified          bool       `json:"verified"`
+	VerificationLevel string     `json:"verification_level"`
+	VerifiedAt        *time.Time `json:"verified_at,omitempty"`
+	CanPostJobs       bool       `json:"can_post_jobs"`
+}
+
+// Badge 读取企业的认证标识
+func (s *CompanyVerificationService) Badge(companyID uint) (*VerificationBadge, error) {
+	var company EnhancedCompany
+	if err := s.db.Select("id", "verification_level", "status").First(&company, companyID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: 企业不存在", ErrVerificationNotFound)
+		}
+		return nil, err
+	}
+	badge := &VerificationBadge{CompanyID: companyID, VerificationLevel: company.VerificationLevel}
+	badge.Verified = isVerifiedLevel(company.VerificationLevel)
+	badge.CanPostJobs = badge.Verified && company.Status == string(StatusActive)
+	if badge.Verified {
+		var approved CompanyVerificationCase
+		if err := s.db.Select("decided_at").Where("company_id = ? AND status = ?", companyID, VerificationCaseApproved).
+			Order("id DESC").First(&approved).Error; err == nil {
+			badge.VerifiedAt = approved.DecidedAt
+		}
+	}
+	return badge, nil
+}
+
+// CanReview 用户是否可以作为审核员处理案件：系统管理员，且不是案件所属企业的成员
+func (s *CompanyVerificationService) CanReview(vc *CompanyVerificationCase, userID uint) bool {
+	var count int64
+	s.db.Model(&CompanyUser{}).Where("company_id = ? AND user_id = ? AND status = ?", vc.CompanyID, userID, "active").Count(&count)
+	if count > 0 || vc.SubmittedBy == userID {
+		return false
+	}
+	var company EnhancedCompany
+	if err := s.db.Select("created_by", "legal_rep_user_id").First(&company, vc.CompanyID).Error; err == nil {
+		return company.CreatedBy != userID && company.LegalRepUserID != userID
+	}
+	return true
+}
+
+// applyVerification 通过后把核验过的信息写回企业
+func (s *CompanyVerificationService) applyVerification(tx *gorm.DB, vc *CompanyVerificationCase) error {
+	var company EnhancedCompany
+	if err := tx.Select("id", "status", "verification_level").First(&company, vc.CompanyID).Error; err != nil {
+		return err
+	}
+	updates := map[string]interface{}{
+		"unified_social_credit_code": vc.CreditCode,
+		"legal_representative":       vc.LegalRepName,
+		"legal_representative_id":    vc.LegalRepIDNumber,
+		"updated_at":                 timeNow(),
+	}
+	// 已是高级认证的企业保留级别
+	if company.VerificationLevel != string(VerificationPremium) {
+		updates["verification_level"] = string(VerificationVerified)
+	}
+	if company.Status == string(StatusPending) {
+		updates["status"] = string(StatusActive)
+	}
+	return tx.Model(&EnhancedCompany{}).Where("id = ?", vc.CompanyID).Updates(updates).Error
+}
+
+func (s *CompanyVerificationService) finish(tx *gorm.DB, vc *CompanyVerificationCase, status string, actorID uint, reason string) error {
+	now := timeNow()
+	return s.update(tx, vc, map[string]interface{}{
+		"status":          status,
+		"decided_by":      actorID,
+		"decided_at":      now,
+		"decision_reason": reason,
+		"due_at":          nil,
+		"response_due_at": nil,
+	})
+}
+
+func (s *CompanyVerificationService) requireReviewer(vc *CompanyVerificationCase, reviewerID uint, status string) error {
+	if vc.Status != status {
+		return fmt.Errorf("%w: 案件状态为%s", ErrVerificationState, vc.Status)
+	}
+	if vc.ReviewerID == nil || *vc.ReviewerID != reviewerID {
+		return fmt.Errorf("%w: 案件未分配给当前审核员", ErrVerificationForbidden)
+	}
+	return nil
+}
+
+// transition 在事务中读取案件并处理，状态条件更新保证并发操作只有一个生效
+func (s *CompanyVerificationService) transition(caseID uint, fn func(tx *gorm.DB, vc *CompanyVerificationCase) error) (*CompanyVerificationCase, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		vc, err := s.find(tx, caseID)
+		if err != nil {
+			return err
+		}
+		return fn(tx, vc)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(caseID)
+}
+
+// update 按读取时的状态条件更新案件，状态已被并发修改时返回ErrVerificationState
+func (s *CompanyVerificationService) update(tx *gorm.DB, vc *CompanyVerificationCase, values map[string]interface{}) error {
+	values["updated_at"] = timeNow()
+	result := tx.Model(&CompanyVerificationCase{}).Where("id = ? AND status = ?", vc.ID, vc.Status).Updates(values)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: 案件已被并发修改", ErrVerificationState)
+	}
+	return nil
+}
+
+func (s *CompanyVerificationService) find(tx *gorm.DB, caseID uint) (*CompanyVerificationCase, error) {
+	var vc CompanyVerificationCase
+	if err := tx.Preload("Evidence").First(&vc, caseID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVerificationNotFound
+		}
+		return nil, err
+	}
+	return &vc, nil
+}
+
+func (s *CompanyVerificationService) recordEvent(tx *gorm.DB, caseID, actorID uint, action, from, to, comment string) error {
+	return tx.Create(&CompanyVerificationEvent{
+		CaseID:     caseID,
+		ActorID:    actorID,
+		Action:     action,
+		FromStatus: from,
+		ToStatus:   to,
+		Comment:    comment,
+		CreatedAt:  timeNow(),
+	}).Error
+}
+
+// missingAcceptedEvidence 返回没有被采纳材料的必需项
+func missingAcceptedEvidence(evidence []CompanyVerificationEvidence) []string {
+	accepted := make(map[string]bool)
+	for _, e := range evidence {
+		if e.Status == EvidenceAccepted {
+			accepted[e.Item] = true
+		}
+	}
+	var missing []string
+	for _, item := range requiredEvidenceItems {
+		if !accepted[item] {
+			missing = append(missing, item)
+		}
+	}
+	return missing
+}
+
+func isOpenVerificationStatus(status string) bool {
+	for _, s := range openVerificationStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func isVerifiedLevel(level string) bool {
+	return level == string(VerificationVerified) || level == string(VerificationPremium)
+}
+
+// 统一社会信用代码（GB 32100-2015）使用的字符集，不含I、O、Z、S、V
+const creditCodeCharset = "0123456789ABCDEFGHJKLMNPQRTUWXY"
+
+var creditCodeWeights = []int{1, 3, 9, 27, 19, 26, 16, 17, 20, 29, 25, 13, 8, 24, 10, 30, 28}
+
+// ValidateCreditCode 校验统一社会信用代码的格式和第18位校验码
+func ValidateCreditCode(code string) bool {
+	if !creditCodePattern.MatchString(code) {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 17; i++ {
+		sum += strings.IndexByte(creditCodeCharset, code[i]) * creditCodeWeights[i]
+	}
+	check := (31 - sum%31) % 31
+	return code[17] == creditCodeCharset[check]
+}
+
+var residentIDWeights = []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+
+// ValidateResidentID 校验18位居民身份证号（GB 11643-1999）的出生日期和校验码
+func ValidateResidentID(id string) bool {
+	if len(id) != 18 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 17; i++ {
+		if id[i] < '0' || id[i] > '9' {
+			return false
+		}
+		sum += int(id[i]-'0') * residentIDWeights[i]
+	}
+	birth, err := time.Parse("20060102", id[6:14])
+	if err != nil || birth.Year() < 1900 || birth.After(timeNow()) {
+		return false
+	}
+	return id[17] == "10X98765432"[sum%11]
+}
+
+// maskIDNumber 身份证号只保留前3位和后4位
+func maskIDNumber(id string) string {
+	if len(id) <= 7 {
+		return strings.Repeat("*", len(id))
+	}
+	return id[:3] + strings.Repeat("*", len(id)-7) + id[len(id)-4:]
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jobfirst/jobfirst-core"
+)
+
+// companyVerificationSweepInterval 超时案件检查间隔
+const companyVerificationSweepInterval = 5 * time.Minute
+
+// CompanyVerificationAPI 企业认证申请与审核API
+type CompanyVerificationAPI struct {
+	service           *CompanyVerificationService
+	permissionManager *CompanyPermissionManager
+}
+
+// NewCompanyVerificationAPI 创建企业认证API
+func NewCompanyVerificationAPI(service *CompanyVerificationService, permissionManager *CompanyPermissionManager) *CompanyVerificationAPI {
+	return &CompanyVerificationAPI{service: service, permissionManager: permissionManager}
+}
+
+// SetupCompanyVerificationRoutes 设置企业认证路由：申请方、审核员和公开认证标识
+func (api *CompanyVerificationAPI) SetupCompanyVerificationRoutes(r *gin.Engine, core *jobfirst.Core) {
+	// 企业用户提交和跟进认证申请
+	applicant := r.Group("/api/v1/company/verification")
+	applicant.Use(core.AuthMiddleware.RequireAuth())
+	{
+		applicant.POST("/companies/:company_id", api.submit)
+		applicant.GET("/companies/:company_id", api.listCompanyCases)
+		applicant.GET("/cases/:id", api.getCase)
+		applicant.GET("/cases/:id/events", api.getCaseEvents)
+		applicant.POST("/cases/:id/respond", api.respond)
+		applicant.POST("/cases/:id/withdraw", api.withdraw)
+	}
+
+	// 审核员队列，仅系统管理员
+	reviewer := r.Group("/api/v1/admin/company-verification")
+	reviewer.Use(core.AuthMiddleware.RequireAuth(), core.AuthMiddleware.RequireAdmin())
+	{
+		reviewer.GET("/queue", api.listQueue)
+		reviewer.POST("/queue/claim", api.claimNext)
+		reviewer.GET("/cases/:id", api.getCaseForReview)
+		reviewer.PUT("/cases/:id/assign", api.assign)
+		reviewer.POST("/cases/:id/request-info", api.requestInfo)
+		reviewer.PUT("/cases/:id/evidence/:evidence_id", api.reviewEvidence)
+		reviewer.POST("/cases/:id/decision", api.decide)
+		reviewer.POST("/companies/:company_id/revoke", api.revoke)
+	}
+
+	// 公开的认证标识
+	r.GET("/api/v1/company/public/companies/:id/verification", api.getBadge)
+}
+
+// submit 提交认证申请
+func (api *CompanyVerificationAPI) submit(c *gin.Context) {
+	companyID, userID, ok := verificationRequestContext(c, "company_id")
+	if !ok {
+		return
+	}
+	if !api.permissionManager.CheckCompanyAccess(userID, companyID, "submit_verification", c) {
+		return
+	}
+	var request VerificationSubmission
+	if err := c.ShouldBindJSON(&request); err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+
+	vc, err := api.service.Submit(companyID, userID, request)
+	if err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+	standardSuccessResponse(c, vc, "Verification submitted successfully")
+}
+
+// listCompanyCases 企业的认证案件
+func (api *CompanyVerificationAPI) listCompanyCases(c *gin.Context) {
+	companyID, userID, ok := verificationRequestContext(c, "company_id")
+	if !ok {
+		return
+	}
+	if !api.permissionManager.CheckCompanyAccess(userID, companyID, "view_verification", c) {
+		return
+	}
+	cases, err := api.service.ListCompanyCases(companyID)
+	if err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+	standardSuccessResponse(c, cases)
+}
+
+// getCase 申请方查看案件
+func (api *CompanyVerificationAPI) getCase(c *gin.Context) {
+	vc, _, ok := api.loadApplicantCase(c, "view_verification")
+	if !ok {
+		return
+	}
+	standardSuccessResponse(c, vc)
+}
+
+// getCaseEvents 案件处理记录
+func (api *CompanyVerificationAPI) getCaseEvents(c *gin.Context) {
+	vc, _, ok := api.loadApplicantCase(c, "view_verification")
+	if !ok {
+		return
+	}
+	events, err := api.service.ListEvents(vc.ID)
+	if err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+	standardSuccessResponse(c, events)
+}
+
+// respond 补充材料
+func (api *CompanyVerificationAPI) respond(c *gin.Context) {
+	vc, userID, ok := api.loadApplicantCase(c, "submit_verification")
+	if !ok {
+		return
+	}
+	var request struct {
+		Comment  string          `json:"comment"`
+		Evidence []EvidenceInput `json:"evidence"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+
+	updated, err := api.service.Respond(vc.ID, userID, request.Comment, request.Evidence)
+	if err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+	standardSuccessResponse(c, updated, "Information submitted successfully")
+}
+
+// withdraw 撤回认证申请
+func (api *CompanyVerificationAPI) withdraw(c *gin.Context) {
+	vc, userID, ok := api.loadApplicantCase(c, "submit_verification")
+	if !ok {
+		return
+	}
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	_ = c.ShouldBindJSON(&request)
+
+	updated, err := api.service.Withdraw(vc.ID, userID, request.Reason)
+	if err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+	standardSuccessResponse(c, updated, "Verification withdrawn successfully")
+}
+
+// listQueue 审核队列
+func (api *CompanyVerificationAPI) listQueue(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	filter := VerificationQueueFilter{
+		Status:     c.Query("status"),
+		Unassigned: c.Query("unassigned") == "true",
+		Overdue:    c.Query("overdue") == "true",
+	}
+	if c.Query("mine") == "true" {
+		filter.ReviewerID = c.MustGet("user_id").(uint)
+	}
+
+	cases, total, err := api.service.ListQueue(filter, (page-1)*pageSize, pageSize)
+	if err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+	standardSuccessResponse(c, gin.H{
+		"cases":     cases,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// claimNext 领取队列中最紧急的案件
+func (api *CompanyVerificationAPI) claimNext(c *gin.Context) {
+	reviewerID := c.MustGet("user_id").(uint)
+	vc, err := api.service.ClaimNext(reviewerID)
+	if err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+	standardSuccessResponse(c, vc, "Verification case claimed successfully")
+}
+
+// getCaseForReview 审核员查看案件
+func (api *CompanyVerificationAPI) getCaseForReview(c *gin.Context) {
+	caseID, _, ok := verificationRequestContext(c, "id")
+	if !ok {
+		return
+	}
+	vc, err := api.service.Get(caseID)
+	if err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+	events, err := api.service.ListEvents(caseID)
+	if err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+	standardSuccessResponse(c, gin.H{"case": vc, "events": events})
+}
+
+// assign 分配或改派审核员
+func (api *CompanyVerificationAPI) assign(c *gin.Context) {
+	caseID, actorID, ok := verificationRequestContext(c, "id")
+	if !ok {
+		return
+	}
+	var request struct {
+		ReviewerID uint `json:"reviewer_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	vc, err := api.service.Get(caseID)
+	if err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+	if !api.service.CanReview(vc, request.ReviewerID) {
+		standardErrorResponse(c, http.StatusForbidden, "Reviewer has a conflict of interest with this company")
+		return
+	}
+
+	updated, err := api.service.Assign(caseID, request.ReviewerID, actorID)
+	if err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+	standardSuccessResponse(c, updated, "Reviewer assigned successfully")
+}
+
+// requestInfo 要求申请方补充材料
+func (api *CompanyVerificationAPI) requestInfo(c *gin.Context) {
+	vc, reviewerID, ok := api.loadReviewerCase(c)
+	if !ok {
+		return
+	}
+	var request struct {
+		Comment string `json:"comment" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+
+	updated, err := api.service.RequestInfo(vc.ID, reviewerID, request.Comment)
+	if err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+	standardSuccessResponse(c, updated, "Information requested successfully")
+}
+
+// reviewEvidence 采纳或退回证明材料
+func (api *CompanyVerificationAPI) reviewEvidence(c *gin.Context) {
+	vc, reviewerID, ok := api.loadReviewerCase(c)
+	if !ok {
+		return
+	}
+	evidenceID, err := strconv.ParseUint(c.Param("evidence_id"), 10, 64)
+	if err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid evidence ID", c.Param("evidence_id"))
+		return
+	}
+	var request struct {
+		Status string `json:"status" binding:"required"`
+		Note   string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+
+	updated, err := api.service.ReviewEvidence(vc.ID, uint(evidenceID), reviewerID, request.Status, request.Note)
+	if err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+	standardSuccessResponse(c, updated, "Evidence reviewed successfully")
+}
+
+// decide 通过或驳回认证
+func (api *CompanyVerificationAPI) decide(c *gin.Context) {
+	vc, reviewerID, ok := api.loadReviewerCase(c)
+	if !ok {
+		return
+	}
+	var request struct {
+		Decision string `json:"decision" binding:"required,oneof=approve reject"`
+		Reason   string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+
+	updated, err := api.service.Decide(vc.ID, reviewerID, request.Decision == "approve", request.Reason)
+	if err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+	standardSuccessResponse(c, updated, "Verification decided successfully")
+}
+
+// revoke 撤销企业认证
+func (api *CompanyVerificationAPI) revoke(c *gin.Context) {
+	companyID, actorID, ok := verificationRequestContext(c, "company_id")
+	if !ok {
+		return
+	}
+	var request struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+
+	vc, err := api.service.Revoke(companyID, actorID, request.Reason)
+	if err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+	standardSuccessResponse(c, vc, "Verification revoked successfully")
+}
+
+// getBadge 企业认证标识
+func (api *CompanyVerificationAPI) getBadge(c *gin.Context) {
+	companyID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || companyID == 0 {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid company ID", c.Param("id"))
+		return
+	}
+	badge, err := api.service.Badge(uint(companyID))
+	if err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+	standardSuccessResponse(c, badge)
+}
+
+// loadApplicantCase 读取案件并检查当前用户对所属企业的权限
+func (api *CompanyVerificationAPI) loadApplicantCase(c *gin.Context, action string) (*CompanyVerificationCase, uint, bool) {
+	caseID, userID, ok := verificationRequestContext(c, "id")
+	if !ok {
+		return nil, 0, false
+	}
+	vc, err := api.service.Get(caseID)
+	if err != nil {
+		respondVerificationError(c, err)
+		return nil, 0, false
+	}
+	if !api.permissionManager.CheckCompanyAccess(userID, vc.CompanyID, action, c) {
+		return nil, 0, false
+	}
+	return vc, userID, true
+}
+
+// loadReviewerCase 读取案件并排除与企业有关联的审核员
+func (api *CompanyVerificationAPI) loadReviewerCase(c *gin.Context) (*CompanyVerificationCase, uint, bool) {
+	caseID, reviewerID, ok := verificationRequestContext(c, "id")
+	if !ok {
+		return nil, 0, false
+	}
+	vc, err := api.service.Get(caseID)
+	if err != nil {
+		respondVerificationError(c, err)
+		return nil, 0, false
+	}
+	if !api.service.CanReview(vc, reviewerID) {
+		standardErrorResponse(c, http.StatusForbidden, "Reviewer has a conflict of interest with this company")
+		return nil, 0, false
+	}
+	return vc, reviewerID, true
+}
+
+func verificationRequestContext(c *gin.Context, param string) (uint, uint, bool) {
+	id, err := strconv.ParseUint(c.Param(param), 10, 64)
+	if err != nil || id == 0 {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid ID", c.Param(param))
+		return 0, 0, false
+	}
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		standardErrorResponse(c, http.StatusUnauthorized, "User ID not found", "")
+		return 0, 0, false
+	}
+	return uint(id), userIDInterface.(uint), true
+}
+
+// respondVerificationError 将认证流程错误映射为HTTP状态码，自动校验失败时返回各项校验结果
+func respondVerificationError(c *gin.Context, err error) {
+	var checkErr *VerificationCheckError
+	switch {
+	case errors.As(err, &checkErr):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"success": false,
+			"error":   "Verification checks failed",
+			"details": err.Error(),
+			"checks":  checkErr.Checks,
+			"service": "company-service",
+			"time":    time.Now().Format(time.RFC3339),
+		})
+	case errors.Is(err, ErrVerificationNotFound):
+		standardErrorResponse(c, http.StatusNotFound, "Verification case not found", err.Error())
+	case errors.Is(err, ErrVerificationQueueIdle):
+		standardErrorResponse(c, http.StatusNotFound, "No verification case waiting for review", err.Error())
+	case errors.Is(err, ErrVerificationForbidden):
+		standardErrorResponse(c, http.StatusForbidden, "No permission for this verification case", err.Error())
+	case errors.Is(err, ErrVerificationState):
+		standardErrorResponse(c, http.StatusConflict, "Verification state conflict", err.Error())
+	case errors.Is(err, ErrVerificationInvalid):
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid verification request", err.Error())
+	default:
+		standardErrorResponse(c, http.StatusInternalServerError, "Verification operation failed", err.Error())
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	testCreditCode = "91440300MA5D8Y7K17"
+	testLegalRepID = "44030419900307123X"
+)
+
+func newTestVerificationService(t *testing.T) (*CompanyVerificationService, *gorm.DB, *time.Time) {
+	t.Helper()
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&CompanyDocument{}, &CompanyUser{}); err != nil {
+		t.Fatal(err)
+	}
+	// 1为待认证企业，2为另一家企业
+	pending := testCompany()
+	pending.Status, pending.VerificationLevel = "pending", "unverified"
+	createTestCompanies(t, db, pending,
+		EnhancedCompany{ID: 2, Name: "北京远航物流", UnifiedSocialCreditCode: "pending-2", Status: "active", VerificationLevel: "unverified", CreatedBy: 20})
+	for i, companyID := range []uint{1, 1, 2} {
+		doc := CompanyDocument{ID: uint(i + 1), CompanyID: companyID, UserID: 10, Title: "证明材料", OriginalFile: "scan.pdf",
+			FileContent: "x", FileType: "pdf", FileSize: 1, UploadTime: time.Now()}
+		if err := db.Create(&doc).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	service := NewCompanyVerificationService(db, CompanyVerificationConfig{ReviewSLA: 48 * time.Hour, ResponseSLA: 7 * 24 * time.Hour})
+	if err := service.AutoMigrate(); err != nil {
+		t.Fatal(err)
+	}
+	return service, db, useTestClock(t)
+}
+
+func testSubmission() VerificationSubmission {
+	return VerificationSubmission{
+		CreditCode:       testCreditCode,
+		LegalRepName:     "张三",
+		LegalRepIDNumber: testLegalRepID,
+		Evidence: []EvidenceInput{
+			{Item: EvidenceBusinessLicense, DocumentID: 1},
+			{Item: EvidenceLegalRepIdentity, DocumentID: 2},
+		},
+	}
+}
+
+func TestVerificationChecksums(t *testing.T) {
+	for code, want := range map[string]bool{
+		"91440300MA5D8Y7K17": true,
+		"91110108551385082Q": true,
+		"91110108551385082X": false, // 校验位错误
+		"91440300MA5D8Y7K1":  false,
+		"9144030OMA5D8Y7K17": false, // 字符集不含O
+	} {
+		if got := ValidateCreditCode(code); got != want {
+			t.Errorf("ValidateCreditCode(%s) = %v, want %v", code, got, want)
+		}
+	}
+	for id, want := range map[string]bool{
+		"11010519491231002X": true,
+		"44030419900307123X": true,
+		"440304199003071231": false, // 校验位错误
+		"11010519490231002X": false, // 2月31日
+	} {
+		if got := ValidateResidentID(id); got != want {
+			t.Errorf("ValidateResidentID(%s) = %v, want %v", id, got, want)
+		}
+	}
+	if got := maskIDNumber(testLegalRepID); got != "440***********123X" {
+		t.Errorf("maskIDNumber = %s", got)
+	}
+}
+
+func TestVerificationSubmitRejectsFailedChecks(t *testing.T) {
+	service, db, _ := newTestVerificationService(t)
+
+	bad := testSubmission()
+	bad.CreditCode = "91110108551385082X"
+	bad.Evidence = bad.Evidence[:1]
+	_, err := service.Submit(1, 10, bad)
+	var checkErr *VerificationCheckError
+	if !errors.As(err, &checkErr) {
+		t.Fatalf("got %v, want VerificationCheckError", err)
+	}
+	failed := map[string]bool{}
+	for _, check := range checkErr.Checks {
+		if !check.Passed {
+			failed[check.Name] = true
+		}
+	}
+	if len(failed) != 2 || !failed["credit_code_checksum"] || !failed["required_evidence"] {
+		t.Fatalf("failed checks = %v", failed)
+	}
+
+	// 其他企业的文档不能作为证明材料
+	foreign := testSubmission()
+	foreign.Evidence[1].DocumentID = 3
+	if _, err := service.Submit(1, 10, foreign); !errors.Is(err, ErrVerificationInvalid) {
+		t.Fatalf("got %v, want ErrVerificationInvalid", err)
+	}
+
+	// 信用代码已被其他已认证企业使用
+	db.Model(&EnhancedCompany{}).Where("id = 2").Updates(map[string]interface{}{
+		"unified_social_credit_code": testCreditCode, "verification_level": "verified"})
+	if _, err := service.Submit(1, 10, testSubmission()); !errors.As(err, &checkErr) {
+		t.Fatalf("got %v, want VerificationCheckError", err)
+	}
+
+	var count int64
+	db.Model(&CompanyVerificationCase{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("cases = %d, want none", count)
+	}
+}
+
+func TestVerificationReviewFlow(t *testing.T) {
+	service, db, now := newTestVerificationService(t)
+	var decided []uint
+	service.OnDecision = func(vc *CompanyVerificationCase) { decided = append(decided, vc.ID) }
+
+	vc, err := service.Submit(1, 10, testSubmission())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vc.Status != VerificationCaseSubmitted || len(vc.Evidence) != 2 || vc.LegalRepIDMasked != "440***********123X" {
+		t.Fatalf("case = %+v", vc)
+	}
+	if _, err := service.Submit(1, 10, testSubmission()); !errors.Is(err, ErrVerificationState) {
+		t.Fatalf("got %v, want ErrVerificationState for second open case", err)
+	}
+
+	claimed, err := service.ClaimNext(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed.ID != vc.ID || claimed.Status != VerificationCaseInReview || *claimed.ReviewerID != 100 {
+		t.Fatalf("claimed = %+v", claimed)
+	}
+	if _, err := service.ClaimNext(101); !errors.Is(err, ErrVerificationQueueIdle) {
+		t.Fatalf("got %v, want ErrVerificationQueueIdle", err)
+	}
+	if _, err := service.RequestInfo(vc.ID, 101, "请补充"); !errors.Is(err, ErrVerificationForbidden) {
+		t.Fatalf("got %v, want ErrVerificationForbidden", err)
+	}
+
+	// 营业执照不清晰，要求补充
+	license := claimed.Evidence[0]
+	if _, err := service.ReviewEvidence(vc.ID, license.ID, 100, EvidenceRejected, "扫描件模糊"); err != nil {
+		t.Fatal(err)
+	}
+	waiting, err := service.RequestInfo(vc.ID, 100, "请上传清晰的营业执照")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if waiting.Status != VerificationCaseNeedsInfo || waiting.DueAt != nil || waiting.ResponseDueAt == nil {
+		t.Fatalf("waiting = %+v", waiting)
+	}
+
+	*now = now.Add(24 * time.Hour)
+	reopened, err := service.Respond(vc.ID, 10, "已重新上传", []EvidenceInput{{Item: EvidenceBusinessLicense, DocumentID: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Status != VerificationCaseInReview || reopened.InfoRounds != 1 || len(reopened.Evidence) != 3 ||
+		!reopened.DueAt.Equal(now.Add(48*time.Hour)) {
+		t.Fatalf("reopened = %+v", reopened)
+	}
+
+	if _, err := service.Decide(vc.ID, 100, true, ""); !errors.Is(err, ErrVerificationState) {
+		t.Fatalf("got %v, want approval blocked until evidence is accepted", err)
+	}
+	for _, e := range reopened.Evidence {
+		if e.Status == EvidencePending {
+			if _, err := service.ReviewEvidence(vc.ID, e.ID, 100, EvidenceAccepted, ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	approved, err := service.Decide(vc.ID, 100, true, "材料齐全")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approved.Status != VerificationCaseApproved || approved.DecidedAt == nil || len(decided) != 1 {
+		t.Fatalf("approved = %+v, decided = %v", approved, decided)
+	}
+
+	var company EnhancedCompany
+	db.First(&company, 1)
+	if company.VerificationLevel != "verified" || company.Status != "active" ||
+		company.UnifiedSocialCreditCode != testCreditCode || company.LegalRepresentative != "张三" {
+		t.Fatalf("company = %+v", company)
+	}
+	badge, err := service.Badge(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !badge.Verified || !badge.CanPostJobs || badge.VerifiedAt == nil {
+		t.Fatalf("badge = %+v", badge)
+	}
+
+	if _, err := service.Revoke(1, 1, "营业执照已吊销"); err != nil {
+		t.Fatal(err)
+	}
+	badge, _ = service.Badge(1)
+	if badge.Verified || badge.CanPostJobs {
+		t.Fatalf("badge after revoke = %+v", badge)
+	}
+
+	events, _ := service.ListEvents(vc.ID)
+	var actions []string
+	for _, e := range events {
+		actions = append(actions, e.Action)
+	}
+	want := []string{"submit", "assign", "review_evidence", "request_info", "respond", "review_evidence", "review_evidence", "approve", "revoke"}
+	if len(actions) != len(want) {
+		t.Fatalf("actions = %v, want %v", actions, want)
+	}
+	for i := range want {
+		if actions[i] != want[i] {
+			t.Fatalf("actions = %v, want %v", actions, want)
+		}
+	}
+}
+
+func TestVerificationSLASweep(t *testing.T) {
+	service, db, now := newTestVerificationService(t)
+	first, err := service.Submit(1, 10, testSubmission())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := testSubmission()
+	second.CreditCode = "91110108551385082Q"
+	second.Evidence = []EvidenceInput{{Item: EvidenceBusinessLicense, DocumentID: 3}, {Item: EvidenceLegalRepIdentity, DocumentID: 3}}
+	*now = now.Add(time.Hour)
+	if _, err := service.Submit(2, 20, second); err != nil {
+		t.Fatal(err)
+	}
+
+	// 第一个案件超过审核SLA后排到队首
+	*now = now.Add(48 * time.Hour)
+	escalated, expired, err := service.SweepOverdue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if escalated != 1 || expired != 0 {
+		t.Fatalf("escalated = %d, expired = %d", escalated, expired)
+	}
+	if escalated, _, _ := service.SweepOverdue(); escalated != 0 {
+		t.Fatal("case escalated twice")
+	}
+	queue, total, err := service.ListQueue(VerificationQueueFilter{}, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || queue[0].ID != first.ID || !queue[0].Escalated {
+		t.Fatalf("queue = %+v", queue)
+	}
+
+	// 申请方超时未补充材料自动驳回
+	if _, err := service.ClaimNext(100); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.RequestInfo(first.ID, 100, "请补充法定代表人身份证明"); err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(8 * 24 * time.Hour)
+	_, expired, err = service.SweepOverdue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired != 1 {
+		t.Fatalf("expired = %d, want 1", expired)
+	}
+	rejected, _ := service.Get(first.ID)
+	if rejected.Status != VerificationCaseRejected || rejected.DecisionReason == "" {
+		t.Fatalf("rejected = %+v", rejected)
+	}
+	var company EnhancedCompany
+	db.First(&company, 1)
+	if company.VerificationLevel != "unverified" {
+		t.Fatalf("verification_level = %s", company.VerificationLevel)
+	}
+}
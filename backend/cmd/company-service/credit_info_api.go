@@ -1,8 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -11,28 +15,51 @@ import (
 
 // CreditInfoAPI 企业信用信息API
 type CreditInfoAPI struct {
-	core   *jobfirst.Core
-	client *CreditInfoClient
+	core    *jobfirst.Core
+	client  *CreditInfoClient
+	gateway *CreditInfoGateway
 }
 
-// NewCreditInfoAPI 创建企业信用信息API
+// NewCreditInfoAPI 创建企业信用信息API。
+// 接口地址和凭据可通过CREDIT_INFO_*环境变量覆盖；CREDIT_INFO_PROVIDER=standin时使用本地替身，便于离线开发
 func NewCreditInfoAPI(core *jobfirst.Core) *CreditInfoAPI {
 	// 使用默认配置
 	client := NewCreditInfoClient(
-		"https://apitest.szscredit.com:8443/public_apis/common_api",
-		"szc_zhangxx",
-		"123456",
-		"8Of0L+PjmIm5FPJn",
-		"MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAhLtBso+Hy6PEaGpA4Txkb6PA03dLUSlXHXV3bdjX1ilZ3re/O6JPinrhxaxsjjqliEqOc/qehNbzde4WKb9FRlnMwWwZReTruVCZNa9eNCLi+BzLcFYl9jO9QNP/Y+uS6P9ozDqmgux47GrbK7/0bIhhgRdXsegGvUp9z5VNiF/5OijDE5lrQcYzSIrPy8YiaDNkS0SZ7JQ24+wFe8fOYRWcIxzYbn5gl6U14JsxIjvnFVKWYBGMh4cfjIVv22M7tVxt52TNEcB0XEWbCcTLQQluf9c2ZGXSe5jyfMZSa4Z5e6mYG8NlywdwSBIRtM4r9WuzEkWrMxfns/sQ9sbF/wIDAQAB",
-		"MIIEvAIBADANBgkqhkiG9w0BAQEFAASCBKYwggSiAgEAAoIBAQCEu0Gyj4fLo8RoakDhPGRvo8DTd0tRKVcddXdt2NfWKVnet787ok+KeuHFrGyOOqWISo5z+p6E1vN17hYpv0VGWczBbBlF5Ou5UJk1r140IuL4HMtwViX2M71A0/9j65Lo/2jMOqaC7Hjsatsrv/RsiGGBF1ex6Aa9Sn3PlU2IX/k6KMMTmWtBxjNIis/LxiJoM2RLRJnslDbj7AV7x85hFZwjHNhufmCXpTXgmzEiO+cVUpZgEYyHhx+MhW/bYzu1XG3nZM0RwHRcRZsJxMtBCW5/1zZkZdJ7mPJ8xlJrhnl7qZgbw2XLB3BIEhG0ziv1a7MSRaszF+ez+xD2xsX/AgMBAAECggEAQAu3RLjbNpjcIeH7UnN4pyHl3mP2tL/06CMRMLDsXMtxMPWK0fSc2t42aNKtQufrjdsj57Srnr+1lFcA3L4NaEfWdBJ8E2zFjZLlirEHDLM0v7HtPFRlVupaTJi+5/D433K2l61JQW1nX/SjsvWZtHEOU2L3DsI91kLGeE67raynlzI0EB0DD2oo3GYoJHiyioQojPjV6hSMHCq6yOcvCxG0q00/fPnZxiyNKJ7gBSuZLwfxqlwp4UQ01wcVDnPQYBhhxjzYPDWGUAPgExLCOngxxjLXAt2mh571YE+d4yQnlhIoY3/UQ7uYScioIWUetTXNxC4AwBzS2VzuTLCMwQKBgQDBP4eUjfRJ7L4fiYqYCDuQj/UA/DIWYeJV3zJIoMIY6rs4OnOuJUi6+WXszOGMUpitF1mdHsZGWzt5D8TXzcqP84X4jSPLaKv4z5j/hZmE+QvWmcmVA//IUwQLXRPCfb3eT6mTZF1B/cDtM7TU2GGvo4L+NJKQUKpwGjNhGf1VXwKBgQCv1Q10i2JRU3/vXGg7HDgke4m07OWHXQykjF93cuRKpE3xE23oo4bi07sPn29StRqjdivvvZNadvNJ2Z1vYKwRnztibbwHLlsour5V67fjhAv4APURO5NSbovHhG2lCyUrvLsyKJQhrzXaAS26CAHaP3au8LnCjg+iT3VLg+izYQKBgE/lCxHA6qmRhj0VqUYXyUCIM9v3aGHWkDO+dlSOmhChI0wo5mCuK3aZ26jeP7W7BEIzsCoEaib2Ww0/Fru96iw/mzjaaV0UZl0UvwWNX54ZNOrBZBUGtT5GDBsCnUPAprn9p3c3fFLnLVckFHQXDbQG3wZoB9xAbWaxfmJ70z/zAoGAWVFlq10ejWdYJrQPMm+sSUQD+McZ9YAb6v5vhFL1isEZ4qtW+oUPAOxDKrV3rFDY/k4KFZd8Ycjo3wvPQIOgBLeZR++sQw2WOwNZqnW6DLXICqwZ0S4tMQN8t9YaiGs375bIlLsuPEovldVhcA2fO0lftZANHLpjULUCRWD1dSECgYBF+rfCsXno9qSTle5d7t2HAERM4RvIvtHhZm/prJ1pwSJSrxdcGzdskWFzI8EANf9rCm+MKiQo1s4Yye122hfU0kJSG0XBRXmh55cZUIkB/0I5MtqZTK4ktbqlb4Z6m57iO+Oydh6A2rWS0KPjMq7BujjeulVBXCpbEuoMwzTh+w==",
+		envOrDefault("CREDIT_INFO_BASE_URL", "https://apitest.szscredit.com:8443/public_apis/common_api"),
+		envOrDefault("CREDIT_INFO_USERNAME", "szc_zhangxx"),
+		envOrDefault("CREDIT_INFO_PASSWORD", "123456"),
+		envOrDefault("CREDIT_INFO_AES_KEY", "8Of0L+PjmIm5FPJn"),
+		envOrDefault("CREDIT_INFO_RSA_PUBLIC_KEY", "MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAhLtBso+Hy6PEaGpA4Txkb6PA03dLUSlXHXV3bdjX1ilZ3re/O6JPinrhxaxsjjqliEqOc/qehNbzde4WKb9FRlnMwWwZReTruVCZNa9eNCLi+BzLcFYl9jO9QNP/Y+uS6P9ozDqmgux47GrbK7/0bIhhgRdXsegGvUp9z5VNiF/5OijDE5lrQcYzSIrPy8YiaDNkS0SZ7JQ24+wFe8fOYRWcIxzYbn5gl6U14JsxIjvnFVKWYBGMh4cfjIVv22M7tVxt52TNEcB0XEWbCcTLQQluf9c2ZGXSe5jyfMZSa4Z5e6mYG8NlywdwSBIRtM4r9WuzEkWrMxfns/sQ9sbF/wIDAQAB"),
+		envOrDefault("CREDIT_INFO_RSA_PRIVATE_KEY", "MIIEvAIBADANBgkqhkiG9w0BAQEFAASCBKYwggSiAgEAAoIBAQCEu0Gyj4fLo8RoakDhPGRvo8DTd0tRKVcddXdt2NfWKVnet787ok+KeuHFrGyOOqWISo5z+p6E1vN17hYpv0VGWczBbBlF5Ou5UJk1r140IuL4HMtwViX2M71A0/9j65Lo/2jMOqaC7Hjsatsrv/RsiGGBF1ex6Aa9Sn3PlU2IX/k6KMMTmWtBxjNIis/LxiJoM2RLRJnslDbj7AV7x85hFZwjHNhufmCXpTXgmzEiO+cVUpZgEYyHhx+MhW/bYzu1XG3nZM0RwHRcRZsJxMtBCW5/1zZkZdJ7mPJ8xlJrhnl7qZgbw2XLB3BIEhG0ziv1a7MSRaszF+ez+xD2xsX/AgMBAAECggEAQAu3RLjbNpjcIeH7UnN4pyHl3mP2tL/06CMRMLDsXMtxMPWK0fSc2t42aNKtQufrjdsj57Srnr+1lFcA3L4NaEfWdBJ8E2zFjZLlirEHDLM0v7HtPFRlVupaTJi+5/D433K2l61JQW1nX/SjsvWZtHEOU2L3DsI91kLGeE67raynlzI0EB0DD2oo3GYoJHiyioQojPjV6hSMHCq6yOcvCxG0q00/fPnZxiyNKJ7gBSuZLwfxqlwp4UQ01wcVDnPQYBhhxjzYPDWGUAPgExLCOngxxjLXAt2mh571YE+d4yQnlhIoY3/UQ7uYScioIWUetTXNxC4AwBzS2VzuTLCMwQKBgQDBP4eUjfRJ7L4fiYqYCDuQj/UA/DIWYeJV3zJIoMIY6rs4OnOuJUi6+WXszOGMUpitF1mdHsZGWzt5D8TXzcqP84X4jSPLaKv4z5j/hZmE+QvWmcmVA//IUwQLXRPCfb3eT6mTZF1B/cDtM7TU2GGvo4L+NJKQUKpwGjNhGf1VXwKBgQCv1Q10i2JRU3/vXGg7HDgke4m07OWHXQykjF93cuRKpE3xE23oo4bi07sPn29StRqjdivvvZNadvNJ2Z1vYKwRnztibbwHLlsour5V67fjhAv4APURO5NSbovHhG2lCyUrvLsyKJQhrzXaAS26CAHaP3au8LnCjg+iT3VLg+izYQKBgE/lCxHA6qmRhj0VqUYXyUCIM9v3aGHWkDO+dlSOmhChI0wo5mCuK3aZ26jeP7W7BEIzsCoEaib2Ww0/Fru96iw/mzjaaV0UZl0UvwWNX54ZNOrBZBUGtT5GDBsCnUPAprn9p3c3fFLnLVckFHQXDbQG3wZoB9xAbWaxfmJ70z/zAoGAWVFlq10ejWdYJrQPMm+sSUQD+McZ9YAb6v5vhFL1isEZ4qtW+oUPAOxDKrV3rFDY/k4KFZd8Ycjo3wvPQIOgBLeZR++sQw2WOwNZqnW6DLXICqwZ0S4tMQN8t9YaiGs375bIlLsuPEovldVhcA2fO0lftZANHLpjULUCRWD1dSECgYBF+rfCsXno9qSTle5d7t2HAERM4RvIvtHhZm/prJ1pwSJSrxdcGzdskWFzI8EANf9rCm+MKiQo1s4Yye122hfU0kJSG0XBRXmh55cZUIkB/0I5MtqZTK4ktbqlb4Z6m57iO+Oydh6A2rWS0KPjMq7BujjeulVBXCpbEuoMwzTh+w=="),
 	)
+	if os.Getenv("CREDIT_INFO_PROVIDER") == "standin" {
+		standIn, err := NewCreditInfoStandIn(defaultStandInCreditRecords())
+		if err != nil {
+			log.Fatalf("启动信用信息替身服务失败: %v", err)
+		}
+		log.Printf("信用信息查询使用本地替身: %s", standIn.Server.URL)
+		client = standIn.Client(client.AESKey)
+	}
+
+	gateway := NewCreditInfoGateway(core.GetDB(), client, DefaultCreditInfoGatewayConfig())
+	if err := gateway.AutoMigrate(); err != nil {
+		log.Printf("信用信息网关数据表迁移失败: %v", err)
+	}
 
 	return &CreditInfoAPI{
-		core:   core,
-		client: client,
+		core:    core,
+		client:  client,
+		gateway: gateway,
 	}
 }
 
+func envOrDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
 // SetupCreditInfoRoutes 设置企业信用信息API路由
 func (api *CreditInfoAPI) SetupCreditInfoRoutes(r *gin.Engine) {
 	// 需要认证的信用信息API路由
@@ -54,7 +81,74 @@ func (api *CreditInfoAPI) SetupCreditInfoRoutes(r *gin.Engine) {
 
 		// 批量查询企业信用信息
 		credit.POST("/batch", api.getBatchCompanyCreditInfo)
+
+		// 当前租户的查询量和费用
+		credit.GET("/usage", api.getCreditUsage)
+
+		// 管理员：查询台账、费用汇总和风险预警
+		admin := credit.Group("", api.core.AuthMiddleware.RequireAdmin())
+		admin.GET("/ledger", api.listCreditLedger)
+		admin.GET("/ledger/summary", api.getCreditSpendSummary)
+		admin.GET("/alerts", api.listCreditAlerts)
+		admin.POST("/alerts/:id/ack", api.acknowledgeCreditAlert)
+	}
+}
+
+// lookup 通过网关查询，失败时写入错误响应并返回false
+func (api *CreditInfoAPI) lookup(c *gin.Context, companyName, companyCode string, refresh bool, failure string) (*CreditLookupResult, bool) {
+	userID, _ := c.Get("user_id")
+	uid, _ := userID.(uint)
+	result, err := api.gateway.Lookup(c.Request.Context(), CreditLookup{
+		CompanyName: companyName,
+		CompanyCode: companyCode,
+		TenantID:    api.creditTenant(c, uid),
+		UserID:      uid,
+		Refresh:     refresh,
+	})
+	if err == nil {
+		return result, true
+	}
+
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrCreditRateLimited):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, ErrCreditLookupInvalid):
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{
+		"status":  "error",
+		"message": failure,
+		"error":   err.Error(),
+	})
+	return nil, false
+}
+
+// creditTenant 查询限额和费用归属的租户：X-Company-ID指定的企业（用户须为该企业的有效成员，管理员不限），
+// 否则为用户所属的第一个企业，都没有时归属到用户本人
+func (api *CreditInfoAPI) creditTenant(c *gin.Context, userID uint) string {
+	role := c.GetString("role")
+	if header := c.GetHeader("X-Company-ID"); header != "" {
+		if companyID, err := strconv.ParseUint(header, 10, 64); err == nil {
+			if role == "admin" || role == "super_admin" {
+				return fmt.Sprintf("company:%d", companyID)
+			}
+			var count int64
+			api.core.GetDB().Model(&CompanyUser{}).
+				Where("company_id = ? AND user_id = ? AND status = ?", companyID, userID, "active").
+				Count(&count)
+			if count > 0 {
+				return fmt.Sprintf("company:%d", companyID)
+			}
+		}
+	}
+	var membership CompanyUser
+	err := api.core.GetDB().Where("user_id = ? AND status = ?", userID, "active").
+		Order("id").Take(&membership).Error
+	if err == nil {
+		return fmt.Sprintf("company:%d", membership.CompanyID)
 	}
+	return fmt.Sprintf("user:%d", userID)
 }
 
 // getCompanyCreditInfo 获取企业信用信息
@@ -62,6 +156,7 @@ func (api *CreditInfoAPI) getCompanyCreditInfo(c *gin.Context) {
 	var req struct {
 		CompanyName string `json:"company_name" binding:"required"`
 		CompanyCode string `json:"company_code,omitempty"`
+		Refresh     bool   `json:"refresh,omitempty"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -73,24 +168,15 @@ func (api *CreditInfoAPI) getCompanyCreditInfo(c *gin.Context) {
 		return
 	}
 
-	// 调用信用信息查询API (如果外部API失败，使用数据库中的模拟数据)
-	creditInfo, err := api.client.GetCompanyCreditInfo(req.CompanyName, req.CompanyCode)
-	if err != nil {
-		// 外部API失败时，从数据库获取模拟数据
-		creditInfo = api.getMockCreditInfo(req.CompanyName)
-		if creditInfo == nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  "error",
-				"message": "获取企业信用信息失败",
-				"error":   err.Error(),
-			})
-			return
-		}
+	result, ok := api.lookup(c, req.CompanyName, req.CompanyCode, req.Refresh, "获取企业信用信息失败")
+	if !ok {
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
-		"data":    creditInfo,
+		"data":    result.Info,
+		"source":  result.Source,
 		"message": "企业信用信息获取成功",
 	})
 }
@@ -106,20 +192,11 @@ func (api *CreditInfoAPI) getCompanyCreditRating(c *gin.Context) {
 		return
 	}
 
-	// 调用信用信息查询API (如果外部API失败，使用数据库中的模拟数据)
-	creditInfo, err := api.client.GetCompanyCreditInfo(companyName, "")
-	if err != nil {
-		// 外部API失败时，从数据库获取模拟数据
-		creditInfo = api.getMockCreditInfo(companyName)
-		if creditInfo == nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  "error",
-				"message": "获取企业信用评级失败",
-				"error":   err.Error(),
-			})
-			return
-		}
+	result, ok := api.lookup(c, companyName, c.Query("company_code"), c.Query("refresh") == "true", "获取企业信用评级失败")
+	if !ok {
+		return
 	}
+	creditInfo := result.Info
 
 	c.JSON(http.StatusOK, gin.H{
 		"status": "success",
@@ -130,6 +207,7 @@ func (api *CreditInfoAPI) getCompanyCreditRating(c *gin.Context) {
 			"risk_level":   creditInfo.RiskLevel,
 			"last_updated": creditInfo.LastUpdated,
 		},
+		"source":  result.Source,
 		"message": "企业信用评级获取成功",
 	})
 }
@@ -145,20 +223,11 @@ func (api *CreditInfoAPI) getCompanyRiskInfo(c *gin.Context) {
 		return
 	}
 
-	// 调用信用信息查询API (如果外部API失败，使用数据库中的模拟数据)
-	creditInfo, err := api.client.GetCompanyCreditInfo(companyName, "")
-	if err != nil {
-		// 外部API失败时，从数据库获取模拟数据
-		creditInfo = api.getMockCreditInfo(companyName)
-		if creditInfo == nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  "error",
-				"message": "获取企业风险信息失败",
-				"error":   err.Error(),
-			})
-			return
-		}
+	result, ok := api.lookup(c, companyName, c.Query("company_code"), c.Query("refresh") == "true", "获取企业风险信息失败")
+	if !ok {
+		return
 	}
+	creditInfo := result.Info
 
 	c.JSON(http.StatusOK, gin.H{
 		"status": "success",
@@ -169,6 +238,7 @@ func (api *CreditInfoAPI) getCompanyRiskInfo(c *gin.Context) {
 			"business_status": creditInfo.BusinessStatus,
 			"last_updated":    creditInfo.LastUpdated,
 		},
+		"source":  result.Source,
 		"message": "企业风险信息获取成功",
 	})
 }
@@ -184,20 +254,11 @@ func (api *CreditInfoAPI) getCompanyComplianceStatus(c *gin.Context) {
 		return
 	}
 
-	// 调用信用信息查询API (如果外部API失败，使用数据库中的模拟数据)
-	creditInfo, err := api.client.GetCompanyCreditInfo(companyName, "")
-	if err != nil {
-		// 外部API失败时，从数据库获取模拟数据
-		creditInfo = api.getMockCreditInfo(companyName)
-		if creditInfo == nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  "error",
-				"message": "获取企业合规状态失败",
-				"error":   err.Error(),
-			})
-			return
-		}
+	result, ok := api.lookup(c, companyName, c.Query("company_code"), c.Query("refresh") == "true", "获取企业合规状态失败")
+	if !ok {
+		return
 	}
+	creditInfo := result.Info
 
 	c.JSON(http.StatusOK, gin.H{
 		"status": "success",
@@ -207,6 +268,7 @@ func (api *CreditInfoAPI) getCompanyComplianceStatus(c *gin.Context) {
 			"compliance_items":  creditInfo.ComplianceItems,
 			"last_updated":      creditInfo.LastUpdated,
 		},
+		"source":  result.Source,
 		"message": "企业合规状态获取成功",
 	})
 }
@@ -245,21 +307,32 @@ func (api *CreditInfoAPI) getBatchCompanyCreditInfo(c *gin.Context) {
 		return
 	}
 
+	userID, _ := c.Get("user_id")
+	uid, _ := userID.(uint)
+	tenant := api.creditTenant(c, uid)
+
 	// 批量查询企业信用信息
 	var results []gin.H
 	var errors []string
 
 	for _, company := range req.Companies {
-		creditInfo, err := api.client.GetCompanyCreditInfo(company.CompanyName, company.CompanyCode)
+		result, err := api.gateway.Lookup(c.Request.Context(), CreditLookup{
+			CompanyName: company.CompanyName,
+			CompanyCode: company.CompanyCode,
+			TenantID:    tenant,
+			UserID:      uid,
+		})
 		if err != nil {
 			errors = append(errors, fmt.Sprintf("查询企业 %s 失败: %v", company.CompanyName, err))
 			continue
 		}
+		creditInfo := result.Info
 		results = append(results, gin.H{
 			"company_name": creditInfo.CompanyName,
 			"credit_level": creditInfo.CreditLevel,
 			"risk_level":   creditInfo.RiskLevel,
 			"status":       creditInfo.ComplianceStatus,
+			"source":       result.Source,
 		})
 	}
 
@@ -274,96 +347,188 @@ func (api *CreditInfoAPI) getBatchCompanyCreditInfo(c *gin.Context) {
 	})
 }
 
-// getMockCreditInfo 获取模拟信用信息数据
-func (api *CreditInfoAPI) getMockCreditInfo(companyName string) *CreditInfo {
-	// 模拟数据映射
-	mockData := map[string]*CreditInfo{
-		"腾讯科技(深圳)有限公司": {
-			CompanyName:       "腾讯科技(深圳)有限公司",
-			CompanyCode:       "91440300708461136T",
-			CreditLevel:       "AAA",
-			RiskLevel:         "低风险",
-			ComplianceStatus:  "合规",
-			BusinessStatus:    "存续",
-			LegalPerson:       "马化腾",
-			RegisteredCapital: "2000000万元",
-			FoundedDate:       "1998-11-11",
-			Industry:          "互联网",
-			Address:           "深圳市南山区",
-			LastUpdated:       time.Now(),
-			RiskFactors:       []string{},
-			CreditScore:       95,
-			ComplianceItems:   []string{"税务合规", "工商合规", "劳动合规"},
-		},
-		"阿里巴巴集团控股有限公司": {
-			CompanyName:       "阿里巴巴集团控股有限公司",
-			CompanyCode:       "91330100MA27XN3X8N",
-			CreditLevel:       "AAA",
-			RiskLevel:         "低风险",
-			ComplianceStatus:  "合规",
-			BusinessStatus:    "存续",
-			LegalPerson:       "张勇",
-			RegisteredCapital: "1000000万元",
-			FoundedDate:       "1999-09-09",
-			Industry:          "电子商务",
-			Address:           "杭州市余杭区",
-			LastUpdated:       time.Now(),
-			RiskFactors:       []string{},
-			CreditScore:       95,
-			ComplianceItems:   []string{"税务合规", "工商合规", "劳动合规"},
-		},
-		"百度在线网络技术(北京)有限公司": {
-			CompanyName:       "百度在线网络技术(北京)有限公司",
-			CompanyCode:       "91110000100000000X",
-			CreditLevel:       "AA",
-			RiskLevel:         "中低风险",
-			ComplianceStatus:  "合规",
-			BusinessStatus:    "存续",
-			LegalPerson:       "李彦宏",
-			RegisteredCapital: "500000万元",
-			FoundedDate:       "2000-01-01",
-			Industry:          "人工智能",
-			Address:           "北京市海淀区",
-			LastUpdated:       time.Now(),
-			RiskFactors:       []string{"市场竞争激烈"},
-			CreditScore:       85,
-			ComplianceItems:   []string{"税务合规", "工商合规", "劳动合规"},
+// parseCreditLedgerFilter 解析from/to（RFC3339，默认最近30天）和tenant_id参数
+func parseCreditLedgerFilter(c *gin.Context) (CreditLedgerFilter, bool) {
+	filter := CreditLedgerFilter{TenantID: c.Query("tenant_id"), To: timeNow()}
+	filter.From = filter.To.AddDate(0, 0, -30)
+	for param, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("%s必须是RFC3339格式的时间", param),
+			})
+			return filter, false
+		}
+		*target = t
+	}
+	return filter, true
+}
+
+func creditPagination(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	return page, pageSize
+}
+
+// getCreditUsage 当前租户的查询量和费用
+func (api *CreditInfoAPI) getCreditUsage(c *gin.Context) {
+	filter, ok := parseCreditLedgerFilter(c)
+	if !ok {
+		return
+	}
+	userID, _ := c.Get("user_id")
+	uid, _ := userID.(uint)
+	filter.TenantID = api.creditTenant(c, uid)
+
+	summary, err := api.gateway.SpendSummary(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "获取信用查询用量失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+	usage := CreditSpendSummary{TenantID: filter.TenantID}
+	if len(summary) > 0 {
+		usage = summary[0]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"data":    usage,
+		"message": "信用查询用量获取成功",
+	})
+}
+
+// listCreditLedger 查询台账
+func (api *CreditInfoAPI) listCreditLedger(c *gin.Context) {
+	filter, ok := parseCreditLedgerFilter(c)
+	if !ok {
+		return
+	}
+	page, pageSize := creditPagination(c)
+	entries, total, err := api.gateway.ListLedger(filter, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "获取信用查询台账失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"entries":   entries,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
 		},
-		"字节跳动科技有限公司": {
-			CompanyName:       "字节跳动科技有限公司",
-			CompanyCode:       "91110000MA0012345X",
-			CreditLevel:       "AA",
-			RiskLevel:         "中低风险",
-			ComplianceStatus:  "合规",
-			BusinessStatus:    "存续",
-			LegalPerson:       "张一鸣",
-			RegisteredCapital: "300000万元",
-			FoundedDate:       "2012-03-09",
-			Industry:          "互联网",
-			Address:           "北京市海淀区",
-			LastUpdated:       time.Now(),
-			RiskFactors:       []string{"监管政策变化"},
-			CreditScore:       85,
-			ComplianceItems:   []string{"税务合规", "工商合规", "劳动合规"},
+		"message": "信用查询台账获取成功",
+	})
+}
+
+// getCreditSpendSummary 按租户汇总费用
+func (api *CreditInfoAPI) getCreditSpendSummary(c *gin.Context) {
+	filter, ok := parseCreditLedgerFilter(c)
+	if !ok {
+		return
+	}
+	summary, err := api.gateway.SpendSummary(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "获取信用查询费用汇总失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	var totalCost float64
+	for _, row := range summary {
+		totalCost += row.Cost
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"tenants":    summary,
+			"total_cost": totalCost,
+			"from":       filter.From,
+			"to":         filter.To,
 		},
-		"美团点评": {
-			CompanyName:       "美团点评",
-			CompanyCode:       "91110000MA0012346X",
-			CreditLevel:       "A",
-			RiskLevel:         "中风险",
-			ComplianceStatus:  "合规",
-			BusinessStatus:    "存续",
-			LegalPerson:       "王兴",
-			RegisteredCapital: "100000万元",
-			FoundedDate:       "2010-03-04",
-			Industry:          "生活服务",
-			Address:           "北京市朝阳区",
-			LastUpdated:       time.Now(),
-			RiskFactors:       []string{"行业竞争激烈", "监管政策变化"},
-			CreditScore:       75,
-			ComplianceItems:   []string{"税务合规", "工商合规", "劳动合规"},
+		"message": "信用查询费用汇总获取成功",
+	})
+}
+
+// listCreditAlerts 查询风险预警，默认只返回未确认的预警
+func (api *CreditInfoAPI) listCreditAlerts(c *gin.Context) {
+	page, pageSize := creditPagination(c)
+	openOnly := c.DefaultQuery("acknowledged", "false") == "false"
+	alerts, total, err := api.gateway.ListAlerts(c.Query("company_code"), openOnly, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "获取信用风险预警失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"alerts":    alerts,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
 		},
+		"message": "信用风险预警获取成功",
+	})
+}
+
+// acknowledgeCreditAlert 确认风险预警
+func (api *CreditInfoAPI) acknowledgeCreditAlert(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "预警ID无效",
+		})
+		return
+	}
+	userID, _ := c.Get("user_id")
+	uid, _ := userID.(uint)
+
+	alert, err := api.gateway.AcknowledgeAlert(uint(id), uid)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrCreditAlertNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": "确认信用风险预警失败",
+			"error":   err.Error(),
+		})
+		return
 	}
 
-	return mockData[companyName]
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"data":    alert,
+		"message": "信用风险预警已确认",
+	})
 }
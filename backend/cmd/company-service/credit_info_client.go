@@ -11,6 +11,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -42,6 +43,24 @@ func NewCreditInfoClient(baseURL, username, password, aesKey, rsaPubKey, rsaPriK
 	}
 }
 
+// CreditInfoUpstreamError 信用信息接口返回的错误，StatusCode为0表示HTTP成功但业务失败
+type CreditInfoUpstreamError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *CreditInfoUpstreamError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("信用信息接口返回错误: %s", e.Message)
+	}
+	return fmt.Sprintf("信用信息接口返回HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// Temporary 限流和服务端错误可以重试
+func (e *CreditInfoUpstreamError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
 // CreditInfoRequest 信用信息查询请求
 type CreditInfoRequest struct {
 	ProductCode   string               `json:"productCode"`
@@ -131,7 +150,7 @@ func (c *CreditInfoClient) GetCompanyCreditInfo(companyName, companyCode string)
 	// 6. 发送HTTP请求
 	response, err := c.sendRequest(formData)
 	if err != nil {
-		return nil, fmt.Errorf("发送请求失败: %v", err)
+		return nil, fmt.Errorf("发送请求失败: %w", err)
 	}
 
 	// 7. 解密响应数据
@@ -179,6 +198,10 @@ func (c *CreditInfoClient) decryptAES(ciphertext string) (string, error) {
 		return "", err
 	}
 
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return "", errors.New("密文长度不是AES块大小的整数倍")
+	}
+
 	// 创建ECB模式的解密器
 	mode := cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize))
 
@@ -187,7 +210,10 @@ func (c *CreditInfoClient) decryptAES(ciphertext string) (string, error) {
 	mode.CryptBlocks(plaintext, data)
 
 	// 去除填充
-	unpaddedText := c.pkcs7UnPadding(plaintext)
+	unpaddedText, err := c.pkcs7UnPadding(plaintext)
+	if err != nil {
+		return "", err
+	}
 	return string(unpaddedText), nil
 }
 
@@ -276,16 +302,16 @@ func (c *CreditInfoClient) parseRSAPrivateKey(priKeyStr string) (*rsa.PrivateKey
 		return nil, err
 	}
 
-	// 解析PEM格式
-	block, _ := pem.Decode(keyBytes)
-	if block == nil {
-		return nil, fmt.Errorf("无法解析PEM格式的私钥")
+	// 解析PEM格式，失败时按Base64编码的DER处理（与公钥一致）
+	der := keyBytes
+	if block, _ := pem.Decode(keyBytes); block != nil {
+		der = block.Bytes
 	}
 
 	// 解析私钥
-	priKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	priKey, err := x509.ParsePKCS8PrivateKey(der)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("无法解析RSA私钥: %v", err)
 	}
 
 	rsaPriKey, ok := priKey.(*rsa.PrivateKey)
@@ -330,11 +356,22 @@ func (c *CreditInfoClient) sendRequest(formData map[string]string) (*CreditInfoR
 		return nil, err
 	}
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, &CreditInfoUpstreamError{StatusCode: resp.StatusCode, Message: string(body)}
+	}
+
 	// 解析响应
 	var response CreditInfoResponse
 	if err := json.Unmarshal(body, &response); err != nil {
 		return nil, err
 	}
+	if response.Data.SecretKey == "" || response.Data.Content == "" {
+		message := response.Message
+		if response.Error != "" {
+			message = response.Error
+		}
+		return nil, &CreditInfoUpstreamError{Message: message}
+	}
 
 	return &response, nil
 }
@@ -377,6 +414,10 @@ func (c *CreditInfoClient) decryptAESWithKey(ciphertext, key string) (string, er
 		return "", err
 	}
 
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return "", errors.New("密文长度不是AES块大小的整数倍")
+	}
+
 	// 创建ECB模式的解密器
 	mode := cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize))
 
@@ -385,7 +426,10 @@ func (c *CreditInfoClient) decryptAESWithKey(ciphertext, key string) (string, er
 	mode.CryptBlocks(plaintext, data)
 
 	// 去除填充
-	unpaddedText := c.pkcs7UnPadding(plaintext)
+	unpaddedText, err := c.pkcs7UnPadding(plaintext)
+	if err != nil {
+		return "", err
+	}
 	return string(unpaddedText), nil
 }
 
@@ -403,8 +447,14 @@ func (c *CreditInfoClient) pkcs7Padding(data []byte, blockSize int) []byte {
 }
 
 // pkcs7UnPadding PKCS7去填充
-func (c *CreditInfoClient) pkcs7UnPadding(data []byte) []byte {
+func (c *CreditInfoClient) pkcs7UnPadding(data []byte) ([]byte, error) {
 	length := len(data)
+	if length == 0 {
+		return nil, errors.New("PKCS7填充无效")
+	}
 	unpadding := int(data[length-1])
-	return data[:(length - unpadding)]
+	if unpadding == 0 || unpadding > aes.BlockSize || unpadding > length {
+		return nil, errors.New("PKCS7填充无效")
+	}
+	return data[:(length - unpadding)], nil
 }
@@ -0,0 +1,760 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 信用信息网关错误
+var (
+	ErrCreditLookupInvalid = errors.New("企业名称和统一社会信用代码不能同时为空")
+	ErrCreditRateLimited   = errors.New("信用信息查询过于频繁，请稍后再试")
+	ErrCreditAlertNotFound = errors.New("信用风险预警不存在")
+)
+
+// 查询结果来源
+const (
+	CreditSourceUpstream  = "upstream"  // 调用了第三方接口
+	CreditSourceCache     = "cache"     // 本实例内存缓存
+	CreditSourceSnapshot  = "snapshot"  // 数据库中未过期的快照（其他实例或重启前查询的结果）
+	CreditSourceCoalesced = "coalesced" // 与同时进行的相同查询合并
+)
+
+// 台账中的查询状态
+const (
+	CreditLookupSucceeded   = "success"
+	CreditLookupFailed      = "failed"
+	CreditLookupRateLimited = "rate_limited"
+)
+
+// 风险预警级别
+const (
+	CreditSeverityLow    = "low"
+	CreditSeverityMedium = "medium"
+	CreditSeverityHigh   = "high"
+)
+
+// CreditInfoProvider 信用信息数据源，由CreditInfoClient实现
+type CreditInfoProvider interface {
+	GetCompanyCreditInfo(companyName, companyCode string) (*CreditInfo, error)
+}
+
+// CreditInfoGatewayConfig 网关配置
+type CreditInfoGatewayConfig struct {
+	// CacheTTL 查询结果的有效期，过期后重新调用第三方接口
+	CacheTTL time.Duration
+	// RatePerMinute 每个租户每分钟允许的第三方接口调用次数，<=0表示不限制；缓存命中不计数
+	RatePerMinute float64
+	// Burst 令牌桶容量
+	Burst int
+	// CostPerCall 每次成功调用第三方接口的费用（元）
+	CostPerCall float64
+	// MaxAttempts 网络错误、限流和服务端错误时的最大尝试次数
+	MaxAttempts int
+	// RetryBackoff 首次重试的等待时间，之后每次翻倍
+	RetryBackoff time.Duration
+}
+
+// DefaultCreditInfoGatewayConfig 默认配置，可通过CREDIT_INFO_CACHE_TTL、CREDIT_INFO_RATE_PER_MINUTE、
+// CREDIT_INFO_BURST、CREDIT_INFO_COST_PER_CALL和CREDIT_INFO_MAX_ATTEMPTS覆盖
+func DefaultCreditInfoGatewayConfig() CreditInfoGatewayConfig {
+	config := CreditInfoGatewayConfig{
+		CacheTTL:      24 * time.Hour,
+		RatePerMinute: 30,
+		Burst:         10,
+		MaxAttempts:   3,
+		RetryBackoff:  500 * time.Millisecond,
+	}
+	if v, err := time.ParseDuration(os.Getenv("CREDIT_INFO_CACHE_TTL")); err == nil && v > 0 {
+		config.CacheTTL = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("CREDIT_INFO_RATE_PER_MINUTE"), 64); err == nil {
+		config.RatePerMinute = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("CREDIT_INFO_BURST")); err == nil && v > 0 {
+		config.Burst = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("CREDIT_INFO_COST_PER_CALL"), 64); err == nil && v >= 0 {
+		config.CostPerCall = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("CREDIT_INFO_MAX_ATTEMPTS")); err == nil && v > 0 {
+		config.MaxAttempts = v
+	}
+	return config
+}
+
+// CreditInfoSnapshot 企业最近一次从第三方接口取得的信用信息，
+// 作为多实例共享的缓存，也是变化检测的比较基准
+type CreditInfoSnapshot struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	CacheKey    string    `json:"cache_key" gorm:"size:255;uniqueIndex;not null"`
+	CompanyCode string    `json:"company_code" gorm:"size:64;index"`
+	CompanyName string    `json:"company_name" gorm:"size:200;index"`
+	Data        string    `json:"-" gorm:"type:text"`
+	FetchedAt   time.Time `json:"fetched_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (CreditInfoSnapshot) TableName() string {
+	return "company_credit_snapshots"
+}
+
+func (s *CreditInfoSnapshot) decode() (*CreditInfo, error) {
+	var info CreditInfo
+	if err := json.Unmarshal([]byte(s.Data), &info); err != nil {
+		return nil, fmt.Errorf("解析信用信息快照失败: %v", err)
+	}
+	return &info, nil
+}
+
+// CreditLookupLedger 信用信息查询台账，每次查询一条，用于费用统计和审计
+type CreditLookupLedger struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	TenantID     string    `json:"tenant_id" gorm:"size:64;index"`
+	UserID       uint      `json:"user_id" gorm:"index"`
+	CompanyCode  string    `json:"company_code" gorm:"size:64;index"`
+	CompanyName  string    `json:"company_name" gorm:"size:200"`
+	Source       string    `json:"source" gorm:"size:20"`
+	Status       string    `json:"status" gorm:"size:20;index"`
+	Attempts     int       `json:"attempts"`
+	Cost         float64   `json:"cost" gorm:"type:decimal(10,4);default:0"`
+	LatencyMs    int64     `json:"latency_ms"`
+	ErrorMessage string    `json:"error_message,omitempty" gorm:"size:500"`
+	CreatedAt    time.Time `json:"created_at" gorm:"index"`
+}
+
+// TableName 指定表名
+func (CreditLookupLedger) TableName() string {
+	return "company_credit_lookup_ledger"
+}
+
+// CreditFieldChange 风险相关字段在两次刷新之间的变化
+type CreditFieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// CreditRiskAlert 企业风险字段变化预警
+type CreditRiskAlert struct {
+	ID             uint                `json:"id" gorm:"primaryKey"`
+	CompanyCode    string              `json:"company_code" gorm:"size:64;index"`
+	CompanyName    string              `json:"company_name" gorm:"size:200"`
+	Severity       string              `json:"severity" gorm:"size:20;index"`
+	ChangesJSON    string              `json:"-" gorm:"column:changes;type:text"`
+	Changes        []CreditFieldChange `json:"changes" gorm:"-"`
+	Acknowledged   bool                `json:"acknowledged" gorm:"default:false;index"`
+	AcknowledgedBy uint                `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt *time.Time          `json:"acknowledged_at,omitempty"`
+	CreatedAt      time.Time           `json:"created_at" gorm:"index"`
+}
+
+// TableName 指定表名
+func (CreditRiskAlert) TableName() string {
+	return "company_credit_risk_alerts"
+}
+
+// AfterFind 解析变化明细
+func (a *CreditRiskAlert) AfterFind(tx *gorm.DB) error {
+	if a.ChangesJSON == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(a.ChangesJSON), &a.Changes)
+}
+
+// CreditLookup 一次信用信息查询
+type CreditLookup struct {
+	CompanyName string
+	CompanyCode string
+	TenantID    string
+	UserID      uint
+	// Refresh 忽略缓存强制调用第三方接口，仍受租户限流约束
+	Refresh bool
+}
+
+// CreditLookupResult 查询结果
+type CreditLookupResult struct {
+	Info      *CreditInfo
+	Source    string
+	FetchedAt time.Time
+	Attempts  int
+	Cost      float64
+	// Changes 本次刷新相对上次快照的风险字段变化，仅Source为upstream时可能非空
+	Changes []CreditFieldChange
+}
+
+type creditCacheEntry struct {
+	info      CreditInfo
+	fetchedAt time.Time
+}
+
+type creditLookupCall struct {
+	done   chan struct{}
+	tenant string
+	result *CreditLookupResult
+	err    error
+}
+
+type creditTokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// CreditInfoGateway 信用信息查询网关：按统一社会信用代码缓存结果、合并并发的相同查询、
+// 按租户限流、失败重试、记录费用台账，并在企业风险字段变化时生成预警
+type CreditInfoGateway struct {
+	provider CreditInfoProvider
+	db       *gorm.DB
+	config   CreditInfoGatewayConfig
+	sleep    func(ctx context.Context, d time.Duration) error
+
+	// OnAlert 新预警写入后回调，默认只记录日志
+	OnAlert func(alert CreditRiskAlert)
+
+	mu       sync.Mutex
+	cache    map[string]creditCacheEntry
+	inflight map[string]*creditLookupCall
+	buckets  map[string]*creditTokenBucket
+}
+
+// NewCreditInfoGateway 创建信用信息网关
+func NewCreditInfoGateway(db *gorm.DB, provider CreditInfoProvider, config CreditInfoGatewayConfig) *CreditInfoGateway {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 1
+	}
+	if config.Burst <= 0 {
+		config.Burst = 1
+	}
+	return &CreditInfoGateway{
+		provider: provider,
+		db:       db,
+		config:   config,
+		sleep:    sleepContext,
+		cache:    make(map[string]creditCacheEntry),
+		inflight: make(map[string]*creditLookupCall),
+		buckets:  make(map[string]*creditTokenBucket),
+	}
+}
+
+// AutoMigrate 创建网关使用的表
+func (g *CreditInfoGateway) AutoMigrate() error {
+	return g.db.AutoMigrate(&CreditInfoSnapshot{}, &CreditLookupLedger{}, &CreditRiskAlert{})
+}
+
+// Lookup 查询企业信用信息，并记录一条台账
+func (g *CreditInfoGateway) Lookup(ctx context.Context, req CreditLookup) (*CreditLookupResult, error) {
+	key := creditCacheKey(req.CompanyCode, req.CompanyName)
+	if key == "" {
+		return nil, ErrCreditLookupInvalid
+	}
+	started := timeNow()
+	result, attempts, err := g.lookup(ctx, key, req)
+	g.recordLedger(req, result, attempts, err, timeNow().Sub(started))
+	return result, err
+}
+
+func (g *CreditInfoGateway) lookup(ctx context.Context, key string, req CreditLookup) (*CreditLookupResult, int, error) {
+	for {
+		g.mu.Lock()
+		if !req.Refresh {
+			if entry, ok := g.cache[key]; ok && timeNow().Sub(entry.fetchedAt) < g.config.CacheTTL {
+				g.mu.Unlock()
+				return &CreditLookupResult{Info: cloneCreditInfo(&entry.info), Source: CreditSourceCache, FetchedAt: entry.fetchedAt}, 0, nil
+			}
+		}
+		if call, ok := g.inflight[key]; ok {
+			g.mu.Unlock()
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return nil, 0, ctx.Err()
+			}
+			// 被其他租户的限额拒绝时按自己的限额重新查询
+			if errors.Is(call.err, ErrCreditRateLimited) && call.tenant != req.TenantID {
+				continue
+			}
+			if call.err != nil {
+				return nil, 0, call.err
+			}
+			return &CreditLookupResult{Info: cloneCreditInfo(call.result.Info), Source: CreditSourceCoalesced, FetchedAt: call.result.FetchedAt}, 0, nil
+		}
+		call := &creditLookupCall{done: make(chan struct{}), tenant: req.TenantID}
+		g.inflight[key] = call
+		g.mu.Unlock()
+
+		// 第三方接口按次计费，发起者取消请求时仍完成查询，结果供等待者和缓存使用
+		result, attempts, err := g.fetch(context.WithoutCancel(ctx), key, req)
+		call.result, call.err = result, err
+		g.mu.Lock()
+		delete(g.inflight, key)
+		g.mu.Unlock()
+		close(call.done)
+		return result, attempts, err
+	}
+}
+
+// fetch 依次尝试数据库快照和第三方接口
+func (g *CreditInfoGateway) fetch(ctx context.Context, key string, req CreditLookup) (*CreditLookupResult, int, error) {
+	previous, err := g.loadSnapshot(ctx, req.CompanyCode, req.CompanyName)
+	if err != nil {
+		log.Printf("读取信用信息快照失败: %v", err)
+	}
+	if previous != nil && !req.Refresh && timeNow().Sub(previous.FetchedAt) < g.config.CacheTTL {
+		if info, err := previous.decode(); err == nil {
+			g.storeCache(info, previous.FetchedAt, key)
+			return &CreditLookupResult{Info: cloneCreditInfo(info), Source: CreditSourceSnapshot, FetchedAt: previous.FetchedAt}, 0, nil
+		}
+	}
+
+	if !g.takeToken(req.TenantID) {
+		return nil, 0, ErrCreditRateLimited
+	}
+	info, attempts, err := g.callProvider(ctx, req)
+	if err != nil {
+		return nil, attempts, err
+	}
+	fetchedAt := timeNow()
+	info.LastUpdated = fetchedAt
+
+	canonical := creditCacheKey(firstNonEmpty(info.CompanyCode, req.CompanyCode), firstNonEmpty(info.CompanyName, req.CompanyName))
+	if previous == nil || previous.CacheKey != canonical {
+		if snapshot, err := g.loadSnapshotByKey(ctx, canonical); err != nil {
+			log.Printf("读取信用信息快照失败: %v", err)
+		} else if snapshot != nil {
+			previous = snapshot
+		}
+	}
+
+	var changes []CreditFieldChange
+	if previous != nil {
+		if old, err := previous.decode(); err == nil {
+			changes = diffCreditRisk(old, info)
+		}
+	}
+	if err := g.saveSnapshot(ctx, canonical, info, fetchedAt); err != nil {
+		log.Printf("保存信用信息快照失败: %v", err)
+	}
+	if len(changes) > 0 {
+		g.raiseAlert(ctx, info, changes)
+	}
+	g.storeCache(info, fetchedAt, key, canonical)
+
+	return &CreditLookupResult{
+		Info:      cloneCreditInfo(info),
+		Source:    CreditSourceUpstream,
+		FetchedAt: fetchedAt,
+		Attempts:  attempts,
+		Cost:      g.config.CostPerCall,
+		Changes:   changes,
+	}, attempts, nil
+}
+
+// callProvider 调用第三方接口，可重试的错误按指数退避重试
+func (g *CreditInfoGateway) callProvider(ctx context.Context, req CreditLookup) (*CreditInfo, int, error) {
+	backoff := g.config.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		info, err := g.provider.GetCompanyCreditInfo(req.CompanyName, req.CompanyCode)
+		if err == nil {
+			return info, attempt, nil
+		}
+		if attempt >= g.config.MaxAttempts || !isRetryableCreditError(err) {
+			return nil, attempt, err
+		}
+		if err := g.sleep(ctx, backoff); err != nil {
+			return nil, attempt, err
+		}
+		backoff *= 2
+	}
+}
+
+// isRetryableCreditError 网络错误、限流和服务端错误可以重试，解密失败、业务错误等不重试
+func isRetryableCreditError(err error) bool {
+	var upstream *CreditInfoUpstreamError
+	if errors.As(err, &upstream) {
+		return upstream.Temporary()
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// takeToken 从租户的令牌桶中取一个令牌
+func (g *CreditInfoGateway) takeToken(tenant string) bool {
+	if g.config.RatePerMinute <= 0 {
+		return true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := timeNow()
+	burst := float64(g.config.Burst)
+	bucket, ok := g.buckets[tenant]
+	if !ok {
+		bucket = &creditTokenBucket{tokens: burst, updated: now}
+		g.buckets[tenant] = bucket
+	}
+	bucket.tokens += now.Sub(bucket.updated).Minutes() * g.config.RatePerMinute
+	if bucket.tokens > burst {
+		bucket.tokens = burst
+	}
+	bucket.updated = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+func (g *CreditInfoGateway) storeCache(info *CreditInfo, fetchedAt time.Time, keys ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, key := range keys {
+		g.cache[key] = creditCacheEntry{info: *cloneCreditInfo(info), fetchedAt: fetchedAt}
+	}
+}
+
+// Invalidate 清除企业的本地缓存，下次查询读取快照或重新调用第三方接口
+func (g *CreditInfoGateway) Invalidate(companyCode, companyName string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.cache, creditCacheKey(companyCode, ""))
+	delete(g.cache, creditCacheKey("", companyName))
+}
+
+// loadSnapshot 有信用代码时按代码查找，否则按企业名称查找最近的快照
+func (g *CreditInfoGateway) loadSnapshot(ctx context.Context, companyCode, companyName string) (*CreditInfoSnapshot, error) {
+	if code := normalizeCreditCode(companyCode); code != "" {
+		return g.loadSnapshotByKey(ctx, creditCacheKey(code, ""))
+	}
+	var snapshot CreditInfoSnapshot
+	err := g.db.WithContext(ctx).Where("company_name = ?", strings.TrimSpace(companyName)).
+		Order("fetched_at DESC").Take(&snapshot).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func (g *CreditInfoGateway) loadSnapshotByKey(ctx context.Context, key string) (*CreditInfoSnapshot, error) {
+	var snapshot CreditInfoSnapshot
+	err := g.db.WithContext(ctx).Where("cache_key = ?", key).Take(&snapshot).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func (g *CreditInfoGateway) saveSnapshot(ctx context.Context, key string, info *CreditInfo, fetchedAt time.Time) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	snapshot := CreditInfoSnapshot{
+		CacheKey:    key,
+		CompanyCode: normalizeCreditCode(info.CompanyCode),
+		CompanyName: strings.TrimSpace(info.CompanyName),
+		Data:        string(data),
+		FetchedAt:   fetchedAt,
+	}
+	return g.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "cache_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"company_code", "company_name", "data", "fetched_at", "updated_at"}),
+	}).Create(&snapshot).Error
+}
+
+func (g *CreditInfoGateway) raiseAlert(ctx context.Context, info *CreditInfo, changes []CreditFieldChange) {
+	data, _ := json.Marshal(changes)
+	alert := CreditRiskAlert{
+		CompanyCode: normalizeCreditCode(info.CompanyCode),
+		CompanyName: info.CompanyName,
+		Severity:    creditChangeSeverity(changes),
+		ChangesJSON: string(data),
+		Changes:     changes,
+	}
+	if err := g.db.WithContext(ctx).Create(&alert).Error; err != nil {
+		log.Printf("保存信用风险预警失败: %v", err)
+		return
+	}
+	if g.OnAlert != nil {
+		g.OnAlert(alert)
+		return
+	}
+	log.Printf("企业%s信用风险字段变化(%s): %s", alert.CompanyName, alert.Severity, data)
+}
+
+func (g *CreditInfoGateway) recordLedger(req CreditLookup, result *CreditLookupResult, attempts int, lookupErr error, latency time.Duration) {
+	entry := CreditLookupLedger{
+		TenantID:    req.TenantID,
+		UserID:      req.UserID,
+		CompanyCode: normalizeCreditCode(req.CompanyCode),
+		CompanyName: strings.TrimSpace(req.CompanyName),
+		Status:      CreditLookupSucceeded,
+		Attempts:    attempts,
+		LatencyMs:   latency.Milliseconds(),
+	}
+	switch {
+	case errors.Is(lookupErr, ErrCreditRateLimited):
+		entry.Status = CreditLookupRateLimited
+		entry.ErrorMessage = lookupErr.Error()
+	case lookupErr != nil:
+		entry.Status = CreditLookupFailed
+		entry.ErrorMessage = truncateString(lookupErr.Error(), 500)
+	default:
+		entry.Source = result.Source
+		entry.Cost = result.Cost
+		if entry.CompanyCode == "" {
+			entry.CompanyCode = normalizeCreditCode(result.Info.CompanyCode)
+		}
+	}
+	if err := g.db.Create(&entry).Error; err != nil {
+		log.Printf("记录信用信息查询台账失败: %v", err)
+	}
+}
+
+// CreditLedgerFilter 台账查询条件
+type CreditLedgerFilter struct {
+	TenantID string
+	From     time.Time
+	To       time.Time
+}
+
+func (f CreditLedgerFilter) apply(db *gorm.DB) *gorm.DB {
+	if f.TenantID != "" {
+		db = db.Where("tenant_id = ?", f.TenantID)
+	}
+	if !f.From.IsZero() {
+		db = db.Where("created_at >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		db = db.Where("created_at < ?", f.To)
+	}
+	return db
+}
+
+// ListLedger 分页查询台账，按时间倒序
+func (g *CreditInfoGateway) ListLedger(filter CreditLedgerFilter, page, pageSize int) ([]CreditLookupLedger, int64, error) {
+	var total int64
+	if err := filter.apply(g.db.Model(&CreditLookupLedger{})).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var entries []CreditLookupLedger
+	err := filter.apply(g.db.Model(&CreditLookupLedger{})).
+		Order("created_at DESC, id DESC").Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&entries).Error
+	return entries, total, err
+}
+
+// CreditSpendSummary 租户的查询量和费用汇总
+type CreditSpendSummary struct {
+	TenantID      string  `json:"tenant_id"`
+	Lookups       int64   `json:"lookups"`
+	UpstreamCalls int64   `json:"upstream_calls"`
+	CacheHits     int64   `json:"cache_hits"`
+	Failed        int64   `json:"failed"`
+	RateLimited   int64   `json:"rate_limited"`
+	Cost          float64 `json:"cost"`
+}
+
+// SpendSummary 按租户汇总查询量和费用，费用从高到低排列
+func (g *CreditInfoGateway) SpendSummary(filter CreditLedgerFilter) ([]CreditSpendSummary, error) {
+	var rows []CreditSpendSummary
+	err := filter.apply(g.db.Model(&CreditLookupLedger{})).
+		Select(`tenant_id,
+			COUNT(*) AS lookups,
+			SUM(CASE WHEN source = ? THEN 1 ELSE 0 END) AS upstream_calls,
+			SUM(CASE WHEN source IN ? THEN 1 ELSE 0 END) AS cache_hits,
+			SUM(CASE WHEN status = ? THEN 1 ELSE 0 END) AS failed,
+			SUM(CASE WHEN status = ? THEN 1 ELSE 0 END) AS rate_limited,
+			COALESCE(SUM(cost), 0) AS cost`,
+			CreditSourceUpstream,
+			[]string{CreditSourceCache, CreditSourceSnapshot, CreditSourceCoalesced},
+			CreditLookupFailed, CreditLookupRateLimited).
+		Group("tenant_id").Order("cost DESC").Scan(&rows).Error
+	return rows, err
+}
+
+// ListAlerts 分页查询风险预警，openOnly为true时只返回未确认的预警
+func (g *CreditInfoGateway) ListAlerts(companyCode string, openOnly bool, page, pageSize int) ([]CreditRiskAlert, int64, error) {
+	query := g.db.Model(&CreditRiskAlert{})
+	if code := normalizeCreditCode(companyCode); code != "" {
+		query = query.Where("company_code = ?", code)
+	}
+	if openOnly {
+		query = query.Where("acknowledged = ?", false)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var alerts []CreditRiskAlert
+	err := query.Order("created_at DESC, id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&alerts).Error
+	return alerts, total, err
+}
+
+// AcknowledgeAlert 确认风险预警
+func (g *CreditInfoGateway) AcknowledgeAlert(id, userID uint) (*CreditRiskAlert, error) {
+	var alert CreditRiskAlert
+	if err := g.db.First(&alert, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCreditAlertNotFound
+		}
+		return nil, err
+	}
+	if alert.Acknowledged {
+		return &alert, nil
+	}
+	now := timeNow()
+	alert.Acknowledged = true
+	alert.AcknowledgedBy = userID
+	alert.AcknowledgedAt = &now
+	err := g.db.Model(&alert).Updates(map[string]interface{}{
+		"acknowledged":    true,
+		"acknowledged_by": userID,
+		"acknowledged_at": now,
+	}).Error
+	return &alert, err
+}
+
+// 风险等级排序，数值越大风险越高
+var creditRiskRank = map[string]int{
+	"低风险":  1,
+	"中低风险": 2,
+	"中风险":  3,
+	"中高风险": 4,
+	"高风险":  5,
+}
+
+// 信用等级排序，数值越大信用越好
+var creditLevelRank = map[string]int{
+	"D": 1, "C": 2, "CC": 3, "CCC": 4, "B": 5, "BB": 6, "BBB": 7, "A": 8, "AA": 9, "AAA": 10,
+}
+
+// diffCreditRisk 比较两次查询的风险相关字段
+func diffCreditRisk(old, new *CreditInfo) []CreditFieldChange {
+	var changes []CreditFieldChange
+	add := func(field, before, after string) {
+		if before != after {
+			changes = append(changes, CreditFieldChange{Field: field, Old: before, New: after})
+		}
+	}
+	add("credit_level", old.CreditLevel, new.CreditLevel)
+	add("risk_level", old.RiskLevel, new.RiskLevel)
+	add("credit_score", strconv.Itoa(old.CreditScore), strconv.Itoa(new.CreditScore))
+	add("business_status", old.BusinessStatus, new.BusinessStatus)
+	add("compliance_status", old.ComplianceStatus, new.ComplianceStatus)
+	add("risk_factors", joinSorted(old.RiskFactors), joinSorted(new.RiskFactors))
+	add("compliance_items", joinSorted(old.ComplianceItems), joinSorted(new.ComplianceItems))
+	return changes
+}
+
+// creditChangeSeverity 经营状态变化或风险升至中高以上为高，风险上升、信用降级或评分下降为中，其余为低
+func creditChangeSeverity(changes []CreditFieldChange) string {
+	severity := CreditSeverityLow
+	raise := func(level string) {
+		if level == CreditSeverityHigh || severity == CreditSeverityLow {
+			severity = level
+		}
+	}
+	for _, change := range changes {
+		switch change.Field {
+		case "business_status":
+			raise(CreditSeverityHigh)
+		case "risk_level":
+			if creditRiskRank[change.New] >= creditRiskRank["中高风险"] {
+				raise(CreditSeverityHigh)
+			} else if creditRiskRank[change.New] > creditRiskRank[change.Old] {
+				raise(CreditSeverityMedium)
+			}
+		case "credit_level":
+			if creditLevelRank[change.New] < creditLevelRank[change.Old] {
+				raise(CreditSeverityMedium)
+			}
+		case "credit_score":
+			before, _ := strconv.Atoi(change.Old)
+			after, _ := strconv.Atoi(change.New)
+			if after < before {
+				raise(CreditSeverityMedium)
+			}
+		case "compliance_status":
+			if change.New != "合规" {
+				raise(CreditSeverityMedium)
+			}
+		}
+	}
+	return severity
+}
+
+// creditCacheKey 有统一社会信用代码时按代码缓存，否则按企业名称
+func creditCacheKey(companyCode, companyName string) string {
+	if code := normalizeCreditCode(companyCode); code != "" {
+		return "code:" + code
+	}
+	if name := strings.TrimSpace(companyName); name != "" {
+		return "name:" + name
+	}
+	return ""
+}
+
+func normalizeCreditCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func cloneCreditInfo(info *CreditInfo) *CreditInfo {
+	clone := *info
+	clone.RiskFactors = append([]string(nil), info.RiskFactors...)
+	clone.ComplianceItems = append([]string(nil), info.ComplianceItems...)
+	return &clone
+}
+
+func joinSorted(values []string) string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, "、")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func truncateString(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
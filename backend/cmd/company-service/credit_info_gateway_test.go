@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testCreditAESKey = "0123456789abcdef"
+
+func newTestCreditGateway(t *testing.T, config CreditInfoGatewayConfig) (*CreditInfoGateway, *CreditInfoStandIn) {
+	t.Helper()
+	standIn, err := NewCreditInfoStandIn(defaultStandInCreditRecords())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(standIn.Close)
+
+	gateway := NewCreditInfoGateway(newTestDB(t), standIn.Client(testCreditAESKey), config)
+	gateway.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+	if err := gateway.AutoMigrate(); err != nil {
+		t.Fatal(err)
+	}
+	return gateway, standIn
+}
+
+func testCreditConfig() CreditInfoGatewayConfig {
+	return CreditInfoGatewayConfig{CacheTTL: time.Hour, RatePerMinute: 60, Burst: 5, CostPerCall: 0.5, MaxAttempts: 3}
+}
+
+func TestCreditStandInEnvelope(t *testing.T) {
+	standIn, err := NewCreditInfoStandIn(defaultStandInCreditRecords())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer standIn.Close()
+
+	info, err := standIn.Client(testCreditAESKey).GetCompanyCreditInfo("", "91440300708461136t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.CompanyName != "腾讯科技(深圳)有限公司" || info.CreditScore != 95 {
+		t.Fatalf("unexpected credit info: %+v", info)
+	}
+
+	if _, err := standIn.Client(testCreditAESKey).GetCompanyCreditInfo("不存在的企业", ""); err == nil {
+		t.Fatal("expected error for unknown company")
+	}
+	wrongAuth := standIn.Client(testCreditAESKey)
+	wrongAuth.Password = "wrong"
+	if _, err := wrongAuth.GetCompanyCreditInfo("美团点评", ""); err == nil {
+		t.Fatal("expected authentication error")
+	}
+}
+
+func TestCreditGatewayCachesAndRecordsLedger(t *testing.T) {
+	gateway, standIn := newTestCreditGateway(t, testCreditConfig())
+	ctx := context.Background()
+	req := CreditLookup{CompanyName: "美团点评", CompanyCode: "91110000MA0012346X", TenantID: "company:1", UserID: 7}
+
+	first, err := gateway.Lookup(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := gateway.Lookup(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Source != CreditSourceUpstream || second.Source != CreditSourceCache {
+		t.Fatalf("sources = %s, %s", first.Source, second.Source)
+	}
+	if standIn.Calls() != 1 {
+		t.Fatalf("stand-in called %d times, want 1", standIn.Calls())
+	}
+
+	// 内存缓存丢失后从数据库快照读取，不再计费
+	gateway.Invalidate(req.CompanyCode, req.CompanyName)
+	third, err := gateway.Lookup(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.Source != CreditSourceSnapshot || standIn.Calls() != 1 {
+		t.Fatalf("source = %s after %d calls, want snapshot", third.Source, standIn.Calls())
+	}
+
+	summary, err := gateway.SpendSummary(CreditLedgerFilter{TenantID: "company:1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary) != 1 || summary[0].Lookups != 3 || summary[0].UpstreamCalls != 1 || summary[0].CacheHits != 2 || summary[0].Cost != 0.5 {
+		t.Fatalf("unexpected spend summary: %+v", summary)
+	}
+}
+
+func TestCreditGatewayCoalescesConcurrentLookups(t *testing.T) {
+	gateway, standIn := newTestCreditGateway(t, testCreditConfig())
+	standIn.SetDelay(100 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	sources := make([]string, 8)
+	for i := range sources {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := gateway.Lookup(context.Background(), CreditLookup{CompanyCode: "91330100MA27XN3X8N", TenantID: "company:1"})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			sources[i] = result.Source
+		}(i)
+	}
+	wg.Wait()
+
+	if standIn.Calls() != 1 {
+		t.Fatalf("stand-in called %d times, want 1", standIn.Calls())
+	}
+	upstream := 0
+	for _, source := range sources {
+		if source == CreditSourceUpstream {
+			upstream++
+		}
+	}
+	if upstream != 1 {
+		t.Fatalf("sources = %v, want exactly one upstream", sources)
+	}
+}
+
+func TestCreditGatewayRateLimitsPerTenant(t *testing.T) {
+	config := testCreditConfig()
+	config.RatePerMinute = 1
+	config.Burst = 2
+	gateway, _ := newTestCreditGateway(t, config)
+	now := useTestClock(t)
+	ctx := context.Background()
+
+	codes := []string{"91440300708461136T", "91330100MA27XN3X8N", "91110000100000000X"}
+	for i, code := range codes {
+		_, err := gateway.Lookup(ctx, CreditLookup{CompanyCode: code, TenantID: "company:1"})
+		if i < 2 && err != nil {
+			t.Fatalf("lookup %d: %v", i, err)
+		}
+		if i == 2 && err != ErrCreditRateLimited {
+			t.Fatalf("lookup %d: got %v, want ErrCreditRateLimited", i, err)
+		}
+	}
+	// 其他租户有独立的额度，缓存命中不消耗额度
+	if _, err := gateway.Lookup(ctx, CreditLookup{CompanyCode: codes[2], TenantID: "company:2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gateway.Lookup(ctx, CreditLookup{CompanyCode: codes[0], TenantID: "company:1"}); err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(time.Minute)
+	if _, err := gateway.Lookup(ctx, CreditLookup{CompanyCode: codes[1], TenantID: "company:1", Refresh: true}); err != nil {
+		t.Fatalf("token should refill after a minute: %v", err)
+	}
+
+	summary, err := gateway.SpendSummary(CreditLedgerFilter{TenantID: "company:1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary) != 1 || summary[0].RateLimited != 1 || summary[0].UpstreamCalls != 3 {
+		t.Fatalf("unexpected spend summary: %+v", summary)
+	}
+}
+
+func TestCreditGatewayRetriesTransientErrors(t *testing.T) {
+	gateway, standIn := newTestCreditGateway(t, testCreditConfig())
+	standIn.FailNext(http.StatusBadGateway, http.StatusTooManyRequests)
+
+	result, err := gateway.Lookup(context.Background(), CreditLookup{CompanyName: "美团点评", TenantID: "company:1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Attempts != 3 {
+		t.Fatalf("attempts = %d, want 3", result.Attempts)
+	}
+
+	// 客户端错误不重试
+	standIn.FailNext(http.StatusBadRequest)
+	if _, err := gateway.Lookup(context.Background(), CreditLookup{CompanyName: "字节跳动科技有限公司", TenantID: "company:1"}); err == nil {
+		t.Fatal("expected error")
+	}
+	if standIn.Calls() != 4 {
+		t.Fatalf("stand-in called %d times, want 4", standIn.Calls())
+	}
+}
+
+func TestCreditGatewayRaisesAlertsOnRiskChanges(t *testing.T) {
+	gateway, standIn := newTestCreditGateway(t, testCreditConfig())
+	var raised []CreditRiskAlert
+	gateway.OnAlert = func(alert CreditRiskAlert) { raised = append(raised, alert) }
+	ctx := context.Background()
+	req := CreditLookup{CompanyName: "百度在线网络技术(北京)有限公司", TenantID: "company:1"}
+
+	if _, err := gateway.Lookup(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	// 无变化的刷新不产生预警
+	req.Refresh = true
+	if _, err := gateway.Lookup(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if len(raised) != 0 {
+		t.Fatalf("unexpected alerts: %+v", raised)
+	}
+
+	records := defaultStandInCreditRecords()
+	changed := records[2]
+	changed.RiskLevel = "高风险"
+	changed.CreditScore = 60
+	changed.RiskFactors = []string{"市场竞争激烈", "被列入经营异常名录"}
+	standIn.Put(changed)
+
+	result, err := gateway.Lookup(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Changes) != 3 {
+		t.Fatalf("changes = %+v, want risk_level, credit_score and risk_factors", result.Changes)
+	}
+	if len(raised) != 1 || raised[0].Severity != CreditSeverityHigh {
+		t.Fatalf("raised = %+v, want one high severity alert", raised)
+	}
+
+	alerts, total, err := gateway.ListAlerts("91110000100000000X", true, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(alerts[0].Changes) != 3 {
+		t.Fatalf("stored alerts = %+v", alerts)
+	}
+	if _, err := gateway.AcknowledgeAlert(alerts[0].ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, total, _ := gateway.ListAlerts("", true, 1, 10); total != 0 {
+		t.Fatalf("open alerts = %d after acknowledgement", total)
+	}
+	if _, err := gateway.AcknowledgeAlert(999, 1); err != ErrCreditAlertNotFound {
+		t.Fatalf("got %v, want ErrCreditAlertNotFound", err)
+	}
+}
+
+func TestCreditChangeSeverity(t *testing.T) {
+	cases := []struct {
+		changes []CreditFieldChange
+		want    string
+	}{
+		{[]CreditFieldChange{{Field: "risk_factors", Old: "", New: "监管政策变化"}}, CreditSeverityLow},
+		{[]CreditFieldChange{{Field: "risk_level", Old: "中风险", New: "低风险"}}, CreditSeverityLow},
+		{[]CreditFieldChange{{Field: "credit_level", Old: "AAA", New: "AA"}}, CreditSeverityMedium},
+		{[]CreditFieldChange{{Field: "risk_level", Old: "低风险", New: "中风险"}}, CreditSeverityMedium},
+		{[]CreditFieldChange{{Field: "credit_score", Old: "80", New: "70"}, {Field: "business_status", Old: "存续", New: "注销"}}, CreditSeverityHigh},
+	}
+	for _, tc := range cases {
+		if got := creditChangeSeverity(tc.changes); got != tc.want {
+			t.Errorf("creditChangeSeverity(%+v) = %s, want %s", tc.changes, got, tc.want)
+		}
+	}
+}
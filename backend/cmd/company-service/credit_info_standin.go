@@ -0,0 +1,304 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CreditInfoStandIn 本地信用信息接口替身，实现与真实接口相同的AES/RSA信封：
+// 用服务端私钥解出请求的AES密钥并解密查询条件，再用新生成的AES密钥加密响应，
+// 该密钥用客户端公钥加密后放在响应的secretKey中。用于测试和离线开发
+type CreditInfoStandIn struct {
+	Server   *httptest.Server
+	Username string
+	Password string
+	// ServerPubKey 服务端公钥（Base64编码的PKIX），作为客户端的RSAPubKey
+	ServerPubKey string
+	// ClientPriKey 客户端私钥（Base64编码的PKCS8），作为客户端的RSAPriKey
+	ClientPriKey string
+
+	serverKey *rsa.PrivateKey
+	clientPub *rsa.PublicKey
+
+	mu       sync.Mutex
+	byCode   map[string]CreditInfo
+	byName   map[string]CreditInfo
+	failures []int
+	delay    time.Duration
+	calls    int
+}
+
+// NewCreditInfoStandIn 启动替身服务，records为初始企业数据
+func NewCreditInfoStandIn(records []CreditInfo) (*CreditInfoStandIn, error) {
+	serverKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	clientKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	serverPub, err := x509.MarshalPKIXPublicKey(&serverKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	clientPri, err := x509.MarshalPKCS8PrivateKey(clientKey)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &CreditInfoStandIn{
+		Username:     "standin",
+		Password:     "standin",
+		ServerPubKey: base64.StdEncoding.EncodeToString(serverPub),
+		ClientPriKey: base64.StdEncoding.EncodeToString(clientPri),
+		serverKey:    serverKey,
+		clientPub:    &clientKey.PublicKey,
+		byCode:       make(map[string]CreditInfo),
+		byName:       make(map[string]CreditInfo),
+	}
+	for _, info := range records {
+		s.Put(info)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s, nil
+}
+
+// Client 创建指向替身服务的客户端，aesKey为16/24/32字节的请求密钥
+func (s *CreditInfoStandIn) Client(aesKey string) *CreditInfoClient {
+	return NewCreditInfoClient(s.Server.URL, s.Username, s.Password, aesKey, s.ServerPubKey, s.ClientPriKey)
+}
+
+// Close 关闭替身服务
+func (s *CreditInfoStandIn) Close() {
+	s.Server.Close()
+}
+
+// Put 新增或修改企业数据，用于模拟企业信用状况的变化
+func (s *CreditInfoStandIn) Put(info CreditInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if code := normalizeCreditCode(info.CompanyCode); code != "" {
+		s.byCode[code] = info
+	}
+	s.byName[strings.TrimSpace(info.CompanyName)] = info
+}
+
+// FailNext 之后的请求依次返回给定的HTTP状态码，用于模拟接口故障
+func (s *CreditInfoStandIn) FailNext(statusCodes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, statusCodes...)
+}
+
+// SetDelay 设置每次请求的响应延迟
+func (s *CreditInfoStandIn) SetDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delay = d
+}
+
+// Calls 替身收到的请求数（含失败的请求）
+func (s *CreditInfoStandIn) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func (s *CreditInfoStandIn) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.calls++
+	delay := s.delay
+	failure := 0
+	if len(s.failures) > 0 {
+		failure, s.failures = s.failures[0], s.failures[1:]
+	}
+	s.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	if failure != 0 {
+		http.Error(w, http.StatusText(failure), failure)
+		return
+	}
+	if user, pass, ok := r.BasicAuth(); !ok || user != s.Username || pass != s.Password {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	request, err := s.decryptRequest(r)
+	if err != nil {
+		writeStandInJSON(w, CreditInfoResponse{Status: "error", Message: "请求解密失败", Error: err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	info, ok := s.byCode[normalizeCreditCode(request.Conditions.EnterpriseCode)]
+	if !ok {
+		info, ok = s.byName[strings.TrimSpace(request.Conditions.EnterpriseName)]
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeStandInJSON(w, CreditInfoResponse{Status: "error", Message: "未查询到企业信息"})
+		return
+	}
+
+	data, err := s.encryptResponse(info)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeStandInJSON(w, CreditInfoResponse{Status: "success", Message: "查询成功", Data: *data})
+}
+
+// decryptRequest 按真实接口的方式解出查询条件
+func (s *CreditInfoStandIn) decryptRequest(r *http.Request) (*CreditInfoRequest, error) {
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		return nil, err
+	}
+	encryptedKey, err := base64.StdEncoding.DecodeString(r.FormValue("secretKey"))
+	if err != nil {
+		return nil, err
+	}
+	aesKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, s.serverKey, encryptedKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := (&CreditInfoClient{AESKey: string(aesKey)}).decryptAES(r.FormValue("content"))
+	if err != nil {
+		return nil, err
+	}
+	var request CreditInfoRequest
+	if err := json.Unmarshal([]byte(plaintext), &request); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// encryptResponse 用一次性AES密钥加密企业数据，密钥用客户端公钥加密
+func (s *CreditInfoStandIn) encryptResponse(info CreditInfo) (*CreditInfoData, error) {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	responseKey := hex.EncodeToString(raw)
+
+	content, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	encryptedContent, err := (&CreditInfoClient{AESKey: responseKey}).encryptAES(string(content))
+	if err != nil {
+		return nil, err
+	}
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, s.clientPub, []byte(responseKey), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &CreditInfoData{
+		SecretKey: base64.StdEncoding.EncodeToString(encryptedKey),
+		Content:   encryptedContent,
+	}, nil
+}
+
+func writeStandInJSON(w http.ResponseWriter, response CreditInfoResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// defaultStandInCreditRecords 离线开发使用的企业信用数据
+func defaultStandInCreditRecords() []CreditInfo {
+	return []CreditInfo{
+		{
+			CompanyName:       "腾讯科技(深圳)有限公司",
+			CompanyCode:       "91440300708461136T",
+			CreditLevel:       "AAA",
+			RiskLevel:         "低风险",
+			ComplianceStatus:  "合规",
+			BusinessStatus:    "存续",
+			LegalPerson:       "马化腾",
+			RegisteredCapital: "2000000万元",
+			FoundedDate:       "1998-11-11",
+			Industry:          "互联网",
+			Address:           "深圳市南山区",
+			RiskFactors:       []string{},
+			CreditScore:       95,
+			ComplianceItems:   []string{"税务合规", "工商合规", "劳动合规"},
+		},
+		{
+			CompanyName:       "阿里巴巴集团控股有限公司",
+			CompanyCode:       "91330100MA27XN3X8N",
+			CreditLevel:       "AAA",
+			RiskLevel:         "低风险",
+			ComplianceStatus:  "合规",
+			BusinessStatus:    "存续",
+			LegalPerson:       "张勇",
+			RegisteredCapital: "1000000万元",
+			FoundedDate:       "1999-09-09",
+			Industry:          "电子商务",
+			Address:           "杭州市余杭区",
+			RiskFactors:       []string{},
+			CreditScore:       95,
+			ComplianceItems:   []string{"税务合规", "工商合规", "劳动合规"},
+		},
+		{
+			CompanyName:       "百度在线网络技术(北京)有限公司",
+			CompanyCode:       "91110000100000000X",
+			CreditLevel:       "AA",
+			RiskLevel:         "中低风险",
+			ComplianceStatus:  "合规",
+			BusinessStatus:    "存续",
+			LegalPerson:       "李彦宏",
+			RegisteredCapital: "500000万元",
+			FoundedDate:       "2000-01-01",
+			Industry:          "人工智能",
+			Address:           "北京市海淀区",
+			RiskFactors:       []string{"市场竞争激烈"},
+			CreditScore:       85,
+			ComplianceItems:   []string{"税务合规", "工商合规", "劳动合规"},
+		},
+		{
+			CompanyName:       "字节跳动科技有限公司",
+			CompanyCode:       "91110000MA0012345X",
+			CreditLevel:       "AA",
+			RiskLevel:         "中低风险",
+			ComplianceStatus:  "合规",
+			BusinessStatus:    "存续",
+			LegalPerson:       "张一鸣",
+			RegisteredCapital: "300000万元",
+			FoundedDate:       "2012-03-09",
+			Industry:          "互联网",
+			Address:           "北京市海淀区",
+			RiskFactors:       []string{"监管政策变化"},
+			CreditScore:       85,
+			ComplianceItems:   []string{"税务合规", "工商合规", "劳动合规"},
+		},
+		{
+			CompanyName:       "美团点评",
+			CompanyCode:       "91110000MA0012346X",
+			CreditLevel:       "A",
+			RiskLevel:         "中风险",
+			ComplianceStatus:  "合规",
+			BusinessStatus:    "存续",
+			LegalPerson:       "王兴",
+			RegisteredCapital: "100000万元",
+			FoundedDate:       "2010-03-04",
+			Industry:          "生活服务",
+			Address:           "北京市朝阳区",
+			RiskFactors:       []string{"行业竞争激烈", "监管政策变化"},
+			CreditScore:       75,
+			ComplianceItems:   []string{"税务合规", "工商合规", "劳动合规"},
+		},
+	}
+}
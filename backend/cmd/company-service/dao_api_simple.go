@@ -1,16 +1,29 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jobfirst/jobfirst-core"
+	"gorm.io/gorm"
 )
 
+// 到期提案的检查间隔
+const daoProposalCloseInterval = time.Minute
+
 // DAO API路由设置
 func setupDAORoutes(r *gin.Engine, core *jobfirst.Core) {
+	gov := NewDAOGovernance(core.GetDB())
+	if err := gov.AutoMigrate(); err != nil {
+		log.Printf("DAO数据表迁移失败: %v", err)
+	}
+	gov.StartScheduler(context.Background(), daoProposalCloseInterval)
+
 	// DAO管理API路由组
 	dao := r.Group("/api/v1/dao")
 	authMiddleware := core.AuthMiddleware.RequireAuth()
@@ -18,120 +31,150 @@ func setupDAORoutes(r *gin.Engine, core *jobfirst.Core) {
 	{
 		// 创建企业DAO
 		dao.POST("/", func(c *gin.Context) {
-			createCompanyDAO(c, core)
+			createCompanyDAO(c, gov)
 		})
 
 		// 获取企业DAO列表
 		dao.GET("/", func(c *gin.Context) {
-			getCompanyDAOList(c, core)
+			getCompanyDAOList(c, gov)
 		})
 
 		// 获取单个DAO信息
 		dao.GET("/:id", func(c *gin.Context) {
-			getCompanyDAO(c, core)
+			getCompanyDAO(c, gov)
 		})
 
 		// 更新DAO信息
 		dao.PUT("/:id", func(c *gin.Context) {
-			updateCompanyDAO(c, core)
+			updateCompanyDAO(c, gov)
 		})
 
 		// 删除DAO
 		dao.DELETE("/:id", func(c *gin.Context) {
-			deleteCompanyDAO(c, core)
+			deleteCompanyDAO(c, gov)
 		})
 
 		// DAO成员管理
 		dao.POST("/:id/members", func(c *gin.Context) {
-			addDAOMember(c, core)
+			addDAOMember(c, gov)
+		})
+
+		dao.PUT("/:id/members/:user_id", func(c *gin.Context) {
+			updateDAOMember(c, gov)
 		})
 
 		dao.DELETE("/:id/members/:user_id", func(c *gin.Context) {
-			removeDAOMember(c, core)
+			removeDAOMember(c, gov)
 		})
 
 		dao.GET("/:id/members", func(c *gin.Context) {
-			getDAOMembers(c, core)
+			getDAOMembers(c, gov)
+		})
+
+		// 投票委托
+		dao.POST("/:id/delegation", func(c *gin.Context) {
+			setDAODelegation(c, gov)
+		})
+
+		dao.DELETE("/:id/delegation", func(c *gin.Context) {
+			revokeDAODelegation(c, gov)
+		})
+
+		dao.GET("/:id/delegations", func(c *gin.Context) {
+			getDAODelegations(c, gov)
 		})
 
 		// 提案管理
 		dao.POST("/:id/proposals", func(c *gin.Context) {
-			createProposal(c, core)
+			createProposal(c, gov)
 		})
 
 		dao.GET("/:id/proposals", func(c *gin.Context) {
-			getProposals(c, core)
+			getProposals(c, gov)
 		})
 
 		dao.GET("/proposals/:proposal_id", func(c *gin.Context) {
-			getProposal(c, core)
+			getProposal(c, gov)
 		})
 
 		dao.PUT("/proposals/:proposal_id", func(c *gin.Context) {
-			updateProposal(c, core)
+			updateProposal(c, gov)
 		})
 
 		dao.DELETE("/proposals/:proposal_id", func(c *gin.Context) {
-			deleteProposal(c, core)
+			deleteProposal(c, gov)
+		})
+
+		// 提案生命周期：草稿 -> 投票中 -> 通过/否决 -> 已执行
+		dao.POST("/proposals/:proposal_id/activate", func(c *gin.Context) {
+			activateProposal(c, gov)
+		})
+
+		dao.POST("/proposals/:proposal_id/execute", func(c *gin.Context) {
+			executeProposal(c, gov)
+		})
+
+		dao.GET("/proposals/:proposal_id/tally", func(c *gin.Context) {
+			getProposalTally(c, gov)
 		})
 
 		// 投票管理
 		dao.POST("/proposals/:proposal_id/vote", func(c *gin.Context) {
-			voteOnProposal(c, core)
+			voteOnProposal(c, gov)
 		})
 
 		dao.GET("/proposals/:proposal_id/votes", func(c *gin.Context) {
-			getProposalVotes(c, core)
+			getProposalVotes(c, gov)
 		})
 
 		// 自主管理团队
 		dao.POST("/:id/teams", func(c *gin.Context) {
-			createAutonomousTeam(c, core)
+			createAutonomousTeam(c, gov)
 		})
 
 		dao.GET("/:id/teams", func(c *gin.Context) {
-			getAutonomousTeams(c, core)
+			getAutonomousTeams(c, gov)
 		})
 
 		dao.PUT("/teams/:team_id", func(c *gin.Context) {
-			updateAutonomousTeam(c, core)
+			updateAutonomousTeam(c, gov)
 		})
 
 		dao.DELETE("/teams/:team_id", func(c *gin.Context) {
-			deleteAutonomousTeam(c, core)
+			deleteAutonomousTeam(c, gov)
 		})
 
 		// 团队成员管理
 		dao.POST("/teams/:team_id/members", func(c *gin.Context) {
-			addTeamMember(c, core)
+			addTeamMember(c, gov)
 		})
 
 		dao.DELETE("/teams/:team_id/members/:user_id", func(c *gin.Context) {
-			removeTeamMember(c, core)
+			removeTeamMember(c, gov)
 		})
 
 		dao.GET("/teams/:team_id/members", func(c *gin.Context) {
-			getTeamMembers(c, core)
+			getTeamMembers(c, gov)
 		})
 
 		// DAO活动记录
 		dao.GET("/:id/activities", func(c *gin.Context) {
-			getDAOActivities(c, core)
+			getDAOActivities(c, gov)
 		})
 
 		// DAO配置管理
 		dao.GET("/:id/settings", func(c *gin.Context) {
-			getDAOSettings(c, core)
+			getDAOSettings(c, gov)
 		})
 
 		dao.PUT("/:id/settings", func(c *gin.Context) {
-			updateDAOSettings(c, core)
+			updateDAOSettings(c, gov)
 		})
 	}
 }
 
 // 创建企业DAO
-func createCompanyDAO(c *gin.Context, core *jobfirst.Core) {
+func createCompanyDAO(c *gin.Context, gov *DAOGovernance) {
 	userIDInterface, exists := c.Get("user_id")
 	if !exists {
 		standardErrorResponse(c, http.StatusUnauthorized, "User ID not found", "")
@@ -146,7 +189,7 @@ func createCompanyDAO(c *gin.Context, core *jobfirst.Core) {
 	}
 
 	// 验证企业是否存在且用户有权限
-	db := core.GetDB()
+	db := gov.db
 	var company Company
 	if err := db.First(&company, dao.CompanyID).Error; err != nil {
 		standardErrorResponse(c, http.StatusNotFound, "Company not found", err.Error())
@@ -160,52 +203,54 @@ func createCompanyDAO(c *gin.Context, core *jobfirst.Core) {
 	}
 
 	// 创建DAO
+	now := timeNow()
 	dao.CreatedBy = userID
-	dao.CreatedAt = time.Now()
-	dao.UpdatedAt = time.Now()
+	dao.CreatedAt = now
+	dao.UpdatedAt = now
 	dao.Status = "active"
 
-	if err := db.Create(&dao).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&dao).Error; err != nil {
+			return err
+		}
+
+		// 创建者自动成为DAO成员
+		member := DAOMember{
+			DAOID:             dao.ID,
+			UserID:            userID,
+			Role:              MemberRoleFounder,
+			VotingPower:       1000, // 创始人默认投票权重
+			TokenBalance:      1000,
+			ContributionScore: 0,
+			JoinedAt:          now,
+			Status:            daoMemberActive,
+			CreatedAt:         now,
+			UpdatedAt:         now,
+		}
+		if err := tx.Create(&member).Error; err != nil {
+			return err
+		}
+
+		// 记录活动，作为哈希链的第一条
+		return gov.recordActivity(tx, dao.ID, userID, ActivityTypeDAOCreated, "DAO created successfully",
+			gin.H{"company_id": dao.CompanyID, "name": dao.Name})
+	})
+	if err != nil {
 		standardErrorResponse(c, http.StatusInternalServerError, "Failed to create DAO", err.Error())
 		return
 	}
 
-	// 创建者自动成为DAO成员
-	member := DAOMember{
-		DAOID:             dao.ID,
-		UserID:            userID,
-		Role:              "founder",
-		VotingPower:       1000, // 创始人默认投票权重
-		TokenBalance:      1000,
-		ContributionScore: 0,
-		JoinedAt:          time.Now(),
-		Status:            "active",
-		CreatedAt:         time.Now(),
-		UpdatedAt:         time.Now(),
-	}
-	db.Create(&member)
-
-	// 记录活动
-	activity := DAOActivity{
-		DAOID:        dao.ID,
-		UserID:       userID,
-		ActivityType: "dao_created",
-		Description:  "DAO created successfully",
-		CreatedAt:    time.Now(),
-	}
-	db.Create(&activity)
-
 	standardSuccessResponse(c, dao, "DAO created successfully")
 }
 
 // 获取企业DAO列表
-func getCompanyDAOList(c *gin.Context, core *jobfirst.Core) {
+func getCompanyDAOList(c *gin.Context, gov *DAOGovernance) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
 	companyID := c.Query("company_id")
 	status := c.Query("status")
 
-	db := core.GetDB()
+	db := gov.db
 	var daos []CompanyDAO
 	offset := (page - 1) * pageSize
 
@@ -234,12 +279,19 @@ func getCompanyDAOList(c *gin.Context, core *jobfirst.Core) {
 }
 
 // 获取单个DAO信息
-func getCompanyDAO(c *gin.Context, core *jobfirst.Core) {
+func getCompanyDAO(c *gin.Context, gov *DAOGovernance) {
 	daoID, _ := strconv.Atoi(c.Param("id"))
 
-	db := core.GetDB()
+	// 先关闭已到期的提案，返回的提案状态才是最新的
+	if _, err := gov.CloseExpiredProposals(uint(daoID)); err != nil {
+		standardErrorResponse(c, http.StatusInternalServerError, "Failed to close expired proposals", err.Error())
+		return
+	}
+
+	db := gov.db
 	var dao CompanyDAO
-	if err := db.Preload("Company").Preload("Members").Preload("Proposals").Preload("Teams").First(&dao, daoID).Error; err != nil {
+	if err := db.Preload("Company").Preload("Members", "status = ?", daoMemberActive).Preload("Proposals").
+		Preload("Teams", "status <> ?", teamDissolved).First(&dao, daoID).Error; err != nil {
 		standardErrorResponse(c, http.StatusNotFound, "DAO not found", err.Error())
 		return
 	}
@@ -247,8 +299,8 @@ func getCompanyDAO(c *gin.Context, core *jobfirst.Core) {
 	standardSuccessResponse(c, dao, "DAO information retrieved successfully")
 }
 
-// 更新DAO信息
-func updateCompanyDAO(c *gin.Context, core *jobfirst.Core) {
+// 更新DAO信息，治理参数通过设置接口修改
+func updateCompanyDAO(c *gin.Context, gov *DAOGovernance) {
 	daoID, _ := strconv.Atoi(c.Param("id"))
 	userIDInterface, exists := c.Get("user_id")
 	if !exists {
@@ -263,7 +315,7 @@ func updateCompanyDAO(c *gin.Context, core *jobfirst.Core) {
 		return
 	}
 
-	db := core.GetDB()
+	db := gov.db
 	var dao CompanyDAO
 	if err := db.First(&dao, daoID).Error; err != nil {
 		standardErrorResponse(c, http.StatusNotFound, "DAO not found", err.Error())
@@ -277,8 +329,14 @@ func updateCompanyDAO(c *gin.Context, core *jobfirst.Core) {
 	}
 
 	// 更新DAO信息
-	updateData.UpdatedAt = time.Now()
-	if err := db.Model(&dao).Updates(updateData).Error; err != nil {
+	if err := db.Model(&dao).Select("Name", "Description", "GovernanceToken", "ContractAddress", "UpdatedAt").
+		Updates(CompanyDAO{
+			Name:            updateData.Name,
+			Description:     updateData.Description,
+			GovernanceToken: updateData.GovernanceToken,
+			ContractAddress: updateData.ContractAddress,
+			UpdatedAt:       timeNow(),
+		}).Error; err != nil {
 		standardErrorResponse(c, http.StatusInternalServerError, "Failed to update DAO", err.Error())
 		return
 	}
@@ -287,7 +345,7 @@ func updateCompanyDAO(c *gin.Context, core *jobfirst.Core) {
 }
 
 // 删除DAO
-func deleteCompanyDAO(c *gin.Context, core *jobfirst.Core) {
+func deleteCompanyDAO(c *gin.Context, gov *DAOGovernance) {
 	daoID, _ := strconv.Atoi(c.Param("id"))
 	userIDInterface, exists := c.Get("user_id")
 	if !exists {
@@ -296,7 +354,7 @@ func deleteCompanyDAO(c *gin.Context, core *jobfirst.Core) {
 	}
 	userID := userIDInterface.(uint)
 
-	db := core.GetDB()
+	db := gov.db
 	var dao CompanyDAO
 	if err := db.First(&dao, daoID).Error; err != nil {
 		standardErrorResponse(c, http.StatusNotFound, "DAO not found", err.Error())
@@ -318,83 +376,561 @@ func deleteCompanyDAO(c *gin.Context, core *jobfirst.Core) {
 	standardSuccessResponse(c, gin.H{}, "DAO deleted successfully")
 }
 
-// 其他函数的简化实现
-func addDAOMember(c *gin.Context, core *jobfirst.Core) {
-	standardSuccessResponse(c, gin.H{"message": "Member added successfully"}, "Member added successfully")
+// 添加DAO成员（创始人或管理员）
+func addDAOMember(c *gin.Context, gov *DAOGovernance) {
+	daoID, userID, ok := daoRequestContext(c, "id")
+	if !ok {
+		return
+	}
+	var request DAOMemberInput
+	if err := c.ShouldBindJSON(&request); err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+
+	member, err := gov.AddMember(daoID, userID, request)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, member, "Member added successfully")
 }
 
-func removeDAOMember(c *gin.Context, core *jobfirst.Core) {
-	standardSuccessResponse(c, gin.H{"message": "Member removed successfully"}, "Member removed successfully")
+// 修改成员角色和投票权重（创始人或管理员）
+func updateDAOMember(c *gin.Context, gov *DAOGovernance) {
+	daoID, userID, ok := daoRequestContext(c, "id")
+	if !ok {
+		return
+	}
+	memberID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid user ID", err.Error())
+		return
+	}
+	var request DAOMemberInput
+	if err := c.ShouldBindJSON(&request); err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	request.UserID = uint(memberID)
+
+	member, err := gov.UpdateMember(daoID, userID, request)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, member, "Member updated successfully")
 }
 
-func getDAOMembers(c *gin.Context, core *jobfirst.Core) {
-	standardSuccessResponse(c, gin.H{"members": []gin.H{}}, "Members retrieved successfully")
+// 移除成员或成员自行退出
+func removeDAOMember(c *gin.Context, gov *DAOGovernance) {
+	daoID, userID, ok := daoRequestContext(c, "id")
+	if !ok {
+		return
+	}
+	memberID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid user ID", err.Error())
+		return
+	}
+
+	if err := gov.RemoveMember(daoID, userID, uint(memberID)); err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, gin.H{"user_id": memberID}, "Member removed successfully")
 }
 
-func createProposal(c *gin.Context, core *jobfirst.Core) {
-	standardSuccessResponse(c, gin.H{"message": "Proposal created successfully"}, "Proposal created successfully")
+func getDAOMembers(c *gin.Context, gov *DAOGovernance) {
+	daoID, _, ok := daoRequestContext(c, "id")
+	if !ok {
+		return
+	}
+
+	members, err := gov.ListMembers(daoID)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, gin.H{"members": members, "total": len(members)}, "Members retrieved successfully")
 }
 
-func getProposals(c *gin.Context, core *jobfirst.Core) {
-	standardSuccessResponse(c, gin.H{"proposals": []gin.H{}}, "Proposals retrieved successfully")
+// 将投票权委托给其他成员
+func setDAODelegation(c *gin.Context, gov *DAOGovernance) {
+	daoID, userID, ok := daoRequestContext(c, "id")
+	if !ok {
+		return
+	}
+	var request struct {
+		DelegateID uint `json:"delegate_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+
+	delegation, err := gov.SetDelegation(daoID, userID, request.DelegateID)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, delegation, "Delegation set successfully")
 }
 
-func getProposal(c *gin.Context, core *jobfirst.Core) {
-	standardSuccessResponse(c, gin.H{"proposal": gin.H{}}, "Proposal retrieved successfully")
+func revokeDAODelegation(c *gin.Context, gov *DAOGovernance) {
+	daoID, userID, ok := daoRequestContext(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := gov.RevokeDelegation(daoID, userID); err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, gin.H{}, "Delegation revoked successfully")
 }
 
-func updateProposal(c *gin.Context, core *jobfirst.Core) {
-	standardSuccessResponse(c, gin.H{"message": "Proposal updated successfully"}, "Proposal updated successfully")
+func getDAODelegations(c *gin.Context, gov *DAOGovernance) {
+	daoID, _, ok := daoRequestContext(c, "id")
+	if !ok {
+		return
+	}
+
+	delegations, err := gov.ListDelegations(daoID)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, gin.H{"delegations": delegations}, "Delegations retrieved successfully")
 }
 
-func deleteProposal(c *gin.Context, core *jobfirst.Core) {
-	standardSuccessResponse(c, gin.H{"message": "Proposal deleted successfully"}, "Proposal deleted successfully")
+// 创建提案草稿
+func createProposal(c *gin.Context, gov *DAOGovernance) {
+	daoID, userID, ok := daoRequestContext(c, "id")
+	if !ok {
+		return
+	}
+	var request DAOProposalInput
+	if err := c.ShouldBindJSON(&request); err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+
+	proposal, err := gov.CreateProposal(daoID, userID, request)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, proposal, "Proposal created successfully")
 }
 
-func voteOnProposal(c *gin.Context, core *jobfirst.Core) {
-	standardSuccessResponse(c, gin.H{"message": "Vote recorded successfully"}, "Vote recorded successfully")
+func getProposals(c *gin.Context, gov *DAOGovernance) {
+	daoID, _, ok := daoRequestContext(c, "id")
+	if !ok {
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	proposals, total, err := gov.ListProposals(daoID, c.Query("status"), (page-1)*pageSize, pageSize)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, gin.H{
+		"proposals": proposals,
+		"total":     total,
+		"page":      page,
+		"size":      pageSize,
+	}, "Proposals retrieved successfully")
 }
 
-func getProposalVotes(c *gin.Context, core *jobfirst.Core) {
-	standardSuccessResponse(c, gin.H{"votes": []gin.H{}}, "Votes retrieved successfully")
+func getProposal(c *gin.Context, gov *DAOGovernance) {
+	proposalID, _, ok := daoRequestContext(c, "proposal_id")
+	if !ok {
+		return
+	}
+
+	proposal, err := gov.GetProposal(proposalID)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, proposal, "Proposal retrieved successfully")
 }
 
-func createAutonomousTeam(c *gin.Context, core *jobfirst.Core) {
-	standardSuccessResponse(c, gin.H{"message": "Team created successfully"}, "Team created successfully")
+// 修改草稿（提案人）
+func updateProposal(c *gin.Context, gov *DAOGovernance) {
+	proposalID, userID, ok := daoRequestContext(c, "proposal_id")
+	if !ok {
+		return
+	}
+	var request DAOProposalInput
+	if err := c.ShouldBindJSON(&request); err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+
+	proposal, err := gov.UpdateProposal(proposalID, userID, request)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, proposal, "Proposal updated successfully")
 }
 
-func getAutonomousTeams(c *gin.Context, core *jobfirst.Core) {
-	standardSuccessResponse(c, gin.H{"teams": []gin.H{}}, "Teams retrieved successfully")
+func deleteProposal(c *gin.Context, gov *DAOGovernance) {
+	proposalID, userID, ok := daoRequestContext(c, "proposal_id")
+	if !ok {
+		return
+	}
+
+	if err := gov.DeleteProposal(proposalID, userID); err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, gin.H{}, "Proposal deleted successfully")
 }
 
-func updateAutonomousTeam(c *gin.Context, core *jobfirst.Core) {
-	standardSuccessResponse(c, gin.H{"message": "Team updated successfully"}, "Team updated successfully")
+// 开始投票
+func activateProposal(c *gin.Context, gov *DAOGovernance) {
+	proposalID, userID, ok := daoRequestContext(c, "proposal_id")
+	if !ok {
+		return
+	}
+
+	proposal, err := gov.ActivateProposal(proposalID, userID)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, proposal, "Voting opened successfully")
 }
 
-func deleteAutonomousTeam(c *gin.Context, core *jobfirst.Core) {
-	standardSuccessResponse(c, gin.H{"message": "Team deleted successfully"}, "Team deleted successfully")
+// 执行已通过的提案
+func executeProposal(c *gin.Context, gov *DAOGovernance) {
+	proposalID, userID, ok := daoRequestContext(c, "proposal_id")
+	if !ok {
+		return
+	}
+
+	proposal, err := gov.ExecuteProposal(proposalID, userID)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, proposal, "Proposal executed successfully")
+}
+
+func getProposalTally(c *gin.Context, gov *DAOGovernance) {
+	proposalID, _, ok := daoRequestContext(c, "proposal_id")
+	if !ok {
+		return
+	}
+
+	tally, err := gov.GetTally(proposalID)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, tally, "Tally retrieved successfully")
+}
+
+// 投票，截止前可以改票
+func voteOnProposal(c *gin.Context, gov *DAOGovernance) {
+	proposalID, userID, ok := daoRequestContext(c, "proposal_id")
+	if !ok {
+		return
+	}
+	var request struct {
+		VoteType   string `json:"vote_type" binding:"required"`
+		VoteReason string `json:"vote_reason"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+
+	vote, tally, err := gov.CastVote(proposalID, userID, request.VoteType, request.VoteReason)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, gin.H{"vote": vote, "tally": tally}, "Vote recorded successfully")
+}
+
+func getProposalVotes(c *gin.Context, gov *DAOGovernance) {
+	proposalID, _, ok := daoRequestContext(c, "proposal_id")
+	if !ok {
+		return
+	}
+
+	votes, err := gov.ListVotes(proposalID)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, gin.H{"votes": votes}, "Votes retrieved successfully")
+}
+
+// 创建团队（创始人或管理员），预算通过预算分配提案拨付
+func createAutonomousTeam(c *gin.Context, gov *DAOGovernance) {
+	daoID, userID, ok := daoRequestContext(c, "id")
+	if !ok {
+		return
+	}
+	var request AutonomousTeamInput
+	if err := c.ShouldBindJSON(&request); err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+
+	team, err := gov.CreateTeam(daoID, userID, request)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, team, "Team created successfully")
+}
+
+func getAutonomousTeams(c *gin.Context, gov *DAOGovernance) {
+	daoID, _, ok := daoRequestContext(c, "id")
+	if !ok {
+		return
+	}
+
+	teams, err := gov.ListTeams(daoID)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, gin.H{"teams": teams}, "Teams retrieved successfully")
+}
+
+func updateAutonomousTeam(c *gin.Context, gov *DAOGovernance) {
+	teamID, userID, ok := daoRequestContext(c, "team_id")
+	if !ok {
+		return
+	}
+	var request AutonomousTeamInput
+	if err := c.ShouldBindJSON(&request); err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+
+	team, err := gov.UpdateTeam(teamID, userID, request)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, team, "Team updated successfully")
+}
+
+func deleteAutonomousTeam(c *gin.Context, gov *DAOGovernance) {
+	teamID, userID, ok := daoRequestContext(c, "team_id")
+	if !ok {
+		return
+	}
+
+	if err := gov.DissolveTeam(teamID, userID); err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, gin.H{}, "Team deleted successfully")
 }
 
-func addTeamMember(c *gin.Context, core *jobfirst.Core) {
-	standardSuccessResponse(c, gin.H{"message": "Team member added successfully"}, "Team member added successfully")
+func addTeamMember(c *gin.Context, gov *DAOGovernance) {
+	teamID, userID, ok := daoRequestContext(c, "team_id")
+	if !ok {
+		return
+	}
+	var request struct {
+		UserID uint   `json:"user_id" binding:"required"`
+		Role   string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+
+	member, err := gov.AddTeamMember(teamID, userID, request.UserID, request.Role)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, member, "Team member added successfully")
 }
 
-func removeTeamMember(c *gin.Context, core *jobfirst.Core) {
-	standardSuccessResponse(c, gin.H{"message": "Team member removed successfully"}, "Team member removed successfully")
+func removeTeamMember(c *gin.Context, gov *DAOGovernance) {
+	teamID, userID, ok := daoRequestContext(c, "team_id")
+	if !ok {
+		return
+	}
+	memberID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid user ID", err.Error())
+		return
+	}
+
+	if err := gov.RemoveTeamMember(teamID, userID, uint(memberID)); err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, gin.H{"user_id": memberID}, "Team member removed successfully")
 }
 
-func getTeamMembers(c *gin.Context, core *jobfirst.Core) {
-	standardSuccessResponse(c, gin.H{"members": []gin.H{}}, "Team members retrieved successfully")
+func getTeamMembers(c *gin.Context, gov *DAOGovernance) {
+	teamID, _, ok := daoRequestContext(c, "team_id")
+	if !ok {
+		return
+	}
+
+	members, err := gov.ListTeamMembers(teamID)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, gin.H{"members": members}, "Team members retrieved successfully")
 }
 
-func getDAOActivities(c *gin.Context, core *jobfirst.Core) {
-	standardSuccessResponse(c, gin.H{"activities": []gin.H{}}, "Activities retrieved successfully")
+// 活动记录，verify=true时同时校验哈希链
+func getDAOActivities(c *gin.Context, gov *DAOGovernance) {
+	daoID, _, ok := daoRequestContext(c, "id")
+	if !ok {
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	activities, total, err := gov.ListActivities(daoID, c.Query("type"), (page-1)*pageSize, pageSize)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	response := gin.H{
+		"activities": activities,
+		"total":      total,
+		"page":       page,
+		"size":       pageSize,
+	}
+	if c.Query("verify") == "true" {
+		report, err := gov.VerifyActivityChain(daoID)
+		if err != nil {
+			respondDAOError(c, err)
+			return
+		}
+		response["verification"] = report
+	}
+
+	standardSuccessResponse(c, response, "Activities retrieved successfully")
+}
+
+func getDAOSettings(c *gin.Context, gov *DAOGovernance) {
+	daoID, _, ok := daoRequestContext(c, "id")
+	if !ok {
+		return
+	}
+
+	settings, err := gov.LoadSettings(daoID)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, gin.H{"settings": settings}, "Settings retrieved successfully")
+}
+
+// 修改治理参数（创始人或管理员）
+func updateDAOSettings(c *gin.Context, gov *DAOGovernance) {
+	daoID, userID, ok := daoRequestContext(c, "id")
+	if !ok {
+		return
+	}
+	var request map[string]interface{}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+
+	settings, err := gov.UpdateSettings(daoID, userID, request)
+	if err != nil {
+		respondDAOError(c, err)
+		return
+	}
+
+	standardSuccessResponse(c, gin.H{"settings": settings}, "Settings updated successfully")
 }
 
-func getDAOSettings(c *gin.Context, core *jobfirst.Core) {
-	standardSuccessResponse(c, gin.H{"settings": []gin.H{}}, "Settings retrieved successfully")
+// daoRequestContext 解析路径中的ID和当前用户，失败时已写入响应
+func daoRequestContext(c *gin.Context, param string) (uint, uint, bool) {
+	id, err := strconv.ParseUint(c.Param(param), 10, 64)
+	if err != nil || id == 0 {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid ID", c.Param(param))
+		return 0, 0, false
+	}
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		standardErrorResponse(c, http.StatusUnauthorized, "User ID not found", "")
+		return 0, 0, false
+	}
+	return uint(id), userIDInterface.(uint), true
 }
 
-func updateDAOSettings(c *gin.Context, core *jobfirst.Core) {
-	standardSuccessResponse(c, gin.H{"message": "Settings updated successfully"}, "Settings updated successfully")
+// respondDAOError 将治理错误映射为HTTP状态码
+func respondDAOError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrDAONotFound):
+		standardErrorResponse(c, http.StatusNotFound, "DAO not found", err.Error())
+	case errors.Is(err, ErrProposalNotFound):
+		standardErrorResponse(c, http.StatusNotFound, "Proposal not found", err.Error())
+	case errors.Is(err, ErrTeamNotFound):
+		standardErrorResponse(c, http.StatusNotFound, "Team not found", err.Error())
+	case errors.Is(err, ErrDAOForbidden), errors.Is(err, ErrNotDAOMember):
+		standardErrorResponse(c, http.StatusForbidden, "No permission for this DAO operation", err.Error())
+	case errors.Is(err, ErrProposalState):
+		standardErrorResponse(c, http.StatusConflict, "Proposal state conflict", err.Error())
+	case errors.Is(err, ErrProposalPayload):
+		standardErrorResponse(c, http.StatusUnprocessableEntity, "Proposal cannot be executed", err.Error())
+	case errors.Is(err, ErrInvalidGovernance):
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid DAO request", err.Error())
+	default:
+		standardErrorResponse(c, http.StatusInternalServerError, "DAO operation failed", err.Error())
+	}
 }
@@ -0,0 +1,1738 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrDAONotFound       = errors.New("dao not found")
+	ErrDAOForbidden      = errors.New("no permission for this dao operation")
+	ErrNotDAOMember      = errors.New("user is not an active dao member")
+	ErrProposalNotFound  = errors.New("proposal not found")
+	ErrTeamNotFound      = errors.New("team not found")
+	ErrProposalState     = errors.New("operation not allowed in current proposal state")
+	ErrInvalidGovernance = errors.New("invalid governance request")
+	ErrActivityImmutable = errors.New("dao activity log is append-only")
+	ErrProposalPayload   = errors.New("proposal data cannot be applied")
+)
+
+// 成员、团队状态
+const (
+	daoMemberActive = "active"
+	daoMemberLeft   = "left"
+	teamDissolved   = "dissolved"
+)
+
+// BeforeUpdate 活动日志只允许追加
+func (a *DAOActivity) BeforeUpdate(tx *gorm.DB) error {
+	return ErrActivityImmutable
+}
+
+// BeforeDelete 活动日志只允许追加
+func (a *DAOActivity) BeforeDelete(tx *gorm.DB) error {
+	return ErrActivityImmutable
+}
+
+// DAOGovernance DAO治理引擎：成员管理、提案生命周期、投票计票、委托和执行。
+// 所有写操作在事务中先锁定DAO记录，同一DAO的操作串行执行，活动日志的哈希链因此保持连续
+type DAOGovernance struct {
+	db *gorm.DB
+}
+
+// NewDAOGovernance 创建治理引擎
+func NewDAOGovernance(db *gorm.DB) *DAOGovernance {
+	return &DAOGovernance{db: db}
+}
+
+// AutoMigrate 创建治理相关的表
+func (g *DAOGovernance) AutoMigrate() error {
+	return g.db.AutoMigrate(&CompanyDAO{}, &DAOMember{}, &DAOProposal{}, &DAOVote{},
+		&DAODelegation{}, &AutonomousTeam{}, &TeamMember{}, &DAOActivity{}, &DAOSetting{})
+}
+
+// StartScheduler 定期关闭已到截止时间的提案
+func (g *DAOGovernance) StartScheduler(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if closed, err := g.CloseExpiredProposals(0); err != nil {
+					log.Printf("关闭到期提案失败: %v", err)
+				} else if closed > 0 {
+					log.Printf("已关闭%d个到期提案", closed)
+				}
+			}
+		}
+	}()
+}
+
+// DAOGovernanceSettings 生效的治理参数：DAO设置优先，未设置时使用DAO本身的字段或默认值
+type DAOGovernanceSettings struct {
+	VotingMode string `json:"voting_mode"`
+	// QuorumPercent 参与投票（含弃权）的权重占可投票总权重的最低比例
+	QuorumPercent float64 `json:"quorum_percent"`
+	// ApprovalThreshold 赞成票占赞成与反对票之和须超过的比例，100表示不能有反对票
+	ApprovalThreshold  float64 `json:"approval_threshold"`
+	VotingPeriodDays   int     `json:"voting_period_days"`
+	ExecutionDelayDays int     `json:"execution_delay_days"`
+	// ProposalThreshold 激活提案所需的最低投票权重，创始人和管理员不受限
+	ProposalThreshold uint64 `json:"proposal_threshold"`
+	DelegationEnabled bool   `json:"delegation_enabled"`
+}
+
+const defaultQuorumPercent = 20
+
+// 可配置的治理参数及其类型
+var governanceSettingTypes = map[string]string{
+	"voting_mode":          "string",
+	"quorum_percent":       "number",
+	"approval_threshold":   "number",
+	"voting_period_days":   "number",
+	"execution_delay_days": "number",
+	"proposal_threshold":   "number",
+	"delegation_enabled":   "boolean",
+}
+
+// LoadSettings 读取DAO的治理参数
+func (g *DAOGovernance) LoadSettings(daoID uint) (*DAOGovernanceSettings, error) {
+	dao, err := g.findDAO(g.db, daoID)
+	if err != nil {
+		return nil, err
+	}
+	return g.loadSettings(g.db, dao)
+}
+
+func (g *DAOGovernance) loadSettings(tx *gorm.DB, dao *CompanyDAO) (*DAOGovernanceSettings, error) {
+	settings := &DAOGovernanceSettings{
+		VotingMode:         VotingModeWeighted,
+		QuorumPercent:      defaultQuorumPercent,
+		ApprovalThreshold:  dao.VotingThreshold,
+		VotingPeriodDays:   dao.VotingPeriod,
+		ExecutionDelayDays: dao.ExecutionDelay,
+		ProposalThreshold:  dao.ProposalThreshold,
+		DelegationEnabled:  true,
+	}
+	if settings.ApprovalThreshold <= 0 {
+		settings.ApprovalThreshold = 50
+	}
+	if settings.VotingPeriodDays <= 0 {
+		settings.VotingPeriodDays = 7
+	}
+
+	var rows []DAOSetting
+	if err := tx.Where("dao_id = ?", dao.ID).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if err := applyGovernanceSetting(settings, row.SettingKey, row.SettingValue); err != nil {
+			log.Printf("DAO %d 的设置%s无效，使用默认值: %v", dao.ID, row.SettingKey, err)
+		}
+	}
+	return settings, nil
+}
+
+// applyGovernanceSetting 校验并应用一项设置，value为存储的字符串形式
+func applyGovernanceSetting(settings *DAOGovernanceSettings, key, value string) error {
+	number := func(min, max float64) (float64, error) {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(v) || v < min || v > max {
+			return 0, fmt.Errorf("%w: %s must be a number between %g and %g", ErrInvalidGovernance, key, min, max)
+		}
+		return v, nil
+	}
+	integer := func(min, max float64) (int, error) {
+		v, err := number(min, max)
+		if err != nil {
+			return 0, err
+		}
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("%w: %s must be an integer", ErrInvalidGovernance, key)
+		}
+		return int(v), nil
+	}
+
+	switch key {
+	case "voting_mode":
+		if value != VotingModeOneMemberOneVote && value != VotingModeWeighted {
+			return fmt.Errorf("%w: voting_mode must be %s or %s", ErrInvalidGovernance, VotingModeOneMemberOneVote, VotingModeWeighted)
+		}
+		settings.VotingMode = value
+	case "quorum_percent":
+		v, err := number(0, 100)
+		if err != nil {
+			return err
+		}
+		settings.QuorumPercent = v
+	case "approval_threshold":
+		v, err := number(0, 100)
+		if err != nil {
+			return err
+		}
+		settings.ApprovalThreshold = v
+	case "voting_period_days":
+		v, err := integer(1, 90)
+		if err != nil {
+			return err
+		}
+		settings.VotingPeriodDays = v
+	case "execution_delay_days":
+		v, err := integer(0, 30)
+		if err != nil {
+			return err
+		}
+		settings.ExecutionDelayDays = v
+	case "proposal_threshold":
+		v, err := integer(0, math.MaxInt32)
+		if err != nil {
+			return err
+		}
+		settings.ProposalThreshold = uint64(v)
+	case "delegation_enabled":
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%w: delegation_enabled must be a boolean", ErrInvalidGovernance)
+		}
+		settings.DelegationEnabled = v
+	default:
+		return fmt.Errorf("%w: unknown setting %s", ErrInvalidGovernance, key)
+	}
+	return nil
+}
+
+// UpdateSettings 修改治理参数（创始人或管理员），进行中的提案使用激活时的参数
+func (g *DAOGovernance) UpdateSettings(daoID, actorID uint, values map[string]interface{}) (*DAOGovernanceSettings, error) {
+	var settings *DAOGovernanceSettings
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		dao, err := g.lockDAO(tx, daoID)
+		if err != nil {
+			return err
+		}
+		if err := g.requireManager(tx, daoID, actorID); err != nil {
+			return err
+		}
+		return g.updateSettings(tx, dao, actorID, values, &settings)
+	})
+	return settings, err
+}
+
+func (g *DAOGovernance) updateSettings(tx *gorm.DB, dao *CompanyDAO, actorID uint, values map[string]interface{}, out **DAOGovernanceSettings) error {
+	if len(values) == 0 {
+		return fmt.Errorf("%w: no settings provided", ErrInvalidGovernance)
+	}
+	settings, err := g.loadSettings(tx, dao)
+	if err != nil {
+		return err
+	}
+	stored := make(map[string]string, len(values))
+	for key, raw := range values {
+		settingType, ok := governanceSettingTypes[key]
+		if !ok {
+			return fmt.Errorf("%w: unknown setting %s", ErrInvalidGovernance, key)
+		}
+		var value string
+		switch v := raw.(type) {
+		case string:
+			value = v
+		case bool:
+			value = strconv.FormatBool(v)
+		case float64:
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		case json.Number:
+			value = v.String()
+		default:
+			return fmt.Errorf("%w: unsupported value for %s", ErrInvalidGovernance, key)
+		}
+		if err := applyGovernanceSetting(settings, key, value); err != nil {
+			return err
+		}
+		stored[key] = value
+
+		now := timeNow()
+		var row DAOSetting
+		err := tx.Where("dao_id = ? AND setting_key = ?", dao.ID, key).First(&row).Error
+		switch {
+		case err == nil:
+			if err := tx.Model(&row).Updates(map[string]interface{}{"setting_value": value, "updated_at": now}).Error; err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := tx.Create(&DAOSetting{
+				DAOID:        dao.ID,
+				SettingKey:   key,
+				SettingValue: value,
+				SettingType:  settingType,
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			}).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+	}
+	*out = settings
+	return g.recordActivity(tx, dao.ID, actorID, ActivityTypeSettingsUpdated, "Governance settings updated", stored)
+}
+
+// DAOMemberInput 添加或修改成员的参数
+type DAOMemberInput struct {
+	UserID       uint    `json:"user_id"`
+	Role         string  `json:"role"`
+	VotingPower  *uint64 `json:"voting_power"`
+	TokenBalance *uint64 `json:"token_balance"`
+}
+
+// 新成员默认投票权重
+const defaultMemberVotingPower = 100
+
+// AddMember 添加成员（创始人或管理员）；已退出的成员重新加入
+func (g *DAOGovernance) AddMember(daoID, actorID uint, in DAOMemberInput) (*DAOMember, error) {
+	var member *DAOMember
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := g.lockDAO(tx, daoID); err != nil {
+			return err
+		}
+		if err := g.requireManager(tx, daoID, actorID); err != nil {
+			return err
+		}
+		var err error
+		member, err = g.addMember(tx, daoID, actorID, in)
+		return err
+	})
+	return member, err
+}
+
+func (g *DAOGovernance) addMember(tx *gorm.DB, daoID, actorID uint, in DAOMemberInput) (*DAOMember, error) {
+	if in.UserID == 0 {
+		return nil, fmt.Errorf("%w: user_id is required", ErrInvalidGovernance)
+	}
+	role := in.Role
+	if role == "" {
+		role = MemberRoleMember
+	}
+	if err := validateMemberRole(role); err != nil {
+		return nil, err
+	}
+
+	now := timeNow()
+	var member DAOMember
+	err := tx.Where("dao_id = ? AND user_id = ?", daoID, in.UserID).First(&member).Error
+	switch {
+	case err == nil && member.Status == daoMemberActive:
+		return nil, fmt.Errorf("%w: user %d is already a member", ErrInvalidGovernance, in.UserID)
+	case err == nil:
+		member.Status = daoMemberActive
+		member.JoinedAt = now
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		member = DAOMember{
+			DAOID:       daoID,
+			UserID:      in.UserID,
+			VotingPower: defaultMemberVotingPower,
+			JoinedAt:    now,
+			Status:      daoMemberActive,
+			CreatedAt:   now,
+		}
+	default:
+		return nil, err
+	}
+	member.Role = role
+	if in.VotingPower != nil {
+		member.VotingPower = *in.VotingPower
+	}
+	if in.TokenBalance != nil {
+		member.TokenBalance = *in.TokenBalance
+	}
+	member.UpdatedAt = now
+	if err := tx.Save(&member).Error; err != nil {
+		return nil, err
+	}
+	if err := g.recordActivity(tx, daoID, actorID, ActivityTypeMemberJoined, fmt.Sprintf("User %d joined as %s", member.UserID, role),
+		gin.H{"user_id": member.UserID, "role": role, "voting_power": member.VotingPower}); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// UpdateMember 修改成员角色、投票权重或代币余额（创始人或管理员）
+func (g *DAOGovernance) UpdateMember(daoID, actorID uint, in DAOMemberInput) (*DAOMember, error) {
+	var member *DAOMember
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := g.lockDAO(tx, daoID); err != nil {
+			return err
+		}
+		if err := g.requireManager(tx, daoID, actorID); err != nil {
+			return err
+		}
+		var err error
+		member, err = g.updateMember(tx, daoID, actorID, in)
+		return err
+	})
+	return member, err
+}
+
+func (g *DAOGovernance) updateMember(tx *gorm.DB, daoID, actorID uint, in DAOMemberInput) (*DAOMember, error) {
+	member, err := g.activeMember(tx, daoID, in.UserID)
+	if err != nil {
+		return nil, err
+	}
+	changes := gin.H{"user_id": member.UserID}
+	if in.Role != "" && in.Role != member.Role {
+		if member.Role == MemberRoleFounder {
+			return nil, fmt.Errorf("%w: the founder role cannot be changed", ErrInvalidGovernance)
+		}
+		if err := validateMemberRole(in.Role); err != nil {
+			return nil, err
+		}
+		member.Role = in.Role
+		changes["role"] = in.Role
+	}
+	if in.VotingPower != nil {
+		member.VotingPower = *in.VotingPower
+		changes["voting_power"] = *in.VotingPower
+	}
+	if in.TokenBalance != nil {
+		member.TokenBalance = *in.TokenBalance
+		changes["token_balance"] = *in.TokenBalance
+	}
+	member.UpdatedAt = timeNow()
+	if err := tx.Save(member).Error; err != nil {
+		return nil, err
+	}
+	if err := g.recordActivity(tx, daoID, actorID, ActivityTypeMemberUpdated, fmt.Sprintf("Member %d updated", member.UserID), changes); err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// RemoveMember 移除成员（创始人、管理员或成员本人），同时撤销相关的委托
+func (g *DAOGovernance) RemoveMember(daoID, actorID, userID uint) error {
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := g.lockDAO(tx, daoID); err != nil {
+			return err
+		}
+		if actorID != userID {
+			if err := g.requireManager(tx, daoID, actorID); err != nil {
+				return err
+			}
+		}
+		return g.removeMember(tx, daoID, actorID, userID)
+	})
+}
+
+func (g *DAOGovernance) removeMember(tx *gorm.DB, daoID, actorID, userID uint) error {
+	member, err := g.activeMember(tx, daoID, userID)
+	if err != nil {
+		return err
+	}
+	if member.Role == MemberRoleFounder {
+		return fmt.Errorf("%w: the founder cannot leave the dao", ErrInvalidGovernance)
+	}
+	now := timeNow()
+	if err := tx.Model(member).Updates(map[string]interface{}{"status": daoMemberLeft, "updated_at": now}).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&DAODelegation{}).
+		Where("dao_id = ? AND revoked_at IS NULL AND (delegator_id = ? OR delegate_id = ?)", daoID, userID, userID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	return g.recordActivity(tx, daoID, actorID, ActivityTypeMemberLeft, fmt.Sprintf("User %d left", userID), gin.H{"user_id": userID})
+}
+
+// ListMembers 列出在任成员
+func (g *DAOGovernance) ListMembers(daoID uint) ([]DAOMember, error) {
+	if _, err := g.findDAO(g.db, daoID); err != nil {
+		return nil, err
+	}
+	var members []DAOMember
+	err := g.db.Where("dao_id = ? AND status = ?", daoID, daoMemberActive).Order("joined_at ASC").Find(&members).Error
+	return members, err
+}
+
+func validateMemberRole(role string) error {
+	switch role {
+	case MemberRoleAdmin, MemberRoleMember, MemberRoleContributor:
+		return nil
+	}
+	return fmt.Errorf("%w: invalid member role %s", ErrInvalidGovernance, role)
+}
+
+// SetDelegation 将投票权委托给另一成员，替换已有委托
+func (g *DAOGovernance) SetDelegation(daoID, delegatorID, delegateID uint) (*DAODelegation, error) {
+	var delegation *DAODelegation
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		dao, err := g.lockDAO(tx, daoID)
+		if err != nil {
+			return err
+		}
+		settings, err := g.loadSettings(tx, dao)
+		if err != nil {
+			return err
+		}
+		if !settings.DelegationEnabled {
+			return fmt.Errorf("%w: delegation is disabled for this dao", ErrInvalidGovernance)
+		}
+		if delegatorID == delegateID {
+			return fmt.Errorf("%w: cannot delegate to yourself", ErrInvalidGovernance)
+		}
+		if _, err := g.activeMember(tx, daoID, delegatorID); err != nil {
+			return err
+		}
+		if _, err := g.activeMember(tx, daoID, delegateID); err != nil {
+			return err
+		}
+
+		now := timeNow()
+		if err := tx.Model(&DAODelegation{}).
+			Where("dao_id = ? AND delegator_id = ? AND revoked_at IS NULL", daoID, delegatorID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		delegation = &DAODelegation{DAOID: daoID, DelegatorID: delegatorID, DelegateID: delegateID, CreatedAt: now}
+		if err := tx.Create(delegation).Error; err != nil {
+			return err
+		}
+		return g.recordActivity(tx, daoID, delegatorID, ActivityTypeDelegationSet,
+			fmt.Sprintf("User %d delegated voting power to %d", delegatorID, delegateID),
+			gin.H{"delegator_id": delegatorID, "delegate_id": delegateID})
+	})
+	return delegation, err
+}
+
+// RevokeDelegation 撤销委托
+func (g *DAOGovernance) RevokeDelegation(daoID, delegatorID uint) error {
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := g.lockDAO(tx, daoID); err != nil {
+			return err
+		}
+		result := tx.Model(&DAODelegation{}).
+			Where("dao_id = ? AND delegator_id = ? AND revoked_at IS NULL", daoID, delegatorID).
+			Update("revoked_at", timeNow())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w: no active delegation", ErrInvalidGovernance)
+		}
+		return g.recordActivity(tx, daoID, delegatorID, ActivityTypeDelegationRevoked,
+			fmt.Sprintf("User %d revoked delegation", delegatorID), gin.H{"delegator_id": delegatorID})
+	})
+}
+
+// ListDelegations 列出生效中的委托
+func (g *DAOGovernance) ListDelegations(daoID uint) ([]DAODelegation, error) {
+	var delegations []DAODelegation
+	err := g.db.Where("dao_id = ? AND revoked_at IS NULL", daoID).Order("created_at ASC").Find(&delegations).Error
+	return delegations, err
+}
+
+// DAOProposalInput 创建或修改提案的参数
+type DAOProposalInput struct {
+	Title        string          `json:"title"`
+	Description  string          `json:"description"`
+	ProposalType string          `json:"proposal_type"`
+	ProposalData json.RawMessage `json:"proposal_data"`
+}
+
+// 各类提案执行时的参数
+type budgetAllocationData struct {
+	TeamID uint   `json:"team_id"`
+	Amount uint64 `json:"amount"`
+}
+
+type memberManagementData struct {
+	Action       string  `json:"action"` // add, update, remove
+	UserID       uint    `json:"user_id"`
+	Role         string  `json:"role"`
+	VotingPower  *uint64 `json:"voting_power"`
+	TokenBalance *uint64 `json:"token_balance"`
+}
+
+type policyChangeData struct {
+	Settings map[string]interface{} `json:"settings"`
+}
+
+type teamStructureData struct {
+	Action      string `json:"action"` // create, dissolve
+	TeamID      uint   `json:"team_id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	LeaderID    uint   `json:"leader_id"`
+	Budget      uint64 `json:"budget"`
+	MaxMembers  int    `json:"max_members"`
+}
+
+// validateProposalData 创建提案时校验执行参数，避免通过后才发现无法执行
+func validateProposalData(proposalType string, data json.RawMessage) error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: "+format, append([]interface{}{ErrInvalidGovernance}, args...)...)
+	}
+	decode := func(v interface{}) error {
+		if len(data) == 0 {
+			return invalid("proposal_data is required for %s proposals", proposalType)
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			return invalid("invalid proposal_data: %v", err)
+		}
+		return nil
+	}
+
+	switch proposalType {
+	case ProposalTypeBudgetAllocation:
+		var d budgetAllocationData
+		if err := decode(&d); err != nil {
+			return err
+		}
+		if d.TeamID == 0 || d.Amount == 0 {
+			return invalid("budget allocation requires team_id and amount")
+		}
+	case ProposalTypeMemberManagement:
+		var d memberManagementData
+		if err := decode(&d); err != nil {
+			return err
+		}
+		if d.UserID == 0 {
+			return invalid("member management requires user_id")
+		}
+		switch d.Action {
+		case "add", "update", "remove":
+		default:
+			return invalid("member management action must be add, update or remove")
+		}
+		if d.Role != "" {
+			if err := validateMemberRole(d.Role); err != nil {
+				return err
+			}
+		}
+	case ProposalTypePolicyChange:
+		var d policyChangeData
+		if err := decode(&d); err != nil {
+			return err
+		}
+		if len(d.Settings) == 0 {
+			return invalid("policy change requires settings")
+		}
+		for key := range d.Settings {
+			if _, ok := governanceSettingTypes[key]; !ok {
+				return invalid("unknown setting %s", key)
+			}
+		}
+	case ProposalTypeTeamStructure:
+		var d teamStructureData
+		if err := decode(&d); err != nil {
+			return err
+		}
+		switch {
+		case d.Action == "create" && (d.Name == "" || d.LeaderID == 0):
+			return invalid("creating a team requires name and leader_id")
+		case d.Action == "dissolve" && d.TeamID == 0:
+			return invalid("dissolving a team requires team_id")
+		case d.Action != "create" && d.Action != "dissolve":
+			return invalid("team structure action must be create or dissolve")
+		}
+	case ProposalTypeProjectApproval, ProposalTypeOther:
+		if len(data) > 0 && !json.Valid(data) {
+			return invalid("proposal_data must be valid JSON")
+		}
+	default:
+		return invalid("unknown proposal type %s", proposalType)
+	}
+	return nil
+}
+
+// CreateProposal 成员创建提案草稿
+func (g *DAOGovernance) CreateProposal(daoID, proposerID uint, in DAOProposalInput) (*DAOProposal, error) {
+	if strings.TrimSpace(in.Title) == "" {
+		return nil, fmt.Errorf("%w: title is required", ErrInvalidGovernance)
+	}
+	if in.ProposalType == "" {
+		in.ProposalType = ProposalTypeOther
+	}
+	if err := validateProposalData(in.ProposalType, in.ProposalData); err != nil {
+		return nil, err
+	}
+
+	var proposal *DAOProposal
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := g.lockDAO(tx, daoID); err != nil {
+			return err
+		}
+		if _, err := g.activeMember(tx, daoID, proposerID); err != nil {
+			return err
+		}
+		now := timeNow()
+		proposal = &DAOProposal{
+			DAOID:        daoID,
+			Title:        in.Title,
+			Description:  in.Description,
+			ProposerID:   proposerID,
+			ProposalType: in.ProposalType,
+			ProposalData: jsonOrNull(in.ProposalData),
+			Status:       ProposalStatusDraft,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		if err := tx.Create(proposal).Error; err != nil {
+			return err
+		}
+		return g.recordActivity(tx, daoID, proposerID, ActivityTypeProposalCreated, "Proposal created: "+in.Title,
+			gin.H{"proposal_id": proposal.ID, "proposal_type": in.ProposalType})
+	})
+	return proposal, err
+}
+
+// UpdateProposal 提案人修改草稿
+func (g *DAOGovernance) UpdateProposal(proposalID, actorID uint, in DAOProposalInput) (*DAOProposal, error) {
+	var proposal *DAOProposal
+	err := g.withProposal(proposalID, func(tx *gorm.DB, dao *CompanyDAO, p *DAOProposal) error {
+		if p.ProposerID != actorID {
+			return ErrDAOForbidden
+		}
+		if p.Status != ProposalStatusDraft {
+			return fmt.Errorf("%w: only draft proposals can be edited", ErrProposalState)
+		}
+		if in.Title != "" {
+			p.Title = in.Title
+		}
+		if in.Description != "" {
+			p.Description = in.Description
+		}
+		if in.ProposalType != "" || len(in.ProposalData) > 0 {
+			proposalType := p.ProposalType
+			if in.ProposalType != "" {
+				proposalType = in.ProposalType
+			}
+			data := in.ProposalData
+			if len(data) == 0 && p.ProposalData != "" && p.ProposalData != "null" {
+				data = json.RawMessage(p.ProposalData)
+			}
+			if err := validateProposalData(proposalType, data); err != nil {
+				return err
+			}
+			p.ProposalType = proposalType
+			p.ProposalData = jsonOrNull(data)
+		}
+		p.UpdatedAt = timeNow()
+		if err := tx.Save(p).Error; err != nil {
+			return err
+		}
+		proposal = p
+		return g.recordActivity(tx, dao.ID, actorID, ActivityTypeProposalUpdated, "Proposal updated: "+p.Title,
+			gin.H{"proposal_id": p.ID})
+	})
+	return proposal, err
+}
+
+// DeleteProposal 删除草稿（提案人、创始人或管理员）
+func (g *DAOGovernance) DeleteProposal(proposalID, actorID uint) error {
+	return g.withProposal(proposalID, func(tx *gorm.DB, dao *CompanyDAO, p *DAOProposal) error {
+		if p.ProposerID != actorID {
+			if err := g.requireManager(tx, dao.ID, actorID); err != nil {
+				return err
+			}
+		}
+		if p.Status != ProposalStatusDraft {
+			return fmt.Errorf("%w: only draft proposals can be deleted", ErrProposalState)
+		}
+		if err := tx.Delete(p).Error; err != nil {
+			return err
+		}
+		return g.recordActivity(tx, dao.ID, actorID, ActivityTypeProposalDeleted, "Proposal deleted: "+p.Title,
+			gin.H{"proposal_id": p.ID})
+	})
+}
+
+// ActivateProposal 开始投票：记录治理参数快照，截止时间为当前时间加投票期
+func (g *DAOGovernance) ActivateProposal(proposalID, actorID uint) (*DAOProposal, error) {
+	var proposal *DAOProposal
+	err := g.withProposal(proposalID, func(tx *gorm.DB, dao *CompanyDAO, p *DAOProposal) error {
+		if p.Status != ProposalStatusDraft {
+			return fmt.Errorf("%w: proposal is %s", ErrProposalState, p.Status)
+		}
+		actor, err := g.activeMember(tx, dao.ID, actorID)
+		if err != nil {
+			return err
+		}
+		manager := actor.Role == MemberRoleFounder || actor.Role == MemberRoleAdmin
+		if p.ProposerID != actorID && !manager {
+			return ErrDAOForbidden
+		}
+		settings, err := g.loadSettings(tx, dao)
+		if err != nil {
+			return err
+		}
+		if !manager && settings.VotingMode == VotingModeWeighted && actor.VotingPower < settings.ProposalThreshold {
+			return fmt.Errorf("%w: voting power %d is below the proposal threshold %d",
+				ErrDAOForbidden, actor.VotingPower, settings.ProposalThreshold)
+		}
+
+		now := timeNow()
+		end := now.AddDate(0, 0, settings.VotingPeriodDays)
+		p.Status = ProposalStatusActive
+		p.StartTime = &now
+		p.EndTime = &end
+		p.VotingMode = settings.VotingMode
+		p.QuorumPercent = settings.QuorumPercent
+		p.ApprovalPercent = settings.ApprovalThreshold
+		p.DelegationEnabled = settings.DelegationEnabled
+		tally, err := g.tallyProposal(tx, p, now)
+		if err != nil {
+			return err
+		}
+		tally.applyTo(p)
+		p.UpdatedAt = now
+		if err := tx.Save(p).Error; err != nil {
+			return err
+		}
+		proposal = p
+		return g.recordActivity(tx, dao.ID, actorID, ActivityTypeProposalActivated, "Voting opened: "+p.Title,
+			gin.H{"proposal_id": p.ID, "end_time": end, "voting_mode": p.VotingMode,
+				"quorum_percent": p.QuorumPercent, "approval_percent": p.ApprovalPercent})
+	})
+	return proposal, err
+}
+
+// CastVote 投票或在截止前改票；计票结果随之更新
+func (g *DAOGovernance) CastVote(proposalID, voterID uint, voteType, reason string) (*DAOVote, *ProposalTally, error) {
+	switch voteType {
+	case VoteTypeFor, VoteTypeAgainst, VoteTypeAbstain:
+	default:
+		return nil, nil, fmt.Errorf("%w: vote_type must be for, against or abstain", ErrInvalidGovernance)
+	}
+
+	var vote DAOVote
+	var tally *ProposalTally
+	err := g.withProposal(proposalID, func(tx *gorm.DB, dao *CompanyDAO, p *DAOProposal) error {
+		now := timeNow()
+		if p.Status != ProposalStatusActive || p.EndTime == nil || !now.Before(*p.EndTime) {
+			return fmt.Errorf("%w: voting is closed", ErrProposalState)
+		}
+		member, err := g.activeMember(tx, dao.ID, voterID)
+		if err != nil {
+			return err
+		}
+		if member.JoinedAt.After(*p.StartTime) {
+			return fmt.Errorf("%w: members who joined after voting opened cannot vote", ErrDAOForbidden)
+		}
+
+		activityType := ActivityTypeProposalVoted
+		data := gin.H{"proposal_id": p.ID, "vote_type": voteType}
+		err = tx.Where("proposal_id = ? AND voter_id = ?", p.ID, voterID).First(&vote).Error
+		switch {
+		case err == nil:
+			if vote.VoteType == voteType && vote.VoteReason == reason {
+				return fmt.Errorf("%w: vote unchanged", ErrInvalidGovernance)
+			}
+			activityType = ActivityTypeVoteChanged
+			data["previous_vote_type"] = vote.VoteType
+			vote.ChangeCount++
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			vote = DAOVote{ProposalID: p.ID, VoterID: voterID, CreatedAt: now}
+		default:
+			return err
+		}
+		vote.VoteType = voteType
+		vote.VoteReason = reason
+		vote.VotingPower = memberPower(p.VotingMode, member)
+		vote.VotedAt = now
+		vote.UpdatedAt = now
+		if err := tx.Save(&vote).Error; err != nil {
+			return err
+		}
+		data["voting_power"] = vote.VotingPower
+
+		tally, err = g.tallyProposal(tx, p, now)
+		if err != nil {
+			return err
+		}
+		tally.applyTo(p)
+		p.UpdatedAt = now
+		if err := tx.Save(p).Error; err != nil {
+			return err
+		}
+		return g.recordActivity(tx, dao.ID, voterID, activityType, fmt.Sprintf("Voted %s on: %s", voteType, p.Title), data)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &vote, tally, nil
+}
+
+// ProposalTally 计票结果
+type ProposalTally struct {
+	For           uint64  `json:"for"`
+	Against       uint64  `json:"against"`
+	Abstain       uint64  `json:"abstain"`
+	Delegated     uint64  `json:"delegated"` // 通过委托计入的权重
+	EligiblePower uint64  `json:"eligible_power"`
+	QuorumPower   uint64  `json:"quorum_power"`
+	Participation float64 `json:"participation"` // 百分比
+	Approval      float64 `json:"approval"`      // 赞成票占赞成与反对票之和的百分比
+	QuorumReached bool    `json:"quorum_reached"`
+	Approved      bool    `json:"approved"`
+}
+
+func (t *ProposalTally) applyTo(p *DAOProposal) {
+	p.VotesFor, p.VotesAgainst, p.VotesAbstain = t.For, t.Against, t.Abstain
+	p.TotalVotes = t.For + t.Against + t.Abstain
+	p.EligiblePower = t.EligiblePower
+	p.VotingThreshold = t.QuorumPower
+}
+
+// outcome 结束原因
+func (t *ProposalTally) outcome() string {
+	switch {
+	case !t.QuorumReached:
+		return CloseReasonQuorumNotMet
+	case !t.Approved:
+		return CloseReasonThresholdNotMet
+	}
+	return CloseReasonApproved
+}
+
+func memberPower(mode string, m *DAOMember) uint64 {
+	if mode == VotingModeOneMemberOneVote {
+		return 1
+	}
+	return m.VotingPower
+}
+
+// ComputeProposalTally 按提案的投票模式计票：投票开始时已是成员的在任成员有投票权。
+// 已投票成员按投票时快照的权重计入，投票后调整成员权重不改变已投的票；
+// 未投票成员按当前权重计算，在委托生效时随受托人的选择计入
+func ComputeProposalTally(p *DAOProposal, members []DAOMember, votes []DAOVote, delegations []DAODelegation) *ProposalTally {
+	eligible := make(map[uint]*DAOMember, len(members))
+	for i := range members {
+		m := &members[i]
+		if m.Status == daoMemberActive && (p.StartTime == nil || !m.JoinedAt.After(*p.StartTime)) {
+			eligible[m.UserID] = m
+		}
+	}
+	cast := make(map[uint]DAOVote, len(votes))
+	for _, v := range votes {
+		if eligible[v.VoterID] != nil {
+			cast[v.VoterID] = v
+		}
+	}
+	delegateOf := make(map[uint]uint)
+	if p.DelegationEnabled {
+		for _, d := range delegations {
+			delegateOf[d.DelegatorID] = d.DelegateID
+		}
+	}
+
+	t := &ProposalTally{}
+	add := func(voteType string, power uint64) {
+		switch voteType {
+		case VoteTypeFor:
+			t.For += power
+		case VoteTypeAgainst:
+			t.Against += power
+		case VoteTypeAbstain:
+			t.Abstain += power
+		}
+	}
+	for userID, m := range eligible {
+		if v, ok := cast[userID]; ok {
+			t.EligiblePower += v.VotingPower
+			add(v.VoteType, v.VotingPower)
+			continue
+		}
+		power := memberPower(p.VotingMode, m)
+		t.EligiblePower += power
+		if delegate, ok := delegateOf[userID]; ok {
+			if v, ok := cast[delegate]; ok {
+				add(v.VoteType, power)
+				t.Delegated += power
+			}
+		}
+	}
+
+	participating := t.For + t.Against + t.Abstain
+	t.QuorumPower = uint64(math.Ceil(float64(t.EligiblePower) * p.QuorumPercent / 100))
+	if t.EligiblePower > 0 {
+		t.Participation = float64(participating) * 100 / float64(t.EligiblePower)
+	}
+	t.QuorumReached = t.EligiblePower > 0 && participating >= t.QuorumPower
+	if decided := t.For + t.Against; decided > 0 {
+		t.Approval = float64(t.For) * 100 / float64(decided)
+	}
+	if p.ApprovalPercent >= 100 {
+		t.Approved = t.For > 0 && t.Against == 0
+	} else {
+		t.Approved = t.For > 0 && t.Approval > p.ApprovalPercent
+	}
+	return t
+}
+
+// tallyProposal 读取成员、投票和asOf时生效的委托后计票
+func (g *DAOGovernance) tallyProposal(tx *gorm.DB, p *DAOProposal, asOf time.Time) (*ProposalTally, error) {
+	var members []DAOMember
+	if err := tx.Where("dao_id = ? AND status = ?", p.DAOID, daoMemberActive).Find(&members).Error; err != nil {
+		return nil, err
+	}
+	var votes []DAOVote
+	if err := tx.Where("proposal_id = ?", p.ID).Find(&votes).Error; err != nil {
+		return nil, err
+	}
+	var delegations []DAODelegation
+	if p.DelegationEnabled {
+		if err := tx.Where("dao_id = ? AND created_at <= ? AND (revoked_at IS NULL OR revoked_at > ?)", p.DAOID, asOf, asOf).
+			Find(&delegations).Error; err != nil {
+			return nil, err
+		}
+	}
+	return ComputeProposalTally(p, members, votes, delegations), nil
+}
+
+// GetTally 当前计票结果，已结束的提案按截止时间计票
+func (g *DAOGovernance) GetTally(proposalID uint) (*ProposalTally, error) {
+	var p DAOProposal
+	if err := g.db.First(&p, proposalID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProposalNotFound
+		}
+		return nil, err
+	}
+	asOf := timeNow()
+	if p.EndTime != nil && p.EndTime.Before(asOf) {
+		asOf = *p.EndTime
+	}
+	return g.tallyProposal(g.db, &p, asOf)
+}
+
+// CloseExpiredProposals 关闭已过截止时间的进行中提案，daoID为0时处理全部DAO
+func (g *DAOGovernance) CloseExpiredProposals(daoID uint) (int, error) {
+	query := g.db.Model(&DAOProposal{}).Where("status = ? AND end_time <= ?", ProposalStatusActive, timeNow())
+	if daoID != 0 {
+		query = query.Where("dao_id = ?", daoID)
+	}
+	var ids []uint
+	if err := query.Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	closed := 0
+	for _, id := range ids {
+		err := g.withProposal(id, func(tx *gorm.DB, dao *CompanyDAO, p *DAOProposal) error {
+			// 加锁后再次检查，避免与其他实例重复关闭
+			if p.Status != ProposalStatusActive || p.EndTime == nil || timeNow().Before(*p.EndTime) {
+				return nil
+			}
+			closed++
+			return g.closeProposal(tx, dao, p)
+		})
+		if err != nil {
+			return closed, fmt.Errorf("关闭提案%d失败: %w", id, err)
+		}
+	}
+	return closed, nil
+}
+
+func (g *DAOGovernance) closeProposal(tx *gorm.DB, dao *CompanyDAO, p *DAOProposal) error {
+	tally, err := g.tallyProposal(tx, p, *p.EndTime)
+	if err != nil {
+		return err
+	}
+	tally.applyTo(p)
+	now := timeNow()
+	p.ClosedAt = &now
+	p.CloseReason = tally.outcome()
+	if tally.QuorumReached && tally.Approved {
+		p.Status = ProposalStatusPassed
+		settings, err := g.loadSettings(tx, dao)
+		if err != nil {
+			return err
+		}
+		executeAt := p.EndTime.AddDate(0, 0, settings.ExecutionDelayDays)
+		p.ExecutionTime = &executeAt
+	} else {
+		p.Status = ProposalStatusRejected
+	}
+	p.UpdatedAt = now
+	if err := tx.Save(p).Error; err != nil {
+		return err
+	}
+	return g.recordActivity(tx, dao.ID, 0, ActivityTypeProposalClosed, fmt.Sprintf("Voting closed (%s): %s", p.Status, p.Title),
+		gin.H{"proposal_id": p.ID, "status": p.Status, "reason": p.CloseReason, "tally": tally})
+}
+
+// ExecuteProposal 执行已通过且过了执行延迟的提案，按提案类型应用变更。
+// 提案内容无法解析时提案标记为失败并返回ErrProposalPayload，不会再次执行
+func (g *DAOGovernance) ExecuteProposal(proposalID, actorID uint) (*DAOProposal, error) {
+	var proposal *DAOProposal
+	var payloadErr error
+	err := g.withProposal(proposalID, func(tx *gorm.DB, dao *CompanyDAO, p *DAOProposal) error {
+		if _, err := g.activeMember(tx, dao.ID, actorID); err != nil {
+			return err
+		}
+		if p.Status != ProposalStatusPassed {
+			return fmt.Errorf("%w: only passed proposals can be executed, proposal is %s", ErrProposalState, p.Status)
+		}
+		now := timeNow()
+		if p.ExecutionTime != nil && now.Before(*p.ExecutionTime) {
+			return fmt.Errorf("%w: execution delay ends at %s", ErrProposalState, p.ExecutionTime.Format(time.RFC3339))
+		}
+
+		result, err := g.applyProposal(tx, dao, p, actorID)
+		if errors.Is(err, ErrProposalPayload) {
+			// 解析失败发生在任何变更之前，提交失败状态即可
+			payloadErr = err
+			failure, _ := json.Marshal(gin.H{"error": err.Error()})
+			p.Status = ProposalStatusFailed
+			p.ExecutionResult = string(failure)
+			p.ExecutedBy = actorID
+			p.UpdatedAt = now
+			if err := tx.Save(p).Error; err != nil {
+				return err
+			}
+			proposal = p
+			return g.recordActivity(tx, dao.ID, actorID, ActivityTypeProposalFailed, "Proposal failed: "+p.Title,
+				gin.H{"proposal_id": p.ID, "error": err.Error()})
+		}
+		if err != nil {
+			return err
+		}
+		resultJSON, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		p.Status = ProposalStatusExecuted
+		p.ExecutionResult = string(resultJSON)
+		p.ExecutedBy = actorID
+		p.UpdatedAt = now
+		if err := tx.Save(p).Error; err != nil {
+			return err
+		}
+		proposal = p
+		return g.recordActivity(tx, dao.ID, actorID, ActivityTypeProposalExecuted, "Proposal executed: "+p.Title,
+			gin.H{"proposal_id": p.ID, "result": result})
+	})
+	if err == nil && payloadErr != nil {
+		return proposal, payloadErr
+	}
+	return proposal, err
+}
+
+// applyProposal 应用提案内容，返回执行结果
+func (g *DAOGovernance) applyProposal(tx *gorm.DB, dao *CompanyDAO, p *DAOProposal, actorID uint) (gin.H, error) {
+	data := json.RawMessage(p.ProposalData)
+	if err := validateProposalData(p.ProposalType, data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProposalPayload, err)
+	}
+	decode := func(v interface{}) error {
+		if err := json.Unmarshal(data, v); err != nil {
+			return fmt.Errorf("%w: %v", ErrProposalPayload, err)
+		}
+		return nil
+	}
+
+	switch p.ProposalType {
+	case ProposalTypeBudgetAllocation:
+		var d budgetAllocationData
+		if err := decode(&d); err != nil {
+			return nil, err
+		}
+		team, err := g.findTeam(tx, d.TeamID)
+		if err != nil {
+			return nil, err
+		}
+		if team.DAOID != dao.ID || team.Status == teamDissolved {
+			return nil, fmt.Errorf("%w: team %d is not an active team of this dao", ErrInvalidGovernance, d.TeamID)
+		}
+		budget := team.Budget + d.Amount
+		if err := tx.Model(team).Updates(map[string]interface{}{"budget": budget, "updated_at": timeNow()}).Error; err != nil {
+			return nil, err
+		}
+		if err := g.recordActivity(tx, dao.ID, actorID, ActivityTypeBudgetAllocated,
+			fmt.Sprintf("Allocated %d to team %s", d.Amount, team.Name),
+			gin.H{"proposal_id": p.ID, "team_id": team.ID, "amount": d.Amount, "budget": budget}); err != nil {
+			return nil, err
+		}
+		return gin.H{"team_id": team.ID, "amount": d.Amount, "budget": budget}, nil
+
+	case ProposalTypeMemberManagement:
+		var d memberManagementData
+		if err := decode(&d); err != nil {
+			return nil, err
+		}
+		in := DAOMemberInput{UserID: d.UserID, Role: d.Role, VotingPower: d.VotingPower, TokenBalance: d.TokenBalance}
+		switch d.Action {
+		case "add":
+			member, err := g.addMember(tx, dao.ID, actorID, in)
+			if err != nil {
+				return nil, err
+			}
+			return gin.H{"action": "add", "member": member}, nil
+		case "update":
+			member, err := g.updateMember(tx, dao.ID, actorID, in)
+			if err != nil {
+				return nil, err
+			}
+			return gin.H{"action": "update", "member": member}, nil
+		default:
+			if err := g.removeMember(tx, dao.ID, actorID, d.UserID); err != nil {
+				return nil, err
+			}
+			return gin.H{"action": "remove", "user_id": d.UserID}, nil
+		}
+
+	case ProposalTypePolicyChange:
+		var d policyChangeData
+		if err := decode(&d); err != nil {
+			return nil, err
+		}
+		var settings *DAOGovernanceSettings
+		if err := g.updateSettings(tx, dao, actorID, d.Settings, &settings); err != nil {
+			return nil, err
+		}
+		return gin.H{"settings": settings}, nil
+
+	case ProposalTypeTeamStructure:
+		var d teamStructureData
+		if err := decode(&d); err != nil {
+			return nil, err
+		}
+		if d.Action == "create" {
+			team, err := g.createTeam(tx, dao.ID, actorID, AutonomousTeamInput{
+				Name: d.Name, Description: d.Description, LeaderID: d.LeaderID, MaxMembers: d.MaxMembers,
+			}, d.Budget)
+			if err != nil {
+				return nil, err
+			}
+			return gin.H{"action": "create", "team": team}, nil
+		}
+		if err := g.dissolveTeam(tx, dao.ID, actorID, d.TeamID); err != nil {
+			return nil, err
+		}
+		return gin.H{"action": "dissolve", "team_id": d.TeamID}, nil
+	}
+
+	// 项目审批等提案没有自动执行的内容，执行即记录批准
+	return gin.H{"approved": true}, nil
+}
+
+// GetProposal 获取提案，已到期的提案先关闭
+func (g *DAOGovernance) GetProposal(proposalID uint) (*DAOProposal, error) {
+	var p DAOProposal
+	if err := g.db.First(&p, proposalID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProposalNotFound
+		}
+		return nil, err
+	}
+	if p.Status == ProposalStatusActive && p.EndTime != nil && !timeNow().Before(*p.EndTime) {
+		if _, err := g.CloseExpiredProposals(p.DAOID); err != nil {
+			return nil, err
+		}
+		if err := g.db.First(&p, proposalID).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &p, nil
+}
+
+// ListProposals 按创建时间倒序列出提案
+func (g *DAOGovernance) ListProposals(daoID uint, status string, offset, limit int) ([]DAOProposal, int64, error) {
+	if _, err := g.findDAO(g.db, daoID); err != nil {
+		return nil, 0, err
+	}
+	if _, err := g.CloseExpiredProposals(daoID); err != nil {
+		return nil, 0, err
+	}
+	query := g.db.Model(&DAOProposal{}).Where("dao_id = ?", daoID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var proposals []DAOProposal
+	err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(limit).Find(&proposals).Error
+	return proposals, total, err
+}
+
+// ListVotes 列出提案的投票
+func (g *DAOGovernance) ListVotes(proposalID uint) ([]DAOVote, error) {
+	var votes []DAOVote
+	err := g.db.Where("proposal_id = ?", proposalID).Order("voted_at ASC").Find(&votes).Error
+	return votes, err
+}
+
+// AutonomousTeamInput 创建或修改团队的参数；预算只能通过预算分配提案修改
+type AutonomousTeamInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	LeaderID    uint   `json:"leader_id"`
+	MaxMembers  int    `json:"max_members"`
+}
+
+// CreateTeam 创建自主管理团队（创始人或管理员），负责人自动加入
+func (g *DAOGovernance) CreateTeam(daoID, actorID uint, in AutonomousTeamInput) (*AutonomousTeam, error) {
+	var team *AutonomousTeam
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := g.lockDAO(tx, daoID); err != nil {
+			return err
+		}
+		if err := g.requireManager(tx, daoID, actorID); err != nil {
+			return err
+		}
+		var err error
+		team, err = g.createTeam(tx, daoID, actorID, in, 0)
+		return err
+	})
+	return team, err
+}
+
+func (g *DAOGovernance) createTeam(tx *gorm.DB, daoID, actorID uint, in AutonomousTeamInput, budget uint64) (*AutonomousTeam, error) {
+	if strings.TrimSpace(in.Name) == "" || in.LeaderID == 0 {
+		return nil, fmt.Errorf("%w: name and leader_id are required", ErrInvalidGovernance)
+	}
+	if _, err := g.activeMember(tx, daoID, in.LeaderID); err != nil {
+		return nil, err
+	}
+	if in.MaxMembers <= 0 {
+		in.MaxMembers = 50
+	}
+	now := timeNow()
+	team := &AutonomousTeam{
+		DAOID:          daoID,
+		Name:           in.Name,
+		Description:    in.Description,
+		LeaderID:       in.LeaderID,
+		Budget:         budget,
+		MaxMembers:     in.MaxMembers,
+		CurrentMembers: 1,
+		Status:         daoMemberActive,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := tx.Create(team).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&TeamMember{
+		TeamID:    team.ID,
+		UserID:    in.LeaderID,
+		Role:      TeamRoleLeader,
+		JoinedAt:  now,
+		Status:    daoMemberActive,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}).Error; err != nil {
+		return nil, err
+	}
+	if err := g.recordActivity(tx, daoID, actorID, ActivityTypeTeamCreated, "Team created: "+team.Name,
+		gin.H{"team_id": team.ID, "leader_id": team.LeaderID, "budget": budget}); err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+// UpdateTeam 修改团队信息（团队负责人、创始人或管理员）
+func (g *DAOGovernance) UpdateTeam(teamID, actorID uint, in AutonomousTeamInput) (*AutonomousTeam, error) {
+	var team *AutonomousTeam
+	err := g.withTeam(teamID, func(tx *gorm.DB, t *AutonomousTeam) error {
+		if err := g.requireTeamManager(tx, t, actorID); err != nil {
+			return err
+		}
+		changes := gin.H{"team_id": t.ID}
+		if in.Name != "" {
+			t.Name = in.Name
+			changes["name"] = in.Name
+		}
+		if in.Description != "" {
+			t.Description = in.Description
+		}
+		if in.MaxMembers > 0 {
+			if in.MaxMembers < t.CurrentMembers {
+				return fmt.Errorf("%w: max_members is below current member count", ErrInvalidGovernance)
+			}
+			t.MaxMembers = in.MaxMembers
+			changes["max_members"] = in.MaxMembers
+		}
+		if in.LeaderID != 0 && in.LeaderID != t.LeaderID {
+			var leader TeamMember
+			if err := tx.Where("team_id = ? AND user_id = ? AND status = ?", t.ID, in.LeaderID, daoMemberActive).
+				First(&leader).Error; err != nil {
+				return fmt.Errorf("%w: new leader must be a team member", ErrInvalidGovernance)
+			}
+			if err := tx.Model(&TeamMember{}).Where("team_id = ? AND user_id = ?", t.ID, t.LeaderID).
+				Update("role", TeamRoleMember).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&leader).Update("role", TeamRoleLeader).Error; err != nil {
+				return err
+			}
+			t.LeaderID = in.LeaderID
+			changes["leader_id"] = in.LeaderID
+		}
+		t.UpdatedAt = timeNow()
+		if err := tx.Save(t).Error; err != nil {
+			return err
+		}
+		team = t
+		return g.recordActivity(tx, t.DAOID, actorID, ActivityTypeTeamUpdated, "Team updated: "+t.Name, changes)
+	})
+	return team, err
+}
+
+// DissolveTeam 解散团队（创始人或管理员）
+func (g *DAOGovernance) DissolveTeam(teamID, actorID uint) error {
+	team, err := g.findTeam(g.db, teamID)
+	if err != nil {
+		return err
+	}
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := g.lockDAO(tx, team.DAOID); err != nil {
+			return err
+		}
+		if err := g.requireManager(tx, team.DAOID, actorID); err != nil {
+			return err
+		}
+		return g.dissolveTeam(tx, team.DAOID, actorID, teamID)
+	})
+}
+
+func (g *DAOGovernance) dissolveTeam(tx *gorm.DB, daoID, actorID, teamID uint) error {
+	team, err := g.findTeam(tx, teamID)
+	if err != nil {
+		return err
+	}
+	if team.DAOID != daoID || team.Status == teamDissolved {
+		return fmt.Errorf("%w: team %d is not an active team of this dao", ErrInvalidGovernance, teamID)
+	}
+	if err := tx.Model(team).Updates(map[string]interface{}{"status": teamDissolved, "updated_at": timeNow()}).Error; err != nil {
+		return err
+	}
+	return g.recordActivity(tx, daoID, actorID, ActivityTypeTeamDissolved, "Team dissolved: "+team.Name,
+		gin.H{"team_id": team.ID, "budget": team.Budget})
+}
+
+// ListTeams 列出未解散的团队
+func (g *DAOGovernance) ListTeams(daoID uint) ([]AutonomousTeam, error) {
+	var teams []AutonomousTeam
+	err := g.db.Where("dao_id = ? AND status <> ?", daoID, teamDissolved).Order("created_at ASC").Find(&teams).Error
+	return teams, err
+}
+
+// AddTeamMember 添加团队成员（团队负责人、创始人或管理员），成员须为DAO成员
+func (g *DAOGovernance) AddTeamMember(teamID, actorID, userID uint, role string) (*TeamMember, error) {
+	if role == "" {
+		role = TeamRoleMember
+	}
+	if role != TeamRoleAdmin && role != TeamRoleMember && role != TeamRoleContributor {
+		return nil, fmt.Errorf("%w: invalid team role %s", ErrInvalidGovernance, role)
+	}
+	var member *TeamMember
+	err := g.withTeam(teamID, func(tx *gorm.DB, t *AutonomousTeam) error {
+		if err := g.requireTeamManager(tx, t, actorID); err != nil {
+			return err
+		}
+		if _, err := g.activeMember(tx, t.DAOID, userID); err != nil {
+			return err
+		}
+		if t.CurrentMembers >= t.MaxMembers {
+			return fmt.Errorf("%w: team is full", ErrInvalidGovernance)
+		}
+		now := timeNow()
+		var existing TeamMember
+		err := tx.Where("team_id = ? AND user_id = ?", t.ID, userID).First(&existing).Error
+		switch {
+		case err == nil && existing.Status == daoMemberActive:
+			return fmt.Errorf("%w: user %d is already in the team", ErrInvalidGovernance, userID)
+		case err == nil:
+			existing.Status = daoMemberActive
+			existing.Role = role
+			existing.JoinedAt = now
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			existing = TeamMember{TeamID: t.ID, UserID: userID, Role: role, JoinedAt: now, Status: daoMemberActive, CreatedAt: now}
+		default:
+			return err
+		}
+		existing.UpdatedAt = now
+		if err := tx.Save(&existing).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(t).Update("current_members", t.CurrentMembers+1).Error; err != nil {
+			return err
+		}
+		member = &existing
+		return g.recordActivity(tx, t.DAOID, actorID, ActivityTypeTeamMemberJoined,
+			fmt.Sprintf("User %d joined team %s", userID, t.Name), gin.H{"team_id": t.ID, "user_id": userID, "role": role})
+	})
+	return member, err
+}
+
+// RemoveTeamMember 移除团队成员（团队负责人、创始人、管理员或本人），负责人不能移除
+func (g *DAOGovernance) RemoveTeamMember(teamID, actorID, userID uint) error {
+	return g.withTeam(teamID, func(tx *gorm.DB, t *AutonomousTeam) error {
+		if actorID != userID {
+			if err := g.requireTeamManager(tx, t, actorID); err != nil {
+				return err
+			}
+		}
+		if userID == t.LeaderID {
+			return fmt.Errorf("%w: the team leader cannot be removed", ErrInvalidGovernance)
+		}
+		result := tx.Model(&TeamMember{}).Where("team_id = ? AND user_id = ? AND status = ?", t.ID, userID, daoMemberActive).
+			Updates(map[string]interface{}{"status": daoMemberLeft, "updated_at": timeNow()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w: user %d is not in the team", ErrInvalidGovernance, userID)
+		}
+		if err := tx.Model(t).Update("current_members", t.CurrentMembers-1).Error; err != nil {
+			return err
+		}
+		return g.recordActivity(tx, t.DAOID, actorID, ActivityTypeTeamMemberLeft,
+			fmt.Sprintf("User %d left team %s", userID, t.Name), gin.H{"team_id": t.ID, "user_id": userID})
+	})
+}
+
+// ListTeamMembers 列出团队在任成员
+func (g *DAOGovernance) ListTeamMembers(teamID uint) ([]TeamMember, error) {
+	if _, err := g.findTeam(g.db, teamID); err != nil {
+		return nil, err
+	}
+	var members []TeamMember
+	err := g.db.Where("team_id = ? AND status = ?", teamID, daoMemberActive).Order("joined_at ASC").Find(&members).Error
+	return members, err
+}
+
+// recordActivity 追加活动日志，哈希链接上一条记录；调用方须已锁定DAO
+func (g *DAOGovernance) recordActivity(tx *gorm.DB, daoID, userID uint, activityType, description string, data interface{}) error {
+	dataJSON := "null"
+	if data != nil {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		dataJSON = string(b)
+	}
+	var last DAOActivity
+	prevHash := ""
+	err := tx.Where("dao_id = ?", daoID).Order("id DESC").First(&last).Error
+	switch {
+	case err == nil:
+		prevHash = last.Hash
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+
+	activity := DAOActivity{
+		DAOID:        daoID,
+		UserID:       userID,
+		ActivityType: activityType,
+		ActivityData: dataJSON,
+		Description:  description,
+		PrevHash:     prevHash,
+		// 数据库时间精度不同，按秒保存以保证哈希可复算
+		CreatedAt: timeNow().Truncate(time.Second),
+	}
+	activity.Hash = activity.computeHash()
+	return tx.Create(&activity).Error
+}
+
+// computeHash 记录内容和上一条哈希的SHA-256
+func (a *DAOActivity) computeHash() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%d|%d|%s|%s|%s|%s", a.PrevHash, a.DAOID, a.UserID, a.ActivityType,
+		a.ActivityData, a.Description, a.CreatedAt.UTC().Format(time.RFC3339))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ActivityChainReport 活动日志校验结果
+type ActivityChainReport struct {
+	Valid     bool `json:"valid"`
+	Checked   int  `json:"checked"`
+	BrokenAt  uint `json:"broken_at,omitempty"` // 第一条校验失败的记录ID
+	Unchained int  `json:"unchained"`           // 哈希链启用前的记录数
+}
+
+// VerifyActivityChain 按顺序复算哈希，检查日志是否被修改或删除
+func (g *DAOGovernance) VerifyActivityChain(daoID uint) (*ActivityChainReport, error) {
+	var activities []DAOActivity
+	if err := g.db.Where("dao_id = ?", daoID).Order("id ASC").Find(&activities).Error; err != nil {
+		return nil, err
+	}
+	report := &ActivityChainReport{Valid: true}
+	prev := ""
+	for i := range activities {
+		a := &activities[i]
+		if a.Hash == "" {
+			report.Unchained++
+			prev = ""
+			continue
+		}
+		report.Checked++
+		if a.PrevHash != prev || a.computeHash() != a.Hash {
+			report.Valid = false
+			report.BrokenAt = a.ID
+			break
+		}
+		prev = a.Hash
+	}
+	return report, nil
+}
+
+// ListActivities 按时间倒序列出活动
+func (g *DAOGovernance) ListActivities(daoID uint, activityType string, offset, limit int) ([]DAOActivity, int64, error) {
+	if _, err := g.findDAO(g.db, daoID); err != nil {
+		return nil, 0, err
+	}
+	query := g.db.Model(&DAOActivity{}).Where("dao_id = ?", daoID)
+	if activityType != "" {
+		query = query.Where("activity_type = ?", activityType)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var activities []DAOActivity
+	err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&activities).Error
+	return activities, total, err
+}
+
+// lockDAO 在事务中锁定DAO记录
+func (g *DAOGovernance) lockDAO(tx *gorm.DB, daoID uint) (*CompanyDAO, error) {
+	var dao CompanyDAO
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&dao, daoID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDAONotFound
+		}
+		return nil, err
+	}
+	if dao.Status != "active" {
+		return nil, fmt.Errorf("%w: dao is %s", ErrInvalidGovernance, dao.Status)
+	}
+	return &dao, nil
+}
+
+func (g *DAOGovernance) findDAO(tx *gorm.DB, daoID uint) (*CompanyDAO, error) {
+	var dao CompanyDAO
+	if err := tx.First(&dao, daoID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDAONotFound
+		}
+		return nil, err
+	}
+	return &dao, nil
+}
+
+// withProposal 锁定提案所属DAO后在事务中处理提案
+func (g *DAOGovernance) withProposal(proposalID uint, fn func(tx *gorm.DB, dao *CompanyDAO, p *DAOProposal) error) error {
+	var p DAOProposal
+	if err := g.db.Select("id", "dao_id").First(&p, proposalID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrProposalNotFound
+		}
+		return err
+	}
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		dao, err := g.lockDAO(tx, p.DAOID)
+		if err != nil {
+			return err
+		}
+		var locked DAOProposal
+		if err := tx.First(&locked, proposalID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrProposalNotFound
+			}
+			return err
+		}
+		return fn(tx, dao, &locked)
+	})
+}
+
+// withTeam 锁定团队所属DAO后在事务中处理团队
+func (g *DAOGovernance) withTeam(teamID uint, fn func(tx *gorm.DB, t *AutonomousTeam) error) error {
+	team, err := g.findTeam(g.db, teamID)
+	if err != nil {
+		return err
+	}
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := g.lockDAO(tx, team.DAOID); err != nil {
+			return err
+		}
+		locked, err := g.findTeam(tx, teamID)
+		if err != nil {
+			return err
+		}
+		if locked.Status == teamDissolved {
+			return fmt.Errorf("%w: team is dissolved", ErrInvalidGovernance)
+		}
+		return fn(tx, locked)
+	})
+}
+
+func (g *DAOGovernance) findTeam(tx *gorm.DB, teamID uint) (*AutonomousTeam, error) {
+	var team AutonomousTeam
+	if err := tx.First(&team, teamID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTeamNotFound
+		}
+		return nil, err
+	}
+	return &team, nil
+}
+
+func (g *DAOGovernance) activeMember(tx *gorm.DB, daoID, userID uint) (*DAOMember, error) {
+	var member DAOMember
+	err := tx.Where("dao_id = ? AND user_id = ? AND status = ?", daoID, userID, daoMemberActive).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: user %d", ErrNotDAOMember, userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// requireManager 创始人或管理员
+func (g *DAOGovernance) requireManager(tx *gorm.DB, daoID, userID uint) error {
+	member, err := g.activeMember(tx, daoID, userID)
+	if err != nil {
+		if errors.Is(err, ErrNotDAOMember) {
+			return ErrDAOForbidden
+		}
+		return err
+	}
+	if member.Role != MemberRoleFounder && member.Role != MemberRoleAdmin {
+		return ErrDAOForbidden
+	}
+	return nil
+}
+
+// requireTeamManager 团队负责人或DAO管理者
+func (g *DAOGovernance) requireTeamManager(tx *gorm.DB, team *AutonomousTeam, userID uint) error {
+	if team.LeaderID == userID {
+		return nil
+	}
+	return g.requireManager(tx, team.DAOID, userID)
+}
+
+func jsonOrNull(data json.RawMessage) string {
+	if len(data) == 0 {
+		return "null"
+	}
+	return string(data)
+}
@@ -0,0 +1,597 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// newTestGovernance 建好治理表并创建DAO 1：1为创始人（权重1000），2、3、4为成员（权重各100）
+func newTestGovernance(t *testing.T) (*DAOGovernance, *gorm.DB, *time.Time) {
+	t.Helper()
+	db := newTestDB(t)
+	now := useTestClock(t)
+	gov := NewDAOGovernance(db)
+	if err := gov.AutoMigrate(); err != nil {
+		t.Fatal(err)
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		dao := CompanyDAO{ID: 1, CompanyID: 1, Name: "晶芯DAO", VotingThreshold: 50, ProposalThreshold: 1000,
+			VotingPeriod: 7, ExecutionDelay: 1, Status: "active", CreatedBy: 1, CreatedAt: *now, UpdatedAt: *now}
+		if err := tx.Create(&dao).Error; err != nil {
+			return err
+		}
+		founder := DAOMember{DAOID: 1, UserID: 1, Role: MemberRoleFounder, VotingPower: 1000, JoinedAt: *now,
+			Status: daoMemberActive, CreatedAt: *now, UpdatedAt: *now}
+		if err := tx.Create(&founder).Error; err != nil {
+			return err
+		}
+		return gov.recordActivity(tx, 1, 1, ActivityTypeDAOCreated, "DAO created successfully", nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []uint{2, 3, 4} {
+		if _, err := gov.AddMember(1, 1, DAOMemberInput{UserID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return gov, db, now
+}
+
+// openTestProposal 创始人创建并激活一个无需执行内容的提案
+func openTestProposal(t *testing.T, gov *DAOGovernance, in DAOProposalInput) *DAOProposal {
+	t.Helper()
+	if in.Title == "" {
+		in.Title = "采购开发工具"
+	}
+	draft, err := gov.CreateProposal(1, 1, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := gov.ActivateProposal(draft.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func castVotes(t *testing.T, gov *DAOGovernance, proposalID uint, votes map[uint]string) *ProposalTally {
+	t.Helper()
+	var tally *ProposalTally
+	for voterID, voteType := range votes {
+		var err error
+		if _, tally, err = gov.CastVote(proposalID, voterID, voteType, ""); err != nil {
+			t.Fatalf("vote by %d: %v", voterID, err)
+		}
+	}
+	return tally
+}
+
+func TestDAOProposalLifecycle(t *testing.T) {
+	gov, _, now := newTestGovernance(t)
+
+	draft, err := gov.CreateProposal(1, 2, DAOProposalInput{Title: "提高法定人数", ProposalType: ProposalTypePolicyChange,
+		ProposalData: json.RawMessage(`{"settings": {"quorum_percent": 60}}`)})
+	if err != nil || draft.Status != ProposalStatusDraft {
+		t.Fatalf("draft = %+v, err = %v", draft, err)
+	}
+	if _, _, err := gov.CastVote(draft.ID, 1, VoteTypeFor, ""); !errors.Is(err, ErrProposalState) {
+		t.Fatalf("vote on draft err = %v", err)
+	}
+	// 普通成员权重低于提案门槛，不能自行开始投票
+	if _, err := gov.ActivateProposal(draft.ID, 2); !errors.Is(err, ErrDAOForbidden) {
+		t.Fatalf("activate below threshold err = %v", err)
+	}
+	active, err := gov.ActivateProposal(draft.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active.Status != ProposalStatusActive || !active.EndTime.Equal(testStart.AddDate(0, 0, 7)) ||
+		active.QuorumPercent != defaultQuorumPercent || active.ApprovalPercent != 50 || active.EligiblePower != 1300 {
+		t.Fatalf("active = %+v", active)
+	}
+	if _, err := gov.UpdateProposal(draft.ID, 2, DAOProposalInput{Title: "改标题"}); !errors.Is(err, ErrProposalState) {
+		t.Fatalf("edit active proposal err = %v", err)
+	}
+
+	tally := castVotes(t, gov, active.ID, map[uint]string{1: VoteTypeFor, 2: VoteTypeAgainst})
+	if !tally.QuorumReached || !tally.Approved || tally.For != 1000 || tally.Against != 100 {
+		t.Fatalf("tally = %+v", tally)
+	}
+	if _, err := gov.ExecuteProposal(active.ID, 1); !errors.Is(err, ErrProposalState) {
+		t.Fatalf("execute before close err = %v", err)
+	}
+
+	*now = now.AddDate(0, 0, 7)
+	if closed, err := gov.CloseExpiredProposals(0); err != nil || closed != 1 {
+		t.Fatalf("closed = %d, err = %v", closed, err)
+	}
+	passed, _ := gov.GetProposal(active.ID)
+	if passed.Status != ProposalStatusPassed || passed.CloseReason != CloseReasonApproved ||
+		!passed.ExecutionTime.Equal(passed.EndTime.AddDate(0, 0, 1)) {
+		t.Fatalf("passed = %+v", passed)
+	}
+	// 执行延迟内不能执行
+	if _, err := gov.ExecuteProposal(active.ID, 1); !errors.Is(err, ErrProposalState) {
+		t.Fatalf("execute during delay err = %v", err)
+	}
+	*now = now.AddDate(0, 0, 1)
+	executed, err := gov.ExecuteProposal(active.ID, 3)
+	if err != nil || executed.Status != ProposalStatusExecuted || executed.ExecutedBy != 3 {
+		t.Fatalf("executed = %+v, err = %v", executed, err)
+	}
+	settings, _ := gov.LoadSettings(1)
+	if settings.QuorumPercent != 60 {
+		t.Fatalf("quorum after policy change = %v", settings.QuorumPercent)
+	}
+	if _, err := gov.ExecuteProposal(active.ID, 1); !errors.Is(err, ErrProposalState) {
+		t.Fatalf("second execution err = %v", err)
+	}
+
+	// 新提案使用新的法定人数：三名成员参与只有300/1300，未达到60%
+	second := openTestProposal(t, gov, DAOProposalInput{Title: "开设分部"})
+	if second.QuorumPercent != 60 || second.VotingThreshold != 780 {
+		t.Fatalf("second = %+v", second)
+	}
+	castVotes(t, gov, second.ID, map[uint]string{2: VoteTypeFor, 3: VoteTypeFor, 4: VoteTypeFor})
+	*now = now.AddDate(0, 0, 7)
+	rejected, _ := gov.GetProposal(second.ID)
+	if rejected.Status != ProposalStatusRejected || rejected.CloseReason != CloseReasonQuorumNotMet {
+		t.Fatalf("rejected = %+v", rejected)
+	}
+	if _, err := gov.ExecuteProposal(second.ID, 1); !errors.Is(err, ErrProposalState) {
+		t.Fatalf("execute rejected err = %v", err)
+	}
+}
+
+func TestComputeProposalTallyThresholds(t *testing.T) {
+	joined := testStart.Add(-time.Hour)
+	members := []DAOMember{
+		{UserID: 1, VotingPower: 1000, Status: daoMemberActive, JoinedAt: joined},
+		{UserID: 2, VotingPower: 100, Status: daoMemberActive, JoinedAt: joined},
+		{UserID: 3, VotingPower: 100, Status: daoMemberActive, JoinedAt: joined},
+		{UserID: 4, VotingPower: 100, Status: daoMemberActive, JoinedAt: joined},
+		// 投票开始后加入的成员没有投票权
+		{UserID: 5, VotingPower: 100, Status: daoMemberActive, JoinedAt: testStart.Add(time.Hour)},
+	}
+	vote := func(voterID uint, voteType string, power uint64) DAOVote {
+		return DAOVote{VoterID: voterID, VoteType: voteType, VotingPower: power}
+	}
+	proposal := func(mode string, quorum, approval float64, delegation bool) *DAOProposal {
+		return &DAOProposal{StartTime: &testStart, VotingMode: mode, QuorumPercent: quorum, ApprovalPercent: approval,
+			DelegationEnabled: delegation}
+	}
+	delegations := []DAODelegation{{DelegatorID: 3, DelegateID: 2}, {DelegatorID: 4, DelegateID: 2}}
+
+	tests := []struct {
+		name        string
+		proposal    *DAOProposal
+		votes       []DAOVote
+		delegations []DAODelegation
+		want        ProposalTally
+	}{
+		{
+			name:     "quorum not reached",
+			proposal: proposal(VotingModeWeighted, 20, 50, false),
+			votes:    []DAOVote{vote(2, VoteTypeFor, 100), vote(3, VoteTypeAgainst, 100)},
+			want: ProposalTally{For: 100, Against: 100, EligiblePower: 1300, QuorumPower: 260,
+				Participation: 200 * 100.0 / 1300, Approval: 50},
+		},
+		{
+			name:     "weighted majority against",
+			proposal: proposal(VotingModeWeighted, 20, 50, false),
+			votes:    []DAOVote{vote(1, VoteTypeAgainst, 1000), vote(2, VoteTypeFor, 100), vote(3, VoteTypeFor, 100), vote(4, VoteTypeFor, 100)},
+			want: ProposalTally{For: 300, Against: 1000, EligiblePower: 1300, QuorumPower: 260,
+				Participation: 100, Approval: 300 * 100.0 / 1300, QuorumReached: true},
+		},
+		{
+			name:     "one member one vote",
+			proposal: proposal(VotingModeOneMemberOneVote, 20, 50, false),
+			votes:    []DAOVote{vote(1, VoteTypeAgainst, 1), vote(2, VoteTypeFor, 1), vote(3, VoteTypeFor, 1), vote(4, VoteTypeFor, 1)},
+			want: ProposalTally{For: 3, Against: 1, EligiblePower: 4, QuorumPower: 1,
+				Participation: 100, Approval: 75, QuorumReached: true, Approved: true},
+		},
+		{
+			name:     "tie does not exceed the threshold",
+			proposal: proposal(VotingModeOneMemberOneVote, 20, 50, false),
+			votes:    []DAOVote{vote(1, VoteTypeFor, 1), vote(2, VoteTypeAgainst, 1), vote(3, VoteTypeAbstain, 1)},
+			want: ProposalTally{For: 1, Against: 1, Abstain: 1, EligiblePower: 4, QuorumPower: 1,
+				Participation: 75, Approval: 50, QuorumReached: true},
+		},
+		{
+			name:     "unanimity rejects any vote against",
+			proposal: proposal(VotingModeWeighted, 20, 100, false),
+			votes:    []DAOVote{vote(1, VoteTypeFor, 1000), vote(2, VoteTypeAgainst, 100)},
+			want: ProposalTally{For: 1000, Against: 100, EligiblePower: 1300, QuorumPower: 260,
+				Participation: 1100 * 100.0 / 1300, Approval: 1000 * 100.0 / 1100, QuorumReached: true},
+		},
+		{
+			name:        "delegated power follows the delegate",
+			proposal:    proposal(VotingModeWeighted, 20, 50, true),
+			votes:       []DAOVote{vote(2, VoteTypeFor, 100), vote(4, VoteTypeAgainst, 100)},
+			delegations: delegations,
+			want: ProposalTally{For: 200, Against: 100, Delegated: 100, EligiblePower: 1300, QuorumPower: 260,
+				Participation: 300 * 100.0 / 1300, Approval: 200 * 100.0 / 300, QuorumReached: true, Approved: true},
+		},
+		{
+			name:        "delegation disabled",
+			proposal:    proposal(VotingModeWeighted, 20, 50, false),
+			votes:       []DAOVote{vote(2, VoteTypeFor, 100)},
+			delegations: delegations,
+			want: ProposalTally{For: 100, EligiblePower: 1300, QuorumPower: 260,
+				Participation: 100 * 100.0 / 1300, Approval: 100, Approved: true},
+		},
+		{
+			name:     "votes keep the power snapshotted when cast",
+			proposal: proposal(VotingModeWeighted, 20, 50, false),
+			votes:    []DAOVote{vote(2, VoteTypeFor, 700), vote(5, VoteTypeAgainst, 100)},
+			want: ProposalTally{For: 700, EligiblePower: 1900, QuorumPower: 380,
+				Participation: 700 * 100.0 / 1900, Approval: 100, QuorumReached: true, Approved: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ComputeProposalTally(tt.proposal, members, tt.votes, tt.delegations)
+			if *got != tt.want {
+				t.Fatalf("tally = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDAOVotingModesAndDelegation(t *testing.T) {
+	gov, _, now := newTestGovernance(t)
+
+	// 投票后调整权重不改变已投的票，未投票成员按当前权重计入
+	weighted := openTestProposal(t, gov, DAOProposalInput{})
+	castVotes(t, gov, weighted.ID, map[uint]string{2: VoteTypeFor})
+	power := uint64(500)
+	for _, id := range []uint{2, 3} {
+		if _, err := gov.UpdateMember(1, 1, DAOMemberInput{UserID: id, VotingPower: &power}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tally, err := gov.GetTally(weighted.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tally.For != 100 || tally.EligiblePower != 1000+100+500+100 {
+		t.Fatalf("weighted tally = %+v", tally)
+	}
+
+	// 委托：3委托给2，4先委托后自己投票
+	if _, err := gov.SetDelegation(1, 3, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gov.SetDelegation(1, 4, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gov.SetDelegation(1, 2, 2); !errors.Is(err, ErrInvalidGovernance) {
+		t.Fatalf("self delegation err = %v", err)
+	}
+	if _, err := gov.UpdateSettings(1, 1, map[string]interface{}{"voting_mode": VotingModeOneMemberOneVote}); err != nil {
+		t.Fatal(err)
+	}
+	p := openTestProposal(t, gov, DAOProposalInput{})
+	if p.VotingMode != VotingModeOneMemberOneVote || p.EligiblePower != 4 {
+		t.Fatalf("proposal = %+v", p)
+	}
+	vote, tally, err := gov.CastVote(p.ID, 2, VoteTypeFor, "")
+	if err != nil || vote.VotingPower != 1 {
+		t.Fatalf("vote = %+v, err = %v", vote, err)
+	}
+	if tally.For != 3 || tally.Delegated != 2 {
+		t.Fatalf("delegated tally = %+v", tally)
+	}
+	_, tally, _ = gov.CastVote(p.ID, 4, VoteTypeAgainst, "")
+	if tally.For != 2 || tally.Against != 1 || tally.Delegated != 1 {
+		t.Fatalf("tally after delegator voted = %+v", tally)
+	}
+
+	// 撤销委托后，之前委托的票不再计入
+	if err := gov.RevokeDelegation(1, 3); err != nil {
+		t.Fatal(err)
+	}
+	tally, _ = gov.GetTally(p.ID)
+	if tally.For != 1 || tally.Delegated != 0 {
+		t.Fatalf("tally after revoke = %+v", tally)
+	}
+	if err := gov.RevokeDelegation(1, 3); !errors.Is(err, ErrInvalidGovernance) {
+		t.Fatalf("second revoke err = %v", err)
+	}
+
+	// 投票开始后加入的成员不能投票
+	*now = now.Add(time.Hour)
+	if _, err := gov.AddMember(1, 1, DAOMemberInput{UserID: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := gov.CastVote(p.ID, 5, VoteTypeFor, ""); !errors.Is(err, ErrDAOForbidden) {
+		t.Fatalf("vote by late member err = %v", err)
+	}
+	if _, _, err := gov.CastVote(p.ID, 6, VoteTypeFor, ""); !errors.Is(err, ErrNotDAOMember) {
+		t.Fatalf("vote by non member err = %v", err)
+	}
+}
+
+func TestDAOChangeVoteBeforeDeadline(t *testing.T) {
+	gov, db, now := newTestGovernance(t)
+	p := openTestProposal(t, gov, DAOProposalInput{})
+
+	castVotes(t, gov, p.ID, map[uint]string{2: VoteTypeFor})
+	*now = now.Add(24 * time.Hour)
+	vote, tally, err := gov.CastVote(p.ID, 2, VoteTypeAgainst, "预算不足")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vote.ChangeCount != 1 || vote.VoteReason != "预算不足" || !vote.VotedAt.Equal(*now) {
+		t.Fatalf("vote = %+v", vote)
+	}
+	if tally.For != 0 || tally.Against != 100 {
+		t.Fatalf("tally = %+v", tally)
+	}
+	if _, _, err := gov.CastVote(p.ID, 2, VoteTypeAgainst, "预算不足"); !errors.Is(err, ErrInvalidGovernance) {
+		t.Fatalf("unchanged vote err = %v", err)
+	}
+	if _, _, err := gov.CastVote(p.ID, 2, "maybe", ""); !errors.Is(err, ErrInvalidGovernance) {
+		t.Fatalf("invalid vote type err = %v", err)
+	}
+	var changes int64
+	db.Model(&DAOActivity{}).Where("activity_type = ?", ActivityTypeVoteChanged).Count(&changes)
+	if changes != 1 {
+		t.Fatalf("vote_changed activities = %d", changes)
+	}
+
+	// 截止时间到达后不能再改票
+	*now = *p.EndTime
+	if _, _, err := gov.CastVote(p.ID, 2, VoteTypeFor, ""); !errors.Is(err, ErrProposalState) {
+		t.Fatalf("vote after deadline err = %v", err)
+	}
+	votes, _ := gov.ListVotes(p.ID)
+	if len(votes) != 1 || votes[0].VoteType != VoteTypeAgainst {
+		t.Fatalf("votes = %+v", votes)
+	}
+}
+
+func TestDAOCloseExpiredProposals(t *testing.T) {
+	gov, _, now := newTestGovernance(t)
+	first := openTestProposal(t, gov, DAOProposalInput{Title: "第一项"})
+	castVotes(t, gov, first.ID, map[uint]string{1: VoteTypeFor})
+	*now = now.AddDate(0, 0, 2)
+	second := openTestProposal(t, gov, DAOProposalInput{Title: "第二项"})
+
+	if closed, err := gov.CloseExpiredProposals(1); err != nil || closed != 0 {
+		t.Fatalf("closed before deadline = %d, err = %v", closed, err)
+	}
+	*now = *first.EndTime
+	if closed, err := gov.CloseExpiredProposals(1); err != nil || closed != 1 {
+		t.Fatalf("closed = %d, err = %v", closed, err)
+	}
+	if closed, _ := gov.CloseExpiredProposals(1); closed != 0 {
+		t.Fatalf("closed again = %d", closed)
+	}
+	p, _ := gov.GetProposal(first.ID)
+	if p.Status != ProposalStatusPassed || p.ClosedAt == nil || p.TotalVotes != 1000 {
+		t.Fatalf("first = %+v", p)
+	}
+	if p, _ := gov.GetProposal(second.ID); p.Status != ProposalStatusActive {
+		t.Fatalf("second closed early: %+v", p)
+	}
+
+	// 没有人投票的提案到期后因未达法定人数被否决；列表查询时也会先关闭到期提案
+	*now = *second.EndTime
+	proposals, total, err := gov.ListProposals(1, ProposalStatusRejected, 0, 10)
+	if err != nil || total != 1 || proposals[0].ID != second.ID || proposals[0].CloseReason != CloseReasonQuorumNotMet {
+		t.Fatalf("rejected = %+v, total = %d, err = %v", proposals, total, err)
+	}
+}
+
+func TestDAOExecuteAppliesAndFailsMalformedProposals(t *testing.T) {
+	gov, db, now := newTestGovernance(t)
+	team, err := gov.CreateTeam(1, 1, AutonomousTeamInput{Name: "平台组", LeaderID: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pass := func(in DAOProposalInput) *DAOProposal {
+		t.Helper()
+		p := openTestProposal(t, gov, in)
+		castVotes(t, gov, p.ID, map[uint]string{1: VoteTypeFor})
+		*now = now.AddDate(0, 0, 8)
+		if closed, err := gov.CloseExpiredProposals(1); err != nil || closed != 1 {
+			t.Fatalf("closed = %d, err = %v", closed, err)
+		}
+		return p
+	}
+
+	budget := pass(DAOProposalInput{Title: "拨付预算", ProposalType: ProposalTypeBudgetAllocation,
+		ProposalData: json.RawMessage(`{"team_id": ` + strconv.Itoa(int(team.ID)) + `, "amount": 5000}`)})
+	if _, err := gov.ExecuteProposal(budget.ID, 2); err != nil {
+		t.Fatal(err)
+	}
+	teams, _ := gov.ListTeams(1)
+	if len(teams) != 1 || teams[0].Budget != 5000 {
+		t.Fatalf("teams = %+v", teams)
+	}
+
+	// 通过后提案内容被改坏：执行失败，提案标记为失败且不会再执行
+	broken := pass(DAOProposalInput{Title: "新增成员", ProposalType: ProposalTypeMemberManagement,
+		ProposalData: json.RawMessage(`{"action": "add", "user_id": 9}`)})
+	if err := db.Model(&DAOProposal{}).Where("id = ?", broken.ID).
+		Update("proposal_data", `{"action": "add", "user_id": "nine"}`).Error; err != nil {
+		t.Fatal(err)
+	}
+	failed, err := gov.ExecuteProposal(broken.ID, 1)
+	if !errors.Is(err, ErrProposalPayload) {
+		t.Fatalf("execute malformed err = %v", err)
+	}
+	if failed.Status != ProposalStatusFailed || !strings.Contains(failed.ExecutionResult, "error") {
+		t.Fatalf("failed = %+v", failed)
+	}
+	stored, _ := gov.GetProposal(broken.ID)
+	if stored.Status != ProposalStatusFailed {
+		t.Fatalf("stored status = %s", stored.Status)
+	}
+	if _, err := gov.ExecuteProposal(broken.ID, 1); !errors.Is(err, ErrProposalState) {
+		t.Fatalf("re-execute failed proposal err = %v", err)
+	}
+	if _, err := gov.activeMember(db, 1, 9); !errors.Is(err, ErrNotDAOMember) {
+		t.Fatalf("member added by failed proposal: %v", err)
+	}
+	activities, _, _ := gov.ListActivities(1, ActivityTypeProposalFailed, 0, 10)
+	if len(activities) != 1 {
+		t.Fatalf("proposal_failed activities = %d", len(activities))
+	}
+}
+
+func TestDAOVerifyActivityChain(t *testing.T) {
+	gov, db, now := newTestGovernance(t)
+	p := openTestProposal(t, gov, DAOProposalInput{})
+	*now = now.Add(time.Hour)
+	castVotes(t, gov, p.ID, map[uint]string{1: VoteTypeFor, 2: VoteTypeAgainst})
+
+	report, err := gov.VerifyActivityChain(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 创建DAO、3名成员加入、创建和激活提案、2次投票
+	if !report.Valid || report.Checked != 8 || report.Unchained != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+
+	var activity DAOActivity
+	db.Where("dao_id = ? AND activity_type = ?", 1, ActivityTypeProposalActivated).First(&activity)
+	if err := db.Model(&activity).Update("description", "tampered").Error; !errors.Is(err, ErrActivityImmutable) {
+		t.Fatalf("update through gorm err = %v", err)
+	}
+	if err := db.Delete(&activity).Error; !errors.Is(err, ErrActivityImmutable) {
+		t.Fatalf("delete through gorm err = %v", err)
+	}
+
+	// 绕过模型直接改库能被校验发现
+	if err := db.Exec("UPDATE dao_activities SET description = ? WHERE id = ?", "tampered", activity.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	report, _ = gov.VerifyActivityChain(1)
+	if report.Valid || report.BrokenAt != activity.ID {
+		t.Fatalf("tampered report = %+v", report)
+	}
+}
+
+// newTestDAORouter 挂载提案相关接口，X-User-ID请求头模拟认证中间件写入的用户
+func newTestDAORouter(gov *DAOGovernance) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	dao := r.Group("/api/v1/dao")
+	dao.Use(func(c *gin.Context) {
+		if id, err := strconv.ParseUint(c.GetHeader("X-User-ID"), 10, 64); err == nil {
+			c.Set("user_id", uint(id))
+		}
+	})
+	handlers := map[string]func(*gin.Context, *DAOGovernance){
+		"POST /":                                createCompanyDAO,
+		"PUT /:id":                              updateCompanyDAO,
+		"POST /:id/proposals":                   createProposal,
+		"POST /proposals/:proposal_id/activate": activateProposal,
+		"POST /proposals/:proposal_id/vote":     voteOnProposal,
+		"POST /proposals/:proposal_id/execute":  executeProposal,
+		"GET /proposals/:proposal_id/tally":     getProposalTally,
+	}
+	for route, handler := range handlers {
+		method, path, _ := strings.Cut(route, " ")
+		handler := handler
+		dao.Handle(method, path, func(c *gin.Context) { handler(c, gov) })
+	}
+	return r
+}
+
+func TestDAOProposalHandlers(t *testing.T) {
+	gov, db, now := newTestGovernance(t)
+	if err := db.AutoMigrate(&Company{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&Company{ID: 2, Name: "深圳晶芯科技", Status: "active", CreatedBy: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := newTestDAORouter(gov)
+	call := func(method, path string, userID uint, body interface{}) (int, map[string]interface{}) {
+		t.Helper()
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		if userID != 0 {
+			req.Header.Set("X-User-ID", strconv.Itoa(int(userID)))
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		data, _ := resp["data"].(map[string]interface{})
+		return w.Code, data
+	}
+
+	// 创建DAO使用服务时钟，创建者成为创始人
+	code, created := call(http.MethodPost, "/api/v1/dao/", 1, gin.H{"company_id": 2, "name": "第二个DAO"})
+	if code != http.StatusOK || created["created_at"] != testStart.Format(time.RFC3339) {
+		t.Fatalf("create dao = %d %v", code, created)
+	}
+	if code, _ := call(http.MethodPost, "/api/v1/dao/", 2, gin.H{"company_id": 2, "name": "越权"}); code != http.StatusForbidden {
+		t.Fatalf("create dao by non creator = %d", code)
+	}
+
+	if code, _ := call(http.MethodPost, "/api/v1/dao/1/proposals", 0, gin.H{"title": "无用户"}); code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated = %d", code)
+	}
+	if code, _ := call(http.MethodPost, "/api/v1/dao/x/proposals", 1, gin.H{"title": "无效ID"}); code != http.StatusBadRequest {
+		t.Fatalf("invalid id = %d", code)
+	}
+	code, draft := call(http.MethodPost, "/api/v1/dao/1/proposals", 2, gin.H{"title": "采购开发工具"})
+	if code != http.StatusOK || draft["status"] != ProposalStatusDraft {
+		t.Fatalf("create proposal = %d %v", code, draft)
+	}
+	proposalPath := "/api/v1/dao/proposals/" + strconv.Itoa(int(draft["id"].(float64)))
+	if code, _ := call(http.MethodPost, proposalPath+"/activate", 2, nil); code != http.StatusForbidden {
+		t.Fatalf("activate below threshold = %d", code)
+	}
+	if code, _ := call(http.MethodPost, proposalPath+"/activate", 1, nil); code != http.StatusOK {
+		t.Fatalf("activate = %d", code)
+	}
+	if code, _ := call(http.MethodPost, proposalPath+"/vote", 9, gin.H{"vote_type": VoteTypeFor}); code != http.StatusForbidden {
+		t.Fatalf("vote by non member = %d", code)
+	}
+	if code, _ := call(http.MethodPost, proposalPath+"/vote", 1, gin.H{"vote_type": "maybe"}); code != http.StatusBadRequest {
+		t.Fatalf("invalid vote type = %d", code)
+	}
+	code, voted := call(http.MethodPost, proposalPath+"/vote", 1, gin.H{"vote_type": VoteTypeFor})
+	if code != http.StatusOK || voted["tally"].(map[string]interface{})["approved"] != true {
+		t.Fatalf("vote = %d %v", code, voted)
+	}
+	if code, _ := call(http.MethodPost, proposalPath+"/execute", 1, nil); code != http.StatusConflict {
+		t.Fatalf("execute active proposal = %d", code)
+	}
+
+	*now = now.AddDate(0, 0, 8)
+	code, tally := call(http.MethodGet, proposalPath+"/tally", 1, nil)
+	if code != http.StatusOK || tally["for"] != float64(1000) || tally["quorum_reached"] != true {
+		t.Fatalf("tally = %d %v", code, tally)
+	}
+	gov.CloseExpiredProposals(1)
+	code, executed := call(http.MethodPost, proposalPath+"/execute", 3, nil)
+	if code != http.StatusOK || executed["status"] != ProposalStatusExecuted {
+		t.Fatalf("execute = %d %v", code, executed)
+	}
+	if code, _ := call(http.MethodGet, "/api/v1/dao/proposals/999/tally", 1, nil); code != http.StatusNotFound {
+		t.Fatalf("missing proposal = %d", code)
+	}
+}
@@ -60,13 +60,23 @@ type DAOProposal struct {
 	ProposalData  string    `json:"proposal_data" gorm:"type:json"`
 	VotesFor      uint64    `json:"votes_for" gorm:"default:0"`
 	VotesAgainst  uint64    `json:"votes_against" gorm:"default:0"`
+	VotesAbstain  uint64    `json:"votes_abstain" gorm:"default:0"`
 	TotalVotes    uint64    `json:"total_votes" gorm:"default:0"`
-	VotingThreshold uint64  `json:"voting_threshold" gorm:"default:0"`
+	VotingThreshold uint64  `json:"voting_threshold" gorm:"default:0"` // 达到法定人数所需的投票权重
+	EligiblePower uint64    `json:"eligible_power" gorm:"default:0"`   // 可投票的总权重
+	// 提案激活时的治理参数快照，投票期间修改设置不影响进行中的提案
+	VotingMode        string  `json:"voting_mode" gorm:"size:30"`
+	QuorumPercent     float64 `json:"quorum_percent" gorm:"type:decimal(5,2);default:0"`
+	ApprovalPercent   float64 `json:"approval_percent" gorm:"type:decimal(5,2);default:0"`
+	DelegationEnabled bool    `json:"delegation_enabled" gorm:"default:false"`
 	StartTime     *time.Time `json:"start_time"`
 	EndTime       *time.Time `json:"end_time"`
-	ExecutionTime *time.Time `json:"execution_time"`
+	ExecutionTime *time.Time `json:"execution_time"` // 通过后最早可执行的时间
+	ClosedAt      *time.Time `json:"closed_at"`
+	CloseReason   string    `json:"close_reason" gorm:"size:50"`
 	Status        string    `json:"status" gorm:"size:20;default:draft"`
 	ExecutionResult string  `json:"execution_result" gorm:"type:json"`
+	ExecutedBy    uint      `json:"executed_by" gorm:"default:0"`
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
 	
@@ -84,8 +94,10 @@ type DAOVote struct {
 	VoteType    string    `json:"vote_type" gorm:"size:20;not null"`
 	VotingPower uint64    `json:"voting_power" gorm:"not null"`
 	VoteReason  string    `json:"vote_reason" gorm:"type:text"`
+	ChangeCount int       `json:"change_count" gorm:"default:0"`
 	VotedAt     time.Time `json:"voted_at"`
 	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 	
 	// 关联数据
 	Proposal DAOProposal `json:"proposal" gorm:"foreignKey:ProposalID"`
@@ -137,6 +149,9 @@ type DAOActivity struct {
 	ActivityType  string    `json:"activity_type" gorm:"size:50;not null"`
 	ActivityData string    `json:"activity_data" gorm:"type:json"`
 	Description  string    `json:"description" gorm:"type:text"`
+	// 哈希链：每条记录的哈希包含上一条记录的哈希，篡改任意记录都会使之后的校验失败
+	PrevHash     string    `json:"prev_hash" gorm:"size:64"`
+	Hash         string    `json:"hash" gorm:"size:64"`
 	CreatedAt    time.Time `json:"created_at"`
 	
 	// 关联数据
@@ -144,6 +159,16 @@ type DAOActivity struct {
 	User User       `json:"user" gorm:"foreignKey:UserID"`
 }
 
+// DAODelegation 投票委托：委托人未亲自投票时，其投票权重随受托人的选择计票
+type DAODelegation struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	DAOID       uint       `json:"dao_id" gorm:"not null;index"`
+	DelegatorID uint       `json:"delegator_id" gorm:"not null"`
+	DelegateID  uint       `json:"delegate_id" gorm:"not null"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+}
+
 // DAOSetting DAO配置数据模型
 type DAOSetting struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
@@ -184,6 +209,20 @@ const (
 	ProposalStatusRejected  = "rejected"
 	ProposalStatusExecuted  = "executed"
 	ProposalStatusExpired   = "expired"
+	ProposalStatusFailed    = "failed" // 提案内容无法执行
+)
+
+// 提案结束原因
+const (
+	CloseReasonApproved        = "approved"
+	CloseReasonQuorumNotMet    = "quorum_not_met"
+	CloseReasonThresholdNotMet = "threshold_not_met"
+)
+
+// 投票模式
+const (
+	VotingModeOneMemberOneVote = "one_member_one_vote"
+	VotingModeWeighted         = "weighted"
 )
 
 // 成员角色枚举
@@ -212,4 +251,20 @@ const (
 	ActivityTypeTeamCreated      = "team_created"
 	ActivityTypeBudgetAllocated  = "budget_allocated"
 	ActivityTypeOther            = "other"
+
+	ActivityTypeDAOCreated         = "dao_created"
+	ActivityTypeProposalUpdated    = "proposal_updated"
+	ActivityTypeProposalDeleted    = "proposal_deleted"
+	ActivityTypeProposalActivated  = "proposal_activated"
+	ActivityTypeProposalClosed     = "proposal_closed"
+	ActivityTypeProposalFailed     = "proposal_failed"
+	ActivityTypeVoteChanged        = "vote_changed"
+	ActivityTypeMemberUpdated      = "member_updated"
+	ActivityTypeDelegationSet      = "delegation_set"
+	ActivityTypeDelegationRevoked  = "delegation_revoked"
+	ActivityTypeSettingsUpdated    = "settings_updated"
+	ActivityTypeTeamUpdated        = "team_updated"
+	ActivityTypeTeamDissolved      = "team_dissolved"
+	ActivityTypeTeamMemberJoined   = "team_member_joined"
+	ActivityTypeTeamMemberLeft     = "team_member_left"
 )
@@ -3,7 +3,9 @@ package main
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -12,6 +14,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/jobfirst/jobfirst-core"
+	aiquota "github.com/xiajason/zervi-basic/basic/backend/pkg/ai-quota"
 )
 
 // DocumentAPI 文档API处理器
@@ -20,14 +23,15 @@ type DocumentAPI struct {
 	mineruClient    *MinerUClient
 	documentParser  *CompanyDocumentParser
 	uploadDir       string
-	quotaMiddleware *QuotaMiddleware
+	quotaMiddleware *aiquota.QuotaMiddleware
+	extraction      *DocumentExtractionService
 }
 
 // NewDocumentAPI 创建文档API处理器
-func NewDocumentAPI(core *jobfirst.Core) *DocumentAPI {
+func NewDocumentAPI(core *jobfirst.Core, quotaService *aiquota.Service) *DocumentAPI {
 	mineruClient := NewMinerUClient("http://localhost:8001")
 	documentParser := NewCompanyDocumentParser(mineruClient)
-	quotaMiddleware := NewQuotaMiddleware(core.GetDB())
+	quotaMiddleware := aiquota.NewQuotaMiddleware(quotaService)
 
 	return &DocumentAPI{
 		core:            core,
@@ -35,6 +39,7 @@ func NewDocumentAPI(core *jobfirst.Core) *DocumentAPI {
 		documentParser:  documentParser,
 		uploadDir:       "./uploads/company-documents",
 		quotaMiddleware: quotaMiddleware,
+		extraction:      NewDocumentExtractionService(core.GetDB(), documentParser),
 	}
 }
 
@@ -76,6 +81,13 @@ func (api *DocumentAPI) SetupDocumentRoutes(r *gin.Engine) {
 	// 创建上传目录
 	os.MkdirAll(api.uploadDir, 0755)
 
+	// 字段提取结果和人工更正，启动时加载已学到的规则调整
+	if err := api.extraction.AutoMigrate(); err != nil {
+		log.Printf("文档提取数据表迁移失败: %v", err)
+	} else if err := api.extraction.RefreshTuning(); err != nil {
+		log.Printf("加载文档提取规则调整失败: %v", err)
+	}
+
 	// 需要认证的文档API
 	authMiddleware := api.core.AuthMiddleware.RequireAuth()
 	documents := r.Group("/api/v1/company/documents")
@@ -84,10 +96,9 @@ func (api *DocumentAPI) SetupDocumentRoutes(r *gin.Engine) {
 		// 上传文档
 		documents.POST("/upload", api.uploadDocument)
 
-		// 解析文档 - 添加AI配额检查
+		// 解析文档 - 预留AI配额，解析失败时释放
 		documents.POST("/:id/parse",
-			api.quotaMiddleware.QuotaCheckMiddleware("document_parsing"),
-			api.quotaMiddleware.RecordUsageMiddleware("document_parsing", "company_document_parsing"),
+			api.quotaMiddleware.Enforce("document_parsing", "company_document_parsing", 0.01),
 			api.parseDocument)
 
 		// 获取解析状态
@@ -102,6 +113,11 @@ func (api *DocumentAPI) SetupDocumentRoutes(r *gin.Engine) {
 		// 删除文档
 		documents.DELETE("/:id", api.deleteDocument)
 
+		// 字段提取结果复核与人工更正
+		documents.GET("/:id/fields", api.getExtractedFields)
+		documents.PUT("/:id/fields", api.correctExtractedFields)
+		documents.GET("/:id/corrections", api.getExtractionCorrections)
+
 		// MinerU集成文档上传
 		documents.POST("/upload-mineru", func(c *gin.Context) {
 			// 获取用户信息
@@ -136,6 +152,22 @@ func (api *DocumentAPI) SetupDocumentRoutes(r *gin.Engine) {
 			GetCompanyMinerUParsedDataHandler(c, api.core)
 		})
 	}
+
+	// 从人工更正中学到的提取规则调整（管理员）
+	extractionAdmin := r.Group("/api/v1/admin/document-extraction")
+	extractionAdmin.Use(authMiddleware, api.core.AuthMiddleware.RequireAdmin())
+	{
+		extractionAdmin.GET("/tuning", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"status": "success", "data": api.extraction.Tuning()})
+		})
+		extractionAdmin.POST("/tuning/refresh", func(c *gin.Context) {
+			if err := api.extraction.RefreshTuning(); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "更新提取规则失败: " + err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"status": "success", "data": api.extraction.Tuning()})
+		})
+	}
 }
 
 // uploadDocument 上传文档
@@ -364,6 +396,11 @@ func (api *DocumentAPI) asyncParseDocument(task *CompanyParsingTask, document *C
 	}
 
 	db.Create(&structuredDataRecord)
+
+	// 保存字段提取结果，供人工复核
+	if _, err := api.extraction.Save(task, structuredData); err != nil {
+		log.Printf("保存文档%d字段提取结果失败: %v", document.ID, err)
+	}
 }
 
 // getParseStatus 获取解析状态
@@ -556,6 +593,99 @@ func (api *DocumentAPI) deleteDocument(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "文档删除成功"})
 }
 
+// getExtractedFields 获取字段提取结果，低置信度字段排在前面
+func (api *DocumentAPI) getExtractedFields(c *gin.Context) {
+	document, ok := api.loadAccessibleDocument(c)
+	if !ok {
+		return
+	}
+	threshold, _ := strconv.ParseFloat(c.Query("threshold"), 64)
+
+	review, err := api.extraction.Review(document.ID, threshold)
+	if err != nil {
+		respondExtractionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": review})
+}
+
+// correctExtractedFields 人工更正字段
+func (api *DocumentAPI) correctExtractedFields(c *gin.Context) {
+	document, ok := api.loadAccessibleDocument(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Corrections []FieldCorrectionInput `json:"corrections" binding:"required,min=1,dive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	extraction, err := api.extraction.Correct(document.ID, c.MustGet("user_id").(uint), req.Corrections)
+	if err != nil && extraction == nil {
+		respondExtractionError(c, err)
+		return
+	}
+	if err != nil {
+		log.Printf("文档%d: %v", document.ID, err)
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": extraction, "message": "字段已更正"})
+}
+
+// getExtractionCorrections 获取文档的更正记录
+func (api *DocumentAPI) getExtractionCorrections(c *gin.Context) {
+	document, ok := api.loadAccessibleDocument(c)
+	if !ok {
+		return
+	}
+	corrections, err := api.extraction.ListCorrections(document.ID)
+	if err != nil {
+		respondExtractionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": corrections})
+}
+
+// loadAccessibleDocument 读取文档，只有上传者和管理员可以访问
+func (api *DocumentAPI) loadAccessibleDocument(c *gin.Context) (*CompanyDocument, bool) {
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户ID不存在"})
+		return nil, false
+	}
+	documentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文档ID格式错误"})
+		return nil, false
+	}
+	var document CompanyDocument
+	if err := api.core.GetDB().First(&document, documentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文档不存在"})
+		return nil, false
+	}
+	if document.UserID != userIDInterface.(uint) {
+		role := c.GetString("role")
+		if role != "admin" && role != "super_admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "权限不足"})
+			return nil, false
+		}
+	}
+	return &document, true
+}
+
+func respondExtractionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrExtractionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "文档还没有字段提取结果"})
+	case errors.Is(err, ErrExtractionInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "字段提取操作失败: " + err.Error()})
+	}
+}
+
 // getStatusMessage 获取状态消息
 func getStatusMessage(status string) string {
 	switch status {
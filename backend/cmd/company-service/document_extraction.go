@@ -0,0 +1,366 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xiajason/zervi-basic/basic/backend/pkg/docextract"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrExtractionNotFound = errors.New("document extraction not found")
+	ErrExtractionInvalid  = errors.New("invalid extraction correction")
+)
+
+// extractionTuningMinSupport 同一标签被更正确认多少次后才影响提取规则
+const extractionTuningMinSupport = 2
+
+// defaultReviewThreshold 置信度低于该值的字段需要人工复核
+const defaultReviewThreshold = 0.7
+
+// 提取记录状态
+const (
+	ExtractionStatusExtracted = "extracted"
+	ExtractionStatusReviewed  = "reviewed"
+)
+
+// CompanyDocumentExtraction 一次文档解析的字段提取结果，保留原文用于人工更正时定位标签
+type CompanyDocumentExtraction struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	DocumentID      uint       `json:"document_id" gorm:"not null;index"`
+	TaskID          uint       `json:"task_id" gorm:"not null;uniqueIndex"`
+	CompanyID       uint       `json:"company_id" gorm:"not null;index"`
+	SourceContent   string     `json:"-" gorm:"type:longtext"`
+	SourceStructure string     `json:"-" gorm:"type:longtext"`
+	FieldsJSON      string     `json:"-" gorm:"column:fields;type:json"`
+	TablesJSON      string     `json:"-" gorm:"column:tables;type:json"`
+	Confidence      float64    `json:"confidence"`
+	Status          string     `json:"status" gorm:"size:20;default:extracted"`
+	ReviewedBy      *uint      `json:"reviewed_by"`
+	ReviewedAt      *time.Time `json:"reviewed_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	Fields map[string]docextract.Field `json:"fields" gorm:"-"`
+	Tables []docextract.Table          `json:"tables" gorm:"-"`
+}
+
+// TableName 指定表名
+func (CompanyDocumentExtraction) TableName() string {
+	return "company_document_extractions"
+}
+
+// AfterFind 解析字段和表格
+func (e *CompanyDocumentExtraction) AfterFind(tx *gorm.DB) error {
+	if e.FieldsJSON != "" {
+		if err := json.Unmarshal([]byte(e.FieldsJSON), &e.Fields); err != nil {
+			return err
+		}
+	}
+	if e.TablesJSON != "" {
+		return json.Unmarshal([]byte(e.TablesJSON), &e.Tables)
+	}
+	return nil
+}
+
+// CompanyExtractionCorrection 人工更正记录，汇总后用于调整提取规则
+type CompanyExtractionCorrection struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	ExtractionID   uint      `json:"extraction_id" gorm:"not null;index"`
+	DocumentID     uint      `json:"document_id" gorm:"not null;index"`
+	CompanyID      uint      `json:"company_id" gorm:"not null"`
+	Field          string    `json:"field" gorm:"size:50;not null;index"`
+	OriginalValue  string    `json:"original_value" gorm:"type:text"`
+	CorrectedValue string    `json:"corrected_value" gorm:"type:text"`
+	OriginalLabel  string    `json:"original_label" gorm:"size:100"` // 原值来自的标签
+	MatchedLabel   string    `json:"matched_label" gorm:"size:100"`  // 更正后的值在原文中对应的标签
+	Confidence     float64   `json:"confidence"`                     // 原值的置信度
+	ReviewerID     uint      `json:"reviewer_id" gorm:"not null"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (CompanyExtractionCorrection) TableName() string {
+	return "company_extraction_corrections"
+}
+
+// FieldCorrectionInput 一个字段的更正，Value为空表示文档中没有该字段
+type FieldCorrectionInput struct {
+	Field string `json:"field" binding:"required"`
+	Value string `json:"value"`
+}
+
+// ReviewField 复核界面展示的字段
+type ReviewField struct {
+	docextract.Field
+	NeedsReview bool `json:"needs_review"`
+	Corrected   bool `json:"corrected"`
+}
+
+// ExtractionReview 一份文档的复核视图：所有规则字段，未提取到的字段值为空
+type ExtractionReview struct {
+	Extraction  *CompanyDocumentExtraction `json:"extraction"`
+	Fields      []ReviewField              `json:"fields"`
+	NeedsReview int                        `json:"needs_review"`
+	Threshold   float64                    `json:"threshold"`
+}
+
+// DocumentExtractionService 保存提取结果、接收人工更正并据此调整提取规则
+type DocumentExtractionService struct {
+	db     *gorm.DB
+	parser *CompanyDocumentParser
+}
+
+// NewDocumentExtractionService 创建文档提取服务
+func NewDocumentExtractionService(db *gorm.DB, parser *CompanyDocumentParser) *DocumentExtractionService {
+	return &DocumentExtractionService{db: db, parser: parser}
+}
+
+// AutoMigrate 创建提取结果和更正记录表
+func (s *DocumentExtractionService) AutoMigrate() error {
+	return s.db.AutoMigrate(&CompanyDocumentExtraction{}, &CompanyExtractionCorrection{})
+}
+
+// Save 保存一次解析的提取结果
+func (s *DocumentExtractionService) Save(task *CompanyParsingTask, data *CompanyStructuredData) (*CompanyDocumentExtraction, error) {
+	extraction := &CompanyDocumentExtraction{
+		DocumentID: task.DocumentID,
+		TaskID:     task.ID,
+		CompanyID:  task.CompanyID,
+		Confidence: data.Confidence,
+		Status:     ExtractionStatusExtracted,
+		Fields:     data.Fields,
+		Tables:     data.Tables,
+	}
+	if data.source != nil {
+		extraction.SourceContent = data.source.Content
+		if len(data.source.Structure) > 0 {
+			structure, _ := json.Marshal(data.source.Structure)
+			extraction.SourceStructure = string(structure)
+		}
+	}
+	if err := encodeExtraction(extraction); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(extraction).Error; err != nil {
+		return nil, err
+	}
+	return extraction, nil
+}
+
+// Latest 文档最近一次的提取结果
+func (s *DocumentExtractionService) Latest(documentID uint) (*CompanyDocumentExtraction, error) {
+	var extraction CompanyDocumentExtraction
+	if err := s.db.Where("document_id = ?", documentID).Order("id DESC").First(&extraction).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrExtractionNotFound
+		}
+		return nil, err
+	}
+	return &extraction, nil
+}
+
+// Review 复核视图：置信度低于阈值或有其他候选值的字段标记为需要复核，排在前面
+func (s *DocumentExtractionService) Review(documentID uint, threshold float64) (*ExtractionReview, error) {
+	if threshold <= 0 || threshold > 1 {
+		threshold = defaultReviewThreshold
+	}
+	extraction, err := s.Latest(documentID)
+	if err != nil {
+		return nil, err
+	}
+	var corrected []string
+	if err := s.db.Model(&CompanyExtractionCorrection{}).Where("extraction_id = ?", extraction.ID).
+		Distinct("field").Pluck("field", &corrected).Error; err != nil {
+		return nil, err
+	}
+	correctedSet := make(map[string]bool, len(corrected))
+	for _, f := range corrected {
+		correctedSet[f] = true
+	}
+
+	review := &ExtractionReview{Extraction: extraction, Threshold: threshold}
+	for _, rule := range companyExtractionRules() {
+		field, ok := extraction.Fields[rule.Name]
+		if !ok {
+			field = docextract.Field{Name: rule.Name}
+		}
+		item := ReviewField{Field: field, Corrected: correctedSet[rule.Name]}
+		item.NeedsReview = ok && !item.Corrected && (field.Confidence < threshold || len(field.Alternatives) > 0)
+		if item.NeedsReview {
+			review.NeedsReview++
+		}
+		review.Fields = append(review.Fields, item)
+	}
+	sort.SliceStable(review.Fields, func(i, j int) bool {
+		return review.Fields[i].NeedsReview && !review.Fields[j].NeedsReview
+	})
+	return review, nil
+}
+
+// Correct 保存人工更正：更新提取结果和结构化数据，记录更正值在原文中对应的标签，并重新学习提取规则
+func (s *DocumentExtractionService) Correct(documentID, reviewerID uint, corrections []FieldCorrectionInput) (*CompanyDocumentExtraction, error) {
+	if len(corrections) == 0 {
+		return nil, fmt.Errorf("%w: 没有需要更正的字段", ErrExtractionInvalid)
+	}
+	extractor := s.parser.Extractor()
+	for _, c := range corrections {
+		if _, ok := extractor.Rule(c.Field); !ok {
+			return nil, fmt.Errorf("%w: 未知字段 %s", ErrExtractionInvalid, c.Field)
+		}
+	}
+
+	var updated *CompanyDocumentExtraction
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var extraction CompanyDocumentExtraction
+		if err := tx.Where("document_id = ?", documentID).Order("id DESC").First(&extraction).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrExtractionNotFound
+			}
+			return err
+		}
+		if extraction.Fields == nil {
+			extraction.Fields = make(map[string]docextract.Field)
+		}
+		doc := extraction.sourceDocument()
+		now := timeNow()
+
+		for _, c := range corrections {
+			value := strings.TrimSpace(c.Value)
+			original := extraction.Fields[c.Field]
+			// 与原值相同视为确认，同样记录下来用于学习；已经人工确认过的不再重复记录
+			if value == original.Value && original.Layout == docextract.LayoutManual {
+				continue
+			}
+			record := CompanyExtractionCorrection{
+				ExtractionID:   extraction.ID,
+				DocumentID:     extraction.DocumentID,
+				CompanyID:      extraction.CompanyID,
+				Field:          c.Field,
+				OriginalValue:  original.Value,
+				CorrectedValue: value,
+				OriginalLabel:  original.Label,
+				Confidence:     original.Confidence,
+				ReviewerID:     reviewerID,
+				CreatedAt:      now,
+			}
+			if value == "" {
+				delete(extraction.Fields, c.Field)
+			} else {
+				field := docextract.Field{Name: c.Field, Value: value, Confidence: 1, Layout: docextract.LayoutManual, Validated: true}
+				if pair, ok := doc.Locate(value); ok {
+					record.MatchedLabel = pair.Label
+					field.Label, field.Source = pair.Label, pair.ValueSpan
+				} else if span, ok := doc.Find(value); ok {
+					field.Source = span
+				}
+				extraction.Fields[c.Field] = field
+			}
+			if err := tx.Create(&record).Error; err != nil {
+				return err
+			}
+		}
+
+		data := structuredDataFromFields(extraction.Fields)
+		data.Tables = extraction.Tables
+		extraction.Confidence = data.Confidence
+		extraction.Status = ExtractionStatusReviewed
+		extraction.ReviewedBy = &reviewerID
+		extraction.ReviewedAt = &now
+		if err := encodeExtraction(&extraction); err != nil {
+			return err
+		}
+		if err := tx.Save(&extraction).Error; err != nil {
+			return err
+		}
+		if err := saveCorrectedStructuredData(tx, extraction.TaskID, data, now); err != nil {
+			return err
+		}
+		updated = &extraction
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.RefreshTuning(); err != nil {
+		return updated, fmt.Errorf("更正已保存，更新提取规则失败: %w", err)
+	}
+	return updated, nil
+}
+
+// saveCorrectedStructuredData 同步更新解析任务的结果和结构化数据记录
+func saveCorrectedStructuredData(tx *gorm.DB, taskID uint, data *CompanyStructuredData, now time.Time) error {
+	resultData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if err := tx.Model(&CompanyParsingTask{}).Where("id = ?", taskID).
+		Updates(map[string]interface{}{"result_data": string(resultData), "updated_at": now}).Error; err != nil {
+		return err
+	}
+	basicInfo, _ := json.Marshal(data.BasicInfo)
+	businessInfo, _ := json.Marshal(data.BusinessInfo)
+	organizationInfo, _ := json.Marshal(data.OrganizationInfo)
+	financialInfo, _ := json.Marshal(data.FinancialInfo)
+	return tx.Model(&CompanyStructuredDataRecord{}).Where("task_id = ?", taskID).Updates(map[string]interface{}{
+		"basic_info":        string(basicInfo),
+		"business_info":     string(businessInfo),
+		"organization_info": string(organizationInfo),
+		"financial_info":    string(financialInfo),
+		"confidence":        data.Confidence,
+		"updated_at":        now,
+	}).Error
+}
+
+// ListCorrections 文档的更正记录
+func (s *DocumentExtractionService) ListCorrections(documentID uint) ([]CompanyExtractionCorrection, error) {
+	var corrections []CompanyExtractionCorrection
+	err := s.db.Where("document_id = ?", documentID).Order("id").Find(&corrections).Error
+	return corrections, err
+}
+
+// RefreshTuning 根据全部更正记录重新学习提取规则并应用到解析器
+func (s *DocumentExtractionService) RefreshTuning() error {
+	var records []CompanyExtractionCorrection
+	if err := s.db.Select("field", "original_label", "matched_label").Find(&records).Error; err != nil {
+		return err
+	}
+	corrections := make([]docextract.Correction, 0, len(records))
+	for _, r := range records {
+		corrections = append(corrections, docextract.Correction{Field: r.Field, Label: r.MatchedLabel, WrongLabel: r.OriginalLabel})
+	}
+	s.parser.SetTuning(docextract.Learn(corrections, extractionTuningMinSupport))
+	return nil
+}
+
+// Tuning 当前生效的规则调整
+func (s *DocumentExtractionService) Tuning() docextract.Tuning {
+	return s.parser.Extractor().Tuning()
+}
+
+// sourceDocument 从保存的原文重建文档
+func (e *CompanyDocumentExtraction) sourceDocument() *docextract.Document {
+	var structure map[string]interface{}
+	if e.SourceStructure != "" {
+		_ = json.Unmarshal([]byte(e.SourceStructure), &structure)
+	}
+	return docextract.FromMinerU(e.SourceContent, structure)
+}
+
+func encodeExtraction(e *CompanyDocumentExtraction) error {
+	fields, err := json.Marshal(e.Fields)
+	if err != nil {
+		return err
+	}
+	tables, err := json.Marshal(e.Tables)
+	if err != nil {
+		return err
+	}
+	e.FieldsJSON, e.TablesJSON = string(fields), string(tables)
+	return nil
+}
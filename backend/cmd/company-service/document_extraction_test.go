@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/xiajason/zervi-basic/basic/backend/pkg/docextract"
+	"gorm.io/gorm"
+)
+
+// 提取规则在语料上的最低要求，调整规则后若低于这些值需要补充语料或修正规则
+const (
+	corpusMinPrecision        = 0.9
+	corpusMinRecall           = 0.9
+	corpusMaxCalibrationError = 0.3
+)
+
+func TestCompanyExtractionCorpus(t *testing.T) {
+	cases, err := docextract.LoadCorpus("testdata/extraction")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) < 6 {
+		t.Fatalf("corpus has %d documents", len(cases))
+	}
+	report := docextract.Evaluate(NewCompanyDocumentParser(nil).Extractor(), cases)
+	for _, f := range report.Fields {
+		t.Logf("%-28s expected=%d extracted=%d correct=%d confidence=%.2f", f.Field, f.Expected, f.Extracted, f.Correct, f.MeanConfidence)
+	}
+	for _, m := range report.Misses {
+		t.Logf("miss %s/%s: expected %q, got %q", m.Case, m.Field, m.Expected, m.Got)
+	}
+	if report.Precision < corpusMinPrecision || report.Recall < corpusMinRecall || report.CalibrationError > corpusMaxCalibrationError {
+		t.Fatalf("precision=%.3f recall=%.3f calibration_error=%.3f", report.Precision, report.Recall, report.CalibrationError)
+	}
+}
+
+func newTestExtractionService(t *testing.T) (*DocumentExtractionService, *gorm.DB) {
+	t.Helper()
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&CompanyParsingTask{}, &CompanyStructuredDataRecord{}); err != nil {
+		t.Fatal(err)
+	}
+	service := NewDocumentExtractionService(db, NewCompanyDocumentParser(nil))
+	if err := service.AutoMigrate(); err != nil {
+		t.Fatal(err)
+	}
+	return service, db
+}
+
+// parseTestDocument 模拟一次解析任务完成：提取字段并保存结果
+func parseTestDocument(t *testing.T, service *DocumentExtractionService, db *gorm.DB, documentID uint, content string) *CompanyDocumentExtraction {
+	t.Helper()
+	data, err := service.parser.extractCompanyInfo(&CompanyDocumentInfo{Content: content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resultData, _ := json.Marshal(data)
+	task := CompanyParsingTask{CompanyID: 1, DocumentID: documentID, UserID: 10, Status: "completed", ResultData: string(resultData)}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&CompanyStructuredDataRecord{CompanyID: 1, TaskID: task.ID, BasicInfo: "{}", BusinessInfo: "{}",
+		OrganizationInfo: "{}", FinancialInfo: "{}", Confidence: data.Confidence}).Error; err != nil {
+		t.Fatal(err)
+	}
+	extraction, err := service.Save(&task, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return extraction
+}
+
+func supplierDocument(i int) string {
+	return fmt.Sprintf("公司名称：测试供应商%d有限公司\n生产基地：苏州市吴中区工业路%d号\n员工人数：%d0人，其中技术人员若干\n名称：测试供应商%d集团\n", i, i, i, i)
+}
+
+func TestExtractionCorrectionsTuneRules(t *testing.T) {
+	service, db := newTestExtractionService(t)
+
+	first := parseTestDocument(t, service, db, 1, supplierDocument(1))
+	if _, ok := first.Fields["location"]; ok {
+		t.Fatalf("location extracted before tuning: %+v", first.Fields["location"])
+	}
+	review, err := service.Review(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 名称有两个不同的候选值，排在最前面等待复核
+	if review.Fields[0].Name != "name" || !review.Fields[0].NeedsReview || review.NeedsReview != 1 {
+		t.Fatalf("review = %+v", review.Fields[:2])
+	}
+
+	if _, err := service.Correct(1, 100, []FieldCorrectionInput{{Field: "registered_office", Value: "x"}}); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+	corrected, err := service.Correct(1, 100, []FieldCorrectionInput{
+		{Field: "location", Value: "苏州市吴中区工业路1号"},
+		{Field: "name", Value: "测试供应商1有限公司"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	location := corrected.Fields["location"]
+	if corrected.Status != ExtractionStatusReviewed || location.Layout != docextract.LayoutManual || location.Label != "生产基地" ||
+		location.Source.Line != 2 {
+		t.Fatalf("corrected = %+v", corrected)
+	}
+
+	// 更正同步到解析任务结果和结构化数据
+	var task CompanyParsingTask
+	db.First(&task, first.TaskID)
+	var data CompanyStructuredData
+	if err := json.Unmarshal([]byte(task.ResultData), &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.BasicInfo.Location != "苏州市吴中区工业路1号" {
+		t.Fatalf("result data = %+v", data.BasicInfo)
+	}
+	var record CompanyStructuredDataRecord
+	db.Where("task_id = ?", first.TaskID).First(&record)
+	if record.Confidence != corrected.Confidence || record.BasicInfo == "{}" {
+		t.Fatalf("structured record = %+v", record)
+	}
+
+	// 同一标签被确认两次后成为location的标签
+	parseTestDocument(t, service, db, 2, supplierDocument(2))
+	if _, err := service.Correct(2, 100, []FieldCorrectionInput{{Field: "location", Value: "苏州市吴中区工业路2号"}}); err != nil {
+		t.Fatal(err)
+	}
+	if service.Tuning().Labels["location"]["生产基地"] == 0 {
+		t.Fatalf("tuning = %+v", service.Tuning())
+	}
+	third := parseTestDocument(t, service, db, 3, supplierDocument(3))
+	if third.Fields["location"].Value != "苏州市吴中区工业路3号" {
+		t.Fatalf("location after tuning = %+v", third.Fields["location"])
+	}
+
+	corrections, _ := service.ListCorrections(1)
+	if len(corrections) != 2 || corrections[0].MatchedLabel != "生产基地" || corrections[1].MatchedLabel != "公司名称" {
+		t.Fatalf("corrections = %+v", corrections)
+	}
+
+	// 重启后从更正记录恢复规则调整
+	restarted := NewDocumentExtractionService(db, NewCompanyDocumentParser(nil))
+	if err := restarted.RefreshTuning(); err != nil {
+		t.Fatal(err)
+	}
+	if restarted.Tuning().Labels["location"]["生产基地"] == 0 {
+		t.Fatal("tuning not restored from corrections")
+	}
+}
@@ -2,32 +2,62 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"regexp"
+	"strconv"
 	"strings"
-	"time"
+	"sync"
+
+	"github.com/xiajason/zervi-basic/basic/backend/pkg/docextract"
 )
 
+// companyParsingVersion 字段提取引擎版本
+const companyParsingVersion = "mineru-v1.0/docextract-v1"
+
+// layoutMinerU 字段取自MinerU识别的企业画像
+const layoutMinerU docextract.Layout = "mineru"
+
 // CompanyDocumentParser 企业文档解析器
 type CompanyDocumentParser struct {
 	mineruClient *MinerUClient
+
+	mu        sync.RWMutex
+	extractor *docextract.Extractor
 }
 
 // NewCompanyDocumentParser 创建企业文档解析器
 func NewCompanyDocumentParser(mineruClient *MinerUClient) *CompanyDocumentParser {
 	return &CompanyDocumentParser{
 		mineruClient: mineruClient,
+		extractor:    docextract.NewExtractor(companyExtractionRules()),
 	}
 }
 
+// SetTuning 叠加从人工更正中学到的规则调整
+func (p *CompanyDocumentParser) SetTuning(t docextract.Tuning) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.extractor = p.extractor.WithTuning(t)
+}
+
+// Extractor 当前使用的字段提取器
+func (p *CompanyDocumentParser) Extractor() *docextract.Extractor {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.extractor
+}
+
 // CompanyBasicInfo 企业基本信息
 type CompanyBasicInfo struct {
-	Name        string `json:"name"`
-	ShortName   string `json:"short_name"`
-	FoundedYear int    `json:"founded_year"`
-	CompanySize string `json:"company_size"`
-	Industry    string `json:"industry"`
-	Location    string `json:"location"`
-	Website     string `json:"website"`
+	Name                    string `json:"name"`
+	ShortName               string `json:"short_name"`
+	UnifiedSocialCreditCode string `json:"unified_social_credit_code,omitempty"`
+	LegalRepresentative     string `json:"legal_representative,omitempty"`
+	FoundedYear             int    `json:"founded_year"`
+	CompanySize             string `json:"company_size"`
+	Industry                string `json:"industry"`
+	Location                string `json:"location"`
+	Website                 string `json:"website"`
 }
 
 // CompanyBusinessInfo 企业业务信息
@@ -62,6 +92,11 @@ type CompanyStructuredData struct {
 	FinancialInfo    CompanyFinancialInfo    `json:"financial_info"`
 	Confidence       float64                 `json:"confidence"`
 	ParsingVersion   string                  `json:"parsing_version"`
+	// Fields 每个字段的值、置信度和在原文中的位置
+	Fields map[string]docextract.Field `json:"fields,omitempty"`
+	Tables []docextract.Table          `json:"tables,omitempty"`
+
+	source *CompanyDocumentInfo // 解析原文，保存提取记录时使用
 }
 
 // ParseCompanyDocument 解析企业文档
@@ -83,296 +118,168 @@ func (p *CompanyDocumentParser) ParseCompanyDocument(filePath string, userID int
 
 // extractCompanyInfo 从文档中提取企业信息
 func (p *CompanyDocumentParser) extractCompanyInfo(documentInfo *CompanyDocumentInfo) (*CompanyStructuredData, error) {
-	// 如果MinerU返回了结构化数据，直接使用
+	doc := docextract.FromMinerU(documentInfo.Content, documentInfo.Structure)
+	result := p.Extractor().Extract(doc)
+
+	// MinerU识别出企业画像时，用其结果补齐文本中没有提取到的字段
 	if documentInfo.BusinessType == "company" {
-		return p.extractFromStructuredData(documentInfo)
+		mergeMinerUCompanyFields(result.Fields, documentInfo)
 	}
 
-	// 否则从文本内容中提取
-	content := documentInfo.Content
-
-	// 提取基本信息
-	basicInfo := p.extractBasicInfo(content)
-
-	// 提取业务信息
-	businessInfo := p.extractBusinessInfo(content)
-
-	// 提取组织信息
-	organizationInfo := p.extractOrganizationInfo(content)
-
-	// 提取财务信息
-	financialInfo := p.extractFinancialInfo(content)
-
-	// 计算置信度
-	confidence := p.calculateConfidence(basicInfo, businessInfo, organizationInfo, financialInfo)
-
-	return &CompanyStructuredData{
-		BasicInfo:        basicInfo,
-		BusinessInfo:     businessInfo,
-		OrganizationInfo: organizationInfo,
-		FinancialInfo:    financialInfo,
-		Confidence:       confidence,
-		ParsingVersion:   "mineru-v1.0",
-	}, nil
+	data := structuredDataFromFields(result.Fields)
+	data.Tables = result.Tables
+	data.source = documentInfo
+	return data, nil
 }
 
-// extractFromStructuredData 从MinerU返回的结构化数据中提取企业信息
-func (p *CompanyDocumentParser) extractFromStructuredData(documentInfo *CompanyDocumentInfo) (*CompanyStructuredData, error) {
-	// 从MinerU返回的企业画像数据中提取信息
-	basicInfo := CompanyBasicInfo{
-		Name:        documentInfo.CompanyName,
-		Industry:    documentInfo.Industry,
-		Location:    documentInfo.Location,
-		FoundedYear: documentInfo.FoundedYear,
-	}
-
-	// 根据员工数量设置公司规模
-	if documentInfo.EmployeeCount > 0 {
-		if documentInfo.EmployeeCount < 50 {
-			basicInfo.CompanySize = "小型企业"
-		} else if documentInfo.EmployeeCount < 200 {
-			basicInfo.CompanySize = "中型企业"
-		} else {
-			basicInfo.CompanySize = "大型企业"
-		}
-	}
-
-	// 提取财务信息
-	financialInfo := CompanyFinancialInfo{
-		AnnualRevenue: documentInfo.Revenue,
-	}
-
-	// 使用MinerU返回的置信度
+// mergeMinerUCompanyFields 补齐MinerU企业画像中的字段，置信度使用MinerU返回的值
+func mergeMinerUCompanyFields(fields map[string]docextract.Field, documentInfo *CompanyDocumentInfo) {
 	confidence := documentInfo.Confidence
 	if confidence == 0 {
 		confidence = 0.88 // 默认置信度
 	}
-
-	return &CompanyStructuredData{
-		BasicInfo:        basicInfo,
-		BusinessInfo:     CompanyBusinessInfo{},     // 暂时为空，可以后续扩展
-		OrganizationInfo: CompanyOrganizationInfo{}, // 暂时为空，可以后续扩展
-		FinancialInfo:    financialInfo,
-		Confidence:       confidence,
-		ParsingVersion:   "mineru-v1.0",
-	}, nil
-}
-
-// extractBasicInfo 提取基本信息
-func (p *CompanyDocumentParser) extractBasicInfo(content string) CompanyBasicInfo {
-	basicInfo := CompanyBasicInfo{}
-
-	// 提取企业名称
-	if name := p.extractField(content, []string{"公司名称", "企业名称", "公司", "企业"}); name != "" {
-		basicInfo.Name = name
-	}
-
-	// 提取简称
-	if shortName := p.extractField(content, []string{"简称", "公司简称", "企业简称"}); shortName != "" {
-		basicInfo.ShortName = shortName
-	}
-
-	// 提取成立年份
-	if year := p.extractYear(content); year > 0 {
-		basicInfo.FoundedYear = year
-	}
-
-	// 提取公司规模
-	if size := p.extractField(content, []string{"公司规模", "人员规模", "员工数量", "规模"}); size != "" {
-		basicInfo.CompanySize = size
-	}
-
-	// 提取行业
-	if industry := p.extractField(content, []string{"行业", "所属行业", "行业类别"}); industry != "" {
-		basicInfo.Industry = industry
-	}
-
-	// 提取地址
-	if location := p.extractField(content, []string{"地址", "公司地址", "注册地址", "办公地址"}); location != "" {
-		basicInfo.Location = location
-	}
-
-	// 提取网站
-	if website := p.extractWebsite(content); website != "" {
-		basicInfo.Website = website
-	}
-
-	return basicInfo
-}
-
-// extractBusinessInfo 提取业务信息
-func (p *CompanyDocumentParser) extractBusinessInfo(content string) CompanyBusinessInfo {
-	businessInfo := CompanyBusinessInfo{}
-
-	// 提取主营业务
-	if mainBusiness := p.extractField(content, []string{"主营业务", "主要业务", "业务范围", "经营范围"}); mainBusiness != "" {
-		businessInfo.MainBusiness = mainBusiness
-	}
-
-	// 提取产品服务
-	if products := p.extractField(content, []string{"产品", "服务", "产品服务", "主要产品"}); products != "" {
-		businessInfo.Products = products
-	}
-
-	// 提取目标客户
-	if targetCustomers := p.extractField(content, []string{"目标客户", "客户群体", "服务对象"}); targetCustomers != "" {
-		businessInfo.TargetCustomers = targetCustomers
-	}
-
-	// 提取竞争优势
-	if competitiveAdvantage := p.extractField(content, []string{"竞争优势", "核心竞争力", "优势"}); competitiveAdvantage != "" {
-		businessInfo.CompetitiveAdvantage = competitiveAdvantage
-	}
-
-	return businessInfo
-}
-
-// extractOrganizationInfo 提取组织信息
-func (p *CompanyDocumentParser) extractOrganizationInfo(content string) CompanyOrganizationInfo {
-	organizationInfo := CompanyOrganizationInfo{}
-
-	// 提取组织架构
-	if orgStructure := p.extractField(content, []string{"组织架构", "公司架构", "架构"}); orgStructure != "" {
-		organizationInfo.OrganizationStructure = orgStructure
-	}
-
-	// 提取部门设置
-	if departments := p.extractField(content, []string{"部门", "部门设置", "组织部门"}); departments != "" {
-		organizationInfo.Departments = departments
-	}
-
-	// 提取人员规模
-	if personnelScale := p.extractField(content, []string{"人员规模", "员工数量", "人员数量"}); personnelScale != "" {
-		organizationInfo.PersonnelScale = personnelScale
-	}
-
-	// 提取管理层信息
-	if managementInfo := p.extractField(content, []string{"管理层", "管理团队", "领导团队"}); managementInfo != "" {
-		organizationInfo.ManagementInfo = managementInfo
-	}
-
-	return organizationInfo
-}
-
-// extractFinancialInfo 提取财务信息
-func (p *CompanyDocumentParser) extractFinancialInfo(content string) CompanyFinancialInfo {
-	financialInfo := CompanyFinancialInfo{}
-
-	// 提取注册资本
-	if registeredCapital := p.extractField(content, []string{"注册资本", "注册资金", "资本"}); registeredCapital != "" {
-		financialInfo.RegisteredCapital = registeredCapital
-	}
-
-	// 提取年营业额
-	if annualRevenue := p.extractField(content, []string{"年营业额", "营业收入", "年收入"}); annualRevenue != "" {
-		financialInfo.AnnualRevenue = annualRevenue
+	values := map[string]string{
+		"name":           documentInfo.CompanyName,
+		"industry":       documentInfo.Industry,
+		"location":       documentInfo.Location,
+		"annual_revenue": documentInfo.Revenue,
 	}
-
-	// 提取融资情况
-	if financingStatus := p.extractField(content, []string{"融资", "融资情况", "投资"}); financingStatus != "" {
-		financialInfo.FinancingStatus = financingStatus
+	if documentInfo.FoundedYear > 0 {
+		values["founded_year"] = strconv.Itoa(documentInfo.FoundedYear)
 	}
-
-	// 提取上市状态
-	if listingStatus := p.extractField(content, []string{"上市", "上市状态", "挂牌"}); listingStatus != "" {
-		financialInfo.ListingStatus = listingStatus
-	}
-
-	return financialInfo
-}
-
-// extractField 提取字段值
-func (p *CompanyDocumentParser) extractField(content string, keywords []string) string {
-	for _, keyword := range keywords {
-		// 使用正则表达式匹配字段
-		pattern := fmt.Sprintf(`%s[：:]\s*([^\n\r]+)`, keyword)
-		re := regexp.MustCompile(pattern)
-		matches := re.FindStringSubmatch(content)
-		if len(matches) > 1 {
-			return strings.TrimSpace(matches[1])
+	// 根据员工数量设置公司规模
+	if n := documentInfo.EmployeeCount; n > 0 {
+		switch {
+		case n < 50:
+			values["company_size"] = "小型企业"
+		case n < 200:
+			values["company_size"] = "中型企业"
+		default:
+			values["company_size"] = "大型企业"
 		}
 	}
-	return ""
-}
-
-// extractYear 提取年份
-func (p *CompanyDocumentParser) extractYear(content string) int {
-	// 匹配成立年份
-	pattern := `成立[于]?[：:]?\s*(\d{4})`
-	re := regexp.MustCompile(pattern)
-	matches := re.FindStringSubmatch(content)
-	if len(matches) > 1 {
-		year := 0
-		fmt.Sscanf(matches[1], "%d", &year)
-		if year > 1900 && year <= time.Now().Year() {
-			return year
+	for name, value := range values {
+		if _, ok := fields[name]; ok || value == "" {
+			continue
 		}
+		fields[name] = docextract.Field{Name: name, Value: value, Confidence: confidence, Layout: layoutMinerU}
 	}
-	return 0
 }
 
-// extractWebsite 提取网站
-func (p *CompanyDocumentParser) extractWebsite(content string) string {
-	// 匹配网站URL
-	pattern := `(https?://[^\s]+)`
-	re := regexp.MustCompile(pattern)
-	matches := re.FindStringSubmatch(content)
-	if len(matches) > 1 {
-		return matches[1]
+// companyExtractionRules 企业文档的字段提取规则，字段名与结构化数据的json字段一致
+func companyExtractionRules() []docextract.FieldRule {
+	return []docextract.FieldRule{
+		{Name: "name", Labels: []string{"公司名称", "企业名称", "单位名称", "名称"}},
+		{Name: "short_name", Labels: []string{"公司简称", "企业简称", "简称"}},
+		{
+			Name:      "unified_social_credit_code",
+			Labels:    []string{"统一社会信用代码", "社会信用代码", "信用代码"},
+			Pattern:   regexp.MustCompile(`\b[0-9A-HJ-NPQRTUWXY]{2}\d{6}[0-9A-HJ-NPQRTUWXY]{10}\b`),
+			Search:    true,
+			Normalize: strings.ToUpper,
+		},
+		{Name: "legal_representative", Labels: []string{"法定代表人", "法人代表", "法人"}},
+		{
+			Name:    "founded_year",
+			Labels:  []string{"成立日期", "成立时间", "成立年份", "注册日期"},
+			Pattern: regexp.MustCompile(`(?:19|20)\d{2}(?:\s*[-/.年]\s*\d{1,2}(?:\s*[-/.月]\s*\d{1,2}\s*日?)?)?`),
+		},
+		{Name: "company_size", Labels: []string{"公司规模", "企业规模"}},
+		{Name: "industry", Labels: []string{"所属行业", "行业类别", "行业"}},
+		{Name: "location", Labels: []string{"注册地址", "公司地址", "办公地址", "住所", "经营场所", "地址"}},
+		{
+			Name:    "website",
+			Labels:  []string{"公司网站", "官网", "网址", "网站"},
+			Pattern: regexp.MustCompile(`(?:https?://|www\.)[A-Za-z0-9./?=_%&#:-]+`),
+			Search:  true,
+		},
+		{Name: "main_business", Labels: []string{"主营业务", "主要业务", "经营范围", "业务范围"}},
+		{Name: "products", Labels: []string{"主要产品", "产品服务", "产品与服务", "产品"}},
+		{Name: "target_customers", Labels: []string{"目标客户", "客户群体", "服务对象"}},
+		{Name: "competitive_advantage", Labels: []string{"竞争优势", "核心竞争力"}},
+		{Name: "organization_structure", Labels: []string{"组织架构", "公司架构"}},
+		{Name: "departments", Labels: []string{"部门设置", "组织部门", "部门"}},
+		{
+			Name:    "personnel_scale",
+			Labels:  []string{"员工人数", "员工数量", "人员数量", "人员规模"},
+			Pattern: regexp.MustCompile(`\d[\d,]*\s*(?:-\s*\d[\d,]*\s*)?人?以?[上下]?`),
+		},
+		{Name: "management_info", Labels: []string{"管理团队", "管理层", "领导团队", "高管团队"}},
+		{
+			Name:    "registered_capital",
+			Labels:  []string{"注册资本", "注册资金"},
+			Pattern: regexp.MustCompile(`(?:人民币)?\s*[\d.,]+\s*(?:万|亿)?\s*元?\s*(?:人民币|美元|港元)?`),
+		},
+		{Name: "annual_revenue", Labels: []string{"年营业额", "营业收入", "年收入", "营收"}},
+		{Name: "financing_status", Labels: []string{"融资情况", "融资阶段", "融资轮次"}},
+		{Name: "listing_status", Labels: []string{"上市状态", "上市情况", "上市板块"}},
 	}
-	return ""
 }
 
-// calculateConfidence 计算置信度
-func (p *CompanyDocumentParser) calculateConfidence(basicInfo CompanyBasicInfo, businessInfo CompanyBusinessInfo, organizationInfo CompanyOrganizationInfo, financialInfo CompanyFinancialInfo) float64 {
-	score := 0.0
-	total := 0.0
-
-	// 基本信息权重
-	if basicInfo.Name != "" {
-		score += 0.3
-	}
-	if basicInfo.Industry != "" {
-		score += 0.2
-	}
-	if basicInfo.Location != "" {
-		score += 0.1
-	}
-	if basicInfo.FoundedYear > 0 {
-		score += 0.1
-	}
-	total += 0.7
-
-	// 业务信息权重
-	if businessInfo.MainBusiness != "" {
-		score += 0.2
-	}
-	if businessInfo.Products != "" {
-		score += 0.1
-	}
-	total += 0.3
-
-	// 组织信息权重
-	if organizationInfo.PersonnelScale != "" {
-		score += 0.1
-	}
-	if organizationInfo.Departments != "" {
-		score += 0.1
-	}
-	total += 0.2
+var yearPattern = regexp.MustCompile(`(?:19|20)\d{2}`)
+
+// structuredDataFromFields 按字段名填充各部分信息
+func structuredDataFromFields(fields map[string]docextract.Field) *CompanyStructuredData {
+	value := func(name string) string { return fields[name].Value }
+	data := &CompanyStructuredData{
+		BasicInfo: CompanyBasicInfo{
+			Name:                    value("name"),
+			ShortName:               value("short_name"),
+			UnifiedSocialCreditCode: value("unified_social_credit_code"),
+			LegalRepresentative:     value("legal_representative"),
+			CompanySize:             value("company_size"),
+			Industry:                value("industry"),
+			Location:                value("location"),
+			Website:                 value("website"),
+		},
+		BusinessInfo: CompanyBusinessInfo{
+			MainBusiness:         value("main_business"),
+			Products:             value("products"),
+			TargetCustomers:      value("target_customers"),
+			CompetitiveAdvantage: value("competitive_advantage"),
+		},
+		OrganizationInfo: CompanyOrganizationInfo{
+			OrganizationStructure: value("organization_structure"),
+			Departments:           value("departments"),
+			PersonnelScale:        value("personnel_scale"),
+			ManagementInfo:        value("management_info"),
+		},
+		FinancialInfo: CompanyFinancialInfo{
+			RegisteredCapital: value("registered_capital"),
+			AnnualRevenue:     value("annual_revenue"),
+			FinancingStatus:   value("financing_status"),
+			ListingStatus:     value("listing_status"),
+		},
+		Fields:         fields,
+		Confidence:     calculateConfidence(fields),
+		ParsingVersion: companyParsingVersion,
+	}
+	if year := yearPattern.FindString(value("founded_year")); year != "" {
+		data.BasicInfo.FoundedYear, _ = strconv.Atoi(year)
+	}
+	return data
+}
 
-	// 财务信息权重
-	if financialInfo.RegisteredCapital != "" {
-		score += 0.1
-	}
-	if financialInfo.AnnualRevenue != "" {
-		score += 0.1
-	}
-	total += 0.2
+// confidenceWeights 各字段在整体置信度中的权重，未列出的字段不参与
+var confidenceWeights = map[string]float64{
+	"name":               0.3,
+	"industry":           0.2,
+	"location":           0.1,
+	"founded_year":       0.1,
+	"main_business":      0.2,
+	"products":           0.1,
+	"personnel_scale":    0.1,
+	"departments":        0.1,
+	"registered_capital": 0.1,
+	"annual_revenue":     0.1,
+}
 
-	if total == 0 {
-		return 0.0
+// calculateConfidence 整体置信度：关键字段置信度的加权平均，缺失的字段按0计
+func calculateConfidence(fields map[string]docextract.Field) float64 {
+	score, total := 0.0, 0.0
+	for name, weight := range confidenceWeights {
+		score += weight * fields[name].Confidence
+		total += weight
 	}
-
-	return score / total
+	return math.Round(score/total*1000) / 1000
 }
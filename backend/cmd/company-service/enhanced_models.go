@@ -64,11 +64,21 @@ type CompanyUser struct {
 	CompanyID   uint      `json:"company_id" gorm:"not null"`
 	UserID      uint      `json:"user_id" gorm:"not null"`
 	Role        string    `json:"role" gorm:"size:50;not null"`         // legal_rep, authorized_user, admin
-	Status      string    `json:"status" gorm:"size:20;default:active"` // active, inactive, pending
+	Status      string    `json:"status" gorm:"size:20;default:active"` // active, inactive, pending, expired, revoked, left
 	Permissions string    `json:"permissions" gorm:"type:json"`         // 权限列表
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 
+	// 授权期限与转授权
+	GrantedBy       uint       `json:"granted_by"`                        // 授权人，0表示系统
+	ParentID        *uint      `json:"parent_id" gorm:"index"`            // 转授权时授权人自己的授权记录
+	DelegationDepth int        `json:"delegation_depth" gorm:"default:1"` // 企业所有者直接授权为1，每转授一次加1
+	Delegable       bool       `json:"delegable" gorm:"default:false"`    // 是否允许继续转授权
+	ExpiresAt       *time.Time `json:"expires_at" gorm:"index"`           // 为空表示长期有效
+	LastReviewedAt  *time.Time `json:"last_reviewed_at"`                  // 最近一次访问审查确认的时间
+	EndedAt         *time.Time `json:"ended_at"`
+	EndReason       string     `json:"end_reason" gorm:"size:100"`
+
 	// 外键关联
 	Company EnhancedCompany `json:"company,omitempty" gorm:"foreignKey:CompanyID"`
 	User    User            `json:"user,omitempty" gorm:"foreignKey:UserID"`
@@ -85,6 +95,7 @@ type CompanyPermissionAuditLog struct {
 	PermissionResult bool      `json:"permission_result" gorm:"not null"`     // 权限检查结果
 	IPAddress        string    `json:"ip_address" gorm:"size:45"`             // IP地址
 	UserAgent        string    `json:"user_agent" gorm:"type:text"`           // 用户代理
+	Details          string    `json:"details,omitempty" gorm:"type:text"`    // 授权变更的详细信息(JSON)
 	CreatedAt        time.Time `json:"created_at"`
 
 	// 外键关联
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testStart 测试时钟的起点
+var testStart = time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+// newTestDB 内存SQLite，单连接保证同一测试内共享一个库
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+// useTestClock 将服务时钟固定在testStart，通过返回的指针推进时间，测试结束后恢复
+func useTestClock(t *testing.T) *time.Time {
+	t.Helper()
+	now := testStart
+	timeNow = func() time.Time { return now }
+	t.Cleanup(func() { timeNow = time.Now })
+	return &now
+}
+
+// testCompany 测试用企业：10为创建者，11为法定代表人，已认证
+func testCompany() EnhancedCompany {
+	return EnhancedCompany{ID: 1, Name: "深圳晶芯科技", UnifiedSocialCreditCode: "pending-1", Status: "active",
+		VerificationLevel: "verified", CreatedBy: 10, LegalRepUserID: 11}
+}
+
+// createTestCompanies 建企业表并写入企业
+func createTestCompanies(t *testing.T, db *gorm.DB, companies ...EnhancedCompany) {
+	t.Helper()
+	if err := db.AutoMigrate(&EnhancedCompany{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&companies).Error; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,8 +13,16 @@ import (
 	"github.com/go-redis/redis/v8"
 	"github.com/hashicorp/consul/api"
 	"github.com/jobfirst/jobfirst-core"
+	aiquota "github.com/xiajason/zervi-basic/basic/backend/pkg/ai-quota"
+	"github.com/xiajason/zervi-basic/basic/backend/pkg/rbac"
 )
 
+// aiQuotaSweepInterval 收回超时AI配额预留的间隔
+const aiQuotaSweepInterval = time.Minute
+
+// timeNow 服务内统一取当前时间的入口，测试中替换为固定时钟
+var timeNow = time.Now
+
 func main() {
 	// 从环境变量获取端口，默认为8083
 	port := os.Getenv("COMPANY_SERVICE_PORT")
@@ -41,21 +50,31 @@ func main() {
 	// 设置业务路由 (保持现有API)
 	setupBusinessRoutes(r, core)
 
+	// AI服务配额：请求前预留，成功后提交，支持企业配额池和突发额度
+	quotaService := aiquota.NewService(core.GetDB(), aiquota.DefaultConfig())
+	if err := quotaService.AutoMigrate(); err != nil {
+		log.Printf("AI配额数据表迁移失败: %v", err)
+	}
+	quotaService.StartSweeper(context.Background(), aiQuotaSweepInterval)
+
 	// 设置文档API路由
-	documentAPI := NewDocumentAPI(core)
+	documentAPI := NewDocumentAPI(core, quotaService)
 	documentAPI.SetupDocumentRoutes(r)
 
 	// 设置企业画像API路由
 	profileAPI := NewCompanyProfileAPI(core)
 	profileAPI.SetupCompanyProfileRoutes(r)
 
+	// 配额重置需要登录并完成MFA二次验证
+	quotaResetGuards := []gin.HandlerFunc{core.AuthMiddleware.RequireAuth(), core.AuthMiddleware.RequireMFA()}
+
 	// 设置AI配额API路由
-	quotaAPI := NewQuotaAPI(core.GetDB())
-	quotaAPI.RegisterRoutes(r.Group("/api/v1"))
+	quotaAPI := aiquota.NewQuotaAPI(quotaService)
+	quotaAPI.RegisterRoutes(r.Group("/api/v1"), quotaResetGuards...)
 
 	// 设置管理员配额API路由
-	adminAPI := NewAdminAPI(core.GetDB())
-	adminAPI.RegisterAdminRoutes(r.Group("/api/v1"))
+	adminAPI := aiquota.NewAdminAPI(quotaService)
+	adminAPI.RegisterAdminRoutes(r.Group("/api/v1"), quotaResetGuards...)
 
 	// 初始化企业权限管理器
 	var redisClient *redis.Client
@@ -64,21 +83,79 @@ func main() {
 	}
 	permissionManager := NewCompanyPermissionManager(core.GetDB(), redisClient)
 
+	// 初始化持久化RBAC策略（平台域与企业域共用一个模型）
+	rbacManager, err := rbac.NewManager(core.GetDB())
+	if err != nil {
+		log.Fatalf("初始化RBAC管理器失败: %v", err)
+	}
+	defer rbacManager.Close()
+	if redisClient != nil {
+		if err := rbacManager.EnableWatcher(redisClient, ""); err != nil {
+			log.Printf("启用RBAC策略同步失败: %v", err)
+		}
+	}
+	permissionManager.SetRBACManager(rbacManager)
+	profileAPI.SetPermissionManager(permissionManager)
+
+	// 授权期限、转授权、访问申请和访问审查
+	if err := permissionManager.AutoMigrateGrants(); err != nil {
+		log.Printf("企业授权数据表迁移失败: %v", err)
+	}
+	permissionManager.StartGrantScheduler(context.Background(), companyGrantSweepInterval)
+
+	// 设置RBAC策略管理API路由
+	rbacAdmin := r.Group("/api/v1/admin")
+	rbacAdmin.Use(core.AuthMiddleware.RequireAuth(), core.AuthMiddleware.RequireAdmin())
+	rbac.NewAdminAPI(rbacManager).RegisterRoutes(rbacAdmin)
+
 	// 初始化企业数据同步服务
 	dataSyncService := NewCompanyDataSyncService(core.GetDB(), nil, nil, redisClient)
 
+	// 初始化企业空间索引（附近企业搜索）
+	geoIndex := NewCompanyGeoIndex(core.GetDB())
+	geoIndex.Start(context.Background())
+	dataSyncService.SetGeoIndex(geoIndex)
+
+	// 未连接Neo4j时从MySQL加载内存关系图
+	go func() {
+		if err := dataSyncService.LoadCompanyGraph(); err != nil {
+			log.Printf("加载企业关系图失败: %v", err)
+		}
+	}()
+
 	// 设置企业认证增强API路由
 	authAPI := NewCompanyAuthAPI(core, permissionManager, dataSyncService)
 	authAPI.SetupCompanyAuthRoutes(r)
 
+	// 设置企业认证审核路由，审核结果同步到各数据源
+	verificationService := NewCompanyVerificationService(core.GetDB(), DefaultCompanyVerificationConfig())
+	if err := verificationService.AutoMigrate(); err != nil {
+		log.Printf("企业认证数据表迁移失败: %v", err)
+	}
+	verificationService.OnDecision = func(vc *CompanyVerificationCase) {
+		if err := dataSyncService.SyncCompanyData(vc.CompanyID); err != nil {
+			log.Printf("同步企业%d认证结果失败: %v", vc.CompanyID, err)
+		}
+	}
+	verificationService.StartScheduler(context.Background(), companyVerificationSweepInterval)
+	NewCompanyVerificationAPI(verificationService, permissionManager).SetupCompanyVerificationRoutes(r, core)
+
 	// 设置企业增强API路由
 	setupCompanyEnhancedRoutes(r, core, dataSyncService)
 
 	// 设置DAO功能路由
 	setupDAORoutes(r, core)
 
+	// AI服务计费：用量计价、月度出账、套餐变更折算、抵扣和退款
+	billingService := NewAIBillingService(core.GetDB(), NewAIServiceLayeringManager(), DefaultAIBillingConfig())
+	if err := billingService.AutoMigrate(); err != nil {
+		log.Printf("AI服务计费数据表迁移失败: %v", err)
+	}
+	billingService.StartScheduler(context.Background(), aiBillingCycleInterval)
+	NewAIBillingAPI(billingService).SetupAIBillingRoutes(r, core)
+
 	// 设置AI优化功能路由
-	setupAIOptimizationRoutes(r, core)
+	setupAIOptimizationRoutes(r, core, billingService)
 
 	// 设置企业信用信息API路由
 	creditInfoAPI := NewCreditInfoAPI(core)
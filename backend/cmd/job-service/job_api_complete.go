@@ -2,12 +2,15 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jobfirst/jobfirst-core"
+	"github.com/jobfirst/jobfirst-core/auth"
+	"github.com/xiajason/zervi-basic/basic/backend/pkg/geo"
 	"gorm.io/gorm"
 )
 
@@ -47,6 +50,11 @@ func setupJobRoutes(r *gin.Engine, core *jobfirst.Core) {
 			getPublicJobs(c, core)
 		})
 
+		// 附近的职位（按企业位置），按距离排序并用游标分页
+		public.GET("/jobs/nearby", func(c *gin.Context) {
+			getNearbyJobs(c, core)
+		})
+
 		// 获取职位详情
 		public.GET("/jobs/:id", func(c *gin.Context) {
 			getPublicJobDetail(c, core)
@@ -68,35 +76,41 @@ func setupJobRoutes(r *gin.Engine, core *jobfirst.Core) {
 		})
 	}
 
-	// 职位管理API路由组（需要认证）
+	// 职位管理API路由组（需要认证，第三方应用需具备相应OAuth作用域）
 	jobs := r.Group("/api/v1/job/jobs")
 	authMiddleware := core.AuthMiddleware.RequireAuth()
-	jobs.Use(authMiddleware)
+	readJobs := core.AuthMiddleware.RequireScope(auth.ScopeJobsRead)
+	writeJobs := core.AuthMiddleware.RequireScope(auth.ScopeJobsWrite)
 	{
 		// 创建职位
-		jobs.POST("/", func(c *gin.Context) {
+		jobs.POST("/", writeJobs, func(c *gin.Context) {
 			createJob(c, core)
 		})
 
 		// 更新职位
-		jobs.PUT("/:id", func(c *gin.Context) {
+		jobs.PUT("/:id", writeJobs, func(c *gin.Context) {
 			updateJob(c, core)
 		})
 
 		// 删除职位
-		jobs.DELETE("/:id", func(c *gin.Context) {
+		jobs.DELETE("/:id", writeJobs, func(c *gin.Context) {
 			deleteJob(c, core)
 		})
 
 		// 获取我的职位列表
-		jobs.GET("/my-jobs", func(c *gin.Context) {
+		jobs.GET("/my-jobs", readJobs, func(c *gin.Context) {
 			getMyJobs(c, core)
 		})
 
 		// 获取职位详情（需要认证）
-		jobs.GET("/:id", func(c *gin.Context) {
+		jobs.GET("/:id", readJobs, func(c *gin.Context) {
 			getJobDetail(c, core)
 		})
+
+		// 获取本人发布职位收到的申请
+		jobs.GET("/:id/applications", core.AuthMiddleware.RequireScope(auth.ScopeApplicationsRead), func(c *gin.Context) {
+			getOwnJobApplications(c, core)
+		})
 	}
 
 	// 职位申请API路由组（需要认证）
@@ -206,6 +220,64 @@ func getPublicJobs(c *gin.Context, core *jobfirst.Core) {
 	}, "Jobs retrieved successfully")
 }
 
+// 获取附近职位
+func getNearbyJobs(c *gin.Context, core *jobfirst.Core) {
+	if jobGeoIndex == nil {
+		standardErrorResponse(c, http.StatusServiceUnavailable, "Geo index not available", "")
+		return
+	}
+	input, err := geo.ParseCoordSystem(c.Query("coord_system"))
+	if err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid coordinate system", err.Error())
+		return
+	}
+	output := input
+	if name := c.Query("output_coord_system"); name != "" {
+		if output, err = geo.ParseCoordSystem(name); err != nil {
+			standardErrorResponse(c, http.StatusBadRequest, "Invalid coordinate system", err.Error())
+			return
+		}
+	}
+	lat, errLat := strconv.ParseFloat(c.Query("latitude"), 64)
+	lng, errLng := strconv.ParseFloat(c.Query("longitude"), 64)
+	center := geo.Point{Lat: lat, Lng: lng}
+	if errLat != nil || errLng != nil || !center.Valid() {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid latitude or longitude", "")
+		return
+	}
+	radius, _ := strconv.ParseFloat(c.DefaultQuery("radius_km", "5"), 64)
+	if radius <= 0 || radius > 200 {
+		standardErrorResponse(c, http.StatusBadRequest, "radius_km must be between 0 and 200", "")
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	jobs, nextCursor, err := jobGeoIndex.Search(geo.Query{
+		Center:   geo.ToWGS84(center, input),
+		RadiusKm: radius,
+		Cursor:   c.Query("cursor"),
+		Limit:    limit,
+	}, output)
+	if err != nil {
+		if errors.Is(err, geo.ErrInvalidCursor) {
+			standardErrorResponse(c, http.StatusBadRequest, "Invalid cursor", err.Error())
+			return
+		}
+		standardErrorResponse(c, http.StatusInternalServerError, "Failed to get nearby jobs", err.Error())
+		return
+	}
+
+	standardSuccessResponse(c, gin.H{
+		"jobs":        jobs,
+		"count":       len(jobs),
+		"next_cursor": nextCursor,
+		"radius_km":   radius,
+	}, "Nearby jobs retrieved successfully")
+}
+
 // 获取公开职位详情
 func getPublicJobDetail(c *gin.Context, core *jobfirst.Core) {
 	jobID, _ := strconv.Atoi(c.Param("id"))
@@ -219,6 +291,12 @@ func getPublicJobDetail(c *gin.Context, core *jobfirst.Core) {
 
 	// 增加浏览次数
 	db.Model(&job).Update("view_count", job.ViewCount+1)
+	statisticsClient.TrackRecruitmentEvent(RecruitmentEvent{
+		EventType: RecruitmentJobViewed,
+		JobID:     job.ID,
+		CompanyID: job.CompanyID,
+		Source:    c.Query("source"),
+	})
 
 	standardSuccessResponse(c, job, "Job detail retrieved successfully")
 }
@@ -284,6 +362,17 @@ func createJob(c *gin.Context, core *jobfirst.Core) {
 	}
 
 	db := core.GetDB()
+	// 只有通过企业认证的企业可以发布职位
+	verified, err := companyCanPostJobs(db, req.CompanyID)
+	if err != nil {
+		standardErrorResponse(c, http.StatusInternalServerError, "Failed to check company verification", err.Error())
+		return
+	}
+	if !verified {
+		standardErrorResponse(c, http.StatusForbidden, "Company must be verified before posting jobs", "")
+		return
+	}
+
 	job := Job{
 		Title:        req.Title,
 		Description:  req.Description,
@@ -306,10 +395,20 @@ func createJob(c *gin.Context, core *jobfirst.Core) {
 		standardErrorResponse(c, http.StatusInternalServerError, "Failed to create job", err.Error())
 		return
 	}
+	jobGeoIndex.SyncJob(job.ID)
 
 	standardSuccessResponse(c, job, "Job created successfully")
 }
 
+// companyCanPostJobs 企业认证级别为verified或premium时才能发布职位
+func companyCanPostJobs(db *gorm.DB, companyID uint) (bool, error) {
+	var count int64
+	err := db.Table("companies").
+		Where("id = ? AND verification_level IN ?", companyID, []string{"verified", "premium"}).
+		Count(&count).Error
+	return count > 0, err
+}
+
 // 更新职位
 func updateJob(c *gin.Context, core *jobfirst.Core) {
 	jobID, _ := strconv.Atoi(c.Param("id"))
@@ -380,6 +479,7 @@ func updateJob(c *gin.Context, core *jobfirst.Core) {
 		standardErrorResponse(c, http.StatusInternalServerError, "Failed to update job", err.Error())
 		return
 	}
+	jobGeoIndex.SyncJob(job.ID)
 
 	standardSuccessResponse(c, job, "Job updated successfully")
 }
@@ -411,6 +511,7 @@ func deleteJob(c *gin.Context, core *jobfirst.Core) {
 		standardErrorResponse(c, http.StatusInternalServerError, "Failed to delete job", err.Error())
 		return
 	}
+	jobGeoIndex.SyncJob(job.ID)
 
 	standardSuccessResponse(c, gin.H{}, "Job deleted successfully")
 }
@@ -481,6 +582,12 @@ func applyJob(c *gin.Context, core *jobfirst.Core) {
 
 	db := core.GetDB()
 
+	var job Job
+	if err := db.Select("id", "company_id").First(&job, jobID).Error; err != nil {
+		standardErrorResponse(c, http.StatusNotFound, "Job not found", err.Error())
+		return
+	}
+
 	// 检查是否已经申请过
 	var existingApplication JobApplication
 	if err := db.Where("job_id = ? AND user_id = ?", jobID, userID).First(&existingApplication).Error; err == nil {
@@ -508,6 +615,20 @@ func applyJob(c *gin.Context, core *jobfirst.Core) {
 	// 增加申请次数
 	db.Model(&Job{}).Where("id = ?", jobID).Update("apply_count", gorm.Expr("apply_count + 1"))
 
+	source := req.Source
+	if source == "" {
+		source = c.Query("source")
+	}
+	statisticsClient.TrackRecruitmentEvent(RecruitmentEvent{
+		EventType:     RecruitmentApplicationSubmitted,
+		JobID:         job.ID,
+		CompanyID:     job.CompanyID,
+		ApplicationID: application.ID,
+		UserID:        userID,
+		Source:        source,
+		OccurredAt:    application.AppliedAt,
+	})
+
 	standardSuccessResponse(c, application, "Job application submitted successfully")
 }
 
@@ -565,6 +686,17 @@ func cancelApplication(c *gin.Context, core *jobfirst.Core) {
 		return
 	}
 
+	var job Job
+	if err := db.Select("id", "company_id").First(&job, application.JobID).Error; err == nil {
+		statisticsClient.TrackRecruitmentEvent(RecruitmentEvent{
+			EventType:     RecruitmentApplicationWithdrawn,
+			JobID:         job.ID,
+			CompanyID:     job.CompanyID,
+			ApplicationID: application.ID,
+			UserID:        userID,
+		})
+	}
+
 	standardSuccessResponse(c, gin.H{}, "Application cancelled successfully")
 }
 
@@ -707,6 +839,7 @@ func updateJobStatus(c *gin.Context, core *jobfirst.Core) {
 		standardErrorResponse(c, http.StatusInternalServerError, "Failed to update job status", err.Error())
 		return
 	}
+	jobGeoIndex.SyncJob(uint(jobID))
 
 	standardSuccessResponse(c, gin.H{}, "Job status updated successfully")
 }
@@ -737,6 +870,28 @@ func getJobApplications(c *gin.Context, core *jobfirst.Core) {
 	}, "Job applications retrieved successfully")
 }
 
+// 获取本人发布职位收到的申请（职位发布者或其授权的第三方应用）
+func getOwnJobApplications(c *gin.Context, core *jobfirst.Core) {
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		standardErrorResponse(c, http.StatusUnauthorized, "User ID not found", "")
+		return
+	}
+	userID := userIDInterface.(uint)
+
+	var job Job
+	if err := core.GetDB().First(&job, c.Param("id")).Error; err != nil {
+		standardErrorResponse(c, http.StatusNotFound, "Job not found", err.Error())
+		return
+	}
+	if job.CreatedBy != userID {
+		standardErrorResponse(c, http.StatusForbidden, "No permission to view applications of this job", "")
+		return
+	}
+
+	getJobApplications(c, core)
+}
+
 // 审核申请（管理员）
 func reviewApplication(c *gin.Context, core *jobfirst.Core) {
 	applicationID, _ := strconv.Atoi(c.Param("id"))
@@ -750,7 +905,21 @@ func reviewApplication(c *gin.Context, core *jobfirst.Core) {
 		return
 	}
 
+	switch req.Status {
+	case ApplicationStatusPending, ApplicationStatusReviewed, ApplicationStatusInterview,
+		ApplicationStatusAccepted, ApplicationStatusRejected:
+	default:
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid application status", req.Status)
+		return
+	}
+
 	db := core.GetDB()
+	var application JobApplication
+	if err := db.Preload("Job").First(&application, applicationID).Error; err != nil {
+		standardErrorResponse(c, http.StatusNotFound, "Application not found", err.Error())
+		return
+	}
+
 	now := time.Now()
 	updates := map[string]interface{}{
 		"status":      req.Status,
@@ -767,5 +936,16 @@ func reviewApplication(c *gin.Context, core *jobfirst.Core) {
 		return
 	}
 
+	if eventType := applicationStatusEvent(req.Status); eventType != "" {
+		statisticsClient.TrackRecruitmentEvent(RecruitmentEvent{
+			EventType:     eventType,
+			JobID:         application.JobID,
+			CompanyID:     application.Job.CompanyID,
+			ApplicationID: application.ID,
+			UserID:        application.UserID,
+			OccurredAt:    now,
+		})
+	}
+
 	standardSuccessResponse(c, gin.H{}, "Application reviewed successfully")
 }
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/xiajason/zervi-basic/basic/backend/pkg/geo"
+	"gorm.io/gorm"
+)
+
+// 空间索引的增量同步和全量重建间隔
+const (
+	jobGeoRefreshInterval = 30 * time.Second
+	jobGeoRebuildInterval = time.Hour
+)
+
+// JobGeoIndex 职位空间索引，与company-service共用pkg/geo的索引实现。
+// 职位的位置取所属企业的坐标，企业坐标按COMPANY_COORD_SYSTEM解释（默认北斗CGCS2000）
+type JobGeoIndex struct {
+	db           *gorm.DB
+	index        *geo.Index
+	syncer       *geo.Syncer
+	storedSystem geo.CoordSystem
+}
+
+// jobGeoIndex 全局职位空间索引，在main中初始化
+var jobGeoIndex *JobGeoIndex
+
+// NewJobGeoIndex 创建职位空间索引
+func NewJobGeoIndex(db *gorm.DB) *JobGeoIndex {
+	stored := geo.CGCS2000
+	if name := os.Getenv("COMPANY_COORD_SYSTEM"); name != "" {
+		system, err := geo.ParseCoordSystem(name)
+		if err != nil {
+			log.Printf("COMPANY_COORD_SYSTEM无效，使用北斗坐标系: %v", err)
+		} else {
+			stored = system
+		}
+	}
+	idx := &JobGeoIndex{db: db, index: geo.NewIndex(), storedSystem: stored}
+	idx.syncer = geo.NewSyncer(idx.index, idx)
+	return idx
+}
+
+// Start 全量加载后在后台保持同步，企业位置变化在一个同步周期内反映到其职位
+func (g *JobGeoIndex) Start(ctx context.Context) {
+	g.syncer.Run(ctx, jobGeoRefreshInterval, jobGeoRebuildInterval)
+}
+
+// jobLocationRow 职位及其企业坐标
+type jobLocationRow struct {
+	ID          uint
+	Status      string
+	BDLatitude  *float64
+	BDLongitude *float64
+}
+
+func (g *JobGeoIndex) locationQuery(ctx context.Context) *gorm.DB {
+	return g.db.WithContext(ctx).Table("jobs").
+		Select("jobs.id, jobs.status, companies.bd_latitude, companies.bd_longitude").
+		Joins("LEFT JOIN companies ON companies.id = jobs.company_id")
+}
+
+// LoadAll 实现geo.Source
+func (g *JobGeoIndex) LoadAll(ctx context.Context) ([]geo.Record, error) {
+	var rows []jobLocationRow
+	err := g.locationQuery(ctx).
+		Where("jobs.status = ? AND companies.bd_latitude IS NOT NULL AND companies.bd_longitude IS NOT NULL", JobStatusActive).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return g.records(rows), nil
+}
+
+// LoadChanged 实现geo.Source，职位或其企业任一变化都会重新索引
+func (g *JobGeoIndex) LoadChanged(ctx context.Context, since time.Time) ([]geo.Record, error) {
+	var rows []jobLocationRow
+	err := g.locationQuery(ctx).
+		Where("jobs.updated_at >= ? OR companies.updated_at >= ?", since, since).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return g.records(rows), nil
+}
+
+func (g *JobGeoIndex) records(rows []jobLocationRow) []geo.Record {
+	records := make([]geo.Record, len(rows))
+	for i, row := range rows {
+		r := geo.Record{ID: row.ID, Active: row.Status == JobStatusActive}
+		if row.BDLatitude != nil && row.BDLongitude != nil {
+			p := geo.ToWGS84(geo.Point{Lat: *row.BDLatitude, Lng: *row.BDLongitude}, g.storedSystem)
+			r.Point = &p
+		}
+		records[i] = r
+	}
+	return records
+}
+
+// SyncJob 职位创建、修改或删除后立即更新索引
+func (g *JobGeoIndex) SyncJob(jobID uint) {
+	if g == nil {
+		return
+	}
+	var row jobLocationRow
+	err := g.locationQuery(context.Background()).Where("jobs.id = ?", jobID).Take(&row).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		g.syncer.Apply(geo.Record{ID: jobID})
+	case err != nil:
+		log.Printf("同步职位%d的位置失败: %v", jobID, err)
+	default:
+		g.syncer.Apply(g.records([]jobLocationRow{row})[0])
+	}
+}
+
+// NearbyJob 附近职位，Coordinates使用请求的坐标系
+type NearbyJob struct {
+	Job
+	DistanceKm  float64         `json:"distance_km"`
+	Coordinates geo.Point       `json:"coordinates"`
+	CoordSystem geo.CoordSystem `json:"coord_system"`
+}
+
+// Search 执行空间查询并读取职位详情，结果按距离排序。
+// 同步周期内下线的职位会被跳过，因此一页可能少于limit条
+func (g *JobGeoIndex) Search(q geo.Query, output geo.CoordSystem) ([]NearbyJob, string, error) {
+	page, err := g.index.Search(q)
+	if err != nil {
+		return nil, "", err
+	}
+	nearby := []NearbyJob{}
+	if len(page.Hits) == 0 {
+		return nearby, page.NextCursor, nil
+	}
+
+	ids := make([]uint, len(page.Hits))
+	for i, hit := range page.Hits {
+		ids[i] = hit.ID
+	}
+	var jobs []Job
+	if err := g.db.Preload("Company").Where("id IN ? AND status = ?", ids, JobStatusActive).Find(&jobs).Error; err != nil {
+		return nil, "", err
+	}
+	byID := make(map[uint]Job, len(jobs))
+	for _, job := range jobs {
+		byID[job.ID] = job
+	}
+	for _, hit := range page.Hits {
+		job, ok := byID[hit.ID]
+		if !ok {
+			continue
+		}
+		nearby = append(nearby, NearbyJob{
+			Job:         job,
+			DistanceKm:  hit.DistanceKm,
+			Coordinates: geo.FromWGS84(hit.Point, output),
+			CoordSystem: output,
+		})
+	}
+	return nearby, page.NextCursor, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -43,6 +44,10 @@ func main() {
 	r.GET("/health", healthCheck)
 	r.GET("/info", serviceInfo)
 
+	// 初始化职位空间索引（附近职位搜索）
+	jobGeoIndex = NewJobGeoIndex(core.GetDB())
+	jobGeoIndex.Start(context.Background())
+
 	// 设置完整的Job服务API路由
 	setupJobRoutes(r, core)
 
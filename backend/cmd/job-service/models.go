@@ -77,7 +77,7 @@ type JobApplication struct {
 	JobID       uint       `json:"job_id" gorm:"not null"`
 	UserID      uint       `json:"user_id" gorm:"not null"`
 	ResumeID    uint       `json:"resume_id" gorm:"not null"`
-	Status      string     `json:"status" gorm:"size:20;default:pending"` // pending, reviewed, accepted, rejected
+	Status      string     `json:"status" gorm:"size:20;default:pending"` // pending, reviewed, interview, accepted, rejected
 	CoverLetter string     `json:"cover_letter" gorm:"type:text"`
 	AppliedAt   time.Time  `json:"applied_at"`
 	ReviewedAt  *time.Time `json:"reviewed_at"`
@@ -175,6 +175,7 @@ type JobDetailResponse struct {
 type ApplyJobRequest struct {
 	ResumeID    uint   `json:"resume_id" binding:"required"`
 	CoverLetter string `json:"cover_letter"`
+	Source      string `json:"source"` // 候选人来源：search, recommendation, matching, referral 等
 }
 
 // JobMatchingRequest 职位匹配请求
@@ -231,10 +232,11 @@ const (
 
 // 申请状态常量
 const (
-	ApplicationStatusPending  = "pending"
-	ApplicationStatusReviewed = "reviewed"
-	ApplicationStatusAccepted = "accepted"
-	ApplicationStatusRejected = "rejected"
+	ApplicationStatusPending   = "pending"
+	ApplicationStatusReviewed  = "reviewed"
+	ApplicationStatusInterview = "interview"
+	ApplicationStatusAccepted  = "accepted"
+	ApplicationStatusRejected  = "rejected"
 )
 
 // 工作类型常量
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 招聘事件类型，与statistics-service保持一致
+const (
+	RecruitmentJobViewed            = "job_viewed"
+	RecruitmentApplicationSubmitted = "application_submitted"
+	RecruitmentApplicationReviewed  = "application_reviewed"
+	RecruitmentInterviewScheduled   = "interview_scheduled"
+	RecruitmentCandidateHired       = "candidate_hired"
+	RecruitmentApplicationRejected  = "application_rejected"
+	RecruitmentApplicationWithdrawn = "application_withdrawn"
+)
+
+// RecruitmentEvent 上报给统计服务的招聘事件
+type RecruitmentEvent struct {
+	EventID       string    `json:"event_id"`
+	EventType     string    `json:"event_type"`
+	JobID         uint      `json:"job_id"`
+	CompanyID     uint      `json:"company_id"`
+	ApplicationID uint      `json:"application_id,omitempty"`
+	UserID        uint      `json:"user_id,omitempty"`
+	Source        string    `json:"source,omitempty"`
+	OccurredAt    time.Time `json:"occurred_at"`
+}
+
+// StatisticsClient Statistics服务客户端
+type StatisticsClient struct {
+	baseURL    string
+	eventToken string
+	httpClient *http.Client
+}
+
+// NewStatisticsClient 创建Statistics服务客户端
+func NewStatisticsClient(baseURL, eventToken string) *StatisticsClient {
+	return &StatisticsClient{
+		baseURL:    baseURL,
+		eventToken: eventToken,
+		httpClient: &http.Client{
+			Timeout: 5 * time.Second,
+		},
+	}
+}
+
+// statisticsClient 全局统计服务客户端，地址和令牌来自 STATISTICS_SERVICE_URL、STATISTICS_EVENT_TOKEN
+var statisticsClient = func() *StatisticsClient {
+	baseURL := os.Getenv("STATISTICS_SERVICE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8086"
+	}
+	return NewStatisticsClient(baseURL, os.Getenv("STATISTICS_EVENT_TOKEN"))
+}()
+
+// TrackRecruitmentEvent 异步上报招聘事件，失败时重试，不影响业务请求
+// 申请状态类事件的EventID由申请ID和事件类型确定，重复上报会被统计服务忽略
+func (sc *StatisticsClient) TrackRecruitmentEvent(event RecruitmentEvent) {
+	if event.EventID == "" {
+		if event.ApplicationID > 0 {
+			event.EventID = fmt.Sprintf("application:%d:%s", event.ApplicationID, event.EventType)
+		} else {
+			event.EventID = uuid.NewString()
+		}
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	go func() {
+		var err error
+		for attempt := 0; attempt < 3; attempt++ {
+			if attempt > 0 {
+				time.Sleep(time.Duration(attempt) * time.Second)
+			}
+			if err = sc.postRecruitmentEvent(event); err == nil {
+				return
+			}
+		}
+		log.Printf("上报招聘事件失败 %s: %v", event.EventID, err)
+	}()
+}
+
+// postRecruitmentEvent 发送单个招聘事件
+func (sc *StatisticsClient) postRecruitmentEvent(event RecruitmentEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("序列化事件失败: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, sc.baseURL+"/api/v1/statistics/events/recruitment", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sc.eventToken != "" {
+		req.Header.Set("X-Event-Token", sc.eventToken)
+	}
+
+	resp, err := sc.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求Statistics服务失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Statistics服务返回错误状态: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// applicationStatusEvent 申请状态对应的招聘事件类型，没有对应事件时返回空
+func applicationStatusEvent(status string) string {
+	switch status {
+	case ApplicationStatusReviewed:
+		return RecruitmentApplicationReviewed
+	case ApplicationStatusInterview:
+		return RecruitmentInterviewScheduled
+	case ApplicationStatusAccepted:
+		return RecruitmentCandidateHired
+	case ApplicationStatusRejected:
+		return RecruitmentApplicationRejected
+	}
+	return ""
+}
@@ -214,5 +214,54 @@ func setupServiceIntegrationRoutes(r *gin.Engine, si *ServiceIntegration) {
 				"message": "订阅变更事件处理完成",
 			})
 		})
+
+		// 报表生成事件
+		eventAPI.POST("/report-generated", func(c *gin.Context) {
+			var req ReportGeneratedEvent
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			failed := si.SendReportNotifications(req)
+			if len(failed) == len(req.Recipients) && len(failed) > 0 {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":   "处理报表生成事件失败",
+					"details": failed,
+				})
+				return
+			}
+
+			response := gin.H{
+				"status":  "success",
+				"message": "报表生成事件处理完成",
+			}
+			if len(failed) > 0 {
+				response["failed"] = failed
+			}
+			c.JSON(http.StatusOK, response)
+		})
+
+		// 可疑登录事件
+		eventAPI.POST("/suspicious-login", func(c *gin.Context) {
+			var req SuspiciousLoginEvent
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			if err := si.SendSuspiciousLoginNotification(req); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":   "处理可疑登录事件失败",
+					"details": err.Error(),
+				})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "success",
+				"message": "可疑登录事件处理完成",
+			})
+		})
 	}
 }
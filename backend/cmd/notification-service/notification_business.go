@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/jobfirst/jobfirst-core"
@@ -200,6 +201,61 @@ func (nb *NotificationBusiness) SendCostControlNotification(userID uint, notific
 	)
 }
 
+// SendReportNotification 发送报表生成通知，附带各格式文件的下载地址
+func (nb *NotificationBusiness) SendReportNotification(userID, reportID, runID uint, reportName, period string, artifacts []ReportArtifactInfo) error {
+	formats := make([]string, 0, len(artifacts))
+	for _, a := range artifacts {
+		formats = append(formats, strings.ToUpper(a.Format))
+	}
+	metadata := map[string]interface{}{
+		"report_id": reportID,
+		"run_id":    runID,
+		"period":    period,
+		"artifacts": artifacts,
+		"timestamp": time.Now().Unix(),
+	}
+
+	metadataJSON, _ := json.Marshal(metadata)
+
+	return nb.CreateNotification(
+		userID,
+		"report_generated",
+		fmt.Sprintf("报表已生成：%s", reportName),
+		fmt.Sprintf("报表「%s」（%s）已生成，可下载格式：%s。", reportName, period, strings.Join(formats, "、")),
+		"report",
+		"normal",
+		string(metadataJSON),
+	)
+}
+
+// SendSecurityNotification 发送可疑登录安全通知
+func (nb *NotificationBusiness) SendSecurityNotification(userID uint, clientIP string, failures int64, locked bool, occurredAt time.Time) error {
+	metadata := map[string]interface{}{
+		"client_ip":   clientIP,
+		"failures":    failures,
+		"locked":      locked,
+		"occurred_at": occurredAt.Unix(),
+	}
+
+	metadataJSON, _ := json.Marshal(metadata)
+
+	content := fmt.Sprintf("您的账户于%s出现%d次登录失败（IP：%s）。如非本人操作，请尽快修改密码。",
+		occurredAt.Format("2006-01-02 15:04:05"), failures, clientIP)
+	if locked {
+		content += "账户已被临时锁定。"
+	}
+
+	return nb.CreateNotification(
+		userID,
+		"suspicious_login",
+		"账户安全提醒：检测到可疑登录",
+		content,
+		"security",
+		"high",
+		string(metadataJSON),
+	)
+}
+
 // CheckAndSendQuotaWarning 检查并发送配额警告通知
 func (nb *NotificationBusiness) CheckAndSendQuotaWarning(userID uint) error {
 	// 这里需要调用Company服务的AI配额API来获取用户配额信息
@@ -200,6 +200,52 @@ func (si *ServiceIntegration) SendWelcomeNotification(userID uint) error {
 	return nil
 }
 
+// ReportArtifactInfo 报表文件信息
+type ReportArtifactInfo struct {
+	Format string `json:"format"`
+	Size   int    `json:"size"`
+	URL    string `json:"url"`
+}
+
+// ReportGeneratedEvent 统计服务报表生成事件
+type ReportGeneratedEvent struct {
+	Recipients []uint               `json:"recipients" binding:"required"`
+	ReportID   uint                 `json:"report_id" binding:"required"`
+	ReportName string               `json:"report_name" binding:"required"`
+	RunID      uint                 `json:"run_id" binding:"required"`
+	Period     string               `json:"period"`
+	Artifacts  []ReportArtifactInfo `json:"artifacts"`
+}
+
+// SendReportNotifications 通知接收人报表已生成，返回发送失败的用户
+func (si *ServiceIntegration) SendReportNotifications(event ReportGeneratedEvent) map[uint]string {
+	failed := make(map[uint]string)
+	for _, userID := range event.Recipients {
+		if err := si.notificationBusiness.SendReportNotification(userID, event.ReportID, event.RunID, event.ReportName, event.Period, event.Artifacts); err != nil {
+			failed[userID] = err.Error()
+		}
+	}
+	return failed
+}
+
+// SuspiciousLoginEvent 认证服务可疑登录事件
+type SuspiciousLoginEvent struct {
+	UserID     uint      `json:"user_id" binding:"required"`
+	Username   string    `json:"username" binding:"required"`
+	ClientIP   string    `json:"client_ip"`
+	Failures   int64     `json:"failures"`
+	Locked     bool      `json:"locked"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// SendSuspiciousLoginNotification 通知账户所有者出现可疑登录
+func (si *ServiceIntegration) SendSuspiciousLoginNotification(event SuspiciousLoginEvent) error {
+	if err := si.notificationBusiness.SendSecurityNotification(event.UserID, event.ClientIP, event.Failures, event.Locked, event.OccurredAt); err != nil {
+		return fmt.Errorf("发送可疑登录通知失败: %v", err)
+	}
+	return nil
+}
+
 // getUserQuotaFromCompanyService 从Company服务获取用户配额信息
 func (si *ServiceIntegration) getUserQuotaFromCompanyService(userID uint) (*UserQuotaInfo, error) {
 	url := fmt.Sprintf("http://localhost:8083/api/v1/quota/user/%d", userID)
@@ -0,0 +1,577 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 异常检测方法
+const (
+	DetectorZScore      = "zscore"       // 滚动Z分数
+	DetectorMAD         = "mad"          // 中位数绝对偏差
+	DetectorSeasonal    = "seasonal"     // 周期分解（STL风格，按天聚合、周周期）
+	DetectorChangePoint = "change_point" // 均值变点检测
+)
+
+// 异常类型
+const (
+	AnomalyTypeSpike         = "spike"
+	AnomalyTypeDrop          = "drop"
+	AnomalyTypePatternChange = "pattern_change"
+)
+
+// madScale 正态分布下MAD与标准差的换算系数
+const madScale = 1.4826
+
+// AnomalyDetectorConfig 指标级异常检测配置
+type AnomalyDetectorConfig struct {
+	ID                   uint      `json:"id" gorm:"primaryKey"`
+	MetricName           string    `json:"metric_name" gorm:"size:100;uniqueIndex;not null"`
+	Methods              string    `json:"methods" gorm:"size:100"` // 逗号分隔，为空时使用全部方法
+	Window               int       `json:"window"`                  // 滚动窗口大小（点数）
+	ZScoreThreshold      float64   `json:"zscore_threshold"`        // |z| 超过该值判定异常
+	MADThreshold         float64   `json:"mad_threshold"`           // 修正Z分数阈值
+	SeasonalPeriod       int       `json:"seasonal_period"`         // 周期长度（天）
+	SeasonalThreshold    float64   `json:"seasonal_threshold"`      // 残差稳健Z分数阈值
+	ChangePointPenalty   float64   `json:"change_point_penalty"`    // 变点惩罚系数，越大越不敏感
+	ChangePointMinLength int       `json:"change_point_min_length"` // 变点两侧最少点数
+	LookbackDays         int       `json:"lookback_days"`           // 检测使用的历史天数
+	Enabled              bool      `json:"enabled"`
+	UpdatedBy            uint      `json:"updated_by"`
+	CreatedAt            time.Time `json:"created_at"`
+	UpdatedAt            time.Time `json:"updated_at"`
+}
+
+// DefaultAnomalyDetectorConfig 默认检测配置
+func DefaultAnomalyDetectorConfig(metricName string) AnomalyDetectorConfig {
+	return AnomalyDetectorConfig{
+		MetricName:           metricName,
+		Methods:              strings.Join([]string{DetectorZScore, DetectorMAD, DetectorSeasonal, DetectorChangePoint}, ","),
+		Window:               30,
+		ZScoreThreshold:      3.0,
+		MADThreshold:         3.5,
+		SeasonalPeriod:       7,
+		SeasonalThreshold:    4.5,
+		ChangePointPenalty:   3.0,
+		ChangePointMinLength: 5,
+		LookbackDays:         90,
+		Enabled:              true,
+	}
+}
+
+// normalize 补全未设置的参数
+func (c AnomalyDetectorConfig) normalize() AnomalyDetectorConfig {
+	defaults := DefaultAnomalyDetectorConfig(c.MetricName)
+	if c.Methods == "" {
+		c.Methods = defaults.Methods
+	}
+	if c.Window < 3 {
+		c.Window = defaults.Window
+	}
+	if c.ZScoreThreshold <= 0 {
+		c.ZScoreThreshold = defaults.ZScoreThreshold
+	}
+	if c.MADThreshold <= 0 {
+		c.MADThreshold = defaults.MADThreshold
+	}
+	if c.SeasonalPeriod < 2 {
+		c.SeasonalPeriod = defaults.SeasonalPeriod
+	}
+	if c.SeasonalThreshold <= 0 {
+		c.SeasonalThreshold = defaults.SeasonalThreshold
+	}
+	if c.ChangePointPenalty <= 0 {
+		c.ChangePointPenalty = defaults.ChangePointPenalty
+	}
+	if c.ChangePointMinLength < 2 {
+		c.ChangePointMinLength = defaults.ChangePointMinLength
+	}
+	if c.LookbackDays <= 0 {
+		c.LookbackDays = defaults.LookbackDays
+	}
+	return c
+}
+
+// AnomalyDetectorConfigUpdate 检测配置的部分更新，只修改请求中出现的字段
+type AnomalyDetectorConfigUpdate struct {
+	Methods              *string  `json:"methods"`
+	Window               *int     `json:"window"`
+	ZScoreThreshold      *float64 `json:"zscore_threshold"`
+	MADThreshold         *float64 `json:"mad_threshold"`
+	SeasonalPeriod       *int     `json:"seasonal_period"`
+	SeasonalThreshold    *float64 `json:"seasonal_threshold"`
+	ChangePointPenalty   *float64 `json:"change_point_penalty"`
+	ChangePointMinLength *int     `json:"change_point_min_length"`
+	LookbackDays         *int     `json:"lookback_days"`
+	Enabled              *bool    `json:"enabled"`
+}
+
+// Apply 将请求中出现的字段合并到现有配置
+func (u AnomalyDetectorConfigUpdate) Apply(c AnomalyDetectorConfig) AnomalyDetectorConfig {
+	if u.Methods != nil {
+		c.Methods = *u.Methods
+	}
+	if u.Window != nil {
+		c.Window = *u.Window
+	}
+	if u.ZScoreThreshold != nil {
+		c.ZScoreThreshold = *u.ZScoreThreshold
+	}
+	if u.MADThreshold != nil {
+		c.MADThreshold = *u.MADThreshold
+	}
+	if u.SeasonalPeriod != nil {
+		c.SeasonalPeriod = *u.SeasonalPeriod
+	}
+	if u.SeasonalThreshold != nil {
+		c.SeasonalThreshold = *u.SeasonalThreshold
+	}
+	if u.ChangePointPenalty != nil {
+		c.ChangePointPenalty = *u.ChangePointPenalty
+	}
+	if u.ChangePointMinLength != nil {
+		c.ChangePointMinLength = *u.ChangePointMinLength
+	}
+	if u.LookbackDays != nil {
+		c.LookbackDays = *u.LookbackDays
+	}
+	if u.Enabled != nil {
+		c.Enabled = *u.Enabled
+	}
+	return c
+}
+
+// MethodList 启用的检测方法
+func (c AnomalyDetectorConfig) MethodList() []string {
+	var methods []string
+	for _, m := range strings.Split(c.Methods, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			methods = append(methods, m)
+		}
+	}
+	return methods
+}
+
+// SeriesPoint 时间序列数据点
+type SeriesPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+	Missing   bool      `json:"missing,omitempty"` // 该时间点无数据（AggregateDaily补齐的占位日期）
+}
+
+// AnomalyFinding 检测结果
+type AnomalyFinding struct {
+	Method    string    `json:"method"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Expected  float64   `json:"expected"`
+	Observed  float64   `json:"observed"`
+	Score     float64   `json:"score"`     // 标准化偏离程度（Z分数或等价量）
+	Threshold float64   `json:"threshold"` // 判定阈值
+}
+
+// Severity 根据偏离程度与阈值的比值确定严重程度
+func (f AnomalyFinding) Severity() string {
+	ratio := math.Abs(f.Score) / f.Threshold
+	switch {
+	case ratio >= 2:
+		return "critical"
+	case ratio >= 1.5:
+		return "high"
+	case ratio >= 1.2:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// RunAnomalyDetectors 按配置对时间序列运行全部启用的检测方法
+func RunAnomalyDetectors(series []SeriesPoint, config AnomalyDetectorConfig) ([]AnomalyFinding, error) {
+	config = config.normalize()
+	var findings []AnomalyFinding
+	for _, method := range config.MethodList() {
+		switch method {
+		case DetectorZScore:
+			findings = append(findings, DetectRollingZScore(series, config.Window, config.ZScoreThreshold)...)
+		case DetectorMAD:
+			findings = append(findings, DetectMAD(series, config.Window, config.MADThreshold)...)
+		case DetectorSeasonal:
+			findings = append(findings, DetectSeasonal(AggregateDaily(series), config.SeasonalPeriod, config.SeasonalThreshold)...)
+		case DetectorChangePoint:
+			findings = append(findings, DetectChangePoints(series, config.ChangePointMinLength, config.ChangePointPenalty)...)
+		default:
+			return nil, fmt.Errorf("不支持的检测方法: %s", method)
+		}
+	}
+	return findings, nil
+}
+
+// DetectRollingZScore 滚动Z分数：用前window个点的均值和标准差评估当前点
+func DetectRollingZScore(series []SeriesPoint, window int, threshold float64) []AnomalyFinding {
+	var findings []AnomalyFinding
+	for i := window; i < len(series); i++ {
+		values := seriesValues(series[i-window : i])
+		m := mean(values)
+		sd := stddev(values, m)
+		observed := series[i].Value
+		if sd == 0 {
+			if observed == m {
+				continue
+			}
+			sd = fallbackScale(m)
+		}
+		z := (observed - m) / sd
+		if math.Abs(z) > threshold {
+			findings = append(findings, newFinding(DetectorZScore, series[i].Timestamp, m, observed, z, threshold))
+		}
+	}
+	return findings
+}
+
+// DetectMAD 中位数绝对偏差：对离群点本身不敏感的稳健检测
+func DetectMAD(series []SeriesPoint, window int, threshold float64) []AnomalyFinding {
+	var findings []AnomalyFinding
+	for i := window; i < len(series); i++ {
+		values := seriesValues(series[i-window : i])
+		med := median(values)
+		scale := madScale * medianAbsDeviation(values, med)
+		observed := series[i].Value
+		if scale == 0 {
+			if observed == med {
+				continue
+			}
+			scale = fallbackScale(med)
+		}
+		score := (observed - med) / scale
+		if math.Abs(score) > threshold {
+			findings = append(findings, newFinding(DetectorMAD, series[i].Timestamp, med, observed, score, threshold))
+		}
+	}
+	return findings
+}
+
+// DetectSeasonal STL风格的季节分解：趋势（中心移动平均）+ 季节（按周期位置取中位数）+ 残差，
+// 迭代三轮以降低异常点对趋势和季节分量的影响，残差稳健Z分数超过阈值判定异常。
+// 缺失点仅用相邻观测插值保持周期对齐，不参与季节分量和残差尺度的估计，也不会被判定为异常
+func DetectSeasonal(series []SeriesPoint, period int, threshold float64) []AnomalyFinding {
+	n := len(series)
+	if n < 2*period {
+		return nil
+	}
+	values, observed := interpolateMissing(series)
+	if len(observed) < 2*period {
+		return nil
+	}
+
+	seasonal := make([]float64, n)
+	var trend, residual []float64
+	for pass := 0; pass < 3; pass++ {
+		deseasonalized := make([]float64, n)
+		for i := range values {
+			deseasonalized[i] = values[i] - seasonal[i]
+		}
+		// 首轮用移动平均消除周期影响，之后对去季节序列用移动中位数估计趋势，避免异常点拉偏邻近趋势
+		if pass == 0 {
+			trend = centeredMovingAverage(deseasonalized, period)
+		} else {
+			trend = centeredMovingMedian(deseasonalized, period|1)
+		}
+
+		// 季节分量：各周期位置去趋势值的中位数，并中心化使一个周期内和为0
+		buckets := make([][]float64, period)
+		for _, i := range observed {
+			buckets[i%period] = append(buckets[i%period], values[i]-trend[i])
+		}
+		components := make([]float64, period)
+		for p := range buckets {
+			components[p] = median(buckets[p])
+		}
+		offset := mean(components)
+		for i := range seasonal {
+			seasonal[i] = components[i%period] - offset
+		}
+
+		residual = make([]float64, n)
+		for i := range values {
+			residual[i] = values[i] - trend[i] - seasonal[i]
+		}
+	}
+
+	observedResidual := make([]float64, len(observed))
+	for k, i := range observed {
+		observedResidual[k] = residual[i]
+	}
+	scale := madScale * medianAbsDeviation(observedResidual, median(observedResidual))
+	if scale == 0 {
+		scale = fallbackScale(mean(values))
+	}
+
+	var findings []AnomalyFinding
+	for _, i := range observed {
+		score := residual[i] / scale
+		if math.Abs(score) > threshold {
+			expected := trend[i] + seasonal[i]
+			findings = append(findings, newFinding(DetectorSeasonal, series[i].Timestamp, expected, values[i], score, threshold))
+		}
+	}
+	return findings
+}
+
+// DetectChangePoints 二分分割法检测均值变点，代价为分段平方误差，
+// 惩罚项为 penalty * 方差 * ln(n)（类BIC），变点两侧至少minLength个点
+func DetectChangePoints(series []SeriesPoint, minLength int, penalty float64) []AnomalyFinding {
+	n := len(series)
+	if n < 2*minLength {
+		return nil
+	}
+	values := seriesValues(series)
+
+	// 噪声方差用一阶差分的MAD估计，不受均值变化影响
+	diffs := make([]float64, n-1)
+	for i := 1; i < n; i++ {
+		diffs[i-1] = values[i] - values[i-1]
+	}
+	sigma := madScale * medianAbsDeviation(diffs, median(diffs)) / math.Sqrt2
+	if sigma == 0 {
+		sigma = stddev(values, mean(values))
+	}
+	if sigma == 0 {
+		return nil
+	}
+	minGain := penalty * sigma * sigma * math.Log(float64(n))
+
+	prefix := make([]float64, n+1)
+	prefixSq := make([]float64, n+1)
+	for i, v := range values {
+		prefix[i+1] = prefix[i] + v
+		prefixSq[i+1] = prefixSq[i] + v*v
+	}
+	cost := func(start, end int) float64 {
+		length := float64(end - start)
+		sum := prefix[end] - prefix[start]
+		return (prefixSq[end] - prefixSq[start]) - sum*sum/length
+	}
+
+	var changePoints []int
+	var split func(start, end int)
+	split = func(start, end int) {
+		if end-start < 2*minLength {
+			return
+		}
+		total := cost(start, end)
+		best, bestGain := -1, 0.0
+		for k := start + minLength; k <= end-minLength; k++ {
+			if gain := total - cost(start, k) - cost(k, end); gain > bestGain {
+				best, bestGain = k, gain
+			}
+		}
+		if best < 0 || bestGain < minGain {
+			return
+		}
+		changePoints = append(changePoints, best)
+		split(start, best)
+		split(best, end)
+	}
+	split(0, n)
+	sort.Ints(changePoints)
+
+	var findings []AnomalyFinding
+	bounds := append(append([]int{0}, changePoints...), n)
+	for i, cp := range changePoints {
+		before := mean(values[bounds[i]:cp])
+		after := mean(values[cp:bounds[i+2]])
+		score := (after - before) / sigma
+		finding := newFinding(DetectorChangePoint, series[cp].Timestamp, before, after, score, math.Sqrt(penalty*math.Log(float64(n))))
+		finding.Type = AnomalyTypePatternChange
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+// AggregateDaily 按自然日聚合为日均值序列（季节分解需要等间隔数据）
+func AggregateDaily(series []SeriesPoint) []SeriesPoint {
+	if len(series) == 0 {
+		return nil
+	}
+	type bucket struct {
+		sum   float64
+		count int
+	}
+	buckets := make(map[time.Time]*bucket)
+	var days []time.Time
+	for _, p := range series {
+		day := time.Date(p.Timestamp.Year(), p.Timestamp.Month(), p.Timestamp.Day(), 0, 0, 0, 0, p.Timestamp.Location())
+		b, ok := buckets[day]
+		if !ok {
+			b = &bucket{}
+			buckets[day] = b
+			days = append(days, day)
+		}
+		b.sum += p.Value
+		b.count++
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+
+	// 缺失的日期标记为Missing占位，保证周期位置对齐；不能补0，否则数据缺口会被当成下跌
+	var result []SeriesPoint
+	for day := days[0]; !day.After(days[len(days)-1]); day = day.AddDate(0, 0, 1) {
+		b, ok := buckets[day]
+		if !ok {
+			result = append(result, SeriesPoint{Timestamp: day, Missing: true})
+			continue
+		}
+		result = append(result, SeriesPoint{Timestamp: day, Value: b.sum / float64(b.count)})
+	}
+	return result
+}
+
+// interpolateMissing 用前后最近观测值线性插值缺失点（两端取最近观测值），返回插值后的数值和观测点下标
+func interpolateMissing(series []SeriesPoint) ([]float64, []int) {
+	values := seriesValues(series)
+	var observed []int
+	for i, p := range series {
+		if !p.Missing {
+			observed = append(observed, i)
+		}
+	}
+	if len(observed) == 0 {
+		return values, nil
+	}
+	prev := -1
+	for _, next := range append(observed, len(series)) {
+		for i := prev + 1; i < next; i++ {
+			switch {
+			case prev < 0:
+				values[i] = values[next]
+			case next == len(series):
+				values[i] = values[prev]
+			default:
+				ratio := float64(i-prev) / float64(next-prev)
+				values[i] = values[prev] + ratio*(values[next]-values[prev])
+			}
+		}
+		prev = next
+	}
+	return values, observed
+}
+
+func newFinding(method string, ts time.Time, expected, observed, score, threshold float64) AnomalyFinding {
+	anomalyType := AnomalyTypeSpike
+	if observed < expected {
+		anomalyType = AnomalyTypeDrop
+	}
+	return AnomalyFinding{
+		Method:    method,
+		Type:      anomalyType,
+		Timestamp: ts,
+		Expected:  expected,
+		Observed:  observed,
+		Score:     score,
+		Threshold: threshold,
+	}
+}
+
+// centeredMovingAverage 中心移动平均（偶数周期使用2×period加权），两端用最近的有效值填充
+func centeredMovingAverage(values []float64, period int) []float64 {
+	n := len(values)
+	result := make([]float64, n)
+	half := period / 2
+	for i := half; i < n-half; i++ {
+		if period%2 == 1 {
+			result[i] = mean(values[i-half : i+half+1])
+			continue
+		}
+		sum := 0.5*values[i-half] + 0.5*values[i+half]
+		for j := i - half + 1; j < i+half; j++ {
+			sum += values[j]
+		}
+		result[i] = sum / float64(period)
+	}
+	for i := 0; i < half && i < n; i++ {
+		result[i] = result[half]
+	}
+	for i := n - half; i < n && i >= 0; i++ {
+		result[i] = result[n-half-1]
+	}
+	return result
+}
+
+// fallbackScale 历史数据完全恒定时的尺度：取中心值的1%（中心为0时取1）
+func fallbackScale(center float64) float64 {
+	if center == 0 {
+		return 1
+	}
+	return math.Abs(center) * 0.01
+}
+
+// centeredMovingMedian 中心移动中位数（window为奇数），两端窗口截断
+func centeredMovingMedian(values []float64, window int) []float64 {
+	n := len(values)
+	result := make([]float64, n)
+	half := window / 2
+	for i := range values {
+		start, end := i-half, i+half+1
+		if start < 0 {
+			start = 0
+		}
+		if end > n {
+			end = n
+		}
+		result[i] = median(values[start:end])
+	}
+	return result
+}
+
+func seriesValues(series []SeriesPoint) []float64 {
+	values := make([]float64, len(series))
+	for i, p := range series {
+		values[i] = p.Value
+	}
+	return values
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func stddev(values []float64, m float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += (v - m) * (v - m)
+	}
+	return math.Sqrt(sum / float64(len(values)-1))
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func medianAbsDeviation(values []float64, med float64) float64 {
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - med)
+	}
+	return median(deviations)
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+var seriesStart = time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC) // 周一
+
+// syntheticSeries 生成带高斯噪声的序列，gen 给出无噪声的基准值
+func syntheticSeries(n int, step time.Duration, noise float64, seed int64, gen func(i int) float64) []SeriesPoint {
+	rng := rand.New(rand.NewSource(seed))
+	series := make([]SeriesPoint, n)
+	for i := range series {
+		series[i] = SeriesPoint{
+			Timestamp: seriesStart.Add(time.Duration(i) * step),
+			Value:     gen(i) + rng.NormFloat64()*noise,
+		}
+	}
+	return series
+}
+
+func findingsAt(findings []AnomalyFinding, ts time.Time) []AnomalyFinding {
+	var result []AnomalyFinding
+	for _, f := range findings {
+		if f.Timestamp.Equal(ts) {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// TestRollingZScoreAndMADDetectSpike 平稳序列中注入的峰值和谷值应被检出，且无其他误报
+func TestRollingZScoreAndMADDetectSpike(t *testing.T) {
+	series := syntheticSeries(200, time.Hour, 2, 1, func(int) float64 { return 100 })
+	series[120].Value = 140
+	series[160].Value = 60
+
+	for name, findings := range map[string][]AnomalyFinding{
+		DetectorZScore: DetectRollingZScore(series, 30, 4),
+		DetectorMAD:    DetectMAD(series, 30, 5),
+	} {
+		if len(findings) != 2 {
+			t.Fatalf("%s: 期望2个异常，实际 %d: %+v", name, len(findings), findings)
+		}
+		if f := findings[0]; !f.Timestamp.Equal(series[120].Timestamp) || f.Type != AnomalyTypeSpike {
+			t.Errorf("%s: 峰值检测错误 %+v", name, f)
+		}
+		if f := findings[1]; !f.Timestamp.Equal(series[160].Timestamp) || f.Type != AnomalyTypeDrop {
+			t.Errorf("%s: 谷值检测错误 %+v", name, f)
+		}
+		if math.Abs(findings[0].Expected-100) > 2 || findings[0].Observed != 140 {
+			t.Errorf("%s: 期望值/观测值错误 %+v", name, findings[0])
+		}
+		if findings[0].Severity() != "critical" {
+			t.Errorf("%s: 20σ偏离应为critical，实际 %s", name, findings[0].Severity())
+		}
+	}
+}
+
+// TestMADRobustToContaminatedWindow 窗口内已有离群点时MAD仍能检出后续异常，而Z分数被拉大的标准差掩盖
+func TestMADRobustToContaminatedWindow(t *testing.T) {
+	series := syntheticSeries(60, time.Hour, 1, 2, func(int) float64 { return 50 })
+	for _, i := range []int{30, 33, 36} {
+		series[i].Value = 150
+	}
+	series[40].Value = 58
+
+	if len(findingsAt(DetectMAD(series, 20, 3.5), series[40].Timestamp)) != 1 {
+		t.Error("MAD应检出被污染窗口之后的异常")
+	}
+	if len(findingsAt(DetectRollingZScore(series, 20, 3.5), series[40].Timestamp)) != 0 {
+		t.Error("Z分数在被污染窗口下不应检出该点（用于对照MAD的稳健性）")
+	}
+}
+
+// TestSeasonalDetectsOffCycleAnomaly 周循环序列：工作日高峰不是异常，周末出现工作日水平的值才是异常
+func TestSeasonalDetectsOffCycleAnomaly(t *testing.T) {
+	weekly := func(i int) float64 {
+		if i%7 >= 5 {
+			return 40 // 周末
+		}
+		return 100
+	}
+	series := syntheticSeries(8*7, 24*time.Hour, 2, 3, func(i int) float64 { return weekly(i) + 0.2*float64(i) })
+	anomalyDay := 4*7 + 5 // 第5周周六
+	series[anomalyDay].Value = 100 + 0.2*float64(anomalyDay)
+
+	findings := DetectSeasonal(series, 7, 5)
+	if len(findings) != 1 {
+		t.Fatalf("期望1个季节性异常，实际 %d: %+v", len(findings), findings)
+	}
+	f := findings[0]
+	if !f.Timestamp.Equal(series[anomalyDay].Timestamp) || f.Type != AnomalyTypeSpike {
+		t.Errorf("季节性异常检测错误 %+v", f)
+	}
+	if math.Abs(f.Expected-(40+0.2*float64(anomalyDay))) > 5 {
+		t.Errorf("期望值应接近周末水平，实际 %.2f", f.Expected)
+	}
+
+	// 同一数据在全局视角下不是离群点（与工作日持平）
+	if len(findingsAt(DetectMAD(series, 28, 3.5), series[anomalyDay].Timestamp)) != 0 {
+		t.Error("不考虑周期的MAD不应检出该点")
+	}
+}
+
+// TestSeasonalNoFalsePositives 干净的周期序列不应产生异常
+func TestSeasonalNoFalsePositives(t *testing.T) {
+	series := syntheticSeries(10*7, 24*time.Hour, 1, 4, func(i int) float64 {
+		return 200 + 50*math.Sin(2*math.Pi*float64(i%7)/7)
+	})
+	if findings := DetectSeasonal(series, 7, 4); len(findings) != 0 {
+		t.Errorf("期望无异常，实际 %+v", findings)
+	}
+}
+
+// TestChangePointDetectsLevelShifts 两次均值跃迁应在正确位置被检出
+func TestChangePointDetectsLevelShifts(t *testing.T) {
+	series := syntheticSeries(150, time.Hour, 3, 5, func(i int) float64 {
+		switch {
+		case i < 60:
+			return 100
+		case i < 110:
+			return 130
+		default:
+			return 90
+		}
+	})
+
+	findings := DetectChangePoints(series, 5, 3)
+	if len(findings) != 2 {
+		t.Fatalf("期望2个变点，实际 %d: %+v", len(findings), findings)
+	}
+	for i, want := range []struct {
+		index    int
+		before   float64
+		after    float64
+		positive bool
+	}{{60, 100, 130, true}, {110, 130, 90, false}} {
+		f := findings[i]
+		got := int(f.Timestamp.Sub(seriesStart) / time.Hour)
+		if abs := got - want.index; abs < -2 || abs > 2 {
+			t.Errorf("变点%d位置期望 %d，实际 %d", i, want.index, got)
+		}
+		if f.Type != AnomalyTypePatternChange || (f.Score > 0) != want.positive {
+			t.Errorf("变点%d类型或方向错误 %+v", i, f)
+		}
+		if math.Abs(f.Expected-want.before) > 3 || math.Abs(f.Observed-want.after) > 3 {
+			t.Errorf("变点%d前后均值错误 %+v", i, f)
+		}
+	}
+
+	flat := syntheticSeries(150, time.Hour, 3, 6, func(int) float64 { return 100 })
+	if findings := DetectChangePoints(flat, 5, 3); len(findings) != 0 {
+		t.Errorf("平稳序列不应检出变点，实际 %+v", findings)
+	}
+}
+
+// TestSensitivityConfig 阈值越低越敏感，配置的方法列表决定运行哪些检测器
+func TestSensitivityConfig(t *testing.T) {
+	series := syntheticSeries(100, time.Hour, 2, 7, func(int) float64 { return 100 })
+	series[80].Value = 109 // 约4.5σ
+
+	strict := DefaultAnomalyDetectorConfig("m")
+	strict.Methods = DetectorZScore
+	strict.ZScoreThreshold = 6
+	if findings, _ := RunAnomalyDetectors(series, strict); len(findingsAt(findings, series[80].Timestamp)) != 0 {
+		t.Error("高阈值下不应检出4.5σ偏离")
+	}
+
+	sensitive := strict
+	sensitive.ZScoreThreshold = 3.5
+	findings, err := RunAnomalyDetectors(series, sensitive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findingsAt(findings, series[80].Timestamp)) != 1 {
+		t.Error("低阈值下应检出4.5σ偏离")
+	}
+	for _, f := range findings {
+		if f.Method != DetectorZScore {
+			t.Errorf("仅应运行zscore检测器，实际出现 %s", f.Method)
+		}
+	}
+
+	bad := DefaultAnomalyDetectorConfig("m")
+	bad.Methods = "unknown"
+	if _, err := RunAnomalyDetectors(series, bad); err == nil {
+		t.Error("未知检测方法应返回错误")
+	}
+}
+
+// TestConfigUpdateAppliesSentFields 部分更新只修改请求中出现的字段，未传enabled时不会关闭检测
+func TestConfigUpdateAppliesSentFields(t *testing.T) {
+	current := DefaultAnomalyDetectorConfig("m")
+	current.Window = 14
+
+	var update AnomalyDetectorConfigUpdate
+	if err := json.Unmarshal([]byte(`{"zscore_threshold": 4}`), &update); err != nil {
+		t.Fatal(err)
+	}
+	got := update.Apply(current)
+	if !got.Enabled || got.ZScoreThreshold != 4 || got.Window != 14 || got.Methods != current.Methods {
+		t.Errorf("部分更新结果错误: %+v", got)
+	}
+
+	if err := json.Unmarshal([]byte(`{"enabled": false}`), &update); err != nil {
+		t.Fatal(err)
+	}
+	if got = update.Apply(got); got.Enabled || got.ZScoreThreshold != 4 {
+		t.Errorf("显式关闭检测失败: %+v", got)
+	}
+}
+
+// TestAggregateDailyMarksGaps 按天聚合，缺失日期标记为缺失而不是补0
+func TestAggregateDailyMarksGaps(t *testing.T) {
+	series := []SeriesPoint{
+		{Timestamp: seriesStart.Add(1 * time.Hour), Value: 10},
+		{Timestamp: seriesStart.Add(5 * time.Hour), Value: 20},
+		{Timestamp: seriesStart.Add(50 * time.Hour), Value: 7},
+	}
+	daily := AggregateDaily(series)
+	if len(daily) != 3 || daily[0].Value != 15 || !daily[1].Missing || daily[2].Value != 7 || daily[2].Missing {
+		t.Errorf("聚合结果错误: %+v", daily)
+	}
+}
+
+// TestSeasonalIgnoresMissingDays 采集中断的日期不应被判定为下跌，也不影响其余日期的检测
+func TestSeasonalIgnoresMissingDays(t *testing.T) {
+	var series []SeriesPoint
+	for _, p := range syntheticSeries(8*7*4, 6*time.Hour, 2, 3, func(int) float64 { return 100 }) {
+		day := int(p.Timestamp.Sub(seriesStart) / (24 * time.Hour))
+		if day == 20 || day == 21 || day == 35 { // 采集中断
+			continue
+		}
+		if day == 45 {
+			p.Value = 160
+		}
+		series = append(series, p)
+	}
+
+	config := DefaultAnomalyDetectorConfig("m")
+	config.Methods = DetectorSeasonal
+	config.SeasonalThreshold = 6
+	findings, err := RunAnomalyDetectors(series, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || !findings[0].Timestamp.Equal(seriesStart.AddDate(0, 0, 45)) || findings[0].Type != AnomalyTypeSpike {
+		t.Fatalf("期望只检出第45天的峰值，实际 %+v", findings)
+	}
+	if math.Abs(findings[0].Expected-100) > 5 {
+		t.Errorf("缺失日期不应拉低期望值，实际 %.2f", findings[0].Expected)
+	}
+}
+
+// TestSeverity 严重程度按偏离/阈值比例分级
+func TestSeverity(t *testing.T) {
+	cases := map[float64]string{3.1: "low", 3.7: "medium", 4.6: "high", -6.5: "critical"}
+	for score, want := range cases {
+		if got := (AnomalyFinding{Score: score, Threshold: 3}).Severity(); got != want {
+			t.Errorf("score=%.1f: 期望 %s，实际 %s", score, want, got)
+		}
+	}
+}
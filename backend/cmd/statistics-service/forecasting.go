@@ -0,0 +1,526 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// 预测模型类型
+const (
+	ForecastHoltWinters      = "holt_winters"
+	ForecastLinearRegression = "linear_regression"
+	ForecastSeasonalNaive    = "seasonal_naive"
+)
+
+// forecastZ95 95%预测区间的正态分位数
+const forecastZ95 = 1.96
+
+// ForecastPoint 第Step步（训练序列之后）的预测值及95%预测区间
+type ForecastPoint struct {
+	Step  int       `json:"step"`
+	Date  time.Time `json:"date"`
+	Value float64   `json:"value"`
+	Lower float64   `json:"lower"`
+	Upper float64   `json:"upper"`
+}
+
+// Forecaster 日度时间序列预测模型，拟合后的参数通过JSON持久化
+type Forecaster interface {
+	Fit(values []float64, start time.Time) error
+	Forecast(horizon int) []ForecastPoint
+}
+
+// ForecastConfig 预测模型配置，来自模型的model_parameters
+type ForecastConfig struct {
+	MetricType      string `json:"metric_type"`
+	MetricName      string `json:"metric_name"`
+	Aggregate       string `json:"aggregate"`     // 每日聚合方式：sum, avg, count
+	SeasonLength    int    `json:"season_length"` // 季节周期（天）
+	LookbackDays    int    `json:"lookback_days"` // 训练使用的历史天数
+	BacktestHorizon int    `json:"backtest_horizon"`
+	BacktestFolds   int    `json:"backtest_folds"`
+}
+
+// normalize 补全未设置的参数
+func (c ForecastConfig) normalize() ForecastConfig {
+	if c.Aggregate == "" {
+		c.Aggregate = "sum"
+	}
+	if c.SeasonLength < 2 {
+		c.SeasonLength = 7
+	}
+	if c.LookbackDays <= 0 {
+		c.LookbackDays = 365
+	}
+	if c.BacktestHorizon <= 0 {
+		c.BacktestHorizon = c.SeasonLength * 2
+	}
+	if c.BacktestFolds <= 0 {
+		c.BacktestFolds = 3
+	}
+	return c
+}
+
+// NormalizeForecastModelType 校验模型类型，regression视为linear_regression
+func NormalizeForecastModelType(modelType string) (string, error) {
+	switch strings.ToLower(modelType) {
+	case ForecastHoltWinters:
+		return ForecastHoltWinters, nil
+	case ForecastLinearRegression, "regression":
+		return ForecastLinearRegression, nil
+	case ForecastSeasonalNaive:
+		return ForecastSeasonalNaive, nil
+	}
+	return "", fmt.Errorf("不支持的预测模型类型: %s（支持 %s, %s, %s）",
+		modelType, ForecastHoltWinters, ForecastLinearRegression, ForecastSeasonalNaive)
+}
+
+// NewForecaster 创建未训练的预测模型
+func NewForecaster(modelType string, seasonLength int) (Forecaster, error) {
+	switch modelType {
+	case ForecastHoltWinters:
+		return &HoltWinters{SeasonLength: seasonLength}, nil
+	case ForecastLinearRegression:
+		return &CalendarRegression{}, nil
+	case ForecastSeasonalNaive:
+		return &SeasonalNaive{SeasonLength: seasonLength}, nil
+	}
+	return nil, fmt.Errorf("不支持的预测模型类型: %s", modelType)
+}
+
+// LoadForecaster 从持久化的参数恢复已训练的预测模型
+func LoadForecaster(modelType, fitted string) (Forecaster, error) {
+	forecaster, err := NewForecaster(modelType, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(fitted), forecaster); err != nil {
+		return nil, fmt.Errorf("解析模型参数失败: %w", err)
+	}
+	return forecaster, nil
+}
+
+// HoltWinters 加法季节性的Holt-Winters三次指数平滑
+type HoltWinters struct {
+	SeasonLength int       `json:"season_length"`
+	Alpha        float64   `json:"alpha"`
+	Beta         float64   `json:"beta"`
+	Gamma        float64   `json:"gamma"`
+	Level        float64   `json:"level"`
+	Trend        float64   `json:"trend"`
+	Season       []float64 `json:"season"` // Season[i] 为训练序列之后第 i+1 步的季节分量
+	Sigma        float64   `json:"sigma"`  // 一步预测残差标准差
+	End          time.Time `json:"end"`    // 训练序列最后一天
+}
+
+// holtWintersGrid 平滑参数的网格搜索取值
+var holtWintersGrid = []float64{0.05, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9}
+
+// Fit 网格搜索使一步预测误差平方和最小的平滑参数
+func (hw *HoltWinters) Fit(values []float64, start time.Time) error {
+	m := hw.SeasonLength
+	if m < 2 {
+		return fmt.Errorf("Holt-Winters季节周期必须大于1")
+	}
+	if len(values) < 2*m+1 {
+		return fmt.Errorf("%w: Holt-Winters至少需要 %d 个点", ErrInsufficientData, 2*m+1)
+	}
+
+	best := math.Inf(1)
+	for _, a := range holtWintersGrid {
+		for _, b := range holtWintersGrid {
+			for _, g := range holtWintersGrid {
+				sse, level, trend, season := holtWintersRun(values, m, a, b, g)
+				if sse < best {
+					best = sse
+					hw.Alpha, hw.Beta, hw.Gamma = a, b, g
+					hw.Level, hw.Trend, hw.Season = level, trend, season
+				}
+			}
+		}
+	}
+	hw.Sigma = math.Sqrt(best / float64(len(values)-m))
+	hw.End = start.AddDate(0, 0, len(values)-1)
+	return nil
+}
+
+// holtWintersRun 以第一个周期初始化并执行平滑，返回一步预测误差平方和与最终状态
+func holtWintersRun(values []float64, m int, a, b, g float64) (float64, float64, float64, []float64) {
+	level := mean(values[:m])
+	trend := (mean(values[m:2*m]) - level) / float64(m)
+	season := make([]float64, m)
+	for i := 0; i < m; i++ {
+		season[i] = values[i] - level
+	}
+
+	var sse float64
+	for t := m; t < len(values); t++ {
+		s := season[t%m]
+		e := values[t] - (level + trend + s)
+		sse += e * e
+		newLevel := a*(values[t]-s) + (1-a)*(level+trend)
+		trend = b*(newLevel-level) + (1-b)*trend
+		season[t%m] = g*(values[t]-newLevel) + (1-g)*s
+		level = newLevel
+	}
+
+	rotated := make([]float64, m)
+	for i := range rotated {
+		rotated[i] = season[(len(values)+i)%m]
+	}
+	return sse, level, trend, rotated
+}
+
+// Forecast 预测区间按加法Holt-Winters的h步方差近似
+func (hw *HoltWinters) Forecast(horizon int) []ForecastPoint {
+	m := len(hw.Season)
+	points := make([]ForecastPoint, horizon)
+	var variance float64 = 1
+	for h := 1; h <= horizon; h++ {
+		if h > 1 {
+			j := h - 1
+			c := hw.Alpha * (1 + float64(j)*hw.Beta)
+			if j%m == 0 {
+				c += hw.Gamma
+			}
+			variance += c * c
+		}
+		value := hw.Level + float64(h)*hw.Trend + hw.Season[(h-1)%m]
+		points[h-1] = newForecastPoint(h, hw.End, value, hw.Sigma*math.Sqrt(variance))
+	}
+	return points
+}
+
+// CalendarRegression 带日历特征（趋势、星期、月份）的线性回归
+type CalendarRegression struct {
+	Start        time.Time `json:"start"`
+	N            int       `json:"n"`
+	UseMonth     bool      `json:"use_month"` // 序列覆盖一年以上时才加入月份特征
+	Coefficients []float64 `json:"coefficients"`
+	Sigma        float64   `json:"sigma"`
+}
+
+// features 第t天的特征：截距、趋势、星期（以周日为基准）和月份（以一月为基准）哑变量
+func (lr *CalendarRegression) features(t int) []float64 {
+	date := lr.Start.AddDate(0, 0, t)
+	x := []float64{1, float64(t)}
+	for d := time.Monday; d <= time.Saturday; d++ {
+		x = append(x, indicator(date.Weekday() == d))
+	}
+	if lr.UseMonth {
+		for m := time.February; m <= time.December; m++ {
+			x = append(x, indicator(date.Month() == m))
+		}
+	}
+	return x
+}
+
+func indicator(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Fit 最小二乘拟合
+func (lr *CalendarRegression) Fit(values []float64, start time.Time) error {
+	lr.Start = start
+	lr.N = len(values)
+	lr.UseMonth = len(values) >= 365
+	p := len(lr.features(0))
+	if len(values) <= p+1 {
+		return fmt.Errorf("%w: 线性回归至少需要 %d 个点", ErrInsufficientData, p+2)
+	}
+
+	x := make([][]float64, len(values))
+	for t := range values {
+		x[t] = lr.features(t)
+	}
+	coefficients, err := leastSquares(x, values)
+	if err != nil {
+		return err
+	}
+	lr.Coefficients = coefficients
+
+	var sse float64
+	for t, y := range values {
+		e := y - dot(coefficients, x[t])
+		sse += e * e
+	}
+	lr.Sigma = math.Sqrt(sse / float64(len(values)-p))
+	return nil
+}
+
+// Forecast 预测区间使用残差标准差（不含参数估计误差）
+func (lr *CalendarRegression) Forecast(horizon int) []ForecastPoint {
+	end := lr.Start.AddDate(0, 0, lr.N-1)
+	points := make([]ForecastPoint, horizon)
+	for h := 1; h <= horizon; h++ {
+		value := dot(lr.Coefficients, lr.features(lr.N-1+h))
+		points[h-1] = newForecastPoint(h, end, value, lr.Sigma)
+	}
+	return points
+}
+
+// SeasonalNaive 季节性朴素预测：取上一个周期同一位置的值，作为其他模型的基线
+type SeasonalNaive struct {
+	SeasonLength int       `json:"season_length"`
+	LastSeason   []float64 `json:"last_season"`
+	Sigma        float64   `json:"sigma"`
+	End          time.Time `json:"end"`
+}
+
+// Fit 记录最后一个周期，残差为与上一周期同位置值之差
+func (sn *SeasonalNaive) Fit(values []float64, start time.Time) error {
+	m := sn.SeasonLength
+	if m < 1 {
+		return fmt.Errorf("季节周期必须大于0")
+	}
+	if len(values) < m+1 {
+		return fmt.Errorf("%w: 季节性朴素模型至少需要 %d 个点", ErrInsufficientData, m+1)
+	}
+	var sse float64
+	for t := m; t < len(values); t++ {
+		e := values[t] - values[t-m]
+		sse += e * e
+	}
+	sn.Sigma = math.Sqrt(sse / float64(len(values)-m))
+	sn.LastSeason = append([]float64(nil), values[len(values)-m:]...)
+	sn.End = start.AddDate(0, 0, len(values)-1)
+	return nil
+}
+
+// Forecast 第k个周期的区间宽度按√k增长
+func (sn *SeasonalNaive) Forecast(horizon int) []ForecastPoint {
+	m := len(sn.LastSeason)
+	points := make([]ForecastPoint, horizon)
+	for h := 1; h <= horizon; h++ {
+		k := float64((h-1)/m + 1)
+		points[h-1] = newForecastPoint(h, sn.End, sn.LastSeason[(h-1)%m], sn.Sigma*math.Sqrt(k))
+	}
+	return points
+}
+
+func newForecastPoint(step int, end time.Time, value, sigma float64) ForecastPoint {
+	return ForecastPoint{
+		Step:  step,
+		Date:  end.AddDate(0, 0, step),
+		Value: value,
+		Lower: value - forecastZ95*sigma,
+		Upper: value + forecastZ95*sigma,
+	}
+}
+
+// leastSquares 求解正规方程 (XᵀX + λI)β = Xᵀy，λ很小，仅用于避免哑变量全零时矩阵奇异
+func leastSquares(x [][]float64, y []float64) ([]float64, error) {
+	p := len(x[0])
+	a := make([][]float64, p)
+	for i := range a {
+		a[i] = make([]float64, p+1)
+	}
+	for r, row := range x {
+		for i := 0; i < p; i++ {
+			for j := 0; j < p; j++ {
+				a[i][j] += row[i] * row[j]
+			}
+			a[i][p] += row[i] * y[r]
+		}
+	}
+	for i := 1; i < p; i++ {
+		a[i][i] += 1e-8
+	}
+
+	// 高斯消元（部分主元）
+	for col := 0; col < p; col++ {
+		pivot := col
+		for r := col + 1; r < p; r++ {
+			if math.Abs(a[r][col]) > math.Abs(a[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, fmt.Errorf("回归矩阵奇异，无法求解")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for r := 0; r < p; r++ {
+			if r == col {
+				continue
+			}
+			f := a[r][col] / a[col][col]
+			for c := col; c <= p; c++ {
+				a[r][c] -= f * a[col][c]
+			}
+		}
+	}
+	beta := make([]float64, p)
+	for i := range beta {
+		beta[i] = a[i][p] / a[i][i]
+	}
+	return beta, nil
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// BacktestResult 滚动起点回测结果
+type BacktestResult struct {
+	ModelType  string  `json:"model_type"`
+	Folds      int     `json:"folds"`
+	Horizon    int     `json:"horizon"`
+	Points     int     `json:"points"`
+	MAPE       float64 `json:"mape"`        // 平均绝对百分比误差，跳过实际值为0的点
+	MAPEPoints int     `json:"mape_points"` // 参与MAPE计算的点数
+	RMSE       float64 `json:"rmse"`
+}
+
+// Backtest 以序列末尾的folds个连续窗口做滚动起点回测，每个窗口用之前的数据训练、预测horizon步
+func Backtest(modelType string, seasonLength int, values []float64, start time.Time, horizon, folds int) (*BacktestResult, error) {
+	result := &BacktestResult{ModelType: modelType, Horizon: horizon}
+	var sse, ape float64
+	for i := folds; i >= 1; i-- {
+		trainEnd := len(values) - i*horizon
+		if trainEnd <= 0 {
+			continue
+		}
+		forecaster, err := NewForecaster(modelType, seasonLength)
+		if err != nil {
+			return nil, err
+		}
+		if err := forecaster.Fit(values[:trainEnd], start); err != nil {
+			continue
+		}
+		for _, p := range forecaster.Forecast(horizon) {
+			actual := values[trainEnd+p.Step-1]
+			e := actual - p.Value
+			sse += e * e
+			result.Points++
+			if actual != 0 {
+				ape += math.Abs(e / actual)
+				result.MAPEPoints++
+			}
+		}
+		result.Folds++
+	}
+	if result.Folds == 0 {
+		return nil, fmt.Errorf("%w: 无法完成%s回测", ErrInsufficientData, modelType)
+	}
+	result.RMSE = math.Sqrt(sse / float64(result.Points))
+	if result.MAPEPoints > 0 {
+		result.MAPE = ape / float64(result.MAPEPoints)
+	}
+	return result, nil
+}
+
+// ForecastTrainingReport 训练报告：候选模型与季节性朴素基线的回测对比
+type ForecastTrainingReport struct {
+	ModelType string          `json:"model_type"`
+	Points    int             `json:"points"`
+	Start     time.Time       `json:"start"`
+	End       time.Time       `json:"end"`
+	Candidate *BacktestResult `json:"candidate"`
+	Baseline  *BacktestResult `json:"baseline"`
+	Promoted  bool            `json:"promoted"`
+	Reason    string          `json:"reason"`
+}
+
+// TrainForecast 回测候选模型和基线，并在全部数据上拟合候选模型
+// 候选模型的回测RMSE低于基线才会被推荐上线；季节性朴素模型本身即基线，直接上线
+func TrainForecast(modelType string, config ForecastConfig, values []float64, start time.Time) (Forecaster, *ForecastTrainingReport, error) {
+	config = config.normalize()
+	report := &ForecastTrainingReport{
+		ModelType: modelType,
+		Points:    len(values),
+		Start:     start,
+		End:       start.AddDate(0, 0, len(values)-1),
+	}
+
+	candidate, err := Backtest(modelType, config.SeasonLength, values, start, config.BacktestHorizon, config.BacktestFolds)
+	if err != nil {
+		return nil, nil, err
+	}
+	report.Candidate = candidate
+
+	if modelType == ForecastSeasonalNaive {
+		report.Baseline = candidate
+		report.Promoted = true
+		report.Reason = "季节性朴素模型即为基线"
+	} else {
+		baseline, err := Backtest(ForecastSeasonalNaive, config.SeasonLength, values, start, config.BacktestHorizon, config.BacktestFolds)
+		if err != nil {
+			return nil, nil, err
+		}
+		report.Baseline = baseline
+		report.Promoted = candidate.RMSE < baseline.RMSE
+		if report.Promoted {
+			report.Reason = fmt.Sprintf("回测RMSE %.4f 低于基线 %.4f", candidate.RMSE, baseline.RMSE)
+		} else {
+			report.Reason = fmt.Sprintf("回测RMSE %.4f 未低于基线 %.4f，不予上线", candidate.RMSE, baseline.RMSE)
+		}
+	}
+
+	forecaster, err := NewForecaster(modelType, config.SeasonLength)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := forecaster.Fit(values, start); err != nil {
+		return nil, nil, err
+	}
+	return forecaster, report, nil
+}
+
+// dailySeriesFromRollups 将天粒度汇总（可能含多个维度组合）合并为连续的日度序列，缺失日期为0
+func dailySeriesFromRollups(rollups []AnalyticsRollup, aggregate string) ([]float64, time.Time) {
+	if len(rollups) == 0 {
+		return nil, time.Time{}
+	}
+	type daily struct {
+		sum   float64
+		count int64
+	}
+	days := make(map[time.Time]*daily)
+	first, last := rollups[0].BucketStart, rollups[0].BucketStart
+	for _, r := range rollups {
+		day := truncateBucket(r.BucketStart, 24*time.Hour)
+		d, ok := days[day]
+		if !ok {
+			d = &daily{}
+			days[day] = d
+		}
+		d.sum += r.Sum
+		d.count += r.Count
+		if day.Before(first) {
+			first = day
+		}
+		if day.After(last) {
+			last = day
+		}
+	}
+
+	n := int(last.Sub(first).Hours()/24) + 1
+	values := make([]float64, n)
+	for i := range values {
+		d, ok := days[first.AddDate(0, 0, i)]
+		if !ok {
+			continue
+		}
+		switch aggregate {
+		case "count":
+			values[i] = float64(d.count)
+		case "avg":
+			if d.count > 0 {
+				values[i] = d.sum / float64(d.count)
+			}
+		default:
+			values[i] = d.sum
+		}
+	}
+	return values, first
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+// weeklyTrendSeries 带线性趋势和周循环的日度序列
+func weeklyTrendSeries(n int, noise float64, seed int64) []float64 {
+	return seriesValues(syntheticSeries(n, 24*time.Hour, noise, seed, func(i int) float64 {
+		return 200 + 1.5*float64(i) + 40*math.Sin(2*math.Pi*float64(i)/7)
+	}))
+}
+
+// TestHoltWintersForecast 拟合带趋势的周期序列，预测接近真实值且区间覆盖真实值
+func TestHoltWintersForecast(t *testing.T) {
+	values := weeklyTrendSeries(16*7, 2, 21)
+	hw := &HoltWinters{SeasonLength: 7}
+	if err := hw.Fit(values, seriesStart); err != nil {
+		t.Fatal(err)
+	}
+
+	forecast := hw.Forecast(14)
+	for _, p := range forecast {
+		i := len(values) - 1 + p.Step
+		truth := 200 + 1.5*float64(i) + 40*math.Sin(2*math.Pi*float64(i)/7)
+		if math.Abs(p.Value-truth) > 10 {
+			t.Errorf("第%d步预测 %.2f 偏离真实值 %.2f", p.Step, p.Value, truth)
+		}
+		if truth < p.Lower || truth > p.Upper {
+			t.Errorf("第%d步区间 [%.2f, %.2f] 未覆盖真实值 %.2f", p.Step, p.Lower, p.Upper, truth)
+		}
+	}
+	if forecast[13].Upper-forecast[13].Lower <= forecast[0].Upper-forecast[0].Lower {
+		t.Error("预测区间应随步数变宽")
+	}
+	if want := seriesStart.AddDate(0, 0, len(values)); !forecast[0].Date.Equal(want) {
+		t.Errorf("第一步日期期望 %s，实际 %s", want, forecast[0].Date)
+	}
+
+	if err := (&HoltWinters{SeasonLength: 7}).Fit(values[:10], seriesStart); err == nil {
+		t.Error("数据不足两个周期时应返回错误")
+	}
+}
+
+// TestCalendarRegressionLearnsWeekdayEffect 线性回归通过星期哑变量学习周末效应
+func TestCalendarRegressionLearnsWeekdayEffect(t *testing.T) {
+	values := seriesValues(syntheticSeries(12*7, 24*time.Hour, 1, 22, func(i int) float64 {
+		v := 50 + 0.5*float64(i)
+		if wd := seriesStart.AddDate(0, 0, i).Weekday(); wd == time.Saturday || wd == time.Sunday {
+			v -= 30
+		}
+		return v
+	}))
+	lr := &CalendarRegression{}
+	if err := lr.Fit(values, seriesStart); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(lr.Coefficients[1]-0.5) > 0.05 {
+		t.Errorf("趋势系数期望0.5，实际 %.3f", lr.Coefficients[1])
+	}
+	for _, p := range lr.Forecast(7) {
+		i := len(values) - 1 + p.Step
+		want := 50 + 0.5*float64(i)
+		if wd := p.Date.Weekday(); wd == time.Saturday || wd == time.Sunday {
+			want -= 30
+		}
+		if math.Abs(p.Value-want) > 3 {
+			t.Errorf("%s 预测 %.2f，期望 %.2f", p.Date.Weekday(), p.Value, want)
+		}
+	}
+}
+
+// TestSeasonalNaiveForecast 季节性朴素模型重复最后一个周期
+func TestSeasonalNaiveForecast(t *testing.T) {
+	values := []float64{1, 2, 3, 4, 5, 6, 7, 2, 3, 4, 5, 6, 7, 8}
+	sn := &SeasonalNaive{SeasonLength: 7}
+	if err := sn.Fit(values, seriesStart); err != nil {
+		t.Fatal(err)
+	}
+	forecast := sn.Forecast(9)
+	if forecast[0].Value != 2 || forecast[6].Value != 8 || forecast[7].Value != 2 {
+		t.Errorf("预测值错误: %+v", forecast)
+	}
+	if sn.Sigma != 1 || forecast[7].Upper-forecast[7].Value <= forecast[0].Upper-forecast[0].Value {
+		t.Errorf("第二个周期的区间应更宽: sigma=%.2f %+v", sn.Sigma, forecast)
+	}
+}
+
+// TestTrainForecastPromotion 有趋势时Holt-Winters优于季节性朴素基线而上线，无法表达周期的回归不予上线
+func TestTrainForecastPromotion(t *testing.T) {
+	config := ForecastConfig{SeasonLength: 7, BacktestHorizon: 14, BacktestFolds: 3}
+
+	values := weeklyTrendSeries(16*7, 2, 23)
+	forecaster, report, err := TrainForecast(ForecastHoltWinters, config, values, seriesStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Promoted || report.Candidate.RMSE >= report.Baseline.RMSE {
+		t.Errorf("Holt-Winters应优于基线: %+v %+v", report.Candidate, report.Baseline)
+	}
+	if report.Candidate.Folds != 3 || report.Candidate.Points != 42 || report.Candidate.MAPE <= 0 {
+		t.Errorf("回测结果错误: %+v", report.Candidate)
+	}
+
+	// 参数持久化后可恢复并得到相同预测
+	fitted, err := json.Marshal(forecaster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := LoadForecaster(ForecastHoltWinters, string(fitted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, b := forecaster.Forecast(3), restored.Forecast(3); a[2] != b[2] {
+		t.Errorf("恢复后的模型预测不一致: %+v vs %+v", a[2], b[2])
+	}
+
+	// 5天周期无法由星期特征表达，回归不如同周期的季节性朴素基线
+	fiveDay := ForecastConfig{SeasonLength: 5, BacktestHorizon: 10, BacktestFolds: 3}
+	cyclic := seriesValues(syntheticSeries(12*5, 24*time.Hour, 0.5, 24, func(i int) float64 {
+		return []float64{100, 140, 90, 160, 120}[i%5]
+	}))
+	_, report, err = TrainForecast(ForecastLinearRegression, fiveDay, cyclic, seriesStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Promoted || report.Candidate.RMSE < report.Baseline.RMSE {
+		t.Errorf("未优于基线的模型不应上线: %+v %+v", report.Candidate, report.Baseline)
+	}
+
+	_, report, err = TrainForecast(ForecastSeasonalNaive, config, values, seriesStart)
+	if err != nil || !report.Promoted {
+		t.Errorf("基线模型应直接上线: %+v, %v", report, err)
+	}
+}
+
+// TestDailySeriesFromRollups 多个维度组合按天合并，缺失日期补0
+func TestDailySeriesFromRollups(t *testing.T) {
+	rollups := []AnalyticsRollup{
+		{BucketStart: seriesStart, Count: 2, Sum: 10},
+		{BucketStart: seriesStart, Count: 3, Sum: 20},
+		{BucketStart: seriesStart.AddDate(0, 0, 2), Count: 1, Sum: 4},
+	}
+	for aggregate, want := range map[string][]float64{
+		"sum":   {30, 0, 4},
+		"count": {5, 0, 1},
+		"avg":   {6, 0, 4},
+	} {
+		values, start := dailySeriesFromRollups(rollups, aggregate)
+		if !start.Equal(seriesStart) || len(values) != 3 {
+			t.Fatalf("%s: 序列错误 %v %s", aggregate, values, start)
+		}
+		for i := range want {
+			if values[i] != want[i] {
+				t.Errorf("%s: 期望 %v，实际 %v", aggregate, want, values)
+				break
+			}
+		}
+	}
+}
+
+// TestNextModelVersion 上线新参数递增次版本号
+func TestNextModelVersion(t *testing.T) {
+	if v := nextModelVersion("1.0.0", false); v != "1.0.0" {
+		t.Errorf("首次训练应保持版本，实际 %s", v)
+	}
+	if v := nextModelVersion("1.3.2", true); v != "1.4.0" {
+		t.Errorf("期望1.4.0，实际 %s", v)
+	}
+}
@@ -0,0 +1,606 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInsufficientData 分析窗口内数据不足
+var ErrInsufficientData = errors.New("分析窗口内数据点不足")
+
+// 相关性计算方法
+const (
+	CorrelationPearson  = "pearson"
+	CorrelationSpearman = "spearman"
+)
+
+// TrendResult 最小二乘线性趋势
+type TrendResult struct {
+	Points     int        `json:"points"`
+	Slope      float64    `json:"slope"` // 每天变化量
+	Intercept  float64    `json:"intercept"`
+	SlopeCI    [2]float64 `json:"slope_ci_95"` // 斜率95%置信区间
+	StdErr     float64    `json:"std_err"`
+	RSquared   float64    `json:"r_squared"`
+	PValue     float64    `json:"p_value"`
+	Direction  string     `json:"direction"`   // increasing, decreasing, flat（置信区间包含0）
+	GrowthRate float64    `json:"growth_rate"` // 窗口内拟合值的相对变化
+	Volatility float64    `json:"volatility"`  // 残差标准差 / 均值
+	StartValue float64    `json:"start_value"` // 窗口起点拟合值
+	EndValue   float64    `json:"end_value"`   // 窗口终点拟合值
+}
+
+// CycleResult 基于自相关的周期检测结果
+type CycleResult struct {
+	Period       int       `json:"period"`       // 周期长度（天），0表示无显著周期
+	Strength     float64   `json:"strength"`     // 周期处的自相关系数
+	Significance float64   `json:"significance"` // 显著性阈值 1.96/√n
+	ACF          []float64 `json:"acf"`          // 各滞后阶的自相关系数（下标为滞后天数）
+}
+
+// CorrelationResult 相关矩阵
+type CorrelationResult struct {
+	Method    string                        `json:"method"`
+	Matrix    map[string]map[string]float64 `json:"matrix"`
+	Strongest [2]string                     `json:"strongest_pair"`
+	Strength  float64                       `json:"strength"`
+}
+
+// LinearTrend 对序列做最小二乘线性回归（x为距第一个点的天数）
+func LinearTrend(series []SeriesPoint) (*TrendResult, error) {
+	n := len(series)
+	if n < 3 {
+		return nil, ErrInsufficientData
+	}
+
+	origin := series[0].Timestamp
+	xs := make([]float64, n)
+	ys := make([]float64, n)
+	for i, p := range series {
+		xs[i] = p.Timestamp.Sub(origin).Hours() / 24
+		ys[i] = p.Value
+	}
+
+	mx, my := mean(xs), mean(ys)
+	var sxx, sxy, syy float64
+	for i := range xs {
+		dx, dy := xs[i]-mx, ys[i]-my
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+	if sxx == 0 {
+		return nil, ErrInsufficientData
+	}
+
+	slope := sxy / sxx
+	intercept := my - slope*mx
+
+	var sse float64
+	for i := range xs {
+		r := ys[i] - (intercept + slope*xs[i])
+		sse += r * r
+	}
+	df := float64(n - 2)
+	residualSD := math.Sqrt(sse / df)
+	stdErr := residualSD / math.Sqrt(sxx)
+
+	result := &TrendResult{
+		Points:     n,
+		Slope:      slope,
+		Intercept:  intercept,
+		StdErr:     stdErr,
+		StartValue: intercept + slope*xs[0],
+		EndValue:   intercept + slope*xs[n-1],
+	}
+	if syy > 0 {
+		result.RSquared = 1 - sse/syy
+	}
+
+	margin := tCritical95(n-2) * stdErr
+	result.SlopeCI = [2]float64{slope - margin, slope + margin}
+	if stdErr > 0 {
+		result.PValue = math.Erfc(math.Abs(slope/stdErr) / math.Sqrt2)
+	}
+
+	switch {
+	case result.SlopeCI[0] > 0:
+		result.Direction = "increasing"
+	case result.SlopeCI[1] < 0:
+		result.Direction = "decreasing"
+	default:
+		result.Direction = "flat"
+	}
+	if result.StartValue != 0 {
+		result.GrowthRate = (result.EndValue - result.StartValue) / math.Abs(result.StartValue)
+	}
+	if my != 0 {
+		result.Volatility = residualSD / math.Abs(my)
+	}
+	return result, nil
+}
+
+// tCritical95 双侧95%置信水平的t分布临界值
+func tCritical95(df int) float64 {
+	table := []float64{0, 12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+		2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+		2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042}
+	if df <= 0 {
+		return math.Inf(1)
+	}
+	if df < len(table) {
+		return table[df]
+	}
+	if df < 60 {
+		return 2.00
+	}
+	if df < 120 {
+		return 1.98
+	}
+	return 1.96
+}
+
+// Autocorrelation 计算滞后 0..maxLag 的样本自相关系数
+func Autocorrelation(values []float64, maxLag int) []float64 {
+	n := len(values)
+	if maxLag >= n {
+		maxLag = n - 1
+	}
+	m := mean(values)
+	var denom float64
+	for _, v := range values {
+		denom += (v - m) * (v - m)
+	}
+	acf := make([]float64, maxLag+1)
+	if denom == 0 {
+		return acf
+	}
+	for lag := 0; lag <= maxLag; lag++ {
+		var num float64
+		for i := lag; i < n; i++ {
+			num += (values[i] - m) * (values[i-lag] - m)
+		}
+		acf[lag] = num / denom
+	}
+	return acf
+}
+
+// DetectCycle 去除线性趋势后，取显著的自相关局部峰值中最强者作为周期
+func DetectCycle(values []float64) (*CycleResult, error) {
+	n := len(values)
+	if n < 8 {
+		return nil, ErrInsufficientData
+	}
+
+	// 去趋势，避免趋势造成的长滞后高自相关
+	series := make([]SeriesPoint, n)
+	for i, v := range values {
+		series[i] = SeriesPoint{Timestamp: time.Unix(int64(i)*86400, 0), Value: v}
+	}
+	detrended := append([]float64(nil), values...)
+	if trend, err := LinearTrend(series); err == nil {
+		for i := range detrended {
+			detrended[i] -= trend.Intercept + trend.Slope*float64(i)
+		}
+	}
+
+	acf := Autocorrelation(detrended, n/2)
+	result := &CycleResult{
+		Significance: 1.96 / math.Sqrt(float64(n)),
+		ACF:          acf,
+	}
+	for lag := 2; lag < len(acf)-1; lag++ {
+		if acf[lag] > acf[lag-1] && acf[lag] >= acf[lag+1] && acf[lag] > result.Significance && acf[lag] > result.Strength {
+			result.Period = lag
+			result.Strength = acf[lag]
+		}
+	}
+	return result, nil
+}
+
+// Correlation 计算两个等长序列的相关系数
+func Correlation(x, y []float64, method string) float64 {
+	if len(x) != len(y) || len(x) < 3 {
+		return 0
+	}
+	if method == CorrelationSpearman {
+		return pearson(ranks(x), ranks(y))
+	}
+	return pearson(x, y)
+}
+
+// CorrelationMatrix 计算多个序列两两之间的相关矩阵
+func CorrelationMatrix(series map[string][]float64, method string) (*CorrelationResult, error) {
+	names := make([]string, 0, len(series))
+	for name := range series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) < 2 {
+		return nil, fmt.Errorf("%w: 相关性分析至少需要2个指标，实际 %d 个", ErrInsufficientData, len(names))
+	}
+
+	result := &CorrelationResult{Method: method, Matrix: make(map[string]map[string]float64)}
+	for _, a := range names {
+		result.Matrix[a] = make(map[string]float64)
+	}
+	for i, a := range names {
+		result.Matrix[a][a] = 1
+		for _, b := range names[i+1:] {
+			r := Correlation(series[a], series[b], method)
+			result.Matrix[a][b] = r
+			result.Matrix[b][a] = r
+			if math.Abs(r) > math.Abs(result.Strength) {
+				result.Strength = r
+				result.Strongest = [2]string{a, b}
+			}
+		}
+	}
+	return result, nil
+}
+
+func pearson(x, y []float64) float64 {
+	mx, my := mean(x), mean(y)
+	var sxy, sxx, syy float64
+	for i := range x {
+		dx, dy := x[i]-mx, y[i]-my
+		sxy += dx * dy
+		sxx += dx * dx
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return 0
+	}
+	return sxy / math.Sqrt(sxx*syy)
+}
+
+// ranks 计算秩（并列取平均秩）
+func ranks(values []float64) []float64 {
+	idx := make([]int, len(values))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return values[idx[a]] < values[idx[b]] })
+
+	result := make([]float64, len(values))
+	for i := 0; i < len(idx); {
+		j := i
+		for j+1 < len(idx) && values[idx[j+1]] == values[idx[i]] {
+			j++
+		}
+		avg := float64(i+j)/2 + 1
+		for k := i; k <= j; k++ {
+			result[idx[k]] = avg
+		}
+		i = j + 1
+	}
+	return result
+}
+
+// DailySeries 将序列按天对齐到 [start, end] 窗口，每天取均值；无数据的日期标记为Missing，不能补0，否则数据缺口会被当成下跌
+func DailySeries(series []SeriesPoint, start, end time.Time) []SeriesPoint {
+	startDay := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	if end.Before(startDay) {
+		return nil
+	}
+	var inWindow []SeriesPoint
+	for _, p := range series {
+		if p.Timestamp.Before(startDay) || p.Timestamp.After(end) {
+			continue
+		}
+		inWindow = append(inWindow, SeriesPoint{Timestamp: p.Timestamp.In(startDay.Location()), Value: p.Value})
+	}
+	daily := AggregateDaily(inWindow)
+
+	// AggregateDaily只覆盖首尾观测日之间，窗口两端无数据的日期同样补Missing占位
+	var result []SeriesPoint
+	day := startDay
+	for ; len(daily) > 0 && day.Before(daily[0].Timestamp); day = day.AddDate(0, 0, 1) {
+		result = append(result, SeriesPoint{Timestamp: day, Missing: true})
+	}
+	result = append(result, daily...)
+	if len(daily) > 0 {
+		day = daily[len(daily)-1].Timestamp.AddDate(0, 0, 1)
+	}
+	for ; !day.After(end); day = day.AddDate(0, 0, 1) {
+		result = append(result, SeriesPoint{Timestamp: day, Missing: true})
+	}
+	return result
+}
+
+// observedPoints 去掉Missing占位点，只保留有数据的日期
+func observedPoints(series []SeriesPoint) []SeriesPoint {
+	result := make([]SeriesPoint, 0, len(series))
+	for _, p := range series {
+		if !p.Missing {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// describeCorrelation 相关强度描述
+func describeCorrelation(r float64) string {
+	strength := "弱"
+	switch a := math.Abs(r); {
+	case a >= 0.7:
+		strength = "强"
+	case a >= 0.4:
+		strength = "中等"
+	}
+	if r < 0 {
+		return strength + "负相关"
+	}
+	return strength + "正相关"
+}
+
+// MetricSeries 按天对齐后的指标序列，无数据的日期标记为Missing
+type MetricSeries struct {
+	Name   string
+	Points []SeriesPoint
+}
+
+// detectDailyCycle 检测按天对齐序列的周期；缺失日期用相邻观测插值保持滞后对齐，观测天数不足时返回ErrInsufficientData
+func detectDailyCycle(points []SeriesPoint) (*CycleResult, error) {
+	values, observed := interpolateMissing(points)
+	if len(observed) < 8 {
+		return nil, ErrInsufficientData
+	}
+	return DetectCycle(values)
+}
+
+// describeSeasonality 根据周期强度描述季节性
+func describeSeasonality(cycle *CycleResult) string {
+	switch {
+	case cycle == nil || cycle.Period == 0:
+		return "none"
+	case cycle.Strength >= 0.6:
+		return "strong"
+	case cycle.Strength >= 0.3:
+		return "moderate"
+	default:
+		return "weak"
+	}
+}
+
+// BuildTrendAnalysis 对每个指标做线性趋势分析，第一个指标为主指标；缺失日期不参与拟合
+func BuildTrendAnalysis(metrics []MetricSeries) (*AnalysisResult, error) {
+	if len(metrics) == 0 {
+		return nil, ErrInsufficientData
+	}
+
+	trends := make(map[string]*TrendResult, len(metrics))
+	for _, m := range metrics {
+		trend, err := LinearTrend(observedPoints(m.Points))
+		if err != nil {
+			return nil, fmt.Errorf("指标 %s: %w", m.Name, err)
+		}
+		trends[m.Name] = trend
+	}
+
+	primary := metrics[0]
+	trend := trends[primary.Name]
+	cycle, _ := detectDailyCycle(primary.Points)
+	seasonality := describeSeasonality(cycle)
+
+	result := &AnalysisResult{
+		Result: map[string]interface{}{
+			"metric":          primary.Name,
+			"trend_direction": trend.Direction,
+			"growth_rate":     trend.GrowthRate,
+			"volatility":      trend.Volatility,
+			"slope":           trend.Slope,
+			"slope_ci_95":     trend.SlopeCI,
+			"r_squared":       trend.RSquared,
+			"p_value":         trend.PValue,
+			"seasonality":     seasonality,
+			"metrics":         trends,
+		},
+		Confidence: 1 - trend.PValue,
+	}
+
+	directions := map[string]string{"increasing": "上升", "decreasing": "下降"}
+	if dir, ok := directions[trend.Direction]; ok {
+		result.Insights = append(result.Insights,
+			fmt.Sprintf("%s 在%d天内呈%s趋势，日均变化 %.2f（95%%置信区间 %.2f ~ %.2f）",
+				primary.Name, len(primary.Points), dir, trend.Slope, trend.SlopeCI[0], trend.SlopeCI[1]),
+			fmt.Sprintf("按趋势线计算，窗口内变化幅度为 %.1f%%", trend.GrowthRate*100))
+	} else {
+		result.Insights = append(result.Insights,
+			fmt.Sprintf("%s 在%d天内无显著趋势，斜率置信区间 %.2f ~ %.2f 包含0",
+				primary.Name, len(primary.Points), trend.SlopeCI[0], trend.SlopeCI[1]))
+	}
+	result.Insights = append(result.Insights,
+		fmt.Sprintf("线性趋势解释了 %.0f%% 的变化（R²=%.2f），残差波动率为 %.1f%%",
+			trend.RSquared*100, trend.RSquared, trend.Volatility*100))
+	if missing := len(primary.Points) - trend.Points; missing > 0 {
+		result.Insights = append(result.Insights,
+			fmt.Sprintf("窗口内有%d天无数据，未参与趋势拟合", missing))
+	}
+	if seasonality != "none" {
+		result.Insights = append(result.Insights,
+			fmt.Sprintf("去趋势后存在%d天周期，自相关系数 %.2f", cycle.Period, cycle.Strength))
+	}
+	for _, m := range metrics[1:] {
+		other := trends[m.Name]
+		if dir, ok := directions[other.Direction]; ok {
+			result.Insights = append(result.Insights,
+				fmt.Sprintf("%s 同期呈%s趋势，变化幅度 %.1f%%", m.Name, dir, other.GrowthRate*100))
+		}
+	}
+	return result, nil
+}
+
+// BuildPatternAnalysis 基于自相关检测主指标的周期，并按周期（或全局）检出异常日期；缺失日期不会被判定为异常
+func BuildPatternAnalysis(metric MetricSeries, config AnomalyDetectorConfig) (*AnalysisResult, error) {
+	cycle, err := detectDailyCycle(metric.Points)
+	if err != nil {
+		return nil, err
+	}
+	config = config.normalize()
+
+	points := metric.Points
+	var findings []AnomalyFinding
+	patternType := "irregular"
+	if cycle.Period > 0 && len(points) >= 2*cycle.Period {
+		patternType = "cyclical"
+		findings = DetectSeasonal(points, cycle.Period, config.SeasonalThreshold)
+	} else {
+		findings = DetectMAD(observedPoints(points), config.Window, config.MADThreshold)
+	}
+
+	anomalies := make([]string, 0, len(findings))
+	for _, f := range findings {
+		anomalies = append(anomalies, f.Timestamp.Format("2006-01-02"))
+	}
+
+	acf := cycle.ACF
+	if len(acf) > 31 {
+		acf = acf[:31]
+	}
+
+	result := &AnalysisResult{
+		Result: map[string]interface{}{
+			"metric":           metric.Name,
+			"pattern_type":     patternType,
+			"cycle_length":     cycle.Period,
+			"pattern_strength": cycle.Strength,
+			"significance":     cycle.Significance,
+			"acf":              acf,
+			"anomalies":        anomalies,
+		},
+	}
+
+	if patternType == "cyclical" {
+		result.Confidence = cycle.Strength
+		result.Insights = append(result.Insights,
+			fmt.Sprintf("%s 呈%d天周期性模式，自相关系数 %.2f（显著性阈值 %.2f）",
+				metric.Name, cycle.Period, cycle.Strength, cycle.Significance))
+	} else {
+		var peak float64
+		for _, v := range cycle.ACF[min(2, len(cycle.ACF)):] {
+			peak = math.Max(peak, math.Abs(v))
+		}
+		result.Confidence = 1 - peak
+		result.Insights = append(result.Insights,
+			fmt.Sprintf("%s 未发现显著周期，最大自相关系数 %.2f 低于或接近显著性阈值 %.2f",
+				metric.Name, peak, cycle.Significance))
+	}
+	if len(anomalies) > 0 {
+		result.Insights = append(result.Insights,
+			fmt.Sprintf("发现%d个偏离模式的异常日期：%s", len(anomalies), joinLimited(anomalies, 5)))
+	} else {
+		result.Insights = append(result.Insights, "未发现偏离模式的异常日期")
+	}
+	return result, nil
+}
+
+// BuildCorrelationAnalysis 计算所选指标的Pearson与Spearman相关矩阵，只使用所有指标都有数据的日期
+func BuildCorrelationAnalysis(metrics []MetricSeries) (*AnalysisResult, error) {
+	series := make(map[string][]float64, len(metrics))
+	for _, m := range metrics {
+		series[m.Name] = nil
+	}
+	days := 0
+	for _, m := range metrics {
+		days = max(days, len(m.Points))
+	}
+	for i := 0; i < days; i++ {
+		complete := true
+		for _, m := range metrics {
+			if i >= len(m.Points) || m.Points[i].Missing {
+				complete = false
+				break
+			}
+		}
+		if !complete {
+			continue
+		}
+		for _, m := range metrics {
+			series[m.Name] = append(series[m.Name], m.Points[i].Value)
+		}
+	}
+	n := 0
+	for _, values := range series {
+		n = len(values)
+	}
+	if n < 3 {
+		return nil, ErrInsufficientData
+	}
+
+	pearsonResult, err := CorrelationMatrix(series, CorrelationPearson)
+	if err != nil {
+		return nil, err
+	}
+	spearmanResult, err := CorrelationMatrix(series, CorrelationSpearman)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &AnalysisResult{
+		Result: map[string]interface{}{
+			"correlation_matrix":    pearsonResult.Matrix,
+			"spearman_matrix":       spearmanResult.Matrix,
+			"strongest_pair":        pearsonResult.Strongest,
+			"strongest_correlation": pearsonResult.Strongest[0] + " ~ " + pearsonResult.Strongest[1],
+			"correlation_strength":  pearsonResult.Strength,
+			"sample_size":           n,
+		},
+		Confidence: 1 - correlationPValue(pearsonResult.Strength, n),
+	}
+
+	// 按相关强度排序输出各指标对
+	type pair struct {
+		a, b     string
+		pearson  float64
+		spearman float64
+	}
+	var pairs []pair
+	for i, a := range metrics {
+		for _, b := range metrics[i+1:] {
+			pairs = append(pairs, pair{a.Name, b.Name, pearsonResult.Matrix[a.Name][b.Name], spearmanResult.Matrix[a.Name][b.Name]})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return math.Abs(pairs[i].pearson) > math.Abs(pairs[j].pearson) })
+	for i, p := range pairs {
+		if i >= 3 {
+			break
+		}
+		result.Insights = append(result.Insights,
+			fmt.Sprintf("%s 与 %s 呈%s（Pearson r=%.2f，Spearman ρ=%.2f）",
+				p.a, p.b, describeCorrelation(p.pearson), p.pearson, p.spearman))
+		if math.Abs(p.pearson-p.spearman) >= 0.2 {
+			result.Insights = append(result.Insights,
+				fmt.Sprintf("%s 与 %s 的Pearson与Spearman系数差异较大，关系可能为非线性或受离群点影响", p.a, p.b))
+		}
+	}
+	result.Insights = append(result.Insights, fmt.Sprintf("基于%d天的日度数据计算", n))
+	if n < days {
+		result.Insights = append(result.Insights, fmt.Sprintf("有%d天部分指标无数据，未参与相关性计算", days-n))
+	}
+	return result, nil
+}
+
+// correlationPValue 相关系数的双侧p值（t统计量按正态近似）
+func correlationPValue(r float64, n int) float64 {
+	if n < 3 {
+		return 1
+	}
+	if math.Abs(r) >= 1 {
+		return 0
+	}
+	t := r * math.Sqrt(float64(n-2)/(1-r*r))
+	return math.Erfc(math.Abs(t) / math.Sqrt2)
+}
+
+// joinLimited 拼接前limit个元素，超出部分以"等"省略
+func joinLimited(items []string, limit int) string {
+	if len(items) <= limit {
+		return strings.Join(items, "、")
+	}
+	return strings.Join(items[:limit], "、") + fmt.Sprintf(" 等%d个", len(items))
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLinearTrendConfidenceInterval 斜率估计与置信区间应覆盖真实斜率，平稳序列判定为flat
+func TestLinearTrendConfidenceInterval(t *testing.T) {
+	series := syntheticSeries(60, 24*time.Hour, 3, 11, func(i int) float64 { return 50 + 2*float64(i) })
+	trend, err := LinearTrend(series)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(trend.Slope-2) > 0.1 || trend.SlopeCI[0] > 2 || trend.SlopeCI[1] < 2 {
+		t.Errorf("斜率或置信区间错误: %+v", trend)
+	}
+	if trend.Direction != "increasing" || trend.RSquared < 0.95 || trend.PValue > 0.001 {
+		t.Errorf("应为显著上升趋势: %+v", trend)
+	}
+	if math.Abs(trend.GrowthRate-118.0/50) > 0.1 {
+		t.Errorf("增长率期望约 %.2f，实际 %.2f", 118.0/50, trend.GrowthRate)
+	}
+
+	flat, err := LinearTrend(syntheticSeries(60, 24*time.Hour, 3, 12, func(int) float64 { return 50 }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flat.Direction != "flat" || flat.SlopeCI[0] > 0 || flat.SlopeCI[1] < 0 {
+		t.Errorf("平稳序列应判定为flat: %+v", flat)
+	}
+
+	if _, err := LinearTrend(series[:2]); !errors.Is(err, ErrInsufficientData) {
+		t.Error("数据点不足应返回ErrInsufficientData")
+	}
+}
+
+// TestDetectCycle 带趋势的周循环序列应检出7天周期，白噪声无显著周期
+func TestDetectCycle(t *testing.T) {
+	weekly := syntheticSeries(12*7, 24*time.Hour, 2, 13, func(i int) float64 {
+		return 100 + 0.5*float64(i) + 30*math.Sin(2*math.Pi*float64(i)/7)
+	})
+	cycle, err := DetectCycle(seriesValues(weekly))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cycle.Period != 7 || cycle.Strength < 0.6 {
+		t.Errorf("期望7天强周期，实际 %+v", cycle)
+	}
+
+	noise, err := DetectCycle(seriesValues(syntheticSeries(84, 24*time.Hour, 5, 14, func(int) float64 { return 100 })))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if noise.Period != 0 && noise.Strength > 0.4 {
+		t.Errorf("白噪声不应有强周期，实际 %+v", noise)
+	}
+}
+
+// TestCorrelationPearsonSpearman 单调非线性关系的Spearman为1而Pearson小于1，并列值取平均秩
+func TestCorrelationPearsonSpearman(t *testing.T) {
+	x := make([]float64, 30)
+	y := make([]float64, 30)
+	for i := range x {
+		x[i] = float64(i + 1)
+		y[i] = math.Exp(x[i] / 4)
+	}
+	if r := Correlation(x, y, CorrelationSpearman); math.Abs(r-1) > 1e-9 {
+		t.Errorf("Spearman期望1，实际 %.4f", r)
+	}
+	if r := Correlation(x, y, CorrelationPearson); r > 0.9 || r < 0.5 {
+		t.Errorf("Pearson期望明显小于1，实际 %.4f", r)
+	}
+
+	got := ranks([]float64{10, 20, 20, 5})
+	want := []float64{2, 3.5, 3.5, 1}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("秩计算错误: %v", got)
+		}
+	}
+}
+
+// TestBuildCorrelationAnalysis 相关矩阵对称，最强相关对和洞察文本来自计算结果
+func TestBuildCorrelationAnalysis(t *testing.T) {
+	base := seriesValues(syntheticSeries(40, 24*time.Hour, 10, 15, func(i int) float64 { return 100 + float64(i) }))
+	follow := make([]float64, len(base))
+	inverse := make([]float64, len(base))
+	noise := seriesValues(syntheticSeries(40, 24*time.Hour, 10, 16, func(int) float64 { return 50 }))
+	for i, v := range base {
+		follow[i] = 2*v + 5
+		inverse[i] = -v + float64(i%3)
+	}
+
+	result, err := BuildCorrelationAnalysis([]MetricSeries{
+		dailyMetric("views", base),
+		dailyMetric("applies", follow),
+		dailyMetric("bounces", inverse),
+		dailyMetric("noise", noise),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	matrix := result.Result["correlation_matrix"].(map[string]map[string]float64)
+	if math.Abs(matrix["views"]["applies"]-1) > 1e-9 || matrix["views"]["applies"] != matrix["applies"]["views"] {
+		t.Errorf("views与applies应完全正相关且矩阵对称: %v", matrix["views"])
+	}
+	if matrix["views"]["bounces"] > -0.9 {
+		t.Errorf("views与bounces应强负相关，实际 %.2f", matrix["views"]["bounces"])
+	}
+	if pair := result.Result["strongest_pair"].([2]string); pair != [2]string{"applies", "views"} {
+		t.Errorf("最强相关对错误: %v", pair)
+	}
+	if result.Confidence < 0.99 {
+		t.Errorf("完全相关的置信度应接近1，实际 %.3f", result.Confidence)
+	}
+	if !strings.Contains(result.Insights[0], "views 与 applies 呈强正相关") {
+		t.Errorf("洞察应来自计算结果: %v", result.Insights)
+	}
+
+	if _, err := BuildCorrelationAnalysis([]MetricSeries{dailyMetric("views", base)}); !errors.Is(err, ErrInsufficientData) {
+		t.Error("单个指标应返回ErrInsufficientData")
+	}
+}
+
+// TestBuildTrendAndPatternAnalysis 趋势与模式分析的结果字段和洞察文本反映实际数据
+func TestBuildTrendAndPatternAnalysis(t *testing.T) {
+	weekly := func(i int) float64 {
+		if i%7 >= 5 {
+			return 40
+		}
+		return 100
+	}
+	values := seriesValues(syntheticSeries(10*7, 24*time.Hour, 2, 17, func(i int) float64 { return weekly(i) - 0.5*float64(i) }))
+	values[45] = 100 // 周末出现工作日水平
+
+	trend, err := BuildTrendAnalysis([]MetricSeries{dailyMetric("job_views", values)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trend.Result["trend_direction"] != "decreasing" || trend.Result["seasonality"] == "none" {
+		t.Errorf("应为带季节性的下降趋势: %v", trend.Result)
+	}
+	if !strings.Contains(trend.Insights[0], "job_views 在70天内呈下降趋势") {
+		t.Errorf("趋势洞察错误: %v", trend.Insights)
+	}
+
+	pattern, err := BuildPatternAnalysis(dailyMetric("job_views", values), DefaultAnomalyDetectorConfig("job_views"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pattern.Result["pattern_type"] != "cyclical" || pattern.Result["cycle_length"] != 7 {
+		t.Errorf("应检出7天周期: %v", pattern.Result)
+	}
+	anomalies := pattern.Result["anomalies"].([]string)
+	want := seriesStart.AddDate(0, 0, 45).Format("2006-01-02")
+	if len(anomalies) != 1 || anomalies[0] != want {
+		t.Errorf("期望异常日期 %s，实际 %v", want, anomalies)
+	}
+	if !strings.Contains(strings.Join(pattern.Insights, "\n"), want) {
+		t.Errorf("洞察应包含异常日期: %v", pattern.Insights)
+	}
+}
+
+// TestHistoricalAnalysisSkipsMissingDays 无数据的日期不参与趋势和相关性拟合，也不会被判定为异常
+func TestHistoricalAnalysisSkipsMissingDays(t *testing.T) {
+	withGap := func(points []SeriesPoint, from, to int) []SeriesPoint {
+		for i := from; i <= to; i++ {
+			points[i] = SeriesPoint{Timestamp: points[i].Timestamp, Missing: true}
+		}
+		return points
+	}
+
+	growing := withGap(syntheticSeries(60, 24*time.Hour, 3, 18, func(i int) float64 { return 50 + 2*float64(i) }), 20, 29)
+	trend, err := BuildTrendAnalysis([]MetricSeries{{Name: "job_views", Points: growing}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fit := trend.Result["metrics"].(map[string]*TrendResult)["job_views"]
+	if fit.Points != 50 || math.Abs(fit.Slope-2) > 0.1 || fit.RSquared < 0.95 {
+		t.Errorf("缺失日期不应参与趋势拟合: %+v", fit)
+	}
+	if !strings.Contains(strings.Join(trend.Insights, "\n"), "有10天无数据") {
+		t.Errorf("洞察应说明缺失天数: %v", trend.Insights)
+	}
+
+	weekly := withGap(syntheticSeries(10*7, 24*time.Hour, 2, 17, func(i int) float64 {
+		if i%7 >= 5 {
+			return 40
+		}
+		return 100
+	}), 30, 33)
+	pattern, err := BuildPatternAnalysis(MetricSeries{Name: "job_views", Points: weekly}, DefaultAnomalyDetectorConfig("job_views"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pattern.Result["cycle_length"] != 7 {
+		t.Errorf("有缺口时仍应检出7天周期: %v", pattern.Result)
+	}
+	for _, day := range pattern.Result["anomalies"].([]string) {
+		for i := 30; i <= 33; i++ {
+			if day == seriesStart.AddDate(0, 0, i).Format("2006-01-02") {
+				t.Errorf("缺失日期 %s 不应判定为异常", day)
+			}
+		}
+	}
+
+	views := syntheticSeries(40, 24*time.Hour, 10, 19, func(i int) float64 { return 100 + float64(i) })
+	applies := make([]SeriesPoint, len(views))
+	for i, p := range views {
+		applies[i] = SeriesPoint{Timestamp: p.Timestamp, Value: 2*p.Value + 5}
+	}
+	correlation, err := BuildCorrelationAnalysis([]MetricSeries{
+		{Name: "views", Points: withGap(views, 5, 9)},
+		{Name: "applies", Points: withGap(applies, 30, 32)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	matrix := correlation.Result["correlation_matrix"].(map[string]map[string]float64)
+	if math.Abs(matrix["views"]["applies"]-1) > 1e-9 || correlation.Result["sample_size"] != 32 {
+		t.Errorf("只应使用两个指标都有数据的32天: r=%.4f, n=%v", matrix["views"]["applies"], correlation.Result["sample_size"])
+	}
+}
+
+// TestDailySeriesAlignsWindow 按窗口对齐，窗口外的数据被忽略，无数据的日期标记为Missing
+func TestDailySeriesAlignsWindow(t *testing.T) {
+	series := []SeriesPoint{
+		{Timestamp: seriesStart.Add(-time.Hour), Value: 99},
+		{Timestamp: seriesStart.Add(26 * time.Hour), Value: 4},
+		{Timestamp: seriesStart.Add(27 * time.Hour), Value: 6},
+		{Timestamp: seriesStart.Add(73 * time.Hour), Value: 8},
+	}
+	got := DailySeries(series, seriesStart, seriesStart.Add(96*time.Hour))
+	want := []SeriesPoint{
+		{Timestamp: seriesStart, Missing: true},
+		{Timestamp: seriesStart.AddDate(0, 0, 1), Value: 5},
+		{Timestamp: seriesStart.AddDate(0, 0, 2), Missing: true},
+		{Timestamp: seriesStart.AddDate(0, 0, 3), Value: 8},
+		{Timestamp: seriesStart.AddDate(0, 0, 4), Missing: true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("期望%d天，实际 %v", len(want), got)
+	}
+	for i := range want {
+		if !got[i].Timestamp.Equal(want[i].Timestamp) || got[i].Value != want[i].Value || got[i].Missing != want[i].Missing {
+			t.Fatalf("对齐结果错误: %v", got)
+		}
+	}
+}
+
+// dailyMetric 从seriesStart开始按天生成指标序列
+func dailyMetric(name string, values []float64) MetricSeries {
+	points := make([]SeriesPoint, len(values))
+	for i, v := range values {
+		points[i] = SeriesPoint{Timestamp: seriesStart.AddDate(0, 0, i), Value: v}
+	}
+	return MetricSeries{Name: name, Points: points}
+}
@@ -49,6 +49,8 @@ func main() {
 	}
 	if enhancedService != nil {
 		defer enhancedService.Close()
+		enhancedService.StartRollupScheduler(time.Minute)
+		enhancedService.StartReportScheduler(time.Minute)
 		log.Println("统计增强服务初始化成功")
 	}
 
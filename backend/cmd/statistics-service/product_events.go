@@ -0,0 +1,804 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 事件接入限制
+const (
+	maxTrackBatchSize      = 100
+	maxEventPropertiesSize = 8 << 10
+	maxAnonymousIDLength   = 64
+	// 客户端时间超出此范围时以服务端接收时间为准
+	maxEventClockSkewFuture = 5 * time.Minute
+	maxEventClockSkewPast   = 72 * time.Hour
+	// DefaultSessionIdleTimeout 同一访客两次事件间隔超过该值即开始新会话
+	DefaultSessionIdleTimeout = 30 * time.Minute
+	// eventSchemaCacheTTL 事件定义的内存缓存时间
+	eventSchemaCacheTTL = time.Minute
+)
+
+var eventNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,99}$`)
+
+// EventPropertySpec 事件属性定义
+type EventPropertySpec struct {
+	Type      string   `json:"type"` // string, number, integer, boolean, object, array
+	Required  bool     `json:"required,omitempty"`
+	Enum      []string `json:"enum,omitempty"`
+	MaxLength int      `json:"max_length,omitempty"`
+	Min       *float64 `json:"min,omitempty"`
+	Max       *float64 `json:"max,omitempty"`
+}
+
+// ProductEventSchema 产品事件定义，未定义或已停用的事件会被拒绝
+type ProductEventSchema struct {
+	Name            string    `json:"name" gorm:"primaryKey;size:100"`
+	Description     string    `json:"description" gorm:"type:text"`
+	Properties      string    `json:"properties" gorm:"type:json"` // map[string]EventPropertySpec
+	AllowAdditional bool      `json:"allow_additional"`            // 是否允许未声明的属性
+	Enabled         bool      `json:"enabled"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ProductEvent 经过校验和补全的产品事件
+type ProductEvent struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	EventID     string    `json:"event_id" gorm:"size:64;not null;uniqueIndex"`
+	Name        string    `json:"name" gorm:"size:100;not null;index"`
+	Identity    string    `json:"identity" gorm:"size:80;not null;index"` // u:<用户ID> 或 a:<匿名ID>
+	UserID      uint      `json:"user_id" gorm:"index"`
+	AnonymousID string    `json:"anonymous_id" gorm:"size:64"`
+	SessionID   string    `json:"session_id" gorm:"size:40;index"`
+	TenantID    string    `json:"tenant_id" gorm:"size:64;index"`
+	Properties  string    `json:"properties" gorm:"type:json"`
+	Context     string    `json:"context" gorm:"type:json"` // 页面、来源、语言、应用版本
+	Browser     string    `json:"browser" gorm:"size:30"`
+	OS          string    `json:"os" gorm:"size:30"`
+	DeviceType  string    `json:"device_type" gorm:"size:20"`
+	Country     string    `json:"country" gorm:"size:10"`
+	Region      string    `json:"region" gorm:"size:50"`
+	City        string    `json:"city" gorm:"size:50"`
+	IPPrefix    string    `json:"ip_prefix" gorm:"size:50"` // 截断后的IP，不保存完整地址
+	OccurredAt  time.Time `json:"occurred_at" gorm:"index"`
+	ReceivedAt  time.Time `json:"received_at"`
+}
+
+// ProductSession 会话汇总
+type ProductSession struct {
+	ID         string    `json:"id" gorm:"primaryKey;size:40"`
+	Identity   string    `json:"identity" gorm:"size:80;index"`
+	TenantID   string    `json:"tenant_id" gorm:"size:64;index"`
+	StartedAt  time.Time `json:"started_at" gorm:"index"`
+	EndedAt    time.Time `json:"ended_at"`
+	EventCount int64     `json:"event_count"`
+}
+
+// defaultEventSchemas 内置事件定义，首次建表时写入，之后可通过接口修改
+func defaultEventSchemas() []ProductEventSchema {
+	zero := 0.0
+	schema := func(name, description string, props map[string]EventPropertySpec) ProductEventSchema {
+		raw, _ := json.Marshal(props)
+		return ProductEventSchema{Name: name, Description: description, Properties: string(raw), Enabled: true}
+	}
+	return []ProductEventSchema{
+		schema("page_view", "页面浏览", map[string]EventPropertySpec{
+			"path":     {Type: "string", Required: true, MaxLength: 500},
+			"title":    {Type: "string", MaxLength: 200},
+			"referrer": {Type: "string", MaxLength: 500},
+		}),
+		schema("feature_used", "功能使用", map[string]EventPropertySpec{
+			"feature": {Type: "string", Required: true, MaxLength: 100},
+			"action":  {Type: "string", MaxLength: 50},
+		}),
+		schema("search", "搜索", map[string]EventPropertySpec{
+			"query":   {Type: "string", Required: true, MaxLength: 200},
+			"scope":   {Type: "string", Enum: []string{"jobs", "companies", "templates", "resumes"}},
+			"results": {Type: "integer", Min: &zero},
+		}),
+		schema("signup", "注册", map[string]EventPropertySpec{
+			"method": {Type: "string", Required: true, Enum: []string{"email", "phone", "wechat", "oauth"}},
+		}),
+		schema("resume_created", "创建简历", map[string]EventPropertySpec{
+			"template_id": {Type: "integer", Min: &zero},
+		}),
+		schema("job_applied", "投递职位", map[string]EventPropertySpec{
+			"job_id": {Type: "integer", Required: true, Min: &zero},
+			"source": {Type: "string", MaxLength: 50},
+		}),
+	}
+}
+
+// PropertySpecs 解析属性定义
+func (s *ProductEventSchema) PropertySpecs() (map[string]EventPropertySpec, error) {
+	specs := map[string]EventPropertySpec{}
+	if s.Properties == "" {
+		return specs, nil
+	}
+	if err := json.Unmarshal([]byte(s.Properties), &specs); err != nil {
+		return nil, fmt.Errorf("事件属性定义格式错误: %w", err)
+	}
+	for name, spec := range specs {
+		switch spec.Type {
+		case "string", "number", "integer", "boolean", "object", "array":
+		default:
+			return nil, fmt.Errorf("属性 %s 的类型 %q 不受支持", name, spec.Type)
+		}
+	}
+	return specs, nil
+}
+
+// ValidateEventProperties 按事件定义校验属性，返回全部错误
+func ValidateEventProperties(specs map[string]EventPropertySpec, allowAdditional bool, props map[string]interface{}) []string {
+	var problems []string
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		spec := specs[name]
+		value, ok := props[name]
+		if !ok || value == nil {
+			if spec.Required {
+				problems = append(problems, fmt.Sprintf("缺少必填属性 %s", name))
+			}
+			continue
+		}
+		if msg := checkPropertyValue(spec, value); msg != "" {
+			problems = append(problems, fmt.Sprintf("属性 %s %s", name, msg))
+		}
+	}
+	if !allowAdditional {
+		var extra []string
+		for name := range props {
+			if _, ok := specs[name]; !ok {
+				extra = append(extra, name)
+			}
+		}
+		sort.Strings(extra)
+		for _, name := range extra {
+			problems = append(problems, fmt.Sprintf("未声明的属性 %s", name))
+		}
+	}
+	return problems
+}
+
+// checkPropertyValue 校验单个属性值，JSON数字统一解码为float64
+func checkPropertyValue(spec EventPropertySpec, value interface{}) string {
+	switch spec.Type {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return "应为字符串"
+		}
+		if spec.MaxLength > 0 && len([]rune(s)) > spec.MaxLength {
+			return fmt.Sprintf("长度不能超过%d", spec.MaxLength)
+		}
+		if len(spec.Enum) > 0 {
+			for _, allowed := range spec.Enum {
+				if s == allowed {
+					return ""
+				}
+			}
+			return fmt.Sprintf("取值必须是 %s 之一", strings.Join(spec.Enum, ", "))
+		}
+	case "number", "integer":
+		n, ok := value.(float64)
+		if !ok {
+			return "应为数字"
+		}
+		if spec.Type == "integer" && n != float64(int64(n)) {
+			return "应为整数"
+		}
+		if spec.Min != nil && n < *spec.Min {
+			return fmt.Sprintf("不能小于%v", *spec.Min)
+		}
+		if spec.Max != nil && n > *spec.Max {
+			return fmt.Sprintf("不能大于%v", *spec.Max)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return "应为布尔值"
+		}
+	case "object":
+		if _, ok := value.(map[string]interface{}); !ok {
+			return "应为对象"
+		}
+	case "array":
+		if _, ok := value.([]interface{}); !ok {
+			return "应为数组"
+		}
+	}
+	return ""
+}
+
+// UserAgentInfo 从User-Agent解析出的客户端信息
+type UserAgentInfo struct {
+	Browser    string `json:"browser"`
+	OS         string `json:"os"`
+	DeviceType string `json:"device_type"` // desktop, mobile, tablet, bot
+}
+
+// ParseUserAgent 按常见特征识别浏览器、操作系统和设备类型，规则顺序即优先级
+func ParseUserAgent(ua string) UserAgentInfo {
+	info := UserAgentInfo{Browser: "other", OS: "other", DeviceType: "desktop"}
+	lower := strings.ToLower(ua)
+	if lower == "" {
+		info.DeviceType = "unknown"
+		return info
+	}
+
+	for _, rule := range []struct{ token, name string }{
+		{"micromessenger", "wechat"},
+		{"edg/", "edge"},
+		{"opr/", "opera"},
+		{"firefox/", "firefox"},
+		{"chrome/", "chrome"},
+		{"crios/", "chrome"},
+		{"safari/", "safari"},
+	} {
+		if strings.Contains(lower, rule.token) {
+			info.Browser = rule.name
+			break
+		}
+	}
+	for _, rule := range []struct{ token, name string }{
+		{"harmonyos", "harmonyos"},
+		{"android", "android"},
+		{"iphone", "ios"},
+		{"ipad", "ios"},
+		{"windows", "windows"},
+		{"mac os x", "macos"},
+		{"linux", "linux"},
+	} {
+		if strings.Contains(lower, rule.token) {
+			info.OS = rule.name
+			break
+		}
+	}
+
+	switch {
+	case strings.Contains(lower, "bot") || strings.Contains(lower, "spider") || strings.Contains(lower, "crawler"):
+		info.DeviceType = "bot"
+	case strings.Contains(lower, "ipad") || strings.Contains(lower, "tablet") ||
+		(strings.Contains(lower, "android") && !strings.Contains(lower, "mobile")):
+		info.DeviceType = "tablet"
+	case strings.Contains(lower, "mobile") || strings.Contains(lower, "iphone"):
+		info.DeviceType = "mobile"
+	}
+	return info
+}
+
+// GeoInfo 地理位置
+type GeoInfo struct {
+	Country string `json:"country"`
+	Region  string `json:"region"`
+	City    string `json:"city"`
+}
+
+// GeoResolver 根据IP和请求头解析地理位置
+type GeoResolver interface {
+	Resolve(ip net.IP, header http.Header) GeoInfo
+}
+
+// headerGeoResolver 读取网关或CDN注入的地理位置请求头，
+// 作为接入IP库之前的替代实现；内网地址标记为LOCAL
+type headerGeoResolver struct{}
+
+// Resolve 实现GeoResolver
+func (headerGeoResolver) Resolve(ip net.IP, header http.Header) GeoInfo {
+	geo := GeoInfo{
+		Country: strings.ToUpper(firstHeader(header, "X-Geo-Country", "CF-IPCountry")),
+		Region:  firstHeader(header, "X-Geo-Region"),
+		City:    firstHeader(header, "X-Geo-City"),
+	}
+	if geo.Country == "" && ip != nil && (ip.IsLoopback() || ip.IsPrivate()) {
+		geo.Country = "LOCAL"
+	}
+	return geo
+}
+
+func firstHeader(header http.Header, names ...string) string {
+	for _, name := range names {
+		if v := strings.TrimSpace(header.Get(name)); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// truncateIP 截断IP地址：IPv4保留前24位，IPv6保留前48位
+func truncateIP(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String() + "/48"
+}
+
+// sessionState 访客当前会话
+type sessionState struct {
+	ID       string    `json:"id"`
+	Start    time.Time `json:"start"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// SessionStore 保存每个访客当前会话的状态
+type SessionStore interface {
+	Get(ctx context.Context, identity string) (*sessionState, error)
+	Set(ctx context.Context, identity string, state sessionState, ttl time.Duration) error
+}
+
+// AssignSessions 为同一访客按时间排序的事件分配会话：与当前会话间隔不超过idle的事件并入当前会话，
+// 否则开始新会话；早于当前会话且超出idle的迟到事件单独成会话，不影响当前会话
+func AssignSessions(current *sessionState, times []time.Time, idle time.Duration, newID func() string) ([]string, *sessionState) {
+	ids := make([]string, len(times))
+	for i, t := range times {
+		switch {
+		case current == nil || t.Sub(current.LastSeen) > idle:
+			current = &sessionState{ID: newID(), Start: t, LastSeen: t}
+		case current.Start.Sub(t) > idle:
+			ids[i] = newID()
+			continue
+		default:
+			if t.Before(current.Start) {
+				current.Start = t
+			}
+			if t.After(current.LastSeen) {
+				current.LastSeen = t
+			}
+		}
+		ids[i] = current.ID
+	}
+	return ids, current
+}
+
+// memorySessionStore 进程内会话存储，Redis不可用时使用
+type memorySessionStore struct {
+	mu      sync.Mutex
+	entries map[string]memorySessionEntry
+}
+
+type memorySessionEntry struct {
+	state   sessionState
+	expires time.Time
+}
+
+func newMemorySessionStore() *memorySessionStore {
+	return &memorySessionStore{entries: make(map[string]memorySessionEntry)}
+}
+
+// Get 实现SessionStore
+func (m *memorySessionStore) Get(_ context.Context, identity string) (*sessionState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[identity]
+	if !ok || time.Now().After(entry.expires) {
+		delete(m.entries, identity)
+		return nil, nil
+	}
+	state := entry.state
+	return &state, nil
+}
+
+// Set 实现SessionStore，写入时顺带清理过期条目
+func (m *memorySessionStore) Set(_ context.Context, identity string, state sessionState, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if len(m.entries) > 10000 {
+		for k, e := range m.entries {
+			if now.After(e.expires) {
+				delete(m.entries, k)
+			}
+		}
+	}
+	m.entries[identity] = memorySessionEntry{state: state, expires: now.Add(ttl)}
+	return nil
+}
+
+// redisSessionStore 基于Redis的会话存储，多实例共享
+type redisSessionStore struct {
+	client *redis.Client
+}
+
+func (r redisSessionStore) key(identity string) string {
+	return "statistics:session:" + identity
+}
+
+// Get 实现SessionStore
+func (r redisSessionStore) Get(ctx context.Context, identity string) (*sessionState, error) {
+	raw, err := r.client.Get(ctx, r.key(identity)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state sessionState
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+// Set 实现SessionStore
+func (r redisSessionStore) Set(ctx context.Context, identity string, state sessionState, ttl time.Duration) error {
+	raw, _ := json.Marshal(state)
+	return r.client.Set(ctx, r.key(identity), raw, ttl).Err()
+}
+
+// TrackEventInput 客户端上报的单个事件
+type TrackEventInput struct {
+	EventID     string                 `json:"event_id"`
+	Name        string                 `json:"name"`
+	Timestamp   time.Time              `json:"timestamp"`
+	AnonymousID string                 `json:"anonymous_id"`
+	Properties  map[string]interface{} `json:"properties"`
+	Context     map[string]interface{} `json:"context"`
+}
+
+// TrackRequestInfo 服务端补全事件所需的请求信息
+type TrackRequestInfo struct {
+	UserID     uint
+	TenantID   string
+	UserAgent  string
+	IP         net.IP
+	Header     http.Header
+	ReceivedAt time.Time
+}
+
+// TrackEventResult 单个事件的处理结果
+type TrackEventResult struct {
+	Index   int      `json:"index"`
+	EventID string   `json:"event_id,omitempty"`
+	Status  string   `json:"status"` // accepted, duplicate, rejected
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// TrackBatchResult 批量上报结果
+type TrackBatchResult struct {
+	Accepted  int                `json:"accepted"`
+	Duplicate int                `json:"duplicate"`
+	Rejected  int                `json:"rejected"`
+	Results   []TrackEventResult `json:"results"`
+}
+
+// getEventSchemas 获取启用的事件定义，带内存缓存
+func (s *StatisticsEnhancedService) getEventSchemas() (map[string]ProductEventSchema, error) {
+	s.eventSchemaMu.Lock()
+	defer s.eventSchemaMu.Unlock()
+	if s.eventSchemas != nil && time.Since(s.eventSchemasAt) < eventSchemaCacheTTL {
+		return s.eventSchemas, nil
+	}
+	var rows []ProductEventSchema
+	if err := s.postgresDB.Where("enabled = ?", true).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("获取事件定义失败: %w", err)
+	}
+	schemas := make(map[string]ProductEventSchema, len(rows))
+	for _, row := range rows {
+		schemas[row.Name] = row
+	}
+	s.eventSchemas, s.eventSchemasAt = schemas, time.Now()
+	return schemas, nil
+}
+
+// invalidateEventSchemas 事件定义修改后清除缓存
+func (s *StatisticsEnhancedService) invalidateEventSchemas() {
+	s.eventSchemaMu.Lock()
+	s.eventSchemas = nil
+	s.eventSchemaMu.Unlock()
+}
+
+// buildProductEvent 校验单个事件并补全服务端信息
+func buildProductEvent(input TrackEventInput, req TrackRequestInfo, schemas map[string]ProductEventSchema, geo GeoInfo, ua UserAgentInfo) (*ProductEvent, []string) {
+	if !eventNamePattern.MatchString(input.Name) {
+		return nil, []string{"事件名只能包含小写字母、数字和下划线，且以字母开头"}
+	}
+	schema, ok := schemas[input.Name]
+	if !ok {
+		return nil, []string{fmt.Sprintf("未定义的事件 %s", input.Name)}
+	}
+	specs, err := schema.PropertySpecs()
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+	if problems := ValidateEventProperties(specs, schema.AllowAdditional, input.Properties); len(problems) > 0 {
+		return nil, problems
+	}
+
+	event := &ProductEvent{
+		EventID:     input.EventID,
+		Name:        input.Name,
+		UserID:      req.UserID,
+		AnonymousID: input.AnonymousID,
+		TenantID:    req.TenantID,
+		Browser:     ua.Browser,
+		OS:          ua.OS,
+		DeviceType:  ua.DeviceType,
+		Country:     geo.Country,
+		Region:      geo.Region,
+		City:        geo.City,
+		IPPrefix:    truncateIP(req.IP),
+		OccurredAt:  input.Timestamp,
+		ReceivedAt:  req.ReceivedAt,
+	}
+	switch {
+	case req.UserID > 0:
+		event.Identity = "u:" + strconv.FormatUint(uint64(req.UserID), 10)
+	case input.AnonymousID != "" && len(input.AnonymousID) <= maxAnonymousIDLength:
+		event.Identity = "a:" + input.AnonymousID
+	default:
+		return nil, []string{fmt.Sprintf("未登录时需要提供不超过%d个字符的anonymous_id", maxAnonymousIDLength)}
+	}
+	if event.EventID == "" {
+		event.EventID = uuid.NewString()
+	} else if len(event.EventID) > 64 {
+		return nil, []string{"event_id不能超过64个字符"}
+	}
+	if event.OccurredAt.IsZero() || event.OccurredAt.After(req.ReceivedAt.Add(maxEventClockSkewFuture)) ||
+		event.OccurredAt.Before(req.ReceivedAt.Add(-maxEventClockSkewPast)) {
+		event.OccurredAt = req.ReceivedAt
+	}
+
+	props, _ := json.Marshal(input.Properties)
+	if len(props) > maxEventPropertiesSize {
+		return nil, []string{fmt.Sprintf("事件属性不能超过%d字节", maxEventPropertiesSize)}
+	}
+	if input.Properties == nil {
+		props = []byte("{}")
+	}
+	eventContext, _ := json.Marshal(input.Context)
+	if input.Context == nil || len(eventContext) > maxEventPropertiesSize {
+		eventContext = []byte("{}")
+	}
+	event.Properties, event.Context = string(props), string(eventContext)
+	return event, nil
+}
+
+// ResolveEventTenant 登录用户事件的租户归属：X-Company-ID指定的企业（用户须为该企业的有效成员，管理员不限），
+// 否则为用户所属的第一个企业，不属于任何企业时不归属租户
+func (s *StatisticsEnhancedService) ResolveEventTenant(userID uint, role, companyHeader string) string {
+	if s.mysqlDB == nil || userID == 0 {
+		return ""
+	}
+	if companyHeader != "" {
+		if companyID, err := strconv.ParseUint(companyHeader, 10, 64); err == nil {
+			if role == "admin" || role == "super_admin" {
+				return fmt.Sprintf("company:%d", companyID)
+			}
+			var count int64
+			s.mysqlDB.Table("company_users").
+				Where("company_id = ? AND user_id = ? AND status = ?", companyID, userID, "active").
+				Count(&count)
+			if count > 0 {
+				return fmt.Sprintf("company:%d", companyID)
+			}
+		}
+	}
+	var membership struct{ CompanyID uint }
+	err := s.mysqlDB.Table("company_users").Select("company_id").
+		Where("user_id = ? AND status = ?", userID, "active").
+		Order("id").Take(&membership).Error
+	if err == nil {
+		return fmt.Sprintf("company:%d", membership.CompanyID)
+	}
+	return ""
+}
+
+// TrackProductEvents 批量接收产品事件：逐条校验、补全、去重、划分会话后保存
+func (s *StatisticsEnhancedService) TrackProductEvents(inputs []TrackEventInput, req TrackRequestInfo) (*TrackBatchResult, error) {
+	if s.postgresDB == nil {
+		return nil, fmt.Errorf("PostgreSQL未连接，无法接收事件")
+	}
+	if len(inputs) == 0 || len(inputs) > maxTrackBatchSize {
+		return nil, fmt.Errorf("每批事件数量必须在1到%d之间", maxTrackBatchSize)
+	}
+	schemas, err := s.getEventSchemas()
+	if err != nil {
+		return nil, err
+	}
+
+	geo := s.geoResolver.Resolve(req.IP, req.Header)
+	ua := ParseUserAgent(req.UserAgent)
+	result := &TrackBatchResult{Results: make([]TrackEventResult, len(inputs))}
+	var events []*ProductEvent
+	eventIndex := make(map[string]int)
+	for i, input := range inputs {
+		event, problems := buildProductEvent(input, req, schemas, geo, ua)
+		if event == nil {
+			result.Results[i] = TrackEventResult{Index: i, EventID: input.EventID, Status: "rejected", Errors: problems}
+			result.Rejected++
+			continue
+		}
+		if _, seen := eventIndex[event.EventID]; seen {
+			result.Results[i] = TrackEventResult{Index: i, EventID: event.EventID, Status: "duplicate"}
+			result.Duplicate++
+			continue
+		}
+		eventIndex[event.EventID] = i
+		events = append(events, event)
+	}
+
+	// 去掉已经接收过的事件（客户端重试）
+	if len(events) > 0 {
+		ids := make([]string, len(events))
+		for i, e := range events {
+			ids[i] = e.EventID
+		}
+		var existing []string
+		if err := s.postgresDB.Model(&ProductEvent{}).Where("event_id IN ?", ids).Pluck("event_id", &existing).Error; err != nil {
+			return nil, fmt.Errorf("检查重复事件失败: %w", err)
+		}
+		seen := make(map[string]bool, len(existing))
+		for _, id := range existing {
+			seen[id] = true
+		}
+		fresh := events[:0]
+		for _, e := range events {
+			if seen[e.EventID] {
+				i := eventIndex[e.EventID]
+				result.Results[i] = TrackEventResult{Index: i, EventID: e.EventID, Status: "duplicate"}
+				result.Duplicate++
+				continue
+			}
+			fresh = append(fresh, e)
+		}
+		events = fresh
+	}
+
+	if len(events) > 0 {
+		sessions, err := s.sessionizeEvents(events)
+		if err != nil {
+			return nil, err
+		}
+		err = s.postgresDB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "event_id"}}, DoNothing: true}).
+				Create(&events).Error; err != nil {
+				return fmt.Errorf("保存事件失败: %w", err)
+			}
+			return tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "id"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"started_at":  gorm.Expr("LEAST(product_sessions.started_at, excluded.started_at)"),
+					"ended_at":    gorm.Expr("GREATEST(product_sessions.ended_at, excluded.ended_at)"),
+					"event_count": gorm.Expr("product_sessions.event_count + excluded.event_count"),
+				}),
+			}).Create(&sessions).Error
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, e := range events {
+		i := eventIndex[e.EventID]
+		result.Results[i] = TrackEventResult{Index: i, EventID: e.EventID, Status: "accepted"}
+		result.Accepted++
+	}
+	return result, nil
+}
+
+// sessionizeEvents 为事件分配会话并返回本批涉及的会话汇总
+func (s *StatisticsEnhancedService) sessionizeEvents(events []*ProductEvent) ([]ProductSession, error) {
+	ctx := context.Background()
+	byIdentity := make(map[string][]*ProductEvent)
+	for _, e := range events {
+		byIdentity[e.Identity] = append(byIdentity[e.Identity], e)
+	}
+
+	summaries := make(map[string]*ProductSession)
+	for identity, group := range byIdentity {
+		sort.SliceStable(group, func(i, j int) bool { return group[i].OccurredAt.Before(group[j].OccurredAt) })
+		times := make([]time.Time, len(group))
+		for i, e := range group {
+			times[i] = e.OccurredAt
+		}
+
+		current, err := s.sessionStore.Get(ctx, identity)
+		if err != nil {
+			return nil, fmt.Errorf("读取会话状态失败: %w", err)
+		}
+		ids, next := AssignSessions(current, times, s.sessionIdleTimeout, uuid.NewString)
+		if err := s.sessionStore.Set(ctx, identity, *next, s.sessionIdleTimeout); err != nil {
+			return nil, fmt.Errorf("保存会话状态失败: %w", err)
+		}
+
+		for i, e := range group {
+			e.SessionID = ids[i]
+			summary := summaries[ids[i]]
+			if summary == nil {
+				summary = &ProductSession{ID: ids[i], Identity: identity, TenantID: e.TenantID, StartedAt: e.OccurredAt, EndedAt: e.OccurredAt}
+				summaries[ids[i]] = summary
+			}
+			if e.OccurredAt.Before(summary.StartedAt) {
+				summary.StartedAt = e.OccurredAt
+			}
+			if e.OccurredAt.After(summary.EndedAt) {
+				summary.EndedAt = e.OccurredAt
+			}
+			summary.EventCount++
+		}
+	}
+
+	sessions := make([]ProductSession, 0, len(summaries))
+	for _, summary := range summaries {
+		sessions = append(sessions, *summary)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return sessions, nil
+}
+
+// ListEventSchemas 获取全部事件定义
+func (s *StatisticsEnhancedService) ListEventSchemas() ([]ProductEventSchema, error) {
+	if s.postgresDB == nil {
+		return nil, fmt.Errorf("PostgreSQL未连接，无法获取事件定义")
+	}
+	var schemas []ProductEventSchema
+	if err := s.postgresDB.Order("name").Find(&schemas).Error; err != nil {
+		return nil, fmt.Errorf("获取事件定义失败: %w", err)
+	}
+	return schemas, nil
+}
+
+// SaveEventSchema 创建或更新事件定义
+func (s *StatisticsEnhancedService) SaveEventSchema(schema *ProductEventSchema) error {
+	if s.postgresDB == nil {
+		return fmt.Errorf("PostgreSQL未连接，无法保存事件定义")
+	}
+	if !eventNamePattern.MatchString(schema.Name) {
+		return fmt.Errorf("事件名只能包含小写字母、数字和下划线，且以字母开头")
+	}
+	if schema.Properties == "" {
+		schema.Properties = "{}"
+	}
+	if _, err := schema.PropertySpecs(); err != nil {
+		return err
+	}
+	if err := s.postgresDB.Save(schema).Error; err != nil {
+		return fmt.Errorf("保存事件定义失败: %w", err)
+	}
+	s.invalidateEventSchemas()
+	return nil
+}
+
+// DeleteEventSchema 删除事件定义，已接收的事件保留
+func (s *StatisticsEnhancedService) DeleteEventSchema(name string) error {
+	if s.postgresDB == nil {
+		return fmt.Errorf("PostgreSQL未连接，无法删除事件定义")
+	}
+	if err := s.postgresDB.Delete(&ProductEventSchema{}, "name = ?", name).Error; err != nil {
+		return fmt.Errorf("删除事件定义失败: %w", err)
+	}
+	s.invalidateEventSchemas()
+	return nil
+}
+
+// seedEventSchemas 写入缺失的内置事件定义，不覆盖已修改的定义
+func (s *StatisticsEnhancedService) seedEventSchemas() error {
+	for _, schema := range defaultEventSchemas() {
+		if err := s.postgresDB.Where("name = ?", schema.Name).FirstOrCreate(&schema).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
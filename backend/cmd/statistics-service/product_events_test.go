@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func testEventSchemas() map[string]ProductEventSchema {
+	schemas := make(map[string]ProductEventSchema)
+	for _, s := range defaultEventSchemas() {
+		schemas[s.Name] = s
+	}
+	return schemas
+}
+
+// TestValidateEventProperties 类型、必填、枚举、长度、范围和未声明属性
+func TestValidateEventProperties(t *testing.T) {
+	schemas := testEventSchemas()
+	search := schemas["search"]
+	specs, err := search.PropertySpecs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if problems := ValidateEventProperties(specs, false, map[string]interface{}{
+		"query": "golang", "scope": "jobs", "results": 12.0,
+	}); len(problems) != 0 {
+		t.Errorf("valid event rejected: %v", problems)
+	}
+
+	problems := ValidateEventProperties(specs, false, map[string]interface{}{
+		"scope":   "people",
+		"results": 1.5,
+		"extra":   true,
+	})
+	want := []string{"缺少必填属性 query", "属性 results 应为整数", "属性 scope 取值必须是", "未声明的属性 extra"}
+	joined := strings.Join(problems, "\n")
+	for _, w := range want {
+		if !strings.Contains(joined, w) {
+			t.Errorf("missing problem %q in %v", w, problems)
+		}
+	}
+
+	if problems := ValidateEventProperties(specs, true, map[string]interface{}{"query": "x", "extra": 1.0}); len(problems) != 0 {
+		t.Errorf("additional properties should be allowed: %v", problems)
+	}
+	if problems := ValidateEventProperties(specs, false, map[string]interface{}{"query": strings.Repeat("长", 201)}); len(problems) != 1 {
+		t.Errorf("max length counts runes: %v", problems)
+	}
+	if problems := ValidateEventProperties(specs, false, map[string]interface{}{"query": "x", "results": -1.0}); len(problems) != 1 {
+		t.Errorf("minimum not enforced: %v", problems)
+	}
+
+	bad := ProductEventSchema{Properties: `{"a":{"type":"date"}}`}
+	if _, err := bad.PropertySpecs(); err == nil {
+		t.Error("unsupported property type should be rejected")
+	}
+}
+
+// TestParseUserAgent 常见浏览器、系统和设备类型
+func TestParseUserAgent(t *testing.T) {
+	cases := []struct {
+		ua   string
+		want UserAgentInfo
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36",
+			UserAgentInfo{"chrome", "windows", "desktop"}},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36 Edg/120.0",
+			UserAgentInfo{"edge", "windows", "desktop"}},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1",
+			UserAgentInfo{"safari", "ios", "mobile"}},
+		{"Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36",
+			UserAgentInfo{"chrome", "android", "tablet"}},
+		{"Mozilla/5.0 (Linux; Android 13; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36 MicroMessenger/8.0",
+			UserAgentInfo{"wechat", "android", "mobile"}},
+		{"Mozilla/5.0 (compatible; Baiduspider/2.0; +http://www.baidu.com/search/spider.html)",
+			UserAgentInfo{"other", "other", "bot"}},
+		{"", UserAgentInfo{"other", "other", "unknown"}},
+	}
+	for _, tc := range cases {
+		if got := ParseUserAgent(tc.ua); got != tc.want {
+			t.Errorf("%q: got %+v, want %+v", tc.ua, got, tc.want)
+		}
+	}
+}
+
+// TestGeoAndIPEnrichment 地理位置读取网关请求头，IP只保留前缀
+func TestGeoAndIPEnrichment(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Geo-Country", "cn")
+	header.Set("X-Geo-City", "Shenzhen")
+	geo := headerGeoResolver{}.Resolve(net.ParseIP("203.0.113.7"), header)
+	if geo.Country != "CN" || geo.City != "Shenzhen" {
+		t.Errorf("unexpected geo: %+v", geo)
+	}
+	if geo := (headerGeoResolver{}).Resolve(net.ParseIP("10.1.2.3"), http.Header{}); geo.Country != "LOCAL" {
+		t.Errorf("private address should resolve to LOCAL: %+v", geo)
+	}
+
+	if got := truncateIP(net.ParseIP("203.0.113.7")); got != "203.0.113.0/24" {
+		t.Errorf("ipv4 prefix = %s", got)
+	}
+	if got := truncateIP(net.ParseIP("2001:db8:abcd:12::1")); got != "2001:db8:abcd::/48" {
+		t.Errorf("ipv6 prefix = %s", got)
+	}
+}
+
+// TestAssignSessions 超过空闲时间开始新会话，迟到事件并入当前会话或单独成会话
+func TestAssignSessions(t *testing.T) {
+	base := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+	n := 0
+	newID := func() string { n++; return fmt.Sprintf("s%d", n) }
+
+	ids, state := AssignSessions(nil, []time.Time{at(0), at(10), at(35), at(80), at(85)}, 30*time.Minute, newID)
+	if strings.Join(ids, ",") != "s1,s1,s1,s2,s2" {
+		t.Errorf("unexpected sessions: %v", ids)
+	}
+	if state.ID != "s2" || !state.Start.Equal(at(80)) || !state.LastSeen.Equal(at(85)) {
+		t.Errorf("unexpected state: %+v", state)
+	}
+
+	// 下一批：一条稍早的迟到事件、一条很早的迟到事件、一条继续当前会话的事件
+	ids, state = AssignSessions(state, []time.Time{at(20), at(70), at(100)}, 30*time.Minute, newID)
+	if strings.Join(ids, ",") != "s3,s2,s2" {
+		t.Errorf("late events: %v", ids)
+	}
+	if state.ID != "s2" || !state.Start.Equal(at(70)) || !state.LastSeen.Equal(at(100)) {
+		t.Errorf("state after late events: %+v", state)
+	}
+}
+
+// TestBuildProductEvent 身份、时间校正和属性校验
+func TestBuildProductEvent(t *testing.T) {
+	schemas := testEventSchemas()
+	now := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	anon := TrackRequestInfo{IP: net.ParseIP("203.0.113.7"), ReceivedAt: now}
+	ua := ParseUserAgent("")
+
+	event, problems := buildProductEvent(TrackEventInput{
+		Name: "page_view", AnonymousID: "abc", Timestamp: now.Add(-time.Hour),
+		Properties: map[string]interface{}{"path": "/jobs"},
+	}, anon, schemas, GeoInfo{}, ua)
+	if event == nil {
+		t.Fatalf("rejected: %v", problems)
+	}
+	if event.Identity != "a:abc" || !event.OccurredAt.Equal(now.Add(-time.Hour)) || event.EventID == "" || event.IPPrefix != "203.0.113.0/24" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+
+	// 登录用户以用户ID为身份；客户端时间过于超前时使用接收时间
+	user := anon
+	user.UserID = 42
+	event, _ = buildProductEvent(TrackEventInput{
+		Name: "feature_used", Timestamp: now.Add(time.Hour),
+		Properties: map[string]interface{}{"feature": "resume_export"},
+	}, user, schemas, GeoInfo{}, ua)
+	if event == nil || event.Identity != "u:42" || !event.OccurredAt.Equal(now) {
+		t.Errorf("unexpected event: %+v", event)
+	}
+
+	for _, input := range []TrackEventInput{
+		{Name: "page_view", Properties: map[string]interface{}{"path": "/"}},                     // 匿名且缺少anonymous_id
+		{Name: "unknown_event", AnonymousID: "abc"},                                              // 未定义的事件
+		{Name: "Page View", AnonymousID: "abc"},                                                  // 非法事件名
+		{Name: "page_view", AnonymousID: "abc", Properties: map[string]interface{}{"path": 1.0}}, // 类型错误
+	} {
+		if event, _ := buildProductEvent(input, anon, schemas, GeoInfo{}, ua); event != nil {
+			t.Errorf("expected rejection for %+v", input)
+		}
+	}
+}
+
+// TestComputeActiveUsers 滑动窗口内去重计数
+func TestComputeActiveUsers(t *testing.T) {
+	activity := []IdentityDay{
+		{"u:1", "2024-02-05"}, // 只计入MAU窗口
+		{"u:1", "2024-03-01"},
+		{"u:2", "2024-03-01"},
+		{"u:1", "2024-03-04"},
+		{"u:3", "2024-03-04"},
+		{"u:1", "2024-03-05"},
+	}
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	points := ComputeActiveUsers(activity, start, start.AddDate(0, 0, 2))
+	if len(points) != 2 {
+		t.Fatalf("unexpected points: %+v", points)
+	}
+	if p := points[0]; p.Date != "2024-03-04" || p.DAU != 2 || p.WAU != 3 || p.MAU != 3 {
+		t.Errorf("2024-03-04: %+v", p)
+	}
+	if p := points[1]; p.DAU != 1 || p.WAU != 3 || p.MAU != 3 || p.Stickiness != 1.0/3 {
+		t.Errorf("2024-03-05: %+v", p)
+	}
+}
+
+// TestComputeRetention 按周划分队列，每期每人只计一次，未到的周期不输出
+func TestComputeRetention(t *testing.T) {
+	firstSeen := map[string]string{
+		"u:1": "2024-03-04", // 周一
+		"u:2": "2024-03-06", // 同一周
+		"u:3": "2024-03-11", // 下一周
+	}
+	activity := []IdentityDay{
+		{"u:1", "2024-03-04"}, {"u:2", "2024-03-06"}, {"u:3", "2024-03-11"},
+		{"u:1", "2024-03-12"}, {"u:1", "2024-03-13"}, // 第1周，重复活动只计一次
+		{"u:2", "2024-03-19"}, // 第2周
+		{"u:3", "2024-03-18"}, // 第1周
+		{"u:9", "2024-03-18"}, // 不在任何队列
+	}
+	asOf := time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC)
+	cohorts := ComputeRetention(firstSeen, activity, "week", 4, asOf)
+	if len(cohorts) != 2 {
+		t.Fatalf("unexpected cohorts: %+v", cohorts)
+	}
+	first := cohorts[0]
+	if first.Cohort != "2024-03-04" || first.Size != 2 || fmt.Sprint(first.Retained) != "[2 1 1]" {
+		t.Errorf("first cohort: %+v", first)
+	}
+	if first.Rates[1] != 0.5 {
+		t.Errorf("week 1 retention = %v", first.Rates[1])
+	}
+	second := cohorts[1]
+	if second.Cohort != "2024-03-11" || second.Size != 1 || fmt.Sprint(second.Retained) != "[1 1]" {
+		t.Errorf("second cohort: %+v", second)
+	}
+
+	daily := ComputeRetention(map[string]string{"u:1": "2024-03-04"}, []IdentityDay{{"u:1", "2024-03-04"}, {"u:1", "2024-03-06"}}, "day", 3, asOf)
+	if len(daily) != 1 || fmt.Sprint(daily[0].Retained) != "[1 0 1]" {
+		t.Errorf("daily retention: %+v", daily)
+	}
+}
+
+// TestMemorySessionStore 过期的会话状态不再返回
+func TestMemorySessionStore(t *testing.T) {
+	store := newMemorySessionStore()
+	state := sessionState{ID: "s1", Start: time.Now(), LastSeen: time.Now()}
+	if err := store.Set(nil, "a:1", state, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := store.Get(nil, "a:1")
+	if got == nil || got.ID != "s1" {
+		t.Fatalf("unexpected state: %+v", got)
+	}
+	_ = store.Set(nil, "a:2", state, -time.Second)
+	if got, _ := store.Get(nil, "a:2"); got != nil {
+		t.Errorf("expired state returned: %+v", got)
+	}
+}
+
+// TestResolveEventTenant 租户来自企业成员关系，不接受非成员指定的企业
+func TestResolveEventTenant(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.Exec(`CREATE TABLE company_users (id integer PRIMARY KEY AUTOINCREMENT, company_id integer, user_id integer, status varchar(20))`).Error; err != nil {
+		t.Fatal(err)
+	}
+	db.Exec(`INSERT INTO company_users (company_id, user_id, status) VALUES (7, 10, 'left'), (3, 10, 'active'), (5, 10, 'active')`)
+	service := &StatisticsEnhancedService{mysqlDB: db}
+
+	cases := []struct {
+		userID        uint
+		role, company string
+		want          string
+	}{
+		{10, "user", "", "company:3"},
+		{10, "user", "5", "company:5"},
+		{10, "user", "7", "company:3"},  // 已离开的企业不能指定
+		{10, "user", "99", "company:3"}, // 非成员企业不能指定
+		{11, "user", "", ""},
+		{11, "admin", "99", "company:99"},
+		{0, "user", "5", ""},
+	}
+	for _, tc := range cases {
+		if got := service.ResolveEventTenant(tc.userID, tc.role, tc.company); got != tc.want {
+			t.Errorf("user=%d role=%s company=%q: 期望 %q，实际 %q", tc.userID, tc.role, tc.company, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// IdentityDay 访客在某天（报表时区）有过活动
+type IdentityDay struct {
+	Identity string
+	Day      string // 2006-01-02
+}
+
+// ActiveUsersPoint 某天的活跃访客数
+type ActiveUsersPoint struct {
+	Date string `json:"date"`
+	DAU  int    `json:"dau"`
+	WAU  int    `json:"wau"` // 截至当天的7天内
+	MAU  int    `json:"mau"` // 截至当天的30天内
+	// Stickiness DAU/MAU，衡量用户回访频率
+	Stickiness float64 `json:"stickiness"`
+}
+
+// ComputeActiveUsers 计算[start, end)每天的DAU、WAU、MAU；activity需包含start之前29天的数据
+func ComputeActiveUsers(activity []IdentityDay, start, end time.Time) []ActiveUsersPoint {
+	byDay := make(map[string]map[string]struct{})
+	for _, a := range activity {
+		if byDay[a.Day] == nil {
+			byDay[a.Day] = make(map[string]struct{})
+		}
+		byDay[a.Day][a.Identity] = struct{}{}
+	}
+	distinct := func(day time.Time, window int) int {
+		seen := make(map[string]struct{})
+		for i := 0; i < window; i++ {
+			for id := range byDay[day.AddDate(0, 0, -i).Format("2006-01-02")] {
+				seen[id] = struct{}{}
+			}
+		}
+		return len(seen)
+	}
+
+	var points []ActiveUsersPoint
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		p := ActiveUsersPoint{
+			Date: day.Format("2006-01-02"),
+			DAU:  len(byDay[day.Format("2006-01-02")]),
+			WAU:  distinct(day, 7),
+			MAU:  distinct(day, 30),
+		}
+		if p.MAU > 0 {
+			p.Stickiness = float64(p.DAU) / float64(p.MAU)
+		}
+		points = append(points, p)
+	}
+	return points
+}
+
+// RetentionCohort 留存队列：Retained[k]为第k个周期仍活跃的人数，第0期即首次活动所在周期
+type RetentionCohort struct {
+	Cohort   string    `json:"cohort"`
+	Size     int       `json:"size"`
+	Retained []int     `json:"retained"`
+	Rates    []float64 `json:"rates"`
+}
+
+// retentionPeriodStart 日期所在周期的起点，week以周一开始
+func retentionPeriodStart(day time.Time, period string) time.Time {
+	if period == "week" {
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	}
+	return day
+}
+
+// ComputeRetention 按首次活动日期分组计算留存；period为day或week，
+// 只输出截至asOf已经开始的周期
+func ComputeRetention(firstSeen map[string]string, activity []IdentityDay, period string, periods int, asOf time.Time) []RetentionCohort {
+	step := 1
+	if period == "week" {
+		step = 7
+	}
+	parse := func(day string) (time.Time, bool) {
+		t, err := time.Parse("2006-01-02", day)
+		return t, err == nil
+	}
+
+	cohortOf := make(map[string]time.Time, len(firstSeen))
+	members := make(map[time.Time]int)
+	for identity, day := range firstSeen {
+		t, ok := parse(day)
+		if !ok {
+			continue
+		}
+		start := retentionPeriodStart(t, period)
+		cohortOf[identity] = start
+		members[start]++
+	}
+
+	// 每个访客在每个偏移周期内只计一次
+	retained := make(map[time.Time][]int)
+	counted := make(map[string]bool)
+	for _, a := range activity {
+		cohort, ok := cohortOf[a.Identity]
+		if !ok {
+			continue
+		}
+		t, ok := parse(a.Day)
+		if !ok || t.Before(cohort) {
+			continue
+		}
+		offset := int(retentionPeriodStart(t, period).Sub(cohort).Hours()/24) / step
+		if offset >= periods {
+			continue
+		}
+		key := fmt.Sprintf("%s|%d", a.Identity, offset)
+		if counted[key] {
+			continue
+		}
+		counted[key] = true
+		if retained[cohort] == nil {
+			retained[cohort] = make([]int, periods)
+		}
+		retained[cohort][offset]++
+	}
+
+	starts := make([]time.Time, 0, len(members))
+	for start := range members {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+
+	asOfDay, _ := parse(asOf.Format("2006-01-02"))
+	cohorts := make([]RetentionCohort, 0, len(starts))
+	for _, start := range starts {
+		cohort := RetentionCohort{Cohort: start.Format("2006-01-02"), Size: members[start]}
+		for k := 0; k < periods; k++ {
+			if start.AddDate(0, 0, k*step).After(asOfDay) {
+				break
+			}
+			n := 0
+			if retained[start] != nil {
+				n = retained[start][k]
+			}
+			cohort.Retained = append(cohort.Retained, n)
+			cohort.Rates = append(cohort.Rates, float64(n)/float64(cohort.Size))
+		}
+		cohorts = append(cohorts, cohort)
+	}
+	return cohorts
+}
+
+// ProductMetricsFilter 产品指标筛选条件
+type ProductMetricsFilter struct {
+	Start    time.Time
+	End      time.Time
+	Event    string // 为空时统计全部事件
+	TenantID string
+	Location *time.Location
+}
+
+// scope 按事件名和租户筛选
+func (f ProductMetricsFilter) scope(event string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if event != "" {
+			db = db.Where("name = ?", event)
+		}
+		if f.TenantID != "" {
+			db = db.Where("tenant_id = ?", f.TenantID)
+		}
+		return db
+	}
+}
+
+// localDay 将日期截断到报表时区的零点
+func localDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// loadIdentityDays 按报表时区加载[start, end)内每天的活跃访客
+func (s *StatisticsEnhancedService) loadIdentityDays(filter ProductMetricsFilter, event string, start, end time.Time) ([]IdentityDay, error) {
+	var rows []IdentityDay
+	err := s.postgresDB.Model(&ProductEvent{}).Scopes(filter.scope(event)).
+		Select("DISTINCT identity, TO_CHAR(occurred_at AT TIME ZONE ?, 'YYYY-MM-DD') AS day", filter.Location.String()).
+		Where("occurred_at >= ? AND occurred_at < ?", start, end).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("获取活跃数据失败: %w", err)
+	}
+	return rows, nil
+}
+
+// GetActiveUsers 获取每日DAU、WAU、MAU
+func (s *StatisticsEnhancedService) GetActiveUsers(filter ProductMetricsFilter) ([]ActiveUsersPoint, error) {
+	if s.postgresDB == nil {
+		return nil, fmt.Errorf("PostgreSQL未连接，无法计算活跃用户")
+	}
+	start, end := localDay(filter.Start, filter.Location), filter.End
+	activity, err := s.loadIdentityDays(filter, filter.Event, start.AddDate(0, 0, -29), end)
+	if err != nil {
+		return nil, err
+	}
+	return ComputeActiveUsers(activity, start, end), nil
+}
+
+// GetRetention 获取留存队列：首次发生startEvent的访客按日期分组，之后发生returnEvent视为留存
+func (s *StatisticsEnhancedService) GetRetention(filter ProductMetricsFilter, startEvent, returnEvent, period string, periods int) ([]RetentionCohort, error) {
+	if s.postgresDB == nil {
+		return nil, fmt.Errorf("PostgreSQL未连接，无法计算留存")
+	}
+	if period != "day" && period != "week" {
+		return nil, fmt.Errorf("留存周期只支持day或week")
+	}
+	if periods <= 0 || periods > 52 {
+		return nil, fmt.Errorf("留存期数必须在1到52之间")
+	}
+
+	// 首次活动按全部历史计算，只保留首次活动落在查询范围内的访客
+	var first []IdentityDay
+	err := s.postgresDB.Model(&ProductEvent{}).Scopes(filter.scope(startEvent)).
+		Select("identity, TO_CHAR(MIN(occurred_at) AT TIME ZONE ?, 'YYYY-MM-DD') AS day", filter.Location.String()).
+		Group("identity").
+		Having("MIN(occurred_at) >= ? AND MIN(occurred_at) < ?", filter.Start, filter.End).
+		Scan(&first).Error
+	if err != nil {
+		return nil, fmt.Errorf("获取首次活动失败: %w", err)
+	}
+	firstSeen := make(map[string]string, len(first))
+	for _, f := range first {
+		firstSeen[f.Identity] = f.Day
+	}
+
+	step := 1
+	if period == "week" {
+		step = 7
+	}
+	activityEnd := localDay(filter.End, filter.Location).AddDate(0, 0, periods*step+step)
+	activity, err := s.loadIdentityDays(filter, returnEvent, localDay(filter.Start, filter.Location), activityEnd)
+	if err != nil {
+		return nil, err
+	}
+	return ComputeRetention(firstSeen, activity, period, periods, time.Now().In(filter.Location)), nil
+}
+
+// SessionStats 会话统计
+type SessionStats struct {
+	Sessions         int64   `json:"sessions"`
+	AvgDurationSec   float64 `json:"avg_duration_seconds"`
+	AvgEventsPerSess float64 `json:"avg_events_per_session"`
+	BounceRate       float64 `json:"bounce_rate"` // 只有一个事件的会话占比
+}
+
+// GetSessionStats 获取[start, end)内开始的会话统计
+func (s *StatisticsEnhancedService) GetSessionStats(filter ProductMetricsFilter) (*SessionStats, error) {
+	if s.postgresDB == nil {
+		return nil, fmt.Errorf("PostgreSQL未连接，无法获取会话统计")
+	}
+	var stats SessionStats
+	db := s.postgresDB.Model(&ProductSession{}).
+		Select(`COUNT(*) AS sessions,
+			COALESCE(AVG(EXTRACT(EPOCH FROM (ended_at - started_at))), 0) AS avg_duration_sec,
+			COALESCE(AVG(event_count), 0) AS avg_events_per_sess,
+			COALESCE(AVG(CASE WHEN event_count = 1 THEN 1.0 ELSE 0 END), 0) AS bounce_rate`).
+		Where("started_at >= ? AND started_at < ?", filter.Start, filter.End)
+	if filter.TenantID != "" {
+		db = db.Where("tenant_id = ?", filter.TenantID)
+	}
+	if err := db.Scan(&stats).Error; err != nil {
+		return nil, fmt.Errorf("获取会话统计失败: %w", err)
+	}
+	return &stats, nil
+}
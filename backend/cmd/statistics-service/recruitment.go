@@ -0,0 +1,580 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 招聘事件类型，由job-service上报
+const (
+	RecruitmentJobViewed            = "job_viewed"
+	RecruitmentApplicationSubmitted = "application_submitted"
+	RecruitmentApplicationReviewed  = "application_reviewed"
+	RecruitmentInterviewScheduled   = "interview_scheduled"
+	RecruitmentCandidateHired       = "candidate_hired"
+	RecruitmentApplicationRejected  = "application_rejected"
+	RecruitmentApplicationWithdrawn = "application_withdrawn"
+)
+
+const (
+	// defaultRecruitmentSource 未标明来源的浏览和申请
+	defaultRecruitmentSource = "direct"
+	// maxFunnelBreakdownRows 按职位/企业拆分时最多返回的行数
+	maxFunnelBreakdownRows = 200
+)
+
+// 招聘漏斗阶段，按先后顺序
+const (
+	FunnelStageViewed      = "viewed"
+	FunnelStageApplied     = "applied"
+	FunnelStageReviewed    = "reviewed"
+	FunnelStageInterviewed = "interviewed"
+	FunnelStageHired       = "hired"
+)
+
+var funnelStages = []string{FunnelStageViewed, FunnelStageApplied, FunnelStageReviewed, FunnelStageInterviewed, FunnelStageHired}
+
+// RecruitmentEvent 招聘事件原始记录，EventID用于去重
+type RecruitmentEvent struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	EventID       string    `json:"event_id" gorm:"size:64;not null;uniqueIndex"`
+	EventType     string    `json:"event_type" gorm:"size:40;not null;index"`
+	JobID         uint      `json:"job_id" gorm:"index"`
+	CompanyID     uint      `json:"company_id" gorm:"index"`
+	ApplicationID uint      `json:"application_id" gorm:"index"`
+	UserID        uint      `json:"user_id"`
+	Source        string    `json:"source" gorm:"size:50"`
+	OccurredAt    time.Time `json:"occurred_at" gorm:"index"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// RecruitmentApplication 由事件投影出的申请进度，记录各阶段首次到达的时间
+type RecruitmentApplication struct {
+	ApplicationID uint       `json:"application_id" gorm:"primaryKey;autoIncrement:false"`
+	JobID         uint       `json:"job_id" gorm:"index"`
+	CompanyID     uint       `json:"company_id" gorm:"index"`
+	UserID        uint       `json:"user_id"`
+	Source        string     `json:"source" gorm:"size:50"`
+	AppliedAt     *time.Time `json:"applied_at" gorm:"index"`
+	ReviewedAt    *time.Time `json:"reviewed_at"`
+	InterviewedAt *time.Time `json:"interviewed_at"`
+	HiredAt       *time.Time `json:"hired_at"`
+	RejectedAt    *time.Time `json:"rejected_at"`
+	WithdrawnAt   *time.Time `json:"withdrawn_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// Validate 校验事件并补全默认值
+func (e *RecruitmentEvent) Validate() error {
+	switch e.EventType {
+	case RecruitmentJobViewed:
+	case RecruitmentApplicationSubmitted, RecruitmentApplicationReviewed, RecruitmentInterviewScheduled,
+		RecruitmentCandidateHired, RecruitmentApplicationRejected, RecruitmentApplicationWithdrawn:
+		if e.ApplicationID == 0 {
+			return fmt.Errorf("%s 事件需要application_id", e.EventType)
+		}
+	default:
+		return fmt.Errorf("不支持的招聘事件类型: %s", e.EventType)
+	}
+	if e.JobID == 0 {
+		return fmt.Errorf("招聘事件需要job_id")
+	}
+	if e.EventID == "" {
+		e.EventID = uuid.NewString()
+	}
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now()
+	}
+	e.Source = strings.ToLower(strings.TrimSpace(e.Source))
+	return nil
+}
+
+// earliest 阶段时间只保留最早一次，事件乱序或重复时结果不变
+func earliest(field **time.Time, t time.Time) {
+	if *field == nil || t.Before(**field) {
+		at := t
+		*field = &at
+	}
+}
+
+// ApplyRecruitmentEvent 将事件合并到申请进度中
+func ApplyRecruitmentEvent(app *RecruitmentApplication, e RecruitmentEvent) {
+	app.ApplicationID = e.ApplicationID
+	if app.JobID == 0 {
+		app.JobID = e.JobID
+	}
+	if app.CompanyID == 0 {
+		app.CompanyID = e.CompanyID
+	}
+	if app.UserID == 0 {
+		app.UserID = e.UserID
+	}
+	switch e.EventType {
+	case RecruitmentApplicationSubmitted:
+		earliest(&app.AppliedAt, e.OccurredAt)
+		if e.Source != "" {
+			app.Source = e.Source
+		}
+	case RecruitmentApplicationReviewed:
+		earliest(&app.ReviewedAt, e.OccurredAt)
+	case RecruitmentInterviewScheduled:
+		earliest(&app.InterviewedAt, e.OccurredAt)
+	case RecruitmentCandidateHired:
+		earliest(&app.HiredAt, e.OccurredAt)
+	case RecruitmentApplicationRejected:
+		earliest(&app.RejectedAt, e.OccurredAt)
+	case RecruitmentApplicationWithdrawn:
+		earliest(&app.WithdrawnAt, e.OccurredAt)
+	}
+	if app.Source == "" {
+		app.Source = defaultRecruitmentSource
+	}
+}
+
+// reachedStage 申请是否到达某阶段；后续阶段已到达时视为经过了前面的阶段（例如直接录用）
+func (app *RecruitmentApplication) reachedStage(stage string) bool {
+	switch stage {
+	case FunnelStageApplied:
+		return app.AppliedAt != nil
+	case FunnelStageReviewed:
+		return app.ReviewedAt != nil || app.InterviewedAt != nil || app.HiredAt != nil
+	case FunnelStageInterviewed:
+		return app.InterviewedAt != nil || app.HiredAt != nil
+	case FunnelStageHired:
+		return app.HiredAt != nil
+	}
+	return false
+}
+
+// FunnelStageStats 漏斗阶段人数与转化率
+type FunnelStageStats struct {
+	Stage string `json:"stage"`
+	Count int64  `json:"count"`
+	// ConversionFromPrevious 相对上一阶段的转化率，ConversionFromFirst 相对首个阶段
+	ConversionFromPrevious float64 `json:"conversion_from_previous"`
+	ConversionFromFirst    float64 `json:"conversion_from_first"`
+}
+
+// DurationStats 耗时分布（小时）
+type DurationStats struct {
+	Count       int     `json:"count"`
+	AvgHours    float64 `json:"avg_hours"`
+	MedianHours float64 `json:"median_hours"`
+	P90Hours    float64 `json:"p90_hours"`
+}
+
+// StageDuration 相邻阶段之间的停留时长
+type StageDuration struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	DurationStats
+}
+
+// SourceAttribution 按候选人来源归因
+type SourceAttribution struct {
+	Source       string  `json:"source"`
+	Views        int64   `json:"views"`
+	Applications int64   `json:"applications"`
+	Interviews   int64   `json:"interviews"`
+	Hires        int64   `json:"hires"`
+	ApplyRate    float64 `json:"apply_rate"` // 申请数/浏览数
+	HireRate     float64 `json:"hire_rate"`  // 录用数/申请数
+}
+
+// RecruitmentFunnel 招聘漏斗分析结果
+type RecruitmentFunnel struct {
+	Stages      []FunnelStageStats  `json:"stages"`
+	Rejected    int64               `json:"rejected"`
+	Withdrawn   int64               `json:"withdrawn"`
+	TimeInStage []StageDuration     `json:"time_in_stage"`
+	TimeToHire  DurationStats       `json:"time_to_hire"`
+	Sources     []SourceAttribution `json:"sources"`
+}
+
+// summarizeDurations 计算耗时分布
+func summarizeDurations(hours []float64) DurationStats {
+	if len(hours) == 0 {
+		return DurationStats{}
+	}
+	sorted := append([]float64(nil), hours...)
+	sort.Float64s(sorted)
+	return DurationStats{
+		Count:       len(sorted),
+		AvgHours:    mean(sorted),
+		MedianHours: percentile(sorted, 0.5),
+		P90Hours:    percentile(sorted, 0.9),
+	}
+}
+
+func ratio(numerator, denominator int64) float64 {
+	if denominator == 0 {
+		return 0
+	}
+	return float64(numerator) / float64(denominator)
+}
+
+// stageTime 阶段到达时间，未记录时返回nil
+func (app *RecruitmentApplication) stageTime(stage string) *time.Time {
+	switch stage {
+	case FunnelStageApplied:
+		return app.AppliedAt
+	case FunnelStageReviewed:
+		return app.ReviewedAt
+	case FunnelStageInterviewed:
+		return app.InterviewedAt
+	case FunnelStageHired:
+		return app.HiredAt
+	}
+	return nil
+}
+
+// BuildRecruitmentFunnel 根据各来源浏览数和申请进度计算漏斗、阶段停留时长、招聘周期和来源归因
+func BuildRecruitmentFunnel(viewsBySource map[string]int64, apps []RecruitmentApplication) RecruitmentFunnel {
+	counts := make(map[string]int64, len(funnelStages))
+	sources := make(map[string]*SourceAttribution)
+	source := func(name string) *SourceAttribution {
+		if name == "" {
+			name = defaultRecruitmentSource
+		}
+		if sources[name] == nil {
+			sources[name] = &SourceAttribution{Source: name}
+		}
+		return sources[name]
+	}
+	for name, views := range viewsBySource {
+		counts[FunnelStageViewed] += views
+		source(name).Views += views
+	}
+
+	var funnel RecruitmentFunnel
+	stageHours := make([][]float64, len(funnelStages)-2)
+	var hireHours []float64
+	for i := range apps {
+		app := &apps[i]
+		for _, stage := range funnelStages[1:] {
+			if app.reachedStage(stage) {
+				counts[stage]++
+			}
+		}
+		if app.RejectedAt != nil {
+			funnel.Rejected++
+		}
+		if app.WithdrawnAt != nil {
+			funnel.Withdrawn++
+		}
+
+		// 阶段停留时长只统计两端时间都有记录的申请
+		for s := 1; s < len(funnelStages)-1; s++ {
+			from, to := app.stageTime(funnelStages[s]), app.stageTime(funnelStages[s+1])
+			if from != nil && to != nil && !to.Before(*from) {
+				stageHours[s-1] = append(stageHours[s-1], to.Sub(*from).Hours())
+			}
+		}
+		if app.AppliedAt != nil && app.HiredAt != nil && !app.HiredAt.Before(*app.AppliedAt) {
+			hireHours = append(hireHours, app.HiredAt.Sub(*app.AppliedAt).Hours())
+		}
+
+		attribution := source(app.Source)
+		attribution.Applications++
+		if app.reachedStage(FunnelStageInterviewed) {
+			attribution.Interviews++
+		}
+		if app.reachedStage(FunnelStageHired) {
+			attribution.Hires++
+		}
+	}
+
+	for i, stage := range funnelStages {
+		stats := FunnelStageStats{Stage: stage, Count: counts[stage]}
+		if i > 0 {
+			stats.ConversionFromPrevious = ratio(counts[stage], counts[funnelStages[i-1]])
+			stats.ConversionFromFirst = ratio(counts[stage], counts[funnelStages[0]])
+		}
+		funnel.Stages = append(funnel.Stages, stats)
+	}
+	for s, hours := range stageHours {
+		funnel.TimeInStage = append(funnel.TimeInStage, StageDuration{
+			From:          funnelStages[s+1],
+			To:            funnelStages[s+2],
+			DurationStats: summarizeDurations(hours),
+		})
+	}
+	funnel.TimeToHire = summarizeDurations(hireHours)
+
+	for _, attribution := range sources {
+		attribution.ApplyRate = ratio(attribution.Applications, attribution.Views)
+		attribution.HireRate = ratio(attribution.Hires, attribution.Applications)
+		funnel.Sources = append(funnel.Sources, *attribution)
+	}
+	sort.Slice(funnel.Sources, func(i, j int) bool {
+		if funnel.Sources[i].Applications != funnel.Sources[j].Applications {
+			return funnel.Sources[i].Applications > funnel.Sources[j].Applications
+		}
+		return funnel.Sources[i].Source < funnel.Sources[j].Source
+	})
+	return funnel
+}
+
+// RecruitmentCohort 按申请时间分组的队列
+type RecruitmentCohort struct {
+	Cohort       string        `json:"cohort"` // 2024-W10 或 2024-03
+	Start        time.Time     `json:"start"`
+	Applications int64         `json:"applications"`
+	Reviewed     int64         `json:"reviewed"`
+	Interviewed  int64         `json:"interviewed"`
+	Hired        int64         `json:"hired"`
+	HireRate     float64       `json:"hire_rate"`
+	TimeToHire   DurationStats `json:"time_to_hire"`
+}
+
+// cohortStart 返回时间所在队列的起点和标签，period为week（周一开始）或month
+func cohortStart(t time.Time, period string, loc *time.Location) (time.Time, string) {
+	t = t.In(loc)
+	if period == "month" {
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		return start, start.Format("2006-01")
+	}
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	start := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	year, week := start.ISOWeek()
+	return start, fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// BuildRecruitmentCohorts 按申请所在周或月分组，比较各队列的转化和招聘周期
+func BuildRecruitmentCohorts(apps []RecruitmentApplication, period string, loc *time.Location) []RecruitmentCohort {
+	cohorts := make(map[time.Time]*RecruitmentCohort)
+	hireHours := make(map[time.Time][]float64)
+	for i := range apps {
+		app := &apps[i]
+		if app.AppliedAt == nil {
+			continue
+		}
+		start, label := cohortStart(*app.AppliedAt, period, loc)
+		cohort := cohorts[start]
+		if cohort == nil {
+			cohort = &RecruitmentCohort{Cohort: label, Start: start}
+			cohorts[start] = cohort
+		}
+		cohort.Applications++
+		if app.reachedStage(FunnelStageReviewed) {
+			cohort.Reviewed++
+		}
+		if app.reachedStage(FunnelStageInterviewed) {
+			cohort.Interviewed++
+		}
+		if app.HiredAt != nil {
+			cohort.Hired++
+			if !app.HiredAt.Before(*app.AppliedAt) {
+				hireHours[start] = append(hireHours[start], app.HiredAt.Sub(*app.AppliedAt).Hours())
+			}
+		}
+	}
+
+	result := make([]RecruitmentCohort, 0, len(cohorts))
+	for start, cohort := range cohorts {
+		cohort.HireRate = ratio(cohort.Hired, cohort.Applications)
+		cohort.TimeToHire = summarizeDurations(hireHours[start])
+		result = append(result, *cohort)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Start.Before(result[j].Start) })
+	return result
+}
+
+// FunnelBreakdown 按职位或企业拆分的漏斗概要
+type FunnelBreakdown struct {
+	ID          uint    `json:"id"`
+	Views       int64   `json:"views"`
+	Applied     int64   `json:"applied"`
+	Reviewed    int64   `json:"reviewed"`
+	Interviewed int64   `json:"interviewed"`
+	Hired       int64   `json:"hired"`
+	ApplyRate   float64 `json:"apply_rate"`
+	HireRate    float64 `json:"hire_rate"`
+}
+
+// BuildFunnelBreakdown 按职位（by=job）或企业（by=company）汇总漏斗，按申请数降序
+func BuildFunnelBreakdown(views map[uint]int64, apps []RecruitmentApplication, by string) []FunnelBreakdown {
+	rows := make(map[uint]*FunnelBreakdown)
+	row := func(id uint) *FunnelBreakdown {
+		if rows[id] == nil {
+			rows[id] = &FunnelBreakdown{ID: id}
+		}
+		return rows[id]
+	}
+	for id, n := range views {
+		row(id).Views += n
+	}
+	for i := range apps {
+		app := &apps[i]
+		id := app.JobID
+		if by == "company" {
+			id = app.CompanyID
+		}
+		r := row(id)
+		r.Applied++
+		if app.reachedStage(FunnelStageReviewed) {
+			r.Reviewed++
+		}
+		if app.reachedStage(FunnelStageInterviewed) {
+			r.Interviewed++
+		}
+		if app.reachedStage(FunnelStageHired) {
+			r.Hired++
+		}
+	}
+
+	result := make([]FunnelBreakdown, 0, len(rows))
+	for _, r := range rows {
+		r.ApplyRate = ratio(r.Applied, r.Views)
+		r.HireRate = ratio(r.Hired, r.Applied)
+		result = append(result, *r)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Applied != result[j].Applied {
+			return result[i].Applied > result[j].Applied
+		}
+		return result[i].ID < result[j].ID
+	})
+	if len(result) > maxFunnelBreakdownRows {
+		result = result[:maxFunnelBreakdownRows]
+	}
+	return result
+}
+
+// RecruitmentFilter 招聘分析的筛选条件，时间范围按申请时间（浏览按浏览时间）
+type RecruitmentFilter struct {
+	JobID     uint
+	CompanyID uint
+	Start     time.Time
+	End       time.Time
+}
+
+// RecordRecruitmentEvent 保存招聘事件并更新申请进度，重复的EventID会被忽略
+func (s *StatisticsEnhancedService) RecordRecruitmentEvent(event *RecruitmentEvent) (bool, error) {
+	if s.postgresDB == nil {
+		return false, fmt.Errorf("PostgreSQL未连接，无法记录招聘事件")
+	}
+	if err := event.Validate(); err != nil {
+		return false, err
+	}
+
+	recorded := false
+	err := s.postgresDB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "event_id"}}, DoNothing: true}).Create(event)
+		if result.Error != nil {
+			return fmt.Errorf("保存招聘事件失败: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil // 重复上报
+		}
+		recorded = true
+		if event.ApplicationID == 0 {
+			return nil
+		}
+
+		var app RecruitmentApplication
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&app, event.ApplicationID).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("获取申请进度失败: %w", err)
+		}
+		ApplyRecruitmentEvent(&app, *event)
+		if err := tx.Save(&app).Error; err != nil {
+			return fmt.Errorf("更新申请进度失败: %w", err)
+		}
+		return nil
+	})
+	return recorded, err
+}
+
+// loadRecruitmentData 加载筛选范围内的浏览数（按分组键）和申请进度
+func (s *StatisticsEnhancedService) loadRecruitmentData(filter RecruitmentFilter, viewKey string) ([]recruitmentViewCount, []RecruitmentApplication, error) {
+	if s.postgresDB == nil {
+		return nil, nil, fmt.Errorf("PostgreSQL未连接，无法获取招聘数据")
+	}
+	scope := func(db *gorm.DB) *gorm.DB {
+		if filter.JobID > 0 {
+			db = db.Where("job_id = ?", filter.JobID)
+		}
+		if filter.CompanyID > 0 {
+			db = db.Where("company_id = ?", filter.CompanyID)
+		}
+		return db
+	}
+
+	var views []recruitmentViewCount
+	if err := s.postgresDB.Model(&RecruitmentEvent{}).Scopes(scope).
+		Select(viewKey+" AS key, COUNT(*) AS count").
+		Where("event_type = ? AND occurred_at >= ? AND occurred_at < ?", RecruitmentJobViewed, filter.Start, filter.End).
+		Group(viewKey).Scan(&views).Error; err != nil {
+		return nil, nil, fmt.Errorf("获取职位浏览数据失败: %w", err)
+	}
+
+	var apps []RecruitmentApplication
+	if err := s.postgresDB.Scopes(scope).
+		Where("applied_at >= ? AND applied_at < ?", filter.Start, filter.End).
+		Find(&apps).Error; err != nil {
+		return nil, nil, fmt.Errorf("获取申请进度失败: %w", err)
+	}
+	return views, apps, nil
+}
+
+type recruitmentViewCount struct {
+	Key   string
+	Count int64
+}
+
+// GetRecruitmentFunnel 获取招聘漏斗、阶段停留时长、招聘周期和来源归因
+func (s *StatisticsEnhancedService) GetRecruitmentFunnel(filter RecruitmentFilter) (*RecruitmentFunnel, error) {
+	views, apps, err := s.loadRecruitmentData(filter, "COALESCE(NULLIF(source, ''), '"+defaultRecruitmentSource+"')")
+	if err != nil {
+		return nil, err
+	}
+	viewsBySource := make(map[string]int64, len(views))
+	for _, v := range views {
+		viewsBySource[v.Key] += v.Count
+	}
+	funnel := BuildRecruitmentFunnel(viewsBySource, apps)
+	return &funnel, nil
+}
+
+// GetRecruitmentCohorts 获取按周或月划分的申请队列对比
+func (s *StatisticsEnhancedService) GetRecruitmentCohorts(filter RecruitmentFilter, period string, loc *time.Location) ([]RecruitmentCohort, error) {
+	if period != "week" && period != "month" {
+		return nil, fmt.Errorf("队列周期只支持week或month")
+	}
+	_, apps, err := s.loadRecruitmentData(filter, "job_id")
+	if err != nil {
+		return nil, err
+	}
+	return BuildRecruitmentCohorts(apps, period, loc), nil
+}
+
+// GetRecruitmentBreakdown 获取按职位或企业拆分的漏斗概要
+func (s *StatisticsEnhancedService) GetRecruitmentBreakdown(filter RecruitmentFilter, by string) ([]FunnelBreakdown, error) {
+	column := "job_id"
+	switch by {
+	case "job":
+	case "company":
+		column = "company_id"
+	default:
+		return nil, fmt.Errorf("拆分维度只支持job或company")
+	}
+	views, apps, err := s.loadRecruitmentData(filter, column)
+	if err != nil {
+		return nil, err
+	}
+	viewsByID := make(map[uint]int64, len(views))
+	for _, v := range views {
+		var id uint
+		fmt.Sscan(v.Key, &id)
+		viewsByID[id] += v.Count
+	}
+	return BuildFunnelBreakdown(viewsByID, apps, by), nil
+}
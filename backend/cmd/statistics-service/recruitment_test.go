@@ -0,0 +1,233 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func recruitmentEvents(app uint, source string, base time.Time, steps ...interface{}) []RecruitmentEvent {
+	var events []RecruitmentEvent
+	for i := 0; i+1 < len(steps); i += 2 {
+		events = append(events, RecruitmentEvent{
+			EventType:     steps[i].(string),
+			JobID:         10 + app%2,
+			CompanyID:     1,
+			ApplicationID: app,
+			Source:        source,
+			OccurredAt:    base.Add(time.Duration(steps[i+1].(int)) * time.Hour),
+		})
+	}
+	return events
+}
+
+func project(events []RecruitmentEvent) RecruitmentApplication {
+	var app RecruitmentApplication
+	for _, e := range events {
+		ApplyRecruitmentEvent(&app, e)
+	}
+	return app
+}
+
+// TestApplyRecruitmentEventOrderIndependent 乱序、重复的事件得到相同的申请进度
+func TestApplyRecruitmentEventOrderIndependent(t *testing.T) {
+	base := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	events := recruitmentEvents(1, "referral", base,
+		RecruitmentApplicationSubmitted, 0,
+		RecruitmentApplicationReviewed, 24,
+		RecruitmentInterviewScheduled, 72,
+		RecruitmentCandidateHired, 240,
+	)
+	inOrder := project(events)
+
+	shuffled := []RecruitmentEvent{events[3], events[1], events[1], events[0], events[2]}
+	// 后到的重复审核事件时间更晚，不应覆盖首次审核时间
+	late := events[1]
+	late.OccurredAt = late.OccurredAt.Add(48 * time.Hour)
+	shuffled = append(shuffled, late)
+	outOfOrder := project(shuffled)
+
+	for _, pair := range [][2]*time.Time{
+		{inOrder.AppliedAt, outOfOrder.AppliedAt},
+		{inOrder.ReviewedAt, outOfOrder.ReviewedAt},
+		{inOrder.InterviewedAt, outOfOrder.InterviewedAt},
+		{inOrder.HiredAt, outOfOrder.HiredAt},
+	} {
+		if pair[0] == nil || pair[1] == nil || !pair[0].Equal(*pair[1]) {
+			t.Fatalf("projection differs: %+v vs %+v", inOrder, outOfOrder)
+		}
+	}
+	if outOfOrder.Source != "referral" || outOfOrder.JobID != 11 || outOfOrder.CompanyID != 1 {
+		t.Errorf("unexpected attribution: %+v", outOfOrder)
+	}
+}
+
+// TestBuildRecruitmentFunnel 阶段单调累计，转化率、停留时长、招聘周期和来源归因正确
+func TestBuildRecruitmentFunnel(t *testing.T) {
+	base := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	apps := []RecruitmentApplication{
+		// 完整流程：10天录用
+		project(recruitmentEvents(1, "referral", base, RecruitmentApplicationSubmitted, 0, RecruitmentApplicationReviewed, 24, RecruitmentInterviewScheduled, 72, RecruitmentCandidateHired, 240)),
+		// 跳过面试直接录用：计入面试阶段，4天录用
+		project(recruitmentEvents(2, "search", base, RecruitmentApplicationSubmitted, 0, RecruitmentApplicationReviewed, 48, RecruitmentCandidateHired, 96)),
+		// 面试后被拒
+		project(recruitmentEvents(3, "search", base, RecruitmentApplicationSubmitted, 0, RecruitmentApplicationReviewed, 12, RecruitmentInterviewScheduled, 36, RecruitmentApplicationRejected, 60)),
+		// 审核前撤回
+		project(recruitmentEvents(4, "", base, RecruitmentApplicationSubmitted, 0, RecruitmentApplicationWithdrawn, 5)),
+	}
+	funnel := BuildRecruitmentFunnel(map[string]int64{"search": 30, "referral": 5, "direct": 5}, apps)
+
+	want := map[string]int64{FunnelStageViewed: 40, FunnelStageApplied: 4, FunnelStageReviewed: 3, FunnelStageInterviewed: 3, FunnelStageHired: 2}
+	for _, stage := range funnel.Stages {
+		if stage.Count != want[stage.Stage] {
+			t.Errorf("%s: count %d, want %d", stage.Stage, stage.Count, want[stage.Stage])
+		}
+	}
+	if got := funnel.Stages[1].ConversionFromPrevious; math.Abs(got-0.1) > 1e-9 {
+		t.Errorf("view→apply conversion = %v, want 0.1", got)
+	}
+	if got := funnel.Stages[4].ConversionFromPrevious; math.Abs(got-2.0/3) > 1e-9 {
+		t.Errorf("interview→hire conversion = %v", got)
+	}
+	if got := funnel.Stages[4].ConversionFromFirst; math.Abs(got-0.05) > 1e-9 {
+		t.Errorf("overall conversion = %v, want 0.05", got)
+	}
+	if funnel.Rejected != 1 || funnel.Withdrawn != 1 {
+		t.Errorf("rejected=%d withdrawn=%d", funnel.Rejected, funnel.Withdrawn)
+	}
+
+	// applied→reviewed: 24, 48, 12；reviewed→interviewed: 48, 24；interviewed→hired: 168
+	if d := funnel.TimeInStage[0]; d.From != FunnelStageApplied || d.Count != 3 || d.MedianHours != 24 || math.Abs(d.AvgHours-28) > 1e-9 {
+		t.Errorf("applied→reviewed: %+v", d)
+	}
+	if d := funnel.TimeInStage[1]; d.Count != 2 || d.MedianHours != 36 {
+		t.Errorf("reviewed→interviewed: %+v", d)
+	}
+	if d := funnel.TimeInStage[2]; d.To != FunnelStageHired || d.Count != 1 || d.MedianHours != 168 {
+		t.Errorf("interviewed→hired: %+v", d)
+	}
+	if d := funnel.TimeToHire; d.Count != 2 || d.MedianHours != 168 || d.AvgHours != 168 {
+		t.Errorf("time to hire: %+v", d)
+	}
+
+	sources := map[string]SourceAttribution{}
+	for _, s := range funnel.Sources {
+		sources[s.Source] = s
+	}
+	if s := sources["search"]; s.Views != 30 || s.Applications != 2 || s.Interviews != 2 || s.Hires != 1 || s.HireRate != 0.5 {
+		t.Errorf("search attribution: %+v", s)
+	}
+	if s := sources["direct"]; s.Applications != 1 || s.Hires != 0 || math.Abs(s.ApplyRate-0.2) > 1e-9 {
+		t.Errorf("direct attribution: %+v", s)
+	}
+	if funnel.Sources[0].Source != "search" {
+		t.Errorf("sources should be ordered by applications: %+v", funnel.Sources)
+	}
+}
+
+// TestBuildRecruitmentCohorts 按申请所在周分组（周一开始），跨周的录用计入申请所在的队列
+func TestBuildRecruitmentCohorts(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Shanghai")
+	week10 := time.Date(2024, 3, 10, 20, 0, 0, 0, loc) // 周日
+	week11 := time.Date(2024, 3, 11, 9, 0, 0, 0, loc)  // 周一
+	apps := []RecruitmentApplication{
+		project(recruitmentEvents(1, "", week10, RecruitmentApplicationSubmitted, 0, RecruitmentCandidateHired, 200)),
+		project(recruitmentEvents(2, "", week10, RecruitmentApplicationSubmitted, 0)),
+		project(recruitmentEvents(3, "", week11, RecruitmentApplicationSubmitted, 0, RecruitmentApplicationReviewed, 2)),
+		project(recruitmentEvents(4, "", week11, RecruitmentApplicationReviewed, 2)), // 缺少申请事件，不计入队列
+	}
+
+	cohorts := BuildRecruitmentCohorts(apps, "week", loc)
+	if len(cohorts) != 2 {
+		t.Fatalf("expected 2 cohorts, got %+v", cohorts)
+	}
+	if c := cohorts[0]; c.Cohort != "2024-W10" || c.Applications != 2 || c.Hired != 1 || c.HireRate != 0.5 || c.TimeToHire.MedianHours != 200 {
+		t.Errorf("week 10: %+v", c)
+	}
+	if c := cohorts[1]; c.Cohort != "2024-W11" || c.Applications != 1 || c.Reviewed != 1 || c.Hired != 0 {
+		t.Errorf("week 11: %+v", c)
+	}
+
+	monthly := BuildRecruitmentCohorts(apps, "month", loc)
+	if len(monthly) != 1 || monthly[0].Cohort != "2024-03" || monthly[0].Applications != 3 {
+		t.Errorf("monthly cohorts: %+v", monthly)
+	}
+}
+
+// TestBuildFunnelBreakdown 按职位拆分，无申请但有浏览的职位也会出现
+func TestBuildFunnelBreakdown(t *testing.T) {
+	base := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	apps := []RecruitmentApplication{
+		project(recruitmentEvents(1, "", base, RecruitmentApplicationSubmitted, 0, RecruitmentCandidateHired, 10)),
+		project(recruitmentEvents(3, "", base, RecruitmentApplicationSubmitted, 0)),
+		project(recruitmentEvents(2, "", base, RecruitmentApplicationSubmitted, 0)),
+	}
+	rows := BuildFunnelBreakdown(map[uint]int64{11: 20, 10: 4, 99: 7}, apps, "job")
+	if len(rows) != 3 {
+		t.Fatalf("unexpected rows: %+v", rows)
+	}
+	if r := rows[0]; r.ID != 11 || r.Applied != 2 || r.Hired != 1 || r.ApplyRate != 0.1 || r.HireRate != 0.5 {
+		t.Errorf("job 11: %+v", r)
+	}
+	if r := rows[2]; r.ID != 99 || r.Views != 7 || r.Applied != 0 {
+		t.Errorf("job 99: %+v", r)
+	}
+
+	byCompany := BuildFunnelBreakdown(nil, apps, "company")
+	if len(byCompany) != 1 || byCompany[0].ID != 1 || byCompany[0].Applied != 3 {
+		t.Errorf("by company: %+v", byCompany)
+	}
+}
+
+// TestRecruitmentEventValidate 申请类事件需要申请ID，缺省来源和时间被补全
+func TestRecruitmentEventValidate(t *testing.T) {
+	view := RecruitmentEvent{EventType: RecruitmentJobViewed, JobID: 1, Source: " Search "}
+	if err := view.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if view.EventID == "" || view.OccurredAt.IsZero() || view.Source != "search" {
+		t.Errorf("defaults not applied: %+v", view)
+	}
+
+	for _, e := range []RecruitmentEvent{
+		{EventType: RecruitmentApplicationSubmitted, JobID: 1},
+		{EventType: RecruitmentJobViewed},
+		{EventType: "job_shared", JobID: 1},
+	} {
+		if err := e.Validate(); err == nil {
+			t.Errorf("expected error for %+v", e)
+		}
+	}
+}
+
+// TestRequireEventToken 未配置令牌时拒绝所有请求，配置后只接受携带正确令牌的请求
+func TestRequireEventToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		configured, sent string
+		want             int
+	}{
+		{"", "", http.StatusServiceUnavailable},
+		{"", "anything", http.StatusServiceUnavailable},
+		{"secret", "", http.StatusUnauthorized},
+		{"secret", "wrong", http.StatusUnauthorized},
+		{"secret", "secret", http.StatusOK},
+	}
+	for _, tc := range cases {
+		r := gin.New()
+		r.POST("/recruitment", requireEventToken(tc.configured), func(c *gin.Context) { c.Status(http.StatusOK) })
+		req := httptest.NewRequest(http.MethodPost, "/recruitment", nil)
+		if tc.sent != "" {
+			req.Header.Set("X-Event-Token", tc.sent)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("configured=%q sent=%q: 期望 %d，实际 %d", tc.configured, tc.sent, tc.want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,815 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // 容器镜像中可能没有时区数据
+
+	"gorm.io/gorm"
+	"resume-centre/common/storage"
+)
+
+// 报表数据来源
+const (
+	ReportSourceOverview       = "overview"        // 用户、模板、企业概览
+	ReportSourceUsersTrend     = "users_trend"     // 每日新增用户
+	ReportSourceTemplatesUsage = "templates_usage" // 模板使用排行
+	ReportSourceUsersDetailed  = "users_detailed"  // 用户明细
+	ReportSourceMetric         = "metric"          // 实时分析指标的时间序列汇总
+)
+
+// ReportSection 报表定义中的一个数据区块
+type ReportSection struct {
+	Source string `json:"source"`
+	Title  string `json:"title"`
+	Chart  string `json:"chart"` // bar, line，为空不生成图表
+	Limit  int    `json:"limit"` // templates_usage、users_detailed 的行数上限
+
+	// 以下仅用于 metric 来源
+	MetricType string            `json:"metric_type"`
+	MetricName string            `json:"metric_name"`
+	Step       string            `json:"step"`      // 默认1d
+	Aggregate  string            `json:"aggregate"` // sum, avg, count, min, max, p50, p90, p95, p99，默认sum
+	GroupBy    []string          `json:"group_by"`
+	Filters    map[string]string `json:"filters"`
+}
+
+// ReportDefinition 已保存的报表定义
+type ReportDefinition struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Name        string     `json:"name" gorm:"size:200;not null"`
+	Description string     `json:"description" gorm:"type:text"`
+	Sections    string     `json:"sections" gorm:"type:json"`   // []ReportSection
+	TimeRange   string     `json:"time_range" gorm:"size:50"`   // last_7d, previous_week, previous_month, month_to_date
+	Formats     string     `json:"formats" gorm:"size:50"`      // 逗号分隔：csv,xlsx,pdf
+	Schedule    string     `json:"schedule" gorm:"size:50"`     // daily 08:00 / weekly mon 09:00 / monthly 1 09:00，为空时仅手动生成
+	Timezone    string     `json:"timezone" gorm:"size:50"`     // 默认Asia/Shanghai
+	Recipients  string     `json:"recipients" gorm:"type:json"` // 接收通知的用户ID列表
+	OwnerID     uint       `json:"owner_id" gorm:"index"`
+	Enabled     bool       `json:"enabled"`
+	NextRunAt   *time.Time `json:"next_run_at" gorm:"index"`
+	LastRunAt   *time.Time `json:"last_run_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// ReportArtifact 生成的报表文件，Key为文件在对象存储中的键
+type ReportArtifact struct {
+	Format string `json:"format"`
+	Key    string `json:"key"`
+	Size   int    `json:"size"`
+	URL    string `json:"url"`
+}
+
+// ReportRun 一次报表生成记录
+type ReportRun struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	DefinitionID  uint       `json:"definition_id" gorm:"index;not null"`
+	Status        string     `json:"status" gorm:"size:20"`       // running, completed, failed
+	TriggeredBy   string     `json:"triggered_by" gorm:"size:20"` // schedule, manual
+	StartDate     time.Time  `json:"start_date"`
+	EndDate       time.Time  `json:"end_date"`
+	Artifacts     string     `json:"artifacts" gorm:"type:json"` // []ReportArtifact
+	Error         string     `json:"error" gorm:"type:text"`
+	Delivered     bool       `json:"delivered"`
+	DeliveryError string     `json:"delivery_error" gorm:"type:text"`
+	StartedAt     time.Time  `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// SectionList 解析报表区块
+func (d *ReportDefinition) SectionList() ([]ReportSection, error) {
+	var sections []ReportSection
+	if err := json.Unmarshal([]byte(d.Sections), &sections); err != nil {
+		return nil, fmt.Errorf("报表区块格式错误: %w", err)
+	}
+	return sections, nil
+}
+
+// FormatList 解析导出格式
+func (d *ReportDefinition) FormatList() []string {
+	var formats []string
+	for _, f := range strings.Split(d.Formats, ",") {
+		if f = strings.TrimSpace(strings.ToLower(f)); f != "" {
+			formats = append(formats, f)
+		}
+	}
+	return formats
+}
+
+// RecipientList 解析接收人
+func (d *ReportDefinition) RecipientList() []uint {
+	var recipients []uint
+	_ = json.Unmarshal([]byte(d.Recipients), &recipients)
+	return recipients
+}
+
+// Location 报表时区
+func (d *ReportDefinition) Location() (*time.Location, error) {
+	if d.Timezone == "" {
+		return time.LoadLocation("Asia/Shanghai")
+	}
+	loc, err := time.LoadLocation(d.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("无效的时区: %s", d.Timezone)
+	}
+	return loc, nil
+}
+
+// Validate 校验报表定义并补全默认值
+func (d *ReportDefinition) Validate() error {
+	if strings.TrimSpace(d.Name) == "" {
+		return fmt.Errorf("报表名称不能为空")
+	}
+	sections, err := d.SectionList()
+	if err != nil {
+		return err
+	}
+	if len(sections) == 0 {
+		return fmt.Errorf("报表至少需要一个数据区块")
+	}
+	for i, section := range sections {
+		switch section.Source {
+		case ReportSourceOverview, ReportSourceUsersTrend, ReportSourceTemplatesUsage, ReportSourceUsersDetailed:
+		case ReportSourceMetric:
+			if section.MetricType == "" || section.MetricName == "" {
+				return fmt.Errorf("区块%d: metric来源需要metric_type和metric_name", i+1)
+			}
+			if section.Step != "" {
+				if _, err := ParseRollupStep(section.Step); err != nil {
+					return fmt.Errorf("区块%d: %w", i+1, err)
+				}
+			}
+			if _, ok := rollupPointValue(RollupPoint{}, section.Aggregate); !ok {
+				return fmt.Errorf("区块%d: 不支持的聚合方式 %s", i+1, section.Aggregate)
+			}
+		default:
+			return fmt.Errorf("区块%d: 不支持的数据来源 %s", i+1, section.Source)
+		}
+		if section.Chart != "" && section.Chart != ReportChartBar && section.Chart != ReportChartLine {
+			return fmt.Errorf("区块%d: 不支持的图表类型 %s", i+1, section.Chart)
+		}
+	}
+
+	if d.Formats == "" {
+		d.Formats = ReportFormatXLSX
+	}
+	for _, f := range d.FormatList() {
+		if f != ReportFormatCSV && f != ReportFormatXLSX && f != ReportFormatPDF {
+			return fmt.Errorf("不支持的导出格式: %s", f)
+		}
+	}
+	if d.TimeRange == "" {
+		d.TimeRange = "last_7d"
+	}
+	loc, err := d.Location()
+	if err != nil {
+		return err
+	}
+	if _, _, err := ResolveReportRange(d.TimeRange, time.Now(), loc); err != nil {
+		return err
+	}
+	if _, err := NextReportRun(d.Schedule, time.Now(), loc); err != nil {
+		return err
+	}
+	if d.Recipients == "" {
+		d.Recipients = "[]"
+	}
+	return nil
+}
+
+// ResolveReportRange 将相对时间范围解析为 [start, end)
+func ResolveReportRange(spec string, now time.Time, loc *time.Location) (time.Time, time.Time, error) {
+	now = now.In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	switch {
+	case spec == "previous_week":
+		offset := (int(today.Weekday()) + 6) % 7 // 距本周一的天数
+		thisMonday := today.AddDate(0, 0, -offset)
+		return thisMonday.AddDate(0, 0, -7), thisMonday, nil
+	case spec == "previous_month":
+		thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+		return thisMonth.AddDate(0, -1, 0), thisMonth, nil
+	case spec == "month_to_date":
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc), now, nil
+	case strings.HasPrefix(spec, "last_") && strings.HasSuffix(spec, "d"):
+		days, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(spec, "last_"), "d"))
+		if err != nil || days <= 0 || days > 3660 {
+			return time.Time{}, time.Time{}, fmt.Errorf("无效的时间范围: %s", spec)
+		}
+		return today.AddDate(0, 0, -days), today, nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("无效的时间范围: %s（支持 last_Nd, previous_week, previous_month, month_to_date）", spec)
+}
+
+// NextReportRun 计算after之后的下一次生成时间，schedule为空时返回零值
+// 支持 "daily HH:MM"、"weekly mon HH:MM"、"monthly D HH:MM"（D为1-28）
+func NextReportRun(schedule string, after time.Time, loc *time.Location) (time.Time, error) {
+	fields := strings.Fields(strings.ToLower(schedule))
+	if len(fields) == 0 {
+		return time.Time{}, nil
+	}
+	invalid := fmt.Errorf("无效的生成计划: %s", schedule)
+
+	clock, err := time.Parse("15:04", fields[len(fields)-1])
+	if err != nil {
+		return time.Time{}, invalid
+	}
+	after = after.In(loc)
+	at := func(day time.Time) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+	}
+
+	switch {
+	case fields[0] == "daily" && len(fields) == 2:
+		next := at(after)
+		if !next.After(after) {
+			next = at(after.AddDate(0, 0, 1))
+		}
+		return next, nil
+	case fields[0] == "weekly" && len(fields) == 3:
+		weekdays := map[string]time.Weekday{"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday,
+			"wed": time.Wednesday, "thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday}
+		weekday, ok := weekdays[fields[1]]
+		if !ok {
+			return time.Time{}, invalid
+		}
+		next := at(after.AddDate(0, 0, (int(weekday)-int(after.Weekday())+7)%7))
+		if !next.After(after) {
+			next = next.AddDate(0, 0, 7)
+		}
+		return next, nil
+	case fields[0] == "monthly" && len(fields) == 3:
+		day, err := strconv.Atoi(fields[1])
+		if err != nil || day < 1 || day > 28 {
+			return time.Time{}, invalid
+		}
+		next := at(time.Date(after.Year(), after.Month(), day, 0, 0, 0, 0, loc))
+		if !next.After(after) {
+			next = at(time.Date(after.Year(), after.Month()+1, day, 0, 0, 0, 0, loc))
+		}
+		return next, nil
+	}
+	return time.Time{}, invalid
+}
+
+// rollupPointValue 按聚合方式取汇总点的值
+func rollupPointValue(p RollupPoint, aggregate string) (float64, bool) {
+	switch aggregate {
+	case "", "sum":
+		return p.Sum, true
+	case "avg":
+		return p.Avg, true
+	case "count":
+		return float64(p.Count), true
+	case "min":
+		return p.Min, true
+	case "max":
+		return p.Max, true
+	case "p50":
+		return p.P50, true
+	case "p90":
+		return p.P90, true
+	case "p95":
+		return p.P95, true
+	case "p99":
+		return p.P99, true
+	}
+	return 0, false
+}
+
+// MetricSectionTable 将汇总查询结果转为数据表：第一列为时间，每个分组一列
+func MetricSectionTable(section ReportSection, series []RollupSeries, loc *time.Location) ReportTable {
+	table := ReportTable{Title: section.Title, Columns: []string{"时间"}, Chart: section.Chart}
+	if table.Title == "" {
+		table.Title = section.MetricName
+	}
+
+	index := make(map[time.Time]int)
+	var times []time.Time
+	for _, s := range series {
+		for _, p := range s.Points {
+			if _, ok := index[p.Timestamp]; !ok {
+				index[p.Timestamp] = 0
+				times = append(times, p.Timestamp)
+			}
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	for i, t := range times {
+		index[t] = i
+	}
+
+	rows := make([][]interface{}, len(times))
+	for i, t := range times {
+		rows[i] = make([]interface{}, len(series)+1)
+		rows[i][0] = t.In(loc)
+		for c := range series {
+			rows[i][c+1] = 0.0
+		}
+	}
+	for c, s := range series {
+		table.Columns = append(table.Columns, seriesLabel(section, s.Group))
+		for _, p := range s.Points {
+			v, _ := rollupPointValue(p, section.Aggregate)
+			rows[index[p.Timestamp]][c+1] = v
+		}
+	}
+	table.Rows = rows
+	return table
+}
+
+// seriesLabel 分组列名，如 platform=web
+func seriesLabel(section ReportSection, group map[string]string) string {
+	if len(section.GroupBy) == 0 {
+		aggregate := section.Aggregate
+		if aggregate == "" {
+			aggregate = "sum"
+		}
+		return section.MetricName + "(" + aggregate + ")"
+	}
+	parts := make([]string, 0, len(section.GroupBy))
+	for _, name := range section.GroupBy {
+		parts = append(parts, name+"="+group[name])
+	}
+	return strings.Join(parts, ",")
+}
+
+// CreateReportDefinition 创建报表定义
+func (s *StatisticsEnhancedService) CreateReportDefinition(def *ReportDefinition) error {
+	if s.postgresDB == nil {
+		return fmt.Errorf("PostgreSQL未连接，无法保存报表定义")
+	}
+	if err := def.Validate(); err != nil {
+		return err
+	}
+	if err := s.scheduleNextReportRun(def, time.Now()); err != nil {
+		return err
+	}
+	if err := s.postgresDB.Create(def).Error; err != nil {
+		return fmt.Errorf("保存报表定义失败: %w", err)
+	}
+	return nil
+}
+
+// UpdateReportDefinition 更新报表定义并重新计算下一次生成时间
+func (s *StatisticsEnhancedService) UpdateReportDefinition(id uint, def *ReportDefinition) (*ReportDefinition, error) {
+	existing, err := s.GetReportDefinition(id)
+	if err != nil {
+		return nil, err
+	}
+	def.ID = existing.ID
+	def.OwnerID = existing.OwnerID
+	def.CreatedAt = existing.CreatedAt
+	def.LastRunAt = existing.LastRunAt
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.scheduleNextReportRun(def, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := s.postgresDB.Save(def).Error; err != nil {
+		return nil, fmt.Errorf("更新报表定义失败: %w", err)
+	}
+	return def, nil
+}
+
+// scheduleNextReportRun 根据生成计划设置NextRunAt，未启用或无计划时清空
+func (s *StatisticsEnhancedService) scheduleNextReportRun(def *ReportDefinition, after time.Time) error {
+	loc, err := def.Location()
+	if err != nil {
+		return err
+	}
+	next, err := NextReportRun(def.Schedule, after, loc)
+	if err != nil {
+		return err
+	}
+	if !def.Enabled || next.IsZero() {
+		def.NextRunAt = nil
+		return nil
+	}
+	def.NextRunAt = &next
+	return nil
+}
+
+// GetReportDefinition 获取报表定义
+func (s *StatisticsEnhancedService) GetReportDefinition(id uint) (*ReportDefinition, error) {
+	if s.postgresDB == nil {
+		return nil, fmt.Errorf("PostgreSQL未连接，无法获取报表定义")
+	}
+	var def ReportDefinition
+	if err := s.postgresDB.First(&def, id).Error; err != nil {
+		return nil, fmt.Errorf("获取报表定义失败: %w", err)
+	}
+	return &def, nil
+}
+
+// ListReportDefinitions 获取全部报表定义
+func (s *StatisticsEnhancedService) ListReportDefinitions() ([]ReportDefinition, error) {
+	if s.postgresDB == nil {
+		return nil, fmt.Errorf("PostgreSQL未连接，无法获取报表定义")
+	}
+	var defs []ReportDefinition
+	if err := s.postgresDB.Order("id").Find(&defs).Error; err != nil {
+		return nil, fmt.Errorf("获取报表定义失败: %w", err)
+	}
+	return defs, nil
+}
+
+// DeleteReportDefinition 删除报表定义（已生成的文件保留）
+func (s *StatisticsEnhancedService) DeleteReportDefinition(id uint) error {
+	if s.postgresDB == nil {
+		return fmt.Errorf("PostgreSQL未连接，无法删除报表定义")
+	}
+	if err := s.postgresDB.Delete(&ReportDefinition{}, id).Error; err != nil {
+		return fmt.Errorf("删除报表定义失败: %w", err)
+	}
+	return nil
+}
+
+// ListReportRuns 获取报表的生成记录
+func (s *StatisticsEnhancedService) ListReportRuns(definitionID uint, limit int) ([]ReportRun, error) {
+	if s.postgresDB == nil {
+		return nil, fmt.Errorf("PostgreSQL未连接，无法获取生成记录")
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	var runs []ReportRun
+	if err := s.postgresDB.Where("definition_id = ?", definitionID).Order("id DESC").Limit(limit).Find(&runs).Error; err != nil {
+		return nil, fmt.Errorf("获取生成记录失败: %w", err)
+	}
+	return runs, nil
+}
+
+// GetReportArtifact 获取生成记录中指定格式的文件及其报表定义
+func (s *StatisticsEnhancedService) GetReportArtifact(runID uint, format string) (*ReportArtifact, *ReportDefinition, error) {
+	if s.postgresDB == nil {
+		return nil, nil, fmt.Errorf("PostgreSQL未连接，无法获取报表文件")
+	}
+	var run ReportRun
+	if err := s.postgresDB.First(&run, runID).Error; err != nil {
+		return nil, nil, fmt.Errorf("获取生成记录失败: %w", err)
+	}
+	def, err := s.GetReportDefinition(run.DefinitionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var artifacts []ReportArtifact
+	_ = json.Unmarshal([]byte(run.Artifacts), &artifacts)
+	for _, a := range artifacts {
+		if a.Format == format {
+			if a.Key == "" {
+				a.Key = reportArtifactKey(run.DefinitionID, run.ID, format) // 早期记录未保存对象键
+			}
+			return &a, def, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("生成记录 %d 中没有 %s 格式的文件", runID, format)
+}
+
+// OpenReportArtifact 从对象存储读取报表文件，调用方负责关闭
+func (s *StatisticsEnhancedService) OpenReportArtifact(artifact *ReportArtifact) (io.ReadCloser, error) {
+	reader, err := s.reportStorage.OpenFile(context.Background(), artifact.Key)
+	if err != nil {
+		return nil, fmt.Errorf("读取报表文件失败: %w", err)
+	}
+	return reader, nil
+}
+
+// reportStorageConfig 报表文件存储配置，本地存储目录可通过STATISTICS_REPORT_DIR覆盖
+func reportStorageConfig() *storage.StorageConfig {
+	config := &storage.StorageConfig{
+		Type:        storage.StorageTypeLocal,
+		BasePath:    "data/reports",
+		MaxFileSize: 100 * 1024 * 1024,
+		AllowedExts: []string{"." + ReportFormatCSV, "." + ReportFormatXLSX, "." + ReportFormatPDF},
+	}
+	if dir := os.Getenv("STATISTICS_REPORT_DIR"); dir != "" {
+		config.BasePath = dir
+	}
+	return config
+}
+
+// reportArtifactKey 报表文件的对象键
+func reportArtifactKey(definitionID, runID uint, format string) string {
+	return fmt.Sprintf("%d/%d.%s", definitionID, runID, format)
+}
+
+// RunReport 生成报表：查询数据、导出各格式文件、保存并通知接收人
+func (s *StatisticsEnhancedService) RunReport(definitionID uint, triggeredBy string) (*ReportRun, error) {
+	def, err := s.GetReportDefinition(definitionID)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := def.Location()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	start, end, err := ResolveReportRange(def.TimeRange, now, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &ReportRun{
+		DefinitionID: def.ID,
+		Status:       "running",
+		TriggeredBy:  triggeredBy,
+		StartDate:    start,
+		EndDate:      end,
+		Artifacts:    "[]",
+		StartedAt:    now,
+	}
+	if err := s.postgresDB.Create(run).Error; err != nil {
+		return nil, fmt.Errorf("创建生成记录失败: %w", err)
+	}
+
+	artifacts, genErr := s.generateReportArtifacts(def, run, loc)
+	finished := time.Now()
+	run.FinishedAt = &finished
+	if genErr != nil {
+		run.Status = "failed"
+		run.Error = genErr.Error()
+	} else {
+		run.Status = "completed"
+		artifactsJSON, _ := json.Marshal(artifacts)
+		run.Artifacts = string(artifactsJSON)
+		if err := s.deliverReport(def, run, artifacts); err != nil {
+			run.DeliveryError = err.Error()
+			log.Printf("报表 %d 通知发送失败: %v", def.ID, err)
+		} else {
+			run.Delivered = len(def.RecipientList()) > 0
+		}
+	}
+	if err := s.postgresDB.Save(run).Error; err != nil {
+		log.Printf("保存报表生成记录失败: %v", err)
+	}
+	s.postgresDB.Model(&ReportDefinition{}).Where("id = ?", def.ID).Update("last_run_at", now)
+
+	if genErr != nil {
+		return run, genErr
+	}
+	return run, nil
+}
+
+// generateReportArtifacts 查询各区块数据并导出为配置的格式
+func (s *StatisticsEnhancedService) generateReportArtifacts(def *ReportDefinition, run *ReportRun, loc *time.Location) ([]ReportArtifact, error) {
+	sections, err := def.SectionList()
+	if err != nil {
+		return nil, err
+	}
+	report := &RenderedReport{
+		Name: def.Name,
+		Period: fmt.Sprintf("%s ~ %s", run.StartDate.In(loc).Format("2006-01-02"),
+			run.EndDate.In(loc).Add(-time.Second).Format("2006-01-02")),
+		GeneratedAt: time.Now().In(loc),
+	}
+	for _, section := range sections {
+		table, err := s.collectReportSection(section, run.StartDate, run.EndDate, loc)
+		if err != nil {
+			return nil, fmt.Errorf("区块 %s: %w", section.Title, err)
+		}
+		report.Tables = append(report.Tables, *table)
+	}
+
+	var artifacts []ReportArtifact
+	for _, format := range def.FormatList() {
+		var data []byte
+		switch format {
+		case ReportFormatCSV:
+			data, err = RenderReportCSV(report)
+		case ReportFormatXLSX:
+			data, err = RenderReportXLSX(report)
+		case ReportFormatPDF:
+			data, err = RenderReportPDF(report, s.reportFont)
+		}
+		if err != nil {
+			return nil, err
+		}
+		key := reportArtifactKey(def.ID, run.ID, format)
+		if _, err := s.reportStorage.SaveFile(context.Background(), key, data, reportContentTypes[format]); err != nil {
+			return nil, fmt.Errorf("保存报表文件失败: %w", err)
+		}
+		artifacts = append(artifacts, ReportArtifact{
+			Format: format,
+			Key:    key,
+			Size:   len(data),
+			URL:    fmt.Sprintf("/api/v1/statistics/enhanced/reports/runs/%d/artifacts/%s", run.ID, format),
+		})
+	}
+	return artifacts, nil
+}
+
+// collectReportSection 查询区块数据，业务数据来自MySQL，实时指标来自时间序列汇总
+func (s *StatisticsEnhancedService) collectReportSection(section ReportSection, start, end time.Time, loc *time.Location) (*ReportTable, error) {
+	table := &ReportTable{Title: section.Title, Chart: section.Chart}
+	limit := section.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	if section.Source == ReportSourceMetric {
+		step := 24 * time.Hour
+		if section.Step != "" {
+			step, _ = ParseRollupStep(section.Step)
+		}
+		result, err := s.QueryRollups(RollupQuery{
+			MetricType: section.MetricType,
+			MetricName: section.MetricName,
+			Start:      start,
+			End:        end,
+			Step:       step,
+			GroupBy:    section.GroupBy,
+			Filters:    section.Filters,
+		})
+		if err != nil {
+			return nil, err
+		}
+		t := MetricSectionTable(section, result.Series, loc)
+		return &t, nil
+	}
+
+	if s.mysqlDB == nil {
+		return nil, fmt.Errorf("MySQL未连接")
+	}
+	switch section.Source {
+	case ReportSourceOverview:
+		var stats struct {
+			TotalUsers, NewUsers, ActiveUsers             int64
+			TotalTemplates, NewTemplates, TemplateUsage   int64
+			TotalCompanies, NewCompanies, ActiveCompanies int64
+		}
+		err := s.mysqlDB.Raw(`
+			SELECT
+				(SELECT COUNT(*) FROM users) as total_users,
+				(SELECT COUNT(*) FROM users WHERE created_at >= ? AND created_at < ?) as new_users,
+				(SELECT COUNT(*) FROM users WHERE status = 'active') as active_users,
+				(SELECT COUNT(*) FROM templates WHERE is_active = 1) as total_templates,
+				(SELECT COUNT(*) FROM templates WHERE is_active = 1 AND created_at >= ? AND created_at < ?) as new_templates,
+				(SELECT COALESCE(SUM(usage_count), 0) FROM templates WHERE is_active = 1) as template_usage,
+				(SELECT COUNT(*) FROM companies) as total_companies,
+				(SELECT COUNT(*) FROM companies WHERE created_at >= ? AND created_at < ?) as new_companies,
+				(SELECT COUNT(*) FROM companies WHERE status = 'active') as active_companies
+		`, start, end, start, end, start, end).Scan(&stats).Error
+		if err != nil {
+			return nil, fmt.Errorf("获取概览统计失败: %w", err)
+		}
+		table.Columns = []string{"指标", "数值"}
+		table.Rows = [][]interface{}{
+			{"用户总数", stats.TotalUsers}, {"期间新增用户", stats.NewUsers}, {"活跃用户", stats.ActiveUsers},
+			{"模板总数", stats.TotalTemplates}, {"期间新增模板", stats.NewTemplates}, {"模板累计使用", stats.TemplateUsage},
+			{"企业总数", stats.TotalCompanies}, {"期间新增企业", stats.NewCompanies}, {"活跃企业", stats.ActiveCompanies},
+		}
+
+	case ReportSourceUsersTrend:
+		var trends []UserTrend
+		if err := s.mysqlDB.Raw(`
+			SELECT DATE(created_at) as date, COUNT(*) as count
+			FROM users
+			WHERE created_at >= ? AND created_at < ?
+			GROUP BY DATE(created_at)
+			ORDER BY date
+		`, start, end).Scan(&trends).Error; err != nil {
+			return nil, fmt.Errorf("获取用户增长趋势失败: %w", err)
+		}
+		table.Columns = []string{"日期", "新增用户"}
+		counts := make(map[string]int, len(trends))
+		for _, t := range trends {
+			counts[t.Date[:min(10, len(t.Date))]] = t.Count
+		}
+		// 补齐没有新增的日期，图表才能反映真实走势
+		for day := start.In(loc); day.Before(end); day = day.AddDate(0, 0, 1) {
+			key := day.Format("2006-01-02")
+			table.Rows = append(table.Rows, []interface{}{key, int64(counts[key])})
+		}
+
+	case ReportSourceTemplatesUsage:
+		var usage []TemplateUsage
+		if err := s.mysqlDB.Raw(`
+			SELECT id, name, category, usage_count, rating, created_at
+			FROM templates
+			WHERE is_active = 1
+			ORDER BY usage_count DESC
+			LIMIT ?
+		`, limit).Scan(&usage).Error; err != nil {
+			return nil, fmt.Errorf("获取模板使用统计失败: %w", err)
+		}
+		table.Columns = []string{"模板", "分类", "使用次数", "评分"}
+		for _, u := range usage {
+			table.Rows = append(table.Rows, []interface{}{u.Name, u.Category, int64(u.UsageCount), u.Rating})
+		}
+
+	case ReportSourceUsersDetailed:
+		var users []DetailedUserStats
+		if err := s.mysqlDB.Raw(`
+			SELECT
+				u.id, u.username, u.email, u.created_at, u.status,
+				COUNT(t.id) as template_count,
+				COALESCE(SUM(t.usage_count), 0) as total_usage,
+				COALESCE(AVG(t.rating), 0) as avg_rating
+			FROM users u
+			LEFT JOIN templates t ON u.id = t.created_by
+			WHERE u.created_at >= ? AND u.created_at < ?
+			GROUP BY u.id, u.username, u.email, u.created_at, u.status
+			ORDER BY u.created_at DESC
+			LIMIT ?
+		`, start, end, limit).Scan(&users).Error; err != nil {
+			return nil, fmt.Errorf("获取用户明细失败: %w", err)
+		}
+		table.Columns = []string{"用户名", "邮箱", "注册时间", "状态", "模板数", "模板使用", "平均评分"}
+		for _, u := range users {
+			table.Rows = append(table.Rows, []interface{}{u.Username, u.Email, u.CreatedAt.In(loc), u.Status,
+				int64(u.TemplateCount), int64(u.TotalUsage), u.AvgRating})
+		}
+	}
+	return table, nil
+}
+
+// deliverReport 通过通知服务告知接收人报表已生成
+func (s *StatisticsEnhancedService) deliverReport(def *ReportDefinition, run *ReportRun, artifacts []ReportArtifact) error {
+	recipients := def.RecipientList()
+	if len(recipients) == 0 {
+		return nil
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"recipients":  recipients,
+		"report_id":   def.ID,
+		"report_name": def.Name,
+		"run_id":      run.ID,
+		"period":      fmt.Sprintf("%s ~ %s", run.StartDate.Format("2006-01-02"), run.EndDate.Add(-time.Second).Format("2006-01-02")),
+		"artifacts":   artifacts,
+	})
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(s.notificationURL+"/api/v1/events/report-generated", "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("调用通知服务失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("通知服务返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// StartReportScheduler 启动定时报表生成，Close时停止
+func (s *StatisticsEnhancedService) StartReportScheduler(interval time.Duration) {
+	if s.postgresDB == nil {
+		log.Println("PostgreSQL未连接，跳过定时报表任务")
+		return
+	}
+	s.stopReports = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.runDueReports(time.Now())
+			case <-s.stopReports:
+				return
+			}
+		}
+	}()
+}
+
+// runDueReports 生成到期的报表；先以条件更新抢占NextRunAt，避免多实例重复生成
+func (s *StatisticsEnhancedService) runDueReports(now time.Time) {
+	var due []ReportDefinition
+	if err := s.postgresDB.Where("enabled = ? AND next_run_at IS NOT NULL AND next_run_at <= ?", true, now).
+		Find(&due).Error; err != nil {
+		log.Printf("获取到期报表失败: %v", err)
+		return
+	}
+	for i := range due {
+		def := &due[i]
+		previous := *def.NextRunAt
+		if err := s.scheduleNextReportRun(def, now); err != nil {
+			log.Printf("报表 %d 生成计划无效: %v", def.ID, err)
+			continue
+		}
+		result := s.postgresDB.Model(&ReportDefinition{}).
+			Where("id = ? AND next_run_at = ?", def.ID, previous).
+			Update("next_run_at", def.NextRunAt)
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue // 已被其他实例处理
+		}
+		if _, err := s.RunReport(def.ID, "schedule"); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("定时生成报表 %d 失败: %v", def.ID, err)
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/xuri/excelize/v2"
+)
+
+// 报表导出格式
+const (
+	ReportFormatCSV  = "csv"
+	ReportFormatXLSX = "xlsx"
+	ReportFormatPDF  = "pdf"
+)
+
+// reportContentTypes 各导出格式的MIME类型
+var reportContentTypes = map[string]string{
+	ReportFormatCSV:  "text/csv; charset=utf-8",
+	ReportFormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	ReportFormatPDF:  "application/pdf",
+}
+
+// 报表图表类型
+const (
+	ReportChartBar  = "bar"
+	ReportChartLine = "line"
+)
+
+// ReportTable 报表中的一个数据表，第一列为分类（图表横轴），数值列作为图表系列
+type ReportTable struct {
+	Title   string
+	Columns []string
+	Rows    [][]interface{}
+	Chart   string // bar, line，为空不生成图表
+}
+
+// RenderedReport 待导出的报表内容
+type RenderedReport struct {
+	Name        string
+	Period      string
+	GeneratedAt time.Time
+	Tables      []ReportTable
+}
+
+// numericColumns 返回除第一列外所有值均为数值的列下标
+func (t ReportTable) numericColumns() []int {
+	var cols []int
+	for c := 1; c < len(t.Columns); c++ {
+		numeric := len(t.Rows) > 0
+		for _, row := range t.Rows {
+			if _, ok := toFloat(cellAt(row, c)); !ok {
+				numeric = false
+				break
+			}
+		}
+		if numeric {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+func cellAt(row []interface{}, c int) interface{} {
+	if c < len(row) {
+		return row[c]
+	}
+	return nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// formatReportCell 将单元格格式化为文本
+func formatReportCell(v interface{}) string {
+	switch n := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return n
+	case float64:
+		if n == math.Trunc(n) && math.Abs(n) < 1e15 {
+			return strconv.FormatInt(int64(n), 10)
+		}
+		return strconv.FormatFloat(n, 'f', 2, 64)
+	case time.Time:
+		if n.Hour() == 0 && n.Minute() == 0 && n.Second() == 0 {
+			return n.Format("2006-01-02")
+		}
+		return n.Format("2006-01-02 15:04")
+	}
+	return fmt.Sprint(v)
+}
+
+// RenderReportCSV 导出CSV，各数据表依次排列并以标题行分隔；带UTF-8 BOM以便Excel正确识别中文
+func RenderReportCSV(report *RenderedReport) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("\ufeff")
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{report.Name})
+	_ = w.Write([]string{"统计周期", report.Period})
+	_ = w.Write([]string{"生成时间", report.GeneratedAt.Format("2006-01-02 15:04:05")})
+	for _, table := range report.Tables {
+		_ = w.Write(nil)
+		_ = w.Write([]string{table.Title})
+		_ = w.Write(table.Columns)
+		for _, row := range table.Rows {
+			record := make([]string, len(table.Columns))
+			for c := range record {
+				record[c] = formatReportCell(cellAt(row, c))
+			}
+			_ = w.Write(record)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("生成CSV失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderReportXLSX 导出XLSX：概要工作表加每个数据表一个工作表，需要时附带原生图表
+func RenderReportXLSX(report *RenderedReport) ([]byte, error) {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	summary := "概要"
+	if err := f.SetSheetName("Sheet1", summary); err != nil {
+		return nil, err
+	}
+	_ = f.SetCellValue(summary, "A1", report.Name)
+	_ = f.SetCellValue(summary, "A2", "统计周期")
+	_ = f.SetCellValue(summary, "B2", report.Period)
+	_ = f.SetCellValue(summary, "A3", "生成时间")
+	_ = f.SetCellValue(summary, "B3", report.GeneratedAt.Format("2006-01-02 15:04:05"))
+	_ = f.SetColWidth(summary, "A", "B", 24)
+
+	used := map[string]bool{summary: true}
+	for i, table := range report.Tables {
+		sheet := xlsxSheetName(table.Title, i, used)
+		if _, err := f.NewSheet(sheet); err != nil {
+			return nil, err
+		}
+		_ = f.SetCellValue(summary, fmt.Sprintf("A%d", 5+i), sheet)
+		_ = f.SetCellValue(summary, fmt.Sprintf("B%d", 5+i), fmt.Sprintf("%d 行", len(table.Rows)))
+
+		header := make([]interface{}, len(table.Columns))
+		for c, name := range table.Columns {
+			header[c] = name
+		}
+		if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
+			return nil, err
+		}
+		for r, row := range table.Rows {
+			values := make([]interface{}, len(table.Columns))
+			for c := range values {
+				v := cellAt(row, c)
+				if t, ok := v.(time.Time); ok {
+					v = formatReportCell(t)
+				}
+				values[c] = v
+			}
+			cell, _ := excelize.CoordinatesToCellName(1, r+2)
+			if err := f.SetSheetRow(sheet, cell, &values); err != nil {
+				return nil, err
+			}
+		}
+		lastCol, _ := excelize.ColumnNumberToName(len(table.Columns))
+		_ = f.SetColWidth(sheet, "A", lastCol, 16)
+
+		if err := addXLSXChart(f, sheet, table); err != nil {
+			return nil, err
+		}
+	}
+
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, fmt.Errorf("生成XLSX失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// xlsxSheetName 生成合法且唯一的工作表名（最长31个字符，不含 []:*?/\）
+func xlsxSheetName(title string, index int, used map[string]bool) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, title)
+	if name == "" {
+		name = fmt.Sprintf("数据%d", index+1)
+	}
+	if utf8.RuneCountInString(name) > 28 {
+		name = string([]rune(name)[:28])
+	}
+	base := name
+	for n := 2; used[name]; n++ {
+		name = fmt.Sprintf("%s_%d", base, n)
+	}
+	used[name] = true
+	return name
+}
+
+// addXLSXChart 在数据表右侧插入柱状图或折线图，首列为分类轴
+func addXLSXChart(f *excelize.File, sheet string, table ReportTable) error {
+	cols := table.numericColumns()
+	if table.Chart == "" || len(cols) == 0 {
+		return nil
+	}
+	chartType := excelize.Col
+	if table.Chart == ReportChartLine {
+		chartType = excelize.Line
+	}
+
+	lastRow := len(table.Rows) + 1
+	chart := &excelize.Chart{
+		Type:   chartType,
+		Title:  []excelize.RichTextRun{{Text: table.Title}},
+		Legend: excelize.ChartLegend{Position: "bottom"},
+		Format: excelize.GraphicOptions{OffsetX: 10, OffsetY: 10},
+	}
+	for _, c := range cols {
+		col, _ := excelize.ColumnNumberToName(c + 1)
+		chart.Series = append(chart.Series, excelize.ChartSeries{
+			Name:       fmt.Sprintf("'%s'!$%s$1", sheet, col),
+			Categories: fmt.Sprintf("'%s'!$A$2:$A$%d", sheet, lastRow),
+			Values:     fmt.Sprintf("'%s'!$%s$2:$%s$%d", sheet, col, col, lastRow),
+		})
+	}
+	anchor, _ := excelize.CoordinatesToCellName(len(table.Columns)+2, 1)
+	if err := f.AddChart(sheet, anchor, chart); err != nil {
+		return fmt.Errorf("生成图表失败: %w", err)
+	}
+	return nil
+}
+
+// maxPDFTableRows PDF中每个数据表最多输出的行数，完整数据见CSV/XLSX
+const maxPDFTableRows = 200
+
+// pdfSeriesColors 图表系列颜色
+var pdfSeriesColors = [][3]int{{52, 114, 219}, {232, 126, 4}, {46, 160, 67}, {155, 89, 182}}
+
+// RenderReportPDF 导出PDF，图表以矢量图形绘制
+// fontFile为TrueType字体路径（中文内容需要CJK字体）；为空时使用内置字体，无法显示的字符替换为?
+func RenderReportPDF(report *RenderedReport, fontFile string) ([]byte, error) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetAutoPageBreak(true, 15)
+
+	family := "Helvetica"
+	text := latinText(pdf)
+	if fontFile != "" {
+		family = "report"
+		pdf.AddUTF8Font(family, "", fontFile)
+		text = func(s string) string { return s }
+	}
+
+	pdf.AddPage()
+	pageW, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	width := pageW - left - right
+
+	pdf.SetFont(family, "", 16)
+	pdf.CellFormat(width, 10, text(report.Name), "", 1, "L", false, 0, "")
+	pdf.SetFont(family, "", 9)
+	pdf.SetTextColor(100, 100, 100)
+	pdf.CellFormat(width, 5, text(report.Period+"  |  "+report.GeneratedAt.Format("2006-01-02 15:04")), "", 1, "L", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+
+	for _, table := range report.Tables {
+		pdf.Ln(6)
+		pdf.SetFont(family, "", 12)
+		pdf.CellFormat(width, 8, text(table.Title), "", 1, "L", false, 0, "")
+
+		if table.Chart != "" && len(table.numericColumns()) > 0 {
+			drawPDFChart(pdf, table, left, width, 60, family, text)
+		}
+		drawPDFTable(pdf, table, width, family, text)
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("生成PDF失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// latinText 内置字体只支持cp1252，其他字符替换为?
+func latinText(pdf *fpdf.Fpdf) func(string) string {
+	translate := pdf.UnicodeTranslatorFromDescriptor("")
+	return func(s string) string {
+		return translate(strings.Map(func(r rune) rune {
+			if r > 0xFF {
+				return '?'
+			}
+			return r
+		}, s))
+	}
+}
+
+func drawPDFChart(pdf *fpdf.Fpdf, table ReportTable, x, width, height float64, family string, text func(string) string) {
+	cols := table.numericColumns()
+	if len(cols) > len(pdfSeriesColors) {
+		cols = cols[:len(pdfSeriesColors)]
+	}
+	rows := table.Rows
+	if len(rows) > 60 {
+		rows = rows[len(rows)-60:] // 只绘制最近的60个点
+	}
+
+	maxV, minV := 0.0, 0.0
+	for _, row := range rows {
+		for _, c := range cols {
+			v, _ := toFloat(cellAt(row, c))
+			maxV = math.Max(maxV, v)
+			minV = math.Min(minV, v)
+		}
+	}
+	if maxV == minV {
+		maxV = minV + 1
+	}
+
+	if pdf.GetY()+height+12 > 282 {
+		pdf.AddPage()
+	}
+	top := pdf.GetY() + 2
+	plotLeft := x + 14
+	plotW := width - 14
+	scale := func(v float64) float64 { return top + height - (v-minV)/(maxV-minV)*height }
+
+	pdf.SetFont(family, "", 7)
+	pdf.SetDrawColor(180, 180, 180)
+	pdf.SetLineWidth(0.1)
+	for i := 0; i <= 4; i++ {
+		v := minV + (maxV-minV)*float64(i)/4
+		y := scale(v)
+		pdf.Line(plotLeft, y, plotLeft+plotW, y)
+		pdf.Text(x, y+1, formatReportCell(math.Round(v*100)/100))
+	}
+
+	n := len(rows)
+	slot := plotW / float64(max(n, 1))
+	for si, c := range cols {
+		color := pdfSeriesColors[si]
+		pdf.SetFillColor(color[0], color[1], color[2])
+		pdf.SetDrawColor(color[0], color[1], color[2])
+		if table.Chart == ReportChartLine {
+			pdf.SetLineWidth(0.5)
+			for i := 1; i < n; i++ {
+				v0, _ := toFloat(cellAt(rows[i-1], c))
+				v1, _ := toFloat(cellAt(rows[i], c))
+				pdf.Line(plotLeft+slot*(float64(i-1)+0.5), scale(v0), plotLeft+slot*(float64(i)+0.5), scale(v1))
+			}
+		} else {
+			barW := slot * 0.8 / float64(len(cols))
+			for i, row := range rows {
+				v, _ := toFloat(cellAt(row, c))
+				bx := plotLeft + slot*float64(i) + slot*0.1 + barW*float64(si)
+				y0, y1 := scale(0), scale(v)
+				pdf.Rect(bx, math.Min(y0, y1), barW, math.Abs(y0-y1), "F")
+			}
+		}
+	}
+
+	// 横轴标签：最多显示约8个
+	pdf.SetTextColor(80, 80, 80)
+	every := max(1, n/8)
+	for i := 0; i < n; i += every {
+		pdf.Text(plotLeft+slot*float64(i), top+height+4, text(truncateRunes(formatReportCell(cellAt(rows[i], 0)), 12)))
+	}
+	// 图例
+	lx := plotLeft
+	for si, c := range cols {
+		color := pdfSeriesColors[si]
+		pdf.SetFillColor(color[0], color[1], color[2])
+		pdf.Rect(lx, top+height+6, 3, 3, "F")
+		label := text(table.Columns[c])
+		pdf.Text(lx+4, top+height+8.5, label)
+		lx += 8 + pdf.GetStringWidth(label)
+	}
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetDrawColor(0, 0, 0)
+	pdf.SetY(top + height + 12)
+}
+
+func drawPDFTable(pdf *fpdf.Fpdf, table ReportTable, width float64, family string, text func(string) string) {
+	if len(table.Columns) == 0 {
+		return
+	}
+	colW := width / float64(len(table.Columns))
+	fit := func(s string) string {
+		for pdf.GetStringWidth(s) > colW-2 && utf8.RuneCountInString(s) > 1 {
+			s = string([]rune(s)[:utf8.RuneCountInString(s)-1])
+		}
+		return s
+	}
+
+	pdf.SetFont(family, "", 8)
+	pdf.SetFillColor(235, 240, 248)
+	for _, name := range table.Columns {
+		pdf.CellFormat(colW, 6, fit(text(name)), "1", 0, "C", true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	rows := table.Rows
+	if len(rows) > maxPDFTableRows {
+		rows = rows[:maxPDFTableRows]
+	}
+	for _, row := range rows {
+		for c := range table.Columns {
+			v := cellAt(row, c)
+			align := "L"
+			if _, ok := toFloat(v); ok {
+				align = "R"
+			}
+			pdf.CellFormat(colW, 5.5, fit(text(formatReportCell(v))), "1", 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	if len(table.Rows) > maxPDFTableRows {
+		pdf.SetFont(family, "", 7)
+		pdf.CellFormat(width, 5, text(fmt.Sprintf("... %d rows total, see CSV/XLSX for full data", len(table.Rows))), "", 1, "L", false, 0, "")
+	}
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
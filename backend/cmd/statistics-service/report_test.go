@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+	"resume-centre/common/storage"
+)
+
+func sampleReport() *RenderedReport {
+	return &RenderedReport{
+		Name:        "运营周报",
+		Period:      "2024-03-04 ~ 2024-03-10",
+		GeneratedAt: time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC),
+		Tables: []ReportTable{
+			{
+				Title:   "用户增长",
+				Columns: []string{"日期", "新增用户"},
+				Rows: [][]interface{}{
+					{"2024-03-04", int64(12)},
+					{"2024-03-05", int64(30)},
+					{"2024-03-06", int64(18)},
+				},
+				Chart: ReportChartLine,
+			},
+			{
+				Title:   "模板使用/排行",
+				Columns: []string{"模板", "分类", "使用次数"},
+				Rows: [][]interface{}{
+					{"简历A", "技术", int64(120)},
+					{"简历B", "设计", int64(80)},
+				},
+				Chart: ReportChartBar,
+			},
+		},
+	}
+}
+
+// TestResolveReportRange 相对时间范围按报表时区解析
+func TestResolveReportRange(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Shanghai")
+	// 2024-03-13 是周三
+	now := time.Date(2024, 3, 13, 10, 30, 0, 0, loc)
+	cases := []struct {
+		spec       string
+		start, end time.Time
+	}{
+		{"last_7d", time.Date(2024, 3, 6, 0, 0, 0, 0, loc), time.Date(2024, 3, 13, 0, 0, 0, 0, loc)},
+		{"previous_week", time.Date(2024, 3, 4, 0, 0, 0, 0, loc), time.Date(2024, 3, 11, 0, 0, 0, 0, loc)},
+		{"previous_month", time.Date(2024, 2, 1, 0, 0, 0, 0, loc), time.Date(2024, 3, 1, 0, 0, 0, 0, loc)},
+		{"month_to_date", time.Date(2024, 3, 1, 0, 0, 0, 0, loc), now},
+	}
+	for _, tc := range cases {
+		start, end, err := ResolveReportRange(tc.spec, now, loc)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.spec, err)
+		}
+		if !start.Equal(tc.start) || !end.Equal(tc.end) {
+			t.Errorf("%s: got [%s, %s), want [%s, %s)", tc.spec, start, end, tc.start, tc.end)
+		}
+	}
+
+	// 周一的上周范围不包含当天
+	monday := time.Date(2024, 3, 11, 8, 0, 0, 0, loc)
+	start, end, _ := ResolveReportRange("previous_week", monday, loc)
+	if !start.Equal(time.Date(2024, 3, 4, 0, 0, 0, 0, loc)) || !end.Equal(time.Date(2024, 3, 11, 0, 0, 0, 0, loc)) {
+		t.Errorf("previous_week on monday: got [%s, %s)", start, end)
+	}
+
+	for _, spec := range []string{"", "last_0d", "last_xd", "yesterday"} {
+		if _, _, err := ResolveReportRange(spec, now, loc); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+// TestNextReportRun 生成计划按时区计算下一次时间，恰好到点时顺延
+func TestNextReportRun(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Shanghai")
+	after := time.Date(2024, 3, 13, 10, 30, 0, 0, loc) // 周三
+	cases := []struct {
+		schedule string
+		want     time.Time
+	}{
+		{"daily 08:00", time.Date(2024, 3, 14, 8, 0, 0, 0, loc)},
+		{"daily 11:00", time.Date(2024, 3, 13, 11, 0, 0, 0, loc)},
+		{"weekly mon 09:00", time.Date(2024, 3, 18, 9, 0, 0, 0, loc)},
+		{"weekly wed 10:30", time.Date(2024, 3, 20, 10, 30, 0, 0, loc)},
+		{"weekly wed 12:00", time.Date(2024, 3, 13, 12, 0, 0, 0, loc)},
+		{"monthly 1 09:00", time.Date(2024, 4, 1, 9, 0, 0, 0, loc)},
+		{"monthly 20 09:00", time.Date(2024, 3, 20, 9, 0, 0, 0, loc)},
+	}
+	for _, tc := range cases {
+		got, err := NextReportRun(tc.schedule, after, loc)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.schedule, err)
+		}
+		if !got.Equal(tc.want) {
+			t.Errorf("%s: got %s, want %s", tc.schedule, got, tc.want)
+		}
+	}
+
+	// 12月的月报跨年
+	dec := time.Date(2024, 12, 15, 0, 0, 0, 0, loc)
+	if got, _ := NextReportRun("monthly 1 09:00", dec, loc); !got.Equal(time.Date(2025, 1, 1, 9, 0, 0, 0, loc)) {
+		t.Errorf("monthly across year: got %s", got)
+	}
+
+	if got, err := NextReportRun("", after, loc); err != nil || !got.IsZero() {
+		t.Errorf("empty schedule: got %s, %v", got, err)
+	}
+	for _, schedule := range []string{"hourly", "daily 25:00", "weekly funday 09:00", "monthly 31 09:00"} {
+		if _, err := NextReportRun(schedule, after, loc); err == nil {
+			t.Errorf("%q: expected error", schedule)
+		}
+	}
+}
+
+// TestReportDefinitionValidate 校验区块来源、聚合方式和导出格式，并补全默认值
+func TestReportDefinitionValidate(t *testing.T) {
+	def := &ReportDefinition{
+		Name:     "周报",
+		Sections: `[{"source":"users_trend","chart":"line"},{"source":"metric","metric_type":"user_activity","metric_name":"login","aggregate":"p95","step":"1d"}]`,
+		Schedule: "weekly mon 09:00",
+	}
+	if err := def.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if def.Formats != ReportFormatXLSX || def.TimeRange != "last_7d" || def.Recipients != "[]" {
+		t.Errorf("defaults not applied: %+v", def)
+	}
+
+	invalid := []ReportDefinition{
+		{Name: "", Sections: `[{"source":"overview"}]`},
+		{Name: "x", Sections: `[]`},
+		{Name: "x", Sections: `[{"source":"unknown"}]`},
+		{Name: "x", Sections: `[{"source":"metric","metric_type":"a"}]`},
+		{Name: "x", Sections: `[{"source":"metric","metric_type":"a","metric_name":"b","aggregate":"median"}]`},
+		{Name: "x", Sections: `[{"source":"overview","chart":"pie"}]`},
+		{Name: "x", Sections: `[{"source":"overview"}]`, Formats: "csv,docx"},
+		{Name: "x", Sections: `[{"source":"overview"}]`, Timezone: "Mars/Olympus"},
+		{Name: "x", Sections: `[{"source":"overview"}]`, Schedule: "every monday"},
+	}
+	for i := range invalid {
+		if err := invalid[i].Validate(); err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+}
+
+// TestMetricSectionTable 每个分组一列，缺失的时间点补0
+func TestMetricSectionTable(t *testing.T) {
+	t0 := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(24 * time.Hour)
+	section := ReportSection{Source: ReportSourceMetric, MetricName: "login", Aggregate: "count", GroupBy: []string{"platform"}}
+	series := []RollupSeries{
+		{Group: map[string]string{"platform": "ios"}, Points: []RollupPoint{{Timestamp: t1, Count: 3}}},
+		{Group: map[string]string{"platform": "web"}, Points: []RollupPoint{{Timestamp: t0, Count: 5}, {Timestamp: t1, Count: 7}}},
+	}
+	table := MetricSectionTable(section, series, time.UTC)
+
+	if strings.Join(table.Columns, "|") != "时间|platform=ios|platform=web" {
+		t.Fatalf("unexpected columns: %v", table.Columns)
+	}
+	if table.Title != "login" || len(table.Rows) != 2 {
+		t.Fatalf("unexpected table: %+v", table)
+	}
+	if table.Rows[0][1] != 0.0 || table.Rows[0][2] != 5.0 || table.Rows[1][1] != 3.0 || table.Rows[1][2] != 7.0 {
+		t.Errorf("unexpected rows: %v", table.Rows)
+	}
+}
+
+// TestRenderReportCSV CSV带BOM，各数据表按标题、表头、数据排列
+func TestRenderReportCSV(t *testing.T) {
+	data, err := RenderReportCSV(sampleReport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("\ufeff")) {
+		t.Fatal("missing UTF-8 BOM")
+	}
+
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, rec := range records {
+		lines = append(lines, strings.Join(rec, ","))
+	}
+	got := strings.Join(lines, "\n")
+	for _, want := range []string{
+		"运营周报",
+		"统计周期,2024-03-04 ~ 2024-03-10",
+		"用户增长\n日期,新增用户\n2024-03-04,12\n2024-03-05,30\n2024-03-06,18",
+		"模板使用/排行\n模板,分类,使用次数\n简历A,技术,120",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("csv missing %q in:\n%s", want, got)
+		}
+	}
+}
+
+// TestRenderReportXLSX 每个数据表一个工作表，数值以数字写入，图表嵌入工作表
+func TestRenderReportXLSX(t *testing.T) {
+	data, err := RenderReportXLSX(sampleReport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	sheets := f.GetSheetList()
+	if strings.Join(sheets, "|") != "概要|用户增长|模板使用_排行" {
+		t.Fatalf("unexpected sheets: %v", sheets)
+	}
+	if v, _ := f.GetCellValue("概要", "B2"); v != "2024-03-04 ~ 2024-03-10" {
+		t.Errorf("summary period = %q", v)
+	}
+	if v, _ := f.GetCellValue("用户增长", "B3"); v != "30" {
+		t.Errorf("B3 = %q, want 30", v)
+	}
+	if typ, _ := f.GetCellType("用户增长", "B3"); typ != excelize.CellTypeNumber && typ != excelize.CellTypeUnset {
+		t.Errorf("B3 should be numeric, got type %v", typ)
+	}
+	if v, _ := f.GetCellValue("模板使用_排行", "A2"); v != "简历A" {
+		t.Errorf("A2 = %q", v)
+	}
+
+	// 图表存放在 xl/charts 下
+	var charts int
+	f.Pkg.Range(func(key, _ interface{}) bool {
+		if strings.HasPrefix(key.(string), "xl/charts/chart") {
+			charts++
+		}
+		return true
+	})
+	if charts != 2 {
+		t.Errorf("expected 2 charts, got %d", charts)
+	}
+}
+
+// TestRenderReportPDF 未配置字体时中文替换为占位符，仍能生成有效PDF
+func TestRenderReportPDF(t *testing.T) {
+	data, err := RenderReportPDF(sampleReport(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		t.Fatalf("not a PDF: %q", data[:min(16, len(data))])
+	}
+	if !bytes.Contains(data, []byte("%%EOF")) {
+		t.Error("PDF is truncated")
+	}
+
+	if _, err := RenderReportPDF(sampleReport(), "/nonexistent/font.ttf"); err == nil {
+		t.Error("expected error for missing font file")
+	}
+}
+
+func TestReportArtifactStorage(t *testing.T) {
+	t.Setenv("STATISTICS_REPORT_DIR", t.TempDir())
+	service := &StatisticsEnhancedService{reportStorage: storage.NewStorageManager(reportStorageConfig())}
+
+	data, err := RenderReportCSV(sampleReport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := reportArtifactKey(3, 42, ReportFormatCSV)
+	if key != "3/42.csv" {
+		t.Fatalf("unexpected key %q", key)
+	}
+	if _, err := service.reportStorage.SaveFile(context.Background(), key, data, reportContentTypes[ReportFormatCSV]); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := service.OpenReportArtifact(&ReportArtifact{Format: ReportFormatCSV, Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	stored, _ := io.ReadAll(reader)
+	if !bytes.Equal(stored, data) {
+		t.Error("stored artifact differs from rendered report")
+	}
+
+	if _, err := service.reportStorage.SaveFile(context.Background(), "../42.csv", data, ""); err == nil {
+		t.Error("expected error for key outside the storage root")
+	}
+	if _, err := service.reportStorage.SaveFile(context.Background(), "3/42.exe", data, ""); err == nil {
+		t.Error("expected error for disallowed extension")
+	}
+}
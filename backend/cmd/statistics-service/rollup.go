@@ -0,0 +1,422 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 汇总粒度
+const (
+	RollupMinute = "minute"
+	RollupHour   = "hour"
+	RollupDay    = "day"
+)
+
+// rollupResolutions 汇总粒度，由细到粗
+var rollupResolutions = []string{RollupMinute, RollupHour, RollupDay}
+
+// rollupStep 汇总粒度对应的时间跨度
+var rollupStep = map[string]time.Duration{
+	RollupMinute: time.Minute,
+	RollupHour:   time.Hour,
+	RollupDay:    24 * time.Hour,
+}
+
+// AnalyticsRollup 实时分析数据的时间分桶汇总，按指标和维度组合聚合
+type AnalyticsRollup struct {
+	ID             uint      `json:"-" gorm:"primaryKey"`
+	MetricType     string    `json:"metric_type" gorm:"size:50;not null;uniqueIndex:idx_rollup_bucket,priority:1"`
+	MetricName     string    `json:"metric_name" gorm:"size:100;not null;uniqueIndex:idx_rollup_bucket,priority:2"`
+	Resolution     string    `json:"resolution" gorm:"size:10;not null;uniqueIndex:idx_rollup_bucket,priority:3"`
+	DimensionsHash string    `json:"-" gorm:"size:40;not null;uniqueIndex:idx_rollup_bucket,priority:4"`
+	BucketStart    time.Time `json:"bucket_start" gorm:"not null;uniqueIndex:idx_rollup_bucket,priority:5;index"`
+	Dimensions     string    `json:"dimensions" gorm:"type:json"` // 规范化（键排序）后的维度
+	Count          int64     `json:"count"`
+	Sum            float64   `json:"sum"`
+	Min            float64   `json:"min"`
+	Max            float64   `json:"max"`
+	Avg            float64   `json:"avg"`
+	P50            float64   `json:"p50"`
+	P90            float64   `json:"p90"`
+	P95            float64   `json:"p95"`
+	P99            float64   `json:"p99"`
+	CreatedAt      time.Time `json:"-"`
+	UpdatedAt      time.Time `json:"-"`
+}
+
+// AnalyticsRollupState 各粒度汇总进度，Watermark之前的桶已汇总完成
+type AnalyticsRollupState struct {
+	Resolution string    `json:"resolution" gorm:"primaryKey;size:10"`
+	Watermark  time.Time `json:"watermark"`
+	LastRunAt  time.Time `json:"last_run_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// RollupRetention 分级保留策略，0表示永久保留
+type RollupRetention struct {
+	Raw    time.Duration
+	Minute time.Duration
+	Hour   time.Duration
+	Day    time.Duration
+}
+
+// DefaultRollupRetention 默认保留策略：原始数据和分钟汇总7天，小时汇总90天，天汇总永久
+func DefaultRollupRetention() RollupRetention {
+	return RollupRetention{
+		Raw:    7 * 24 * time.Hour,
+		Minute: 7 * 24 * time.Hour,
+		Hour:   90 * 24 * time.Hour,
+	}
+}
+
+// For 返回指定粒度的保留时长
+func (r RollupRetention) For(resolution string) time.Duration {
+	switch resolution {
+	case RollupMinute:
+		return r.Minute
+	case RollupHour:
+		return r.Hour
+	case RollupDay:
+		return r.Day
+	}
+	return r.Raw
+}
+
+// canonicalDimensions 将维度JSON规范化（键排序），返回规范化文本及其哈希
+func canonicalDimensions(raw string) (string, string) {
+	dims := map[string]interface{}{}
+	if raw != "" && raw != "null" {
+		if err := json.Unmarshal([]byte(raw), &dims); err != nil {
+			dims = map[string]interface{}{}
+		}
+	}
+	canonical, _ := json.Marshal(dims) // map按键排序输出
+	sum := sha1.Sum(canonical)
+	return string(canonical), hex.EncodeToString(sum[:])
+}
+
+// truncateBucket 将时间截断到所在桶的起点（UTC）
+func truncateBucket(t time.Time, step time.Duration) time.Time {
+	return t.UTC().Truncate(step)
+}
+
+// percentile 对已排序数据按线性插值计算分位数
+func percentile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	pos := q * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(pos-float64(lower))
+}
+
+// BuildRollups 按（指标, 维度组合, 时间桶）聚合原始数据
+func BuildRollups(rows []RealTimeAnalytics, resolution string) []AnalyticsRollup {
+	step := rollupStep[resolution]
+	type bucketKey struct {
+		metricType, metricName, hash string
+		start                        time.Time
+	}
+	values := make(map[bucketKey][]float64)
+	dimensions := make(map[string]string)
+	var keys []bucketKey
+	for _, row := range rows {
+		canonical, hash := canonicalDimensions(row.Dimensions)
+		dimensions[hash] = canonical
+		key := bucketKey{row.MetricType, row.MetricName, hash, truncateBucket(row.Timestamp, step)}
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = append(values[key], row.MetricValue)
+	}
+
+	rollups := make([]AnalyticsRollup, 0, len(keys))
+	for _, key := range keys {
+		vs := values[key]
+		sort.Float64s(vs)
+		var sum float64
+		for _, v := range vs {
+			sum += v
+		}
+		rollups = append(rollups, AnalyticsRollup{
+			MetricType:     key.metricType,
+			MetricName:     key.metricName,
+			Resolution:     resolution,
+			DimensionsHash: key.hash,
+			BucketStart:    key.start,
+			Dimensions:     dimensions[key.hash],
+			Count:          int64(len(vs)),
+			Sum:            sum,
+			Min:            vs[0],
+			Max:            vs[len(vs)-1],
+			Avg:            sum / float64(len(vs)),
+			P50:            percentile(vs, 0.50),
+			P90:            percentile(vs, 0.90),
+			P95:            percentile(vs, 0.95),
+			P99:            percentile(vs, 0.99),
+		})
+	}
+	sort.SliceStable(rollups, func(i, j int) bool { return rollups[i].BucketStart.Before(rollups[j].BucketStart) })
+	return rollups
+}
+
+// HistorySources 读取历史窗口时各数据源覆盖的时间段：
+// [Start, HourStart) 读天汇总，[HourStart, RawStart) 读小时汇总，RawStart之后读原始数据
+type HistorySources struct {
+	Start     time.Time
+	HourStart time.Time
+	RawStart  time.Time
+}
+
+// PlanHistorySources 按保留策略和小时汇总进度划分数据源。原始数据只在保留期内且小时汇总已完成的部分之前才被清理，
+// 因此原始数据的起点取保留期起点（向上取整到小时）与小时汇总水位线中较早者；小时汇总超出保留期的部分改读天汇总
+func PlanHistorySources(start, now, hourWatermark time.Time, retention RollupRetention) HistorySources {
+	plan := HistorySources{Start: start, HourStart: start, RawStart: start}
+	if retention.Raw == 0 || hourWatermark.IsZero() {
+		return plan
+	}
+	rawStart := truncateBucket(now.Add(-retention.Raw), time.Hour).Add(time.Hour)
+	if watermark := truncateBucket(hourWatermark, time.Hour); watermark.Before(rawStart) {
+		rawStart = watermark
+	}
+	if !rawStart.After(start) {
+		return plan
+	}
+	plan.RawStart = rawStart
+	if keep := retention.Hour; keep > 0 {
+		hourStart := truncateBucket(now.Add(-keep), 24*time.Hour).Add(24 * time.Hour)
+		if hourStart.After(rawStart) {
+			hourStart = truncateBucket(rawStart, 24*time.Hour)
+		}
+		if hourStart.After(start) {
+			plan.HourStart = hourStart
+		}
+	}
+	return plan
+}
+
+// HistoryPoint 历史数据点，来自原始数据或汇总桶
+type HistoryPoint struct {
+	MetricType string
+	MetricName string
+	SeriesPoint
+}
+
+// RollupHistoryPoints 将汇总桶按（指标, 桶起点）合并不同维度组合，以总和/总数作为该桶的值
+func RollupHistoryPoints(rollups []AnalyticsRollup) []HistoryPoint {
+	type pointKey struct {
+		metricType, metricName string
+		start                  time.Time
+	}
+	type accumulator struct {
+		sum   float64
+		count int64
+	}
+	buckets := make(map[pointKey]*accumulator)
+	var keys []pointKey
+	for _, r := range rollups {
+		key := pointKey{r.MetricType, r.MetricName, r.BucketStart}
+		acc, ok := buckets[key]
+		if !ok {
+			acc = &accumulator{}
+			buckets[key] = acc
+			keys = append(keys, key)
+		}
+		acc.sum += r.Sum
+		acc.count += r.Count
+	}
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].start.Before(keys[j].start) })
+
+	points := make([]HistoryPoint, 0, len(keys))
+	for _, key := range keys {
+		acc := buckets[key]
+		if acc.count == 0 {
+			continue
+		}
+		points = append(points, HistoryPoint{
+			MetricType:  key.metricType,
+			MetricName:  key.metricName,
+			SeriesPoint: SeriesPoint{Timestamp: key.start, Value: acc.sum / float64(acc.count)},
+		})
+	}
+	return points
+}
+
+// RollupQuery 汇总数据查询参数
+type RollupQuery struct {
+	MetricType string
+	MetricName string
+	Start      time.Time
+	End        time.Time
+	Step       time.Duration
+	GroupBy    []string          // 按这些维度分组，其余维度合并
+	Filters    map[string]string // 维度过滤条件
+}
+
+// RollupPoint 查询结果中的一个时间点
+type RollupPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Count     int64     `json:"count"`
+	Sum       float64   `json:"sum"`
+	Min       float64   `json:"min"`
+	Max       float64   `json:"max"`
+	Avg       float64   `json:"avg"`
+	P50       float64   `json:"p50"`
+	P90       float64   `json:"p90"`
+	P95       float64   `json:"p95"`
+	P99       float64   `json:"p99"`
+}
+
+// RollupSeries 按分组维度划分的时间序列
+type RollupSeries struct {
+	Group  map[string]string `json:"group"`
+	Points []RollupPoint     `json:"points"`
+}
+
+// RollupQueryResult 汇总查询结果
+type RollupQueryResult struct {
+	Resolution string         `json:"resolution"` // 实际读取的汇总粒度
+	Step       string         `json:"step"`
+	Series     []RollupSeries `json:"series"`
+	// Approximate 为true时分位数由多个桶按数量加权合并，仅为近似值
+	Approximate bool `json:"approximate"`
+}
+
+// ParseRollupStep 解析查询步长，支持Go时长格式以及d（天）后缀，最小1分钟
+func ParseRollupStep(s string) (time.Duration, error) {
+	var step time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("无效的步长: %s", s)
+		}
+		step = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("无效的步长: %s", s)
+		}
+		step = d
+	}
+	if step < time.Minute || step%time.Minute != 0 {
+		return 0, fmt.Errorf("步长必须是1分钟的整数倍: %s", s)
+	}
+	return step, nil
+}
+
+// ChooseRollupResolution 选择能整除步长且保留期覆盖查询起点的最粗粒度
+func ChooseRollupResolution(step time.Duration, start, now time.Time, retention RollupRetention) (string, error) {
+	for i := len(rollupResolutions) - 1; i >= 0; i-- {
+		resolution := rollupResolutions[i]
+		if step%rollupStep[resolution] != 0 {
+			continue
+		}
+		keep := retention.For(resolution)
+		if keep == 0 || !start.Before(now.Add(-keep)) {
+			return resolution, nil
+		}
+	}
+	return "", fmt.Errorf("步长 %s 的数据在 %s 之前已按保留策略清理，请使用更大的步长", step, start.Format(time.RFC3339))
+}
+
+// MergeRollups 将汇总桶按步长和分组维度合并为查询结果
+func MergeRollups(rollups []AnalyticsRollup, query RollupQuery) ([]RollupSeries, bool) {
+	type pointKey struct {
+		group string
+		start time.Time
+	}
+	type accumulator struct {
+		point   RollupPoint
+		buckets int
+	}
+	groups := make(map[string]map[string]string)
+	points := make(map[pointKey]*accumulator)
+	approximate := false
+
+	for _, r := range rollups {
+		dims := map[string]interface{}{}
+		_ = json.Unmarshal([]byte(r.Dimensions), &dims)
+		if !matchDimensionFilters(dims, query.Filters) {
+			continue
+		}
+
+		group := make(map[string]string, len(query.GroupBy))
+		for _, name := range query.GroupBy {
+			if v, ok := dims[name]; ok {
+				group[name] = fmt.Sprint(v)
+			} else {
+				group[name] = ""
+			}
+		}
+		groupJSON, _ := json.Marshal(group)
+		groups[string(groupJSON)] = group
+
+		key := pointKey{string(groupJSON), truncateBucket(r.BucketStart, query.Step)}
+		acc, ok := points[key]
+		if !ok {
+			acc = &accumulator{point: RollupPoint{Timestamp: key.start, Min: r.Min, Max: r.Max}}
+			points[key] = acc
+		}
+		p := &acc.point
+		w := float64(r.Count)
+		p.P50 += r.P50 * w
+		p.P90 += r.P90 * w
+		p.P95 += r.P95 * w
+		p.P99 += r.P99 * w
+		p.Count += r.Count
+		p.Sum += r.Sum
+		p.Min = math.Min(p.Min, r.Min)
+		p.Max = math.Max(p.Max, r.Max)
+		acc.buckets++
+		if acc.buckets > 1 {
+			approximate = true
+		}
+	}
+
+	byGroup := make(map[string][]RollupPoint)
+	for key, acc := range points {
+		p := acc.point
+		if p.Count > 0 {
+			n := float64(p.Count)
+			p.Avg = p.Sum / n
+			p.P50, p.P90, p.P95, p.P99 = p.P50/n, p.P90/n, p.P95/n, p.P99/n
+		}
+		byGroup[key.group] = append(byGroup[key.group], p)
+	}
+
+	groupKeys := make([]string, 0, len(byGroup))
+	for k := range byGroup {
+		groupKeys = append(groupKeys, k)
+	}
+	sort.Strings(groupKeys)
+
+	series := make([]RollupSeries, 0, len(groupKeys))
+	for _, k := range groupKeys {
+		ps := byGroup[k]
+		sort.Slice(ps, func(i, j int) bool { return ps[i].Timestamp.Before(ps[j].Timestamp) })
+		series = append(series, RollupSeries{Group: groups[k], Points: ps})
+	}
+	return series, approximate
+}
+
+// matchDimensionFilters 检查维度是否满足全部过滤条件
+func matchDimensionFilters(dims map[string]interface{}, filters map[string]string) bool {
+	for name, want := range filters {
+		v, ok := dims[name]
+		if !ok || fmt.Sprint(v) != want {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func rawRow(ts time.Time, value float64, dims string) RealTimeAnalytics {
+	return RealTimeAnalytics{MetricType: "user_activity", MetricName: "login", MetricValue: value, Dimensions: dims, Timestamp: ts}
+}
+
+// TestBuildRollupsAggregates 按分钟分桶，维度键顺序不同视为同一组合，统计量和分位数正确
+func TestBuildRollupsAggregates(t *testing.T) {
+	var rows []RealTimeAnalytics
+	for i := 1; i <= 100; i++ {
+		dims := `{"platform":"web","region":"cn"}`
+		if i%2 == 0 {
+			dims = `{"region":"cn","platform":"web"}`
+		}
+		rows = append(rows, rawRow(seriesStart.Add(time.Duration(i)*100*time.Millisecond), float64(i), dims))
+	}
+	rows = append(rows,
+		rawRow(seriesStart.Add(90*time.Second), 7, `{"platform":"web","region":"cn"}`),
+		rawRow(seriesStart.Add(2*time.Second), 3, `{"platform":"ios"}`),
+	)
+
+	rollups := BuildRollups(rows, RollupMinute)
+	if len(rollups) != 3 {
+		t.Fatalf("期望3个桶，实际 %d: %+v", len(rollups), rollups)
+	}
+
+	var web *AnalyticsRollup
+	for i := range rollups {
+		if rollups[i].BucketStart.Equal(seriesStart) && rollups[i].Dimensions == `{"platform":"web","region":"cn"}` {
+			web = &rollups[i]
+		}
+	}
+	if web == nil {
+		t.Fatalf("缺少web维度的第一分钟桶: %+v", rollups)
+	}
+	if web.Count != 100 || web.Sum != 5050 || web.Min != 1 || web.Max != 100 || web.Avg != 50.5 {
+		t.Errorf("统计量错误: %+v", web)
+	}
+	if math.Abs(web.P50-50.5) > 1e-9 || math.Abs(web.P90-90.1) > 1e-9 || math.Abs(web.P99-99.01) > 1e-9 {
+		t.Errorf("分位数错误: p50=%.2f p90=%.2f p99=%.2f", web.P50, web.P90, web.P99)
+	}
+	if web.Resolution != RollupMinute {
+		t.Errorf("粒度错误: %s", web.Resolution)
+	}
+
+	hourly := BuildRollups(rows, RollupHour)
+	if len(hourly) != 2 {
+		t.Errorf("小时粒度期望2个桶（按维度），实际 %d", len(hourly))
+	}
+}
+
+// TestMergeRollupsGroupBy 按步长合并桶，按指定维度分组并应用过滤
+func TestMergeRollupsGroupBy(t *testing.T) {
+	rows := []RealTimeAnalytics{
+		rawRow(seriesStart.Add(10*time.Minute), 10, `{"platform":"web","region":"cn"}`),
+		rawRow(seriesStart.Add(20*time.Minute), 30, `{"platform":"web","region":"us"}`),
+		rawRow(seriesStart.Add(70*time.Minute), 5, `{"platform":"web","region":"cn"}`),
+		rawRow(seriesStart.Add(15*time.Minute), 100, `{"platform":"ios","region":"cn"}`),
+	}
+	rollups := BuildRollups(rows, RollupMinute)
+
+	series, approximate := MergeRollups(rollups, RollupQuery{Step: time.Hour, GroupBy: []string{"platform"}})
+	if len(series) != 2 || !approximate {
+		t.Fatalf("期望2个分组且分位数为近似值，实际 %+v", series)
+	}
+	ios, web := series[0], series[1]
+	if ios.Group["platform"] != "ios" || web.Group["platform"] != "web" {
+		t.Fatalf("分组顺序或取值错误: %+v", series)
+	}
+	if len(web.Points) != 2 {
+		t.Fatalf("web应有2个小时点，实际 %+v", web.Points)
+	}
+	first := web.Points[0]
+	if !first.Timestamp.Equal(seriesStart) || first.Count != 2 || first.Sum != 40 || first.Min != 10 || first.Max != 30 || first.Avg != 20 {
+		t.Errorf("合并结果错误: %+v", first)
+	}
+
+	filtered, _ := MergeRollups(rollups, RollupQuery{Step: time.Hour, Filters: map[string]string{"region": "cn"}})
+	if len(filtered) != 1 || filtered[0].Points[0].Count != 2 || filtered[0].Points[1].Count != 1 {
+		t.Errorf("过滤结果错误: %+v", filtered)
+	}
+
+	exact, approximate := MergeRollups(rollups[:1], RollupQuery{Step: time.Minute})
+	if approximate || len(exact) != 1 {
+		t.Errorf("步长等于粒度时应为精确值: %+v", exact)
+	}
+}
+
+// TestChooseRollupResolution 选择能整除步长且未过保留期的最粗粒度
+func TestChooseRollupResolution(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	retention := DefaultRollupRetention()
+	cases := []struct {
+		step  time.Duration
+		start time.Time
+		want  string
+	}{
+		{5 * time.Minute, now.Add(-time.Hour), RollupMinute},
+		{time.Hour, now.AddDate(0, 0, -30), RollupHour},
+		{6 * time.Hour, now.AddDate(0, 0, -30), RollupHour},
+		{24 * time.Hour, now.AddDate(-2, 0, 0), RollupDay},
+		{24 * time.Hour, now.Add(-time.Hour), RollupDay},
+	}
+	for _, tc := range cases {
+		got, err := ChooseRollupResolution(tc.step, tc.start, now, retention)
+		if err != nil || got != tc.want {
+			t.Errorf("step=%s start=%s: 期望 %s，实际 %s (%v)", tc.step, tc.start, tc.want, got, err)
+		}
+	}
+
+	if _, err := ChooseRollupResolution(time.Hour, now.AddDate(0, 0, -120), now, retention); err == nil {
+		t.Error("小时数据已过保留期时应返回错误")
+	}
+	if _, err := ChooseRollupResolution(5*time.Minute, now.AddDate(0, 0, -10), now, retention); err == nil {
+		t.Error("分钟数据已过保留期时应返回错误")
+	}
+}
+
+// TestPlanHistorySources 原始数据保留期之前读小时汇总，超出小时汇总保留期读天汇总；汇总未完成的部分仍读原始数据
+func TestPlanHistorySources(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)
+	retention := DefaultRollupRetention()
+	watermark := now.Truncate(time.Hour)
+
+	plan := PlanHistorySources(now.AddDate(0, 0, -120), now, watermark, retention)
+	if want := time.Date(2025, 5, 25, 13, 0, 0, 0, time.UTC); !plan.RawStart.Equal(want) {
+		t.Errorf("原始数据起点期望 %s，实际 %s", want, plan.RawStart)
+	}
+	if want := time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC); !plan.HourStart.Equal(want) {
+		t.Errorf("小时汇总起点期望 %s，实际 %s", want, plan.HourStart)
+	}
+
+	// 回溯窗口在小时汇总保留期内时不读天汇总
+	plan = PlanHistorySources(now.AddDate(0, 0, -30), now, watermark, retention)
+	if !plan.HourStart.Equal(plan.Start) || !plan.RawStart.After(plan.Start) {
+		t.Errorf("30天窗口应读小时汇总和原始数据: %+v", plan)
+	}
+
+	// 小时汇总落后时，水位线之后的原始数据尚未清理，从水位线起读原始数据
+	lagging := now.AddDate(0, 0, -10).Truncate(time.Hour)
+	if plan := PlanHistorySources(now.AddDate(0, 0, -30), now, lagging, retention); !plan.RawStart.Equal(lagging) {
+		t.Errorf("原始数据起点应为汇总水位线 %s，实际 %s", lagging, plan.RawStart)
+	}
+
+	// 从未汇总或窗口在原始数据保留期内时只读原始数据
+	for _, plan := range []HistorySources{
+		PlanHistorySources(now.AddDate(0, 0, -30), now, time.Time{}, retention),
+		PlanHistorySources(now.AddDate(0, 0, -3), now, watermark, retention),
+	} {
+		if !plan.RawStart.Equal(plan.Start) || !plan.HourStart.Equal(plan.Start) {
+			t.Errorf("应只读原始数据: %+v", plan)
+		}
+	}
+}
+
+// TestRollupHistoryPoints 同一桶的不同维度组合按总和/总数合并为一个点
+func TestRollupHistoryPoints(t *testing.T) {
+	rows := []RealTimeAnalytics{
+		rawRow(seriesStart.Add(time.Hour+time.Minute), 10, `{"platform":"web"}`),
+		rawRow(seriesStart.Add(time.Hour+2*time.Minute), 20, `{"platform":"web"}`),
+		rawRow(seriesStart.Add(time.Hour+3*time.Minute), 60, `{"platform":"ios"}`),
+		rawRow(seriesStart.Add(time.Minute), 5, `{"platform":"ios"}`),
+	}
+	points := RollupHistoryPoints(BuildRollups(rows, RollupHour))
+	if len(points) != 2 {
+		t.Fatalf("期望2个点，实际 %+v", points)
+	}
+	if !points[0].Timestamp.Equal(seriesStart) || points[0].Value != 5 {
+		t.Errorf("第一个桶错误: %+v", points[0])
+	}
+	if !points[1].Timestamp.Equal(seriesStart.Add(time.Hour)) || points[1].Value != 30 || points[1].MetricName != "login" {
+		t.Errorf("合并维度后应为按数量加权的均值30: %+v", points[1])
+	}
+}
+
+// TestParseRollupStep 支持Go时长和天数后缀，拒绝小于1分钟的步长
+func TestParseRollupStep(t *testing.T) {
+	valid := map[string]time.Duration{"1m": time.Minute, "15m": 15 * time.Minute, "1h": time.Hour, "7d": 7 * 24 * time.Hour}
+	for s, want := range valid {
+		if got, err := ParseRollupStep(s); err != nil || got != want {
+			t.Errorf("%s: 期望 %s，实际 %s (%v)", s, want, got, err)
+		}
+	}
+	for _, s := range []string{"30s", "90s", "abc", "xd"} {
+		if _, err := ParseRollupStep(s); err == nil {
+			t.Errorf("%s 应为无效步长", s)
+		}
+	}
+}
@@ -1,17 +1,104 @@
 package main
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jobfirst/jobfirst-core"
 )
 
+// requireEventToken 校验服务间事件令牌；令牌未配置时拒绝请求，避免接口在未加保护的情况下对外开放
+func requireEventToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "事件令牌未配置，暂不接收招聘事件"})
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader("X-Event-Token")), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "无效的事件令牌"})
+			return
+		}
+		c.Next()
+	}
+}
+
 // setupStatisticsEnhancedRoutes 设置Statistics服务增强API路由
 func setupStatisticsEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, enhancedService *StatisticsEnhancedService) {
+	// 事件接入API
+	events := r.Group("/api/v1/statistics/events")
+	{
+		// 客户端产品事件批量上报，登录与否均可；登录用户按企业成员关系确定租户归属，匿名事件不归属租户
+		// 请求体: {"events":[{"event_id","name","timestamp","anonymous_id","properties","context"}]}
+		events.POST("", core.AuthMiddleware.OptionalAuth(), func(c *gin.Context) {
+			var req struct {
+				Events []TrackEventInput `json:"events" binding:"required"`
+			}
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, 1<<20)
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			info := TrackRequestInfo{
+				UserID:     c.GetUint("user_id"),
+				UserAgent:  c.Request.UserAgent(),
+				IP:         net.ParseIP(c.ClientIP()),
+				Header:     c.Request.Header,
+				ReceivedAt: time.Now(),
+			}
+			if info.UserID > 0 {
+				info.TenantID = enhancedService.ResolveEventTenant(info.UserID, c.GetString("role"), c.GetHeader("X-Company-ID"))
+			}
+			result, err := enhancedService.TrackProductEvents(req.Events, info)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "接收事件失败: " + err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"status": "success",
+				"data":   result,
+			})
+		})
+
+		// 招聘事件：职位浏览、申请、审核、面试、录用、拒绝、撤回，供job-service调用
+		// 调用方需在X-Event-Token头中携带STATISTICS_EVENT_TOKEN，未配置令牌时拒绝所有请求
+		eventToken := os.Getenv("STATISTICS_EVENT_TOKEN")
+		if eventToken == "" {
+			log.Printf("⚠️ 未配置STATISTICS_EVENT_TOKEN，招聘事件接口将拒绝所有请求")
+		}
+		events.POST("/recruitment", requireEventToken(eventToken), func(c *gin.Context) {
+			var event RecruitmentEvent
+			if err := c.ShouldBindJSON(&event); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			recorded, err := enhancedService.RecordRecruitmentEvent(&event)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "记录招聘事件失败: " + err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"status":   "success",
+				"recorded": recorded, // false表示重复事件已忽略
+				"event_id": event.EventID,
+			})
+		})
+	}
+
 	// 需要认证的增强API路由
 	authMiddleware := core.AuthMiddleware.RequireAuth()
 	enhanced := r.Group("/api/v1/statistics/enhanced")
@@ -64,6 +151,79 @@ func setupStatisticsEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, enhancedS
 					"count":  len(analytics),
 				})
 			})
+			// 查询时间序列汇总，step支持1m、5m、1h、1d等
+			// 示例: /realtime/query?metric_type=user_activity&metric_name=login&start=...&end=...&step=1h&group_by=platform&filter=region:cn
+			realtime.GET("/query", func(c *gin.Context) {
+				var req struct {
+					MetricType string    `form:"metric_type" binding:"required"`
+					MetricName string    `form:"metric_name" binding:"required"`
+					Start      time.Time `form:"start" binding:"required" time_format:"2006-01-02T15:04:05Z07:00"`
+					End        time.Time `form:"end" time_format:"2006-01-02T15:04:05Z07:00"`
+					Step       string    `form:"step"`
+					GroupBy    string    `form:"group_by"`
+					Filter     []string  `form:"filter"`
+				}
+				if err := c.ShouldBindQuery(&req); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				if req.End.IsZero() {
+					req.End = time.Now()
+				}
+				if req.Step == "" {
+					req.Step = "1h"
+				}
+
+				step, err := ParseRollupStep(req.Step)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				query := RollupQuery{
+					MetricType: req.MetricType,
+					MetricName: req.MetricName,
+					Start:      req.Start,
+					End:        req.End,
+					Step:       step,
+					Filters:    make(map[string]string),
+				}
+				if req.GroupBy != "" {
+					query.GroupBy = strings.Split(req.GroupBy, ",")
+				}
+				for _, f := range req.Filter {
+					name, value, ok := strings.Cut(f, ":")
+					if !ok || name == "" {
+						c.JSON(http.StatusBadRequest, gin.H{"error": "过滤条件格式应为 维度:值"})
+						return
+					}
+					query.Filters[name] = value
+				}
+
+				result, err := enhancedService.QueryRollups(query)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "查询汇总数据失败: " + err.Error()})
+					return
+				}
+
+				c.JSON(http.StatusOK, gin.H{
+					"status": "success",
+					"data":   result,
+				})
+			})
+
+			// 获取各粒度汇总进度
+			realtime.GET("/rollups/status", func(c *gin.Context) {
+				states, err := enhancedService.GetRollupStatus()
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "获取汇总进度失败: " + err.Error()})
+					return
+				}
+
+				c.JSON(http.StatusOK, gin.H{
+					"status": "success",
+					"data":   states,
+				})
+			})
 		}
 
 		// 历史分析API
@@ -74,9 +234,10 @@ func setupStatisticsEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, enhancedS
 				var req struct {
 					AnalysisType string    `json:"analysis_type" binding:"required"` // trend, pattern, correlation
 					EntityType   string    `json:"entity_type" binding:"required"`
-					EntityID     uint      `json:"entity_id" binding:"required"`
+					EntityID     uint      `json:"entity_id"` // 0表示分析该类型实体的汇总指标
 					StartDate    time.Time `json:"start_date" binding:"required"`
 					EndDate      time.Time `json:"end_date" binding:"required"`
+					Metrics      []string  `json:"metrics"` // 参与分析的指标，为空时使用窗口内全部指标
 				}
 
 				if err := c.ShouldBindJSON(&req); err != nil {
@@ -85,8 +246,12 @@ func setupStatisticsEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, enhancedS
 				}
 
 				result, err := enhancedService.PerformHistoricalAnalysis(
-					req.AnalysisType, req.EntityType, req.EntityID, req.StartDate, req.EndDate,
+					req.AnalysisType, req.EntityType, req.EntityID, req.StartDate, req.EndDate, req.Metrics...,
 				)
+				if errors.Is(err, ErrInsufficientData) {
+					c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+					return
+				}
 				if err != nil {
 					c.JSON(http.StatusInternalServerError, gin.H{"error": "执行历史分析失败: " + err.Error()})
 					return
@@ -106,7 +271,7 @@ func setupStatisticsEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, enhancedS
 			predictive.POST("/models", func(c *gin.Context) {
 				var req struct {
 					ModelName    string                 `json:"model_name" binding:"required"`
-					ModelType    string                 `json:"model_type" binding:"required"` // regression, classification, clustering
+					ModelType    string                 `json:"model_type" binding:"required"` // holt_winters, linear_regression, seasonal_naive
 					TargetEntity string                 `json:"target_entity" binding:"required"`
 					Parameters   map[string]interface{} `json:"parameters"`
 				}
@@ -120,7 +285,7 @@ func setupStatisticsEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, enhancedS
 					req.ModelName, req.ModelType, req.TargetEntity, req.Parameters,
 				)
 				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "创建预测模型失败: " + err.Error()})
+					c.JSON(http.StatusBadRequest, gin.H{"error": "创建预测模型失败: " + err.Error()})
 					return
 				}
 
@@ -139,24 +304,57 @@ func setupStatisticsEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, enhancedS
 					return
 				}
 
+				// training_data可选，未提供时使用模型参数中指标的已记录数据
 				var req struct {
-					TrainingData map[string]interface{} `json:"training_data" binding:"required"`
+					TrainingData map[string]interface{} `json:"training_data"`
 				}
 
-				if err := c.ShouldBindJSON(&req); err != nil {
-					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-					return
+				if c.Request.ContentLength > 0 {
+					if err := c.ShouldBindJSON(&req); err != nil {
+						c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+						return
+					}
 				}
 
-				if err := enhancedService.TrainPredictiveModel(uint(modelID), req.TrainingData); err != nil {
+				report, err := enhancedService.TrainPredictiveModel(uint(modelID), req.TrainingData)
+				if errors.Is(err, ErrInsufficientData) {
+					c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+					return
+				}
+				if err != nil {
 					c.JSON(http.StatusInternalServerError, gin.H{"error": "训练预测模型失败: " + err.Error()})
 					return
 				}
 
+				message := "预测模型训练成功，已上线新参数"
+				if !report.Promoted {
+					message = "预测模型训练完成，但未优于基线，保留原有参数"
+				}
 				c.JSON(http.StatusOK, gin.H{
 					"status":   "success",
-					"message":  "预测模型训练成功",
+					"message":  message,
 					"model_id": modelID,
+					"data":     report,
+				})
+			})
+
+			// 获取预测模型详情（含回测报告）
+			predictive.GET("/models/:id", func(c *gin.Context) {
+				modelID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "无效的模型ID"})
+					return
+				}
+
+				model, err := enhancedService.GetPredictiveModel(uint(modelID))
+				if err != nil {
+					c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+					return
+				}
+
+				c.JSON(http.StatusOK, gin.H{
+					"status": "success",
+					"data":   model,
 				})
 			})
 
@@ -167,6 +365,7 @@ func setupStatisticsEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, enhancedS
 					EntityType     string `json:"entity_type" binding:"required"`
 					EntityID       uint   `json:"entity_id" binding:"required"`
 					PredictionType string `json:"prediction_type" binding:"required"`
+					Horizon        int    `json:"horizon"` // 预测天数，默认7
 				}
 
 				if err := c.ShouldBindJSON(&req); err != nil {
@@ -175,7 +374,7 @@ func setupStatisticsEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, enhancedS
 				}
 
 				result, err := enhancedService.GeneratePrediction(
-					req.ModelID, req.EntityType, req.EntityID, req.PredictionType,
+					req.ModelID, req.EntityType, req.EntityID, req.PredictionType, req.Horizon,
 				)
 				if err != nil {
 					c.JSON(http.StatusInternalServerError, gin.H{"error": "生成预测失败: " + err.Error()})
@@ -192,11 +391,11 @@ func setupStatisticsEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, enhancedS
 		// 异常检测API
 		anomaly := enhanced.Group("/anomaly")
 		{
-			// 检测异常
+			// 检测异常（threshold可选，覆盖指标配置中的阈值）
 			anomaly.POST("/detect", func(c *gin.Context) {
 				var req struct {
 					MetricName string  `json:"metric_name" binding:"required"`
-					Threshold  float64 `json:"threshold" binding:"required"`
+					Threshold  float64 `json:"threshold"`
 				}
 
 				if err := c.ShouldBindJSON(&req); err != nil {
@@ -216,6 +415,63 @@ func setupStatisticsEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, enhancedS
 					"count":  len(anomalies),
 				})
 			})
+
+			// 查询已检测的异常
+			anomaly.GET("/list", func(c *gin.Context) {
+				limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+				anomalies, err := enhancedService.ListAnomalies(c.Query("metric_name"), c.Query("severity"), limit)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "查询异常失败: " + err.Error()})
+					return
+				}
+
+				c.JSON(http.StatusOK, gin.H{
+					"status": "success",
+					"data":   anomalies,
+					"count":  len(anomalies),
+				})
+			})
+
+			// 获取指标的检测配置
+			anomaly.GET("/config/:metric_name", func(c *gin.Context) {
+				config, err := enhancedService.GetAnomalyDetectorConfig(c.Param("metric_name"))
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "获取检测配置失败: " + err.Error()})
+					return
+				}
+
+				c.JSON(http.StatusOK, gin.H{
+					"status": "success",
+					"data":   config,
+				})
+			})
+
+			// 更新指标的检测方法和灵敏度，未传的字段保持原值
+			anomaly.PUT("/config/:metric_name", func(c *gin.Context) {
+				var update AnomalyDetectorConfigUpdate
+				if err := c.ShouldBindJSON(&update); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				current, err := enhancedService.GetAnomalyDetectorConfig(c.Param("metric_name"))
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "获取检测配置失败: " + err.Error()})
+					return
+				}
+				config := update.Apply(current)
+				config.UpdatedBy = c.GetUint("user_id")
+
+				saved, err := enhancedService.SaveAnomalyDetectorConfig(config)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "保存检测配置失败: " + err.Error()})
+					return
+				}
+
+				c.JSON(http.StatusOK, gin.H{
+					"status": "success",
+					"data":   saved,
+				})
+			})
 		}
 
 		// 业务洞察API
@@ -332,6 +588,215 @@ func setupStatisticsEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, enhancedS
 			})
 		}
 
+		// 招聘漏斗分析API，仅管理员可用
+		// 公共参数: job_id, company_id, start, end（RFC3339，默认最近30天）
+		recruitment := enhanced.Group("/recruitment")
+		recruitment.Use(func(c *gin.Context) {
+			if !isAdminRole(c) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
+				c.Abort()
+				return
+			}
+			c.Next()
+		})
+		{
+			// 漏斗、转化率、阶段停留时长、招聘周期和来源归因
+			recruitment.GET("/funnel", func(c *gin.Context) {
+				filter, ok := bindRecruitmentFilter(c)
+				if !ok {
+					return
+				}
+				funnel, err := enhancedService.GetRecruitmentFunnel(filter)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "获取招聘漏斗失败: " + err.Error()})
+					return
+				}
+
+				c.JSON(http.StatusOK, gin.H{
+					"status": "success",
+					"data":   funnel,
+				})
+			})
+
+			// 按申请周/月划分的队列对比，period=week|month，tz为队列划分时区
+			recruitment.GET("/cohorts", func(c *gin.Context) {
+				filter, ok := bindRecruitmentFilter(c)
+				if !ok {
+					return
+				}
+				loc, err := time.LoadLocation(c.DefaultQuery("tz", "Asia/Shanghai"))
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "无效的时区"})
+					return
+				}
+				cohorts, err := enhancedService.GetRecruitmentCohorts(filter, c.DefaultQuery("period", "week"), loc)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+
+				c.JSON(http.StatusOK, gin.H{
+					"status": "success",
+					"data":   cohorts,
+					"count":  len(cohorts),
+				})
+			})
+
+			// 按职位或企业拆分的漏斗概要，by=job|company
+			recruitment.GET("/breakdown", func(c *gin.Context) {
+				filter, ok := bindRecruitmentFilter(c)
+				if !ok {
+					return
+				}
+				rows, err := enhancedService.GetRecruitmentBreakdown(filter, c.DefaultQuery("by", "job"))
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+
+				c.JSON(http.StatusOK, gin.H{
+					"status": "success",
+					"data":   rows,
+					"count":  len(rows),
+				})
+			})
+		}
+
+		// 产品分析API，仅管理员可用
+		// 公共参数: start, end（RFC3339，默认最近30天）, event, tenant_id, tz（默认Asia/Shanghai）
+		product := enhanced.Group("/product")
+		product.Use(func(c *gin.Context) {
+			if !isAdminRole(c) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
+				c.Abort()
+				return
+			}
+			c.Next()
+		})
+		{
+			// 每日DAU、WAU、MAU
+			product.GET("/active-users", func(c *gin.Context) {
+				filter, ok := bindProductMetricsFilter(c)
+				if !ok {
+					return
+				}
+				points, err := enhancedService.GetActiveUsers(filter)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "计算活跃用户失败: " + err.Error()})
+					return
+				}
+
+				c.JSON(http.StatusOK, gin.H{
+					"status": "success",
+					"data":   points,
+				})
+			})
+
+			// 留存队列: start_event（默认event）首次发生后，return_event（默认event）的回访情况
+			// period=day|week，periods为期数（默认8）
+			product.GET("/retention", func(c *gin.Context) {
+				filter, ok := bindProductMetricsFilter(c)
+				if !ok {
+					return
+				}
+				periods, _ := strconv.Atoi(c.DefaultQuery("periods", "8"))
+				cohorts, err := enhancedService.GetRetention(filter,
+					c.DefaultQuery("start_event", filter.Event), c.DefaultQuery("return_event", filter.Event),
+					c.DefaultQuery("period", "week"), periods)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+
+				c.JSON(http.StatusOK, gin.H{
+					"status": "success",
+					"data":   cohorts,
+					"count":  len(cohorts),
+				})
+			})
+
+			// 会话统计
+			product.GET("/sessions", func(c *gin.Context) {
+				filter, ok := bindProductMetricsFilter(c)
+				if !ok {
+					return
+				}
+				stats, err := enhancedService.GetSessionStats(filter)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+
+				c.JSON(http.StatusOK, gin.H{
+					"status": "success",
+					"data":   stats,
+				})
+			})
+
+			// 事件定义列表
+			product.GET("/schemas", func(c *gin.Context) {
+				schemas, err := enhancedService.ListEventSchemas()
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+
+				c.JSON(http.StatusOK, gin.H{
+					"status": "success",
+					"data":   schemas,
+					"count":  len(schemas),
+				})
+			})
+
+			// 创建或更新事件定义
+			product.PUT("/schemas/:name", func(c *gin.Context) {
+				var req struct {
+					Description     string                       `json:"description"`
+					Properties      map[string]EventPropertySpec `json:"properties"`
+					AllowAdditional bool                         `json:"allow_additional"`
+					Enabled         *bool                        `json:"enabled"`
+				}
+				if err := c.ShouldBindJSON(&req); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				if req.Properties == nil {
+					req.Properties = map[string]EventPropertySpec{}
+				}
+				properties, _ := json.Marshal(req.Properties)
+				schema := ProductEventSchema{
+					Name:            c.Param("name"),
+					Description:     req.Description,
+					Properties:      string(properties),
+					AllowAdditional: req.AllowAdditional,
+					Enabled:         req.Enabled == nil || *req.Enabled,
+				}
+				if err := enhancedService.SaveEventSchema(&schema); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+
+				c.JSON(http.StatusOK, gin.H{
+					"status":  "success",
+					"message": "事件定义已保存",
+					"data":    schema,
+				})
+			})
+
+			// 删除事件定义
+			product.DELETE("/schemas/:name", func(c *gin.Context) {
+				if err := enhancedService.DeleteEventSchema(c.Param("name")); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+
+				c.JSON(http.StatusOK, gin.H{
+					"status":  "success",
+					"message": "事件定义已删除",
+				})
+			})
+		}
+
 		// 报告生成API
 		reports := enhanced.Group("/reports")
 		{
@@ -410,6 +875,295 @@ func setupStatisticsEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, enhancedS
 					"count":  len(reports),
 				})
 			})
+
+			// 下载报表文件：管理员、报表创建人和接收人可下载
+			reports.GET("/runs/:id/artifacts/:format", func(c *gin.Context) {
+				runID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "无效的生成记录ID"})
+					return
+				}
+				artifact, def, err := enhancedService.GetReportArtifact(uint(runID), c.Param("format"))
+				if err != nil {
+					c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+					return
+				}
+
+				userID := c.GetUint("user_id")
+				allowed := isAdminRole(c) || def.OwnerID == userID
+				for _, recipient := range def.RecipientList() {
+					allowed = allowed || recipient == userID
+				}
+				if !allowed {
+					c.JSON(http.StatusForbidden, gin.H{"error": "无权下载该报表"})
+					return
+				}
+
+				reader, err := enhancedService.OpenReportArtifact(artifact)
+				if err != nil {
+					c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+					return
+				}
+				defer reader.Close()
+
+				filename := fmt.Sprintf("%s-%d.%s", def.Name, runID, artifact.Format)
+				c.DataFromReader(http.StatusOK, int64(artifact.Size), reportContentTypes[artifact.Format], reader, map[string]string{
+					"Content-Disposition": "attachment; filename*=UTF-8''" + url.QueryEscape(filename),
+				})
+			})
+
+			// 报表定义管理，仅管理员可用
+			builder := reports.Group("")
+			builder.Use(func(c *gin.Context) {
+				if !isAdminRole(c) {
+					c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
+					c.Abort()
+					return
+				}
+				c.Next()
+			})
+			{
+				// 创建报表定义
+				builder.POST("/definitions", func(c *gin.Context) {
+					def, ok := bindReportDefinition(c)
+					if !ok {
+						return
+					}
+					def.OwnerID = c.GetUint("user_id")
+					if err := enhancedService.CreateReportDefinition(def); err != nil {
+						c.JSON(http.StatusBadRequest, gin.H{"error": "创建报表定义失败: " + err.Error()})
+						return
+					}
+
+					c.JSON(http.StatusOK, gin.H{
+						"status":  "success",
+						"message": "报表定义创建成功",
+						"data":    def,
+					})
+				})
+
+				// 获取报表定义列表
+				builder.GET("/definitions", func(c *gin.Context) {
+					defs, err := enhancedService.ListReportDefinitions()
+					if err != nil {
+						c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+						return
+					}
+
+					c.JSON(http.StatusOK, gin.H{
+						"status": "success",
+						"data":   defs,
+						"count":  len(defs),
+					})
+				})
+
+				// 获取报表定义
+				builder.GET("/definitions/:id", func(c *gin.Context) {
+					id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+					if err != nil {
+						c.JSON(http.StatusBadRequest, gin.H{"error": "无效的报表ID"})
+						return
+					}
+					def, err := enhancedService.GetReportDefinition(uint(id))
+					if err != nil {
+						c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+						return
+					}
+
+					c.JSON(http.StatusOK, gin.H{
+						"status": "success",
+						"data":   def,
+					})
+				})
+
+				// 更新报表定义
+				builder.PUT("/definitions/:id", func(c *gin.Context) {
+					id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+					if err != nil {
+						c.JSON(http.StatusBadRequest, gin.H{"error": "无效的报表ID"})
+						return
+					}
+					def, ok := bindReportDefinition(c)
+					if !ok {
+						return
+					}
+					updated, err := enhancedService.UpdateReportDefinition(uint(id), def)
+					if err != nil {
+						c.JSON(http.StatusBadRequest, gin.H{"error": "更新报表定义失败: " + err.Error()})
+						return
+					}
+
+					c.JSON(http.StatusOK, gin.H{
+						"status":  "success",
+						"message": "报表定义更新成功",
+						"data":    updated,
+					})
+				})
+
+				// 删除报表定义
+				builder.DELETE("/definitions/:id", func(c *gin.Context) {
+					id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+					if err != nil {
+						c.JSON(http.StatusBadRequest, gin.H{"error": "无效的报表ID"})
+						return
+					}
+					if err := enhancedService.DeleteReportDefinition(uint(id)); err != nil {
+						c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+						return
+					}
+
+					c.JSON(http.StatusOK, gin.H{
+						"status":  "success",
+						"message": "报表定义已删除",
+					})
+				})
+
+				// 立即生成报表
+				builder.POST("/definitions/:id/run", func(c *gin.Context) {
+					id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+					if err != nil {
+						c.JSON(http.StatusBadRequest, gin.H{"error": "无效的报表ID"})
+						return
+					}
+					run, err := enhancedService.RunReport(uint(id), "manual")
+					if err != nil {
+						if run == nil {
+							c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+							return
+						}
+						c.JSON(http.StatusInternalServerError, gin.H{"error": "生成报表失败: " + err.Error(), "data": run})
+						return
+					}
+
+					c.JSON(http.StatusOK, gin.H{
+						"status":  "success",
+						"message": "报表生成成功",
+						"data":    run,
+					})
+				})
+
+				// 获取报表生成记录
+				builder.GET("/definitions/:id/runs", func(c *gin.Context) {
+					id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+					if err != nil {
+						c.JSON(http.StatusBadRequest, gin.H{"error": "无效的报表ID"})
+						return
+					}
+					limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+					runs, err := enhancedService.ListReportRuns(uint(id), limit)
+					if err != nil {
+						c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+						return
+					}
+
+					c.JSON(http.StatusOK, gin.H{
+						"status": "success",
+						"data":   runs,
+						"count":  len(runs),
+					})
+				})
+			}
 		}
 	}
 }
+
+// isAdminRole 检查当前用户是否为管理员
+func isAdminRole(c *gin.Context) bool {
+	role := c.GetString("role")
+	return role == "admin" || role == "super_admin"
+}
+
+// bindRecruitmentFilter 解析招聘分析的筛选参数
+func bindRecruitmentFilter(c *gin.Context) (RecruitmentFilter, bool) {
+	var req struct {
+		JobID     uint      `form:"job_id"`
+		CompanyID uint      `form:"company_id"`
+		Start     time.Time `form:"start" time_format:"2006-01-02T15:04:05Z07:00"`
+		End       time.Time `form:"end" time_format:"2006-01-02T15:04:05Z07:00"`
+	}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return RecruitmentFilter{}, false
+	}
+	if req.End.IsZero() {
+		req.End = time.Now()
+	}
+	if req.Start.IsZero() {
+		req.Start = req.End.AddDate(0, 0, -30)
+	}
+	if !req.Start.Before(req.End) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start必须早于end"})
+		return RecruitmentFilter{}, false
+	}
+	return RecruitmentFilter{JobID: req.JobID, CompanyID: req.CompanyID, Start: req.Start, End: req.End}, true
+}
+
+// bindProductMetricsFilter 解析产品分析的筛选参数
+func bindProductMetricsFilter(c *gin.Context) (ProductMetricsFilter, bool) {
+	var req struct {
+		Start    time.Time `form:"start" time_format:"2006-01-02T15:04:05Z07:00"`
+		End      time.Time `form:"end" time_format:"2006-01-02T15:04:05Z07:00"`
+		Event    string    `form:"event"`
+		TenantID string    `form:"tenant_id"`
+		TZ       string    `form:"tz"`
+	}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return ProductMetricsFilter{}, false
+	}
+	if req.TZ == "" {
+		req.TZ = "Asia/Shanghai"
+	}
+	loc, err := time.LoadLocation(req.TZ)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的时区"})
+		return ProductMetricsFilter{}, false
+	}
+	if req.End.IsZero() {
+		req.End = time.Now()
+	}
+	if req.Start.IsZero() {
+		req.Start = req.End.AddDate(0, 0, -30)
+	}
+	if !req.Start.Before(req.End) || req.End.Sub(req.Start) > 366*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start必须早于end，且范围不超过一年"})
+		return ProductMetricsFilter{}, false
+	}
+	return ProductMetricsFilter{Start: req.Start, End: req.End, Event: req.Event, TenantID: req.TenantID, Location: loc}, true
+}
+
+// bindReportDefinition 解析报表定义请求体，区块和接收人以JSON数组提交
+func bindReportDefinition(c *gin.Context) (*ReportDefinition, bool) {
+	var req struct {
+		Name        string          `json:"name" binding:"required"`
+		Description string          `json:"description"`
+		Sections    []ReportSection `json:"sections" binding:"required"`
+		TimeRange   string          `json:"time_range"`
+		Formats     []string        `json:"formats"`
+		Schedule    string          `json:"schedule"`
+		Timezone    string          `json:"timezone"`
+		Recipients  []uint          `json:"recipients"`
+		Enabled     *bool           `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	sections, _ := json.Marshal(req.Sections)
+	if req.Recipients == nil {
+		req.Recipients = []uint{}
+	}
+	recipients, _ := json.Marshal(req.Recipients)
+	return &ReportDefinition{
+		Name:        req.Name,
+		Description: req.Description,
+		Sections:    string(sections),
+		TimeRange:   req.TimeRange,
+		Formats:     strings.Join(req.Formats, ","),
+		Schedule:    req.Schedule,
+		Timezone:    req.Timezone,
+		Recipients:  string(recipients),
+		Enabled:     req.Enabled == nil || *req.Enabled,
+	}, true
+}
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/jobfirst/jobfirst-core"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 	"gorm.io/gorm"
+	"resume-centre/common/storage"
 )
 
 // StatisticsEnhancedService 统计增强服务
@@ -16,6 +18,25 @@ type StatisticsEnhancedService struct {
 	postgresDB  *gorm.DB
 	neo4jDriver neo4j.DriverWithContext
 	redisClient *redis.Client
+
+	// 时间序列汇总
+	rollupRetention RollupRetention
+	rollupMu        sync.Mutex
+	stopRollup      chan struct{}
+
+	// 报表生成
+	reportStorage   *storage.StorageManager
+	reportFont      string
+	notificationURL string
+	stopReports     chan struct{}
+
+	// 产品事件
+	eventSchemaMu      sync.Mutex
+	eventSchemas       map[string]ProductEventSchema
+	eventSchemasAt     time.Time
+	geoResolver        GeoResolver
+	sessionStore       SessionStore
+	sessionIdleTimeout time.Duration
 }
 
 // 实时分析数据模型
@@ -48,18 +69,20 @@ type HistoricalAnalysis struct {
 
 // 预测模型数据
 type PredictiveModel struct {
-	ID              uint      `json:"id" gorm:"primaryKey"`
-	ModelName       string    `json:"model_name" gorm:"size:100;not null"`
-	ModelType       string    `json:"model_type" gorm:"size:50;not null"`    // regression, classification, clustering
-	TargetEntity    string    `json:"target_entity" gorm:"size:50;not null"` // user_behavior, template_popularity, company_growth
-	ModelVersion    string    `json:"model_version" gorm:"size:20"`
-	ModelParameters string    `json:"model_parameters" gorm:"type:json"`
-	TrainingData    string    `json:"training_data" gorm:"type:json"`
-	ModelAccuracy   float64   `json:"model_accuracy" gorm:"type:decimal(5,4)"`
-	Status          string    `json:"status" gorm:"size:20;default:active"` // active, inactive, training
-	LastTrained     time.Time `json:"last_trained"`
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	ModelName        string    `json:"model_name" gorm:"size:100;not null"`
+	ModelType        string    `json:"model_type" gorm:"size:50;not null"`    // holt_winters, linear_regression, seasonal_naive
+	TargetEntity     string    `json:"target_entity" gorm:"size:50;not null"` // user_behavior, template_popularity, company_growth
+	ModelVersion     string    `json:"model_version" gorm:"size:20"`
+	ModelParameters  string    `json:"model_parameters" gorm:"type:json"`
+	TrainingData     string    `json:"training_data" gorm:"type:json"`
+	FittedParameters string    `json:"fitted_parameters" gorm:"type:json"`      // 当前上线的拟合参数
+	BacktestReport   string    `json:"backtest_report" gorm:"type:json"`        // 最近一次训练的回测报告
+	ModelAccuracy    float64   `json:"model_accuracy" gorm:"type:decimal(5,4)"` // 1 - 回测MAPE
+	Status           string    `json:"status" gorm:"size:20;default:active"`    // active, inactive
+	LastTrained      time.Time `json:"last_trained"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
 }
 
 // 预测结果数据
@@ -121,6 +144,7 @@ type AnomalyDetection struct {
 	EntityType    string     `json:"entity_type" gorm:"size:50;not null"`
 	EntityID      *uint      `json:"entity_id"`
 	MetricName    string     `json:"metric_name" gorm:"size:100;not null"`
+	Method        string     `json:"method" gorm:"size:30"` // zscore, mad, seasonal, change_point
 	ExpectedValue float64    `json:"expected_value" gorm:"type:decimal(15,4)"`
 	ActualValue   float64    `json:"actual_value" gorm:"type:decimal(15,4)"`
 	Deviation     float64    `json:"deviation" gorm:"type:decimal(15,4)"` // 偏差程度
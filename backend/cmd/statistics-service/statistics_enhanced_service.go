@@ -3,22 +3,38 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
+	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/jobfirst/jobfirst-core"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"resume-centre/common/storage"
 )
 
 // NewStatisticsEnhancedService 创建统计增强服务实例
 func NewStatisticsEnhancedService(core *jobfirst.Core) (*StatisticsEnhancedService, error) {
 	service := &StatisticsEnhancedService{
-		core:    core,
-		mysqlDB: core.GetDB(), // 使用核心包的MySQL DB
+		core:            core,
+		mysqlDB:         core.GetDB(), // 使用核心包的MySQL DB
+		rollupRetention: DefaultRollupRetention(),
+		reportFont:      os.Getenv("STATISTICS_REPORT_FONT"),
+		notificationURL: os.Getenv("NOTIFICATION_SERVICE_URL"),
+
+		geoResolver:        headerGeoResolver{},
+		sessionIdleTimeout: DefaultSessionIdleTimeout,
+	}
+	service.reportStorage = storage.NewStorageManager(reportStorageConfig())
+	if service.notificationURL == "" {
+		service.notificationURL = "http://localhost:8084"
 	}
 
 	// 初始化PostgreSQL
@@ -61,6 +77,13 @@ func NewStatisticsEnhancedService(core *jobfirst.Core) (*StatisticsEnhancedServi
 		service.redisClient = redisManager.GetClient()
 	}
 
+	// 会话状态优先保存在Redis，多实例共享
+	if service.redisClient != nil {
+		service.sessionStore = redisSessionStore{client: service.redisClient}
+	} else {
+		service.sessionStore = newMemorySessionStore()
+	}
+
 	return service, nil
 }
 
@@ -112,6 +135,18 @@ func (s *StatisticsEnhancedService) createAnalyticsTables() error {
 		return fmt.Errorf("创建异常检测表失败: %w", err)
 	}
 
+	// 创建异常检测配置表
+	err = s.postgresDB.AutoMigrate(&AnomalyDetectorConfig{})
+	if err != nil {
+		return fmt.Errorf("创建异常检测配置表失败: %w", err)
+	}
+
+	// 创建时间序列汇总表
+	err = s.postgresDB.AutoMigrate(&AnalyticsRollup{}, &AnalyticsRollupState{})
+	if err != nil {
+		return fmt.Errorf("创建时间序列汇总表失败: %w", err)
+	}
+
 	// 创建可视化配置表
 	err = s.postgresDB.AutoMigrate(&VisualizationConfig{})
 	if err != nil {
@@ -124,6 +159,27 @@ func (s *StatisticsEnhancedService) createAnalyticsTables() error {
 		return fmt.Errorf("创建统计报告表失败: %w", err)
 	}
 
+	// 创建报表定义和生成记录表
+	err = s.postgresDB.AutoMigrate(&ReportDefinition{}, &ReportRun{})
+	if err != nil {
+		return fmt.Errorf("创建报表定义表失败: %w", err)
+	}
+
+	// 创建招聘事件和申请进度表
+	err = s.postgresDB.AutoMigrate(&RecruitmentEvent{}, &RecruitmentApplication{})
+	if err != nil {
+		return fmt.Errorf("创建招聘分析表失败: %w", err)
+	}
+
+	// 创建产品事件、会话和事件定义表
+	err = s.postgresDB.AutoMigrate(&ProductEventSchema{}, &ProductEvent{}, &ProductSession{})
+	if err != nil {
+		return fmt.Errorf("创建产品事件表失败: %w", err)
+	}
+	if err = s.seedEventSchemas(); err != nil {
+		return fmt.Errorf("写入内置事件定义失败: %w", err)
+	}
+
 	// 创建数据同步状态表
 	err = s.postgresDB.AutoMigrate(&StatisticsSyncStatus{})
 	if err != nil {
@@ -213,32 +269,62 @@ func (s *StatisticsEnhancedService) GetRealTimeAnalytics(metricType, metricName
 	return analytics, nil
 }
 
-// PerformHistoricalAnalysis 执行历史数据分析
-func (s *StatisticsEnhancedService) PerformHistoricalAnalysis(analysisType, entityType string, entityID uint, startDate, endDate time.Time) (*AnalysisResult, error) {
+// historicalAnalysisCacheTTL 历史分析结果缓存时间（窗口未结束时缩短，以便纳入新数据）
+const (
+	historicalAnalysisCacheTTL     = time.Hour
+	historicalAnalysisOpenCacheTTL = time.Minute * 5
+)
+
+// PerformHistoricalAnalysis 执行历史数据分析，metrics为空时分析实体在窗口内的全部指标
+func (s *StatisticsEnhancedService) PerformHistoricalAnalysis(analysisType, entityType string, entityID uint, startDate, endDate time.Time, metrics ...string) (*AnalysisResult, error) {
 	if s.postgresDB == nil {
 		return nil, fmt.Errorf("PostgreSQL未连接，无法执行历史分析")
 	}
+	if !endDate.After(startDate) {
+		return nil, fmt.Errorf("结束时间必须晚于开始时间")
+	}
+	switch analysisType {
+	case "trend", "pattern", "correlation":
+	default:
+		return nil, fmt.Errorf("不支持的分析类型: %s", analysisType)
+	}
+
+	cacheKey := historicalAnalysisCacheKey(analysisType, entityType, entityID, startDate, endDate, metrics)
+	if cached := s.getCachedAnalysis(cacheKey); cached != nil {
+		return cached, nil
+	}
+
+	series, err := s.loadEntityMetrics(entityType, entityID, startDate, endDate, metrics)
+	if err != nil {
+		return nil, err
+	}
 
 	// 根据分析类型执行不同的分析
 	var result *AnalysisResult
-	var err error
-
 	switch analysisType {
 	case "trend":
-		result, err = s.analyzeTrend(entityType, entityID, startDate, endDate)
+		result, err = BuildTrendAnalysis(series)
 	case "pattern":
-		result, err = s.analyzePattern(entityType, entityID, startDate, endDate)
+		config, cfgErr := s.GetAnomalyDetectorConfig(series[0].Name)
+		if cfgErr != nil {
+			return nil, cfgErr
+		}
+		result, err = BuildPatternAnalysis(series[0], config)
 	case "correlation":
-		result, err = s.analyzeCorrelation(entityType, entityID, startDate, endDate)
-	default:
-		return nil, fmt.Errorf("不支持的分析类型: %s", analysisType)
+		result, err = BuildCorrelationAnalysis(series)
 	}
-
 	if err != nil {
 		return nil, err
 	}
+	result.AnalysisType = analysisType
+	result.EntityType = entityType
+	result.EntityID = entityID
+	result.Confidence = math.Max(0, math.Min(1, result.Confidence))
+	result.Timestamp = time.Now()
 
 	// 保存分析结果到数据库
+	resultJSON, _ := json.Marshal(result.Result)
+	insightsJSON, _ := json.Marshal(result.Insights)
 	analysis := HistoricalAnalysis{
 		AnalysisType:   analysisType,
 		EntityType:     entityType,
@@ -246,8 +332,8 @@ func (s *StatisticsEnhancedService) PerformHistoricalAnalysis(analysisType, enti
 		AnalysisPeriod: "custom",
 		StartDate:      startDate,
 		EndDate:        endDate,
-		AnalysisResult: fmt.Sprintf(`{"result": %s}`, result.Result),
-		Insights:       fmt.Sprintf("%v", result.Insights),
+		AnalysisResult: string(resultJSON),
+		Insights:       string(insightsJSON),
 		Confidence:     result.Confidence,
 	}
 
@@ -255,97 +341,388 @@ func (s *StatisticsEnhancedService) PerformHistoricalAnalysis(analysisType, enti
 		log.Printf("保存历史分析结果失败: %v", err)
 	}
 
+	ttl := historicalAnalysisCacheTTL
+	if endDate.After(time.Now()) {
+		ttl = historicalAnalysisOpenCacheTTL
+	}
+	s.cacheAnalysis(cacheKey, result, ttl)
+
 	return result, nil
 }
 
-// analyzeTrend 分析趋势
-func (s *StatisticsEnhancedService) analyzeTrend(entityType string, entityID uint, startDate, endDate time.Time) (*AnalysisResult, error) {
-	// 模拟趋势分析
-	result := &AnalysisResult{
-		AnalysisType: "trend",
-		EntityType:   entityType,
-		EntityID:     entityID,
-		Result: map[string]interface{}{
-			"trend_direction": "increasing",
-			"growth_rate":     0.15,
-			"volatility":      0.05,
-			"seasonality":     "moderate",
-		},
-		Insights: []string{
-			"数据呈现稳定增长趋势",
-			"增长率保持在15%左右",
-			"存在适度的季节性波动",
-		},
-		Confidence: 0.85,
-		Timestamp:  time.Now(),
+// historicalAnalysisCacheKey 按（分析类型, 实体, 时间窗口, 指标）生成缓存键
+func historicalAnalysisCacheKey(analysisType, entityType string, entityID uint, startDate, endDate time.Time, metrics []string) string {
+	key := fmt.Sprintf("statistics:historical:%s:%s:%d:%d:%d", analysisType, entityType, entityID, startDate.Unix(), endDate.Unix())
+	if len(metrics) > 0 {
+		key += ":" + strings.Join(metrics, ",")
 	}
+	return key
+}
 
-	return result, nil
+// getCachedAnalysis 读取缓存的分析结果，未命中返回nil
+func (s *StatisticsEnhancedService) getCachedAnalysis(key string) *AnalysisResult {
+	if s.redisClient == nil {
+		return nil
+	}
+	data, err := s.redisClient.Get(context.Background(), key).Bytes()
+	if err != nil {
+		return nil
+	}
+	var result AnalysisResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil
+	}
+	return &result
 }
 
-// analyzePattern 分析模式
-func (s *StatisticsEnhancedService) analyzePattern(entityType string, entityID uint, startDate, endDate time.Time) (*AnalysisResult, error) {
-	// 模拟模式分析
-	result := &AnalysisResult{
-		AnalysisType: "pattern",
-		EntityType:   entityType,
-		EntityID:     entityID,
-		Result: map[string]interface{}{
-			"pattern_type":     "cyclical",
-			"cycle_length":     7, // 天
-			"pattern_strength": 0.75,
-			"anomalies":        []string{"2025-09-10", "2025-09-15"},
-		},
-		Insights: []string{
-			"数据呈现7天周期性模式",
-			"模式强度为75%",
-			"发现2个异常数据点",
-		},
-		Confidence: 0.78,
-		Timestamp:  time.Now(),
+// cacheAnalysis 缓存分析结果
+func (s *StatisticsEnhancedService) cacheAnalysis(key string, result *AnalysisResult, ttl time.Duration) {
+	if s.redisClient == nil {
+		return
 	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	if err := s.redisClient.Set(context.Background(), key, data, ttl).Err(); err != nil {
+		log.Printf("缓存历史分析结果失败: %v", err)
+	}
+}
 
-	return result, nil
+// loadEntityMetrics 读取实体在时间窗口内的指标并按天对齐
+// entityType匹配metric_type本身或以其为前缀的类型（如user匹配user_activity），entityID>0时按维度中的entity_id过滤
+func (s *StatisticsEnhancedService) loadEntityMetrics(entityType string, entityID uint, startDate, endDate time.Time, metrics []string) ([]MetricSeries, error) {
+	rows, err := s.loadHistoryPoints(startDate, endDate, func(db *gorm.DB) *gorm.DB {
+		db = db.Where("metric_type = ? OR metric_type LIKE ?", entityType, entityType+"\\_%")
+		if entityID > 0 {
+			db = db.Where("dimensions->>'entity_id' = ?", fmt.Sprint(entityID))
+		}
+		if len(metrics) > 0 {
+			db = db.Where("metric_name IN ?", metrics)
+		}
+		return db
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取历史数据失败: %w", err)
+	}
+
+	points := make(map[string][]SeriesPoint)
+	for _, row := range rows {
+		points[row.MetricName] = append(points[row.MetricName], row.SeriesPoint)
+	}
+
+	// 指定了指标时按请求顺序，否则按数据点数量降序（数据最多的为主指标）
+	names := metrics
+	if len(names) == 0 {
+		for name := range points {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			if len(points[names[i]]) != len(points[names[j]]) {
+				return len(points[names[i]]) > len(points[names[j]])
+			}
+			return names[i] < names[j]
+		})
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%w: %s 在 %s 至 %s 期间没有数据", ErrInsufficientData,
+			entityType, startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
+	}
+
+	series := make([]MetricSeries, 0, len(names))
+	for _, name := range names {
+		if len(points[name]) == 0 {
+			return nil, fmt.Errorf("%w: 指标 %s 在分析窗口内没有数据", ErrInsufficientData, name)
+		}
+		series = append(series, MetricSeries{Name: name, Points: DailySeries(points[name], startDate, endDate)})
+	}
+	return series, nil
 }
 
-// analyzeCorrelation 分析相关性
-func (s *StatisticsEnhancedService) analyzeCorrelation(entityType string, entityID uint, startDate, endDate time.Time) (*AnalysisResult, error) {
-	// 模拟相关性分析
-	result := &AnalysisResult{
-		AnalysisType: "correlation",
-		EntityType:   entityType,
-		EntityID:     entityID,
-		Result: map[string]interface{}{
-			"correlation_matrix": map[string]float64{
-				"user_activity":  0.65,
-				"template_usage": 0.42,
-				"company_growth": 0.38,
-			},
-			"strongest_correlation": "user_activity",
-			"correlation_strength":  0.65,
-		},
-		Insights: []string{
-			"用户活跃度与整体指标相关性最强",
-			"模板使用率与用户活跃度正相关",
-			"企业增长与用户活跃度存在中等相关性",
-		},
-		Confidence: 0.72,
-		Timestamp:  time.Now(),
+// loadHistoryPoints 读取 [start, end] 内符合条件的数据点。原始数据保留期之前的部分按PlanHistorySources改读小时/天汇总，
+// 每个汇总桶作为一个数据点；filter同时作用于原始数据和汇总表（两者的指标和维度列同名）
+func (s *StatisticsEnhancedService) loadHistoryPoints(start, end time.Time, filter func(*gorm.DB) *gorm.DB) ([]HistoryPoint, error) {
+	var state AnalyticsRollupState
+	if err := s.postgresDB.Where("resolution = ?", RollupHour).First(&state).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("获取汇总进度失败: %w", err)
+	}
+	plan := PlanHistorySources(start, time.Now(), state.Watermark, s.rollupRetention)
+
+	var points []HistoryPoint
+	for _, source := range []struct {
+		resolution string
+		from, to   time.Time
+	}{
+		{RollupDay, plan.Start, plan.HourStart},
+		{RollupHour, plan.HourStart, plan.RawStart},
+	} {
+		if !source.to.After(source.from) {
+			continue
+		}
+		var rollups []AnalyticsRollup
+		if err := s.postgresDB.Scopes(filter).
+			Where("resolution = ? AND bucket_start >= ? AND bucket_start < ?", source.resolution, truncateBucket(source.from, rollupStep[source.resolution]), source.to).
+			Order("bucket_start ASC").Find(&rollups).Error; err != nil {
+			return nil, err
+		}
+		points = append(points, RollupHistoryPoints(rollups)...)
 	}
 
-	return result, nil
+	var rows []RealTimeAnalytics
+	if err := s.postgresDB.Scopes(filter).Where("timestamp >= ? AND timestamp <= ?", plan.RawStart, end).
+		Order("timestamp ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		points = append(points, HistoryPoint{
+			MetricType:  row.MetricType,
+			MetricName:  row.MetricName,
+			SeriesPoint: SeriesPoint{Timestamp: row.Timestamp, Value: row.MetricValue},
+		})
+	}
+	return points, nil
+}
+
+// rollupLateArrival 每次汇总时重新处理水位线之前这段时间内的桶，以纳入延迟到达的数据
+const rollupLateArrival = 5 * time.Minute
+
+// maxRollupQueryPoints 单次查询允许的最大时间点数
+const maxRollupQueryPoints = 10000
+
+// StartRollupScheduler 启动定时汇总和保留策略清理，Close时停止
+func (s *StatisticsEnhancedService) StartRollupScheduler(interval time.Duration) {
+	if s.postgresDB == nil {
+		log.Println("PostgreSQL未连接，跳过时间序列汇总任务")
+		return
+	}
+	s.stopRollup = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var lastRetention time.Time
+		for {
+			now := time.Now()
+			if err := s.RunRollups(now); err != nil {
+				log.Printf("时间序列汇总失败: %v", err)
+			}
+			if now.Sub(lastRetention) >= time.Hour {
+				if err := s.ApplyRetention(now); err != nil {
+					log.Printf("清理过期分析数据失败: %v", err)
+				}
+				lastRetention = now
+			}
+
+			select {
+			case <-ticker.C:
+			case <-s.stopRollup:
+				return
+			}
+		}
+	}()
+}
+
+// RunRollups 汇总各粒度已结束的时间桶，可重复执行
+func (s *StatisticsEnhancedService) RunRollups(now time.Time) error {
+	if s.postgresDB == nil {
+		return fmt.Errorf("PostgreSQL未连接，无法汇总实时分析数据")
+	}
+	s.rollupMu.Lock()
+	defer s.rollupMu.Unlock()
+
+	for _, resolution := range rollupResolutions {
+		step := rollupStep[resolution]
+		end := truncateBucket(now, step)
+
+		var state AnalyticsRollupState
+		if err := s.postgresDB.Where("resolution = ?", resolution).First(&state).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("获取汇总进度失败: %w", err)
+			}
+			state.Resolution = resolution
+		}
+
+		var start time.Time
+		if state.Watermark.IsZero() {
+			var first RealTimeAnalytics
+			if err := s.postgresDB.Order("timestamp ASC").First(&first).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					continue
+				}
+				return fmt.Errorf("获取最早分析数据失败: %w", err)
+			}
+			start = truncateBucket(first.Timestamp, step)
+		} else {
+			start = truncateBucket(state.Watermark.Add(-rollupLateArrival), step)
+		}
+		if rawStart := truncateBucket(now.Add(-s.rollupRetention.Raw), step); s.rollupRetention.Raw > 0 && start.Before(rawStart) {
+			start = rawStart
+		}
+
+		// 分块读取原始数据，避免首次回填时一次加载过多
+		chunk := step
+		if chunk < time.Hour {
+			chunk = time.Hour
+		} else if chunk < 24*time.Hour {
+			chunk = 24 * time.Hour
+		}
+		for chunkStart := start; chunkStart.Before(end); {
+			chunkEnd := chunkStart.Add(chunk)
+			if chunkEnd.After(end) {
+				chunkEnd = end
+			}
+			if err := s.rollupRange(resolution, chunkStart, chunkEnd); err != nil {
+				return err
+			}
+			chunkStart = chunkEnd
+		}
+
+		state.Watermark = end
+		state.LastRunAt = now
+		if err := s.postgresDB.Save(&state).Error; err != nil {
+			return fmt.Errorf("保存汇总进度失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// rollupRange 汇总 [start, end) 内的原始数据并写入（覆盖）对应的桶
+func (s *StatisticsEnhancedService) rollupRange(resolution string, start, end time.Time) error {
+	var rows []RealTimeAnalytics
+	if err := s.postgresDB.Where("timestamp >= ? AND timestamp < ?", start, end).Find(&rows).Error; err != nil {
+		return fmt.Errorf("读取原始分析数据失败: %w", err)
+	}
+	rollups := BuildRollups(rows, resolution)
+	if len(rollups) == 0 {
+		return nil
+	}
+	err := s.postgresDB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "metric_type"}, {Name: "metric_name"}, {Name: "resolution"}, {Name: "dimensions_hash"}, {Name: "bucket_start"}},
+		DoUpdates: clause.AssignmentColumns([]string{"count", "sum", "min", "max", "avg", "p50", "p90", "p95", "p99", "updated_at"}),
+	}).CreateInBatches(&rollups, 500).Error
+	if err != nil {
+		return fmt.Errorf("保存%s汇总数据失败: %w", resolution, err)
+	}
+	return nil
+}
+
+// ApplyRetention 按分级保留策略清理原始数据和汇总数据
+// 原始数据只有在所有粒度都已汇总之后才会删除
+func (s *StatisticsEnhancedService) ApplyRetention(now time.Time) error {
+	if s.postgresDB == nil {
+		return fmt.Errorf("PostgreSQL未连接，无法清理分析数据")
+	}
+	s.rollupMu.Lock()
+	defer s.rollupMu.Unlock()
+
+	if keep := s.rollupRetention.Raw; keep > 0 {
+		cutoff := now.Add(-keep)
+		var states []AnalyticsRollupState
+		if err := s.postgresDB.Find(&states).Error; err != nil {
+			return fmt.Errorf("获取汇总进度失败: %w", err)
+		}
+		if len(states) < len(rollupResolutions) {
+			cutoff = time.Time{} // 尚有粒度未开始汇总，暂不删除原始数据
+		}
+		for _, state := range states {
+			if state.Watermark.Before(cutoff) {
+				cutoff = state.Watermark
+			}
+		}
+		if !cutoff.IsZero() {
+			result := s.postgresDB.Where("timestamp < ?", cutoff).Delete(&RealTimeAnalytics{})
+			if result.Error != nil {
+				return fmt.Errorf("清理原始分析数据失败: %w", result.Error)
+			}
+			if result.RowsAffected > 0 {
+				log.Printf("已清理 %d 条过期原始分析数据", result.RowsAffected)
+			}
+		}
+	}
+
+	for _, resolution := range rollupResolutions {
+		keep := s.rollupRetention.For(resolution)
+		if keep == 0 {
+			continue
+		}
+		result := s.postgresDB.Where("resolution = ? AND bucket_start < ?", resolution, now.Add(-keep)).Delete(&AnalyticsRollup{})
+		if result.Error != nil {
+			return fmt.Errorf("清理%s汇总数据失败: %w", resolution, result.Error)
+		}
+	}
+	return nil
+}
+
+// QueryRollups 按步长、时间范围和维度分组查询汇总数据
+func (s *StatisticsEnhancedService) QueryRollups(query RollupQuery) (*RollupQueryResult, error) {
+	if s.postgresDB == nil {
+		return nil, fmt.Errorf("PostgreSQL未连接，无法查询汇总数据")
+	}
+	if !query.End.After(query.Start) {
+		return nil, fmt.Errorf("结束时间必须晚于开始时间")
+	}
+	if query.End.Sub(query.Start)/query.Step > maxRollupQueryPoints {
+		return nil, fmt.Errorf("查询时间点过多，请增大步长或缩小时间范围（最多 %d 个点）", maxRollupQueryPoints)
+	}
+
+	resolution, err := ChooseRollupResolution(query.Step, query.Start, time.Now(), s.rollupRetention)
+	if err != nil {
+		return nil, err
+	}
+
+	db := s.postgresDB.Where("metric_type = ? AND metric_name = ? AND resolution = ?", query.MetricType, query.MetricName, resolution).
+		Where("bucket_start >= ? AND bucket_start < ?", truncateBucket(query.Start, query.Step), query.End)
+	for name, value := range query.Filters {
+		db = db.Where("dimensions->>? = ?", name, value)
+	}
+	var rollups []AnalyticsRollup
+	if err := db.Order("bucket_start ASC").Find(&rollups).Error; err != nil {
+		return nil, fmt.Errorf("查询汇总数据失败: %w", err)
+	}
+
+	series, approximate := MergeRollups(rollups, query)
+	return &RollupQueryResult{
+		Resolution:  resolution,
+		Step:        query.Step.String(),
+		Series:      series,
+		Approximate: approximate,
+	}, nil
+}
+
+// GetRollupStatus 获取各粒度的汇总进度
+func (s *StatisticsEnhancedService) GetRollupStatus() ([]AnalyticsRollupState, error) {
+	if s.postgresDB == nil {
+		return nil, fmt.Errorf("PostgreSQL未连接，无法获取汇总进度")
+	}
+	var states []AnalyticsRollupState
+	if err := s.postgresDB.Order("resolution").Find(&states).Error; err != nil {
+		return nil, fmt.Errorf("获取汇总进度失败: %w", err)
+	}
+	return states, nil
 }
 
-// CreatePredictiveModel 创建预测模型
+// CreatePredictiveModel 创建预测模型，parameters需包含训练序列的metric_type和metric_name
 func (s *StatisticsEnhancedService) CreatePredictiveModel(modelName, modelType, targetEntity string, parameters map[string]interface{}) (*PredictiveModel, error) {
 	if s.postgresDB == nil {
 		return nil, fmt.Errorf("PostgreSQL未连接，无法创建预测模型")
 	}
 
+	modelType, err := NormalizeForecastModelType(modelType)
+	if err != nil {
+		return nil, err
+	}
+
 	parametersJSON, err := json.Marshal(parameters)
 	if err != nil {
 		return nil, fmt.Errorf("序列化模型参数失败: %w", err)
 	}
+	var config ForecastConfig
+	if err := json.Unmarshal(parametersJSON, &config); err != nil {
+		return nil, fmt.Errorf("模型参数格式错误: %w", err)
+	}
+	if config.MetricType == "" || config.MetricName == "" {
+		return nil, fmt.Errorf("模型参数必须包含metric_type和metric_name")
+	}
 
 	model := PredictiveModel{
 		ModelName:       modelName,
@@ -354,8 +731,7 @@ func (s *StatisticsEnhancedService) CreatePredictiveModel(modelName, modelType,
 		ModelVersion:    "1.0.0",
 		ModelParameters: string(parametersJSON),
 		ModelAccuracy:   0.0, // 初始准确度
-		Status:          "training",
-		LastTrained:     time.Now(),
+		Status:          "inactive",
 	}
 
 	if err := s.postgresDB.Create(&model).Error; err != nil {
@@ -365,115 +741,354 @@ func (s *StatisticsEnhancedService) CreatePredictiveModel(modelName, modelType,
 	return &model, nil
 }
 
-// TrainPredictiveModel 训练预测模型
-func (s *StatisticsEnhancedService) TrainPredictiveModel(modelID uint, trainingData map[string]interface{}) error {
+// GetPredictiveModel 获取预测模型（含拟合参数和最近一次回测报告）
+func (s *StatisticsEnhancedService) GetPredictiveModel(modelID uint) (*PredictiveModel, error) {
 	if s.postgresDB == nil {
-		return fmt.Errorf("PostgreSQL未连接，无法训练预测模型")
+		return nil, fmt.Errorf("PostgreSQL未连接，无法获取预测模型")
 	}
+	var model PredictiveModel
+	if err := s.postgresDB.First(&model, modelID).Error; err != nil {
+		return nil, fmt.Errorf("获取预测模型失败: %w", err)
+	}
+	return &model, nil
+}
 
-	// 模拟模型训练
-	trainingDataJSON, err := json.Marshal(trainingData)
+// TrainPredictiveModel 训练预测模型并与季节性朴素基线回测对比，优于基线时才上线新参数
+// trainingData可通过values（日度数值）和start（首日，2006-01-02）直接提供训练序列，否则读取已记录的指标
+func (s *StatisticsEnhancedService) TrainPredictiveModel(modelID uint, trainingData map[string]interface{}) (*ForecastTrainingReport, error) {
+	model, err := s.GetPredictiveModel(modelID)
 	if err != nil {
-		return fmt.Errorf("序列化训练数据失败: %w", err)
+		return nil, err
 	}
 
-	// 更新模型状态和准确度
-	model := PredictiveModel{
-		TrainingData:  string(trainingDataJSON),
-		ModelAccuracy: 0.85, // 模拟训练后的准确度
-		Status:        "active",
-		LastTrained:   time.Now(),
+	var config ForecastConfig
+	if err := json.Unmarshal([]byte(model.ModelParameters), &config); err != nil {
+		return nil, fmt.Errorf("模型参数格式错误: %w", err)
 	}
+	config = config.normalize()
 
-	if err := s.postgresDB.Model(&PredictiveModel{}).Where("id = ?", modelID).Updates(model).Error; err != nil {
-		return fmt.Errorf("更新预测模型失败: %w", err)
+	values, start, err := s.forecastTrainingSeries(config, trainingData)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	forecaster, report, err := TrainForecast(model.ModelType, config, values, start)
+	if err != nil {
+		return nil, err
+	}
+
+	reportJSON, _ := json.Marshal(report)
+	updates := map[string]interface{}{"backtest_report": string(reportJSON)}
+	if report.Promoted {
+		fitted, err := json.Marshal(forecaster)
+		if err != nil {
+			return nil, fmt.Errorf("序列化模型参数失败: %w", err)
+		}
+		summary, _ := json.Marshal(map[string]interface{}{
+			"points": report.Points,
+			"start":  report.Start.Format("2006-01-02"),
+			"end":    report.End.Format("2006-01-02"),
+		})
+		updates["fitted_parameters"] = string(fitted)
+		updates["training_data"] = string(summary)
+		updates["model_accuracy"] = math.Max(0, 1-report.Candidate.MAPE)
+		updates["model_version"] = nextModelVersion(model.ModelVersion, model.FittedParameters != "")
+		updates["status"] = "active"
+		updates["last_trained"] = time.Now()
+	}
+
+	if err := s.postgresDB.Model(&PredictiveModel{}).Where("id = ?", modelID).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("更新预测模型失败: %w", err)
+	}
+
+	return report, nil
 }
 
-// GeneratePrediction 生成预测
-func (s *StatisticsEnhancedService) GeneratePrediction(modelID uint, entityType string, entityID uint, predictionType string) (*PredictionResultInterface, error) {
+// forecastTrainingSeries 获取训练序列：优先使用请求中提供的数据，否则读取天粒度汇总（尚未汇总时使用原始数据）
+func (s *StatisticsEnhancedService) forecastTrainingSeries(config ForecastConfig, trainingData map[string]interface{}) ([]float64, time.Time, error) {
+	if raw, ok := trainingData["values"]; ok {
+		var payload struct {
+			Values []float64 `json:"values"`
+			Start  string    `json:"start"`
+		}
+		data, _ := json.Marshal(map[string]interface{}{"values": raw, "start": trainingData["start"]})
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return nil, time.Time{}, fmt.Errorf("训练数据格式错误: %w", err)
+		}
+		start, err := time.Parse("2006-01-02", payload.Start)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("训练数据start格式应为2006-01-02: %w", err)
+		}
+		return payload.Values, start, nil
+	}
+
+	if s.postgresDB == nil {
+		return nil, time.Time{}, fmt.Errorf("PostgreSQL未连接，无法读取训练数据")
+	}
+
+	// 只使用已结束的完整天
+	end := truncateBucket(time.Now(), 24*time.Hour)
+	since := end.AddDate(0, 0, -config.LookbackDays)
+
+	var rollups []AnalyticsRollup
+	if err := s.postgresDB.Where("metric_type = ? AND metric_name = ? AND resolution = ? AND bucket_start >= ? AND bucket_start < ?",
+		config.MetricType, config.MetricName, RollupDay, since, end).Find(&rollups).Error; err != nil {
+		return nil, time.Time{}, fmt.Errorf("读取训练数据失败: %w", err)
+	}
+	if len(rollups) == 0 {
+		var rows []RealTimeAnalytics
+		if err := s.postgresDB.Where("metric_type = ? AND metric_name = ? AND timestamp >= ? AND timestamp < ?",
+			config.MetricType, config.MetricName, since, end).Find(&rows).Error; err != nil {
+			return nil, time.Time{}, fmt.Errorf("读取训练数据失败: %w", err)
+		}
+		rollups = BuildRollups(rows, RollupDay)
+	}
+
+	values, start := dailySeriesFromRollups(rollups, config.Aggregate)
+	if len(values) == 0 {
+		return nil, time.Time{}, fmt.Errorf("%w: 指标 %s/%s 没有可用的训练数据", ErrInsufficientData, config.MetricType, config.MetricName)
+	}
+	return values, start, nil
+}
+
+// nextModelVersion 上线新参数时递增次版本号，首次训练保持原版本
+func nextModelVersion(version string, trained bool) string {
+	if !trained {
+		return version
+	}
+	var major, minor, patch int
+	if _, err := fmt.Sscanf(version, "%d.%d.%d", &major, &minor, &patch); err != nil {
+		return "1.0.0"
+	}
+	return fmt.Sprintf("%d.%d.0", major, minor+1)
+}
+
+// GeneratePrediction 使用已上线的模型参数预测训练序列之后horizon天的值及95%区间
+func (s *StatisticsEnhancedService) GeneratePrediction(modelID uint, entityType string, entityID uint, predictionType string, horizon int) (*PredictionResultInterface, error) {
 	if s.postgresDB == nil {
 		return nil, fmt.Errorf("PostgreSQL未连接，无法生成预测")
 	}
 
 	// 获取模型信息
-	var model PredictiveModel
-	if err := s.postgresDB.First(&model, modelID).Error; err != nil {
-		return nil, fmt.Errorf("获取预测模型失败: %w", err)
+	model, err := s.GetPredictiveModel(modelID)
+	if err != nil {
+		return nil, err
 	}
 
-	if model.Status != "active" {
+	if model.Status != "active" || model.FittedParameters == "" {
 		return nil, fmt.Errorf("预测模型未激活")
 	}
 
-	// 模拟预测生成
-	predictedValue := 100.0 + math.Sin(float64(time.Now().Unix())/86400)*50                   // 模拟预测值
-	confidence := model.ModelAccuracy * (0.8 + 0.2*math.Sin(float64(time.Now().Unix())/3600)) // 模拟置信度
+	forecaster, err := LoadForecaster(model.ModelType, model.FittedParameters)
+	if err != nil {
+		return nil, err
+	}
+	if horizon <= 0 {
+		horizon = 7
+	}
+	if horizon > 365 {
+		return nil, fmt.Errorf("预测步数不能超过365")
+	}
+	forecast := forecaster.Forecast(horizon)
 
 	result := &PredictionResultInterface{
 		ModelID:        modelID,
 		EntityType:     entityType,
 		EntityID:       entityID,
 		PredictionType: predictionType,
-		PredictedValue: predictedValue,
-		Confidence:     confidence,
+		PredictedValue: forecast[0].Value,
+		Confidence:     model.ModelAccuracy,
 		Details: map[string]interface{}{
-			"model_version": model.ModelVersion,
-			"training_date": model.LastTrained,
-			"parameters":    model.ModelParameters,
+			"model_type":     model.ModelType,
+			"model_version":  model.ModelVersion,
+			"training_date":  model.LastTrained,
+			"forecast":       forecast,
+			"interval_level": 0.95,
 		},
 		Timestamp: time.Now(),
 	}
 
-	// 保存预测结果
-	predictionRecord := PredictionResult{
-		ModelID:        modelID,
-		EntityType:     entityType,
-		EntityID:       entityID,
-		PredictionType: predictionType,
-		PredictedValue: predictedValue,
-		Confidence:     confidence,
-		PredictionDate: time.Now(),
+	// 保存每一步的预测结果，PredictionDate为被预测的日期，便于之后回填实际值
+	records := make([]PredictionResult, 0, len(forecast))
+	for _, p := range forecast {
+		records = append(records, PredictionResult{
+			ModelID:        modelID,
+			EntityType:     entityType,
+			EntityID:       entityID,
+			PredictionType: predictionType,
+			PredictedValue: p.Value,
+			Confidence:     model.ModelAccuracy,
+			PredictionDate: p.Date,
+		})
 	}
-
-	if err := s.postgresDB.Create(&predictionRecord).Error; err != nil {
+	if err := s.postgresDB.Create(&records).Error; err != nil {
 		log.Printf("保存预测结果失败: %v", err)
 	}
 
 	return result, nil
 }
 
-// DetectAnomalies 检测异常
+// DetectAnomalies 在已记录的时间序列上运行异常检测，threshold>0时覆盖配置中的Z分数类阈值
 func (s *StatisticsEnhancedService) DetectAnomalies(metricName string, threshold float64) ([]AnomalyDetection, error) {
 	if s.postgresDB == nil {
 		return nil, fmt.Errorf("PostgreSQL未连接，无法检测异常")
 	}
 
-	// 模拟异常检测
-	anomalies := []AnomalyDetection{
-		{
-			AnomalyType:   "spike",
-			EntityType:    "user_activity",
+	config, err := s.GetAnomalyDetectorConfig(metricName)
+	if err != nil {
+		return nil, err
+	}
+	if !config.Enabled {
+		return []AnomalyDetection{}, nil
+	}
+	if threshold > 0 {
+		config.ZScoreThreshold = threshold
+		config.MADThreshold = threshold
+		config.SeasonalThreshold = threshold
+	}
+	config = config.normalize()
+
+	// 回溯窗口超出原始数据保留期的部分读取小时/天汇总
+	now := time.Now()
+	points, err := s.loadHistoryPoints(now.AddDate(0, 0, -config.LookbackDays), now, func(db *gorm.DB) *gorm.DB {
+		return db.Where("metric_name = ?", metricName)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取时间序列失败: %w", err)
+	}
+	if len(points) == 0 {
+		return []AnomalyDetection{}, nil
+	}
+
+	series := make([]SeriesPoint, len(points))
+	for i, p := range points {
+		series[i] = p.SeriesPoint
+	}
+
+	findings, err := RunAnomalyDetectors(series, config)
+	if err != nil {
+		return nil, err
+	}
+
+	anomalies := make([]AnomalyDetection, 0, len(findings))
+	for _, finding := range findings {
+		anomaly := AnomalyDetection{
+			AnomalyType:   finding.Type,
+			EntityType:    points[0].MetricType,
 			MetricName:    metricName,
-			ExpectedValue: 100.0,
-			ActualValue:   150.0,
-			Deviation:     0.5,
-			Severity:      "medium",
-			Description:   "用户活跃度出现异常峰值",
+			Method:        finding.Method,
+			ExpectedValue: finding.Expected,
+			ActualValue:   finding.Observed,
+			Deviation:     finding.Score,
+			Severity:      finding.Severity(),
+			Description:   describeAnomaly(metricName, finding),
 			Status:        "detected",
-			DetectedAt:    time.Now(),
-		},
-	}
+			DetectedAt:    finding.Timestamp,
+		}
 
-	// 保存异常检测结果
-	for _, anomaly := range anomalies {
+		// 同一方法在同一时间点的异常只保存一次，重复检测返回已有记录
+		var existing AnomalyDetection
+		err := s.postgresDB.Where("metric_name = ? AND method = ? AND anomaly_type = ? AND detected_at = ?",
+			metricName, finding.Method, finding.Type, finding.Timestamp).First(&existing).Error
+		if err == nil {
+			anomalies = append(anomalies, existing)
+			continue
+		}
 		if err := s.postgresDB.Create(&anomaly).Error; err != nil {
 			log.Printf("保存异常检测结果失败: %v", err)
 		}
+		anomalies = append(anomalies, anomaly)
+	}
+
+	return anomalies, nil
+}
+
+// describeAnomaly 生成异常描述
+func describeAnomaly(metricName string, finding AnomalyFinding) string {
+	methodNames := map[string]string{
+		DetectorZScore:      "滚动Z分数",
+		DetectorMAD:         "中位数绝对偏差",
+		DetectorSeasonal:    "周期分解",
+		DetectorChangePoint: "变点检测",
+	}
+	at := finding.Timestamp.Format("2006-01-02 15:04")
+	switch finding.Type {
+	case AnomalyTypePatternChange:
+		return fmt.Sprintf("[%s] 指标 %s 于 %s 发生水平变化：均值由 %.2f 变为 %.2f（偏离 %.2fσ）",
+			methodNames[finding.Method], metricName, at, finding.Expected, finding.Observed, math.Abs(finding.Score))
+	case AnomalyTypeDrop:
+		return fmt.Sprintf("[%s] 指标 %s 于 %s 异常下降：期望 %.2f，实际 %.2f（偏离 %.2fσ）",
+			methodNames[finding.Method], metricName, at, finding.Expected, finding.Observed, math.Abs(finding.Score))
+	default:
+		return fmt.Sprintf("[%s] 指标 %s 于 %s 出现异常峰值：期望 %.2f，实际 %.2f（偏离 %.2fσ）",
+			methodNames[finding.Method], metricName, at, finding.Expected, finding.Observed, math.Abs(finding.Score))
+	}
+}
+
+// GetAnomalyDetectorConfig 获取指标的异常检测配置，未配置时返回默认值
+func (s *StatisticsEnhancedService) GetAnomalyDetectorConfig(metricName string) (AnomalyDetectorConfig, error) {
+	if s.postgresDB == nil {
+		return AnomalyDetectorConfig{}, fmt.Errorf("PostgreSQL未连接，无法获取异常检测配置")
+	}
+
+	var config AnomalyDetectorConfig
+	err := s.postgresDB.Where("metric_name = ?", metricName).First(&config).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return DefaultAnomalyDetectorConfig(metricName), nil
+	}
+	if err != nil {
+		return AnomalyDetectorConfig{}, fmt.Errorf("获取异常检测配置失败: %w", err)
+	}
+	return config, nil
+}
+
+// SaveAnomalyDetectorConfig 保存指标的异常检测配置
+func (s *StatisticsEnhancedService) SaveAnomalyDetectorConfig(config AnomalyDetectorConfig) (*AnomalyDetectorConfig, error) {
+	if s.postgresDB == nil {
+		return nil, fmt.Errorf("PostgreSQL未连接，无法保存异常检测配置")
+	}
+
+	for _, method := range config.MethodList() {
+		switch method {
+		case DetectorZScore, DetectorMAD, DetectorSeasonal, DetectorChangePoint:
+		default:
+			return nil, fmt.Errorf("不支持的检测方法: %s", method)
+		}
+	}
+	config = config.normalize()
+
+	var existing AnomalyDetectorConfig
+	if err := s.postgresDB.Where("metric_name = ?", config.MetricName).First(&existing).Error; err == nil {
+		config.ID = existing.ID
+		config.CreatedAt = existing.CreatedAt
 	}
+	if err := s.postgresDB.Save(&config).Error; err != nil {
+		return nil, fmt.Errorf("保存异常检测配置失败: %w", err)
+	}
+	return &config, nil
+}
 
+// ListAnomalies 查询已检测到的异常
+func (s *StatisticsEnhancedService) ListAnomalies(metricName, severity string, limit int) ([]AnomalyDetection, error) {
+	if s.postgresDB == nil {
+		return nil, fmt.Errorf("PostgreSQL未连接，无法查询异常")
+	}
+
+	query := s.postgresDB.Order("detected_at DESC")
+	if metricName != "" {
+		query = query.Where("metric_name = ?", metricName)
+	}
+	if severity != "" {
+		query = query.Where("severity = ?", severity)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	var anomalies []AnomalyDetection
+	if err := query.Find(&anomalies).Error; err != nil {
+		return nil, fmt.Errorf("查询异常失败: %w", err)
+	}
 	return anomalies, nil
 }
 
@@ -565,6 +1180,12 @@ func (s *StatisticsEnhancedService) GetSyncStatus(entityType string, entityID ui
 
 // Close 关闭数据库连接
 func (s *StatisticsEnhancedService) Close() {
+	if s.stopRollup != nil {
+		close(s.stopRollup)
+	}
+	if s.stopReports != nil {
+		close(s.stopReports)
+	}
 	if s.neo4jDriver != nil {
 		ctx := context.Background()
 		s.neo4jDriver.Close(ctx)
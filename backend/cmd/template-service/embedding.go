@@ -0,0 +1,529 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// TemplateVectorDimension 模板向量维度，与template_vectors.content_vector一致
+const TemplateVectorDimension = 384
+
+// EmbeddingProvider 文本向量模型
+type EmbeddingProvider interface {
+	// ModelVersion 模型版本，随向量一起保存；版本变化后已有向量需要重新生成
+	ModelVersion() string
+	Dimension() int
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// 内置模型参数
+const (
+	hashedNGramModel = "hashed-ngram-v1"
+	ngramBuckets     = 1 << 18 // 稀疏特征空间大小
+	ngramProjections = 3       // 每个特征随机投影到的维度数
+)
+
+// NGramStats 语料中每个特征出现的文档数，用于计算IDF
+type NGramStats struct {
+	Documents int            `json:"documents"`
+	DF        map[uint32]int `json:"df"`
+}
+
+// FitNGramStats 统计语料的文档频率
+func FitNGramStats(corpus []string) *NGramStats {
+	stats := &NGramStats{Documents: len(corpus), DF: make(map[uint32]int)}
+	for _, text := range corpus {
+		for bucket := range ngramFeatures(text) {
+			stats.DF[bucket]++
+		}
+	}
+	return stats
+}
+
+// idf 平滑IDF；未拟合时所有特征权重相同
+func (s *NGramStats) idf(bucket uint32) float64 {
+	if s == nil || s.Documents == 0 {
+		return 1
+	}
+	return math.Log(float64(1+s.Documents)/float64(1+s.DF[bucket])) + 1
+}
+
+// fingerprint 统计数据的摘要，作为模型版本的一部分
+func (s *NGramStats) fingerprint() string {
+	if s == nil || s.Documents == 0 {
+		return "tf"
+	}
+	buckets := make([]uint32, 0, len(s.DF))
+	for bucket := range s.DF {
+		buckets = append(buckets, bucket)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+
+	h := sha256.New()
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(s.Documents))
+	h.Write(buf[:])
+	for _, bucket := range buckets {
+		binary.LittleEndian.PutUint32(buf[:4], bucket)
+		binary.LittleEndian.PutUint32(buf[4:], uint32(s.DF[bucket]))
+		h.Write(buf[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// HashedNGramEmbedder 内置向量模型：西文单词和字符三元组、中日韩单字和二元组经哈希映射到稀疏空间，
+// 按TF-IDF加权后通过稀疏随机投影降到固定维度并归一化。无外部依赖，结果确定
+type HashedNGramEmbedder struct {
+	dim     int
+	stats   *NGramStats
+	version string
+}
+
+// NewHashedNGramEmbedder 创建内置模型；stats为nil时只使用词频
+func NewHashedNGramEmbedder(dim int, stats *NGramStats) *HashedNGramEmbedder {
+	return &HashedNGramEmbedder{
+		dim:     dim,
+		stats:   stats,
+		version: fmt.Sprintf("%s-%d-%s", hashedNGramModel, dim, stats.fingerprint()),
+	}
+}
+
+func (e *HashedNGramEmbedder) ModelVersion() string { return e.version }
+func (e *HashedNGramEmbedder) Dimension() int       { return e.dim }
+
+func (e *HashedNGramEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		features := ngramFeatures(text)
+		// 按固定顺序累加，保证浮点结果可复现
+		buckets := make([]uint32, 0, len(features))
+		for bucket := range features {
+			buckets = append(buckets, bucket)
+		}
+		sort.Slice(buckets, func(a, b int) bool { return buckets[a] < buckets[b] })
+
+		vec := make([]float64, e.dim)
+		for _, bucket := range buckets {
+			weight := math.Sqrt(features[bucket]) * e.stats.idf(bucket)
+			x := uint64(bucket)
+			for j := 0; j < ngramProjections; j++ {
+				x = splitmix64(x)
+				idx := int(x % uint64(e.dim))
+				if x>>63 == 1 {
+					vec[idx] -= weight
+				} else {
+					vec[idx] += weight
+				}
+			}
+		}
+		normalizeVector(vec)
+		vectors[i] = vec
+	}
+	return vectors, nil
+}
+
+// splitmix64 由特征确定投影位置和符号的伪随机序列
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+func normalizeVector(vec []float64) {
+	var norm float64
+	for _, v := range vec {
+		norm += v * v
+	}
+	if norm == 0 {
+		return
+	}
+	norm = math.Sqrt(norm)
+	for i := range vec {
+		vec[i] /= norm
+	}
+}
+
+// 各类特征的权重：完整的词和二元组最有区分度，字符级特征用于容忍词形变化
+const (
+	weightWord      = 1.0
+	weightTrigram   = 0.25
+	weightCJKChar   = 0.5
+	weightCJKBigram = 1.0
+)
+
+// ngramFeatures 提取特征及其加权词频
+func ngramFeatures(text string) map[uint32]float64 {
+	features := make(map[uint32]float64)
+	add := func(kind byte, s string, weight float64) {
+		h := fnv.New32a()
+		h.Write([]byte{kind})
+		h.Write([]byte(s))
+		features[h.Sum32()%ngramBuckets] += weight
+	}
+
+	var word []rune
+	var wide []rune
+	flushWord := func() {
+		if len(word) == 0 {
+			return
+		}
+		add('w', string(word), weightWord)
+		if len(word) > 2 {
+			padded := append(append([]rune{'^'}, word...), '$')
+			for i := 0; i+3 <= len(padded); i++ {
+				add('t', string(padded[i:i+3]), weightTrigram)
+			}
+		}
+		word = word[:0]
+	}
+	flushWide := func() {
+		for i, r := range wide {
+			add('u', string(r), weightCJKChar)
+			if i+1 < len(wide) {
+				add('b', string(wide[i:i+2]), weightCJKBigram)
+			}
+		}
+		wide = wide[:0]
+	}
+
+	for _, r := range text {
+		// 全角字母数字转为半角
+		if r >= 0xFF01 && r <= 0xFF5E {
+			r -= 0xFEE0
+		}
+		r = unicode.ToLower(r)
+		switch {
+		case isWideRune(r) && unicode.IsLetter(r):
+			flushWord()
+			wide = append(wide, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '+' || r == '#':
+			flushWide()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushWide()
+		}
+	}
+	flushWord()
+	flushWide()
+	return features
+}
+
+// RemoteEmbeddingProvider 调用AI服务的/api/v1/ai/embedding接口（sentence-transformers模型）
+type RemoteEmbeddingProvider struct {
+	baseURL     string
+	model       string
+	dim         int
+	client      *http.Client
+	concurrency int
+}
+
+// NewRemoteEmbeddingProvider 创建远程模型；model需与AI服务加载的模型一致，用于区分向量版本
+func NewRemoteEmbeddingProvider(baseURL, model string, dim int) *RemoteEmbeddingProvider {
+	return &RemoteEmbeddingProvider{
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		model:       model,
+		dim:         dim,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		concurrency: 4,
+	}
+}
+
+func (p *RemoteEmbeddingProvider) ModelVersion() string { return "remote-" + p.model }
+func (p *RemoteEmbeddingProvider) Dimension() int       { return p.dim }
+
+// Embed AI服务每次只处理一段文本，批量请求并发发送
+func (p *RemoteEmbeddingProvider) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	errs := make([]error, len(texts))
+	sem := make(chan struct{}, p.concurrency)
+	var wg sync.WaitGroup
+	for i, text := range texts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, text string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			vectors[i], errs[i] = p.embedOne(ctx, text)
+		}(i, text)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return vectors, nil
+}
+
+func (p *RemoteEmbeddingProvider) embedOne(ctx context.Context, text string) ([]float64, error) {
+	body, _ := json.Marshal(map[string]string{"text": text})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/api/v1/ai/embedding", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("调用向量服务失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Embedding []float64 `json:"embedding"`
+		Error     string    `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("解析向量服务响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("向量服务返回%d: %s", resp.StatusCode, result.Error)
+	}
+	if len(result.Embedding) != p.dim {
+		return nil, fmt.Errorf("向量维度为%d，需要%d", len(result.Embedding), p.dim)
+	}
+	return result.Embedding, nil
+}
+
+// Vector pgvector向量，以'[x,y,...]'文本格式读写
+type Vector []float64
+
+func (v Vector) Value() (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, x := range v {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(x, 'f', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String(), nil
+}
+
+func (v *Vector) Scan(src interface{}) error {
+	var s string
+	switch src := src.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case string:
+		s = src
+	case []byte:
+		s = string(src)
+	default:
+		return fmt.Errorf("无法将%T转换为向量", src)
+	}
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '[' || s[len(s)-1] != ']' {
+		return fmt.Errorf("无效的向量: %q", s)
+	}
+	s = s[1 : len(s)-1]
+	if s == "" {
+		*v = Vector{}
+		return nil
+	}
+	parts := strings.Split(s, ",")
+	out := make(Vector, len(parts))
+	for i, part := range parts {
+		x, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return fmt.Errorf("无效的向量分量: %w", err)
+		}
+		out[i] = x
+	}
+	*v = out
+	return nil
+}
+
+func cosineSimilarity(a, b []float64) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// EmbeddingEvalSet 评测集：语料和人工标注的模板对
+type EmbeddingEvalSet struct {
+	Documents []EmbeddingEvalDocument `json:"documents"`
+	Pairs     []EmbeddingEvalPair     `json:"pairs"`
+}
+
+// EmbeddingEvalDocument 评测语料中的一个模板
+type EmbeddingEvalDocument struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+// EmbeddingEvalPair 标注的模板对，Related为false表示明确不相关
+type EmbeddingEvalPair struct {
+	A       string `json:"a"`
+	B       string `json:"b"`
+	Related bool   `json:"related"`
+}
+
+// EmbeddingEvalReport 近邻检索质量
+type EmbeddingEvalReport struct {
+	ModelVersion string `json:"model_version"`
+	Documents    int    `json:"documents"`
+	Queries      int    `json:"queries"` // 至少有一个相关模板的文档数
+	K            int    `json:"k"`
+	// RecallAtK 前K个近邻中找回的相关模板占比（按查询平均）
+	RecallAtK    float64 `json:"recall_at_k"`
+	PrecisionAt1 float64 `json:"precision_at_1"`
+	MRR          float64 `json:"mrr"`
+	// PairAUC 任取一对相关和一对不相关的标注，相关对相似度更高的概率
+	PairAUC                 float64 `json:"pair_auc"`
+	MeanRelatedSimilarity   float64 `json:"mean_related_similarity"`
+	MeanUnrelatedSimilarity float64 `json:"mean_unrelated_similarity"`
+}
+
+// EvaluateEmbeddings 用评测集衡量模型的近邻质量：每个有相关标注的文档作为查询，
+// 在其余文档中按余弦相似度排序
+func EvaluateEmbeddings(ctx context.Context, provider EmbeddingProvider, set EmbeddingEvalSet, k int) (*EmbeddingEvalReport, error) {
+	if k <= 0 {
+		k = 5
+	}
+	index := make(map[string]int, len(set.Documents))
+	texts := make([]string, len(set.Documents))
+	for i, doc := range set.Documents {
+		if _, dup := index[doc.ID]; dup {
+			return nil, fmt.Errorf("评测文档ID重复: %s", doc.ID)
+		}
+		index[doc.ID] = i
+		texts[i] = doc.Text
+	}
+	related := make(map[int]map[int]bool)
+	for _, pair := range set.Pairs {
+		a, okA := index[pair.A]
+		b, okB := index[pair.B]
+		if !okA || !okB {
+			return nil, fmt.Errorf("标注引用了不存在的文档: %s - %s", pair.A, pair.B)
+		}
+		if !pair.Related {
+			continue
+		}
+		for _, edge := range [][2]int{{a, b}, {b, a}} {
+			if related[edge[0]] == nil {
+				related[edge[0]] = make(map[int]bool)
+			}
+			related[edge[0]][edge[1]] = true
+		}
+	}
+
+	vectors, err := provider.Embed(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("生成评测向量失败: %w", err)
+	}
+
+	report := &EmbeddingEvalReport{ModelVersion: provider.ModelVersion(), Documents: len(texts), K: k}
+	for q := range texts {
+		relevant := related[q]
+		if len(relevant) == 0 {
+			continue
+		}
+		type neighbour struct {
+			doc int
+			sim float64
+		}
+		var ranked []neighbour
+		for d := range texts {
+			if d != q {
+				ranked = append(ranked, neighbour{d, cosineSimilarity(vectors[q], vectors[d])})
+			}
+		}
+		sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].sim > ranked[j].sim })
+
+		report.Queries++
+		found, first := 0, -1
+		for rank, n := range ranked {
+			if !relevant[n.doc] {
+				continue
+			}
+			if first < 0 {
+				first = rank
+			}
+			if rank < k {
+				found++
+			}
+		}
+		if first >= 0 {
+			report.MRR += 1 / float64(first+1)
+		}
+		report.RecallAtK += float64(found) / float64(len(relevant))
+		if len(ranked) > 0 && relevant[ranked[0].doc] {
+			report.PrecisionAt1++
+		}
+	}
+	if report.Queries > 0 {
+		report.RecallAtK /= float64(report.Queries)
+		report.PrecisionAt1 /= float64(report.Queries)
+		report.MRR /= float64(report.Queries)
+	}
+
+	var pos, neg []float64
+	for _, pair := range set.Pairs {
+		sim := cosineSimilarity(vectors[index[pair.A]], vectors[index[pair.B]])
+		if pair.Related {
+			pos = append(pos, sim)
+		} else {
+			neg = append(neg, sim)
+		}
+	}
+	report.MeanRelatedSimilarity = meanOf(pos)
+	report.MeanUnrelatedSimilarity = meanOf(neg)
+	if len(pos) > 0 && len(neg) > 0 {
+		var wins float64
+		for _, p := range pos {
+			for _, n := range neg {
+				switch {
+				case p > n:
+					wins++
+				case p == n:
+					wins += 0.5
+				}
+			}
+		}
+		report.PairAUC = wins / float64(len(pos)*len(neg))
+	}
+	return report, nil
+}
+
+func meanOf(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
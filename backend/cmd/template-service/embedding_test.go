@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadEmbeddingEvalSet(t *testing.T) EmbeddingEvalSet {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "embedding_eval.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var set EmbeddingEvalSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+func fittedEmbedder(set EmbeddingEvalSet) *HashedNGramEmbedder {
+	corpus := make([]string, len(set.Documents))
+	for i, doc := range set.Documents {
+		corpus[i] = doc.Text
+	}
+	return NewHashedNGramEmbedder(TemplateVectorDimension, FitNGramStats(corpus))
+}
+
+// 评测集中同一岗位的中英文模板互为干扰项：内置模型只做字面匹配，不标注跨语言的相关对
+func TestEvaluateHashedNGramEmbedder(t *testing.T) {
+	set := loadEmbeddingEvalSet(t)
+	report, err := EvaluateEmbeddings(context.Background(), fittedEmbedder(set), set, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%+v", *report)
+
+	if report.Documents != len(set.Documents) || report.Queries == 0 {
+		t.Fatalf("documents=%d queries=%d", report.Documents, report.Queries)
+	}
+	checks := []struct {
+		name      string
+		got, want float64
+	}{
+		{"recall@3", report.RecallAtK, 0.9},
+		{"P@1", report.PrecisionAt1, 0.85},
+		{"MRR", report.MRR, 0.9},
+		{"pair AUC", report.PairAUC, 0.95},
+	}
+	for _, c := range checks {
+		if c.got < c.want {
+			t.Errorf("%s = %.3f, want >= %.2f", c.name, c.got, c.want)
+		}
+	}
+	if report.MeanRelatedSimilarity <= report.MeanUnrelatedSimilarity {
+		t.Errorf("related similarity %.3f not above unrelated %.3f",
+			report.MeanRelatedSimilarity, report.MeanUnrelatedSimilarity)
+	}
+}
+
+func TestEvaluateBeatsConstantVectors(t *testing.T) {
+	// 原先的固定向量让所有模板相似度相同，作为基线
+	set := loadEmbeddingEvalSet(t)
+	baseline, err := EvaluateEmbeddings(context.Background(), constantEmbedder{}, set, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := EvaluateEmbeddings(context.Background(), fittedEmbedder(set), set, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if baseline.PairAUC != 0.5 {
+		t.Errorf("baseline AUC = %.3f, want 0.5", baseline.PairAUC)
+	}
+	if report.MRR <= baseline.MRR || report.PairAUC <= baseline.PairAUC {
+		t.Errorf("report %+v not better than baseline %+v", *report, *baseline)
+	}
+}
+
+type constantEmbedder struct{}
+
+func (constantEmbedder) ModelVersion() string { return "constant" }
+func (constantEmbedder) Dimension() int       { return TemplateVectorDimension }
+func (constantEmbedder) Embed(_ context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i := range texts {
+		vec := make([]float64, TemplateVectorDimension)
+		for j := range vec {
+			vec[j] = float64(j%100) / 100
+		}
+		vectors[i] = vec
+	}
+	return vectors, nil
+}
+
+func TestEvaluateEmbeddingsRejectsUnknownDocuments(t *testing.T) {
+	set := EmbeddingEvalSet{
+		Documents: []EmbeddingEvalDocument{{ID: "a", Text: "x"}},
+		Pairs:     []EmbeddingEvalPair{{A: "a", B: "missing", Related: true}},
+	}
+	if _, err := EvaluateEmbeddings(context.Background(), constantEmbedder{}, set, 3); err == nil {
+		t.Fatal("expected error for unknown document")
+	}
+}
+
+func TestHashedNGramEmbedder(t *testing.T) {
+	e := NewHashedNGramEmbedder(TemplateVectorDimension, nil)
+	texts := []string{
+		"Go后端开发工程师",
+		"ＧＯ后端开发工程师", // 全角字母
+		"护士 临床护理",
+		"",
+	}
+	vectors, err := e.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, vec := range vectors[:3] {
+		if len(vec) != TemplateVectorDimension {
+			t.Fatalf("vector %d has dimension %d", i, len(vec))
+		}
+		var norm float64
+		for _, v := range vec {
+			norm += v * v
+		}
+		if math.Abs(norm-1) > 1e-9 {
+			t.Errorf("vector %d norm = %f", i, norm)
+		}
+	}
+	if sim := cosineSimilarity(vectors[0], vectors[1]); math.Abs(sim-1) > 1e-9 {
+		t.Errorf("full-width text similarity = %f, want 1", sim)
+	}
+	if sim := cosineSimilarity(vectors[0], vectors[2]); sim > 0.3 {
+		t.Errorf("unrelated CJK similarity = %f", sim)
+	}
+	for _, v := range vectors[3] {
+		if v != 0 {
+			t.Fatal("empty text should embed to zero vector")
+		}
+	}
+
+	again, _ := e.Embed(context.Background(), texts[:1])
+	for i := range again[0] {
+		if again[0][i] != vectors[0][i] {
+			t.Fatal("embedding is not deterministic")
+		}
+	}
+}
+
+func TestHashedNGramModelVersion(t *testing.T) {
+	corpus := []string{"后端开发", "销售经理"}
+	a := NewHashedNGramEmbedder(TemplateVectorDimension, FitNGramStats(corpus))
+	b := NewHashedNGramEmbedder(TemplateVectorDimension, FitNGramStats(corpus))
+	if a.ModelVersion() != b.ModelVersion() {
+		t.Errorf("same corpus gave versions %s and %s", a.ModelVersion(), b.ModelVersion())
+	}
+	c := NewHashedNGramEmbedder(TemplateVectorDimension, FitNGramStats(append(corpus, "护士")))
+	if c.ModelVersion() == a.ModelVersion() {
+		t.Error("different corpus kept the same version")
+	}
+	if v := NewHashedNGramEmbedder(TemplateVectorDimension, nil).ModelVersion(); v != "hashed-ngram-v1-384-tf" {
+		t.Errorf("unfitted version = %s", v)
+	}
+
+	// 统计数据序列化后版本不变，保证重启后沿用已有向量
+	data, err := json.Marshal(a.stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats NGramStats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		t.Fatal(err)
+	}
+	if v := NewHashedNGramEmbedder(TemplateVectorDimension, &stats).ModelVersion(); v != a.ModelVersion() {
+		t.Errorf("reloaded version = %s, want %s", v, a.ModelVersion())
+	}
+}
+
+func TestVectorValueScan(t *testing.T) {
+	v := Vector{0.5, -0.25, 1}
+	value, err := v.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "[0.5,-0.25,1]" {
+		t.Errorf("Value = %v", value)
+	}
+	var scanned Vector
+	if err := scanned.Scan([]byte("[0.5, -0.25, 1]")); err != nil {
+		t.Fatal(err)
+	}
+	if len(scanned) != 3 || scanned[0] != 0.5 || scanned[1] != -0.25 || scanned[2] != 1 {
+		t.Errorf("Scan = %v", scanned)
+	}
+	if err := scanned.Scan("0.5,1"); err == nil {
+		t.Error("expected error for missing brackets")
+	}
+}
+
+func TestEmbeddingText(t *testing.T) {
+	template := &Template{
+		Name:        "简历模板",
+		Category:    "技术",
+		Description: "适合开发岗位",
+		Content:     "<h1>{{.Basics.Name}}</h1>\n<p>工作经历 &amp; 项目</p>{{range .Work}}{{.Company}}{{end}}",
+	}
+	got := embeddingText(template)
+	want := "简历模板 技术 适合开发岗位 工作经历 & 项目"
+	if got != want {
+		t.Errorf("embeddingText = %q, want %q", got, want)
+	}
+}
+
+func TestRemoteEmbeddingProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/ai/embedding" {
+			http.NotFound(w, r)
+			return
+		}
+		var req struct {
+			Text string `json:"text"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		dim := 4
+		if strings.Contains(req.Text, "short") {
+			dim = 3
+		}
+		embedding := make([]float64, dim)
+		embedding[0] = float64(len(req.Text))
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "success", "embedding": embedding, "dimension": dim})
+	}))
+	defer server.Close()
+
+	p := NewRemoteEmbeddingProvider(server.URL+"/", "test-model", 4)
+	if p.ModelVersion() != "remote-test-model" {
+		t.Errorf("ModelVersion = %s", p.ModelVersion())
+	}
+	vectors, err := p.Embed(context.Background(), []string{"a", "bbb", "cc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []float64{1, 3, 2} {
+		if vectors[i][0] != want {
+			t.Errorf("vector %d = %v, results out of order", i, vectors[i])
+		}
+	}
+	if _, err := p.Embed(context.Background(), []string{"ok", "short"}); err == nil {
+		t.Error("expected dimension mismatch error")
+	}
+}
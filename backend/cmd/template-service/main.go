@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"log"
@@ -28,6 +29,11 @@ func main() {
 	}
 	defer core.Close()
 
+	// 模板版本和按版本记录的评分
+	if err := core.GetDB().AutoMigrate(&TemplateVersion{}, &Rating{}); err != nil {
+		log.Printf("模板版本表迁移失败: %v", err)
+	}
+
 	// 初始化模板增强服务
 	enhancedService, err := NewTemplateEnhancedService(core)
 	if err != nil {
@@ -180,13 +186,16 @@ func setupBusinessRoutes(r *gin.Engine, core *jobfirst.Core) {
 			// 使用核心包的数据库管理器
 			db := core.GetDB()
 			var template Template
-			if err := db.First(&template, templateID).Error; err != nil {
+			// 未发布的模板不公开
+			if err := db.Where("is_active = true").First(&template, templateID).Error; err != nil {
 				standardErrorResponse(c, http.StatusNotFound, "Template not found", err.Error())
 				return
 			}
 
-			// 增加使用次数
-			db.Model(&template).Update("usage", template.Usage+1)
+			// 增加使用次数（同时计入当前发布版本）
+			if err := RecordTemplateUsage(db, template.ID); err != nil {
+				log.Printf("记录模板使用次数失败: %v", err)
+			}
 
 			standardSuccessResponse(c, template, "Template retrieved successfully")
 		})
@@ -240,35 +249,36 @@ func setupBusinessRoutes(r *gin.Engine, core *jobfirst.Core) {
 				}
 				userID := userIDInterface.(uint)
 
-				var template Template
-				if err := c.ShouldBindJSON(&template); err != nil {
+				var input TemplateVersionInput
+				if err := c.ShouldBindJSON(&input); err != nil {
 					standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
 					return
 				}
+				if input.Name == "" || input.Category == "" {
+					standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", "name and category are required")
+					return
+				}
 
-				// 使用核心包的数据库管理器
+				// 新模板以草稿保存，审核通过后公开
 				db := core.GetDB()
-				template.CreatedBy = userID
-				template.CreatedAt = time.Now()
-				template.UpdatedAt = time.Now()
-				template.IsActive = true
-				template.Usage = 0
-				template.Rating = 0.0
-
-				if err := db.Create(&template).Error; err != nil {
+				template, draft, err := CreateTemplateDraft(db, userID, input)
+				if err != nil {
 					standardErrorResponse(c, http.StatusInternalServerError, "Failed to create template", err.Error())
 					return
 				}
 
-				standardSuccessResponse(c, template, "Template created successfully")
+				standardSuccessResponse(c, gin.H{
+					"template": template,
+					"draft":    draft,
+				}, "Template created as draft")
 			})
 
 			// 更新模板
 			templates.PUT("/:id", func(c *gin.Context) {
 				templateID, _ := strconv.Atoi(c.Param("id"))
 
-				var updateData Template
-				if err := c.ShouldBindJSON(&updateData); err != nil {
+				var input TemplateVersionInput
+				if err := c.ShouldBindJSON(&input); err != nil {
 					standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
 					return
 				}
@@ -291,18 +301,14 @@ func setupBusinessRoutes(r *gin.Engine, core *jobfirst.Core) {
 					return
 				}
 
-				updateData.ID = uint(templateID)
-				updateData.UpdatedAt = time.Now()
-				// 不允许更新使用次数和评分
-				updateData.Usage = template.Usage
-				updateData.Rating = template.Rating
-
-				if err := db.Save(&updateData).Error; err != nil {
-					standardErrorResponse(c, http.StatusInternalServerError, "Failed to update template", err.Error())
+				// 修改写入草稿，发布版本保持不变，直到草稿审核通过
+				draft, err := SaveTemplateDraft(db, template.ID, userID, input)
+				if err != nil {
+					respondTemplateVersionError(c, err)
 					return
 				}
 
-				standardSuccessResponse(c, updateData, "Template updated successfully")
+				standardSuccessResponse(c, draft, "Template draft saved")
 			})
 
 			// 删除模板
@@ -348,6 +354,44 @@ func setupBusinessRoutes(r *gin.Engine, core *jobfirst.Core) {
 					return
 				}
 
+				// 评分记在当前发布版本上，模板评分为所有版本的平均值
+				userIDInterface, _ := c.Get("user_id")
+				userID := userIDInterface.(uint)
+
+				avgRating, version, err := RateTemplate(core.GetDB(), uint(templateID), userID, ratingRequest.Rating)
+				if err != nil {
+					respondTemplateVersionError(c, err)
+					return
+				}
+
+				standardSuccessResponse(c, gin.H{
+					"rating":               avgRating,
+					"version":              version.Version,
+					"version_rating":       version.Rating,
+					"version_rating_count": version.RatingCount,
+				}, "Template rated successfully")
+			})
+
+			// 渲染简历：将简历数据绑定到模板，输出HTML、PDF或DOCX
+			templates.POST("/:id/render", func(c *gin.Context) {
+				templateID, _ := strconv.Atoi(c.Param("id"))
+
+				var renderRequest struct {
+					Format   string      `json:"format"`
+					ResumeID uint        `json:"resume_id"`
+					Data     *ResumeData `json:"data"`
+					Version  int         `json:"version"` // 预览指定版本，默认为当前发布版本
+				}
+				c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, 1<<20)
+				if err := c.ShouldBindJSON(&renderRequest); err != nil {
+					standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+					return
+				}
+				if renderRequest.ResumeID == 0 && renderRequest.Data == nil {
+					standardErrorResponse(c, http.StatusBadRequest, "resume_id or data is required", "")
+					return
+				}
+
 				db := core.GetDB()
 				var template Template
 				if err := db.First(&template, templateID).Error; err != nil {
@@ -355,42 +399,74 @@ func setupBusinessRoutes(r *gin.Engine, core *jobfirst.Core) {
 					return
 				}
 
-				// 更新评分（简单平均算法）
-				userIDInterface, _ := c.Get("user_id")
-				userID := userIDInterface.(uint)
-
-				// 检查用户是否已经评分过
-				var existingRating Rating
-				err := db.Where("template_id = ? AND user_id = ?", templateID, userID).First(&existingRating).Error
+				content := template.Content
+				if renderRequest.Version != 0 {
+					version, err := GetTemplateVersion(db, template.ID, renderRequest.Version)
+					if err != nil {
+						respondTemplateVersionError(c, err)
+						return
+					}
+					// 未发布的版本只有作者和管理员可以预览
+					if version.Status != TemplateVersionPublished && !canManageTemplate(c, &template) {
+						standardErrorResponse(c, http.StatusForbidden, "Insufficient permissions", "")
+						return
+					}
+					content = version.Content
+				} else if !template.IsActive && !canManageTemplate(c, &template) {
+					standardErrorResponse(c, http.StatusNotFound, "Template not found", "")
+					return
+				}
 
-				if err == nil {
-					// 用户已经评分过，更新评分
-					existingRating.Rating = ratingRequest.Rating
-					existingRating.UpdatedAt = time.Now()
-					db.Save(&existingRating)
-				} else {
-					// 新评分
-					newRating := Rating{
-						TemplateID: uint(templateID),
-						UserID:     userID,
-						Rating:     ratingRequest.Rating,
-						CreatedAt:  time.Now(),
-						UpdatedAt:  time.Now(),
+				data := renderRequest.Data
+				if renderRequest.ResumeID != 0 {
+					// 管理员可以渲染任意简历，其他用户只能渲染自己的简历
+					userIDInterface, _ := c.Get("user_id")
+					owner := userIDInterface.(uint)
+					if role := c.GetString("role"); role == "admin" || role == "super_admin" {
+						owner = 0
+					}
+					loaded, err := LoadResumeData(db, renderRequest.ResumeID, owner)
+					switch {
+					case errors.Is(err, ErrResumeNotFound):
+						standardErrorResponse(c, http.StatusNotFound, "Resume not found", err.Error())
+						return
+					case errors.Is(err, ErrResumeForbidden):
+						standardErrorResponse(c, http.StatusForbidden, "Insufficient permissions", err.Error())
+						return
+					case err != nil:
+						standardErrorResponse(c, http.StatusInternalServerError, "Failed to load resume", err.Error())
+						return
 					}
-					db.Create(&newRating)
+					data = loaded
 				}
 
-				// 重新计算平均评分
-				var avgRating float64
-				db.Model(&Rating{}).Where("template_id = ?", templateID).Select("AVG(rating)").Scan(&avgRating)
+				format := renderRequest.Format
+				if format == "" {
+					format = c.DefaultQuery("format", ResumeFormatHTML)
+				}
+				rendered, err := RenderResume(content, data, format, resumeRenderOptionsFromEnv())
+				if err != nil {
+					standardErrorResponse(c, http.StatusUnprocessableEntity, "Failed to render template", err.Error())
+					return
+				}
 
-				// 更新模板评分
-				db.Model(&template).Update("rating", avgRating)
+				// 渲染发布版本计入模板使用次数
+				if renderRequest.Version == 0 {
+					if err := RecordTemplateUsage(db, template.ID); err != nil {
+						log.Printf("记录模板使用次数失败: %v", err)
+					}
+				}
 
-				standardSuccessResponse(c, gin.H{
-					"rating": avgRating,
-				}, "Template rated successfully")
+				disposition := "attachment"
+				if rendered.Extension == ResumeFormatHTML {
+					disposition = "inline"
+				}
+				c.Header("Content-Disposition", fmt.Sprintf(`%s; filename="resume-%d.%s"`, disposition, templateID, rendered.Extension))
+				c.Data(http.StatusOK, rendered.ContentType, rendered.Content)
 			})
+
+			// 版本、草稿和发布审核
+			setupTemplateVersionRoutes(templates, core)
 		}
 	}
 }
@@ -483,6 +559,7 @@ type Rating struct {
 	ID         uint      `json:"id" gorm:"primaryKey"`
 	TemplateID uint      `json:"template_id" gorm:"not null"`
 	UserID     uint      `json:"user_id" gorm:"not null"`
+	Version    int       `json:"version" gorm:"not null;default:1"` // 评分时的发布版本
 	Rating     float64   `json:"rating" gorm:"not null"`
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
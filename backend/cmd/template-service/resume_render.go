@@ -0,0 +1,871 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"gorm.io/gorm"
+)
+
+// 简历输出格式
+const (
+	ResumeFormatHTML = "html"
+	ResumeFormatPDF  = "pdf"
+	ResumeFormatDOCX = "docx"
+)
+
+// ResumeData 简历渲染数据，对应V3简历模型（工作、教育、项目、技能、证书）
+type ResumeData struct {
+	Basics         ResumeBasics          `json:"basics"`
+	Work           []ResumeWork          `json:"work"`
+	Education      []ResumeEducation     `json:"education"`
+	Projects       []ResumeProject       `json:"projects"`
+	Skills         []ResumeSkill         `json:"skills"`
+	Certifications []ResumeCertification `json:"certifications"`
+}
+
+// ResumeBasics 基本信息
+type ResumeBasics struct {
+	Name     string `json:"name"`
+	Headline string `json:"headline"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
+	Location string `json:"location"`
+	Website  string `json:"website"`
+	Summary  string `json:"summary"`
+}
+
+// ResumeWork 工作经历，日期格式为2006-01或2006-01-02
+type ResumeWork struct {
+	Company     string   `json:"company"`
+	Position    string   `json:"position"`
+	StartDate   string   `json:"start_date"`
+	EndDate     string   `json:"end_date"`
+	IsCurrent   bool     `json:"is_current"`
+	Description string   `json:"description"`
+	Highlights  []string `json:"highlights"`
+}
+
+// ResumeEducation 教育经历
+type ResumeEducation struct {
+	School      string `json:"school"`
+	Degree      string `json:"degree"`
+	Major       string `json:"major"`
+	StartDate   string `json:"start_date"`
+	EndDate     string `json:"end_date"`
+	IsCurrent   bool   `json:"is_current"`
+	Description string `json:"description"`
+}
+
+// ResumeProject 项目经历
+type ResumeProject struct {
+	Name         string   `json:"name"`
+	Role         string   `json:"role"`
+	StartDate    string   `json:"start_date"`
+	EndDate      string   `json:"end_date"`
+	IsCurrent    bool     `json:"is_current"`
+	Description  string   `json:"description"`
+	Technologies []string `json:"technologies"`
+	URL          string   `json:"url"`
+}
+
+// ResumeSkill 技能
+type ResumeSkill struct {
+	Name     string  `json:"name"`
+	Category string  `json:"category"`
+	Level    string  `json:"level"`
+	Years    float64 `json:"years"`
+}
+
+// ResumeCertification 证书
+type ResumeCertification struct {
+	Name          string `json:"name"`
+	Issuer        string `json:"issuer"`
+	IssueDate     string `json:"issue_date"`
+	ExpiryDate    string `json:"expiry_date"`
+	CredentialURL string `json:"credential_url"`
+}
+
+// SkillGroup 同一分类的技能
+type SkillGroup struct {
+	Category string
+	Skills   []ResumeSkill
+}
+
+// SkillsByCategory 按分类分组技能，分类按首次出现的顺序排列
+func (d ResumeData) SkillsByCategory() []SkillGroup {
+	var groups []SkillGroup
+	index := make(map[string]int)
+	for _, skill := range d.Skills {
+		category := skill.Category
+		if category == "" {
+			category = "其他"
+		}
+		i, ok := index[category]
+		if !ok {
+			i = len(groups)
+			index[category] = i
+			groups = append(groups, SkillGroup{Category: category})
+		}
+		groups[i].Skills = append(groups[i].Skills, skill)
+	}
+	return groups
+}
+
+// DefaultResumeTemplate 模板内容为空时使用的默认双栏简历模板
+const DefaultResumeTemplate = `<h1>{{.Basics.Name}}</h1>
+<p class="muted">{{join " · " .Basics.Headline .Basics.Email .Basics.Phone .Basics.Location .Basics.Website}}</p>
+{{with .Basics.Summary}}<p>{{.}}</p>{{end}}
+<div class="columns">
+<div class="column" data-width="64">
+{{if .Work}}<h2>工作经历</h2>
+{{range .Work}}<h3>{{.Position}}{{with .Company}} · {{.}}{{end}}</h3>
+<p class="muted">{{dateRange .StartDate .EndDate .IsCurrent}}</p>
+{{with .Description}}<p>{{.}}</p>{{end}}
+{{if .Highlights}}<ul>{{range .Highlights}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{end}}{{end}}
+{{if .Projects}}<h2>项目经历</h2>
+{{range .Projects}}<h3>{{.Name}}{{with .Role}} · {{.}}{{end}}</h3>
+<p class="muted">{{join " · " (dateRange .StartDate .EndDate .IsCurrent) (joinList ", " .Technologies)}}</p>
+{{with .Description}}<p>{{.}}</p>{{end}}
+{{end}}{{end}}
+</div>
+<div class="column" data-width="36">
+{{if .Skills}}<h2>专业技能</h2>
+{{range .SkillsByCategory}}<h3>{{.Category}}</h3>
+<ul>{{range .Skills}}<li><strong>{{.Name}}</strong>{{with .Level}} · {{.}}{{end}}</li>{{end}}</ul>
+{{end}}{{end}}
+{{if .Education}}<h2>教育背景</h2>
+{{range .Education}}<h3>{{.School}}</h3>
+<p>{{join " · " .Degree .Major}}</p>
+<p class="muted">{{dateRange .StartDate .EndDate .IsCurrent}}</p>
+{{end}}{{end}}
+{{if .Certifications}}<h2>证书</h2>
+<ul>{{range .Certifications}}<li><strong>{{.Name}}</strong>{{with .Issuer}} · {{.}}{{end}}{{with .IssueDate}} · {{formatDate .}}{{end}}</li>{{end}}</ul>
+{{end}}
+</div>
+</div>
+`
+
+// formatResumeDate 将2006-01-02、2006-01格式的日期统一为2006.01，其他格式（如只有年份）原样返回
+func formatResumeDate(value string) string {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.RFC3339, "2006-01-02", "2006-01", "2006/01", "2006.01"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("2006.01")
+		}
+	}
+	return value
+}
+
+// resumeTemplateFuncs 模板可用的辅助函数
+var resumeTemplateFuncs = template.FuncMap{
+	"formatDate": formatResumeDate,
+	// dateRange 起止日期区间，current为true时结束日期显示为"至今"，英文模板可传入第四个参数替换（如"Present"）
+	"dateRange": func(start, end string, current bool, present ...string) string {
+		start, end = formatResumeDate(start), formatResumeDate(end)
+		switch {
+		case current:
+			end = "至今"
+			if len(present) > 0 {
+				end = present[0]
+			}
+		case end == "":
+			return start
+		}
+		if start == "" {
+			return end
+		}
+		return start + " - " + end
+	},
+	// join 用分隔符连接非空字符串
+	"join": func(sep string, values ...string) string {
+		return joinNonEmpty(sep, values)
+	},
+	"joinList": func(sep string, values []string) string {
+		return joinNonEmpty(sep, values)
+	},
+}
+
+func joinNonEmpty(sep string, values []string) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			parts = append(parts, v)
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+// BindResumeTemplate 使用Go html/template语法将简历数据绑定到模板，输出排版用的HTML片段
+func BindResumeTemplate(content string, data *ResumeData) (string, error) {
+	if strings.TrimSpace(content) == "" {
+		content = DefaultResumeTemplate
+	}
+	tmpl, err := template.New("resume").Funcs(resumeTemplateFuncs).Option("missingkey=zero").Parse(content)
+	if err != nil {
+		return "", fmt.Errorf("模板语法错误: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("模板渲染失败: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// 排版块类型
+const (
+	BlockHeading   = "heading"
+	BlockParagraph = "paragraph"
+	BlockListItem  = "list_item"
+	BlockRule      = "rule"
+	BlockPageBreak = "page_break"
+	BlockColumns   = "columns"
+)
+
+// ResumeRun 一段相同样式的文字；Break表示换行
+type ResumeRun struct {
+	Text   string
+	Bold   bool
+	Italic bool
+	Break  bool
+}
+
+// ResumeBlock 排版块
+type ResumeBlock struct {
+	Kind    string
+	Level   int  // 标题级别1-3；列表嵌套层级，从1开始
+	Ordered bool // 有序列表
+	Number  int  // 有序列表序号
+	Muted   bool // class="muted"的段落：次要信息，小字灰色
+	Runs    []ResumeRun
+	Columns []ResumeColumn
+}
+
+// ResumeColumn 多栏布局中的一栏，Width为所占宽度比例
+type ResumeColumn struct {
+	Width  float64
+	Blocks []ResumeBlock
+}
+
+// ResumeDocument 与输出格式无关的简历排版结构
+type ResumeDocument struct {
+	Title  string
+	Blocks []ResumeBlock
+}
+
+// ParseResumeDocument 将绑定后的HTML解析为排版结构。支持的子集：
+// h1-h6（h4以下按h3处理）、p（class="muted"为次要信息）、ul/ol/li（可嵌套）、hr、br、
+// strong/b、em/i；class="page-break"或样式含page-break-before/after:always的元素表示分页；
+// class="columns"的元素按子元素分栏，data-width为该栏宽度百分比。其余元素按容器处理，样式表被忽略
+func ParseResumeDocument(markup string) (*ResumeDocument, error) {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(markup), body)
+	if err != nil {
+		return nil, fmt.Errorf("解析模板输出失败: %w", err)
+	}
+	p := &layoutParser{}
+	for _, n := range nodes {
+		p.node(n, runStyle{})
+	}
+	p.flush()
+
+	doc := &ResumeDocument{Blocks: p.out}
+	doc.Title = firstHeadingText(doc.Blocks)
+	return doc, nil
+}
+
+// firstHeadingText 文档标题取第一个一级标题
+func firstHeadingText(blocks []ResumeBlock) string {
+	for _, b := range blocks {
+		if b.Kind == BlockHeading && b.Level == 1 {
+			return runsText(b.Runs)
+		}
+		if b.Kind == BlockColumns {
+			for _, col := range b.Columns {
+				if title := firstHeadingText(col.Blocks); title != "" {
+					return title
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func runsText(runs []ResumeRun) string {
+	var b strings.Builder
+	for _, r := range runs {
+		if r.Break {
+			b.WriteString(" ")
+			continue
+		}
+		b.WriteString(r.Text)
+	}
+	return b.String()
+}
+
+type runStyle struct {
+	bold, italic bool
+}
+
+type listState struct {
+	ordered bool
+	count   int
+}
+
+// layoutParser 将HTML节点转换为排版块；块级元素之间的零散文字合并为隐式段落
+type layoutParser struct {
+	out   []ResumeBlock
+	runs  []ResumeRun
+	lists []listState
+}
+
+func (p *layoutParser) flush() {
+	if runs := normalizeRuns(p.runs); len(runs) > 0 {
+		p.out = append(p.out, ResumeBlock{Kind: BlockParagraph, Runs: runs})
+	}
+	p.runs = nil
+}
+
+func (p *layoutParser) children(n *html.Node, style runStyle) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		p.node(c, style)
+	}
+}
+
+func (p *layoutParser) node(n *html.Node, style runStyle) {
+	switch n.Type {
+	case html.TextNode:
+		p.runs = append(p.runs, ResumeRun{Text: n.Data, Bold: style.bold, Italic: style.italic})
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	if isPageBreak(n) {
+		p.flush()
+		p.out = append(p.out, ResumeBlock{Kind: BlockPageBreak})
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Head, atom.Title, atom.Template:
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		p.flush()
+		level := int(n.Data[1] - '0')
+		if level > 3 {
+			level = 3
+		}
+		p.appendBlock(ResumeBlock{Kind: BlockHeading, Level: level, Runs: p.inlineRuns(n, style, false)})
+	case atom.P:
+		p.flush()
+		p.appendBlock(ResumeBlock{Kind: BlockParagraph, Muted: hasClass(n, "muted"), Runs: p.inlineRuns(n, style, false)})
+	case atom.Ul, atom.Ol:
+		p.flush()
+		p.lists = append(p.lists, listState{ordered: n.DataAtom == atom.Ol})
+		p.children(n, style)
+		p.flush()
+		p.lists = p.lists[:len(p.lists)-1]
+	case atom.Li:
+		p.flush()
+		if len(p.lists) == 0 {
+			p.lists = append(p.lists, listState{})
+			defer func() { p.lists = p.lists[:len(p.lists)-1] }()
+		}
+		list := &p.lists[len(p.lists)-1]
+		list.count++
+		p.appendBlock(ResumeBlock{
+			Kind:    BlockListItem,
+			Level:   len(p.lists),
+			Ordered: list.ordered,
+			Number:  list.count,
+			Runs:    p.inlineRuns(n, style, true),
+		})
+		// 嵌套列表作为下一级列表项输出
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.DataAtom == atom.Ul || c.DataAtom == atom.Ol {
+				p.node(c, style)
+			}
+		}
+	case atom.Hr:
+		p.flush()
+		if !hasClass(n, "page-break") {
+			p.out = append(p.out, ResumeBlock{Kind: BlockRule})
+		}
+	case atom.Br:
+		p.runs = append(p.runs, ResumeRun{Break: true})
+	case atom.B, atom.Strong:
+		p.children(n, runStyle{bold: true, italic: style.italic})
+	case atom.I, atom.Em:
+		p.children(n, runStyle{bold: style.bold, italic: true})
+	default:
+		switch {
+		case hasClass(n, "columns"):
+			p.flush()
+			if block, ok := parseColumns(n); ok {
+				p.out = append(p.out, block)
+			}
+		case isBlockElement(n):
+			p.flush()
+			p.children(n, style)
+			p.flush()
+		default:
+			p.children(n, style)
+		}
+	}
+
+	if isPageBreakAfter(n) {
+		p.flush()
+		p.out = append(p.out, ResumeBlock{Kind: BlockPageBreak})
+	}
+}
+
+// appendBlock 忽略没有文字的标题、段落和列表项
+func (p *layoutParser) appendBlock(b ResumeBlock) {
+	if len(b.Runs) > 0 {
+		p.out = append(p.out, b)
+	}
+}
+
+// inlineRuns 收集元素内的文字；skipLists为true时跳过嵌套列表
+func (p *layoutParser) inlineRuns(n *html.Node, style runStyle, skipLists bool) []ResumeRun {
+	saved := p.runs
+	p.runs = nil
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if skipLists && (c.DataAtom == atom.Ul || c.DataAtom == atom.Ol) {
+			continue
+		}
+		p.inline(c, style)
+	}
+	runs := normalizeRuns(p.runs)
+	p.runs = saved
+	return runs
+}
+
+// inline 块内的元素一律按行内处理
+func (p *layoutParser) inline(n *html.Node, style runStyle) {
+	switch n.Type {
+	case html.TextNode:
+		p.runs = append(p.runs, ResumeRun{Text: n.Data, Bold: style.bold, Italic: style.italic})
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	switch n.DataAtom {
+	case atom.Script, atom.Style:
+		return
+	case atom.Br:
+		p.runs = append(p.runs, ResumeRun{Break: true})
+		return
+	case atom.B, atom.Strong:
+		style.bold = true
+	case atom.I, atom.Em:
+		style.italic = true
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		p.inline(c, style)
+	}
+}
+
+// parseColumns 每个子元素为一栏；未指定data-width的栏平分剩余宽度
+func parseColumns(n *html.Node) (ResumeBlock, bool) {
+	block := ResumeBlock{Kind: BlockColumns}
+	var specified float64
+	unspecified := 0
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		sub := &layoutParser{}
+		sub.node(c, runStyle{})
+		sub.flush()
+
+		width := 0.0
+		if v, err := strconv.ParseFloat(strings.TrimSuffix(attr(c, "data-width"), "%"), 64); err == nil && v > 0 {
+			width = v / 100
+			specified += width
+		} else {
+			unspecified++
+		}
+		block.Columns = append(block.Columns, ResumeColumn{Width: width, Blocks: sub.out})
+	}
+	if len(block.Columns) == 0 {
+		return block, false
+	}
+
+	remaining := math.Max(1-specified, 0)
+	for i := range block.Columns {
+		if block.Columns[i].Width == 0 {
+			if remaining > 0 {
+				block.Columns[i].Width = remaining / float64(unspecified)
+			} else {
+				block.Columns[i].Width = 1 / float64(len(block.Columns))
+			}
+		}
+	}
+	// 归一化，宽度之和为1
+	var total float64
+	for _, col := range block.Columns {
+		total += col.Width
+	}
+	for i := range block.Columns {
+		block.Columns[i].Width /= total
+	}
+	return block, true
+}
+
+// normalizeRuns 按HTML规则折叠空白，去掉首尾空白并合并相邻同样式的文字
+func normalizeRuns(runs []ResumeRun) []ResumeRun {
+	var out []ResumeRun
+	trimTrailing := func() {
+		if n := len(out); n > 0 && !out[n-1].Break {
+			out[n-1].Text = strings.TrimRight(out[n-1].Text, " ")
+			if out[n-1].Text == "" {
+				out = out[:n-1]
+			}
+		}
+	}
+
+	lastSpace := true
+	for _, r := range runs {
+		if r.Break {
+			trimTrailing()
+			out = append(out, ResumeRun{Break: true})
+			lastSpace = true
+			continue
+		}
+		var b strings.Builder
+		for _, ch := range r.Text {
+			if unicode.IsSpace(ch) {
+				if !lastSpace {
+					b.WriteByte(' ')
+					lastSpace = true
+				}
+				continue
+			}
+			b.WriteRune(ch)
+			lastSpace = false
+		}
+		if b.Len() == 0 {
+			continue
+		}
+		if n := len(out); n > 0 && !out[n-1].Break && out[n-1].Bold == r.Bold && out[n-1].Italic == r.Italic {
+			out[n-1].Text += b.String()
+		} else {
+			out = append(out, ResumeRun{Text: b.String(), Bold: r.Bold, Italic: r.Italic})
+		}
+	}
+	trimTrailing()
+	for len(out) > 0 && out[len(out)-1].Break {
+		out = out[:len(out)-1]
+	}
+	return out
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+func styleHas(n *html.Node, property string) bool {
+	style := strings.ToLower(strings.ReplaceAll(attr(n, "style"), " ", ""))
+	return strings.Contains(style, property+":always") || strings.Contains(style, property+":page")
+}
+
+// isPageBreak 元素之前分页
+func isPageBreak(n *html.Node) bool {
+	return hasClass(n, "page-break") || styleHas(n, "page-break-before") || styleHas(n, "break-before")
+}
+
+// isPageBreakAfter 元素之后分页
+func isPageBreakAfter(n *html.Node) bool {
+	return styleHas(n, "page-break-after") || styleHas(n, "break-after")
+}
+
+// isBlockElement 作为容器处理的块级元素，其前后的文字不会合并到同一段落
+func isBlockElement(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Div, atom.Section, atom.Article, atom.Header, atom.Footer, atom.Main, atom.Aside,
+		atom.Nav, atom.Body, atom.Html, atom.Table, atom.Tbody, atom.Thead, atom.Tr, atom.Td, atom.Th,
+		atom.Blockquote, atom.Address, atom.Dl, atom.Dt, atom.Dd, atom.Figure, atom.Pre:
+		return true
+	}
+	return false
+}
+
+// ResumeRenderOptions 渲染选项
+type ResumeRenderOptions struct {
+	// FontFamily HTML和DOCX中使用的字体名称，需包含中文字形
+	FontFamily string
+	// FontFile PDF嵌入的TrueType字体；为空时使用内置字体，内容包含中文等字符时PDF渲染返回ErrResumeFontRequired
+	FontFile string
+	// BoldFontFile PDF粗体字体，为空时粗体与常规字体相同
+	BoldFontFile string
+	// CreatedAt 写入PDF和DOCX元数据的创建时间
+	CreatedAt time.Time
+	// DisableCompression 不压缩PDF内容流，便于比对输出
+	DisableCompression bool
+}
+
+// DefaultResumeFontFamily 默认字体，依次回退到常见的中文字体
+const DefaultResumeFontFamily = "Noto Sans CJK SC"
+
+// resumeRenderOptionsFromEnv 从环境变量读取字体配置
+func resumeRenderOptionsFromEnv() ResumeRenderOptions {
+	opts := ResumeRenderOptions{
+		FontFamily:   os.Getenv("TEMPLATE_RENDER_FONT_FAMILY"),
+		FontFile:     os.Getenv("TEMPLATE_RENDER_FONT"),
+		BoldFontFile: os.Getenv("TEMPLATE_RENDER_FONT_BOLD"),
+	}
+	if opts.FontFamily == "" {
+		opts.FontFamily = DefaultResumeFontFamily
+	}
+	return opts
+}
+
+// RenderedResume 渲染结果
+type RenderedResume struct {
+	Content     []byte
+	ContentType string
+	Extension   string
+}
+
+// RenderResume 绑定数据并按指定格式输出
+func RenderResume(content string, data *ResumeData, format string, opts ResumeRenderOptions) (*RenderedResume, error) {
+	if opts.FontFamily == "" {
+		opts.FontFamily = DefaultResumeFontFamily
+	}
+	if opts.CreatedAt.IsZero() {
+		opts.CreatedAt = time.Now()
+	}
+
+	markup, err := BindResumeTemplate(content, data)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := ParseResumeDocument(markup)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Title == "" {
+		doc.Title = data.Basics.Name
+	}
+
+	switch format {
+	case ResumeFormatHTML, "":
+		return &RenderedResume{Content: RenderResumeHTML(doc, opts), ContentType: "text/html; charset=utf-8", Extension: "html"}, nil
+	case ResumeFormatPDF:
+		out, err := RenderResumePDF(doc, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &RenderedResume{Content: out, ContentType: "application/pdf", Extension: "pdf"}, nil
+	case ResumeFormatDOCX:
+		out, err := RenderResumeDOCX(doc, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &RenderedResume{
+			Content:     out,
+			ContentType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+			Extension:   "docx",
+		}, nil
+	default:
+		return nil, fmt.Errorf("不支持的输出格式: %s", format)
+	}
+}
+
+// 加载简历数据的错误
+var (
+	ErrResumeNotFound  = errors.New("简历不存在")
+	ErrResumeForbidden = errors.New("无权访问该简历")
+)
+
+// LoadResumeData 从V3简历表加载渲染数据；userID不为0时只允许加载本人的简历
+func LoadResumeData(db *gorm.DB, resumeID, userID uint) (*ResumeData, error) {
+	var resume struct {
+		UserID    uint
+		Title     string
+		Summary   string
+		Username  string
+		FirstName string
+		LastName  string
+		Email     string
+		Phone     string
+	}
+	err := db.Raw(`
+		SELECT r.user_id, r.title, r.summary, u.username, u.first_name, u.last_name, u.email, u.phone
+		FROM resumes r LEFT JOIN users u ON u.id = r.user_id
+		WHERE r.id = ? AND r.deleted_at IS NULL`, resumeID).Scan(&resume).Error
+	if err != nil {
+		return nil, fmt.Errorf("获取简历失败: %w", err)
+	}
+	if resume.UserID == 0 {
+		return nil, ErrResumeNotFound
+	}
+	if userID != 0 && resume.UserID != userID {
+		return nil, ErrResumeForbidden
+	}
+
+	name := strings.TrimSpace(resume.LastName + resume.FirstName)
+	if name == "" {
+		name = resume.Username
+	}
+	data := &ResumeData{Basics: ResumeBasics{
+		Name:     name,
+		Headline: resume.Title,
+		Email:    resume.Email,
+		Phone:    resume.Phone,
+		Summary:  resume.Summary,
+	}}
+
+	month := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format("2006-01")
+	}
+
+	var work []struct {
+		Title       string
+		Company     string
+		Position    string
+		StartDate   *time.Time
+		EndDate     *time.Time
+		IsCurrent   bool
+		Description string
+	}
+	if err := db.Raw(`
+		SELECT we.title, c.name AS company, p.name AS position, we.start_date, we.end_date, we.is_current, we.description
+		FROM work_experiences we
+		LEFT JOIN companies c ON c.id = we.company_id
+		LEFT JOIN positions p ON p.id = we.position_id
+		WHERE we.resume_id = ?
+		ORDER BY we.is_current DESC, we.start_date DESC`, resumeID).Scan(&work).Error; err != nil {
+		return nil, fmt.Errorf("获取工作经历失败: %w", err)
+	}
+	for _, w := range work {
+		position := w.Position
+		if position == "" {
+			position = w.Title
+		}
+		data.Work = append(data.Work, ResumeWork{
+			Company:     w.Company,
+			Position:    position,
+			StartDate:   month(w.StartDate),
+			EndDate:     month(w.EndDate),
+			IsCurrent:   w.IsCurrent,
+			Description: w.Description,
+		})
+	}
+
+	var educations []struct {
+		School      string
+		Degree      string
+		Major       string
+		StartDate   *time.Time
+		EndDate     *time.Time
+		IsCurrent   bool
+		Description string
+	}
+	if err := db.Raw(`
+		SELECT school, degree, major, start_date, end_date, is_current, description
+		FROM educations WHERE resume_id = ? ORDER BY start_date DESC`, resumeID).Scan(&educations).Error; err != nil {
+		return nil, fmt.Errorf("获取教育经历失败: %w", err)
+	}
+	for _, e := range educations {
+		data.Education = append(data.Education, ResumeEducation{
+			School:      e.School,
+			Degree:      e.Degree,
+			Major:       e.Major,
+			StartDate:   month(e.StartDate),
+			EndDate:     month(e.EndDate),
+			IsCurrent:   e.IsCurrent,
+			Description: e.Description,
+		})
+	}
+
+	var projects []struct {
+		Name            string
+		Description     string
+		TechnologyStack string
+		StartDate       *time.Time
+		EndDate         *time.Time
+	}
+	if err := db.Raw(`
+		SELECT name, description, technology_stack, start_date, end_date
+		FROM projects WHERE resume_id = ? ORDER BY start_date DESC`, resumeID).Scan(&projects).Error; err != nil {
+		return nil, fmt.Errorf("获取项目经历失败: %w", err)
+	}
+	for _, p := range projects {
+		var technologies []string
+		for _, t := range strings.FieldsFunc(p.TechnologyStack, func(r rune) bool { return r == ',' || r == '，' || r == '、' }) {
+			if t = strings.TrimSpace(t); t != "" {
+				technologies = append(technologies, t)
+			}
+		}
+		data.Projects = append(data.Projects, ResumeProject{
+			Name:         p.Name,
+			Description:  p.Description,
+			Technologies: technologies,
+			StartDate:    month(p.StartDate),
+			EndDate:      month(p.EndDate),
+		})
+	}
+
+	var skills []struct {
+		Name              string
+		Category          string
+		ProficiencyLevel  string
+		YearsOfExperience float64
+	}
+	if err := db.Raw(`
+		SELECT s.name, s.category, rs.proficiency_level, rs.years_of_experience
+		FROM resume_skills rs JOIN skills s ON s.id = rs.skill_id
+		WHERE rs.resume_id = ?
+		ORDER BY rs.is_highlighted DESC, rs.years_of_experience DESC`, resumeID).Scan(&skills).Error; err != nil {
+		return nil, fmt.Errorf("获取技能失败: %w", err)
+	}
+	for _, s := range skills {
+		data.Skills = append(data.Skills, ResumeSkill{Name: s.Name, Category: s.Category, Level: s.ProficiencyLevel, Years: s.YearsOfExperience})
+	}
+
+	var certifications []struct {
+		Name      string
+		Issuer    string
+		IssueDate *time.Time
+	}
+	if err := db.Raw(`
+		SELECT name, issuer, issue_date FROM certifications
+		WHERE resume_id = ? ORDER BY issue_date DESC`, resumeID).Scan(&certifications).Error; err != nil {
+		return nil, fmt.Errorf("获取证书失败: %w", err)
+	}
+	for _, c := range certifications {
+		data.Certifications = append(data.Certifications, ResumeCertification{Name: c.Name, Issuer: c.Issuer, IssueDate: month(c.IssueDate)})
+	}
+	return data, nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DOCX版式（单位twip，1mm≈56.7twip）
+const (
+	docxPageWidth    = 11906 // A4
+	docxPageHeight   = 16838
+	docxMargin       = 850 // 15mm
+	docxColumnGap    = 340 // 6mm
+	docxListIndent   = 360
+	docxContentWidth = docxPageWidth - 2*docxMargin
+)
+
+// RenderResumeDOCX 输出Word文档：多栏布局用无边框表格实现，列表以符号和悬挂缩进表示
+func RenderResumeDOCX(doc *ResumeDocument, opts ResumeRenderOptions) ([]byte, error) {
+	var body strings.Builder
+	writeDOCXBlocks(&body, doc.Blocks, docxContentWidth)
+	// 以表格结尾时Word要求表格后还有一个段落
+	if n := len(doc.Blocks); n > 0 && doc.Blocks[n-1].Kind == BlockColumns {
+		body.WriteString("<w:p/>")
+	}
+
+	document := xml.Header + `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+		body.String() +
+		fmt.Sprintf(`<w:sectPr><w:pgSz w:w="%d" w:h="%d"/><w:pgMar w:top="%d" w:right="%d" w:bottom="%d" w:left="%d" w:header="0" w:footer="0" w:gutter="0"/></w:sectPr>`,
+			docxPageWidth, docxPageHeight, docxMargin, docxMargin, docxMargin, docxMargin) +
+		`</w:body></w:document>`
+
+	created := opts.CreatedAt.UTC().Format("2006-01-02T15:04:05Z")
+	core := xml.Header + `<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">` +
+		`<dc:title>` + xmlEscape(doc.Title) + `</dc:title>` +
+		`<dcterms:created xsi:type="dcterms:W3CDTF">` + created + `</dcterms:created>` +
+		`<dcterms:modified xsi:type="dcterms:W3CDTF">` + created + `</dcterms:modified>` +
+		`</cp:coreProperties>`
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", docxContentTypes},
+		{"_rels/.rels", docxRootRels},
+		{"docProps/core.xml", core},
+		{"word/_rels/document.xml.rels", docxDocumentRels},
+		{"word/styles.xml", docxStyles(opts.FontFamily)},
+		{"word/document.xml", document},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, part := range parts {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: part.name, Method: zip.Deflate, Modified: opts.CreatedAt})
+		if err != nil {
+			return nil, fmt.Errorf("生成DOCX失败: %w", err)
+		}
+		if _, err := w.Write([]byte(part.content)); err != nil {
+			return nil, fmt.Errorf("生成DOCX失败: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("生成DOCX失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// writeDOCXBlocks 输出排版块，width为可用宽度
+func writeDOCXBlocks(b *strings.Builder, blocks []ResumeBlock, width int) {
+	for _, block := range blocks {
+		switch block.Kind {
+		case BlockHeading:
+			b.WriteString(`<w:p><w:pPr><w:pStyle w:val="Heading` + strconv.Itoa(block.Level) + `"/><w:keepNext/></w:pPr>`)
+			writeDOCXRuns(b, block.Runs)
+			b.WriteString(`</w:p>`)
+		case BlockParagraph:
+			b.WriteString(`<w:p>`)
+			if block.Muted {
+				b.WriteString(`<w:pPr><w:pStyle w:val="Muted"/></w:pPr>`)
+			}
+			writeDOCXRuns(b, block.Runs)
+			b.WriteString(`</w:p>`)
+		case BlockListItem:
+			marker := "•"
+			if block.Ordered {
+				marker = strconv.Itoa(block.Number) + "."
+			}
+			fmt.Fprintf(b, `<w:p><w:pPr><w:pStyle w:val="ListItem"/><w:ind w:left="%d" w:hanging="%d"/></w:pPr>`,
+				docxListIndent*block.Level, docxListIndent)
+			b.WriteString(`<w:r><w:t>` + marker + `</w:t></w:r><w:r><w:tab/></w:r>`)
+			writeDOCXRuns(b, block.Runs)
+			b.WriteString(`</w:p>`)
+		case BlockRule:
+			b.WriteString(`<w:p><w:pPr><w:pBdr><w:bottom w:val="single" w:sz="4" w:space="1" w:color="C8C8C8"/></w:pBdr></w:pPr></w:p>`)
+		case BlockPageBreak:
+			b.WriteString(`<w:p><w:r><w:br w:type="page"/></w:r></w:p>`)
+		case BlockColumns:
+			writeDOCXColumns(b, block, width)
+		}
+	}
+}
+
+// writeDOCXColumns 多栏布局输出为无边框的单行表格
+func writeDOCXColumns(b *strings.Builder, block ResumeBlock, width int) {
+	available := width - docxColumnGap*(len(block.Columns)-1)
+	widths := make([]int, len(block.Columns))
+	for i, col := range block.Columns {
+		widths[i] = int(float64(available) * col.Width)
+	}
+
+	fmt.Fprintf(b, `<w:tbl><w:tblPr><w:tblW w:w="%d" w:type="dxa"/>`, width)
+	b.WriteString(`<w:tblBorders><w:top w:val="nil"/><w:left w:val="nil"/><w:bottom w:val="nil"/><w:right w:val="nil"/><w:insideH w:val="nil"/><w:insideV w:val="nil"/></w:tblBorders>`)
+	b.WriteString(`<w:tblLayout w:type="fixed"/><w:tblCellMar><w:left w:w="0" w:type="dxa"/><w:right w:w="0" w:type="dxa"/></w:tblCellMar></w:tblPr><w:tblGrid>`)
+	for i, w := range widths {
+		if i > 0 {
+			w += docxColumnGap
+		}
+		fmt.Fprintf(b, `<w:gridCol w:w="%d"/>`, w)
+	}
+	b.WriteString(`</w:tblGrid><w:tr>`)
+	for i, col := range block.Columns {
+		cellWidth := widths[i]
+		b.WriteString(`<w:tc><w:tcPr>`)
+		if i > 0 {
+			// 栏间距放在后一栏的左内边距中
+			cellWidth += docxColumnGap
+			fmt.Fprintf(b, `<w:tcW w:w="%d" w:type="dxa"/><w:tcMar><w:left w:w="%d" w:type="dxa"/></w:tcMar>`, cellWidth, docxColumnGap)
+		} else {
+			fmt.Fprintf(b, `<w:tcW w:w="%d" w:type="dxa"/>`, cellWidth)
+		}
+		b.WriteString(`</w:tcPr>`)
+		writeDOCXBlocks(b, col.Blocks, widths[i])
+		// 单元格必须以段落结尾
+		if n := len(col.Blocks); n == 0 || col.Blocks[n-1].Kind == BlockColumns {
+			b.WriteString(`<w:p/>`)
+		}
+		b.WriteString(`</w:tc>`)
+	}
+	b.WriteString(`</w:tr></w:tbl>`)
+}
+
+func writeDOCXRuns(b *strings.Builder, runs []ResumeRun) {
+	for _, r := range runs {
+		if r.Break {
+			b.WriteString(`<w:r><w:br/></w:r>`)
+			continue
+		}
+		b.WriteString(`<w:r>`)
+		if r.Bold || r.Italic {
+			b.WriteString(`<w:rPr>`)
+			if r.Bold {
+				b.WriteString(`<w:b/>`)
+			}
+			if r.Italic {
+				b.WriteString(`<w:i/>`)
+			}
+			b.WriteString(`</w:rPr>`)
+		}
+		b.WriteString(`<w:t xml:space="preserve">` + xmlEscape(r.Text) + `</w:t></w:r>`)
+	}
+}
+
+const docxContentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>` +
+	`<Override PartName="/word/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/>` +
+	`<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>` +
+	`</Types>`
+
+const docxRootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>` +
+	`</Relationships>`
+
+const docxDocumentRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+	`</Relationships>`
+
+// docxStyles 样式与PDF版式保持一致；字号单位为半磅
+func docxStyles(fontFamily string) string {
+	font := xmlEscape(fontFamily)
+	return xml.Header + `<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` +
+		`<w:docDefaults><w:rPrDefault><w:rPr>` +
+		`<w:rFonts w:ascii="` + font + `" w:hAnsi="` + font + `" w:eastAsia="` + font + `" w:cs="` + font + `"/>` +
+		`<w:sz w:val="20"/><w:szCs w:val="20"/><w:lang w:val="en-US" w:eastAsia="zh-CN"/>` +
+		`</w:rPr></w:rPrDefault><w:pPrDefault><w:pPr><w:spacing w:after="80" w:line="264" w:lineRule="auto"/></w:pPr></w:pPrDefault></w:docDefaults>` +
+		`<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/></w:style>` +
+		`<w:style w:type="paragraph" w:styleId="Heading1"><w:name w:val="heading 1"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/>` +
+		`<w:pPr><w:spacing w:after="40"/><w:outlineLvl w:val="0"/></w:pPr><w:rPr><w:b/><w:sz w:val="40"/><w:szCs w:val="40"/></w:rPr></w:style>` +
+		`<w:style w:type="paragraph" w:styleId="Heading2"><w:name w:val="heading 2"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/>` +
+		`<w:pPr><w:pBdr><w:bottom w:val="single" w:sz="4" w:space="1" w:color="C8C8C8"/></w:pBdr><w:spacing w:before="280" w:after="140"/><w:outlineLvl w:val="1"/></w:pPr>` +
+		`<w:rPr><w:b/><w:color w:val="1F4E8C"/><w:sz w:val="26"/><w:szCs w:val="26"/></w:rPr></w:style>` +
+		`<w:style w:type="paragraph" w:styleId="Heading3"><w:name w:val="heading 3"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/>` +
+		`<w:pPr><w:spacing w:before="140" w:after="20"/><w:outlineLvl w:val="2"/></w:pPr><w:rPr><w:b/><w:sz w:val="22"/><w:szCs w:val="22"/></w:rPr></w:style>` +
+		`<w:style w:type="paragraph" w:styleId="Muted"><w:name w:val="Muted"/><w:basedOn w:val="Normal"/>` +
+		`<w:rPr><w:color w:val="6E6E6E"/><w:sz w:val="18"/><w:szCs w:val="18"/></w:rPr></w:style>` +
+		`<w:style w:type="paragraph" w:styleId="ListItem"><w:name w:val="List Item"/><w:basedOn w:val="Normal"/>` +
+		`<w:pPr><w:spacing w:after="30"/></w:pPr></w:style>` +
+		`</w:styles>`
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// resumeHTMLStyle 网页和打印共用的样式，与PDF、DOCX版式保持一致
+const resumeHTMLStyle = `@page { size: A4; margin: 15mm; }
+body { font-family: %s; font-size: 10pt; line-height: 1.45; color: #000; margin: 0 auto; max-width: 180mm; }
+h1 { font-size: 20pt; margin: 0 0 1mm; }
+h2 { font-size: 13pt; color: #1f4e8c; border-bottom: 0.3mm solid #c8c8c8; margin: 5mm 0 2.5mm; }
+h3 { font-size: 11pt; margin: 2.5mm 0 0.5mm; }
+p { margin: 0 0 1.5mm; }
+p.muted { font-size: 9pt; color: #6e6e6e; }
+ul, ol { margin: 0 0 1.5mm; padding-left: 5mm; }
+hr { border: 0; border-top: 0.3mm solid #c8c8c8; margin: 1.5mm 0; }
+.columns { display: flex; gap: 6mm; }
+.columns > .column { min-width: 0; }
+.columns > .column > :first-child { margin-top: 0; }
+.page-break { break-after: page; page-break-after: always; }
+h2, h3 { break-after: avoid; page-break-after: avoid; }`
+
+// RenderResumeHTML 输出完整的HTML文档，可直接预览或由浏览器打印
+func RenderResumeHTML(doc *ResumeDocument, opts ResumeRenderOptions) []byte {
+	fonts := []string{strconv.Quote(opts.FontFamily), `"PingFang SC"`, `"Microsoft YaHei"`, `"SimSun"`, "sans-serif"}
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html lang=\"zh-CN\">\n<head>\n<meta charset=\"utf-8\">\n")
+	b.WriteString("<title>" + html.EscapeString(doc.Title) + "</title>\n<style>\n")
+	fmt.Fprintf(&b, resumeHTMLStyle, strings.Join(fonts, ", "))
+	b.WriteString("\n</style>\n</head>\n<body>\n")
+	writeHTMLBlocks(&b, doc.Blocks)
+	b.WriteString("</body>\n</html>\n")
+	return []byte(b.String())
+}
+
+// writeHTMLBlocks 输出排版块；连续的列表项按层级还原为嵌套列表
+func writeHTMLBlocks(b *strings.Builder, blocks []ResumeBlock) {
+	var lists []bool // 当前打开的列表，true为有序
+	listTag := func(ordered bool) string {
+		if ordered {
+			return "ol"
+		}
+		return "ul"
+	}
+	closeLists := func(level int) {
+		for len(lists) > level {
+			b.WriteString("</li></" + listTag(lists[len(lists)-1]) + ">\n")
+			lists = lists[:len(lists)-1]
+		}
+	}
+
+	for _, block := range blocks {
+		if block.Kind != BlockListItem {
+			closeLists(0)
+		}
+		switch block.Kind {
+		case BlockHeading:
+			tag := "h" + strconv.Itoa(block.Level)
+			b.WriteString("<" + tag + ">")
+			writeHTMLRuns(b, block.Runs)
+			b.WriteString("</" + tag + ">\n")
+		case BlockParagraph:
+			if block.Muted {
+				b.WriteString(`<p class="muted">`)
+			} else {
+				b.WriteString("<p>")
+			}
+			writeHTMLRuns(b, block.Runs)
+			b.WriteString("</p>\n")
+		case BlockListItem:
+			closeLists(block.Level)
+			switch {
+			case len(lists) == block.Level && lists[len(lists)-1] != block.Ordered:
+				closeLists(block.Level - 1)
+			case len(lists) == block.Level:
+				b.WriteString("</li>\n")
+			}
+			for len(lists) < block.Level {
+				lists = append(lists, block.Ordered)
+				b.WriteString("<" + listTag(block.Ordered) + ">\n")
+			}
+			b.WriteString("<li>")
+			writeHTMLRuns(b, block.Runs)
+		case BlockRule:
+			b.WriteString("<hr>\n")
+		case BlockPageBreak:
+			b.WriteString("<div class=\"page-break\"></div>\n")
+		case BlockColumns:
+			b.WriteString("<div class=\"columns\">\n")
+			for _, col := range block.Columns {
+				grow := strconv.FormatFloat(math.Round(col.Width*10000)/100, 'f', -1, 64)
+				fmt.Fprintf(b, "<div class=\"column\" style=\"flex: %s 1 0\">\n", grow)
+				writeHTMLBlocks(b, col.Blocks)
+				b.WriteString("</div>\n")
+			}
+			b.WriteString("</div>\n")
+		}
+	}
+	closeLists(0)
+}
+
+func writeHTMLRuns(b *strings.Builder, runs []ResumeRun) {
+	for _, r := range runs {
+		if r.Break {
+			b.WriteString("<br>")
+			continue
+		}
+		text := html.EscapeString(r.Text)
+		if r.Italic {
+			text = "<em>" + text + "</em>"
+		}
+		if r.Bold {
+			text = "<strong>" + text + "</strong>"
+		}
+		b.WriteString(text)
+	}
+}
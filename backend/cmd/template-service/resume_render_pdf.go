@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// PDF版式（单位mm）
+const (
+	pdfMargin    = 15.0
+	pdfColumnGap = 6.0
+	pdfListStep  = 5.0 // 每级列表缩进
+)
+
+// pdfTextStyle 块的字号、行高、颜色和前后间距
+type pdfTextStyle struct {
+	size        float64
+	lineHeight  float64
+	color       [3]int
+	bold        bool
+	spaceBefore float64
+	spaceAfter  float64
+}
+
+var (
+	pdfStyleBody    = pdfTextStyle{size: 10, lineHeight: 5, spaceAfter: 1.5}
+	pdfStyleMuted   = pdfTextStyle{size: 9, lineHeight: 4.5, color: [3]int{110, 110, 110}, spaceAfter: 1.5}
+	pdfStyleHeading = map[int]pdfTextStyle{
+		1: {size: 20, lineHeight: 9, bold: true, spaceAfter: 1},
+		2: {size: 13, lineHeight: 6.5, bold: true, color: [3]int{31, 78, 140}, spaceBefore: 5, spaceAfter: 2.5},
+		3: {size: 11, lineHeight: 5.5, bold: true, spaceBefore: 2.5, spaceAfter: 0.5},
+	}
+	pdfRuleColor = [3]int{200, 200, 200}
+)
+
+// ErrResumeFontRequired 内容包含内置字体无法显示的字符（如中文），但未配置PDF字体
+var ErrResumeFontRequired = errors.New("PDF内容包含内置字体无法显示的字符，需要配置TEMPLATE_RENDER_FONT指定CJK字体")
+
+// pdfOp 排版结果中的一个绘制操作：文字片段或线段
+type pdfOp struct {
+	page       int
+	x, y, w, h float64
+	text       string
+	style      string
+	size       float64
+	color      [3]int
+	line       bool
+}
+
+// pdfLayout 先计算所有内容的页码和坐标再统一绘制，多栏内容可以各自跨页
+type pdfLayout struct {
+	pdf    *fpdf.Fpdf
+	family string
+	text   func(string) string
+	top    float64
+	bottom float64
+	page   int
+	y      float64
+	ops    []pdfOp
+}
+
+// RenderResumePDF 输出A4 PDF。中文内容需要通过opts.FontFile提供CJK字体；
+// 未提供时使用内置字体，内容中有内置字体无法显示的字符时返回ErrResumeFontRequired，而不是输出无法辨认的替代字符
+func RenderResumePDF(doc *ResumeDocument, opts ResumeRenderOptions) ([]byte, error) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(false, pdfMargin)
+	pdf.SetCompression(!opts.DisableCompression)
+	pdf.SetCreationDate(opts.CreatedAt)
+	pdf.SetModificationDate(opts.CreatedAt)
+	pdf.SetCatalogSort(true)
+	pdf.SetTitle(doc.Title, true)
+
+	layout := &pdfLayout{pdf: pdf, family: "Helvetica", top: pdfMargin, page: 1, y: pdfMargin}
+	var unsupported rune
+	if opts.FontFile == "" {
+		translate := pdf.UnicodeTranslatorFromDescriptor("")
+		layout.text = func(s string) string {
+			// 内置字体的转换把无法编码的字符替换为"."
+			for _, r := range s {
+				if unsupported == 0 && r >= 0x80 && translate(string(r)) == "." {
+					unsupported = r
+				}
+			}
+			return translate(s)
+		}
+	} else {
+		layout.family = "resume"
+		layout.text = func(s string) string { return s }
+		bold := opts.BoldFontFile
+		if bold == "" {
+			bold = opts.FontFile
+		}
+		// 斜体使用同一字形
+		pdf.AddUTF8Font(layout.family, "", opts.FontFile)
+		pdf.AddUTF8Font(layout.family, "I", opts.FontFile)
+		pdf.AddUTF8Font(layout.family, "B", bold)
+		pdf.AddUTF8Font(layout.family, "BI", bold)
+		if err := pdf.Error(); err != nil {
+			return nil, fmt.Errorf("加载字体失败: %w", err)
+		}
+	}
+	pdf.SetCellMargin(0)
+	pageW, pageH := pdf.GetPageSize()
+	layout.bottom = pageH - pdfMargin
+
+	layout.blocks(doc.Blocks, pdfMargin, pageW-2*pdfMargin)
+	if unsupported != 0 {
+		return nil, fmt.Errorf("%w（%q）", ErrResumeFontRequired, unsupported)
+	}
+
+	lastPage := layout.page
+	for _, op := range layout.ops {
+		if op.page > lastPage {
+			lastPage = op.page
+		}
+	}
+	for page := 1; page <= lastPage; page++ {
+		pdf.AddPage()
+		for _, op := range layout.ops {
+			if op.page == page {
+				layout.draw(op)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("生成PDF失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (l *pdfLayout) draw(op pdfOp) {
+	if op.line {
+		l.pdf.SetDrawColor(op.color[0], op.color[1], op.color[2])
+		l.pdf.SetLineWidth(0.3)
+		l.pdf.Line(op.x, op.y, op.x+op.w, op.y)
+		return
+	}
+	l.pdf.SetFont(l.family, op.style, op.size)
+	l.pdf.SetTextColor(op.color[0], op.color[1], op.color[2])
+	l.pdf.SetXY(op.x, op.y)
+	l.pdf.CellFormat(op.w, op.h, op.text, "", 0, "L", false, 0, "")
+}
+
+// nextPage 移到下一页顶部
+func (l *pdfLayout) nextPage() {
+	l.page++
+	l.y = l.top
+}
+
+// ensure 剩余空间不足h时换页
+func (l *pdfLayout) ensure(h float64) {
+	if l.y+h > l.bottom && l.y > l.top {
+		l.nextPage()
+	}
+}
+
+// space 块前后的间距，页首不留白
+func (l *pdfLayout) space(h float64) {
+	if l.y > l.top {
+		l.y += h
+	}
+}
+
+func (l *pdfLayout) blocks(blocks []ResumeBlock, x, width float64) {
+	for _, b := range blocks {
+		switch b.Kind {
+		case BlockHeading:
+			style := pdfStyleHeading[b.Level]
+			l.space(style.spaceBefore)
+			// 标题不单独留在页尾
+			l.ensure(style.lineHeight + pdfStyleBody.lineHeight)
+			l.paragraph(b.Runs, x, width, style)
+			if b.Level == 2 {
+				l.rule(x, width, 0)
+			}
+			l.y += style.spaceAfter
+		case BlockParagraph:
+			style := pdfStyleBody
+			if b.Muted {
+				style = pdfStyleMuted
+			}
+			l.paragraph(b.Runs, x, width, style)
+			l.y += style.spaceAfter
+		case BlockListItem:
+			indent := pdfListStep * float64(b.Level-1)
+			marker := "•"
+			if b.Ordered {
+				marker = strconv.Itoa(b.Number) + "."
+			}
+			style := pdfStyleBody
+			l.ensure(style.lineHeight)
+			l.ops = append(l.ops, pdfOp{page: l.page, x: x + indent, y: l.y, w: pdfListStep, h: style.lineHeight, text: l.text(marker), size: style.size})
+			l.paragraph(b.Runs, x+indent+pdfListStep, width-indent-pdfListStep, style)
+			l.y += 0.5
+		case BlockRule:
+			l.ensure(3)
+			l.rule(x, width, 1.5)
+			l.y += 1.5
+		case BlockPageBreak:
+			l.nextPage()
+		case BlockColumns:
+			l.columns(b, x, width)
+		}
+	}
+}
+
+// rule 在当前位置下方画一条横线
+func (l *pdfLayout) rule(x, width, offset float64) {
+	l.y += offset
+	l.ops = append(l.ops, pdfOp{page: l.page, x: x, y: l.y, w: width, color: pdfRuleColor, line: true})
+}
+
+// columns 各栏从同一位置开始排版，结束位置取最靠后的一栏
+func (l *pdfLayout) columns(b ResumeBlock, x, width float64) {
+	startPage, startY := l.page, l.y
+	endPage, endY := startPage, startY
+	available := width - pdfColumnGap*float64(len(b.Columns)-1)
+	cx := x
+	for _, col := range b.Columns {
+		l.page, l.y = startPage, startY
+		cw := available * col.Width
+		l.blocks(col.Blocks, cx, cw)
+		if l.page > endPage || (l.page == endPage && l.y > endY) {
+			endPage, endY = l.page, l.y
+		}
+		cx += cw + pdfColumnGap
+	}
+	l.page, l.y = endPage, endY
+}
+
+// pdfToken 折行的最小单位：西文单词或单个CJK字符
+type pdfToken struct {
+	text        string
+	bold        bool
+	italic      bool
+	spaceBefore bool
+	lineBreak   bool
+}
+
+// isWideRune CJK文字和全角标点，可以在任意两个字符之间折行
+func isWideRune(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(r >= 0x3000 && r <= 0x303F) || (r >= 0xFF00 && r <= 0xFFEF)
+}
+
+// splitTextTokens 将文字拆分为折行单位
+func splitTextTokens(runs []ResumeRun) []pdfToken {
+	var tokens []pdfToken
+	for _, r := range runs {
+		if r.Break {
+			tokens = append(tokens, pdfToken{lineBreak: true})
+			continue
+		}
+		space := false
+		var word strings.Builder
+		emit := func() {
+			if word.Len() > 0 {
+				tokens = append(tokens, pdfToken{text: word.String(), bold: r.Bold, italic: r.Italic, spaceBefore: space})
+				word.Reset()
+				space = false
+			}
+		}
+		for _, ch := range r.Text {
+			switch {
+			case ch == ' ':
+				emit()
+				space = true
+			case isWideRune(ch):
+				emit()
+				tokens = append(tokens, pdfToken{text: string(ch), bold: r.Bold, italic: r.Italic, spaceBefore: space})
+				space = false
+			default:
+				word.WriteRune(ch)
+			}
+		}
+		emit()
+		// 末尾的空格留给后面样式不同的文字
+		if space && len(tokens) > 0 {
+			tokens = append(tokens, pdfToken{bold: r.Bold, italic: r.Italic, spaceBefore: true})
+		}
+	}
+	return tokens
+}
+
+func fontStyle(bold, italic bool) string {
+	style := ""
+	if bold {
+		style += "B"
+	}
+	if italic {
+		style += "I"
+	}
+	return style
+}
+
+// paragraph 按宽度折行并输出每行的文字片段
+func (l *pdfLayout) paragraph(runs []ResumeRun, x, width float64, style pdfTextStyle) {
+	type segment struct {
+		text  string
+		style string
+		width float64
+	}
+	var lines [][]segment
+	var line []segment
+	lineWidth := 0.0
+	pendingSpace := false
+
+	measure := func(s string, fs string) float64 {
+		l.pdf.SetFont(l.family, fs, style.size)
+		return l.pdf.GetStringWidth(l.text(s))
+	}
+	appendText := func(s, fs string, w float64) {
+		if n := len(line); n > 0 && line[n-1].style == fs {
+			line[n-1].text += s
+			line[n-1].width += w
+		} else {
+			line = append(line, segment{text: s, style: fs, width: w})
+		}
+		lineWidth += w
+	}
+	newLine := func() {
+		lines = append(lines, line)
+		line, lineWidth = nil, 0
+	}
+
+	for _, tok := range splitTextTokens(runs) {
+		if tok.lineBreak {
+			newLine()
+			pendingSpace = false
+			continue
+		}
+		fs := fontStyle(tok.bold || style.bold, tok.italic)
+		pendingSpace = pendingSpace || tok.spaceBefore
+		if tok.text == "" {
+			continue
+		}
+		w := measure(tok.text, fs)
+		space := 0.0
+		if pendingSpace && len(line) > 0 {
+			space = measure(" ", fs)
+		}
+		if len(line) > 0 && lineWidth+space+w > width {
+			newLine()
+			space = 0
+		}
+		if space > 0 {
+			appendText(" ", fs, space)
+		}
+		pendingSpace = false
+
+		// 超长单词（如网址）按字符拆分
+		for w > width && len([]rune(tok.text)) > 1 {
+			runes := []rune(tok.text)
+			n := len(runes) - 1
+			for n > 1 && lineWidth+measure(string(runes[:n]), fs) > width {
+				n--
+			}
+			appendText(string(runes[:n]), fs, measure(string(runes[:n]), fs))
+			newLine()
+			tok.text = string(runes[n:])
+			w = measure(tok.text, fs)
+		}
+		appendText(tok.text, fs, w)
+	}
+	if len(line) > 0 {
+		newLine()
+	}
+
+	for _, segments := range lines {
+		l.ensure(style.lineHeight)
+		cx := x
+		for _, seg := range segments {
+			l.ops = append(l.ops, pdfOp{
+				page:  l.page,
+				x:     cx,
+				y:     l.y,
+				w:     seg.width,
+				h:     style.lineHeight,
+				text:  l.text(seg.text),
+				style: seg.style,
+				size:  style.size,
+				color: style.color,
+			})
+			cx += seg.width
+		}
+		l.y += style.lineHeight
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "重新生成testdata/golden下的文件")
+
+var goldenTime = time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+
+func goldenOptions() ResumeRenderOptions {
+	return ResumeRenderOptions{FontFamily: DefaultResumeFontFamily, CreatedAt: goldenTime, DisableCompression: true}
+}
+
+// chineseResume 默认模板使用的中文简历
+func chineseResume() *ResumeData {
+	return &ResumeData{
+		Basics: ResumeBasics{
+			Name:     "张三",
+			Headline: "高级后端工程师",
+			Email:    "zhangsan@example.com",
+			Phone:    "138-0000-0000",
+			Location: "深圳",
+			Summary:  "八年后端开发经验，熟悉分布式系统与高并发服务设计。",
+		},
+		Work: []ResumeWork{
+			{
+				Company: "星辰科技", Position: "技术负责人", StartDate: "2020-03", IsCurrent: true,
+				Description: "负责招聘平台后端架构，带领8人团队。",
+				Highlights:  []string{"将核心接口P99延迟从800ms降至120ms", "主导微服务拆分与Consul服务治理"},
+			},
+			{Company: "蓝海网络", Position: "后端工程师", StartDate: "2016-07-01", EndDate: "2020-02-28", Description: "开发支付与订单系统。"},
+		},
+		Education: []ResumeEducation{{School: "浙江大学", Degree: "硕士", Major: "计算机科学", StartDate: "2013-09", EndDate: "2016-06"}},
+		Projects: []ResumeProject{{
+			Name: "智能简历解析", Role: "负责人", StartDate: "2022-01", EndDate: "2022-09",
+			Description: "基于文档解析与NLP的简历结构化，准确率92%。", Technologies: []string{"Go", "Python", "PostgreSQL"},
+		}},
+		Skills: []ResumeSkill{
+			{Name: "Go", Category: "编程语言", Level: "专家"},
+			{Name: "MySQL", Category: "数据库", Level: "高级"},
+			{Name: "C++ & Rust", Category: "编程语言"},
+		},
+		Certifications: []ResumeCertification{{Name: "PMP", Issuer: "PMI", IssueDate: "2021-05-20"}},
+	}
+}
+
+// englishResume 布局模板使用的英文简历，内置字体可完整显示
+func englishResume() *ResumeData {
+	work := make([]ResumeWork, 0, 6)
+	for i, company := range []string{"Acme Corp", "Globex", "Initech", "Umbrella", "Hooli", "Stark Industries"} {
+		work = append(work, ResumeWork{
+			Company:     company,
+			Position:    "Software Engineer",
+			StartDate:   time.Date(2023-2*i, 1, 1, 0, 0, 0, 0, time.UTC).Format("2006-01"),
+			EndDate:     time.Date(2024-2*i, 12, 1, 0, 0, 0, 0, time.UTC).Format("2006-01"),
+			IsCurrent:   i == 0,
+			Description: "Designed and operated services handling millions of requests per day, with a focus on reliability, observability and developer experience across several product teams.",
+			Highlights:  []string{"Cut infrastructure cost by 35% through capacity planning", "Mentored four engineers"},
+		})
+	}
+	return &ResumeData{
+		Basics: ResumeBasics{
+			Name:     "Jane Doe",
+			Headline: "Staff Engineer",
+			Email:    "jane@example.com",
+			Website:  "https://jane.example.com",
+			Summary:  "Backend engineer who enjoys distributed systems & clean APIs.",
+		},
+		Work:      work,
+		Education: []ResumeEducation{{School: "MIT", Degree: "BSc", Major: "Computer Science", StartDate: "2008-09", EndDate: "2012-06"}},
+		Projects: []ResumeProject{{
+			Name:         "Open Source Scheduler",
+			Description:  "A distributed cron replacement.",
+			URL:          "https://github.com/example/a-very-long-repository-name-that-does-not-fit-on-one-line-in-a-pdf/tree/main/docs/architecture-overview",
+			Technologies: []string{"Go", "etcd"},
+		}},
+		Skills:         []ResumeSkill{{Name: "Go", Level: "expert"}, {Name: "Kubernetes", Level: "advanced"}},
+		Certifications: []ResumeCertification{{Name: "CKA", Issuer: "CNCF", IssueDate: "2022-11-02"}},
+	}
+}
+
+func layoutTemplate(t *testing.T) string {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join("testdata", "templates", "layout.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+// assertGolden 与testdata/golden下的文件比较，go test -update重新生成
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name)
+	if *updateGolden {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("读取golden文件失败（可用-update生成）: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s 与golden文件不一致，确认改动后用 go test -update 更新", name)
+	}
+}
+
+// assertGoldenDOCX 按包内各部分比较DOCX，不受zip压缩实现差异影响
+func assertGoldenDOCX(t *testing.T, name string, got []byte) {
+	t.Helper()
+	if *updateGolden {
+		assertGolden(t, name, got)
+		return
+	}
+	want, err := os.ReadFile(filepath.Join("testdata", "golden", name))
+	if err != nil {
+		t.Fatalf("读取golden文件失败（可用-update生成）: %v", err)
+	}
+	gotParts, wantParts := docxParts(t, got), docxParts(t, want)
+	if len(gotParts) != len(wantParts) {
+		t.Fatalf("%s: parts %v, want %v", name, partNames(gotParts), partNames(wantParts))
+	}
+	for part, content := range wantParts {
+		if gotParts[part] != content {
+			t.Errorf("%s: %s 与golden文件不一致，确认改动后用 go test -update 更新", name, part)
+		}
+	}
+}
+
+func docxParts(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("无效的DOCX: %v", err)
+	}
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[f.Name] = string(content)
+	}
+	return parts
+}
+
+func partNames(parts map[string]string) []string {
+	names := make([]string, 0, len(parts))
+	for name := range parts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func render(t *testing.T, content string, data *ResumeData, format string) []byte {
+	t.Helper()
+	rendered, err := RenderResume(content, data, format, goldenOptions())
+	if err != nil {
+		t.Fatalf("render %s: %v", format, err)
+	}
+	return rendered.Content
+}
+
+// TestRenderResumeGoldenHTML 默认模板（中文）和布局模板的HTML输出
+func TestRenderResumeGoldenHTML(t *testing.T) {
+	assertGolden(t, "default.html", render(t, "", chineseResume(), ResumeFormatHTML))
+	assertGolden(t, "layout.html", render(t, layoutTemplate(t), englishResume(), ResumeFormatHTML))
+}
+
+// TestRenderResumeGoldenPDF 布局模板的PDF输出：双栏、跨页、分页、列表和超长单词折行
+func TestRenderResumeGoldenPDF(t *testing.T) {
+	out := render(t, layoutTemplate(t), englishResume(), ResumeFormatPDF)
+	assertGolden(t, "layout.pdf", out)
+
+	if again := render(t, layoutTemplate(t), englishResume(), ResumeFormatPDF); !bytes.Equal(out, again) {
+		t.Error("PDF output is not deterministic")
+	}
+	// 右栏的工作经历超过一页，分页符之后的内容从新的一页开始
+	if pages := bytes.Count(out, []byte("/Type /Page\n")); pages != 3 {
+		t.Errorf("expected 3 pages, got %d", pages)
+	}
+}
+
+// TestRenderResumeGoldenPDFCJK 默认模板（中文）的PDF输出嵌入配置的CJK字体；未配置字体时返回错误而不是输出?
+func TestRenderResumeGoldenPDFCJK(t *testing.T) {
+	opts := goldenOptions()
+	opts.FontFile = filepath.Join("testdata", "fonts", "cjk-fixture.ttf")
+	rendered, err := RenderResume("", chineseResume(), ResumeFormatPDF, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "default.pdf", rendered.Content)
+	if !bytes.Contains(rendered.Content, []byte("/FontFile2")) {
+		t.Error("CJK font is not embedded")
+	}
+
+	if _, err := RenderResume("", chineseResume(), ResumeFormatPDF, goldenOptions()); !errors.Is(err, ErrResumeFontRequired) {
+		t.Errorf("expected ErrResumeFontRequired without a CJK font, got %v", err)
+	}
+}
+
+// TestRenderResumeGoldenDOCX 默认模板（中文）和布局模板的DOCX输出
+func TestRenderResumeGoldenDOCX(t *testing.T) {
+	assertGoldenDOCX(t, "default.docx", render(t, "", chineseResume(), ResumeFormatDOCX))
+	assertGoldenDOCX(t, "layout.docx", render(t, layoutTemplate(t), englishResume(), ResumeFormatDOCX))
+}
+
+// TestParseResumeDocument 排版子集的解析：空白折叠、样式、列表层级、分栏宽度和分页
+func TestParseResumeDocument(t *testing.T) {
+	doc, err := ParseResumeDocument(`
+		<h1>  Jane   Doe </h1>
+		loose <b>text</b>
+		<h5>Deep heading</h5>
+		<p class="muted">a<br> b <script>alert(1)</script></p>
+		<ol><li>one<ul><li>nested</li></ul></li><li>two</li></ol>
+		<div class="columns">
+			<div data-width="30%"><p>left</p></div>
+			<div><p>middle</p></div>
+			<div><p>right</p></div>
+		</div>
+		<section style="page-break-before: always"><p>next page</p></section>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Title != "Jane Doe" {
+		t.Errorf("title = %q", doc.Title)
+	}
+
+	var kinds []string
+	for _, b := range doc.Blocks {
+		kinds = append(kinds, b.Kind)
+	}
+	want := "heading,paragraph,heading,paragraph,list_item,list_item,list_item,columns,page_break,paragraph"
+	if strings.Join(kinds, ",") != want {
+		t.Fatalf("blocks = %s", strings.Join(kinds, ","))
+	}
+
+	loose := doc.Blocks[1].Runs
+	if len(loose) != 2 || loose[0].Text != "loose " || loose[1].Text != "text" || !loose[1].Bold {
+		t.Errorf("implicit paragraph runs: %+v", loose)
+	}
+	if doc.Blocks[2].Level != 3 {
+		t.Errorf("h5 should map to level 3: %+v", doc.Blocks[2])
+	}
+	muted := doc.Blocks[3]
+	if !muted.Muted || len(muted.Runs) != 3 || muted.Runs[0].Text != "a" || !muted.Runs[1].Break || muted.Runs[2].Text != "b" {
+		t.Errorf("muted paragraph: %+v", muted)
+	}
+
+	one, nested, two := doc.Blocks[4], doc.Blocks[5], doc.Blocks[6]
+	if !one.Ordered || one.Number != 1 || one.Level != 1 || runsText(one.Runs) != "one" {
+		t.Errorf("first item: %+v", one)
+	}
+	if nested.Ordered || nested.Level != 2 || nested.Number != 1 {
+		t.Errorf("nested item: %+v", nested)
+	}
+	if !two.Ordered || two.Number != 2 || two.Level != 1 {
+		t.Errorf("second item: %+v", two)
+	}
+
+	cols := doc.Blocks[7].Columns
+	if len(cols) != 3 || math.Abs(cols[0].Width-0.3) > 1e-9 || math.Abs(cols[1].Width-0.35) > 1e-9 || math.Abs(cols[2].Width-0.35) > 1e-9 {
+		t.Errorf("column widths: %+v", cols)
+	}
+	if runsText(cols[2].Blocks[0].Runs) != "right" {
+		t.Errorf("column content: %+v", cols[2])
+	}
+}
+
+// TestBindResumeTemplate 日期格式、HTML转义和模板错误
+func TestBindResumeTemplate(t *testing.T) {
+	data := &ResumeData{
+		Basics: ResumeBasics{Name: "<script>x</script>"},
+		Work:   []ResumeWork{{StartDate: "2020-03-15", IsCurrent: true}, {StartDate: "2018-01", EndDate: "2019"}},
+	}
+	out, err := BindResumeTemplate(`<h1>{{.Basics.Name}}</h1>{{range .Work}}<p>{{dateRange .StartDate .EndDate .IsCurrent}}</p>{{end}}`, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := ParseResumeDocument(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Title != "<script>x</script>" {
+		t.Errorf("data should be rendered as text: %q", doc.Title)
+	}
+	if got := runsText(doc.Blocks[1].Runs); got != "2020.03 - 至今" {
+		t.Errorf("current job: %q", got)
+	}
+	if got := runsText(doc.Blocks[2].Runs); got != "2018.01 - 2019" {
+		t.Errorf("past job: %q", got)
+	}
+
+	if _, err := BindResumeTemplate(`{{if .Basics.Name}}`, data); err == nil {
+		t.Error("expected syntax error")
+	}
+	if _, err := RenderResume("", data, "odt", goldenOptions()); err == nil {
+		t.Error("expected unsupported format error")
+	}
+}
+
+// TestSplitTextTokens 西文按单词折行，CJK字符之间可以折行
+func TestSplitTextTokens(t *testing.T) {
+	tokens := splitTextTokens([]ResumeRun{{Text: "Go 语言专家"}, {Text: " and more", Bold: true}})
+	var got []string
+	for _, tok := range tokens {
+		s := tok.text
+		if tok.spaceBefore {
+			s = "_" + s
+		}
+		got = append(got, s)
+	}
+	if strings.Join(got, "|") != "Go|_语|言|专|家|_and|_more" {
+		t.Errorf("tokens = %v", got)
+	}
+	if !tokens[len(tokens)-1].bold {
+		t.Error("style should be kept")
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 差异操作
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// DiffLine 差异中的一行，行号从1开始，插入行没有旧行号，删除行没有新行号
+type DiffLine struct {
+	Op      string `json:"op"`
+	Text    string `json:"text"`
+	OldLine int    `json:"old_line,omitempty"`
+	NewLine int    `json:"new_line,omitempty"`
+}
+
+// DiffLines 按行比较，使用Myers算法得到最短编辑序列
+func DiffLines(a, b []string) []DiffLine {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// 从终点回溯编辑路径
+	var reversed []DiffLine
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			reversed = append(reversed, DiffLine{Op: DiffEqual, Text: a[x-1], OldLine: x, NewLine: y})
+			x--
+			y--
+		}
+		if x == prevX {
+			reversed = append(reversed, DiffLine{Op: DiffInsert, Text: b[y-1], NewLine: y})
+			y--
+		} else {
+			reversed = append(reversed, DiffLine{Op: DiffDelete, Text: a[x-1], OldLine: x})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		reversed = append(reversed, DiffLine{Op: DiffEqual, Text: a[x-1], OldLine: x, NewLine: y})
+		x--
+		y--
+	}
+
+	lines := make([]DiffLine, len(reversed))
+	for i, line := range reversed {
+		lines[len(reversed)-1-i] = line
+	}
+	return lines
+}
+
+// DiffHunk 一段连续的修改及其上下文
+type DiffHunk struct {
+	OldStart int        `json:"old_start"`
+	OldLines int        `json:"old_lines"`
+	NewStart int        `json:"new_start"`
+	NewLines int        `json:"new_lines"`
+	Lines    []DiffLine `json:"lines"`
+}
+
+// DiffHunks 将修改按context行上下文分组，相距不超过2*context行的修改合并为一段
+func DiffHunks(lines []DiffLine, context int) []DiffHunk {
+	var hunks []DiffHunk
+	i := 0
+	for i < len(lines) {
+		// 找到下一处修改
+		for i < len(lines) && lines[i].Op == DiffEqual {
+			i++
+		}
+		if i == len(lines) {
+			break
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(lines) {
+			if lines[end].Op != DiffEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(lines) && lines[run].Op == DiffEqual {
+				run++
+			}
+			if run == len(lines) || run-end > 2*context {
+				end += context
+				if end > len(lines) {
+					end = len(lines)
+				}
+				break
+			}
+			end = run
+		}
+
+		hunk := DiffHunk{Lines: lines[start:end]}
+		for _, line := range hunk.Lines {
+			if line.Op != DiffInsert {
+				hunk.OldLines++
+				if hunk.OldStart == 0 {
+					hunk.OldStart = line.OldLine
+				}
+			}
+			if line.Op != DiffDelete {
+				hunk.NewLines++
+				if hunk.NewStart == 0 {
+					hunk.NewStart = line.NewLine
+				}
+			}
+		}
+		hunk.OldStart = hunkStart(hunk.OldStart, hunk.OldLines, lines[:start], true)
+		hunk.NewStart = hunkStart(hunk.NewStart, hunk.NewLines, lines[:start], false)
+		hunks = append(hunks, hunk)
+		i = end
+	}
+	return hunks
+}
+
+// hunkStart 一侧没有行时，按unified格式取该段之前的最后一个行号
+func hunkStart(start, count int, before []DiffLine, old bool) int {
+	if count > 0 {
+		return start
+	}
+	n := 0
+	for _, line := range before {
+		if old && line.Op != DiffInsert || !old && line.Op != DiffDelete {
+			n++
+		}
+	}
+	return n
+}
+
+// UnifiedDiff 输出unified格式的差异文本
+func UnifiedDiff(hunks []DiffHunk, fromLabel, toLabel string) string {
+	if len(hunks) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", fromLabel, toLabel)
+	for _, hunk := range hunks {
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(hunk.OldStart, hunk.OldLines), hunkRange(hunk.NewStart, hunk.NewLines))
+		for _, line := range hunk.Lines {
+			switch line.Op {
+			case DiffInsert:
+				b.WriteByte('+')
+			case DiffDelete:
+				b.WriteByte('-')
+			default:
+				b.WriteByte(' ')
+			}
+			b.WriteString(line.Text)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 向量模型配置
+const (
+	embeddingProviderLocal  = "local"
+	embeddingProviderRemote = "remote"
+
+	defaultEmbeddingURL   = "http://localhost:8206"
+	defaultEmbeddingModel = "all-MiniLM-L6-v2"
+
+	reembedBatchSize = 32
+)
+
+// TemplateEmbeddingModel 内置模型的语料统计，重启后继续使用同一版本
+type TemplateEmbeddingModel struct {
+	ModelVersion string    `json:"model_version" gorm:"primaryKey;size:100"`
+	Provider     string    `json:"provider" gorm:"size:50"`
+	Dimension    int       `json:"dimension"`
+	Documents    int       `json:"documents"`
+	Stats        string    `json:"-" gorm:"type:jsonb"`
+	IsActive     bool      `json:"is_active"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// initEmbeddingProvider 按TEMPLATE_EMBEDDING_PROVIDER选择模型：remote调用AI服务，
+// 默认使用内置模型并加载上次拟合的语料统计，没有则用当前模板拟合
+func (s *TemplateEnhancedService) initEmbeddingProvider() {
+	if os.Getenv("TEMPLATE_EMBEDDING_PROVIDER") == embeddingProviderRemote {
+		url := os.Getenv("TEMPLATE_EMBEDDING_URL")
+		if url == "" {
+			url = defaultEmbeddingURL
+		}
+		model := os.Getenv("TEMPLATE_EMBEDDING_MODEL")
+		if model == "" {
+			model = defaultEmbeddingModel
+		}
+		s.setEmbedder(NewRemoteEmbeddingProvider(url, model, TemplateVectorDimension))
+		return
+	}
+
+	if s.postgresDB != nil {
+		var model TemplateEmbeddingModel
+		err := s.postgresDB.Where("is_active = ? AND provider = ?", true, embeddingProviderLocal).First(&model).Error
+		if err == nil {
+			var stats NGramStats
+			if err := json.Unmarshal([]byte(model.Stats), &stats); err == nil {
+				s.setEmbedder(NewHashedNGramEmbedder(model.Dimension, &stats))
+				return
+			}
+			log.Printf("向量模型%s的统计数据无效，重新拟合", model.ModelVersion)
+		}
+	}
+
+	s.setEmbedder(NewHashedNGramEmbedder(TemplateVectorDimension, nil))
+	if _, err := s.RefitEmbeddingModel(); err != nil {
+		log.Printf("拟合向量模型失败，使用未加权的内置模型: %v", err)
+	}
+}
+
+func (s *TemplateEnhancedService) currentEmbedder() EmbeddingProvider {
+	s.embedMu.RLock()
+	defer s.embedMu.RUnlock()
+	return s.embedder
+}
+
+func (s *TemplateEnhancedService) setEmbedder(embedder EmbeddingProvider) {
+	s.embedMu.Lock()
+	s.embedder = embedder
+	s.embedMu.Unlock()
+}
+
+// RefitEmbeddingModel 用当前启用的模板重新统计内置模型的文档频率，返回新的模型版本。
+// 版本变化后需要调用ReembedTemplates更新已有向量
+func (s *TemplateEnhancedService) RefitEmbeddingModel() (string, error) {
+	if _, ok := s.currentEmbedder().(*HashedNGramEmbedder); !ok {
+		return "", fmt.Errorf("远程向量模型不需要拟合")
+	}
+	if s.mysqlDB == nil {
+		return "", fmt.Errorf("MySQL未连接，无法读取模板")
+	}
+
+	var templates []Template
+	if err := s.mysqlDB.Where("is_active = ?", true).Find(&templates).Error; err != nil {
+		return "", fmt.Errorf("读取模板失败: %v", err)
+	}
+	corpus := make([]string, len(templates))
+	for i := range templates {
+		corpus[i] = embeddingText(&templates[i])
+	}
+	stats := FitNGramStats(corpus)
+	embedder := NewHashedNGramEmbedder(TemplateVectorDimension, stats)
+
+	if s.postgresDB != nil {
+		data, err := json.Marshal(stats)
+		if err != nil {
+			return "", err
+		}
+		model := TemplateEmbeddingModel{
+			ModelVersion: embedder.ModelVersion(),
+			Provider:     embeddingProviderLocal,
+			Dimension:    embedder.Dimension(),
+			Documents:    stats.Documents,
+			Stats:        string(data),
+			IsActive:     true,
+			CreatedAt:    time.Now(),
+		}
+		err = s.postgresDB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&TemplateEmbeddingModel{}).Where("is_active = ?", true).
+				Update("is_active", false).Error; err != nil {
+				return err
+			}
+			return tx.Save(&model).Error
+		})
+		if err != nil {
+			return "", fmt.Errorf("保存向量模型失败: %v", err)
+		}
+	}
+
+	s.setEmbedder(embedder)
+	return embedder.ModelVersion(), nil
+}
+
+// ReembedTemplates 分批重新生成模板向量；force为false时只处理缺失或模型版本不同的模板。
+// 已有任务在运行时直接返回错误
+func (s *TemplateEnhancedService) ReembedTemplates(ctx context.Context, force bool) (int, error) {
+	if s.postgresDB == nil {
+		return 0, fmt.Errorf("PostgreSQL未连接，无法生成向量")
+	}
+	if !s.reembedMu.TryLock() {
+		return 0, fmt.Errorf("向量重新生成任务正在进行")
+	}
+	defer s.reembedMu.Unlock()
+
+	embedder := s.currentEmbedder()
+	modelVersion := embedder.ModelVersion()
+
+	current := make(map[uint]bool)
+	if !force {
+		var ids []uint
+		if err := s.postgresDB.Model(&TemplateVector{}).Where("model_version = ?", modelVersion).
+			Pluck("template_id", &ids).Error; err != nil {
+			return 0, fmt.Errorf("读取向量失败: %v", err)
+		}
+		for _, id := range ids {
+			current[id] = true
+		}
+	}
+
+	var templates []Template
+	if err := s.mysqlDB.Where("is_active = ?", true).Order("id").Find(&templates).Error; err != nil {
+		return 0, fmt.Errorf("读取模板失败: %v", err)
+	}
+	var pending []*Template
+	for i := range templates {
+		if !current[templates[i].ID] {
+			pending = append(pending, &templates[i])
+		}
+	}
+
+	count := 0
+	for start := 0; start < len(pending); start += reembedBatchSize {
+		end := start + reembedBatchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		batch := pending[start:end]
+		texts := make([]string, len(batch))
+		for i, template := range batch {
+			texts[i] = embeddingText(template)
+		}
+		vectors, err := embedder.Embed(ctx, texts)
+		if err != nil {
+			return count, fmt.Errorf("生成向量失败: %v", err)
+		}
+		for i, template := range batch {
+			if err := s.saveTemplateVector(template, vectors[i], modelVersion); err != nil {
+				return count, fmt.Errorf("保存模板%d的向量失败: %v", template.ID, err)
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetEmbeddingModelInfo 当前模型及向量覆盖情况
+func (s *TemplateEnhancedService) GetEmbeddingModelInfo() (map[string]interface{}, error) {
+	embedder := s.currentEmbedder()
+	provider := embeddingProviderLocal
+	if _, ok := embedder.(*RemoteEmbeddingProvider); ok {
+		provider = embeddingProviderRemote
+	}
+	info := map[string]interface{}{
+		"model_version": embedder.ModelVersion(),
+		"provider":      provider,
+		"dimension":     embedder.Dimension(),
+	}
+
+	var templates int64
+	if err := s.mysqlDB.Model(&Template{}).Where("is_active = ?", true).Count(&templates).Error; err != nil {
+		return nil, fmt.Errorf("统计模板失败: %v", err)
+	}
+	info["templates"] = templates
+
+	if s.postgresDB != nil {
+		var upToDate int64
+		if err := s.postgresDB.Model(&TemplateVector{}).Where("model_version = ?", embedder.ModelVersion()).
+			Count(&upToDate).Error; err != nil {
+			return nil, fmt.Errorf("统计向量失败: %v", err)
+		}
+		info["up_to_date_vectors"] = upToDate
+	}
+	return info, nil
+}
+
+// EvaluateTemplateEmbeddings 以全部启用的模板为语料，用标注的模板对评估当前模型
+func (s *TemplateEnhancedService) EvaluateTemplateEmbeddings(ctx context.Context, pairs []EmbeddingEvalPair, k int) (*EmbeddingEvalReport, error) {
+	var templates []Template
+	if err := s.mysqlDB.Where("is_active = ?", true).Order("id").Find(&templates).Error; err != nil {
+		return nil, fmt.Errorf("读取模板失败: %v", err)
+	}
+	set := EmbeddingEvalSet{Pairs: pairs}
+	for i := range templates {
+		set.Documents = append(set.Documents, EmbeddingEvalDocument{
+			ID:   strconv.FormatUint(uint64(templates[i].ID), 10),
+			Text: embeddingText(&templates[i]),
+		})
+	}
+	return EvaluateEmbeddings(ctx, s.currentEmbedder(), set, k)
+}
+
+var (
+	templateActionPattern = regexp.MustCompile(`(?s)\{\{.*?\}\}`)
+	templateTagPattern    = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// embeddingText 参与向量计算的模板文本：名称、分类、描述和去掉模板语法与标签后的正文
+func embeddingText(template *Template) string {
+	content := templateActionPattern.ReplaceAllString(template.Content, " ")
+	content = html.UnescapeString(templateTagPattern.ReplaceAllString(content, " "))
+	parts := []string{template.Name, template.Category, template.Description, content}
+	return strings.Join(strings.Fields(strings.Join(parts, "\n")), " ")
+}
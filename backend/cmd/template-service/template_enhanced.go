@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -21,6 +22,11 @@ type TemplateEnhancedService struct {
 	postgresDB  *gorm.DB
 	neo4jDriver neo4j.DriverWithContext
 	redisClient *redis.Client
+
+	embedMu  sync.RWMutex
+	embedder EmbeddingProvider
+	// reembedMu 同一时间只允许一个批量重新生成任务
+	reembedMu sync.Mutex
 }
 
 // NewTemplateEnhancedService 创建模板增强服务
@@ -43,6 +49,17 @@ func NewTemplateEnhancedService(core *jobfirst.Core) (*TemplateEnhancedService,
 		// 创建向量表
 		service.createVectorTables()
 	}
+	service.initEmbeddingProvider()
+	if service.postgresDB != nil {
+		// 模型版本变化后，后台补齐旧版本的向量
+		go func() {
+			if count, err := service.ReembedTemplates(context.Background(), false); err != nil {
+				log.Printf("重新生成模板向量失败: %v", err)
+			} else if count > 0 {
+				log.Printf("已重新生成%d个模板向量，模型版本: %s", count, service.currentEmbedder().ModelVersion())
+			}
+		}()
+	}
 
 	// 初始化Neo4j连接
 	neo4jDriver, err := neo4j.NewDriverWithContext("bolt://localhost:7687", neo4j.BasicAuth("neo4j", "password", ""))
@@ -92,6 +109,26 @@ func (s *TemplateEnhancedService) createVectorTables() {
 		CREATE INDEX IF NOT EXISTS template_vectors_content_vector_idx 
 		ON template_vectors USING ivfflat (content_vector vector_cosine_ops)
 	`)
+
+	// 记录生成向量的模型版本，不同版本的向量不可比较
+	s.postgresDB.Exec(`ALTER TABLE template_vectors ADD COLUMN IF NOT EXISTS model_version VARCHAR(100)`)
+	s.postgresDB.Exec(`
+		CREATE INDEX IF NOT EXISTS template_vectors_model_version_idx 
+		ON template_vectors(model_version)
+	`)
+
+	// 内置模型的语料统计
+	s.postgresDB.Exec(`
+		CREATE TABLE IF NOT EXISTS template_embedding_models (
+			model_version VARCHAR(100) PRIMARY KEY,
+			provider VARCHAR(50) NOT NULL,
+			dimension INTEGER NOT NULL,
+			documents INTEGER NOT NULL DEFAULT 0,
+			stats JSONB,
+			is_active BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
 }
 
 // createRelationshipIndexes 创建关系网络索引
@@ -116,7 +153,8 @@ func (s *TemplateEnhancedService) createRelationshipIndexes() {
 type TemplateVector struct {
 	ID            uint      `json:"id" gorm:"primaryKey"`
 	TemplateID    uint      `json:"template_id" gorm:"not null"`
-	ContentVector []float64 `json:"content_vector" gorm:"type:vector(384)"`
+	ContentVector Vector    `json:"content_vector" gorm:"type:vector(384)"`
+	ModelVersion  string    `json:"model_version" gorm:"size:100"`
 	Metadata      string    `json:"metadata" gorm:"type:jsonb"`
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
@@ -133,31 +171,38 @@ type TemplateRelationship struct {
 }
 
 // GenerateTemplateVector 生成模板向量
-func (s *TemplateEnhancedService) GenerateTemplateVector(templateID uint, content string) error {
+func (s *TemplateEnhancedService) GenerateTemplateVector(template *Template) error {
 	if s.postgresDB == nil {
 		return fmt.Errorf("PostgreSQL未连接，无法生成向量")
 	}
 
-	// 调用AI服务生成向量
-	vector, err := s.callAIServiceForVector(content)
+	embedder := s.currentEmbedder()
+	vectors, err := embedder.Embed(context.Background(), []string{embeddingText(template)})
 	if err != nil {
 		return fmt.Errorf("生成向量失败: %v", err)
 	}
+	return s.saveTemplateVector(template, vectors[0], embedder.ModelVersion())
+}
 
-	// 保存向量到PostgreSQL
+// saveTemplateVector 保存模板向量，已存在则覆盖
+func (s *TemplateEnhancedService) saveTemplateVector(template *Template, vector []float64, modelVersion string) error {
+	metadata := fmt.Sprintf(`{"content_length": %d}`, len(template.Content))
 	templateVector := TemplateVector{
-		TemplateID:    templateID,
+		TemplateID:    template.ID,
 		ContentVector: vector,
-		Metadata:      `{"content_length": ` + fmt.Sprintf("%d", len(content)) + `}`,
+		ModelVersion:  modelVersion,
+		Metadata:      metadata,
 		CreatedAt:     time.Now(),
 		UpdatedAt:     time.Now(),
 	}
 
 	// 检查是否已存在
 	var existing TemplateVector
-	if err := s.postgresDB.Where("template_id = ?", templateID).First(&existing).Error; err == nil {
+	if err := s.postgresDB.Where("template_id = ?", template.ID).First(&existing).Error; err == nil {
 		// 更新现有向量
 		existing.ContentVector = vector
+		existing.ModelVersion = modelVersion
+		existing.Metadata = metadata
 		existing.UpdatedAt = time.Now()
 		return s.postgresDB.Save(&existing).Error
 	} else {
@@ -166,17 +211,6 @@ func (s *TemplateEnhancedService) GenerateTemplateVector(templateID uint, conten
 	}
 }
 
-// callAIServiceForVector 调用AI服务生成向量
-func (s *TemplateEnhancedService) callAIServiceForVector(content string) ([]float64, error) {
-	// 这里应该调用容器化AI服务的embedding API
-	// 为了演示，我们返回一个模拟向量
-	vector := make([]float64, 384)
-	for i := range vector {
-		vector[i] = float64(i%100) / 100.0
-	}
-	return vector, nil
-}
-
 // CreateTemplateRelationship 创建模板关系
 func (s *TemplateEnhancedService) CreateTemplateRelationship(sourceID, targetID uint, relationship string, weight float64) error {
 	if s.neo4jDriver == nil {
@@ -203,38 +237,58 @@ func (s *TemplateEnhancedService) CreateTemplateRelationship(sourceID, targetID
 	return err
 }
 
-// GetSimilarTemplates 获取相似模板
-func (s *TemplateEnhancedService) GetSimilarTemplates(templateID uint, limit int) ([]Template, error) {
+// SimilarTemplate 相似模板及其余弦相似度
+type SimilarTemplate struct {
+	Template
+	Similarity float64 `json:"similarity"`
+}
+
+// GetSimilarTemplates 获取相似模板，只在同一模型版本的向量中检索
+func (s *TemplateEnhancedService) GetSimilarTemplates(templateID uint, limit int) ([]SimilarTemplate, error) {
 	if s.postgresDB == nil {
 		return nil, fmt.Errorf("PostgreSQL未连接，无法获取相似模板")
 	}
 
-	// 获取目标模板的向量
+	// 获取目标模板的向量，缺失或版本过期时当场生成
+	modelVersion := s.currentEmbedder().ModelVersion()
 	var targetVector TemplateVector
-	if err := s.postgresDB.Where("template_id = ?", templateID).First(&targetVector).Error; err != nil {
-		return nil, fmt.Errorf("模板向量不存在: %v", err)
+	err := s.postgresDB.Where("template_id = ?", templateID).First(&targetVector).Error
+	if err != nil || targetVector.ModelVersion != modelVersion {
+		var template Template
+		if err := s.mysqlDB.First(&template, templateID).Error; err != nil {
+			return nil, fmt.Errorf("模板不存在: %v", err)
+		}
+		if err := s.GenerateTemplateVector(&template); err != nil {
+			return nil, err
+		}
+		if err := s.postgresDB.Where("template_id = ?", templateID).First(&targetVector).Error; err != nil {
+			return nil, fmt.Errorf("模板向量不存在: %v", err)
+		}
 	}
 
 	// 使用向量相似度搜索
-	var similarVectors []TemplateVector
-	err := s.postgresDB.Raw(`
-		SELECT tv.*, 1 - (tv.content_vector <=> $1) as similarity
+	var matches []struct {
+		TemplateID uint
+		Similarity float64
+	}
+	err = s.postgresDB.Raw(`
+		SELECT tv.template_id, 1 - (tv.content_vector <=> ?) AS similarity
 		FROM template_vectors tv
-		WHERE tv.template_id != $2
-		ORDER BY similarity DESC
-		LIMIT $3
-	`, targetVector.ContentVector, templateID, limit).Scan(&similarVectors).Error
+		WHERE tv.template_id != ? AND tv.model_version = ?
+		ORDER BY tv.content_vector <=> ?
+		LIMIT ?
+	`, targetVector.ContentVector, templateID, modelVersion, targetVector.ContentVector, limit).Scan(&matches).Error
 
 	if err != nil {
 		return nil, fmt.Errorf("相似度搜索失败: %v", err)
 	}
 
 	// 获取模板详细信息
-	var templates []Template
-	for _, vector := range similarVectors {
+	var templates []SimilarTemplate
+	for _, match := range matches {
 		var template Template
-		if err := s.mysqlDB.First(&template, vector.TemplateID).Error; err == nil {
-			templates = append(templates, template)
+		if err := s.mysqlDB.Where("is_active = ?", true).First(&template, match.TemplateID).Error; err == nil {
+			templates = append(templates, SimilarTemplate{Template: template, Similarity: match.Similarity})
 		}
 	}
 
@@ -287,7 +341,7 @@ func (s *TemplateEnhancedService) SyncTemplateToAllDatabases(template *Template)
 
 	// 2. 生成并同步向量到PostgreSQL
 	if s.postgresDB != nil {
-		if err := s.GenerateTemplateVector(template.ID, template.Content); err != nil {
+		if err := s.GenerateTemplateVector(template); err != nil {
 			log.Printf("PostgreSQL向量同步失败: %v", err)
 		}
 	}
@@ -404,6 +458,8 @@ func (s *TemplateEnhancedService) AnalyzeTemplateUsage(templateID uint) (map[str
 		if err := s.postgresDB.Where("template_id = ?", templateID).First(&vector).Error; err == nil {
 			analysis["has_vector"] = true
 			analysis["vector_dimension"] = len(vector.ContentVector)
+			analysis["vector_model_version"] = vector.ModelVersion
+			analysis["vector_up_to_date"] = vector.ModelVersion == s.currentEmbedder().ModelVersion()
 		} else {
 			analysis["has_vector"] = false
 		}
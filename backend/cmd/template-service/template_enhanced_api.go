@@ -35,7 +35,7 @@ func setupEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, enhancedService *Te
 				}
 
 				// 生成向量
-				if err := enhancedService.GenerateTemplateVector(uint(templateID), template.Content); err != nil {
+				if err := enhancedService.GenerateTemplateVector(&template); err != nil {
 					c.JSON(http.StatusInternalServerError, gin.H{"error": "向量生成失败: " + err.Error()})
 					return
 				}
@@ -73,6 +73,106 @@ func setupEnhancedRoutes(r *gin.Engine, core *jobfirst.Core, enhancedService *Te
 					"template_id": templateID,
 				})
 			})
+
+			// 当前向量模型及覆盖情况
+			vectors.GET("/model", func(c *gin.Context) {
+				info, err := enhancedService.GetEmbeddingModelInfo()
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "获取向量模型失败: " + err.Error()})
+					return
+				}
+
+				c.JSON(http.StatusOK, gin.H{
+					"status": "success",
+					"data":   info,
+				})
+			})
+
+			// 批量重新生成向量（管理员），force=true时包括版本已是最新的向量
+			vectors.POST("/reembed", func(c *gin.Context) {
+				if role := c.GetString("role"); role != "admin" && role != "super_admin" {
+					c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
+					return
+				}
+
+				force := c.Query("force") == "true"
+				count, err := enhancedService.ReembedTemplates(c.Request.Context(), force)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "重新生成向量失败: " + err.Error(), "reembedded": count})
+					return
+				}
+
+				c.JSON(http.StatusOK, gin.H{
+					"status":        "success",
+					"reembedded":    count,
+					"model_version": enhancedService.currentEmbedder().ModelVersion(),
+				})
+			})
+
+			// 用当前模板重新拟合内置模型并更新向量（管理员）
+			vectors.POST("/refit", func(c *gin.Context) {
+				if role := c.GetString("role"); role != "admin" && role != "super_admin" {
+					c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
+					return
+				}
+
+				modelVersion, err := enhancedService.RefitEmbeddingModel()
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "拟合向量模型失败: " + err.Error()})
+					return
+				}
+				count, err := enhancedService.ReembedTemplates(c.Request.Context(), false)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "重新生成向量失败: " + err.Error(), "model_version": modelVersion})
+					return
+				}
+
+				c.JSON(http.StatusOK, gin.H{
+					"status":        "success",
+					"model_version": modelVersion,
+					"reembedded":    count,
+				})
+			})
+
+			// 用标注的模板对评估当前模型（管理员）
+			vectors.POST("/evaluate", func(c *gin.Context) {
+				if role := c.GetString("role"); role != "admin" && role != "super_admin" {
+					c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
+					return
+				}
+
+				var req struct {
+					Pairs []struct {
+						A       uint `json:"a" binding:"required"`
+						B       uint `json:"b" binding:"required"`
+						Related bool `json:"related"`
+					} `json:"pairs" binding:"required,min=1"`
+					K int `json:"k"`
+				}
+				if err := c.ShouldBindJSON(&req); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+					return
+				}
+
+				pairs := make([]EmbeddingEvalPair, len(req.Pairs))
+				for i, pair := range req.Pairs {
+					pairs[i] = EmbeddingEvalPair{
+						A:       strconv.FormatUint(uint64(pair.A), 10),
+						B:       strconv.FormatUint(uint64(pair.B), 10),
+						Related: pair.Related,
+					}
+				}
+				report, err := enhancedService.EvaluateTemplateEmbeddings(c.Request.Context(), pairs, req.K)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "评估失败: " + err.Error()})
+					return
+				}
+
+				c.JSON(http.StatusOK, gin.H{
+					"status": "success",
+					"data":   report,
+				})
+			})
 		}
 
 		// 模板关系网络API
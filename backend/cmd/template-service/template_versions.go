@@ -0,0 +1,524 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 模板版本状态：草稿可以修改，提交审核后内容冻结；发布新版本时原发布版本归档
+const (
+	TemplateVersionDraft     = "draft"
+	TemplateVersionPending   = "pending_review"
+	TemplateVersionPublished = "published"
+	TemplateVersionArchived  = "archived"
+)
+
+var (
+	ErrTemplateNotFound        = errors.New("template not found")
+	ErrTemplateVersionNotFound = errors.New("template version not found")
+	// ErrTemplateVersionState 版本当前状态不允许该操作，如修改审核中的版本
+	ErrTemplateVersionState = errors.New("operation not allowed in current version state")
+)
+
+// TemplateVersion 模板的一个版本。Template表中的内容始终是当前发布版本的副本，
+// 使用次数和评分同时按版本累计，便于作者比较修改前后的效果
+type TemplateVersion struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	TemplateID  uint       `json:"template_id" gorm:"not null;uniqueIndex:idx_template_versions_version"`
+	Version     int        `json:"version" gorm:"not null;uniqueIndex:idx_template_versions_version"`
+	Status      string     `json:"status" gorm:"size:20;not null;index"`
+	BaseVersion int        `json:"base_version"` // 修改所基于的版本，0表示新建
+	Name        string     `json:"name" gorm:"size:200;not null"`
+	Category    string     `json:"category" gorm:"size:100;not null"`
+	Description string     `json:"description" gorm:"type:text"`
+	Content     string     `json:"content" gorm:"type:text"`
+	Variables   string     `json:"variables" gorm:"type:json"`
+	Preview     string     `json:"preview" gorm:"type:text"`
+	ChangeNote  string     `json:"change_note" gorm:"size:500"`
+	ReviewNote  string     `json:"review_note" gorm:"size:500"`
+	CreatedBy   uint       `json:"created_by" gorm:"not null"`
+	ReviewedBy  *uint      `json:"reviewed_by,omitempty"`
+	SubmittedAt *time.Time `json:"submitted_at,omitempty"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	Usage       int        `json:"usage" gorm:"column:usage_count;default:0"`
+	Rating      float64    `json:"rating" gorm:"default:0"`
+	RatingCount int        `json:"rating_count" gorm:"default:0"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// editable 草稿之外的版本内容不可修改
+func (v *TemplateVersion) editable() bool {
+	return v.Status == TemplateVersionDraft
+}
+
+// TemplateVersionInput 草稿的可编辑字段，空字段沿用所基于版本的值
+type TemplateVersionInput struct {
+	Name        string `json:"name"`
+	Category    string `json:"category"`
+	Description string `json:"description"`
+	Content     string `json:"content"`
+	Variables   string `json:"variables"`
+	Preview     string `json:"preview"`
+	ChangeNote  string `json:"change_note"`
+}
+
+func (in TemplateVersionInput) applyTo(v *TemplateVersion) {
+	set := func(dst *string, src string) {
+		if src != "" {
+			*dst = src
+		}
+	}
+	set(&v.Name, in.Name)
+	set(&v.Category, in.Category)
+	set(&v.Description, in.Description)
+	set(&v.Content, in.Content)
+	set(&v.Variables, in.Variables)
+	set(&v.Preview, in.Preview)
+	set(&v.ChangeNote, in.ChangeNote)
+}
+
+// copyFrom 复制版本内容，不包括状态和统计
+func (v *TemplateVersion) copyFrom(src *TemplateVersion) {
+	v.Name = src.Name
+	v.Category = src.Category
+	v.Description = src.Description
+	v.Content = src.Content
+	v.Variables = src.Variables
+	v.Preview = src.Preview
+}
+
+// CreateTemplateDraft 新建模板及其第一个草稿；模板在首个版本发布前不公开
+func CreateTemplateDraft(db *gorm.DB, userID uint, in TemplateVersionInput) (*Template, *TemplateVersion, error) {
+	now := time.Now()
+	template := &Template{
+		Name:      in.Name,
+		Category:  in.Category,
+		CreatedBy: userID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	version := &TemplateVersion{Version: 1, Status: TemplateVersionDraft, CreatedBy: userID}
+	in.applyTo(version)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(template).Error; err != nil {
+			return err
+		}
+		// is_active带有数据库默认值，零值需要单独更新
+		if err := tx.Model(template).Update("is_active", false).Error; err != nil {
+			return err
+		}
+		template.IsActive = false
+		version.TemplateID = template.ID
+		return tx.Create(version).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return template, version, nil
+}
+
+// SaveTemplateDraft 修改模板：已有草稿时更新草稿，否则基于当前发布版本新建草稿。
+// 发布版本不受影响，审核中的版本不能修改
+func SaveTemplateDraft(db *gorm.DB, templateID, userID uint, in TemplateVersionInput) (*TemplateVersion, error) {
+	var draft *TemplateVersion
+	err := db.Transaction(func(tx *gorm.DB) error {
+		template, err := loadTemplateForVersioning(tx, templateID)
+		if err != nil {
+			return err
+		}
+
+		var open TemplateVersion
+		err = tx.Where("template_id = ? AND status IN ?", templateID,
+			[]string{TemplateVersionDraft, TemplateVersionPending}).First(&open).Error
+		switch {
+		case err == nil && !open.editable():
+			return fmt.Errorf("%w: version %d is under review", ErrTemplateVersionState, open.Version)
+		case err == nil:
+			in.applyTo(&open)
+			open.ReviewNote = ""
+			draft = &open
+			return tx.Save(draft).Error
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		next, err := nextTemplateVersion(tx, templateID)
+		if err != nil {
+			return err
+		}
+		draft = &TemplateVersion{TemplateID: templateID, Version: next, Status: TemplateVersionDraft, CreatedBy: userID}
+		var published TemplateVersion
+		if err := tx.Where("template_id = ? AND status = ?", templateID, TemplateVersionPublished).
+			First(&published).Error; err == nil {
+			draft.copyFrom(&published)
+			draft.BaseVersion = published.Version
+		} else {
+			draft.Name, draft.Category = template.Name, template.Category
+		}
+		in.applyTo(draft)
+		return tx.Create(draft).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return draft, nil
+}
+
+// SubmitTemplateVersion 提交草稿审核
+func SubmitTemplateVersion(db *gorm.DB, templateID uint, version int) (*TemplateVersion, error) {
+	var v TemplateVersion
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := findTemplateVersion(tx, templateID, version, &v); err != nil {
+			return err
+		}
+		if v.Status != TemplateVersionDraft {
+			return fmt.Errorf("%w: version %d is %s", ErrTemplateVersionState, version, v.Status)
+		}
+		now := time.Now()
+		v.Status = TemplateVersionPending
+		v.SubmittedAt = &now
+		return tx.Save(&v).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// ReviewTemplateVersion 审核提交的版本：通过则发布，驳回则退回草稿并附上审核意见
+func ReviewTemplateVersion(db *gorm.DB, templateID uint, version int, reviewerID uint, approve bool, note string) (*TemplateVersion, error) {
+	var v TemplateVersion
+	err := db.Transaction(func(tx *gorm.DB) error {
+		template, err := loadTemplateForVersioning(tx, templateID)
+		if err != nil {
+			return err
+		}
+		if err := findTemplateVersion(tx, templateID, version, &v); err != nil {
+			return err
+		}
+		if v.Status != TemplateVersionPending {
+			return fmt.Errorf("%w: version %d is %s", ErrTemplateVersionState, version, v.Status)
+		}
+		v.ReviewedBy = &reviewerID
+		v.ReviewNote = note
+		if !approve {
+			v.Status = TemplateVersionDraft
+			v.SubmittedAt = nil
+			return tx.Save(&v).Error
+		}
+		return publishTemplateVersion(tx, template, &v)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// RollbackTemplate 回滚到曾经发布过的版本：复制其内容生成新的发布版本，历史版本保持不变。
+// 回滚的内容已审核过，不需要再次审核
+func RollbackTemplate(db *gorm.DB, templateID uint, toVersion int, userID uint, note string) (*TemplateVersion, error) {
+	var v *TemplateVersion
+	err := db.Transaction(func(tx *gorm.DB) error {
+		template, err := loadTemplateForVersioning(tx, templateID)
+		if err != nil {
+			return err
+		}
+		var target TemplateVersion
+		if err := findTemplateVersion(tx, templateID, toVersion, &target); err != nil {
+			return err
+		}
+		if target.Status != TemplateVersionArchived {
+			return fmt.Errorf("%w: can only roll back to a previously published version, version %d is %s",
+				ErrTemplateVersionState, toVersion, target.Status)
+		}
+		next, err := nextTemplateVersion(tx, templateID)
+		if err != nil {
+			return err
+		}
+		if note == "" {
+			note = fmt.Sprintf("回滚到版本%d", toVersion)
+		}
+		v = &TemplateVersion{
+			TemplateID:  templateID,
+			Version:     next,
+			BaseVersion: toVersion,
+			ChangeNote:  note,
+			CreatedBy:   userID,
+			ReviewedBy:  target.ReviewedBy,
+		}
+		v.copyFrom(&target)
+		return publishTemplateVersion(tx, template, v)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// publishTemplateVersion 发布版本并同步到模板表
+func publishTemplateVersion(tx *gorm.DB, template *Template, v *TemplateVersion) error {
+	if err := tx.Model(&TemplateVersion{}).
+		Where("template_id = ? AND status = ?", template.ID, TemplateVersionPublished).
+		Update("status", TemplateVersionArchived).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	v.Status = TemplateVersionPublished
+	v.PublishedAt = &now
+	if err := tx.Save(v).Error; err != nil {
+		return err
+	}
+	return tx.Model(template).Updates(map[string]interface{}{
+		"name":        v.Name,
+		"category":    v.Category,
+		"description": v.Description,
+		"content":     v.Content,
+		"variables":   v.Variables,
+		"preview":     v.Preview,
+		"is_active":   true,
+		"updated_at":  now,
+	}).Error
+}
+
+// ListTemplateVersions 按版本号倒序列出版本；includeUnpublished为false时只返回发布过的版本
+func ListTemplateVersions(db *gorm.DB, templateID uint, includeUnpublished bool) ([]TemplateVersion, error) {
+	if _, err := ensureTemplateVersions(db, templateID); err != nil {
+		return nil, err
+	}
+	query := db.Where("template_id = ?", templateID)
+	if !includeUnpublished {
+		query = query.Where("status IN ?", []string{TemplateVersionPublished, TemplateVersionArchived})
+	}
+	var versions []TemplateVersion
+	if err := query.Order("version DESC").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// GetTemplateVersion 获取指定版本
+func GetTemplateVersion(db *gorm.DB, templateID uint, version int) (*TemplateVersion, error) {
+	if _, err := ensureTemplateVersions(db, templateID); err != nil {
+		return nil, err
+	}
+	var v TemplateVersion
+	if err := findTemplateVersion(db, templateID, version, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// RecordTemplateUsage 使用次数同时计入模板和当前发布版本
+func RecordTemplateUsage(db *gorm.DB, templateID uint) error {
+	if err := db.Model(&Template{}).Where("id = ?", templateID).
+		UpdateColumn("usage_count", gorm.Expr("usage_count + 1")).Error; err != nil {
+		return err
+	}
+	return db.Model(&TemplateVersion{}).
+		Where("template_id = ? AND status = ?", templateID, TemplateVersionPublished).
+		UpdateColumn("usage_count", gorm.Expr("usage_count + 1")).Error
+}
+
+// RateTemplate 记录用户对当前发布版本的评分，每个用户每个版本一条；
+// 返回模板和该版本的平均分
+func RateTemplate(db *gorm.DB, templateID, userID uint, score float64) (templateRating float64, version *TemplateVersion, err error) {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		published, err := ensureTemplateVersions(tx, templateID)
+		if err != nil {
+			return err
+		}
+		if published == nil {
+			return fmt.Errorf("%w: template has no published version", ErrTemplateVersionState)
+		}
+		version = published
+
+		now := time.Now()
+		var existing Rating
+		err = tx.Where("template_id = ? AND user_id = ? AND version = ?", templateID, userID, published.Version).
+			First(&existing).Error
+		switch {
+		case err == nil:
+			existing.Rating = score
+			existing.UpdatedAt = now
+			if err := tx.Save(&existing).Error; err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := tx.Create(&Rating{
+				TemplateID: templateID,
+				UserID:     userID,
+				Version:    published.Version,
+				Rating:     score,
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			}).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		var stats struct {
+			Avg   float64
+			Count int
+		}
+		if err := tx.Model(&Rating{}).Select("COALESCE(AVG(rating), 0) AS avg, COUNT(*) AS count").
+			Where("template_id = ? AND version = ?", templateID, published.Version).Scan(&stats).Error; err != nil {
+			return err
+		}
+		published.Rating, published.RatingCount = stats.Avg, stats.Count
+		if err := tx.Model(published).Updates(map[string]interface{}{
+			"rating":       stats.Avg,
+			"rating_count": stats.Count,
+		}).Error; err != nil {
+			return err
+		}
+
+		// 模板评分为所有版本评分的平均值
+		if err := tx.Model(&Rating{}).Select("COALESCE(AVG(rating), 0)").
+			Where("template_id = ?", templateID).Scan(&templateRating).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Template{}).Where("id = ?", templateID).Update("rating", templateRating).Error
+	})
+	return templateRating, version, err
+}
+
+// ensureTemplateVersions 版本功能上线前创建的模板没有版本记录，以当前内容补建为已发布的版本1。
+// 返回当前发布版本，没有时为nil
+func ensureTemplateVersions(db *gorm.DB, templateID uint) (*TemplateVersion, error) {
+	var published *TemplateVersion
+	err := db.Transaction(func(tx *gorm.DB) error {
+		template, err := loadTemplateForVersioning(tx, templateID)
+		if err != nil {
+			return err
+		}
+		var v TemplateVersion
+		err = tx.Where("template_id = ? AND status = ?", templateID, TemplateVersionPublished).First(&v).Error
+		if err == nil {
+			published = &v
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&TemplateVersion{}).Where("template_id = ?", templateID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+
+		publishedAt := template.UpdatedAt
+		v = TemplateVersion{
+			TemplateID:  templateID,
+			Version:     1,
+			Status:      TemplateVersionPublished,
+			Name:        template.Name,
+			Category:    template.Category,
+			Description: template.Description,
+			Content:     template.Content,
+			Variables:   template.Variables,
+			Preview:     template.Preview,
+			CreatedBy:   template.CreatedBy,
+			PublishedAt: &publishedAt,
+			Usage:       template.Usage,
+			Rating:      template.Rating,
+		}
+		if err := tx.Create(&v).Error; err != nil {
+			return err
+		}
+		published = &v
+		return nil
+	})
+	return published, err
+}
+
+func loadTemplateForVersioning(tx *gorm.DB, templateID uint) (*Template, error) {
+	var template Template
+	if err := tx.First(&template, templateID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTemplateNotFound
+		}
+		return nil, err
+	}
+	return &template, nil
+}
+
+func findTemplateVersion(tx *gorm.DB, templateID uint, version int, v *TemplateVersion) error {
+	err := tx.Where("template_id = ? AND version = ?", templateID, version).First(v).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrTemplateVersionNotFound
+	}
+	return err
+}
+
+func nextTemplateVersion(tx *gorm.DB, templateID uint) (int, error) {
+	var max int
+	err := tx.Model(&TemplateVersion{}).Select("COALESCE(MAX(version), 0)").
+		Where("template_id = ?", templateID).Scan(&max).Error
+	return max + 1, err
+}
+
+// TemplateFieldChange 元数据字段的变化
+type TemplateFieldChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// TemplateVersionDiff 两个版本之间的差异
+type TemplateVersionDiff struct {
+	TemplateID uint                           `json:"template_id"`
+	From       int                            `json:"from"`
+	To         int                            `json:"to"`
+	Fields     map[string]TemplateFieldChange `json:"fields"`
+	Hunks      []DiffHunk                     `json:"hunks"`
+	Unified    string                         `json:"unified"`
+}
+
+// DiffTemplateVersions 比较两个版本的元数据和内容
+func DiffTemplateVersions(db *gorm.DB, templateID uint, from, to int) (*TemplateVersionDiff, error) {
+	a, err := GetTemplateVersion(db, templateID, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := GetTemplateVersion(db, templateID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &TemplateVersionDiff{TemplateID: templateID, From: from, To: to, Fields: map[string]TemplateFieldChange{}}
+	fields := []struct {
+		name   string
+		before string
+		after  string
+	}{
+		{"name", a.Name, b.Name},
+		{"category", a.Category, b.Category},
+		{"description", a.Description, b.Description},
+		{"variables", a.Variables, b.Variables},
+		{"preview", a.Preview, b.Preview},
+	}
+	for _, f := range fields {
+		if f.before != f.after {
+			diff.Fields[f.name] = TemplateFieldChange{From: f.before, To: f.after}
+		}
+	}
+	diff.Hunks = DiffHunks(DiffLines(splitLines(a.Content), splitLines(b.Content)), 3)
+	diff.Unified = UnifiedDiff(diff.Hunks, fmt.Sprintf("v%d", from), fmt.Sprintf("v%d", to))
+	return diff, nil
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
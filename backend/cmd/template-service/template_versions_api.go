@@ -0,0 +1,274 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jobfirst/jobfirst-core"
+)
+
+// setupTemplateVersionRoutes 设置模板版本路由：版本历史、差异、提交审核、审核发布和回滚
+func setupTemplateVersionRoutes(templates *gin.RouterGroup, core *jobfirst.Core) {
+	// 待审核的版本（管理员）
+	templates.GET("/reviews/pending", func(c *gin.Context) {
+		if !isTemplateAdmin(c) {
+			standardErrorResponse(c, http.StatusForbidden, "Insufficient permissions", "")
+			return
+		}
+
+		var versions []TemplateVersion
+		if err := core.GetDB().Where("status = ?", TemplateVersionPending).
+			Order("submitted_at ASC").Find(&versions).Error; err != nil {
+			standardErrorResponse(c, http.StatusInternalServerError, "Failed to get pending reviews", err.Error())
+			return
+		}
+
+		standardSuccessResponse(c, versions, "Pending reviews retrieved successfully")
+	})
+
+	// 版本历史，包含每个版本的使用次数和评分；作者和管理员可以看到草稿
+	templates.GET("/:id/versions", func(c *gin.Context) {
+		template, ok := loadVersionedTemplate(c, core)
+		if !ok {
+			return
+		}
+
+		versions, err := ListTemplateVersions(core.GetDB(), template.ID, canManageTemplate(c, template))
+		if err != nil {
+			respondTemplateVersionError(c, err)
+			return
+		}
+
+		standardSuccessResponse(c, versions, "Template versions retrieved successfully")
+	})
+
+	// 获取指定版本
+	templates.GET("/:id/versions/:version", func(c *gin.Context) {
+		template, ok := loadVersionedTemplate(c, core)
+		if !ok {
+			return
+		}
+		versionNumber, ok := versionParam(c)
+		if !ok {
+			return
+		}
+
+		version, err := GetTemplateVersion(core.GetDB(), template.ID, versionNumber)
+		if err != nil {
+			respondTemplateVersionError(c, err)
+			return
+		}
+		if !versionVisible(c, template, version) {
+			standardErrorResponse(c, http.StatusNotFound, "Template version not found", "")
+			return
+		}
+
+		standardSuccessResponse(c, version, "Template version retrieved successfully")
+	})
+
+	// 比较两个版本
+	templates.GET("/:id/diff", func(c *gin.Context) {
+		template, ok := loadVersionedTemplate(c, core)
+		if !ok {
+			return
+		}
+		from, errFrom := strconv.Atoi(c.Query("from"))
+		to, errTo := strconv.Atoi(c.Query("to"))
+		if errFrom != nil || errTo != nil {
+			standardErrorResponse(c, http.StatusBadRequest, "from and to versions are required", "")
+			return
+		}
+
+		db := core.GetDB()
+		for _, number := range []int{from, to} {
+			version, err := GetTemplateVersion(db, template.ID, number)
+			if err != nil {
+				respondTemplateVersionError(c, err)
+				return
+			}
+			if !versionVisible(c, template, version) {
+				standardErrorResponse(c, http.StatusNotFound, "Template version not found", "")
+				return
+			}
+		}
+
+		diff, err := DiffTemplateVersions(db, template.ID, from, to)
+		if err != nil {
+			respondTemplateVersionError(c, err)
+			return
+		}
+
+		standardSuccessResponse(c, diff, "Template diff retrieved successfully")
+	})
+
+	// 提交草稿审核（作者或管理员）
+	templates.POST("/:id/versions/:version/submit", func(c *gin.Context) {
+		template, ok := loadVersionedTemplate(c, core)
+		if !ok {
+			return
+		}
+		if !canManageTemplate(c, template) {
+			standardErrorResponse(c, http.StatusForbidden, "Insufficient permissions", "")
+			return
+		}
+		versionNumber, ok := versionParam(c)
+		if !ok {
+			return
+		}
+
+		version, err := SubmitTemplateVersion(core.GetDB(), template.ID, versionNumber)
+		if err != nil {
+			respondTemplateVersionError(c, err)
+			return
+		}
+
+		standardSuccessResponse(c, version, "Template version submitted for review")
+	})
+
+	// 审核通过并发布（管理员）
+	templates.POST("/:id/versions/:version/approve", func(c *gin.Context) {
+		reviewTemplateVersion(c, core, true)
+	})
+
+	// 驳回，版本退回草稿（管理员）
+	templates.POST("/:id/versions/:version/reject", func(c *gin.Context) {
+		reviewTemplateVersion(c, core, false)
+	})
+
+	// 回滚到曾发布的版本（作者或管理员）
+	templates.POST("/:id/versions/:version/rollback", func(c *gin.Context) {
+		template, ok := loadVersionedTemplate(c, core)
+		if !ok {
+			return
+		}
+		if !canManageTemplate(c, template) {
+			standardErrorResponse(c, http.StatusForbidden, "Insufficient permissions", "")
+			return
+		}
+		versionNumber, ok := versionParam(c)
+		if !ok {
+			return
+		}
+
+		var request struct {
+			Note string `json:"note"`
+		}
+		// 请求体可选
+		_ = c.ShouldBindJSON(&request)
+
+		userIDInterface, _ := c.Get("user_id")
+		version, err := RollbackTemplate(core.GetDB(), template.ID, versionNumber, userIDInterface.(uint), request.Note)
+		if err != nil {
+			respondTemplateVersionError(c, err)
+			return
+		}
+
+		standardSuccessResponse(c, version, "Template rolled back successfully")
+	})
+}
+
+// reviewTemplateVersion 处理审核通过和驳回，驳回必须填写意见
+func reviewTemplateVersion(c *gin.Context, core *jobfirst.Core, approve bool) {
+	if !isTemplateAdmin(c) {
+		standardErrorResponse(c, http.StatusForbidden, "Insufficient permissions", "")
+		return
+	}
+	template, ok := loadVersionedTemplate(c, core)
+	if !ok {
+		return
+	}
+	versionNumber, ok := versionParam(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Note string `json:"note"`
+	}
+	_ = c.ShouldBindJSON(&request)
+	if !approve && request.Note == "" {
+		standardErrorResponse(c, http.StatusBadRequest, "Review note is required when rejecting", "")
+		return
+	}
+
+	userIDInterface, _ := c.Get("user_id")
+	version, err := ReviewTemplateVersion(core.GetDB(), template.ID, versionNumber, userIDInterface.(uint), approve, request.Note)
+	if err != nil {
+		respondTemplateVersionError(c, err)
+		return
+	}
+
+	if approve {
+		standardSuccessResponse(c, version, "Template version published")
+	} else {
+		standardSuccessResponse(c, version, "Template version rejected")
+	}
+}
+
+// loadVersionedTemplate 读取路径中的模板，失败时已写入响应
+func loadVersionedTemplate(c *gin.Context, core *jobfirst.Core) (*Template, bool) {
+	templateID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid template ID", err.Error())
+		return nil, false
+	}
+	var template Template
+	if err := core.GetDB().First(&template, templateID).Error; err != nil {
+		standardErrorResponse(c, http.StatusNotFound, "Template not found", err.Error())
+		return nil, false
+	}
+	if !template.IsActive && !canManageTemplate(c, &template) {
+		standardErrorResponse(c, http.StatusNotFound, "Template not found", "")
+		return nil, false
+	}
+	return &template, true
+}
+
+func versionParam(c *gin.Context) (int, bool) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version <= 0 {
+		standardErrorResponse(c, http.StatusBadRequest, "Invalid version", "")
+		return 0, false
+	}
+	return version, true
+}
+
+// versionVisible 草稿和审核中的版本只对作者和管理员可见
+func versionVisible(c *gin.Context, template *Template, version *TemplateVersion) bool {
+	switch version.Status {
+	case TemplateVersionPublished, TemplateVersionArchived:
+		return true
+	}
+	return canManageTemplate(c, template)
+}
+
+func isTemplateAdmin(c *gin.Context) bool {
+	role := c.GetString("role")
+	return role == "admin" || role == "super_admin"
+}
+
+// canManageTemplate 模板创建者或管理员
+func canManageTemplate(c *gin.Context, template *Template) bool {
+	if isTemplateAdmin(c) {
+		return true
+	}
+	userIDInterface, _ := c.Get("user_id")
+	userID, _ := userIDInterface.(uint)
+	return userID != 0 && template.CreatedBy == userID
+}
+
+// respondTemplateVersionError 将版本操作的错误映射为HTTP状态码
+func respondTemplateVersionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrTemplateNotFound):
+		standardErrorResponse(c, http.StatusNotFound, "Template not found", err.Error())
+	case errors.Is(err, ErrTemplateVersionNotFound):
+		standardErrorResponse(c, http.StatusNotFound, "Template version not found", err.Error())
+	case errors.Is(err, ErrTemplateVersionState):
+		standardErrorResponse(c, http.StatusConflict, "Template version state conflict", err.Error())
+	default:
+		standardErrorResponse(c, http.StatusInternalServerError, "Template version operation failed", err.Error())
+	}
+}
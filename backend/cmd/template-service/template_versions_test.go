@@ -0,0 +1,348 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newVersionTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存库每个连接独立，测试中只用一个连接
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&Template{}, &TemplateVersion{}, &Rating{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func reloadTemplate(t *testing.T, db *gorm.DB, id uint) Template {
+	t.Helper()
+	var template Template
+	if err := db.First(&template, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return template
+}
+
+func TestTemplateVersionWorkflow(t *testing.T) {
+	db := newVersionTestDB(t)
+	const author, admin, reader = 1, 99, 7
+
+	template, draft, err := CreateTemplateDraft(db, author, TemplateVersionInput{
+		Name: "技术简历", Category: "简历模板", Content: "<h1>{{.Basics.Name}}</h1>", ChangeNote: "初版",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if draft.Version != 1 || draft.Status != TemplateVersionDraft {
+		t.Fatalf("draft = %+v", draft)
+	}
+	if got := reloadTemplate(t, db, template.ID); got.IsActive || got.Content != "" {
+		t.Fatalf("unpublished template is visible: %+v", got)
+	}
+
+	// 草稿可以反复修改
+	if _, err := SaveTemplateDraft(db, template.ID, author, TemplateVersionInput{Description: "适合开发岗位"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SubmitTemplateVersion(db, template.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	// 审核中的版本不能修改，也不能重复提交
+	if _, err := SaveTemplateDraft(db, template.ID, author, TemplateVersionInput{Content: "x"}); !errors.Is(err, ErrTemplateVersionState) {
+		t.Fatalf("edit pending version err = %v", err)
+	}
+	if _, err := SubmitTemplateVersion(db, template.ID, 1); !errors.Is(err, ErrTemplateVersionState) {
+		t.Fatalf("resubmit err = %v", err)
+	}
+
+	v1, err := ReviewTemplateVersion(db, template.ID, 1, admin, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v1.Status != TemplateVersionPublished || v1.ReviewedBy == nil || *v1.ReviewedBy != admin {
+		t.Fatalf("published = %+v", v1)
+	}
+	live := reloadTemplate(t, db, template.ID)
+	if !live.IsActive || live.Content != "<h1>{{.Basics.Name}}</h1>" || live.Description != "适合开发岗位" {
+		t.Fatalf("template after publish = %+v", live)
+	}
+
+	// 修改只进入新草稿，线上内容不变
+	v2, err := SaveTemplateDraft(db, template.ID, author, TemplateVersionInput{Content: "<h1>{{.Basics.Name}}</h1>\n<p>{{.Basics.Email}}</p>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v2.Version != 2 || v2.BaseVersion != 1 || v2.Name != "技术简历" {
+		t.Fatalf("second draft = %+v", v2)
+	}
+	if got := reloadTemplate(t, db, template.ID); got.Content != live.Content {
+		t.Fatalf("draft leaked into live template: %q", got.Content)
+	}
+
+	// 驳回后退回草稿，修改后再次提交并发布
+	if _, err := SubmitTemplateVersion(db, template.ID, 2); err != nil {
+		t.Fatal(err)
+	}
+	rejected, err := ReviewTemplateVersion(db, template.ID, 2, admin, false, "缺少联系方式标签")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rejected.Status != TemplateVersionDraft || rejected.ReviewNote != "缺少联系方式标签" {
+		t.Fatalf("rejected = %+v", rejected)
+	}
+	if _, err := SubmitTemplateVersion(db, template.ID, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReviewTemplateVersion(db, template.ID, 2, admin, true, "通过"); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := ListTemplateVersions(db, template.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Status != TemplateVersionPublished || versions[1].Status != TemplateVersionArchived {
+		t.Fatalf("versions = %+v", versions)
+	}
+
+	// 只能回滚到曾发布的版本
+	if _, err := RollbackTemplate(db, template.ID, 2, author, ""); !errors.Is(err, ErrTemplateVersionState) {
+		t.Fatalf("rollback to current err = %v", err)
+	}
+	v3, err := RollbackTemplate(db, template.ID, 1, author, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v3.Version != 3 || v3.BaseVersion != 1 || v3.Status != TemplateVersionPublished || v3.ChangeNote != "回滚到版本1" {
+		t.Fatalf("rollback = %+v", v3)
+	}
+	if got := reloadTemplate(t, db, template.ID); got.Content != "<h1>{{.Basics.Name}}</h1>" {
+		t.Fatalf("content after rollback = %q", got.Content)
+	}
+	archived, err := GetTemplateVersion(db, template.ID, 2)
+	if err != nil || archived.Status != TemplateVersionArchived || !strings.Contains(archived.Content, "Email") {
+		t.Fatalf("version 2 after rollback = %+v, %v", archived, err)
+	}
+
+	if _, err := GetTemplateVersion(db, template.ID, 9); !errors.Is(err, ErrTemplateVersionNotFound) {
+		t.Fatalf("missing version err = %v", err)
+	}
+	if _, err := SaveTemplateDraft(db, 12345, reader, TemplateVersionInput{}); !errors.Is(err, ErrTemplateNotFound) {
+		t.Fatalf("missing template err = %v", err)
+	}
+}
+
+func TestTemplateUsageAndRatingPerVersion(t *testing.T) {
+	db := newVersionTestDB(t)
+
+	// 版本功能上线前的模板
+	legacy := Template{Name: "旧模板", Category: "其他", Content: "a", CreatedBy: 1, IsActive: true, Usage: 5, UpdatedAt: time.Now()}
+	if err := db.Create(&legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RecordTemplateUsage(db, legacy.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := RateTemplate(db, legacy.ID, 10, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := RateTemplate(db, legacy.ID, 11, 3); err != nil {
+		t.Fatal(err)
+	}
+	v1, err := GetTemplateVersion(db, legacy.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v1.Status != TemplateVersionPublished || v1.RatingCount != 2 || v1.Rating != 2.5 {
+		t.Fatalf("backfilled version = %+v", v1)
+	}
+
+	if _, err := SaveTemplateDraft(db, legacy.ID, 1, TemplateVersionInput{Content: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SubmitTemplateVersion(db, legacy.ID, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReviewTemplateVersion(db, legacy.ID, 2, 99, true, ""); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := RecordTemplateUsage(db, legacy.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 同一用户对新版本重新评分，不覆盖旧版本的评分
+	overall, v2, err := RateTemplate(db, legacy.ID, 10, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v2.Version != 2 || v2.Rating != 5 || v2.RatingCount != 1 {
+		t.Fatalf("version 2 rating = %+v", v2)
+	}
+	if overall != (2.0+3+5)/3 {
+		t.Errorf("template rating = %f", overall)
+	}
+	if _, _, err := RateTemplate(db, legacy.ID, 10, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := ListTemplateVersions(db, legacy.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[int]TemplateVersion{}
+	for _, v := range versions {
+		got[v.Version] = v
+	}
+	if got[1].Usage != 6 || got[2].Usage != 3 {
+		t.Errorf("usage v1=%d v2=%d, want 6 and 3", got[1].Usage, got[2].Usage)
+	}
+	if got[1].Rating != 2.5 || got[2].Rating != 4 || got[2].RatingCount != 1 {
+		t.Errorf("ratings v1=%+v v2=%+v", got[1], got[2])
+	}
+	if live := reloadTemplate(t, db, legacy.ID); live.Usage != 9 {
+		t.Errorf("template usage = %d, want 9", live.Usage)
+	}
+
+	// 尚未发布的模板不能评分
+	draftOnly, _, err := CreateTemplateDraft(db, 1, TemplateVersionInput{Name: "草稿", Category: "其他"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := RateTemplate(db, draftOnly.ID, 10, 5); !errors.Is(err, ErrTemplateVersionState) {
+		t.Fatalf("rate unpublished err = %v", err)
+	}
+}
+
+func TestDiffTemplateVersions(t *testing.T) {
+	db := newVersionTestDB(t)
+	template, _, err := CreateTemplateDraft(db, 1, TemplateVersionInput{
+		Name: "简历", Category: "简历模板", Content: "line1\nline2\nline3\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SubmitTemplateVersion(db, template.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReviewTemplateVersion(db, template.ID, 1, 99, true, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SaveTemplateDraft(db, template.ID, 1, TemplateVersionInput{Name: "技术简历", Content: "line1\nline2 changed\nline3\nline4\n"}); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := DiffTemplateVersions(db, template.ID, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change, ok := diff.Fields["name"]; !ok || change.From != "简历" || change.To != "技术简历" {
+		t.Errorf("fields = %+v", diff.Fields)
+	}
+	if _, ok := diff.Fields["category"]; ok {
+		t.Error("unchanged category reported")
+	}
+	want := "--- v1\n+++ v2\n@@ -1,3 +1,4 @@\n line1\n-line2\n+line2 changed\n line3\n+line4\n"
+	if diff.Unified != want {
+		t.Errorf("unified diff =\n%s\nwant\n%s", diff.Unified, want)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		ops  string // 每行一个字符：=、+、-
+	}{
+		{"identical", "a\nb", "a\nb", "=="},
+		{"empty to text", "", "a\nb", "++"},
+		{"text to empty", "a\nb", "", "--"},
+		{"insert middle", "a\nc", "a\nb\nc", "=+="},
+		{"replace", "a\nb\nc", "a\nx\nc", "=-+="},
+		{"minimal", "a\nb\nc\na\nb\nb\na", "c\nb\na\nb\na\nc", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := DiffLines(splitLines(tt.a), splitLines(tt.b))
+			var ops strings.Builder
+			edits := 0
+			var rebuiltOld, rebuiltNew []string
+			for _, line := range lines {
+				switch line.Op {
+				case DiffEqual:
+					ops.WriteByte('=')
+					rebuiltOld = append(rebuiltOld, line.Text)
+					rebuiltNew = append(rebuiltNew, line.Text)
+				case DiffInsert:
+					ops.WriteByte('+')
+					rebuiltNew = append(rebuiltNew, line.Text)
+					edits++
+				case DiffDelete:
+					ops.WriteByte('-')
+					rebuiltOld = append(rebuiltOld, line.Text)
+					edits++
+				}
+			}
+			if strings.Join(rebuiltOld, "\n") != tt.a || strings.Join(rebuiltNew, "\n") != tt.b {
+				t.Fatalf("diff does not reproduce inputs: %+v", lines)
+			}
+			if tt.ops != "" && ops.String() != tt.ops {
+				t.Errorf("ops = %s, want %s", ops.String(), tt.ops)
+			}
+			// Myers论文中的示例，最短编辑距离为5
+			if tt.name == "minimal" && edits != 5 {
+				t.Errorf("edits = %d, want 5", edits)
+			}
+		})
+	}
+}
+
+func TestDiffHunks(t *testing.T) {
+	var a, b []string
+	for i := 1; i <= 20; i++ {
+		line := "line" + strings.Repeat("x", i)
+		a = append(a, line)
+		b = append(b, line)
+	}
+	b[1] = "changed 2"
+	b[17] = "changed 18"
+	hunks := DiffHunks(DiffLines(a, b), 3)
+	if len(hunks) != 2 {
+		t.Fatalf("hunks = %d, want 2", len(hunks))
+	}
+	if h := hunks[0]; h.OldStart != 1 || h.OldLines != 5 || h.NewStart != 1 || h.NewLines != 5 {
+		t.Errorf("first hunk = %+v", h)
+	}
+	if h := hunks[1]; h.OldStart != 15 || h.OldLines != 6 || h.NewLines != 6 {
+		t.Errorf("second hunk = %+v", h)
+	}
+
+	// 间隔不超过两倍上下文时合并
+	b[7] = "changed 8"
+	if hunks := DiffHunks(DiffLines(a, b), 3); len(hunks) != 2 || hunks[0].OldLines != 11 {
+		t.Errorf("merged hunks = %+v", hunks)
+	}
+
+	// 纯插入到空内容
+	insert := DiffHunks(DiffLines(nil, []string{"a"}), 3)
+	if got := UnifiedDiff(insert, "v1", "v2"); got != "--- v1\n+++ v2\n@@ -0,0 +1 @@\n+a\n" {
+		t.Errorf("unified = %q", got)
+	}
+}
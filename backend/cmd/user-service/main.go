@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -50,6 +51,9 @@ func main() {
 	// 设置业务路由 (保持现有API)
 	setupBusinessRoutes(r, core)
 
+	// 设置OAuth2/OIDC授权服务路由
+	setupOAuthRoutes(r, core)
+
 	// 注册到Consul
 	portInt, _ := strconv.Atoi(port)
 	registerToConsul("user-service", "127.0.0.1", portInt)
@@ -139,6 +143,42 @@ func setupBusinessRoutes(r *gin.Engine, core *jobfirst.Core) {
 				return
 			}
 
+			if resp.MFARequired {
+				standardSuccessResponse(c, gin.H{
+					"mfa_required":            true,
+					"mfa_enrollment_required": resp.MFAEnrollmentRequired,
+					"mfa_token":               resp.MFAToken,
+					"expires_at":              resp.ExpiresAt,
+					"message":                 resp.Message,
+				}, "需要多因素认证")
+				return
+			}
+
+			standardSuccessResponse(c, gin.H{
+				"token":      resp.Token,
+				"user":       resp.User,
+				"expires_at": resp.ExpiresAt,
+				"message":    resp.Message,
+			}, "登录成功")
+		})
+
+		// 使用MFA待验证token和验证码完成登录
+		public.POST("/auth/mfa/verify", func(c *gin.Context) {
+			var req struct {
+				MFAToken string `json:"mfa_token" binding:"required"`
+				Code     string `json:"code" binding:"required"`
+			}
+			if err := c.ShouldBindJSON(&req); err != nil {
+				standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+				return
+			}
+
+			resp, err := core.AuthManager.VerifyMFALogin(req.MFAToken, req.Code, c.ClientIP(), c.GetHeader("User-Agent"))
+			if err != nil {
+				standardErrorResponse(c, mfaErrorStatus(err), "多因素认证失败", err.Error())
+				return
+			}
+
 			standardSuccessResponse(c, gin.H{
 				"token":      resp.Token,
 				"user":       resp.User,
@@ -148,6 +188,39 @@ func setupBusinessRoutes(r *gin.Engine, core *jobfirst.Core) {
 		})
 	}
 
+	// MFA注册API（允许使用MFA待验证token，以便策略要求MFA的用户首次登录时完成注册）
+	mfaEnroll := r.Group("/api/v1/auth/mfa")
+	mfaEnroll.Use(core.AuthMiddleware.RequireAuthAllowMFAPending())
+	{
+		// 开始注册，返回密钥和otpauth URI
+		mfaEnroll.POST("/enroll", func(c *gin.Context) {
+			enrollment, err := core.AuthManager.EnrollMFA(c.GetUint("user_id"))
+			if err != nil {
+				standardErrorResponse(c, http.StatusBadRequest, "MFA注册失败", err.Error())
+				return
+			}
+			standardSuccessResponse(c, enrollment, "请使用验证器应用扫描二维码")
+		})
+
+		// 确认注册，返回一次性恢复码
+		mfaEnroll.POST("/confirm", func(c *gin.Context) {
+			var req struct {
+				Code string `json:"code" binding:"required"`
+			}
+			if err := c.ShouldBindJSON(&req); err != nil {
+				standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+				return
+			}
+
+			codes, err := core.AuthManager.ConfirmMFA(c.GetUint("user_id"), req.Code)
+			if err != nil {
+				standardErrorResponse(c, http.StatusBadRequest, "MFA确认失败", err.Error())
+				return
+			}
+			standardSuccessResponse(c, gin.H{"recovery_codes": codes}, "MFA已启用，请妥善保存恢复码")
+		})
+	}
+
 	// 需要认证的API路由
 	authMiddleware := core.AuthMiddleware.RequireAuth()
 	api := r.Group("/api/v1")
@@ -198,7 +271,109 @@ func setupBusinessRoutes(r *gin.Engine, core *jobfirst.Core) {
 				}, "更新用户信息成功")
 			})
 		}
+
+		// MFA管理API
+		mfa := api.Group("/auth/mfa")
+		{
+			// 敏感操作前重新验证MFA，返回新token
+			mfa.POST("/step-up", func(c *gin.Context) {
+				var req struct {
+					Code string `json:"code" binding:"required"`
+				}
+				if err := c.ShouldBindJSON(&req); err != nil {
+					standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+					return
+				}
+
+				claims := c.MustGet("claims").(*auth.Claims)
+				token, expiresAt, err := core.AuthManager.StepUpMFA(claims, req.Code)
+				if err != nil {
+					standardErrorResponse(c, mfaErrorStatus(err), "多因素认证失败", err.Error())
+					return
+				}
+				standardSuccessResponse(c, gin.H{
+					"token":      token,
+					"expires_at": expiresAt.Format(time.RFC3339),
+				}, "验证成功")
+			})
+
+			// 重新生成恢复码
+			mfa.POST("/recovery-codes", core.AuthMiddleware.RequireMFA(), func(c *gin.Context) {
+				codes, err := core.AuthManager.RegenerateRecoveryCodes(c.GetUint("user_id"))
+				if err != nil {
+					standardErrorResponse(c, http.StatusBadRequest, "生成恢复码失败", err.Error())
+					return
+				}
+				standardSuccessResponse(c, gin.H{"recovery_codes": codes}, "恢复码已重新生成")
+			})
+
+			// 关闭MFA（角色策略要求MFA时不允许关闭）
+			mfa.DELETE("", core.AuthMiddleware.RequireMFA(), func(c *gin.Context) {
+				if core.AuthManager.MFAPolicy().Requirement(c.GetString("role")) == auth.MFARequired {
+					standardErrorResponse(c, http.StatusForbidden, "关闭MFA失败", "当前角色必须启用多因素认证")
+					return
+				}
+				if err := core.AuthManager.DisableMFA(c.GetUint("user_id")); err != nil {
+					standardErrorResponse(c, http.StatusInternalServerError, "关闭MFA失败", err.Error())
+					return
+				}
+				standardSuccessResponse(c, nil, "MFA已关闭")
+			})
+		}
+
+		// 登录锁定管理API（管理员）
+		lockout := api.Group("/admin/auth/lockout")
+		lockout.Use(core.AuthMiddleware.RequireAdmin())
+		{
+			// 查询账户锁定状态
+			lockout.GET("/:username", func(c *gin.Context) {
+				status, err := core.AuthManager.GetLockoutStatus(c.Param("username"))
+				if err != nil {
+					standardErrorResponse(c, http.StatusInternalServerError, "查询锁定状态失败", err.Error())
+					return
+				}
+				standardSuccessResponse(c, status, "查询锁定状态成功")
+			})
+
+			// 解锁账户或IP
+			lockout.POST("/unlock", func(c *gin.Context) {
+				var req struct {
+					Username string `json:"username"`
+					IP       string `json:"ip"`
+				}
+				if err := c.ShouldBindJSON(&req); err != nil || (req.Username == "" && req.IP == "") {
+					standardErrorResponse(c, http.StatusBadRequest, "Invalid request payload", "username or ip is required")
+					return
+				}
+
+				if req.Username != "" {
+					if err := core.AuthManager.UnlockAccount(req.Username); err != nil {
+						standardErrorResponse(c, http.StatusInternalServerError, "解锁账户失败", err.Error())
+						return
+					}
+				}
+				if req.IP != "" {
+					if err := core.AuthManager.UnlockIP(req.IP); err != nil {
+						standardErrorResponse(c, http.StatusInternalServerError, "解锁IP失败", err.Error())
+						return
+					}
+				}
+
+				standardSuccessResponse(c, gin.H{
+					"username": req.Username,
+					"ip":       req.IP,
+				}, "解锁成功")
+			})
+		}
+	}
+}
+
+// mfaErrorStatus MFA校验失败对应的HTTP状态码，失败次数过多时返回429
+func mfaErrorStatus(err error) int {
+	if errors.Is(err, auth.ErrMFATooManyAttempts) {
+		return http.StatusTooManyRequests
 	}
+	return http.StatusUnauthorized
 }
 
 // registerToConsul 注册服务到Consul
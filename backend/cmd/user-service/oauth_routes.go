@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jobfirst/jobfirst-core"
+	"github.com/jobfirst/jobfirst-core/auth"
+)
+
+// setupOAuthRoutes 设置OAuth2/OIDC授权服务路由
+func setupOAuthRoutes(r *gin.Engine, core *jobfirst.Core) {
+	// OIDC发现与公钥
+	r.GET("/.well-known/openid-configuration", func(c *gin.Context) {
+		c.JSON(http.StatusOK, core.AuthManager.OIDCDiscovery())
+	})
+	r.GET("/oauth/jwks", func(c *gin.Context) {
+		c.JSON(http.StatusOK, core.AuthManager.JWKS())
+	})
+
+	// 协议端点（RFC 6749/7009/7662），使用表单参数和标准错误格式
+	oauth := r.Group("/oauth")
+	{
+		oauth.POST("/token", func(c *gin.Context) {
+			c.Header("Cache-Control", "no-store")
+			client, err := authenticateOAuthClient(c, core)
+			if err != nil {
+				oauthErrorResponse(c, err)
+				return
+			}
+
+			var resp *auth.OAuthTokenResponse
+			switch c.PostForm("grant_type") {
+			case auth.GrantAuthorizationCode:
+				resp, err = core.AuthManager.ExchangeAuthorizationCode(client,
+					c.PostForm("code"), c.PostForm("redirect_uri"), c.PostForm("code_verifier"))
+			case auth.GrantClientCredentials:
+				resp, err = core.AuthManager.ClientCredentialsGrant(client, c.PostForm("scope"))
+			case auth.GrantRefreshToken:
+				resp, err = core.AuthManager.RefreshTokenGrant(client, c.PostForm("refresh_token"), c.PostForm("scope"))
+			default:
+				err = &auth.OAuthError{Code: auth.OAuthErrUnsupportedGrantType, Description: "不支持的授权类型"}
+			}
+			if err != nil {
+				oauthErrorResponse(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, resp)
+		})
+
+		oauth.POST("/introspect", func(c *gin.Context) {
+			client, err := authenticateOAuthClient(c, core)
+			if err != nil {
+				oauthErrorResponse(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, core.AuthManager.IntrospectToken(client, c.PostForm("token")))
+		})
+
+		oauth.POST("/revoke", func(c *gin.Context) {
+			client, err := authenticateOAuthClient(c, core)
+			if err != nil {
+				oauthErrorResponse(c, err)
+				return
+			}
+			if err := core.AuthManager.RevokeOAuthToken(client, c.PostForm("token")); err != nil {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "temporarily_unavailable"})
+				return
+			}
+			c.Status(http.StatusOK)
+		})
+
+		userInfo := func(c *gin.Context) {
+			claims := c.MustGet("claims").(*auth.Claims)
+			info, err := core.AuthManager.OIDCUserInfo(claims)
+			if err != nil {
+				var oauthErr *auth.OAuthError
+				if errors.As(err, &oauthErr) {
+					c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+					c.JSON(http.StatusForbidden, oauthErr)
+					return
+				}
+				c.JSON(http.StatusNotFound, gin.H{"error": "invalid_token"})
+				return
+			}
+			c.JSON(http.StatusOK, info)
+		}
+		oauth.GET("/userinfo", core.AuthMiddleware.RequireScope(auth.ScopeOpenID), userInfo)
+		oauth.POST("/userinfo", core.AuthMiddleware.RequireScope(auth.ScopeOpenID), userInfo)
+	}
+
+	// 同意页面、应用管理和授权管理（需要用户登录）
+	api := r.Group("/api/v1/oauth")
+	api.Use(core.AuthMiddleware.RequireAuth())
+	{
+		// 获取同意页面信息
+		api.GET("/authorize", func(c *gin.Context) {
+			var req auth.AuthorizeRequest
+			if err := c.ShouldBindQuery(&req); err != nil {
+				standardErrorResponse(c, http.StatusBadRequest, "请求参数错误", err.Error())
+				return
+			}
+			info, err := core.AuthManager.GetConsentInfo(c.GetUint("user_id"), req)
+			if err != nil {
+				standardErrorResponse(c, http.StatusBadRequest, "授权请求无效", err.Error())
+				return
+			}
+			standardSuccessResponse(c, info)
+		})
+
+		// 提交用户同意/拒绝，返回前端需要跳转的回调地址
+		api.POST("/authorize", func(c *gin.Context) {
+			var req struct {
+				auth.AuthorizeRequest
+				Approve bool `json:"approve"`
+			}
+			if err := c.ShouldBindJSON(&req); err != nil {
+				standardErrorResponse(c, http.StatusBadRequest, "请求参数错误", err.Error())
+				return
+			}
+
+			var redirectTo string
+			var err error
+			if req.Approve {
+				redirectTo, err = core.AuthManager.ApproveAuthorization(c.GetUint("user_id"), req.AuthorizeRequest)
+			} else {
+				redirectTo, err = core.AuthManager.DenyAuthorization(req.AuthorizeRequest)
+			}
+			if err != nil {
+				standardErrorResponse(c, http.StatusBadRequest, "授权请求无效", err.Error())
+				return
+			}
+			standardSuccessResponse(c, gin.H{"redirect_to": redirectTo})
+		})
+
+		// 支持的作用域
+		api.GET("/scopes", func(c *gin.Context) {
+			standardSuccessResponse(c, auth.SupportedOAuthScopes())
+		})
+
+		// 第三方应用管理
+		api.GET("/clients", func(c *gin.Context) {
+			clients, err := core.AuthManager.ListOAuthClients(c.GetUint("user_id"))
+			if err != nil {
+				standardErrorResponse(c, http.StatusInternalServerError, "获取应用列表失败", err.Error())
+				return
+			}
+			standardSuccessResponse(c, clients)
+		})
+
+		api.POST("/clients", func(c *gin.Context) {
+			var req auth.OAuthClientRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				standardErrorResponse(c, http.StatusBadRequest, "请求参数错误", err.Error())
+				return
+			}
+			registration, err := core.AuthManager.RegisterOAuthClient(c.GetUint("user_id"), req)
+			if err != nil {
+				standardErrorResponse(c, http.StatusBadRequest, "注册应用失败", err.Error())
+				return
+			}
+			standardSuccessResponse(c, registration, "应用注册成功，请妥善保存client_secret")
+		})
+
+		api.DELETE("/clients/:client_id", func(c *gin.Context) {
+			if err := core.AuthManager.DeleteOAuthClient(c.GetUint("user_id"), c.Param("client_id")); err != nil {
+				standardErrorResponse(c, http.StatusBadRequest, "删除应用失败", err.Error())
+				return
+			}
+			standardSuccessResponse(c, nil, "应用已删除")
+		})
+
+		// 用户已授权的应用
+		api.GET("/consents", func(c *gin.Context) {
+			consents, err := core.AuthManager.ListOAuthConsents(c.GetUint("user_id"))
+			if err != nil {
+				standardErrorResponse(c, http.StatusInternalServerError, "获取授权列表失败", err.Error())
+				return
+			}
+			standardSuccessResponse(c, consents)
+		})
+
+		api.DELETE("/consents/:client_id", func(c *gin.Context) {
+			if err := core.AuthManager.RevokeOAuthConsent(c.GetUint("user_id"), c.Param("client_id")); err != nil {
+				standardErrorResponse(c, http.StatusInternalServerError, "撤销授权失败", err.Error())
+				return
+			}
+			standardSuccessResponse(c, nil, "已撤销授权")
+		})
+	}
+}
+
+// authenticateOAuthClient 通过HTTP Basic或表单参数认证客户端
+func authenticateOAuthClient(c *gin.Context, core *jobfirst.Core) (*auth.OAuthClient, error) {
+	clientID, clientSecret, ok := c.Request.BasicAuth()
+	if !ok {
+		clientID = c.PostForm("client_id")
+		clientSecret = c.PostForm("client_secret")
+	}
+	return core.AuthManager.AuthenticateOAuthClient(clientID, clientSecret)
+}
+
+// oauthErrorResponse 按RFC 6749输出错误
+func oauthErrorResponse(c *gin.Context, err error) {
+	var oauthErr *auth.OAuthError
+	if !errors.As(err, &oauthErr) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	status := http.StatusBadRequest
+	if oauthErr.Code == auth.OAuthErrInvalidClient {
+		status = http.StatusUnauthorized
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	c.JSON(status, oauthErr)
+}
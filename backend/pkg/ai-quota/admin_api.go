@@ -1,6 +1,7 @@
 package aiquota
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -8,380 +9,252 @@ import (
 	"gorm.io/gorm"
 )
 
-// AdminAPI 管理员配额管理API
+// validSubscriptions 可设置的订阅状态
+var validSubscriptions = map[string]bool{"trial": true, "free": true, "premium": true, "enterprise": true}
+
+// AdminAPI 管理员配额API
 type AdminAPI struct {
-	db         *gorm.DB
-	middleware *QuotaMiddleware
+	service *Service
 }
 
 // NewAdminAPI 创建管理员API
-func NewAdminAPI(db *gorm.DB) *AdminAPI {
-	return &AdminAPI{
-		db:         db,
-		middleware: NewQuotaMiddleware(db),
-	}
+func NewAdminAPI(service *Service) *AdminAPI {
+	return &AdminAPI{service: service}
 }
 
-// UpdateUserSubscription 更新用户订阅状态
-// @Summary 更新用户订阅状态
-// @Description 管理员更新用户订阅状态并自动调整配额
-// @Tags Admin Quota
-// @Accept json
-// @Produce json
-// @Param user_id path int true "用户ID"
-// @Param request body UpdateSubscriptionRequest true "订阅更新请求"
-// @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/admin/quota/user/{user_id}/subscription [put]
-func (api *AdminAPI) UpdateUserSubscription(c *gin.Context) {
-	userIDStr := c.Param("user_id")
-	userID, err := strconv.ParseUint(userIDStr, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid user ID",
-		})
-		return
-	}
-
-	var request UpdateSubscriptionRequest
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "invalid request",
-			"details": err.Error(),
-		})
+// GetUserQuotaDetails 获取用户配额详情
+func (api *AdminAPI) GetUserQuotaDetails(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
 		return
 	}
 
-	// 验证订阅类型
-	validTypes := []string{"trial", "basic", "premium", "enterprise"}
-	if !contains(validTypes, request.SubscriptionStatus) {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":       "invalid subscription status",
-			"valid_types": validTypes,
-		})
+	serviceType := c.DefaultQuery("service_type", "document_parsing")
+	var quota UserAIQuota
+	if err := api.service.db.Where("user_id = ? AND service_type = ?", userID, serviceType).First(&quota).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "quota not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-
-	// 更新用户订阅状态
-	err = api.db.Exec("UPDATE users SET subscription_status = ? WHERE id = ?",
-		request.SubscriptionStatus, userID).Error
+	status, err := api.service.Status(userID, serviceType, 0)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "failed to update user subscription",
-			"details": err.Error(),
-		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 更新所有服务的配额限制
-	serviceTypes := []string{"document_parsing", "text_analysis", "ai_chat"}
-	updatedServices := []string{}
-
-	for _, serviceType := range serviceTypes {
-		// 获取新的限制配置
-		var limits struct {
-			DailyLimit       int     `json:"daily_limit"`
-			MonthlyLimit     int     `json:"monthly_limit"`
-			DailyCostLimit   float64 `json:"daily_cost_limit"`
-			MonthlyCostLimit float64 `json:"monthly_cost_limit"`
-		}
-
-		err = api.db.Raw(`
-			SELECT daily_limit, monthly_limit, daily_cost_limit, monthly_cost_limit 
-			FROM subscription_limits 
-			WHERE subscription_type = ? AND service_type = ? AND is_active = true
-		`, request.SubscriptionStatus, serviceType).Scan(&limits).Error
-
-		if err != nil {
-			continue // 跳过没有配置的服务
-		}
-
-		// 更新配额限制
-		err = api.db.Model(&UserAIQuota{}).Where("user_id = ? AND service_type = ?", userID, serviceType).Updates(map[string]interface{}{
-			"subscription_type":  request.SubscriptionStatus,
-			"daily_limit":        limits.DailyLimit,
-			"monthly_limit":      limits.MonthlyLimit,
-			"daily_cost_limit":   limits.DailyCostLimit,
-			"monthly_cost_limit": limits.MonthlyCostLimit,
-		}).Error
-
-		if err == nil {
-			updatedServices = append(updatedServices, serviceType)
-		}
+	// 获取用户信息
+	var user struct {
+		ID                 uint   `json:"id"`
+		Username           string `json:"username"`
+		SubscriptionStatus string `json:"subscription_status"`
+	}
+	if err := api.service.db.Raw("SELECT id, username, COALESCE(subscription_status, 'trial') as subscription_status FROM users WHERE id = ?", userID).Scan(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "user subscription updated successfully",
-		"data": gin.H{
-			"user_id":                 userID,
-			"new_subscription_status": request.SubscriptionStatus,
-			"updated_services":        updatedServices,
-		},
+		"user":         user,
+		"quota":        quota,
+		"quota_info":   status,
+		"service_type": serviceType,
 	})
 }
 
-// ResetUserQuota 重置用户配额
-// @Summary 重置用户配额
-// @Description 管理员重置用户配额使用量
-// @Tags Admin Quota
-// @Accept json
-// @Produce json
-// @Param user_id path int true "用户ID"
-// @Param service_type query string false "服务类型，不指定则重置所有服务"
-// @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/admin/quota/user/{user_id}/reset [post]
-func (api *AdminAPI) ResetUserQuota(c *gin.Context) {
-	userIDStr := c.Param("user_id")
-	userID, err := strconv.ParseUint(userIDStr, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid user ID",
-		})
+// UpdateUserSubscription 更新用户订阅状态，并按新订阅更新已有配额的限制
+func (api *AdminAPI) UpdateUserSubscription(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
 		return
 	}
 
-	serviceType := c.Query("service_type")
-
-	// 重置配额使用量
-	query := api.db.Model(&UserAIQuota{}).Where("user_id = ?", userID)
-	if serviceType != "" {
-		query = query.Where("service_type = ?", serviceType)
+	var request struct {
+		SubscriptionStatus string `json:"subscription_status" binding:"required"`
 	}
-
-	err = query.Updates(map[string]interface{}{
-		"daily_used":        0,
-		"monthly_used":      0,
-		"daily_cost_used":   0,
-		"monthly_cost_used": 0,
-	}).Error
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "failed to reset quota",
-			"details": err.Error(),
-		})
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validSubscriptions[request.SubscriptionStatus] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid subscription status"})
 		return
 	}
 
-	message := "quota reset successfully"
-	if serviceType != "" {
-		message = "quota reset successfully for service: " + serviceType
+	if err := api.service.db.Exec("UPDATE users SET subscription_status = ? WHERE id = ?", request.SubscriptionStatus, userID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := api.service.ApplySubscription(userID, request.SubscriptionStatus); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": message,
-		"data": gin.H{
-			"user_id":      userID,
-			"service_type": serviceType,
-		},
+		"message":             "subscription updated successfully",
+		"user_id":             userID,
+		"subscription_status": request.SubscriptionStatus,
 	})
 }
 
-// GetUserQuotaDetails 获取用户配额详情
-// @Summary 获取用户配额详情
-// @Description 管理员查看用户配额详情
-// @Tags Admin Quota
-// @Accept json
-// @Produce json
-// @Param user_id path int true "用户ID"
-// @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/admin/quota/user/{user_id}/details [get]
-func (api *AdminAPI) GetUserQuotaDetails(c *gin.Context) {
-	userIDStr := c.Param("user_id")
-	userID, err := strconv.ParseUint(userIDStr, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid user ID",
-		})
+// UpdateUserLimits 设置用户某项服务的限制和突发额度。company_id将其挂到企业配额池下，detach_company解除
+func (api *AdminAPI) UpdateUserLimits(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
 		return
 	}
 
-	// 获取用户信息
-	var user struct {
-		ID                 uint   `json:"id"`
-		Username           string `json:"username"`
-		SubscriptionStatus string `json:"subscription_status"`
+	var request struct {
+		ServiceType string `json:"service_type" binding:"required"`
+		Limits
+		CompanyID     *uint `json:"company_id"`
+		DetachCompany bool  `json:"detach_company"`
 	}
-	err = api.db.Raw("SELECT id, username, subscription_status FROM users WHERE id = ?", userID).Scan(&user).Error
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "user not found",
-		})
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 获取所有服务的配额信息
-	serviceTypes := []string{"document_parsing", "text_analysis", "ai_chat"}
-	quotas := make(map[string]*QuotaCheckResult)
-
-	for _, serviceType := range serviceTypes {
-		result, err := api.middleware.GetUserQuota(uint(userID), serviceType)
-		if err != nil {
-			quotas[serviceType] = &QuotaCheckResult{
-				Allowed: false,
-				Reason:  "error",
-			}
-		} else {
-			quotas[serviceType] = result
+	if request.CompanyID != nil || request.DetachCompany {
+		if _, err := api.service.SetUserCompany(userID, request.ServiceType, request.CompanyID); err != nil {
+			respondQuotaError(c, err)
+			return
 		}
 	}
-
-	// 获取使用统计
-	usageStats := make(map[string]interface{})
-	for _, serviceType := range serviceTypes {
-		stats, err := api.getUsageStats(uint(userID), serviceType, 30)
-		if err == nil {
-			usageStats[serviceType] = stats
-		}
+	quota, err := api.service.SetUserLimits(userID, request.ServiceType, request.Limits)
+	if err != nil {
+		respondQuotaError(c, err)
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data": gin.H{
-			"user":        user,
-			"quotas":      quotas,
-			"usage_stats": usageStats,
-		},
+		"message": "quota limits updated successfully",
+		"quota":   quota,
 	})
 }
 
-// GetSystemQuotaStats 获取系统配额统计
-// @Summary 获取系统配额统计
-// @Description 管理员查看系统配额使用统计
-// @Tags Admin Quota
-// @Accept json
-// @Produce json
-// @Success 200 {object} map[string]interface{}
-// @Failure 500 {object} map[string]string
-// @Router /api/admin/quota/system/stats [get]
-func (api *AdminAPI) GetSystemQuotaStats(c *gin.Context) {
-	// 获取各订阅类型的用户数量
-	var subscriptionStats []struct {
-		SubscriptionStatus string `json:"subscription_status"`
-		UserCount          int    `json:"user_count"`
+// GetCompanyPool 获取企业配额池
+func (api *AdminAPI) GetCompanyPool(c *gin.Context) {
+	companyID, err := strconv.ParseUint(c.Param("company_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid company ID"})
+		return
 	}
 
-	err := api.db.Raw(`
-		SELECT subscription_status, COUNT(*) as user_count 
-		FROM users 
-		GROUP BY subscription_status
-	`).Scan(&subscriptionStats).Error
-
+	serviceType := c.DefaultQuery("service_type", "document_parsing")
+	pool, err := api.service.GetCompanyPool(uint(companyID), serviceType)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to get subscription stats",
-		})
+		respondQuotaError(c, err)
 		return
 	}
 
-	// 获取今日AI服务使用统计
-	var todayUsage struct {
-		TotalCalls   int     `json:"total_calls"`
-		TotalCost    float64 `json:"total_cost"`
-		SuccessCalls int     `json:"success_calls"`
-		FailedCalls  int     `json:"failed_calls"`
+	c.JSON(http.StatusOK, gin.H{
+		"pool": pool,
+	})
+}
+
+// UpdateCompanyPool 设置企业配额池的限制，企业下挂靠的用户配额共同占用该配额池
+func (api *AdminAPI) UpdateCompanyPool(c *gin.Context) {
+	companyID, err := strconv.ParseUint(c.Param("company_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid company ID"})
+		return
 	}
 
-	err = api.db.Raw(`
-		SELECT 
-			COUNT(*) as total_calls,
-			SUM(cost_usd) as total_cost,
-			SUM(CASE WHEN status = 'success' THEN 1 ELSE 0 END) as success_calls,
-			SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END) as failed_calls
-		FROM ai_service_usage 
-		WHERE DATE(created_at) = CURDATE()
-	`).Scan(&todayUsage).Error
+	var request struct {
+		ServiceType string `json:"service_type" binding:"required"`
+		Limits
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
+	pool, err := api.service.SetCompanyPool(uint(companyID), request.ServiceType, request.Limits)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to get usage stats",
-		})
+		respondQuotaError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data": gin.H{
-			"subscription_stats": subscriptionStats,
-			"today_usage":        todayUsage,
-		},
+		"message": "company quota pool updated successfully",
+		"pool":    pool,
 	})
 }
 
-// UpdateSubscriptionRequest 更新订阅请求
-type UpdateSubscriptionRequest struct {
-	SubscriptionStatus string `json:"subscription_status" binding:"required"`
-}
-
-// contains 检查切片是否包含指定元素
-func contains(slice []string, item string) bool {
-	for _, s := range slice {
-		if s == item {
-			return true
-		}
-	}
-	return false
-}
-
-// getUsageStats 获取使用统计（复用QuotaAPI的方法）
-func (api *AdminAPI) getUsageStats(userID uint, serviceType string, days int) (*UsageStats, error) {
-	var stats UsageStats
-	stats.UserID = userID
-	stats.ServiceType = serviceType
-
-	// 构建查询条件
-	query := api.db.Model(&AIUsageRecord{}).Where("user_id = ?", userID)
-	if serviceType != "" {
-		query = query.Where("service_type = ?", serviceType)
+// ResetUserQuota 重置用户配额，未指定service_type时重置所有服务
+func (api *AdminAPI) ResetUserQuota(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
 	}
 
-	// 获取总体统计
-	var totalStats struct {
-		TotalCalls      int     `json:"total_calls"`
-		SuccessCalls    int     `json:"success_calls"`
-		FailedCalls     int     `json:"failed_calls"`
-		TotalCost       float64 `json:"total_cost"`
-		TotalTokens     int     `json:"total_tokens"`
-		AvgResponseTime float64 `json:"avg_response_time"`
+	serviceType := c.Query("service_type")
+	if err := api.service.ResetUsage(userID, serviceType); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	err := query.Select(`
-		COUNT(*) as total_calls,
-		SUM(CASE WHEN status = 'success' THEN 1 ELSE 0 END) as success_calls,
-		SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END) as failed_calls,
-		SUM(cost_usd) as total_cost,
-		SUM(total_tokens) as total_tokens,
-		AVG(processing_time_ms) as avg_response_time
-	`).Where("created_at >= DATE_SUB(NOW(), INTERVAL ? DAY)", days).Scan(&totalStats).Error
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "quota reset successfully",
+		"user_id":      userID,
+		"service_type": serviceType,
+	})
+}
 
-	if err != nil {
-		return nil, err
+// GetSystemStats 获取系统统计
+func (api *AdminAPI) GetSystemStats(c *gin.Context) {
+	db := api.service.db
+
+	// 获取总用户数
+	var totalUsers int64
+	db.Table("users").Count(&totalUsers)
+
+	// 获取配额统计
+	var quotaStats struct {
+		TotalQuotas      int64   `json:"total_quotas"`
+		TotalDailyUsed   int64   `json:"total_daily_used"`
+		TotalMonthlyUsed int64   `json:"total_monthly_used"`
+		TotalReserved    int64   `json:"total_reserved"`
+		TotalCostUsed    float64 `json:"total_cost_used"`
 	}
+	db.Model(&UserAIQuota{}).Count(&quotaStats.TotalQuotas)
+	db.Model(&UserAIQuota{}).Select("COALESCE(SUM(daily_used), 0)").Scan(&quotaStats.TotalDailyUsed)
+	db.Model(&UserAIQuota{}).Select("COALESCE(SUM(monthly_used), 0)").Scan(&quotaStats.TotalMonthlyUsed)
+	db.Model(&UserAIQuota{}).Select("COALESCE(SUM(reserved), 0)").Scan(&quotaStats.TotalReserved)
+	db.Model(&UserAIQuota{}).Select("COALESCE(SUM(daily_cost_used), 0)").Scan(&quotaStats.TotalCostUsed)
+
+	// 获取使用记录统计
+	var usageStats struct {
+		TotalRecords int64 `json:"total_records"`
+		SuccessCount int64 `json:"success_count"`
+		ErrorCount   int64 `json:"error_count"`
+	}
+	db.Model(&AIUsageRecord{}).Count(&usageStats.TotalRecords)
+	db.Model(&AIUsageRecord{}).Where("status = ?", UsageSuccess).Count(&usageStats.SuccessCount)
+	db.Model(&AIUsageRecord{}).Where("status = ?", UsageFailed).Count(&usageStats.ErrorCount)
 
-	stats.TotalCalls = totalStats.TotalCalls
-	stats.SuccessCalls = totalStats.SuccessCalls
-	stats.FailedCalls = totalStats.FailedCalls
-	stats.TotalCost = totalStats.TotalCost
-	stats.TotalTokens = totalStats.TotalTokens
-	stats.AvgResponseTime = totalStats.AvgResponseTime
-
-	return &stats, nil
+	c.JSON(http.StatusOK, gin.H{
+		"total_users": totalUsers,
+		"quota_stats": quotaStats,
+		"usage_stats": usageStats,
+	})
 }
 
-// RegisterAdminRoutes 注册管理员路由
-func (api *AdminAPI) RegisterAdminRoutes(r *gin.RouterGroup) {
+// RegisterAdminRoutes 注册管理员路由，sensitive为配额重置等敏感操作附加的中间件
+func (api *AdminAPI) RegisterAdminRoutes(r *gin.RouterGroup, sensitive ...gin.HandlerFunc) {
 	admin := r.Group("/admin/quota")
 	{
-		admin.PUT("/user/:user_id/subscription", api.UpdateUserSubscription)
-		admin.POST("/user/:user_id/reset", api.ResetUserQuota)
+		// 支持两种路径格式
+		admin.GET("/user/:user_id", api.GetUserQuotaDetails)
 		admin.GET("/user/:user_id/details", api.GetUserQuotaDetails)
-		admin.GET("/system/stats", api.GetSystemQuotaStats)
+		admin.PUT("/user/:user_id/subscription", api.UpdateUserSubscription)
+		admin.PUT("/user/:user_id/limits", api.UpdateUserLimits)
+		admin.POST("/user/:user_id/reset", append(sensitive[:len(sensitive):len(sensitive)], api.ResetUserQuota)...)
+		admin.GET("/company/:company_id/pool", api.GetCompanyPool)
+		admin.PUT("/company/:company_id/pool", api.UpdateCompanyPool)
+		admin.GET("/system/stats", api.GetSystemStats)
 	}
 }
@@ -1,6 +1,7 @@
 package aiquota
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -10,344 +11,153 @@ import (
 
 // QuotaAPI AI配额API
 type QuotaAPI struct {
-	db         *gorm.DB
-	middleware *QuotaMiddleware
+	service *Service
 }
 
 // NewQuotaAPI 创建配额API
-func NewQuotaAPI(db *gorm.DB) *QuotaAPI {
-	return &QuotaAPI{
-		db:         db,
-		middleware: NewQuotaMiddleware(db),
-	}
+func NewQuotaAPI(service *Service) *QuotaAPI {
+	return &QuotaAPI{service: service}
 }
 
-// GetUserQuota 获取用户配额信息
-// @Summary 获取用户配额信息
-// @Description 获取指定用户的AI服务配额信息
-// @Tags AI Quota
-// @Accept json
-// @Produce json
-// @Param user_id path int true "用户ID"
-// @Param service_type query string false "服务类型"
-// @Success 200 {object} QuotaCheckResult
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/quota/user/{user_id} [get]
+// GetUserQuota 获取用户配额
 func (api *QuotaAPI) GetUserQuota(c *gin.Context) {
-	userIDStr := c.Param("user_id")
-	userID, err := strconv.ParseUint(userIDStr, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid user ID",
-		})
+	userID, ok := userIDParam(c)
+	if !ok {
 		return
 	}
 
-	serviceType := c.Query("service_type")
-	if serviceType == "" {
-		serviceType = "document_parsing" // 默认服务类型
-	}
-
-	result, err := api.middleware.GetUserQuota(uint(userID), serviceType)
+	serviceType := c.DefaultQuery("service_type", "document_parsing")
+	result, err := api.service.Status(userID, serviceType, 0)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "failed to get quota",
-			"details": err.Error(),
-		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    result,
+		"user_id":      userID,
+		"service_type": serviceType,
+		"quota_info":   result,
 	})
 }
 
-// GetUserAllQuotas 获取用户所有服务配额信息
-// @Summary 获取用户所有服务配额信息
-// @Description 获取指定用户的所有AI服务配额信息
-// @Tags AI Quota
-// @Accept json
-// @Produce json
-// @Param user_id path int true "用户ID"
-// @Success 200 {object} map[string]QuotaCheckResult
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/quota/user/{user_id}/all [get]
+// GetUserAllQuotas 获取用户所有配额
 func (api *QuotaAPI) GetUserAllQuotas(c *gin.Context) {
-	userIDStr := c.Param("user_id")
-	userID, err := strconv.ParseUint(userIDStr, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid user ID",
-		})
+	userID, ok := userIDParam(c)
+	if !ok {
 		return
 	}
 
-	// 获取所有服务类型
-	serviceTypes := []string{"document_parsing", "text_analysis", "ai_chat"}
-	quotas := make(map[string]*QuotaCheckResult)
-
-	for _, serviceType := range serviceTypes {
-		result, err := api.middleware.GetUserQuota(uint(userID), serviceType)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "failed to get quota for service: " + serviceType,
-				"details": err.Error(),
-			})
-			return
-		}
-		quotas[serviceType] = result
+	quotas, err := api.service.ListUserQuotas(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    quotas,
+		"user_id": userID,
+		"quotas":  quotas,
 	})
 }
 
-// CheckQuota 检查用户配额
-// @Summary 检查用户配额
-// @Description 检查用户是否可以调用指定的AI服务
-// @Tags AI Quota
-// @Accept json
-// @Produce json
-// @Param request body QuotaCheckRequest true "配额检查请求"
-// @Success 200 {object} QuotaCheckResult
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/quota/check [post]
+// CheckQuota 检查配额，仅查询不预留
 func (api *QuotaAPI) CheckQuota(c *gin.Context) {
-	var request QuotaCheckRequest
+	var request struct {
+		UserID        uint    `json:"user_id" binding:"required"`
+		ServiceType   string  `json:"service_type" binding:"required"`
+		EstimatedCost float64 `json:"estimated_cost"`
+	}
+
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "invalid request",
-			"details": err.Error(),
-		})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	result, err := api.middleware.CheckQuota(request.UserID, request.ServiceType, request.EstimatedCost)
+	result, err := api.service.Status(request.UserID, request.ServiceType, request.EstimatedCost)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "failed to check quota",
-			"details": err.Error(),
-		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    result,
+		"quota_info": result,
 	})
 }
 
-// GetUsageStats 获取使用统计
-// @Summary 获取使用统计
-// @Description 获取用户的AI服务使用统计信息
-// @Tags AI Quota
-// @Accept json
-// @Produce json
-// @Param user_id path int true "用户ID"
-// @Param service_type query string false "服务类型"
-// @Param days query int false "统计天数，默认30天"
-// @Success 200 {object} UsageStats
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/quota/user/{user_id}/usage [get]
+// GetUsageStats 获取使用记录
 func (api *QuotaAPI) GetUsageStats(c *gin.Context) {
-	userIDStr := c.Param("user_id")
-	userID, err := strconv.ParseUint(userIDStr, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid user ID",
-		})
+	userID, ok := userIDParam(c)
+	if !ok {
 		return
 	}
 
 	serviceType := c.Query("service_type")
-	daysStr := c.DefaultQuery("days", "30")
-	days, err := strconv.Atoi(daysStr)
-	if err != nil {
-		days = 30
-	}
-
-	stats, err := api.getUsageStats(uint(userID), serviceType, days)
+	records, err := api.service.ListUsage(userID, serviceType, 100)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "failed to get usage stats",
-			"details": err.Error(),
-		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    stats,
+		"user_id":       userID,
+		"service_type":  serviceType,
+		"usage_records": records,
 	})
 }
 
-// ResetQuota 重置用户配额
-// @Summary 重置用户配额
-// @Description 重置指定用户的配额使用量
-// @Tags AI Quota
-// @Accept json
-// @Produce json
-// @Param user_id path int true "用户ID"
-// @Param service_type query string false "服务类型，不指定则重置所有服务"
-// @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/quota/user/{user_id}/reset [post]
+// ResetQuota 重置配额
 func (api *QuotaAPI) ResetQuota(c *gin.Context) {
-	userIDStr := c.Param("user_id")
-	userID, err := strconv.ParseUint(userIDStr, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid user ID",
-		})
+	userID, ok := userIDParam(c)
+	if !ok {
 		return
 	}
 
-	serviceType := c.Query("service_type")
-
-	err = api.resetUserQuota(uint(userID), serviceType)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "failed to reset quota",
-			"details": err.Error(),
-		})
+	serviceType := c.DefaultQuery("service_type", "document_parsing")
+	if err := api.service.ResetUsage(userID, serviceType); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "quota reset successfully",
+		"message":      "quota reset successfully",
+		"user_id":      userID,
+		"service_type": serviceType,
 	})
 }
 
-// QuotaCheckRequest 配额检查请求
-type QuotaCheckRequest struct {
-	UserID        uint    `json:"user_id" binding:"required"`
-	ServiceType   string  `json:"service_type" binding:"required"`
-	EstimatedCost float64 `json:"estimated_cost"`
-}
-
-// UsageStats 使用统计
-type UsageStats struct {
-	UserID          uint         `json:"user_id"`
-	ServiceType     string       `json:"service_type"`
-	TotalCalls      int          `json:"total_calls"`
-	SuccessCalls    int          `json:"success_calls"`
-	FailedCalls     int          `json:"failed_calls"`
-	TotalCost       float64      `json:"total_cost"`
-	TotalTokens     int          `json:"total_tokens"`
-	AvgResponseTime float64      `json:"avg_response_time"`
-	DailyStats      []DailyUsage `json:"daily_stats"`
-}
-
-// DailyUsage 每日使用统计
-type DailyUsage struct {
-	Date            string  `json:"date"`
-	Calls           int     `json:"calls"`
-	SuccessCalls    int     `json:"success_calls"`
-	FailedCalls     int     `json:"failed_calls"`
-	Cost            float64 `json:"cost"`
-	Tokens          int     `json:"tokens"`
-	AvgResponseTime float64 `json:"avg_response_time"`
-}
-
-// getUsageStats 获取使用统计
-func (api *QuotaAPI) getUsageStats(userID uint, serviceType string, days int) (*UsageStats, error) {
-	var stats UsageStats
-	stats.UserID = userID
-	stats.ServiceType = serviceType
-
-	// 构建查询条件
-	query := api.db.Model(&AIUsageRecord{}).Where("user_id = ?", userID)
-	if serviceType != "" {
-		query = query.Where("service_type = ?", serviceType)
-	}
-
-	// 获取总体统计
-	var totalStats struct {
-		TotalCalls      int     `json:"total_calls"`
-		SuccessCalls    int     `json:"success_calls"`
-		FailedCalls     int     `json:"failed_calls"`
-		TotalCost       float64 `json:"total_cost"`
-		TotalTokens     int     `json:"total_tokens"`
-		AvgResponseTime float64 `json:"avg_response_time"`
-	}
-
-	err := query.Select(`
-		COUNT(*) as total_calls,
-		SUM(CASE WHEN status = 'success' THEN 1 ELSE 0 END) as success_calls,
-		SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END) as failed_calls,
-		SUM(cost_usd) as total_cost,
-		SUM(total_tokens) as total_tokens,
-		AVG(processing_time_ms) as avg_response_time
-	`).Where("created_at >= DATE_SUB(NOW(), INTERVAL ? DAY)", days).Scan(&totalStats).Error
-
-	if err != nil {
-		return nil, err
-	}
-
-	stats.TotalCalls = totalStats.TotalCalls
-	stats.SuccessCalls = totalStats.SuccessCalls
-	stats.FailedCalls = totalStats.FailedCalls
-	stats.TotalCost = totalStats.TotalCost
-	stats.TotalTokens = totalStats.TotalTokens
-	stats.AvgResponseTime = totalStats.AvgResponseTime
-
-	// 获取每日统计
-	var dailyStats []DailyUsage
-	err = query.Select(`
-		DATE(created_at) as date,
-		COUNT(*) as calls,
-		SUM(CASE WHEN status = 'success' THEN 1 ELSE 0 END) as success_calls,
-		SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END) as failed_calls,
-		SUM(cost_usd) as cost,
-		SUM(total_tokens) as tokens,
-		AVG(processing_time_ms) as avg_response_time
-	`).Where("created_at >= DATE_SUB(NOW(), INTERVAL ? DAY)", days).
-		Group("DATE(created_at)").
-		Order("date DESC").
-		Scan(&dailyStats).Error
-
-	if err != nil {
-		return nil, err
-	}
-
-	stats.DailyStats = dailyStats
-
-	return &stats, nil
-}
-
-// resetUserQuota 重置用户配额
-func (api *QuotaAPI) resetUserQuota(userID uint, serviceType string) error {
-	query := api.db.Model(&UserAIQuota{}).Where("user_id = ?", userID)
-	if serviceType != "" {
-		query = query.Where("service_type = ?", serviceType)
-	}
-
-	return query.Updates(map[string]interface{}{
-		"daily_used":        0,
-		"monthly_used":      0,
-		"daily_cost_used":   0,
-		"monthly_cost_used": 0,
-		"quota_reset_date":  "NOW()",
-	}).Error
-}
-
-// RegisterRoutes 注册路由
-func (api *QuotaAPI) RegisterRoutes(r *gin.RouterGroup) {
+// RegisterRoutes 注册路由，sensitive为配额重置等敏感操作附加的中间件（如登录和MFA二次验证）
+func (api *QuotaAPI) RegisterRoutes(r *gin.RouterGroup, sensitive ...gin.HandlerFunc) {
 	quota := r.Group("/quota")
 	{
 		quota.GET("/user/:user_id", api.GetUserQuota)
 		quota.GET("/user/:user_id/all", api.GetUserAllQuotas)
 		quota.POST("/check", api.CheckQuota)
 		quota.GET("/user/:user_id/usage", api.GetUsageStats)
-		quota.POST("/user/:user_id/reset", api.ResetQuota)
+		quota.POST("/user/:user_id/reset", append(sensitive[:len(sensitive):len(sensitive)], api.ResetQuota)...)
+	}
+}
+
+// userIDParam 解析路径中的user_id，无效时写入400响应
+func userIDParam(c *gin.Context) (uint, bool) {
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil || userID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return 0, false
 	}
+	return uint(userID), true
+}
+
+// respondQuotaError 按错误类型返回状态码
+func respondQuotaError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrInvalidQuota):
+		status = http.StatusBadRequest
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, ErrReservationNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrQuotaExceeded):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, ErrReservationClosed):
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
 }
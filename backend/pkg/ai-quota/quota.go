@@ -0,0 +1,228 @@
+package aiquota
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// 使用记录状态
+const (
+	UsageSuccess = "success"
+	UsageFailed  = "failed"
+)
+
+// 预留状态
+const (
+	ReservationReserved  = "reserved"
+	ReservationCommitted = "committed"
+	ReservationReleased  = "released"
+	ReservationExpired   = "expired" // 请求未提交也未释放，超时后由清理任务收回
+)
+
+// 配额不足的原因，企业配额池不足时带company_前缀
+const (
+	ReasonDailyLimit       = "daily_limit_exceeded"
+	ReasonMonthlyLimit     = "monthly_limit_exceeded"
+	ReasonDailyCostLimit   = "daily_cost_limit_exceeded"
+	ReasonMonthlyCostLimit = "monthly_cost_limit_exceeded"
+	ReasonInactive         = "quota_inactive"
+	reasonCompanyPrefix    = "company_"
+)
+
+var (
+	ErrQuotaExceeded       = errors.New("quota exceeded")
+	ErrReservationNotFound = errors.New("quota reservation not found")
+	ErrReservationClosed   = errors.New("quota reservation already committed or released")
+	ErrInvalidQuota        = errors.New("invalid quota request")
+)
+
+// QuotaExceededError 配额不足，Result为拒绝时的配额状态
+type QuotaExceededError struct {
+	Result *QuotaCheckResult
+}
+
+func (e *QuotaExceededError) Error() string {
+	return "quota exceeded: " + e.Result.Reason
+}
+
+func (e *QuotaExceededError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// QuotaCheckResult 配额检查结果
+type QuotaCheckResult struct {
+	Allowed      bool              `json:"allowed"`
+	Reason       string            `json:"reason,omitempty"`
+	DailyUsed    int               `json:"daily_used"`
+	DailyLimit   int               `json:"daily_limit"`
+	DailyBurst   int               `json:"daily_burst"`
+	MonthlyUsed  int               `json:"monthly_used"`
+	MonthlyLimit int               `json:"monthly_limit"`
+	Reserved     int               `json:"reserved"` // 进行中的请求预留的次数
+	CostUsed     float64           `json:"cost_used"`
+	CostLimit    float64           `json:"cost_limit"`
+	ResetTime    string            `json:"reset_time,omitempty"`
+	CompanyID    *uint             `json:"company_id,omitempty"`
+	CompanyPool  *QuotaCheckResult `json:"company_pool,omitempty"`
+}
+
+// Limits 配额限制。DailyBurst为每日允许临时超出DailyLimit的请求数，每月限制和费用限制不可超出
+type Limits struct {
+	DailyLimit       int     `json:"daily_limit"`
+	MonthlyLimit     int     `json:"monthly_limit"`
+	DailyCostLimit   float64 `json:"daily_cost_limit"`
+	MonthlyCostLimit float64 `json:"monthly_cost_limit"`
+	DailyBurst       int     `json:"daily_burst"`
+}
+
+// Config 配额服务配置
+type Config struct {
+	ReservationTTL time.Duration     // 预留超过此时间未提交或释放即被收回
+	Location       *time.Location    // 日、月配额按该时区的自然日和自然月重置
+	DefaultLimits  map[string]Limits // 按订阅类型的默认限制，subscription_limits表没有配置时使用
+}
+
+// DefaultConfig 默认配置，预留有效期可通过AI_QUOTA_RESERVATION_TTL配置
+func DefaultConfig() Config {
+	trial := Limits{DailyLimit: 5, MonthlyLimit: 100, DailyCostLimit: 10, MonthlyCostLimit: 50}
+	config := Config{
+		ReservationTTL: 10 * time.Minute,
+		Location:       time.FixedZone("CST", 8*3600),
+		DefaultLimits: map[string]Limits{
+			"trial":      trial,
+			"free":       trial,
+			"basic":      trial,
+			"premium":    {DailyLimit: 50, MonthlyLimit: 1000, DailyCostLimit: 50, MonthlyCostLimit: 500, DailyBurst: 10},
+			"enterprise": {DailyLimit: 200, MonthlyLimit: 5000, DailyCostLimit: 200, MonthlyCostLimit: 2000, DailyBurst: 40},
+		},
+	}
+	if d, err := time.ParseDuration(os.Getenv("AI_QUOTA_RESERVATION_TTL")); err == nil && d > 0 {
+		config.ReservationTTL = d
+	}
+	if location, err := time.LoadLocation("Asia/Shanghai"); err == nil {
+		config.Location = location
+	}
+	return config
+}
+
+// QuotaCounters 配额限制和用量，用户配额与企业配额池共用
+type QuotaCounters struct {
+	DailyLimit       int        `json:"daily_limit" gorm:"default:0"`
+	MonthlyLimit     int        `json:"monthly_limit" gorm:"default:0"`
+	DailyBurst       int        `json:"daily_burst" gorm:"default:0"`
+	DailyCostLimit   float64    `json:"daily_cost_limit" gorm:"type:decimal(10,6);default:0.000000"`
+	MonthlyCostLimit float64    `json:"monthly_cost_limit" gorm:"type:decimal(10,6);default:0.000000"`
+	DailyUsed        int        `json:"daily_used" gorm:"default:0"`
+	MonthlyUsed      int        `json:"monthly_used" gorm:"default:0"`
+	DailyCostUsed    float64    `json:"daily_cost_used" gorm:"type:decimal(10,6);default:0.000000"`
+	MonthlyCostUsed  float64    `json:"monthly_cost_used" gorm:"type:decimal(10,6);default:0.000000"`
+	Reserved         int        `json:"reserved" gorm:"default:0"` // 已预留尚未提交或释放的请求数
+	CostReserved     float64    `json:"cost_reserved" gorm:"type:decimal(10,6);default:0.000000"`
+	DailyPeriod      string     `json:"daily_period" gorm:"size:10"` // 日用量所属日期，日期变化时清零
+	MonthlyPeriod    string     `json:"monthly_period" gorm:"size:7"`
+	QuotaResetDate   *time.Time `json:"quota_reset_date"`
+}
+
+// setLimits 设置限制，不改变用量
+func (q *QuotaCounters) setLimits(limits Limits) {
+	q.DailyLimit = limits.DailyLimit
+	q.MonthlyLimit = limits.MonthlyLimit
+	q.DailyCostLimit = limits.DailyCostLimit
+	q.MonthlyCostLimit = limits.MonthlyCostLimit
+	q.DailyBurst = limits.DailyBurst
+}
+
+// exceededReason 再预留一次（预估费用cost）会超出的限制，为空表示可以预留
+func (q QuotaCounters) exceededReason(cost float64) string {
+	switch {
+	case q.DailyUsed+q.Reserved+1 > q.DailyLimit+q.DailyBurst:
+		return ReasonDailyLimit
+	case q.MonthlyUsed+q.Reserved+1 > q.MonthlyLimit:
+		return ReasonMonthlyLimit
+	case q.DailyCostUsed+q.CostReserved+cost > q.DailyCostLimit:
+		return ReasonDailyCostLimit
+	case q.MonthlyCostUsed+q.CostReserved+cost > q.MonthlyCostLimit:
+		return ReasonMonthlyCostLimit
+	}
+	return ""
+}
+
+// AIUsageRecord AI服务使用记录
+type AIUsageRecord struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	UserID         uint      `json:"user_id" gorm:"not null;index"`
+	CompanyID      *uint     `json:"company_id,omitempty" gorm:"index"`
+	ServiceType    string    `json:"service_type" gorm:"size:50;not null"`
+	ServiceName    string    `json:"service_name" gorm:"size:100;not null"`
+	RequestID      string    `json:"request_id" gorm:"size:100"`
+	ReservationID  string    `json:"reservation_id" gorm:"size:36"`
+	InputTokens    int       `json:"input_tokens" gorm:"default:0"`
+	OutputTokens   int       `json:"output_tokens" gorm:"default:0"`
+	TotalTokens    int       `json:"total_tokens" gorm:"default:0"`
+	CostUSD        float64   `json:"cost_usd" gorm:"type:decimal(10,6);default:0.000000"`
+	ProcessingTime int       `json:"processing_time_ms" gorm:"column:processing_time_ms;default:0"`
+	Status         string    `json:"status" gorm:"size:20;default:'success'"`
+	ErrorMessage   string    `json:"error_message"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (AIUsageRecord) TableName() string {
+	return "ai_service_usage"
+}
+
+// UserAIQuota 用户AI服务配额。CompanyID不为空时同时占用该企业的配额池，即企业配额池下的子配额
+type UserAIQuota struct {
+	ID               uint   `json:"id" gorm:"primaryKey"`
+	UserID           uint   `json:"user_id" gorm:"not null;uniqueIndex:idx_user_ai_quota"`
+	ServiceType      string `json:"service_type" gorm:"size:50;not null;uniqueIndex:idx_user_ai_quota"`
+	SubscriptionType string `json:"subscription_type" gorm:"size:20;default:'trial'"`
+	CompanyID        *uint  `json:"company_id,omitempty" gorm:"index"`
+	QuotaCounters
+	IsActive  bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (UserAIQuota) TableName() string {
+	return "user_ai_quotas"
+}
+
+// CompanyAIQuotaPool 企业AI服务配额池，企业下所有用户的子配额共同占用
+type CompanyAIQuotaPool struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	CompanyID   uint   `json:"company_id" gorm:"not null;uniqueIndex:idx_company_ai_quota"`
+	ServiceType string `json:"service_type" gorm:"size:50;not null;uniqueIndex:idx_company_ai_quota"`
+	QuotaCounters
+	IsActive  bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (CompanyAIQuotaPool) TableName() string {
+	return "company_ai_quota_pools"
+}
+
+// Reservation 一次请求预留的配额，请求成功后提交为用量，失败后释放
+type Reservation struct {
+	ID            string    `json:"id" gorm:"primaryKey;size:36"`
+	UserID        uint      `json:"user_id" gorm:"not null;index"`
+	QuotaID       uint      `json:"quota_id" gorm:"not null"`
+	PoolID        *uint     `json:"pool_id,omitempty"`
+	CompanyID     *uint     `json:"company_id,omitempty"`
+	ServiceType   string    `json:"service_type" gorm:"size:50;not null"`
+	EstimatedCost float64   `json:"estimated_cost" gorm:"type:decimal(10,6);default:0.000000"`
+	Status        string    `json:"status" gorm:"size:20;not null;index"`
+	ExpiresAt     time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Reservation) TableName() string {
+	return "ai_quota_reservations"
+}
@@ -0,0 +1,583 @@
+package aiquota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	userQuotaTable = "user_ai_quotas"
+	poolTable      = "company_ai_quota_pools"
+)
+
+// Service AI服务配额。请求先原子地预留配额，成功后提交为用量，失败后释放，
+// 预留计入已用量的判断，因此并发请求不会超出每日、每月和费用限制。
+// 预留和提交在同一事务内依次更新用户配额和企业配额池，条件更新持有行锁直到事务结束
+type Service struct {
+	db     *gorm.DB
+	config Config
+}
+
+// timeNow 取当前时间，测试中替换为固定时钟
+var timeNow = time.Now
+
+// NewService 创建配额服务
+func NewService(db *gorm.DB, config Config) *Service {
+	if config.Location == nil {
+		config.Location = time.UTC
+	}
+	if config.ReservationTTL <= 0 {
+		config.ReservationTTL = 10 * time.Minute
+	}
+	return &Service{db: db, config: config}
+}
+
+// AutoMigrate 创建配额相关的表
+func (s *Service) AutoMigrate() error {
+	return s.db.AutoMigrate(&AIUsageRecord{}, &UserAIQuota{}, &CompanyAIQuotaPool{}, &Reservation{})
+}
+
+// StartSweeper 定期收回超时未提交的预留
+func (s *Service) StartSweeper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if expired, err := s.SweepExpired(); err != nil {
+					log.Printf("收回超时的配额预留失败: %v", err)
+				} else if expired > 0 {
+					log.Printf("收回%d个超时的配额预留", expired)
+				}
+			}
+		}
+	}()
+}
+
+// Reserve 为一次请求预留配额，estimatedCost为预估费用。配额不足时返回*QuotaExceededError
+func (s *Service) Reserve(userID uint, serviceType string, estimatedCost float64) (*Reservation, *QuotaCheckResult, error) {
+	if userID == 0 || serviceType == "" || estimatedCost < 0 {
+		return nil, nil, fmt.Errorf("%w: 缺少用户或服务类型，或预估费用为负", ErrInvalidQuota)
+	}
+	quota, err := s.getOrCreateQuota(userID, serviceType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := timeNow()
+	reservation := &Reservation{
+		ID:            uuid.NewString(),
+		UserID:        userID,
+		QuotaID:       quota.ID,
+		ServiceType:   serviceType,
+		EstimatedCost: estimatedCost,
+		Status:        ReservationReserved,
+		ExpiresAt:     now.Add(s.config.ReservationTTL),
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.rollPeriods(tx, userQuotaTable, quota.ID, now); err != nil {
+			return err
+		}
+		if ok, err := s.take(tx, userQuotaTable, quota.ID, estimatedCost); err != nil || !ok {
+			if err != nil {
+				return err
+			}
+			return s.exceeded(tx, userID, serviceType, estimatedCost, now)
+		}
+
+		if quota.CompanyID != nil {
+			var pool CompanyAIQuotaPool
+			err := tx.Where("company_id = ? AND service_type = ?", *quota.CompanyID, serviceType).First(&pool).Error
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				// 企业尚未设置配额池，只受个人配额限制
+			case err != nil:
+				return err
+			default:
+				if err := s.rollPeriods(tx, poolTable, pool.ID, now); err != nil {
+					return err
+				}
+				ok, err := s.take(tx, poolTable, pool.ID, estimatedCost)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return s.exceeded(tx, userID, serviceType, estimatedCost, now)
+				}
+				reservation.PoolID = &pool.ID
+				reservation.CompanyID = quota.CompanyID
+			}
+		}
+		return tx.Create(reservation).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result, err := s.Status(userID, serviceType, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	result.Allowed = true
+	result.Reason = ""
+	return reservation, result, nil
+}
+
+// take 条件更新占用一次预留，返回false表示限制不足。条件在数据库中判断，并发时以行锁串行
+func (s *Service) take(tx *gorm.DB, table string, id uint, cost float64) (bool, error) {
+	result := tx.Table(table).
+		Where("id = ? AND is_active = ?", id, true).
+		Where("daily_used + reserved + 1 <= daily_limit + daily_burst").
+		Where("monthly_used + reserved + 1 <= monthly_limit").
+		Where("daily_cost_used + cost_reserved + ? <= daily_cost_limit", cost).
+		Where("monthly_cost_used + cost_reserved + ? <= monthly_cost_limit", cost).
+		Updates(map[string]interface{}{
+			"reserved":      gorm.Expr("reserved + 1"),
+			"cost_reserved": gorm.Expr("cost_reserved + ?", cost),
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// exceeded 在事务内读取当前配额，生成拒绝原因
+func (s *Service) exceeded(tx *gorm.DB, userID uint, serviceType string, cost float64, now time.Time) error {
+	result, err := s.status(tx, userID, serviceType, cost, now)
+	if err != nil {
+		return err
+	}
+	if result.Allowed {
+		// 条件更新失败但读到的配额足够，说明配额刚被停用或并发修改了限制
+		result.Allowed = false
+		result.Reason = ReasonInactive
+	}
+	return &QuotaExceededError{Result: result}
+}
+
+// rollPeriods 日期或月份变化时清零对应的用量，预留不清零
+func (s *Service) rollPeriods(tx *gorm.DB, table string, id uint, now time.Time) error {
+	local := now.In(s.config.Location)
+	day, month := local.Format("2006-01-02"), local.Format("2006-01")
+	if err := tx.Table(table).Where("id = ? AND (daily_period IS NULL OR daily_period <> ?)", id, day).
+		Updates(map[string]interface{}{"daily_used": 0, "daily_cost_used": 0, "daily_period": day, "quota_reset_date": now}).Error; err != nil {
+		return err
+	}
+	return tx.Table(table).Where("id = ? AND (monthly_period IS NULL OR monthly_period <> ?)", id, month).
+		Updates(map[string]interface{}{"monthly_used": 0, "monthly_cost_used": 0, "monthly_period": month}).Error
+}
+
+// Usage 请求完成后的实际用量
+type Usage struct {
+	ServiceName    string
+	RequestID      string
+	InputTokens    int
+	OutputTokens   int
+	CostUSD        float64 // 实际费用，提交时替换预估费用
+	ProcessingTime int     // 毫秒
+}
+
+// Commit 请求成功，预留转为用量并记录使用情况
+func (s *Service) Commit(reservationID string, usage Usage) error {
+	if usage.CostUSD < 0 {
+		return fmt.Errorf("%w: 实际费用不能为负", ErrInvalidQuota)
+	}
+	return s.closeReservation(reservationID, ReservationCommitted, func(tx *gorm.DB, r *Reservation) error {
+		now := timeNow()
+		apply := func(table string, id uint) error {
+			if err := s.rollPeriods(tx, table, id, now); err != nil {
+				return err
+			}
+			return tx.Table(table).Where("id = ?", id).Updates(map[string]interface{}{
+				"reserved":          gorm.Expr("reserved - 1"),
+				"cost_reserved":     gorm.Expr("cost_reserved - ?", r.EstimatedCost),
+				"daily_used":        gorm.Expr("daily_used + 1"),
+				"monthly_used":      gorm.Expr("monthly_used + 1"),
+				"daily_cost_used":   gorm.Expr("daily_cost_used + ?", usage.CostUSD),
+				"monthly_cost_used": gorm.Expr("monthly_cost_used + ?", usage.CostUSD),
+			}).Error
+		}
+		if err := apply(userQuotaTable, r.QuotaID); err != nil {
+			return err
+		}
+		if r.PoolID != nil {
+			if err := apply(poolTable, *r.PoolID); err != nil {
+				return err
+			}
+		}
+		return tx.Create(usageRecord(r, usage, UsageSuccess, "")).Error
+	})
+}
+
+// Release 请求失败，释放预留，记录失败的使用情况但不计入用量
+func (s *Service) Release(reservationID string, usage Usage, errorMessage string) error {
+	return s.closeReservation(reservationID, ReservationReleased, func(tx *gorm.DB, r *Reservation) error {
+		if err := s.unreserve(tx, r); err != nil {
+			return err
+		}
+		return tx.Create(usageRecord(r, usage, UsageFailed, errorMessage)).Error
+	})
+}
+
+// SweepExpired 收回超时未提交的预留
+func (s *Service) SweepExpired() (int, error) {
+	var ids []string
+	if err := s.db.Model(&Reservation{}).Where("status = ? AND expires_at < ?", ReservationReserved, timeNow()).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, id := range ids {
+		err := s.closeReservation(id, ReservationExpired, s.unreserve)
+		switch {
+		case err == nil:
+			expired++
+		case errors.Is(err, ErrReservationClosed):
+			// 清理期间请求已提交或释放
+		default:
+			return expired, err
+		}
+	}
+	return expired, nil
+}
+
+func (s *Service) unreserve(tx *gorm.DB, r *Reservation) error {
+	update := map[string]interface{}{
+		"reserved":      gorm.Expr("reserved - 1"),
+		"cost_reserved": gorm.Expr("cost_reserved - ?", r.EstimatedCost),
+	}
+	if err := tx.Table(userQuotaTable).Where("id = ?", r.QuotaID).Updates(update).Error; err != nil {
+		return err
+	}
+	if r.PoolID != nil {
+		return tx.Table(poolTable).Where("id = ?", *r.PoolID).Updates(update).Error
+	}
+	return nil
+}
+
+// closeReservation 将预留从reserved改为终态并执行对应的配额更新，每个预留只能结束一次
+func (s *Service) closeReservation(id, status string, apply func(tx *gorm.DB, r *Reservation) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Reservation{}).Where("id = ? AND status = ?", id, ReservationReserved).Update("status", status)
+		if result.Error != nil {
+			return result.Error
+		}
+		var r Reservation
+		if err := tx.First(&r, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: %s", ErrReservationNotFound, id)
+			}
+			return err
+		}
+		if result.RowsAffected != 1 {
+			return fmt.Errorf("%w: %s为%s", ErrReservationClosed, id, r.Status)
+		}
+		return apply(tx, &r)
+	})
+}
+
+func usageRecord(r *Reservation, usage Usage, status, errorMessage string) *AIUsageRecord {
+	serviceName := usage.ServiceName
+	if serviceName == "" {
+		serviceName = r.ServiceType
+	}
+	return &AIUsageRecord{
+		UserID:         r.UserID,
+		CompanyID:      r.CompanyID,
+		ServiceType:    r.ServiceType,
+		ServiceName:    serviceName,
+		RequestID:      usage.RequestID,
+		ReservationID:  r.ID,
+		InputTokens:    usage.InputTokens,
+		OutputTokens:   usage.OutputTokens,
+		TotalTokens:    usage.InputTokens + usage.OutputTokens,
+		CostUSD:        usage.CostUSD,
+		ProcessingTime: usage.ProcessingTime,
+		Status:         status,
+		ErrorMessage:   errorMessage,
+	}
+}
+
+// Status 当前配额状态，Allowed表示能否再预留一次预估费用为estimatedCost的请求。
+// 仅供查询，实际放行以Reserve为准
+func (s *Service) Status(userID uint, serviceType string, estimatedCost float64) (*QuotaCheckResult, error) {
+	quota, err := s.getOrCreateQuota(userID, serviceType)
+	if err != nil {
+		return nil, err
+	}
+	var result *QuotaCheckResult
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		now := timeNow()
+		if err := s.rollPeriods(tx, userQuotaTable, quota.ID, now); err != nil {
+			return err
+		}
+		result, err = s.status(tx, userID, serviceType, estimatedCost, now)
+		return err
+	})
+	return result, err
+}
+
+// status 读取用户配额和所属企业配额池，生成检查结果
+func (s *Service) status(tx *gorm.DB, userID uint, serviceType string, cost float64, now time.Time) (*QuotaCheckResult, error) {
+	var quota UserAIQuota
+	if err := tx.Where("user_id = ? AND service_type = ?", userID, serviceType).First(&quota).Error; err != nil {
+		return nil, err
+	}
+	result := s.checkResult(quota.QuotaCounters, quota.IsActive, cost, now)
+	result.CompanyID = quota.CompanyID
+	if quota.CompanyID == nil {
+		return result, nil
+	}
+
+	var pool CompanyAIQuotaPool
+	err := tx.Where("company_id = ? AND service_type = ?", *quota.CompanyID, serviceType).First(&pool).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.rollPeriods(tx, poolTable, pool.ID, now); err != nil {
+		return nil, err
+	}
+	if err := tx.First(&pool, pool.ID).Error; err != nil {
+		return nil, err
+	}
+	result.CompanyPool = s.checkResult(pool.QuotaCounters, pool.IsActive, cost, now)
+	if result.Allowed && !result.CompanyPool.Allowed {
+		result.Allowed = false
+		result.Reason = reasonCompanyPrefix + result.CompanyPool.Reason
+	}
+	return result, nil
+}
+
+func (s *Service) checkResult(q QuotaCounters, active bool, cost float64, now time.Time) *QuotaCheckResult {
+	local := now.In(s.config.Location)
+	tomorrow := time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, s.config.Location)
+	result := &QuotaCheckResult{
+		DailyUsed:    q.DailyUsed,
+		DailyLimit:   q.DailyLimit,
+		DailyBurst:   q.DailyBurst,
+		MonthlyUsed:  q.MonthlyUsed,
+		MonthlyLimit: q.MonthlyLimit,
+		Reserved:     q.Reserved,
+		CostUsed:     q.DailyCostUsed,
+		CostLimit:    q.DailyCostLimit,
+		ResetTime:    tomorrow.Format("2006-01-02 15:04:05"),
+	}
+	result.Reason = q.exceededReason(cost)
+	if !active {
+		result.Reason = ReasonInactive
+	}
+	result.Allowed = result.Reason == ""
+	return result
+}
+
+// getOrCreateQuota 获取用户配额，没有时按订阅类型创建默认配额
+func (s *Service) getOrCreateQuota(userID uint, serviceType string) (*UserAIQuota, error) {
+	var quota UserAIQuota
+	err := s.db.Where("user_id = ? AND service_type = ?", userID, serviceType).First(&quota).Error
+	if err == nil {
+		return &quota, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to get quota: %v", err)
+	}
+
+	subscriptionType := s.subscriptionType(userID)
+	quota = UserAIQuota{UserID: userID, ServiceType: serviceType, SubscriptionType: subscriptionType, IsActive: true}
+	quota.setLimits(s.limitsFor(subscriptionType, serviceType))
+	if err := s.db.Create(&quota).Error; err != nil {
+		// 并发创建时唯一索引冲突，读取先创建的记录
+		if findErr := s.db.Where("user_id = ? AND service_type = ?", userID, serviceType).First(&quota).Error; findErr == nil {
+			return &quota, nil
+		}
+		return nil, fmt.Errorf("failed to create default quota: %v", err)
+	}
+	return &quota, nil
+}
+
+// subscriptionType 用户的订阅类型，用户表不可用时按试用处理
+func (s *Service) subscriptionType(userID uint) string {
+	var subscriptionType string
+	if err := s.db.Raw("SELECT COALESCE(subscription_status, 'trial') FROM users WHERE id = ?", userID).
+		Scan(&subscriptionType).Error; err != nil || subscriptionType == "" {
+		return "trial"
+	}
+	return subscriptionType
+}
+
+// limitsFor 订阅类型的默认限制，优先使用subscription_limits表的配置
+func (s *Service) limitsFor(subscriptionType, serviceType string) Limits {
+	var limits Limits
+	err := s.db.Raw(`
+		SELECT daily_limit, monthly_limit, daily_cost_limit, monthly_cost_limit
+		FROM subscription_limits
+		WHERE subscription_type = ? AND service_type = ? AND is_active = ?
+	`, subscriptionType, serviceType, true).Scan(&limits).Error
+	if err == nil && limits.DailyLimit > 0 {
+		limits.DailyBurst = s.defaultLimits(subscriptionType).DailyBurst
+		return limits
+	}
+	return s.defaultLimits(subscriptionType)
+}
+
+func (s *Service) defaultLimits(subscriptionType string) Limits {
+	if limits, ok := s.config.DefaultLimits[subscriptionType]; ok {
+		return limits
+	}
+	return s.config.DefaultLimits["trial"]
+}
+
+// ListUserQuotas 用户的所有服务配额
+func (s *Service) ListUserQuotas(userID uint) ([]UserAIQuota, error) {
+	var quotas []UserAIQuota
+	err := s.db.Where("user_id = ?", userID).Order("service_type").Find(&quotas).Error
+	return quotas, err
+}
+
+// ListUsage 用户最近的使用记录，serviceType为空时不限服务
+func (s *Service) ListUsage(userID uint, serviceType string, limit int) ([]AIUsageRecord, error) {
+	var records []AIUsageRecord
+	query := s.db.Where("user_id = ?", userID)
+	if serviceType != "" {
+		query = query.Where("service_type = ?", serviceType)
+	}
+	err := query.Order("created_at DESC").Limit(limit).Find(&records).Error
+	return records, err
+}
+
+// SetUserLimits 设置用户某项服务的配额限制
+func (s *Service) SetUserLimits(userID uint, serviceType string, limits Limits) (*UserAIQuota, error) {
+	if err := validateLimits(limits); err != nil {
+		return nil, err
+	}
+	quota, err := s.getOrCreateQuota(userID, serviceType)
+	if err != nil {
+		return nil, err
+	}
+	quota.setLimits(limits)
+	if err := s.db.Model(quota).Updates(limitColumns(limits)).Error; err != nil {
+		return nil, err
+	}
+	return quota, nil
+}
+
+// SetUserCompany 将用户配额挂到企业配额池下，companyID为nil时解除
+func (s *Service) SetUserCompany(userID uint, serviceType string, companyID *uint) (*UserAIQuota, error) {
+	quota, err := s.getOrCreateQuota(userID, serviceType)
+	if err != nil {
+		return nil, err
+	}
+	var reserved int64
+	if err := s.db.Model(&Reservation{}).Where("quota_id = ? AND status = ?", quota.ID, ReservationReserved).
+		Count(&reserved).Error; err != nil {
+		return nil, err
+	}
+	if reserved > 0 {
+		// 进行中的预留按原企业归还，等请求结束后再调整归属
+		return nil, fmt.Errorf("%w: 用户有%d个进行中的请求", ErrInvalidQuota, reserved)
+	}
+	quota.CompanyID = companyID
+	if err := s.db.Model(quota).Select("company_id").Updates(quota).Error; err != nil {
+		return nil, err
+	}
+	return quota, nil
+}
+
+// ApplySubscription 订阅变更后按新订阅类型更新用户所有服务的配额限制，返回更新的服务类型
+func (s *Service) ApplySubscription(userID uint, subscriptionType string) ([]string, error) {
+	quotas, err := s.ListUserQuotas(userID)
+	if err != nil {
+		return nil, err
+	}
+	var updated []string
+	for _, quota := range quotas {
+		columns := limitColumns(s.limitsFor(subscriptionType, quota.ServiceType))
+		columns["subscription_type"] = subscriptionType
+		if err := s.db.Model(&UserAIQuota{}).Where("id = ?", quota.ID).Updates(columns).Error; err != nil {
+			return updated, err
+		}
+		updated = append(updated, quota.ServiceType)
+	}
+	return updated, nil
+}
+
+// SetCompanyPool 设置企业配额池的限制，不存在时创建
+func (s *Service) SetCompanyPool(companyID uint, serviceType string, limits Limits) (*CompanyAIQuotaPool, error) {
+	if companyID == 0 || serviceType == "" {
+		return nil, fmt.Errorf("%w: 缺少企业或服务类型", ErrInvalidQuota)
+	}
+	if err := validateLimits(limits); err != nil {
+		return nil, err
+	}
+	var pool CompanyAIQuotaPool
+	err := s.db.Where("company_id = ? AND service_type = ?", companyID, serviceType).First(&pool).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		pool = CompanyAIQuotaPool{CompanyID: companyID, ServiceType: serviceType, IsActive: true}
+		pool.setLimits(limits)
+		if err := s.db.Create(&pool).Error; err == nil {
+			return &pool, nil
+		}
+		// 并发创建，改为更新已存在的记录
+		if err := s.db.Where("company_id = ? AND service_type = ?", companyID, serviceType).First(&pool).Error; err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	pool.setLimits(limits)
+	if err := s.db.Model(&pool).Updates(limitColumns(limits)).Error; err != nil {
+		return nil, err
+	}
+	return &pool, nil
+}
+
+// GetCompanyPool 企业某项服务的配额池
+func (s *Service) GetCompanyPool(companyID uint, serviceType string) (*CompanyAIQuotaPool, error) {
+	var pool CompanyAIQuotaPool
+	err := s.db.Where("company_id = ? AND service_type = ?", companyID, serviceType).First(&pool).Error
+	if err != nil {
+		return nil, err
+	}
+	return &pool, nil
+}
+
+// ResetUsage 清零用户的用量，serviceType为空时清零所有服务；进行中的预留不受影响
+func (s *Service) ResetUsage(userID uint, serviceType string) error {
+	query := s.db.Model(&UserAIQuota{}).Where("user_id = ?", userID)
+	if serviceType != "" {
+		query = query.Where("service_type = ?", serviceType)
+	}
+	return query.Updates(map[string]interface{}{
+		"daily_used":        0,
+		"monthly_used":      0,
+		"daily_cost_used":   0,
+		"monthly_cost_used": 0,
+		"quota_reset_date":  timeNow(),
+	}).Error
+}
+
+func validateLimits(limits Limits) error {
+	if limits.DailyLimit < 0 || limits.MonthlyLimit < 0 || limits.DailyBurst < 0 ||
+		limits.DailyCostLimit < 0 || limits.MonthlyCostLimit < 0 {
+		return fmt.Errorf("%w: 限制不能为负", ErrInvalidQuota)
+	}
+	return nil
+}
+
+func limitColumns(limits Limits) map[string]interface{} {
+	return map[string]interface{}{
+		"daily_limit":        limits.DailyLimit,
+		"monthly_limit":      limits.MonthlyLimit,
+		"daily_cost_limit":   limits.DailyCostLimit,
+		"monthly_cost_limit": limits.MonthlyCostLimit,
+		"daily_burst":        limits.DailyBurst,
+	}
+}
@@ -0,0 +1,298 @@
+package aiquota
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestService 使用文件数据库和多个连接，使并发请求真正并行地访问数据库
+func newTestService(t *testing.T) (*Service, *time.Time) {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "quota.db") + "?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(8)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	service := NewService(db, Config{ReservationTTL: time.Minute, Location: time.UTC, DefaultLimits: DefaultConfig().DefaultLimits})
+	if err := service.AutoMigrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, time.March, 10, 9, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	t.Cleanup(func() { timeNow = time.Now })
+	return service, &now
+}
+
+// reserveConcurrently 每个用户并发发起attempts次请求并立即提交，返回各用户成功次数和拒绝原因
+func reserveConcurrently(t *testing.T, service *Service, users []uint, attempts int) (map[uint]int, []string) {
+	t.Helper()
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		granted = map[uint]int{}
+		reasons []string
+	)
+	for _, userID := range users {
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func(userID uint) {
+				defer wg.Done()
+				reservation, _, err := service.Reserve(userID, "document_parsing", 0.5)
+				var exceeded *QuotaExceededError
+				if errors.As(err, &exceeded) {
+					mu.Lock()
+					reasons = append(reasons, exceeded.Result.Reason)
+					mu.Unlock()
+					return
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if err := service.Commit(reservation.ID, Usage{CostUSD: 0.5}); err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				granted[userID]++
+				mu.Unlock()
+			}(userID)
+		}
+	}
+	wg.Wait()
+	return granted, reasons
+}
+
+func TestReserveHoldsLimitsUnderConcurrency(t *testing.T) {
+	service, _ := newTestService(t)
+	if _, err := service.SetUserLimits(1, "document_parsing", Limits{DailyLimit: 10, MonthlyLimit: 100,
+		DailyCostLimit: 100, MonthlyCostLimit: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	granted, reasons := reserveConcurrently(t, service, []uint{1}, 50)
+	if granted[1] != 10 || len(reasons) != 40 {
+		t.Fatalf("granted = %d, rejected = %d", granted[1], len(reasons))
+	}
+	for _, reason := range reasons {
+		if reason != ReasonDailyLimit {
+			t.Fatalf("reason = %s", reason)
+		}
+	}
+	status, err := service.Status(1, "document_parsing", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.DailyUsed != 10 || status.Reserved != 0 || status.CostUsed != 5 || status.Allowed {
+		t.Fatalf("status = %+v", status)
+	}
+	records, _ := service.ListUsage(1, "document_parsing", 100)
+	if len(records) != 10 {
+		t.Fatalf("usage records = %d", len(records))
+	}
+}
+
+func TestCompanyPoolCapsSubQuotasUnderConcurrency(t *testing.T) {
+	service, _ := newTestService(t)
+	if _, err := service.SetCompanyPool(7, "document_parsing", Limits{DailyLimit: 12, MonthlyLimit: 100,
+		DailyCostLimit: 100, MonthlyCostLimit: 100}); err != nil {
+		t.Fatal(err)
+	}
+	companyID := uint(7)
+	users := []uint{1, 2, 3}
+	for _, userID := range users {
+		if _, err := service.SetUserLimits(userID, "document_parsing", Limits{DailyLimit: 6, MonthlyLimit: 100,
+			DailyCostLimit: 100, MonthlyCostLimit: 100}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := service.SetUserCompany(userID, "document_parsing", &companyID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	granted, reasons := reserveConcurrently(t, service, users, 20)
+	total := 0
+	for _, userID := range users {
+		if granted[userID] > 6 {
+			t.Fatalf("user %d granted %d over sub-quota", userID, granted[userID])
+		}
+		total += granted[userID]
+	}
+	if total != 12 {
+		t.Fatalf("total granted = %d, want company pool 12", total)
+	}
+	pooled := false
+	for _, reason := range reasons {
+		pooled = pooled || reason == reasonCompanyPrefix+ReasonDailyLimit
+	}
+	if !pooled {
+		t.Fatalf("no rejection by company pool: %v", reasons)
+	}
+	pool, err := service.GetCompanyPool(7, "document_parsing")
+	if err != nil || pool.DailyUsed != 12 || pool.Reserved != 0 {
+		t.Fatalf("pool = %+v, %v", pool, err)
+	}
+}
+
+func TestBurstAllowanceAndPeriodRollover(t *testing.T) {
+	service, now := newTestService(t)
+	*now = time.Date(2026, time.March, 31, 9, 0, 0, 0, time.UTC)
+	if _, err := service.SetUserLimits(1, "document_parsing", Limits{DailyLimit: 5, DailyBurst: 3, MonthlyLimit: 10,
+		DailyCostLimit: 100, MonthlyCostLimit: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	granted, reasons := reserveConcurrently(t, service, []uint{1}, 12)
+	if granted[1] != 8 || len(reasons) != 4 || reasons[0] != ReasonDailyLimit {
+		t.Fatalf("day one granted = %d, reasons = %v", granted[1], reasons)
+	}
+
+	*now = time.Date(2026, time.March, 31, 23, 59, 0, 0, time.UTC)
+	if _, _, err := service.Reserve(1, "document_parsing", 0); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("same day err = %v", err)
+	}
+	// 跨月同时清零日用量和月用量
+	*now = time.Date(2026, time.April, 1, 0, 1, 0, 0, time.UTC)
+	status, _ := service.Status(1, "document_parsing", 0)
+	if status.DailyUsed != 0 || status.MonthlyUsed != 0 || !status.Allowed {
+		t.Fatalf("new month status = %+v", status)
+	}
+
+	// 次日只清零日用量，月用量累计到上限后突发额度也不能使用
+	*now = time.Date(2026, time.April, 2, 0, 1, 0, 0, time.UTC)
+	granted, reasons = reserveConcurrently(t, service, []uint{1}, 8)
+	if granted[1] != 8 {
+		t.Fatalf("day two granted = %d, reasons = %v", granted[1], reasons)
+	}
+	*now = time.Date(2026, time.April, 3, 0, 1, 0, 0, time.UTC)
+	granted, reasons = reserveConcurrently(t, service, []uint{1}, 5)
+	if granted[1] != 2 || len(reasons) != 3 || reasons[0] != ReasonMonthlyLimit {
+		t.Fatalf("day three granted = %d, reasons = %v", granted[1], reasons)
+	}
+}
+
+func TestReleaseExpiryAndCostLimits(t *testing.T) {
+	service, now := newTestService(t)
+	if _, err := service.SetUserLimits(1, "document_parsing", Limits{DailyLimit: 10, MonthlyLimit: 100,
+		DailyCostLimit: 10, MonthlyCostLimit: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	first, _, err := service.Reserve(1, "document_parsing", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := service.Reserve(1, "document_parsing", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exceeded *QuotaExceededError
+	if _, _, err := service.Reserve(1, "document_parsing", 4); !errors.As(err, &exceeded) || exceeded.Result.Reason != ReasonDailyCostLimit {
+		t.Fatalf("cost limit err = %v", err)
+	}
+
+	if err := service.Release(second.ID, Usage{}, "upstream error"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Release(second.ID, Usage{}, "upstream error"); !errors.Is(err, ErrReservationClosed) {
+		t.Fatalf("double release err = %v", err)
+	}
+	// 实际费用低于预估，提交后按实际费用计入
+	if err := service.Commit(first.ID, Usage{CostUSD: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Commit(first.ID, Usage{CostUSD: 1}); !errors.Is(err, ErrReservationClosed) {
+		t.Fatalf("double commit err = %v", err)
+	}
+	if err := service.Commit("missing", Usage{}); !errors.Is(err, ErrReservationNotFound) {
+		t.Fatalf("missing reservation err = %v", err)
+	}
+
+	third, _, err := service.Reserve(1, "document_parsing", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(2 * time.Minute)
+	if expired, err := service.SweepExpired(); err != nil || expired != 1 {
+		t.Fatalf("sweep = %d, %v", expired, err)
+	}
+	if err := service.Commit(third.ID, Usage{CostUSD: 4}); !errors.Is(err, ErrReservationClosed) {
+		t.Fatalf("commit after expiry err = %v", err)
+	}
+
+	status, _ := service.Status(1, "document_parsing", 0)
+	if status.DailyUsed != 1 || status.Reserved != 0 || status.CostUsed != 1 {
+		t.Fatalf("status = %+v", status)
+	}
+	var failed int64
+	service.db.Model(&AIUsageRecord{}).Where("status = ?", UsageFailed).Count(&failed)
+	if failed != 1 {
+		t.Fatalf("failed usage records = %d", failed)
+	}
+}
+
+func TestEnforceCommitsOnSuccessAndReleasesOnFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service, _ := newTestService(t)
+	if _, err := service.SetUserLimits(1, "document_parsing", Limits{DailyLimit: 1, MonthlyLimit: 100,
+		DailyCostLimit: 100, MonthlyCostLimit: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.Use(gin.Recovery(), func(c *gin.Context) { c.Set("user_id", uint(1)) })
+	enforce := NewQuotaMiddleware(service).Enforce("document_parsing", "company_document_parsing", 0.01)
+	r.POST("/fail", enforce, func(c *gin.Context) { c.JSON(http.StatusBadGateway, gin.H{"error": "upstream"}) })
+	r.POST("/panic", enforce, func(c *gin.Context) { panic("parser crashed") })
+	r.POST("/ok", enforce, func(c *gin.Context) {
+		SetActualUsage(c, 100, 50, 0.02)
+		c.JSON(http.StatusOK, gin.H{"quota_info": c.MustGet("quota_info")})
+	})
+
+	call := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		return w
+	}
+	// 失败和panic的请求不占用配额，唯一的一次额度留给成功的请求
+	if w := call("/fail"); w.Code != http.StatusBadGateway {
+		t.Fatalf("fail = %d", w.Code)
+	}
+	if w := call("/panic"); w.Code != http.StatusInternalServerError {
+		t.Fatalf("panic = %d", w.Code)
+	}
+	if w := call("/ok"); w.Code != http.StatusOK {
+		t.Fatalf("ok = %d %s", w.Code, w.Body.String())
+	}
+	if w := call("/ok"); w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), ReasonDailyLimit) {
+		t.Fatalf("over quota = %d %s", w.Code, w.Body.String())
+	}
+
+	records, _ := service.ListUsage(1, "", 10)
+	statuses := map[string]int{}
+	for _, record := range records {
+		statuses[record.Status]++
+		if record.Status == UsageSuccess && (record.TotalTokens != 150 || record.CostUSD != 0.02) {
+			t.Fatalf("success record = %+v", record)
+		}
+	}
+	if statuses[UsageSuccess] != 1 || statuses[UsageFailed] != 2 {
+		t.Fatalf("usage statuses = %v", statuses)
+	}
+}
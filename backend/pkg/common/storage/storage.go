@@ -121,6 +121,57 @@ func (s *StorageManager) UploadFile(ctx context.Context, file *multipart.FileHea
 	return fileInfo, nil
 }
 
+// SaveFile 按指定对象键保存文件内容，已存在时覆盖
+func (s *StorageManager) SaveFile(ctx context.Context, key string, data []byte, contentType string) (*FileInfo, error) {
+	if int64(len(data)) > s.config.MaxFileSize {
+		return nil, fmt.Errorf("file size exceeds limit: %d > %d", len(data), s.config.MaxFileSize)
+	}
+	ext := strings.ToLower(filepath.Ext(key))
+	if !s.isAllowedExtension(ext) {
+		return nil, fmt.Errorf("file extension not allowed: %s", ext)
+	}
+	fullPath, err := s.objectPath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(fullPath, data, 0640); err != nil {
+		return nil, fmt.Errorf("failed to write file: %v", err)
+	}
+
+	now := time.Now()
+	return &FileInfo{
+		Name:        filepath.Base(key),
+		Path:        key,
+		Size:        int64(len(data)),
+		ContentType: contentType,
+		URL:         s.config.URLPrefix + "/" + key,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, nil
+}
+
+// OpenFile 按对象键打开文件，调用方负责关闭
+func (s *StorageManager) OpenFile(ctx context.Context, key string) (io.ReadCloser, error) {
+	fullPath, err := s.objectPath(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(fullPath)
+}
+
+// objectPath 对象键对应的本地路径，拒绝跳出基础目录的键
+func (s *StorageManager) objectPath(key string) (string, error) {
+	cleaned := filepath.Clean("/" + key)
+	if key == "" || cleaned == "/" || cleaned != "/"+filepath.ToSlash(key) {
+		return "", fmt.Errorf("invalid object key: %s", key)
+	}
+	return filepath.Join(s.config.BasePath, cleaned), nil
+}
+
 // DeleteFile 删除文件
 func (s *StorageManager) DeleteFile(ctx context.Context, filePath string) error {
 	fullPath := filepath.Join(s.config.BasePath, filePath)
@@ -0,0 +1,192 @@
+package docextract
+
+import (
+	"regexp"
+	"testing"
+)
+
+func pairMap(doc *Document) map[string]Pair {
+	m := make(map[string]Pair)
+	for _, p := range doc.Pairs {
+		m[p.Label] = p
+	}
+	return m
+}
+
+func TestParseKeyValueLayouts(t *testing.T) {
+	text := "# 企业简介\n" +
+		"- **公司名称**：华星科技有限公司\n" +
+		"法定代表人：张三    注册资本：1000万元人民币\n" +
+		"官网：https://www.huaxing.example\n" +
+		"经营范围：\n" +
+		"\n" +
+		"软件开发；技术服务。\n" +
+		"所属行业\t\t软件和信息技术服务业\n" +
+		"我们致力于成为行业领先的服务商，欢迎合作。\n"
+	doc := Parse(text)
+	pairs := pairMap(doc)
+
+	for label, want := range map[string]struct {
+		value  string
+		layout Layout
+	}{
+		"公司名称":  {"华星科技有限公司", LayoutInline},
+		"法定代表人": {"张三", LayoutInline},
+		"注册资本":  {"1000万元人民币", LayoutInline},
+		"官网":    {"https://www.huaxing.example", LayoutInline},
+		"经营范围":  {"软件开发；技术服务", LayoutNextLine},
+		"所属行业":  {"软件和信息技术服务业", LayoutAligned},
+	} {
+		got, ok := pairs[label]
+		if !ok || got.Value != want.value || got.Layout != want.layout {
+			t.Errorf("%s = %+v, want %q (%s)", label, got, want.value, want.layout)
+			continue
+		}
+		if text[got.ValueSpan.Start:got.ValueSpan.End] != want.value {
+			t.Errorf("%s span %+v covers %q", label, got.ValueSpan, text[got.ValueSpan.Start:got.ValueSpan.End])
+		}
+	}
+	if len(doc.Pairs) != 6 {
+		t.Errorf("pairs = %+v", doc.Pairs)
+	}
+	if pairs["注册资本"].ValueSpan.Line != 3 {
+		t.Errorf("line = %d, want 3", pairs["注册资本"].ValueSpan.Line)
+	}
+}
+
+func TestParseTables(t *testing.T) {
+	text := "| 项目 | 内容 | 项目 | 内容 |\n" +
+		"|---|---|---|---|\n" +
+		"| 企业名称 | 晶芯半导体 | 成立日期 | 2015-06-01 |\n" +
+		"| 员工人数 | 320 | 所属行业 | 集成电路 |\n" +
+		"\n" +
+		"<table><tr><th>年度</th><th>营业收入</th><th>净利润</th></tr>" +
+		"<tr><td>2023</td><td>1.2亿元</td><td>1800万元</td></tr></table>\n"
+	doc := Parse(text)
+	pairs := pairMap(doc)
+	if pairs["企业名称"].Value != "晶芯半导体" || pairs["所属行业"].Layout != LayoutTable {
+		t.Fatalf("pairs = %+v", doc.Pairs)
+	}
+	if len(doc.Tables) != 1 {
+		t.Fatalf("tables = %+v", doc.Tables)
+	}
+	table := doc.Tables[0]
+	if len(table.Header) != 3 || table.Header[1].Text != "营业收入" || len(table.Rows) != 1 || table.Rows[0][1].Text != "1.2亿元" {
+		t.Fatalf("table = %+v", table)
+	}
+	if cell := table.Rows[0][2]; text[cell.Span.Start:cell.Span.End] != "1800万元" {
+		t.Fatalf("cell span covers %q", text[cell.Span.Start:cell.Span.End])
+	}
+}
+
+func TestFromMinerUContentList(t *testing.T) {
+	structure := map[string]interface{}{
+		"content_list": []interface{}{
+			map[string]interface{}{"type": "text", "text": "营业执照", "page_idx": float64(0)},
+			map[string]interface{}{"type": "image", "img_path": "images/seal.jpg", "page_idx": float64(0)},
+			map[string]interface{}{"type": "table", "page_idx": float64(1),
+				"table_body": "<table><tr><td>名称</td><td>远航物流有限公司</td></tr><tr><td>住所</td><td>深圳市南山区</td></tr></table>"},
+		},
+	}
+	doc := FromMinerU("ignored", structure)
+	pairs := pairMap(doc)
+	if pairs["名称"].Value != "远航物流有限公司" || pairs["住所"].ValueSpan.Page != 2 {
+		t.Fatalf("pairs = %+v", doc.Pairs)
+	}
+}
+
+func testRules() []FieldRule {
+	return []FieldRule{
+		{Name: "name", Labels: []string{"公司名称", "企业名称", "名称"}},
+		{Name: "credit_code", Labels: []string{"统一社会信用代码"}, Pattern: regexp.MustCompile(`\b[0-9A-Z]{18}\b`), Search: true},
+		{Name: "address", Labels: []string{"注册地址", "住所"}},
+	}
+}
+
+func TestExtractConfidence(t *testing.T) {
+	doc := Parse("公司名称：华星科技有限公司\n" +
+		"| 企业名称 | 华星科技有限公司 |\n" +
+		"企业注册地址：深圳市福田区\n" +
+		"统一社会信用代码：9144030012345\n")
+	result := NewExtractor(testRules()).Extract(doc)
+
+	name := result.Fields["name"]
+	if name.Value != "华星科技有限公司" || name.Layout != LayoutTable || name.Confidence <= layoutScores[LayoutTable]*unvalidatedScore {
+		t.Fatalf("name = %+v, want agreeing candidates to lift confidence", name)
+	}
+	address := result.Fields["address"]
+	if address.Value != "深圳市福田区" || address.Confidence >= name.Confidence {
+		t.Fatalf("address = %+v, want lower confidence for partial label", address)
+	}
+	code := result.Fields["credit_code"]
+	if code.Validated || code.Confidence > 0.5 {
+		t.Fatalf("credit_code = %+v, want low confidence for invalid format", code)
+	}
+
+	// 值后面跟着说明文字时只取满足格式的开头部分
+	rules := append(testRules(), FieldRule{Name: "staff", Labels: []string{"员工人数"}, Pattern: regexp.MustCompile(`\d[\d,]*人`)})
+	text := "员工人数：1,250人，其中研发人员占比42%\n"
+	staff := NewExtractor(rules).Extract(Parse(text)).Fields["staff"]
+	if staff.Value != "1,250人" || !staff.Validated || text[staff.Source.Start:staff.Source.End] != "1,250人" {
+		t.Fatalf("staff = %+v", staff)
+	}
+
+	// 没有标签时按格式在全文中查找
+	doc = Parse("信用代码为91440300MA5D8Y7K17的企业\n")
+	code = NewExtractor(testRules()).Extract(doc).Fields["credit_code"]
+	if code.Value != "91440300MA5D8Y7K17" || code.Layout != LayoutPattern || !code.Validated {
+		t.Fatalf("credit_code = %+v", code)
+	}
+}
+
+func TestExtractConflictingValues(t *testing.T) {
+	doc := Parse("名称：华星科技\n公司名称：华星电子\n")
+	name := NewExtractor(testRules()).Extract(doc).Fields["name"]
+	if name.Value != "华星科技" || len(name.Alternatives) != 1 || name.Alternatives[0].Value != "华星电子" {
+		t.Fatalf("name = %+v", name)
+	}
+	if name.Confidence > 0.5 {
+		t.Fatalf("confidence = %v, want conflict to halve it", name.Confidence)
+	}
+}
+
+func TestLearnTuning(t *testing.T) {
+	corrections := []Correction{
+		{Field: "address", Label: "经营场所", WrongLabel: ""},
+		{Field: "address", Label: "经营场所", WrongLabel: "通讯地址"},
+		{Field: "address", Label: "", WrongLabel: "通讯地址"},
+		{Field: "name", Label: "开户名", WrongLabel: ""},
+	}
+	tuning := Learn(corrections, 2)
+	if tuning.Labels["address"]["经营场所"] != learnedLabelBase || len(tuning.Labels["name"]) != 0 {
+		t.Fatalf("labels = %+v", tuning.Labels)
+	}
+	if tuning.Penalties["address"]["通讯地址"] != penaltyStep {
+		t.Fatalf("penalties = %+v", tuning.Penalties)
+	}
+
+	rules := append(testRules(), FieldRule{Name: "contact_address", Labels: []string{"通讯地址"}})
+	doc := Parse("经营场所：广州市天河区\n")
+	before := NewExtractor(rules).Extract(doc)
+	after := NewExtractor(rules).WithTuning(tuning).Extract(doc)
+	if _, ok := before.Fields["address"]; ok {
+		t.Fatalf("before tuning = %+v", before.Fields)
+	}
+	if after.Fields["address"].Value != "广州市天河区" {
+		t.Fatalf("after tuning = %+v", after.Fields)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	cases := []Case{
+		{Name: "a", Document: Parse("公司名称：甲公司\n住所：北京\n"), Expected: map[string]string{"name": "甲公司", "address": "北京"}},
+		{Name: "b", Document: Parse("名称：乙公司\n"), Expected: map[string]string{"name": "乙公司", "address": "上海", "credit_code": ""}},
+	}
+	report := Evaluate(NewExtractor(testRules()), cases)
+	if report.Cases != 2 || report.Precision != 1 || report.Recall != 0.75 || len(report.Misses) != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	if report.Misses[0].Case != "b" || report.Misses[0].Field != "address" {
+		t.Fatalf("misses = %+v", report.Misses)
+	}
+}
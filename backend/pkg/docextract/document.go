@@ -0,0 +1,512 @@
+package docextract
+
+import (
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Span 文本在文档中的位置：Start/End为Document.Text中的字节偏移，Line从1开始，Page未知时为0
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+	Line  int `json:"line"`
+	Page  int `json:"page,omitempty"`
+}
+
+// Layout 键值对在文档中的排版方式
+type Layout string
+
+const (
+	LayoutTable    Layout = "table"     // 键值表格中相邻的两个单元格
+	LayoutInline   Layout = "inline"    // 同一行的"标签：值"
+	LayoutNextLine Layout = "next_line" // 标签独占一行，值在下一行
+	LayoutAligned  Layout = "aligned"   // 标签和值之间用多个空格或制表符对齐
+	LayoutPattern  Layout = "pattern"   // 没有标签，按值的格式在全文中找到
+	LayoutManual   Layout = "manual"    // 人工更正
+)
+
+// Pair 识别出的一个标签和值
+type Pair struct {
+	Label     string `json:"label"`
+	Value     string `json:"value"`
+	Layout    Layout `json:"layout"`
+	LabelSpan Span   `json:"label_span"`
+	ValueSpan Span   `json:"value_span"`
+}
+
+// Cell 表格单元格
+type Cell struct {
+	Text string `json:"text"`
+	Span Span   `json:"span"`
+}
+
+// Table 数据表格，键值布局的表格已拆成Pair，不在这里
+type Table struct {
+	Page   int      `json:"page,omitempty"`
+	Header []Cell   `json:"header"`
+	Rows   [][]Cell `json:"rows"`
+	Span   Span     `json:"span"`
+}
+
+// Document 解析后的文档：原文、键值对和数据表格
+type Document struct {
+	Text   string  `json:"-"`
+	Pairs  []Pair  `json:"pairs"`
+	Tables []Table `json:"tables"`
+
+	lines []textLine
+	pages []pageMark
+}
+
+type textLine struct {
+	start, end int
+}
+
+// pageMark 从offset开始的文本属于page页
+type pageMark struct {
+	offset, page int
+}
+
+// ContentBlock MinerU content_list中的一个内容块
+type ContentBlock struct {
+	Type      string `json:"type"`
+	Text      string `json:"text,omitempty"`
+	TableBody string `json:"table_body,omitempty"`
+	PageIdx   int    `json:"page_idx"`
+}
+
+// Parse 解析纯文本或Markdown（MinerU的md输出），页码未知
+func Parse(text string) *Document {
+	return parse(text, nil)
+}
+
+// FromContentList 按MinerU content_list解析，保留每个块的页码；图片等非文本块被忽略
+func FromContentList(blocks []ContentBlock) *Document {
+	var b strings.Builder
+	var pages []pageMark
+	for _, block := range blocks {
+		body := block.Text
+		if block.Type == "table" {
+			body = block.TableBody
+		}
+		if strings.TrimSpace(body) == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		pages = append(pages, pageMark{offset: b.Len(), page: block.PageIdx + 1})
+		b.WriteString(strings.TrimRight(body, "\n"))
+	}
+	return parse(b.String(), pages)
+}
+
+// FromMinerU 优先使用结构化结果中的content_list，没有时解析文本内容
+func FromMinerU(content string, structure map[string]interface{}) *Document {
+	if raw, ok := structure["content_list"].([]interface{}); ok && len(raw) > 0 {
+		blocks := make([]ContentBlock, 0, len(raw))
+		for _, item := range raw {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			block := ContentBlock{}
+			block.Type, _ = m["type"].(string)
+			block.Text, _ = m["text"].(string)
+			block.TableBody, _ = m["table_body"].(string)
+			if page, ok := m["page_idx"].(float64); ok {
+				block.PageIdx = int(page)
+			}
+			blocks = append(blocks, block)
+		}
+		return FromContentList(blocks)
+	}
+	return Parse(content)
+}
+
+func parse(text string, pages []pageMark) *Document {
+	doc := &Document{Text: text, pages: pages}
+	start := 0
+	for i := 0; i <= len(text); i++ {
+		if i == len(text) || text[i] == '\n' {
+			end := i
+			if end > start && text[end-1] == '\r' {
+				end--
+			}
+			doc.lines = append(doc.lines, textLine{start: start, end: end})
+			start = i + 1
+		}
+	}
+
+	var pending *Pair // 以冒号结尾、值在下一行的标签
+	for i := 0; i < len(doc.lines); i++ {
+		ln := doc.lines[i]
+		trimmed := strings.TrimSpace(text[ln.start:ln.end])
+		switch {
+		case trimmed == "":
+			continue
+		case strings.HasPrefix(trimmed, "|"):
+			j := i
+			for j+1 < len(doc.lines) && strings.HasPrefix(strings.TrimSpace(doc.lineText(j+1)), "|") {
+				j++
+			}
+			doc.addMarkdownTable(i, j)
+			i, pending = j, nil
+			continue
+		case strings.Contains(strings.ToLower(trimmed), "<table"):
+			j := i
+			for j < len(doc.lines) && !strings.Contains(strings.ToLower(doc.lineText(j)), "</table>") {
+				j++
+			}
+			if j == len(doc.lines) {
+				j--
+			}
+			doc.addHTMLTable(doc.lines[i].start, doc.lines[j].end)
+			i, pending = j, nil
+			continue
+		}
+
+		pairs, dangling := doc.linePairs(ln)
+		if pending != nil && len(pairs) == 0 && dangling == nil {
+			s, e := trimValue(text, ln.start, ln.end)
+			if s < e {
+				pending.Value = text[s:e]
+				pending.ValueSpan = doc.span(s, e)
+				pending.Layout = LayoutNextLine
+				doc.Pairs = append(doc.Pairs, *pending)
+			}
+			pending = nil
+			continue
+		}
+		doc.Pairs = append(doc.Pairs, pairs...)
+		pending = dangling
+	}
+	return doc
+}
+
+func (d *Document) lineText(i int) string {
+	return d.Text[d.lines[i].start:d.lines[i].end]
+}
+
+// labelColon 行内"标签："的位置：标签前是行首、多个空格、制表符或分号逗号
+var labelColon = regexp.MustCompile(`(?:^|\s{2,}|\t|　+|[；;，,]\s*)([^\s：:；;，,|]{1,20})\s*[：:]`)
+
+// linePairs 识别一行中的键值对；行以"标签："结尾时返回待填值的标签
+func (d *Document) linePairs(ln textLine) ([]Pair, *Pair) {
+	lineStart := ln.start + markerLength(d.Text[ln.start:ln.end])
+	line := d.Text[lineStart:ln.end]
+
+	var pairs []Pair
+	var dangling *Pair
+	matches := labelColon.FindAllStringSubmatchIndex(line, -1)
+	var accepted [][]int
+	for _, m := range matches {
+		label := line[m[2]:m[3]]
+		// URL中的冒号不是标签分隔符
+		if strings.HasPrefix(line[m[1]:], "//") || !labelLike(cleanLabel(label), 20) {
+			continue
+		}
+		accepted = append(accepted, m)
+	}
+	for k, m := range accepted {
+		valueEnd := len(line)
+		if k+1 < len(accepted) {
+			valueEnd = accepted[k+1][0]
+		}
+		ls, le := trimValue(d.Text, lineStart+m[2], lineStart+m[3])
+		vs, ve := trimValue(d.Text, lineStart+m[1], lineStart+valueEnd)
+		pair := Pair{Label: cleanLabel(d.Text[ls:le]), Layout: LayoutInline, LabelSpan: d.span(ls, le)}
+		if vs >= ve {
+			if k == len(accepted)-1 {
+				dangling = &pair
+			}
+			continue
+		}
+		pair.Value = d.Text[vs:ve]
+		pair.ValueSpan = d.span(vs, ve)
+		pairs = append(pairs, pair)
+	}
+	if len(accepted) > 0 {
+		return pairs, dangling
+	}
+
+	// 没有冒号时按多空格对齐的"标签 值 标签 值"识别
+	segments := splitAligned(line)
+	if len(segments) < 2 || len(segments)%2 != 0 {
+		return nil, nil
+	}
+	for k := 0; k < len(segments); k += 2 {
+		if !labelLike(cleanLabel(line[segments[k][0]:segments[k][1]]), 10) || hasDigit(line[segments[k][0]:segments[k][1]]) {
+			return nil, nil
+		}
+	}
+	for k := 0; k < len(segments); k += 2 {
+		ls, le := lineStart+segments[k][0], lineStart+segments[k][1]
+		vs, ve := trimValue(d.Text, lineStart+segments[k+1][0], lineStart+segments[k+1][1])
+		if vs >= ve {
+			continue
+		}
+		pairs = append(pairs, Pair{
+			Label:     cleanLabel(d.Text[ls:le]),
+			Value:     d.Text[vs:ve],
+			Layout:    LayoutAligned,
+			LabelSpan: d.span(ls, le),
+			ValueSpan: d.span(vs, ve),
+		})
+	}
+	return pairs, nil
+}
+
+var alignedGap = regexp.MustCompile(`\t+|\s{2,}|　+`)
+
+// splitAligned 按对齐空白切分，返回各段在line中的区间
+func splitAligned(line string) [][2]int {
+	var segments [][2]int
+	start := 0
+	for _, gap := range alignedGap.FindAllStringIndex(line, -1) {
+		if gap[0] > start {
+			segments = append(segments, [2]int{start, gap[0]})
+		}
+		start = gap[1]
+	}
+	if start < len(line) {
+		segments = append(segments, [2]int{start, len(line)})
+	}
+	return segments
+}
+
+var listMarker = regexp.MustCompile(`^\s*(?:[#>*+\-]+\s*|\d+[.、)）]\s*|[(（]\d+[)）]\s*)*`)
+
+// markerLength Markdown标题、引用和列表符号的长度
+func markerLength(line string) int {
+	return len(listMarker.FindString(line))
+}
+
+func (d *Document) addMarkdownTable(first, last int) {
+	var rows [][]Cell
+	header := false
+	for i := first; i <= last; i++ {
+		ln := d.lines[i]
+		line := d.Text[ln.start:ln.end]
+		var cells []Cell
+		offset := 0
+		parts := strings.Split(line, "|")
+		separator := true
+		for k, part := range parts {
+			cellStart := ln.start + offset
+			offset += len(part) + 1
+			if k == 0 || k == len(parts)-1 && strings.TrimSpace(part) == "" {
+				continue
+			}
+			s, e := trimValue(d.Text, cellStart, cellStart+len(part))
+			text := d.Text[s:e]
+			if !tableRule.MatchString(strings.TrimSpace(part)) {
+				separator = false
+			}
+			cells = append(cells, Cell{Text: text, Span: d.span(s, e)})
+		}
+		if separator && len(cells) > 0 {
+			header = len(rows) == 1
+			continue
+		}
+		rows = append(rows, cells)
+	}
+	d.addTable(rows, header, d.span(d.lines[first].start, d.lines[last].end))
+}
+
+var tableRule = regexp.MustCompile(`^:?-{3,}:?$`)
+
+var (
+	htmlRow  = regexp.MustCompile(`(?is)<tr[^>]*>(.*?)</tr>`)
+	htmlCell = regexp.MustCompile(`(?is)<t([dh])[^>]*>(.*?)</t[dh]>`)
+	htmlTag  = regexp.MustCompile(`<[^>]+>`)
+)
+
+func (d *Document) addHTMLTable(start, end int) {
+	body := d.Text[start:end]
+	var rows [][]Cell
+	header := false
+	for r, row := range htmlRow.FindAllStringSubmatchIndex(body, -1) {
+		var cells []Cell
+		allTH := true
+		for _, cell := range htmlCell.FindAllStringSubmatchIndex(body[row[2]:row[3]], -1) {
+			if body[row[2]+cell[2]:row[2]+cell[3]] != "h" && body[row[2]+cell[2]:row[2]+cell[3]] != "H" {
+				allTH = false
+			}
+			s, e := start+row[2]+cell[4], start+row[2]+cell[5]
+			text := strings.TrimSpace(html.UnescapeString(htmlTag.ReplaceAllString(d.Text[s:e], "")))
+			if ts, te := trimValue(d.Text, s, e); !strings.ContainsAny(d.Text[ts:te], "<&") {
+				s, e = ts, te
+			}
+			cells = append(cells, Cell{Text: text, Span: d.span(s, e)})
+		}
+		if r == 0 && allTH && len(cells) > 0 {
+			header = true
+		}
+		rows = append(rows, cells)
+	}
+	d.addTable(rows, header, d.span(start, end))
+}
+
+// addTable 键值布局（偶数列，偶数位置都是标签）拆成键值对，其余作为数据表格
+func (d *Document) addTable(rows [][]Cell, header bool, span Span) {
+	if len(rows) == 0 {
+		return
+	}
+	if isKeyValueTable(rows) {
+		for _, row := range rows {
+			for k := 0; k+1 < len(row); k += 2 {
+				if row[k+1].Text == "" {
+					continue
+				}
+				d.Pairs = append(d.Pairs, Pair{
+					Label:     cleanLabel(row[k].Text),
+					Value:     row[k+1].Text,
+					Layout:    LayoutTable,
+					LabelSpan: row[k].Span,
+					ValueSpan: row[k+1].Span,
+				})
+			}
+		}
+		return
+	}
+	table := Table{Page: span.Page, Span: span}
+	if header || len(rows) > 1 {
+		table.Header, rows = rows[0], rows[1:]
+	}
+	table.Rows = rows
+	d.Tables = append(d.Tables, table)
+}
+
+func isKeyValueTable(rows [][]Cell) bool {
+	width := len(rows[0])
+	if width == 0 || width%2 != 0 {
+		return false
+	}
+	labelRows := 0
+	for _, row := range rows {
+		if len(row) != width {
+			return false
+		}
+		ok := true
+		for k := 0; k < len(row); k += 2 {
+			if !labelLike(cleanLabel(row[k].Text), 12) || hasDigit(row[k].Text) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			labelRows++
+		}
+	}
+	return labelRows*5 >= len(rows)*4
+}
+
+// span 根据字节偏移计算行号和页码
+func (d *Document) span(start, end int) Span {
+	line := sort.Search(len(d.lines), func(i int) bool { return d.lines[i].end >= start })
+	s := Span{Start: start, End: end, Line: line + 1}
+	if k := sort.Search(len(d.pages), func(i int) bool { return d.pages[i].offset > start }); k > 0 {
+		s.Page = d.pages[k-1].page
+	}
+	return s
+}
+
+// Locate 查找值与value一致的键值对，用于从人工更正中学习标签
+func (d *Document) Locate(value string) (Pair, bool) {
+	target := Normalize(value)
+	if target == "" {
+		return Pair{}, false
+	}
+	for _, p := range d.Pairs {
+		if Normalize(p.Value) == target {
+			return p, true
+		}
+	}
+	for _, p := range d.Pairs {
+		if utf8.RuneCountInString(target) >= 2 && strings.Contains(Normalize(p.Value), target) {
+			return p, true
+		}
+	}
+	return Pair{}, false
+}
+
+// Find 值在原文中第一次出现的位置
+func (d *Document) Find(value string) (Span, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Span{}, false
+	}
+	i := strings.Index(d.Text, value)
+	if i < 0 {
+		return Span{}, false
+	}
+	return d.span(i, i+len(value)), true
+}
+
+// Normalize 比较标签和值时使用的规范形式：去掉空白和强调符号，全角转半角，英文小写
+func Normalize(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r), r == '*', r == '`':
+			continue
+		case r >= 0xFF01 && r <= 0xFF5E:
+			r -= 0xFEE0
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return strings.TrimRight(b.String(), ":")
+}
+
+// cleanLabel 去掉标签中的强调符号、空白和结尾冒号
+func cleanLabel(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '*' || r == '`' {
+			return -1
+		}
+		return r
+	}, s)
+	return strings.TrimRight(s, ":：")
+}
+
+// labelLike 看起来像标签：长度有限、含文字、不是句子
+func labelLike(s string, maxRunes int) bool {
+	n := utf8.RuneCountInString(s)
+	if n == 0 || n > maxRunes || strings.ContainsAny(s, "。，,!！?？<>/\\") {
+		return false
+	}
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasDigit(s string) bool {
+	return strings.IndexFunc(s, unicode.IsDigit) >= 0
+}
+
+// trimValue 去掉区间两端的空白、强调符号和结尾标点
+func trimValue(text string, start, end int) (int, int) {
+	for start < end {
+		r, size := utf8.DecodeRuneInString(text[start:end])
+		if !unicode.IsSpace(r) && r != '*' && r != '`' {
+			break
+		}
+		start += size
+	}
+	for end > start {
+		r, size := utf8.DecodeLastRuneInString(text[start:end])
+		if !unicode.IsSpace(r) && r != '*' && r != '`' && !strings.ContainsRune("。；;，,", r) {
+			break
+		}
+		end -= size
+	}
+	return start, end
+}
@@ -0,0 +1,170 @@
+package docextract
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Case 评测语料中的一份文档及其标注
+type Case struct {
+	Name     string
+	Document *Document
+	// Expected 字段 → 期望值，空字符串表示该字段不应被提取；未列出的字段不参与评测
+	Expected map[string]string
+}
+
+// FieldScore 单个字段的评测结果
+type FieldScore struct {
+	Field          string  `json:"field"`
+	Expected       int     `json:"expected"`
+	Extracted      int     `json:"extracted"`
+	Correct        int     `json:"correct"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+	MeanConfidence float64 `json:"mean_confidence"`
+}
+
+// Miss 一处提取错误
+type Miss struct {
+	Case     string `json:"case"`
+	Field    string `json:"field"`
+	Expected string `json:"expected"`
+	Got      string `json:"got"`
+}
+
+// Report 评测报告
+type Report struct {
+	Cases     int          `json:"cases"`
+	Fields    []FieldScore `json:"fields"`
+	Precision float64      `json:"precision"`
+	Recall    float64      `json:"recall"`
+	F1        float64      `json:"f1"`
+	// CalibrationError 置信度与是否正确（1或0）之间的平均绝对偏差，越小说明置信度越可信
+	CalibrationError float64 `json:"calibration_error"`
+	Misses           []Miss  `json:"misses,omitempty"`
+}
+
+// Evaluate 在语料上运行提取器并统计各字段的准确率和召回率
+func Evaluate(e *Extractor, cases []Case) Report {
+	scores := make(map[string]*FieldScore)
+	confidence := make(map[string]float64)
+	var report Report
+	var expected, extracted, correct int
+	var calibration float64
+
+	for _, c := range cases {
+		result := e.Extract(c.Document)
+		for field, want := range c.Expected {
+			s := scores[field]
+			if s == nil {
+				s = &FieldScore{Field: field}
+				scores[field] = s
+			}
+			got, ok := result.Fields[field]
+			if want != "" {
+				s.Expected++
+				expected++
+			}
+			if !ok {
+				if want != "" {
+					report.Misses = append(report.Misses, Miss{Case: c.Name, Field: field, Expected: want})
+				}
+				continue
+			}
+			s.Extracted++
+			extracted++
+			confidence[field] += got.Confidence
+			hit := want != "" && Normalize(got.Value) == Normalize(want)
+			if hit {
+				s.Correct++
+				correct++
+				calibration += 1 - got.Confidence
+			} else {
+				calibration += got.Confidence
+				report.Misses = append(report.Misses, Miss{Case: c.Name, Field: field, Expected: want, Got: got.Value})
+			}
+		}
+	}
+
+	for field, s := range scores {
+		s.Precision = ratio(s.Correct, s.Extracted)
+		s.Recall = ratio(s.Correct, s.Expected)
+		if s.Extracted > 0 {
+			s.MeanConfidence = round3(confidence[field] / float64(s.Extracted))
+		}
+		report.Fields = append(report.Fields, *s)
+	}
+	sort.Slice(report.Fields, func(i, j int) bool { return report.Fields[i].Field < report.Fields[j].Field })
+	sort.SliceStable(report.Misses, func(i, j int) bool { return report.Misses[i].Case < report.Misses[j].Case })
+
+	report.Cases = len(cases)
+	report.Precision = ratio(correct, extracted)
+	report.Recall = ratio(correct, expected)
+	if report.Precision+report.Recall > 0 {
+		report.F1 = round3(2 * report.Precision * report.Recall / (report.Precision + report.Recall))
+	}
+	if extracted > 0 {
+		report.CalibrationError = round3(calibration / float64(extracted))
+	}
+	return report
+}
+
+// LoadCorpus 读取评测语料：每份文档一个<name>.expected.json标注文件，
+// 文档本身是同名的MinerU输出<name>.content_list.json或文本<name>.md
+func LoadCorpus(dir string) ([]Case, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.expected.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	cases := make([]Case, 0, len(files))
+	for _, file := range files {
+		base := strings.TrimSuffix(file, ".expected.json")
+		c := Case{Name: filepath.Base(base)}
+		if err := readJSON(file, &c.Expected); err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(base + ".content_list.json"); err == nil {
+			var blocks []ContentBlock
+			if err := readJSON(base+".content_list.json", &blocks); err != nil {
+				return nil, err
+			}
+			c.Document = FromContentList(blocks)
+		} else {
+			text, err := os.ReadFile(base + ".md")
+			if err != nil {
+				return nil, fmt.Errorf("语料%s缺少文档: %w", c.Name, err)
+			}
+			c.Document = Parse(string(text))
+		}
+		cases = append(cases, c)
+	}
+	return cases, nil
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("解析%s失败: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return round3(float64(a) / float64(b))
+}
+
+func round3(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
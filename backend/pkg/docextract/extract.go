@@ -0,0 +1,256 @@
+package docextract
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldRule 一个字段的提取规则
+type FieldRule struct {
+	Name   string
+	Labels []string // 文档中可能出现的标签，完全匹配得分最高，包含匹配次之
+	// Pattern 值应满足的格式，需完整匹配整个值，不满足时降低置信度
+	Pattern *regexp.Regexp
+	// Search 没有任何标签命中时，用Pattern在全文中查找
+	Search bool
+	// Normalize 对提取到的值做规范化，例如统一大小写
+	Normalize func(string) string
+}
+
+// Candidate 字段的一个候选值
+type Candidate struct {
+	Value  string  `json:"value"`
+	Label  string  `json:"label,omitempty"`
+	Layout Layout  `json:"layout"`
+	Source Span    `json:"source"`
+	Score  float64 `json:"score"`
+}
+
+// Field 提取结果：取得分最高的候选值，置信度综合排版、标签、格式校验和候选值之间的一致性
+type Field struct {
+	Name         string      `json:"name"`
+	Value        string      `json:"value"`
+	Confidence   float64     `json:"confidence"`
+	Label        string      `json:"label,omitempty"`
+	Layout       Layout      `json:"layout"`
+	Source       Span        `json:"source"`
+	Validated    bool        `json:"validated"` // 值满足规则的格式
+	Alternatives []Candidate `json:"alternatives,omitempty"`
+}
+
+// Result 一份文档的提取结果
+type Result struct {
+	Fields map[string]Field `json:"fields"`
+	Tables []Table          `json:"tables,omitempty"`
+}
+
+// 各排版方式的基础分：表格和同行冒号最可靠，对齐布局容易把正文误认成键值
+var layoutScores = map[Layout]float64{
+	LayoutTable:    0.95,
+	LayoutInline:   0.9,
+	LayoutNextLine: 0.75,
+	LayoutAligned:  0.7,
+	LayoutPattern:  0.55,
+}
+
+const (
+	containsLabelScore = 0.75 // 文档标签包含规则标签，例如"企业注册地址"包含"注册地址"
+	unvalidatedScore   = 0.85 // 规则没有格式约束
+	invalidScore       = 0.45 // 值不满足格式
+	truncatedScore     = 0.9  // 只有开头部分满足格式
+	maxAlternatives    = 3
+)
+
+// Extractor 按规则从文档中提取字段，可以叠加从人工更正中学到的调整
+type Extractor struct {
+	rules  []FieldRule
+	tuning Tuning
+}
+
+// NewExtractor 创建提取器，规则的顺序决定标签同分时的归属
+func NewExtractor(rules []FieldRule) *Extractor {
+	return &Extractor{rules: rules}
+}
+
+// WithTuning 返回叠加了学习结果的提取器副本
+func (e *Extractor) WithTuning(t Tuning) *Extractor {
+	return &Extractor{rules: e.rules, tuning: t}
+}
+
+// Tuning 当前叠加的学习结果
+func (e *Extractor) Tuning() Tuning {
+	return e.tuning
+}
+
+// Rule 按名称查找规则
+func (e *Extractor) Rule(name string) (FieldRule, bool) {
+	for _, r := range e.rules {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return FieldRule{}, false
+}
+
+// Extract 提取文档中的字段。每个键值对只归属于标签得分最高的一个字段
+func (e *Extractor) Extract(doc *Document) Result {
+	candidates := make(map[string][]Candidate)
+	for _, pair := range doc.Pairs {
+		best, bestScore := -1, 0.0
+		for i, rule := range e.rules {
+			if s := e.labelScore(rule, pair.Label); s > bestScore {
+				best, bestScore = i, s
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		rule := e.rules[best]
+		value := e.clean(rule, pair.Value)
+		if value == "" {
+			continue
+		}
+		source := pair.ValueSpan
+		validation := validationScore(rule, value)
+		// 值以合法格式开头、后面跟着说明文字时只取合法部分，例如"1,250人，其中研发人员占比42%"
+		if prefix := validPrefix(rule, value); prefix != "" {
+			value, validation = prefix, truncatedScore
+			if i := strings.Index(doc.Text[source.Start:source.End], prefix); i >= 0 {
+				source = doc.span(source.Start+i, source.Start+i+len(prefix))
+			}
+		}
+		score := layoutScores[pair.Layout] * bestScore * validation
+		score *= 1 - e.tuning.penalty(rule.Name, pair.Label)
+		candidates[rule.Name] = append(candidates[rule.Name], Candidate{
+			Value:  value,
+			Label:  pair.Label,
+			Layout: pair.Layout,
+			Source: source,
+			Score:  score,
+		})
+	}
+
+	for _, rule := range e.rules {
+		if len(candidates[rule.Name]) > 0 || !rule.Search || rule.Pattern == nil {
+			continue
+		}
+		for _, m := range rule.Pattern.FindAllStringIndex(doc.Text, -1) {
+			value := e.clean(rule, doc.Text[m[0]:m[1]])
+			if value == "" {
+				continue
+			}
+			candidates[rule.Name] = append(candidates[rule.Name], Candidate{
+				Value:  value,
+				Layout: LayoutPattern,
+				Source: doc.span(m[0], m[1]),
+				Score:  layoutScores[LayoutPattern],
+			})
+		}
+	}
+
+	result := Result{Fields: make(map[string]Field), Tables: doc.Tables}
+	for _, rule := range e.rules {
+		if list := candidates[rule.Name]; len(list) > 0 {
+			result.Fields[rule.Name] = combine(rule, list)
+		}
+	}
+	return result
+}
+
+// combine 选出得分最高的值。其他候选值相同时提高置信度，不同时按竞争者的得分降低
+func combine(rule FieldRule, list []Candidate) Field {
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Score > list[j].Score })
+	best := list[0]
+	key := Normalize(best.Value)
+
+	confidence := best.Score
+	agreeing, rival := 0.0, 0.0
+	var alternatives []Candidate
+	seen := map[string]bool{key: true}
+	for _, c := range list[1:] {
+		k := Normalize(c.Value)
+		if k == key {
+			agreeing = math.Max(agreeing, c.Score)
+			continue
+		}
+		rival = math.Max(rival, c.Score)
+		if !seen[k] && len(alternatives) < maxAlternatives {
+			seen[k] = true
+			alternatives = append(alternatives, c)
+		}
+	}
+	confidence += (1 - confidence) * 0.5 * agreeing
+	confidence *= 1 - 0.5*rival/best.Score
+
+	return Field{
+		Name:         rule.Name,
+		Value:        best.Value,
+		Confidence:   math.Round(confidence*1000) / 1000,
+		Label:        best.Label,
+		Layout:       best.Layout,
+		Source:       best.Source,
+		Validated:    rule.Pattern != nil && fullMatch(rule.Pattern, best.Value),
+		Alternatives: alternatives,
+	}
+}
+
+// labelScore 文档标签与规则的匹配程度，0表示不匹配
+func (e *Extractor) labelScore(rule FieldRule, label string) float64 {
+	got := Normalize(label)
+	if got == "" {
+		return 0
+	}
+	score := 0.0
+	for _, l := range rule.Labels {
+		want := Normalize(l)
+		if got == want {
+			return 1
+		}
+		if utf8.RuneCountInString(want) >= 2 && strings.Contains(got, want) {
+			score = containsLabelScore
+		}
+	}
+	if learned := e.tuning.Labels[rule.Name][got]; learned > score {
+		score = learned
+	}
+	return score
+}
+
+func (e *Extractor) clean(rule FieldRule, value string) string {
+	value = strings.TrimSpace(value)
+	if rule.Normalize != nil {
+		value = strings.TrimSpace(rule.Normalize(value))
+	}
+	return value
+}
+
+func validationScore(rule FieldRule, value string) float64 {
+	switch {
+	case rule.Pattern == nil:
+		return unvalidatedScore
+	case fullMatch(rule.Pattern, value):
+		return 1
+	default:
+		return invalidScore
+	}
+}
+
+// validPrefix 值不完全满足格式、但开头一段满足时返回这一段
+func validPrefix(rule FieldRule, value string) string {
+	if rule.Pattern == nil || fullMatch(rule.Pattern, value) {
+		return ""
+	}
+	loc := rule.Pattern.FindStringIndex(value)
+	if loc == nil || loc[0] != 0 || loc[1] == 0 {
+		return ""
+	}
+	return strings.TrimSpace(value[:loc[1]])
+}
+
+func fullMatch(re *regexp.Regexp, value string) bool {
+	loc := re.FindStringIndex(value)
+	return loc != nil && loc[0] == 0 && loc[1] == len(value)
+}
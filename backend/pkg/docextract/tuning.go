@@ -0,0 +1,81 @@
+package docextract
+
+import "math"
+
+// Tuning 从人工更正中学到的规则调整
+type Tuning struct {
+	// Labels 字段 → 规则之外的标签及其匹配得分
+	Labels map[string]map[string]float64 `json:"labels"`
+	// Penalties 字段 → 多次提取出错误值的标签及其扣分比例
+	Penalties map[string]map[string]float64 `json:"penalties"`
+}
+
+// Correction 一次人工更正
+type Correction struct {
+	Field string `json:"field"`
+	// Label 更正后的值在文档中对应的标签，没有找到时为空
+	Label string `json:"label"`
+	// WrongLabel 被更正的原值来自的标签，原值为空或来自全文匹配时为空
+	WrongLabel string `json:"wrong_label"`
+}
+
+const (
+	learnedLabelBase = 0.6
+	learnedLabelMax  = 0.9
+	penaltyStep      = 0.25
+	penaltyMax       = 0.8
+)
+
+// Learn 汇总人工更正：同一字段的某个标签被确认至少minSupport次后成为该字段的标签，
+// 至少minSupport次提取出错误值的标签被扣分
+func Learn(corrections []Correction, minSupport int) Tuning {
+	if minSupport < 1 {
+		minSupport = 1
+	}
+	confirmed := make(map[string]map[string]int)
+	wrong := make(map[string]map[string]int)
+	for _, c := range corrections {
+		if label := Normalize(c.Label); label != "" {
+			count(confirmed, c.Field, label)
+		}
+		if label := Normalize(c.WrongLabel); label != "" && label != Normalize(c.Label) {
+			count(wrong, c.Field, label)
+		}
+	}
+
+	t := Tuning{Labels: make(map[string]map[string]float64), Penalties: make(map[string]map[string]float64)}
+	for field, labels := range confirmed {
+		for label, n := range labels {
+			if n >= minSupport {
+				set(t.Labels, field, label, math.Min(learnedLabelMax, learnedLabelBase+0.1*float64(n-minSupport)))
+			}
+		}
+	}
+	for field, labels := range wrong {
+		for label, n := range labels {
+			// 同一标签被确认的次数更多时不扣分
+			if n >= minSupport && n > confirmed[field][label] {
+				set(t.Penalties, field, label, math.Min(penaltyMax, penaltyStep*float64(n-minSupport+1)))
+			}
+		}
+	}
+	return t
+}
+
+func (t Tuning) penalty(field, label string) float64 {
+	return t.Penalties[field][Normalize(label)]
+}
+
+func count(m map[string]map[string]int, field, label string) {
+	if m[field] == nil {
+		m[field] = make(map[string]int)
+	}
+	m[field][label]++
+}
+
+func set(m map[string]map[string]float64, field, label string, v float64) {
+	if m[field] == nil {
+		m[field] = make(map[string]float64)
+	}
+	m[field][label] = v
+}
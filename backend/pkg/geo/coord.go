@@ -0,0 +1,166 @@
+// Package geo 提供坐标系转换、geohash编码和内存空间索引，供企业和职位的附近搜索共用
+package geo
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Point 经纬度坐标（度）
+type Point struct {
+	Lat float64 `json:"latitude"`
+	Lng float64 `json:"longitude"`
+}
+
+// Valid 纬度在[-90,90]、经度在[-180,180]内
+func (p Point) Valid() bool {
+	return !math.IsNaN(p.Lat) && !math.IsNaN(p.Lng) &&
+		p.Lat >= -90 && p.Lat <= 90 && p.Lng >= -180 && p.Lng <= 180
+}
+
+// CoordSystem 坐标系
+type CoordSystem string
+
+// 支持的坐标系。北斗定位使用CGCS2000，与WGS-84的差异在厘米级，按WGS-84处理；
+// 注意BD-09是百度地图的加密坐标系，与北斗无关
+const (
+	WGS84    CoordSystem = "wgs84"
+	GCJ02    CoordSystem = "gcj02"
+	BD09     CoordSystem = "bd09"
+	CGCS2000 CoordSystem = "cgcs2000"
+)
+
+// ParseCoordSystem 解析坐标系名称，空字符串视为WGS-84
+func ParseCoordSystem(name string) (CoordSystem, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "wgs84", "wgs-84", "gps":
+		return WGS84, nil
+	case "gcj02", "gcj-02", "amap", "tencent":
+		return GCJ02, nil
+	case "bd09", "bd-09", "baidu":
+		return BD09, nil
+	case "cgcs2000", "beidou", "bds":
+		return CGCS2000, nil
+	}
+	return "", fmt.Errorf("unsupported coordinate system: %s", name)
+}
+
+// ToWGS84 将坐标从指定坐标系转换为WGS-84
+func ToWGS84(p Point, from CoordSystem) Point {
+	switch from {
+	case GCJ02:
+		return GCJ02ToWGS84(p)
+	case BD09:
+		return GCJ02ToWGS84(BD09ToGCJ02(p))
+	}
+	return p
+}
+
+// FromWGS84 将WGS-84坐标转换为指定坐标系
+func FromWGS84(p Point, to CoordSystem) Point {
+	switch to {
+	case GCJ02:
+		return WGS84ToGCJ02(p)
+	case BD09:
+		return GCJ02ToBD09(WGS84ToGCJ02(p))
+	}
+	return p
+}
+
+// Convert 在任意两个坐标系之间转换
+func Convert(p Point, from, to CoordSystem) Point {
+	if from == to {
+		return p
+	}
+	return FromWGS84(ToWGS84(p, from), to)
+}
+
+// GCJ-02使用的克拉索夫斯基椭球参数
+const (
+	krasovskyA  = 6378245.0
+	krasovskyEE = 0.00669342162296594323
+	bdXPi       = math.Pi * 3000.0 / 180.0
+)
+
+// outOfChina GCJ-02只在中国境内加偏，境外坐标保持不变
+func outOfChina(p Point) bool {
+	return p.Lng < 72.004 || p.Lng > 137.8347 || p.Lat < 0.8293 || p.Lat > 55.8271
+}
+
+// WGS84ToGCJ02 WGS-84转GCJ-02（国测局坐标）
+func WGS84ToGCJ02(p Point) Point {
+	if outOfChina(p) {
+		return p
+	}
+	dLat, dLng := gcjDelta(p)
+	return Point{Lat: p.Lat + dLat, Lng: p.Lng + dLng}
+}
+
+// GCJ02ToWGS84 GCJ-02转WGS-84，迭代求逆，误差小于1e-9度
+func GCJ02ToWGS84(p Point) Point {
+	if outOfChina(p) {
+		return p
+	}
+	return invert(p, WGS84ToGCJ02)
+}
+
+// GCJ02ToBD09 GCJ-02转BD-09（百度坐标）
+func GCJ02ToBD09(p Point) Point {
+	x, y := p.Lng, p.Lat
+	z := math.Sqrt(x*x+y*y) + 0.00002*math.Sin(y*bdXPi)
+	theta := math.Atan2(y, x) + 0.000003*math.Cos(x*bdXPi)
+	return Point{Lat: z*math.Sin(theta) + 0.006, Lng: z*math.Cos(theta) + 0.0065}
+}
+
+// BD09ToGCJ02 BD-09转GCJ-02，迭代求逆
+func BD09ToGCJ02(p Point) Point {
+	return invert(p, GCJ02ToBD09)
+}
+
+// invert 求forward的逆：从target出发反复用正向变换的残差修正
+func invert(target Point, forward func(Point) Point) Point {
+	guess := target
+	for i := 0; i < 30; i++ {
+		mapped := forward(guess)
+		dLat, dLng := mapped.Lat-target.Lat, mapped.Lng-target.Lng
+		guess.Lat -= dLat
+		guess.Lng -= dLng
+		if math.Abs(dLat) < 1e-10 && math.Abs(dLng) < 1e-10 {
+			break
+		}
+	}
+	return guess
+}
+
+func gcjDelta(p Point) (float64, float64) {
+	x, y := p.Lng-105.0, p.Lat-35.0
+	dLat := -100.0 + 2.0*x + 3.0*y + 0.2*y*y + 0.1*x*y + 0.2*math.Sqrt(math.Abs(x)) +
+		(20.0*math.Sin(6.0*x*math.Pi)+20.0*math.Sin(2.0*x*math.Pi))*2.0/3.0 +
+		(20.0*math.Sin(y*math.Pi)+40.0*math.Sin(y/3.0*math.Pi))*2.0/3.0 +
+		(160.0*math.Sin(y/12.0*math.Pi)+320*math.Sin(y*math.Pi/30.0))*2.0/3.0
+	dLng := 300.0 + x + 2.0*y + 0.1*x*x + 0.1*x*y + 0.1*math.Sqrt(math.Abs(x)) +
+		(20.0*math.Sin(6.0*x*math.Pi)+20.0*math.Sin(2.0*x*math.Pi))*2.0/3.0 +
+		(20.0*math.Sin(x*math.Pi)+40.0*math.Sin(x/3.0*math.Pi))*2.0/3.0 +
+		(150.0*math.Sin(x/12.0*math.Pi)+300.0*math.Sin(x/30.0*math.Pi))*2.0/3.0
+
+	radLat := p.Lat / 180.0 * math.Pi
+	magic := math.Sin(radLat)
+	magic = 1 - krasovskyEE*magic*magic
+	sqrtMagic := math.Sqrt(magic)
+	dLat = (dLat * 180.0) / ((krasovskyA * (1 - krasovskyEE)) / (magic * sqrtMagic) * math.Pi)
+	dLng = (dLng * 180.0) / (krasovskyA / sqrtMagic * math.Cos(radLat) * math.Pi)
+	return dLat, dLng
+}
+
+// EarthRadiusKm 地球平均半径（公里）
+const EarthRadiusKm = 6371.0088
+
+// Distance 两点间的大圆距离（公里），使用haversine公式
+func Distance(a, b Point) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (b.Lng - a.Lng) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EarthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
@@ -0,0 +1,271 @@
+package geo
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestGeohashKnownValues(t *testing.T) {
+	// 参考值来自geohash的公开定义
+	if got := EncodeGeohash(Point{Lat: 42.6, Lng: -5.6}, 5); got != "ezs42" {
+		t.Fatalf("EncodeGeohash = %s, want ezs42", got)
+	}
+	if got := EncodeGeohash(Point{Lat: 57.64911, Lng: 10.40744}, 11); got != "u4pruydqqvj" {
+		t.Fatalf("EncodeGeohash = %s, want u4pruydqqvj", got)
+	}
+	box, ok := DecodeGeohash("ezs42")
+	if !ok || !box.Contains(Point{Lat: 42.6, Lng: -5.6}) {
+		t.Fatalf("DecodeGeohash(ezs42) = %+v", box)
+	}
+	if _, ok := DecodeGeohash("ezs4a"); ok {
+		t.Fatal("expected invalid geohash character to be rejected")
+	}
+}
+
+func TestCoordinateConversions(t *testing.T) {
+	// 北京天安门附近
+	wgs := Point{Lat: 39.9087, Lng: 116.3975}
+	gcj := WGS84ToGCJ02(wgs)
+	if offset := Distance(wgs, gcj) * 1000; offset < 100 || offset > 1000 {
+		t.Fatalf("GCJ-02 offset = %.1fm, want a few hundred metres", offset)
+	}
+	bd := FromWGS84(wgs, BD09)
+	if offset := Distance(gcj, bd) * 1000; offset < 500 || offset > 1500 {
+		t.Fatalf("BD-09 offset from GCJ-02 = %.1fm", offset)
+	}
+
+	for _, system := range []CoordSystem{WGS84, GCJ02, BD09, CGCS2000} {
+		back := ToWGS84(FromWGS84(wgs, system), system)
+		if d := Distance(wgs, back) * 1000; d > 0.01 {
+			t.Fatalf("%s round trip error = %.4fm", system, d)
+		}
+	}
+	if got := Convert(bd, BD09, GCJ02); Distance(got, gcj)*1000 > 0.01 {
+		t.Fatalf("BD-09 -> GCJ-02 = %+v, want %+v", got, gcj)
+	}
+
+	// 境外坐标不加偏
+	london := Point{Lat: 51.5074, Lng: -0.1278}
+	if got := WGS84ToGCJ02(london); got != london {
+		t.Fatalf("out of China point changed: %+v", got)
+	}
+
+	if _, err := ParseCoordSystem("baidu"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseCoordSystem("mercator"); err == nil {
+		t.Fatal("expected unsupported coordinate system error")
+	}
+}
+
+func TestDistance(t *testing.T) {
+	beijing := Point{Lat: 39.9042, Lng: 116.4074}
+	shanghai := Point{Lat: 31.2304, Lng: 121.4737}
+	if d := Distance(beijing, shanghai); math.Abs(d-1067) > 5 {
+		t.Fatalf("Beijing-Shanghai distance = %.1fkm, want about 1067km", d)
+	}
+}
+
+// bruteForce 全量扫描得到的期望结果
+func bruteForce(points map[uint]Point, q Query) []Hit {
+	var hits []Hit
+	for id, p := range points {
+		d := Distance(q.Center, p)
+		if q.RadiusKm > 0 && d > q.RadiusKm || q.RadiusKm <= 0 && !q.BBox.Contains(p) {
+			continue
+		}
+		if q.Filter != nil && !q.Filter(id) {
+			continue
+		}
+		hits = append(hits, Hit{ID: id, Point: p, DistanceKm: d})
+	}
+	sort.Slice(hits, func(i, j int) bool { return hitLess(hits[i], hits[j]) })
+	return hits
+}
+
+// collect 按游标翻页取出全部结果
+func collect(t *testing.T, idx *Index, q Query) []Hit {
+	t.Helper()
+	var all []Hit
+	for pages := 0; ; pages++ {
+		if pages > 1000 {
+			t.Fatal("pagination did not terminate")
+		}
+		page, err := idx.Search(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Hits) > q.Limit {
+			t.Fatalf("page has %d hits, limit %d", len(page.Hits), q.Limit)
+		}
+		all = append(all, page.Hits...)
+		if page.NextCursor == "" {
+			return all
+		}
+		q.Cursor = page.NextCursor
+	}
+}
+
+func sameHits(t *testing.T, name string, got, want []Hit) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %d hits, want %d", name, len(got), len(want))
+	}
+	for i := range want {
+		if got[i].ID != want[i].ID {
+			t.Fatalf("%s: hit %d is %d (%.3fkm), want %d (%.3fkm)", name, i, got[i].ID, got[i].DistanceKm, want[i].ID, want[i].DistanceKm)
+		}
+	}
+}
+
+func TestIndexMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	idx := NewIndex()
+	points := make(map[uint]Point)
+	// 以上海为中心约100km范围内的点，加上少量分布在全球的点
+	for id := uint(1); id <= 3000; id++ {
+		p := Point{Lat: 31.23 + (rng.Float64()-0.5)*2, Lng: 121.47 + (rng.Float64()-0.5)*2}
+		if id%10 == 0 {
+			p = Point{Lat: (rng.Float64() - 0.5) * 170, Lng: (rng.Float64() - 0.5) * 360}
+		}
+		points[id] = p
+		if err := idx.Upsert(id, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 移动和删除一部分点
+	for id := uint(1); id <= 300; id++ {
+		if id%2 == 0 {
+			idx.Remove(id)
+			delete(points, id)
+		} else {
+			p := Point{Lat: 31.23 + (rng.Float64()-0.5)*0.1, Lng: 121.47 + (rng.Float64()-0.5)*0.1}
+			points[id] = p
+			idx.Upsert(id, p)
+		}
+	}
+	if idx.Len() != len(points) {
+		t.Fatalf("index has %d points, want %d", idx.Len(), len(points))
+	}
+
+	center := Point{Lat: 31.23, Lng: 121.47}
+	for _, radius := range []float64{0.5, 3, 15, 60, 5000} {
+		q := Query{Center: center, RadiusKm: radius, Limit: 37}
+		sameHits(t, "radius", collect(t, idx, q), bruteForce(points, q))
+	}
+
+	odd := func(id uint) bool { return id%2 == 1 }
+	q := Query{Center: center, RadiusKm: 20, Limit: 50, Filter: odd}
+	sameHits(t, "filtered", collect(t, idx, q), bruteForce(points, q))
+
+	box := BBox{MinLat: 31.0, MinLng: 121.2, MaxLat: 31.4, MaxLng: 121.6}
+	q = Query{Center: box.Center(), BBox: &box, Limit: 100}
+	sameHits(t, "bbox", collect(t, idx, q), bruteForce(points, q))
+}
+
+func TestIndexAntimeridianAndPoles(t *testing.T) {
+	idx := NewIndex()
+	points := map[uint]Point{
+		1: {Lat: -17.7, Lng: 179.9},
+		2: {Lat: -17.7, Lng: -179.9},
+		3: {Lat: -17.7, Lng: 178.0},
+		4: {Lat: 89.9, Lng: 10},
+		5: {Lat: 89.9, Lng: -170},
+	}
+	for id, p := range points {
+		idx.Upsert(id, p)
+	}
+
+	q := Query{Center: Point{Lat: -17.7, Lng: 179.95}, RadiusKm: 50, Limit: 10}
+	sameHits(t, "antimeridian radius", collect(t, idx, q), bruteForce(points, q))
+
+	box := BBox{MinLat: -18, MinLng: 179.5, MaxLat: -17, MaxLng: -179.5}
+	q = Query{Center: box.Center(), BBox: &box, Limit: 10}
+	got := collect(t, idx, q)
+	if len(got) != 2 {
+		t.Fatalf("antimeridian bbox returned %d hits, want 2", len(got))
+	}
+
+	q = Query{Center: Point{Lat: 90, Lng: 0}, RadiusKm: 50, Limit: 10}
+	sameHits(t, "polar radius", collect(t, idx, q), bruteForce(points, q))
+}
+
+func TestIndexCursorIsStableAcrossInserts(t *testing.T) {
+	idx := NewIndex()
+	center := Point{Lat: 22.54, Lng: 114.06}
+	for id := uint(1); id <= 10; id++ {
+		idx.Upsert(id, Point{Lat: center.Lat + float64(id)*0.01, Lng: center.Lng})
+	}
+	first, err := idx.Search(Query{Center: center, RadiusKm: 50, Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 翻页前插入一个更近的点，不应影响第二页
+	idx.Upsert(100, center)
+	second, err := idx.Search(Query{Center: center, RadiusKm: 50, Limit: 5, Cursor: first.NextCursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Hits[0].ID != 6 || second.NextCursor != "" {
+		t.Fatalf("second page starts at %d (next %q), want 6 and no more pages", second.Hits[0].ID, second.NextCursor)
+	}
+
+	if _, err := idx.Search(Query{Center: center, RadiusKm: 1, Cursor: "%%%"}); err != ErrInvalidCursor {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+type fakeSource struct {
+	all     []Record
+	changed []Record
+	since   time.Time
+}
+
+func (s *fakeSource) LoadAll(ctx context.Context) ([]Record, error) { return s.all, nil }
+
+func (s *fakeSource) LoadChanged(ctx context.Context, since time.Time) ([]Record, error) {
+	s.since = since
+	return s.changed, nil
+}
+
+func TestSyncer(t *testing.T) {
+	a, b := Point{Lat: 30, Lng: 120}, Point{Lat: 30.01, Lng: 120}
+	source := &fakeSource{all: []Record{
+		{ID: 1, Point: &a, Active: true},
+		{ID: 2, Point: &b, Active: true},
+		{ID: 3, Point: nil, Active: true},
+		{ID: 4, Point: &a, Active: false},
+	}}
+	idx := NewIndex()
+	syncer := NewSyncer(idx, source)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	t.Cleanup(func() { timeNow = time.Now })
+
+	// 首次Refresh执行全量加载
+	if err := syncer.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if idx.Len() != 2 {
+		t.Fatalf("index has %d points after rebuild, want 2", idx.Len())
+	}
+
+	source.changed = []Record{{ID: 1, Active: false}, {ID: 3, Point: &b, Active: true}}
+	now = now.Add(time.Minute)
+	if err := syncer.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := now.Add(-time.Minute - syncOverlap); !source.since.Equal(want) {
+		t.Fatalf("incremental sync since %v, want %v", source.since, want)
+	}
+	if _, ok := idx.Get(1); ok {
+		t.Fatal("inactive record should be removed")
+	}
+	if _, ok := idx.Get(3); !ok {
+		t.Fatal("changed record should be indexed")
+	}
+}
@@ -0,0 +1,216 @@
+package geo
+
+import (
+	"math"
+	"strings"
+)
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// MaxGeohashPrecision 支持的最大geohash长度
+const MaxGeohashPrecision = 12
+
+// BBox 经纬度矩形。MinLng大于MaxLng时表示跨越180度经线
+type BBox struct {
+	MinLat float64 `json:"min_latitude"`
+	MinLng float64 `json:"min_longitude"`
+	MaxLat float64 `json:"max_latitude"`
+	MaxLng float64 `json:"max_longitude"`
+}
+
+// Valid 坐标范围合法且MinLat不大于MaxLat
+func (b BBox) Valid() bool {
+	return Point{b.MinLat, b.MinLng}.Valid() && Point{b.MaxLat, b.MaxLng}.Valid() && b.MinLat <= b.MaxLat
+}
+
+// Contains 点是否在矩形内（含边界）
+func (b BBox) Contains(p Point) bool {
+	if p.Lat < b.MinLat || p.Lat > b.MaxLat {
+		return false
+	}
+	if b.MinLng <= b.MaxLng {
+		return p.Lng >= b.MinLng && p.Lng <= b.MaxLng
+	}
+	return p.Lng >= b.MinLng || p.Lng <= b.MaxLng
+}
+
+// Center 矩形中心
+func (b BBox) Center() Point {
+	lng := (b.MinLng + b.MaxLng) / 2
+	if b.MinLng > b.MaxLng {
+		lng = normalizeLng((b.MinLng + b.MaxLng + 360) / 2)
+	}
+	return Point{Lat: (b.MinLat + b.MaxLat) / 2, Lng: lng}
+}
+
+// split 跨越180度经线的矩形拆成两个
+func (b BBox) split() []BBox {
+	if b.MinLng <= b.MaxLng {
+		return []BBox{b}
+	}
+	return []BBox{
+		{MinLat: b.MinLat, MinLng: b.MinLng, MaxLat: b.MaxLat, MaxLng: 180},
+		{MinLat: b.MinLat, MinLng: -180, MaxLat: b.MaxLat, MaxLng: b.MaxLng},
+	}
+}
+
+// RadiusBBox 包含以center为圆心、radiusKm为半径的圆的最小经纬度矩形
+func RadiusBBox(center Point, radiusKm float64) BBox {
+	dLat := radiusKm / EarthRadiusKm * 180 / math.Pi
+	box := BBox{
+		MinLat: math.Max(-90, center.Lat-dLat),
+		MaxLat: math.Min(90, center.Lat+dLat),
+	}
+	// 圆覆盖极点时经度不受限
+	if box.MinLat == -90 || box.MaxLat == 90 {
+		box.MinLng, box.MaxLng = -180, 180
+		return box
+	}
+	// 圆上经度跨度最大的点所在纬度处的经度半宽
+	ratio := math.Sin(radiusKm/EarthRadiusKm) / math.Cos(center.Lat*math.Pi/180)
+	if ratio >= 1 {
+		box.MinLng, box.MaxLng = -180, 180
+		return box
+	}
+	dLng := math.Asin(ratio) * 180 / math.Pi
+	box.MinLng = normalizeLng(center.Lng - dLng)
+	box.MaxLng = normalizeLng(center.Lng + dLng)
+	return box
+}
+
+func normalizeLng(lng float64) float64 {
+	for lng > 180 {
+		lng -= 360
+	}
+	for lng < -180 {
+		lng += 360
+	}
+	return lng
+}
+
+// EncodeGeohash 计算指定长度的geohash
+func EncodeGeohash(p Point, precision int) string {
+	if precision < 1 {
+		precision = 1
+	}
+	if precision > MaxGeohashPrecision {
+		precision = MaxGeohashPrecision
+	}
+	latRange := [2]float64{-90, 90}
+	lngRange := [2]float64{-180, 180}
+	var b strings.Builder
+	b.Grow(precision)
+	bit, ch, even := 0, 0, true
+	for b.Len() < precision {
+		if even {
+			mid := (lngRange[0] + lngRange[1]) / 2
+			if p.Lng >= mid {
+				ch |= 1 << (4 - bit)
+				lngRange[0] = mid
+			} else {
+				lngRange[1] = mid
+			}
+		} else {
+			mid := (latRange[0] + latRange[1]) / 2
+			if p.Lat >= mid {
+				ch |= 1 << (4 - bit)
+				latRange[0] = mid
+			} else {
+				latRange[1] = mid
+			}
+		}
+		even = !even
+		if bit < 4 {
+			bit++
+		} else {
+			b.WriteByte(geohashAlphabet[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return b.String()
+}
+
+// DecodeGeohash 返回geohash对应的矩形，非法字符返回false
+func DecodeGeohash(hash string) (BBox, bool) {
+	box := BBox{MinLat: -90, MaxLat: 90, MinLng: -180, MaxLng: 180}
+	even := true
+	for i := 0; i < len(hash); i++ {
+		idx := strings.IndexByte(geohashAlphabet, hash[i])
+		if idx < 0 {
+			return BBox{}, false
+		}
+		for bit := 4; bit >= 0; bit-- {
+			on := idx&(1<<bit) != 0
+			if even {
+				mid := (box.MinLng + box.MaxLng) / 2
+				if on {
+					box.MinLng = mid
+				} else {
+					box.MaxLng = mid
+				}
+			} else {
+				mid := (box.MinLat + box.MaxLat) / 2
+				if on {
+					box.MinLat = mid
+				} else {
+					box.MaxLat = mid
+				}
+			}
+			even = !even
+		}
+	}
+	return box, true
+}
+
+// cellSize 指定长度的geohash单元的高和宽（度）
+func cellSize(precision int) (float64, float64) {
+	bits := 5 * precision
+	lngBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / math.Pow(2, float64(latBits)), 360 / math.Pow(2, float64(lngBits))
+}
+
+// coverCount 用指定长度的单元覆盖矩形所需的单元数（上界）
+func coverCount(box BBox, precision int) int {
+	h, w := cellSize(precision)
+	total := 0
+	for _, part := range box.split() {
+		rows := math.Floor(part.MaxLat/h) - math.Floor(part.MinLat/h) + 1
+		cols := math.Floor(part.MaxLng/w) - math.Floor(part.MinLng/w) + 1
+		n := rows * cols
+		if n > math.MaxInt32 {
+			return math.MaxInt32
+		}
+		total += int(n)
+	}
+	return total
+}
+
+// CoverBBox 返回覆盖矩形的geohash单元。选择单元数不超过maxCells的最大长度（不超过maxPrecision）
+func CoverBBox(box BBox, maxPrecision, maxCells int) []string {
+	precision := 1
+	for p := maxPrecision; p > 1; p-- {
+		if coverCount(box, p) <= maxCells {
+			precision = p
+			break
+		}
+	}
+
+	h, w := cellSize(precision)
+	seen := make(map[string]struct{})
+	var cells []string
+	for _, part := range box.split() {
+		for lat := math.Floor(part.MinLat/h) * h; lat <= part.MaxLat; lat += h {
+			for lng := math.Floor(part.MinLng/w) * w; lng <= part.MaxLng; lng += w {
+				// 取单元中心编码，避免边界上的浮点误差落入相邻单元
+				center := Point{Lat: math.Min(90, lat+h/2), Lng: math.Min(180, lng+w/2)}
+				cell := EncodeGeohash(center, precision)
+				if _, ok := seen[cell]; !ok {
+					seen[cell] = struct{}{}
+					cells = append(cells, cell)
+				}
+			}
+		}
+	}
+	return cells
+}
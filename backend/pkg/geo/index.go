@@ -0,0 +1,233 @@
+package geo
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// indexPrecision 索引中保存的最长geohash，6位单元约1.2km×0.6km
+const indexPrecision = 6
+
+// 一次查询最多扫描的geohash单元数
+const maxQueryCells = 32
+
+// ErrInvalidCursor 分页游标无法解析
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Index 基于geohash的内存空间索引，按1~6位前缀分桶，支持半径和矩形查询并按距离排序。
+// 并发安全
+type Index struct {
+	mu      sync.RWMutex
+	points  map[uint]Point
+	buckets [indexPrecision + 1]map[string]map[uint]struct{}
+}
+
+// NewIndex 创建空索引
+func NewIndex() *Index {
+	idx := &Index{points: make(map[uint]Point)}
+	for p := 1; p <= indexPrecision; p++ {
+		idx.buckets[p] = make(map[string]map[uint]struct{})
+	}
+	return idx
+}
+
+// Len 索引中的点数
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.points)
+}
+
+// Get 读取点的坐标（WGS-84）
+func (idx *Index) Get(id uint) (Point, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	p, ok := idx.points[id]
+	return p, ok
+}
+
+// Upsert 添加或移动一个点，坐标须为WGS-84
+func (idx *Index) Upsert(id uint, p Point) error {
+	if !p.Valid() {
+		return fmt.Errorf("invalid coordinate %v,%v", p.Lat, p.Lng)
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(id)
+	idx.points[id] = p
+	hash := EncodeGeohash(p, indexPrecision)
+	for prec := 1; prec <= indexPrecision; prec++ {
+		bucket := idx.buckets[prec][hash[:prec]]
+		if bucket == nil {
+			bucket = make(map[uint]struct{})
+			idx.buckets[prec][hash[:prec]] = bucket
+		}
+		bucket[id] = struct{}{}
+	}
+	return nil
+}
+
+// Remove 删除一个点
+func (idx *Index) Remove(id uint) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(id)
+}
+
+func (idx *Index) removeLocked(id uint) {
+	p, ok := idx.points[id]
+	if !ok {
+		return
+	}
+	delete(idx.points, id)
+	hash := EncodeGeohash(p, indexPrecision)
+	for prec := 1; prec <= indexPrecision; prec++ {
+		bucket := idx.buckets[prec][hash[:prec]]
+		delete(bucket, id)
+		if len(bucket) == 0 {
+			delete(idx.buckets[prec], hash[:prec])
+		}
+	}
+}
+
+// Replace 用给定的点整体替换索引内容
+func (idx *Index) Replace(points map[uint]Point) {
+	fresh := NewIndex()
+	for id, p := range points {
+		// 非法坐标直接跳过，与Upsert一致
+		_ = fresh.Upsert(id, p)
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.points = fresh.points
+	idx.buckets = fresh.buckets
+}
+
+// Query 空间查询条件。设置RadiusKm时为半径查询，否则按BBox查询；
+// 结果按到Center的距离升序、距离相同时按ID升序排列
+type Query struct {
+	Center   Point
+	RadiusKm float64
+	BBox     *BBox
+	// Filter 返回false的点被排除，在索引读锁内调用，不能再访问索引
+	Filter func(id uint) bool
+	Cursor string
+	Limit  int
+}
+
+// Hit 查询结果
+type Hit struct {
+	ID         uint    `json:"id"`
+	Point      Point   `json:"point"`
+	DistanceKm float64 `json:"distance_km"`
+}
+
+// Page 一页结果，NextCursor为空表示没有更多
+type Page struct {
+	Hits       []Hit  `json:"hits"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Search 执行查询。游标记录上一页最后一条的(距离, ID)，翻页期间索引变化不会导致重复或遗漏已排在前面的点
+func (idx *Index) Search(q Query) (*Page, error) {
+	var box BBox
+	switch {
+	case q.RadiusKm > 0:
+		box = RadiusBBox(q.Center, q.RadiusKm)
+	case q.BBox != nil:
+		box = *q.BBox
+	default:
+		return nil, errors.New("radius or bounding box is required")
+	}
+	if !q.Center.Valid() || !box.Valid() {
+		return nil, errors.New("invalid coordinates")
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	after, hasCursor, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	cells := CoverBBox(box, indexPrecision, maxQueryCells)
+	prec := len(cells[0])
+
+	idx.mu.RLock()
+	var hits []Hit
+	for _, cell := range cells {
+		for id := range idx.buckets[prec][cell] {
+			p := idx.points[id]
+			if q.RadiusKm <= 0 && !box.Contains(p) {
+				continue
+			}
+			d := Distance(q.Center, p)
+			if q.RadiusKm > 0 && d > q.RadiusKm {
+				continue
+			}
+			hit := Hit{ID: id, Point: p, DistanceKm: d}
+			if hasCursor && !hitAfter(hit, after) {
+				continue
+			}
+			if q.Filter != nil && !q.Filter(id) {
+				continue
+			}
+			hits = append(hits, hit)
+		}
+	}
+	idx.mu.RUnlock()
+
+	sort.Slice(hits, func(i, j int) bool { return hitLess(hits[i], hits[j]) })
+	page := &Page{Hits: hits}
+	if len(hits) > limit {
+		page.Hits = hits[:limit]
+		page.NextCursor = encodeCursor(page.Hits[limit-1])
+	}
+	return page, nil
+}
+
+func hitLess(a, b Hit) bool {
+	if a.DistanceKm != b.DistanceKm {
+		return a.DistanceKm < b.DistanceKm
+	}
+	return a.ID < b.ID
+}
+
+func hitAfter(h Hit, cursor Hit) bool {
+	return hitLess(cursor, h)
+}
+
+// 游标格式：base64url("距离:ID")，距离以最短可逆形式保存
+func encodeCursor(h Hit) string {
+	raw := strconv.FormatFloat(h.DistanceKm, 'g', -1, 64) + ":" + strconv.FormatUint(uint64(h.ID), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (Hit, bool, error) {
+	if cursor == "" {
+		return Hit{}, false, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return Hit{}, false, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return Hit{}, false, ErrInvalidCursor
+	}
+	d, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return Hit{}, false, ErrInvalidCursor
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return Hit{}, false, ErrInvalidCursor
+	}
+	return Hit{ID: uint(id), DistanceKm: d}, true, nil
+}
@@ -0,0 +1,124 @@
+package geo
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Record 数据源中的一条位置记录，坐标须已转换为WGS-84。
+// Active为false或坐标为空时从索引中移除
+type Record struct {
+	ID     uint
+	Point  *Point
+	Active bool
+}
+
+// Source 索引的数据源
+type Source interface {
+	// LoadAll 读取全部可索引的记录
+	LoadAll(ctx context.Context) ([]Record, error)
+	// LoadChanged 读取since之后变化的记录，包括失效的记录
+	LoadChanged(ctx context.Context, since time.Time) ([]Record, error)
+}
+
+// syncOverlap 增量同步的时间窗口向前重叠，容忍数据库与本机的时钟误差和未提交的事务
+const syncOverlap = 5 * time.Second
+
+// timeNow 取当前时间，测试中替换为固定时钟
+var timeNow = time.Now
+
+// Syncer 将数据源同步到索引：启动时全量加载，之后定期增量同步并定期全量重建
+// （增量同步无法发现被物理删除的记录）
+type Syncer struct {
+	index  *Index
+	source Source
+
+	mu       sync.Mutex
+	lastSync time.Time
+}
+
+// NewSyncer 创建同步器
+func NewSyncer(index *Index, source Source) *Syncer {
+	return &Syncer{index: index, source: source}
+}
+
+// Rebuild 全量重建索引
+func (s *Syncer) Rebuild(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	started := timeNow()
+	records, err := s.source.LoadAll(ctx)
+	if err != nil {
+		return err
+	}
+	points := make(map[uint]Point, len(records))
+	for _, r := range records {
+		if r.Active && r.Point != nil {
+			points[r.ID] = *r.Point
+		}
+	}
+	s.index.Replace(points)
+	s.lastSync = started
+	return nil
+}
+
+// Refresh 增量同步上次同步之后变化的记录，尚未全量加载时执行全量重建
+func (s *Syncer) Refresh(ctx context.Context) error {
+	s.mu.Lock()
+	if s.lastSync.IsZero() {
+		s.mu.Unlock()
+		return s.Rebuild(ctx)
+	}
+	defer s.mu.Unlock()
+	started := timeNow()
+	records, err := s.source.LoadChanged(ctx, s.lastSync.Add(-syncOverlap))
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		s.Apply(r)
+	}
+	s.lastSync = started
+	return nil
+}
+
+// Apply 立即应用一条记录，供业务写入后同步调用
+func (s *Syncer) Apply(r Record) {
+	if !r.Active || r.Point == nil {
+		s.index.Remove(r.ID)
+		return
+	}
+	if err := s.index.Upsert(r.ID, *r.Point); err != nil {
+		log.Printf("空间索引忽略记录%d: %v", r.ID, err)
+		s.index.Remove(r.ID)
+	}
+}
+
+// Run 启动同步循环，直到ctx取消
+func (s *Syncer) Run(ctx context.Context, refreshInterval, rebuildInterval time.Duration) {
+	if err := s.Rebuild(ctx); err != nil {
+		log.Printf("空间索引加载失败: %v", err)
+	}
+	go func() {
+		refresh := time.NewTicker(refreshInterval)
+		rebuild := time.NewTicker(rebuildInterval)
+		defer refresh.Stop()
+		defer rebuild.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-refresh.C:
+				if err := s.Refresh(ctx); err != nil {
+					log.Printf("空间索引增量同步失败: %v", err)
+				}
+			case <-rebuild.C:
+				if err := s.Rebuild(ctx); err != nil {
+					log.Printf("空间索引重建失败: %v", err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,185 @@
+package graph
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// 中心性指标
+const (
+	MetricDegree      = "degree"
+	MetricPageRank    = "pagerank"
+	MetricBetweenness = "betweenness"
+)
+
+// PageRank参数
+const (
+	pageRankDamping    = 0.85
+	pageRankTolerance  = 1e-9
+	pageRankIterations = 100
+)
+
+// Centrality 节点的中心性指标
+type Centrality struct {
+	Node        Node    `json:"node"`
+	Degree      float64 `json:"degree"`      // 加权度，除以最大加权度归一化到0~1
+	PageRank    float64 `json:"pagerank"`    // 沿边的方向计算，合计为1
+	Betweenness float64 `json:"betweenness"` // 无向图上的介数，归一化到0~1
+}
+
+// ParseMetric 解析中心性指标，空字符串为pagerank
+func ParseMetric(name string) (string, error) {
+	switch name {
+	case "":
+		return MetricPageRank, nil
+	case MetricDegree, MetricPageRank, MetricBetweenness:
+		return name, nil
+	}
+	return "", fmt.Errorf("unsupported centrality metric %q", name)
+}
+
+// Centralities 计算所有节点的中心性并按metric降序排列
+func (g *Graph) Centralities(metric string) []Centrality {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	adj := g.undirectedWeights()
+	ids := sortedIDs(adj)
+	pageRank := g.pageRank(ids)
+	betweenness := betweenness(adj, ids)
+
+	var maxDegree float64
+	degrees := make(map[uint]float64, len(ids))
+	for _, id := range ids {
+		for _, w := range adj[id] {
+			degrees[id] += w
+		}
+		maxDegree = math.Max(maxDegree, degrees[id])
+	}
+
+	result := make([]Centrality, len(ids))
+	for i, id := range ids {
+		result[i] = Centrality{Node: g.nodes[id], PageRank: pageRank[id], Betweenness: betweenness[id]}
+		if maxDegree > 0 {
+			result[i].Degree = degrees[id] / maxDegree
+		}
+	}
+	value := func(c Centrality) float64 {
+		switch metric {
+		case MetricDegree:
+			return c.Degree
+		case MetricBetweenness:
+			return c.Betweenness
+		}
+		return c.PageRank
+	}
+	sort.SliceStable(result, func(i, j int) bool { return value(result[i]) > value(result[j]) })
+	return result
+}
+
+// pageRank 加权PageRank，无出边的节点把分值平均分给所有节点
+func (g *Graph) pageRank(ids []uint) map[uint]float64 {
+	n := float64(len(ids))
+	rank := make(map[uint]float64, len(ids))
+	if n == 0 {
+		return rank
+	}
+	outWeight := make(map[uint]float64, len(ids))
+	for _, id := range ids {
+		rank[id] = 1 / n
+		for key, e := range g.out[id] {
+			if key.peer != id {
+				outWeight[id] += edgeWeight(e)
+			}
+		}
+	}
+	for iter := 0; iter < pageRankIterations; iter++ {
+		var dangling float64
+		for _, id := range ids {
+			if outWeight[id] == 0 {
+				dangling += rank[id]
+			}
+		}
+		next := make(map[uint]float64, len(ids))
+		base := (1-pageRankDamping)/n + pageRankDamping*dangling/n
+		for _, id := range ids {
+			next[id] += base
+			if outWeight[id] == 0 {
+				continue
+			}
+			for key, e := range g.out[id] {
+				if key.peer != id {
+					next[key.peer] += pageRankDamping * rank[id] * edgeWeight(e) / outWeight[id]
+				}
+			}
+		}
+		var delta float64
+		for _, id := range ids {
+			delta += math.Abs(next[id] - rank[id])
+		}
+		rank = next
+		if delta < pageRankTolerance {
+			break
+		}
+	}
+	return rank
+}
+
+// betweenness Brandes算法计算无向无权介数，除以(n-1)(n-2)/2归一化
+func betweenness(adj map[uint]map[uint]float64, ids []uint) map[uint]float64 {
+	result := make(map[uint]float64, len(ids))
+	neighbors := make(map[uint][]uint, len(ids))
+	for _, id := range ids {
+		neighbors[id] = sortedPeers(adj[id])
+	}
+	for _, s := range ids {
+		var stack []uint
+		preds := make(map[uint][]uint)
+		sigma := map[uint]float64{s: 1}
+		dist := map[uint]int{s: 0}
+		queue := []uint{s}
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			stack = append(stack, v)
+			for _, w := range neighbors[v] {
+				if _, ok := dist[w]; !ok {
+					dist[w] = dist[v] + 1
+					queue = append(queue, w)
+				}
+				if dist[w] == dist[v]+1 {
+					sigma[w] += sigma[v]
+					preds[w] = append(preds[w], v)
+				}
+			}
+		}
+		delta := make(map[uint]float64)
+		for i := len(stack) - 1; i >= 0; i-- {
+			w := stack[i]
+			for _, v := range preds[w] {
+				delta[v] += sigma[v] / sigma[w] * (1 + delta[w])
+			}
+			if w != s {
+				result[w] += delta[w]
+			}
+		}
+	}
+	// 无向图中每条最短路径被两端各统计一次
+	n := float64(len(ids))
+	for id := range result {
+		result[id] /= 2
+		if n > 2 {
+			result[id] /= (n - 1) * (n - 2) / 2
+		}
+	}
+	return result
+}
+
+func sortedPeers(peers map[uint]float64) []uint {
+	ids := make([]uint, 0, len(peers))
+	for id := range peers {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,117 @@
+package graph
+
+import "sort"
+
+// maxLabelPropagationRounds 标签传播的最大轮数，通常几轮内即收敛
+const maxLabelPropagationRounds = 50
+
+// Community 一个社区（紧密关联的企业群）
+type Community struct {
+	ID      int     `json:"id"`
+	Members []Node  `json:"members"`
+	Weight  float64 `json:"internal_weight"` // 社区内部边的权重之和
+}
+
+// CommunityResult 社区发现结果
+type CommunityResult struct {
+	Communities []Community `json:"communities"`
+	Modularity  float64     `json:"modularity"`
+}
+
+// Communities 把图视为无向带权图，用标签传播划分社区。
+// 节点按ID顺序异步更新、平局取最小标签，结果是确定的；社区按规模降序编号
+func (g *Graph) Communities() CommunityResult {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	adj := g.undirectedWeights()
+	ids := sortedIDs(adj)
+
+	labels := make(map[uint]uint, len(ids))
+	for _, id := range ids {
+		labels[id] = id
+	}
+	for round := 0; round < maxLabelPropagationRounds; round++ {
+		changed := false
+		for _, id := range ids {
+			if len(adj[id]) == 0 {
+				continue
+			}
+			votes := make(map[uint]float64)
+			for peer, w := range adj[id] {
+				votes[labels[peer]] += w
+			}
+			best, bestVote := labels[id], votes[labels[id]]
+			for label, vote := range votes {
+				if vote > bestVote || vote == bestVote && label < best {
+					best, bestVote = label, vote
+				}
+			}
+			if best != labels[id] {
+				labels[id] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	groups := make(map[uint][]uint)
+	for _, id := range ids {
+		groups[labels[id]] = append(groups[labels[id]], id)
+	}
+	communities := make([]Community, 0, len(groups))
+	for _, members := range groups {
+		c := Community{Members: make([]Node, len(members))}
+		for i, id := range members {
+			c.Members[i] = g.nodes[id]
+			for peer, w := range adj[id] {
+				if labels[peer] == labels[id] && peer > id {
+					c.Weight += w
+				}
+			}
+		}
+		communities = append(communities, c)
+	}
+	sort.Slice(communities, func(i, j int) bool {
+		if len(communities[i].Members) != len(communities[j].Members) {
+			return len(communities[i].Members) > len(communities[j].Members)
+		}
+		return communities[i].Members[0].ID < communities[j].Members[0].ID
+	})
+	for i := range communities {
+		communities[i].ID = i + 1
+	}
+	return CommunityResult{Communities: communities, Modularity: modularity(adj, labels)}
+}
+
+// modularity 计算划分的模块度Q，取值-0.5~1，越大说明社区内部联系越紧密
+func modularity(adj map[uint]map[uint]float64, labels map[uint]uint) float64 {
+	var total float64
+	degree := make(map[uint]float64, len(adj))
+	for id, peers := range adj {
+		for _, w := range peers {
+			degree[id] += w
+			total += w
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	// total是2m
+	var internal float64
+	labelDegree := make(map[uint]float64)
+	for id, peers := range adj {
+		labelDegree[labels[id]] += degree[id]
+		for peer, w := range peers {
+			if labels[peer] == labels[id] {
+				internal += w
+			}
+		}
+	}
+	q := internal / total
+	for _, d := range labelDegree {
+		q -= (d / total) * (d / total)
+	}
+	return q
+}
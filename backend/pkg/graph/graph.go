@@ -0,0 +1,298 @@
+package graph
+
+import (
+	"sort"
+	"sync"
+)
+
+// Node 图中的企业节点
+type Node struct {
+	ID       uint   `json:"id"`
+	Name     string `json:"name"`
+	Industry string `json:"industry,omitempty"`
+}
+
+// Edge 有向带权关系边，同一对节点之间每种类型最多一条
+type Edge struct {
+	From   uint    `json:"from"`
+	To     uint    `json:"to"`
+	Type   string  `json:"type"`
+	Weight float64 `json:"weight"`
+}
+
+// Direction 沿边遍历的方向
+type Direction int
+
+const (
+	// Both 忽略边的方向
+	Both Direction = iota
+	// Outgoing 只沿出边
+	Outgoing
+	// Incoming 只沿入边
+	Incoming
+)
+
+// Filter 遍历时可以经过的边
+type Filter struct {
+	Types     []string  // 为空时不限类型
+	Direction Direction // 默认Both
+}
+
+func (f Filter) allows(edgeType string) bool {
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if t == edgeType {
+			return true
+		}
+	}
+	return false
+}
+
+type edgeKey struct {
+	peer uint
+	typ  string
+}
+
+// Graph 内存中的企业关系图。并发安全
+type Graph struct {
+	mu    sync.RWMutex
+	nodes map[uint]Node
+	out   map[uint]map[edgeKey]Edge
+	in    map[uint]map[edgeKey]Edge
+}
+
+// New 创建空图
+func New() *Graph {
+	return &Graph{
+		nodes: make(map[uint]Node),
+		out:   make(map[uint]map[edgeKey]Edge),
+		in:    make(map[uint]map[edgeKey]Edge),
+	}
+}
+
+// Len 节点数
+func (g *Graph) Len() int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return len(g.nodes)
+}
+
+// AddNode 添加或更新节点，已有的边保持不变
+func (g *Graph) AddNode(n Node) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.nodes[n.ID] = n
+}
+
+// RemoveNode 删除节点及其所有边
+func (g *Graph) RemoveNode(id uint) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for key := range g.out[id] {
+		delete(g.in[key.peer], edgeKey{peer: id, typ: key.typ})
+	}
+	for key := range g.in[id] {
+		delete(g.out[key.peer], edgeKey{peer: id, typ: key.typ})
+	}
+	delete(g.out, id)
+	delete(g.in, id)
+	delete(g.nodes, id)
+}
+
+// AddEdge 添加或更新边，端点不存在时自动创建只有ID的节点
+func (g *Graph) AddEdge(e Edge) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.addEdgeLocked(e)
+}
+
+func (g *Graph) addEdgeLocked(e Edge) {
+	for _, id := range []uint{e.From, e.To} {
+		if _, ok := g.nodes[id]; !ok {
+			g.nodes[id] = Node{ID: id}
+		}
+	}
+	if g.out[e.From] == nil {
+		g.out[e.From] = make(map[edgeKey]Edge)
+	}
+	if g.in[e.To] == nil {
+		g.in[e.To] = make(map[edgeKey]Edge)
+	}
+	g.out[e.From][edgeKey{peer: e.To, typ: e.Type}] = e
+	g.in[e.To][edgeKey{peer: e.From, typ: e.Type}] = e
+}
+
+// RemoveEdge 删除一条边
+func (g *Graph) RemoveEdge(from, to uint, edgeType string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.out[from], edgeKey{peer: to, typ: edgeType})
+	delete(g.in[to], edgeKey{peer: from, typ: edgeType})
+}
+
+// Node 读取节点
+func (g *Graph) Node(id uint) (Node, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	n, ok := g.nodes[id]
+	return n, ok
+}
+
+// Nodes 按ID升序返回全部节点
+func (g *Graph) Nodes() []Node {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	nodes := make([]Node, 0, len(g.nodes))
+	for _, n := range g.nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// Edges 按起点、终点、类型排序返回全部边
+func (g *Graph) Edges() []Edge {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	var edges []Edge
+	for _, m := range g.out {
+		for _, e := range m {
+			edges = append(edges, e)
+		}
+	}
+	sortEdges(edges)
+	return edges
+}
+
+// Subgraph 复制给定节点及它们之间的边
+func (g *Graph) Subgraph(ids []uint) *Graph {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	sub := New()
+	keep := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		if n, ok := g.nodes[id]; ok {
+			keep[id] = true
+			sub.nodes[id] = n
+		}
+	}
+	for id := range keep {
+		for key, e := range g.out[id] {
+			if keep[key.peer] {
+				sub.addEdgeLocked(e)
+			}
+		}
+	}
+	return sub
+}
+
+// Neighborhood 返回距离start在depth跳以内（沿filter允许的边）的子图，start不存在时返回空图
+func (g *Graph) Neighborhood(start uint, depth int, filter Filter) *Graph {
+	reached := g.Traverse(start, depth, filter)
+	if _, ok := g.Node(start); !ok {
+		return New()
+	}
+	ids := []uint{start}
+	for _, r := range reached {
+		ids = append(ids, r.Node.ID)
+	}
+	return g.Subgraph(ids)
+}
+
+// EdgesOf 返回节点沿filter可走的边，保持原始方向，按对端ID和类型排序
+func (g *Graph) EdgesOf(id uint, filter Filter) []Edge {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	steps := g.steps(id, filter)
+	edges := make([]Edge, len(steps))
+	for i, s := range steps {
+		edges[i] = s.edge
+	}
+	return edges
+}
+
+type step struct {
+	to   uint
+	edge Edge // 保持原始方向
+}
+
+// steps 返回从id出发沿filter可走的一步，按对端ID和类型排序
+func (g *Graph) steps(id uint, filter Filter) []step {
+	var steps []step
+	if filter.Direction != Incoming {
+		for key, e := range g.out[id] {
+			if filter.allows(e.Type) {
+				steps = append(steps, step{to: key.peer, edge: e})
+			}
+		}
+	}
+	if filter.Direction != Outgoing {
+		for key, e := range g.in[id] {
+			if filter.allows(e.Type) {
+				steps = append(steps, step{to: key.peer, edge: e})
+			}
+		}
+	}
+	sort.Slice(steps, func(i, j int) bool {
+		a, b := steps[i], steps[j]
+		if a.to != b.to {
+			return a.to < b.to
+		}
+		if a.edge.Type != b.edge.Type {
+			return a.edge.Type < b.edge.Type
+		}
+		return a.edge.From < b.edge.From
+	})
+	return steps
+}
+
+// undirectedWeights 把图视为无向图，同一对节点之间多条边的权重相加
+func (g *Graph) undirectedWeights() map[uint]map[uint]float64 {
+	adj := make(map[uint]map[uint]float64, len(g.nodes))
+	for id := range g.nodes {
+		adj[id] = make(map[uint]float64)
+	}
+	for from, m := range g.out {
+		for key, e := range m {
+			if from == key.peer {
+				continue
+			}
+			w := edgeWeight(e)
+			adj[from][key.peer] += w
+			adj[key.peer][from] += w
+		}
+	}
+	return adj
+}
+
+// edgeWeight 未设置权重的边按1计算
+func edgeWeight(e Edge) float64 {
+	if e.Weight <= 0 {
+		return 1
+	}
+	return e.Weight
+}
+
+func sortEdges(edges []Edge) {
+	sort.Slice(edges, func(i, j int) bool {
+		a, b := edges[i], edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.Type < b.Type
+	})
+}
+
+func sortedIDs(m map[uint]map[uint]float64) []uint {
+	ids := make([]uint, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
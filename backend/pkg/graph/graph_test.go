@@ -0,0 +1,223 @@
+package graph
+
+import (
+	"math"
+	"testing"
+)
+
+// testGraph 两个三角形社区通过3-4相连：
+//
+//	1 ─ 2      5 ─ 6
+//	 \ /        \ /
+//	  3 ─────── 4
+func testGraph() *Graph {
+	g := New()
+	for id := uint(1); id <= 6; id++ {
+		industry := "制造"
+		if id > 3 {
+			industry = "软件"
+		}
+		g.AddNode(Node{ID: id, Name: string(rune('A' + id - 1)), Industry: industry})
+	}
+	for _, e := range []Edge{
+		{From: 1, To: 2, Type: "合作", Weight: 1},
+		{From: 2, To: 3, Type: "合作", Weight: 1},
+		{From: 1, To: 3, Type: "供应", Weight: 1},
+		{From: 3, To: 4, Type: "供应", Weight: 0.5},
+		{From: 4, To: 5, Type: "控股", Weight: 1},
+		{From: 5, To: 6, Type: "合作", Weight: 1},
+		{From: 4, To: 6, Type: "参股", Weight: 0.3},
+	} {
+		g.AddEdge(e)
+	}
+	return g
+}
+
+func TestShortestPath(t *testing.T) {
+	g := testGraph()
+
+	path, ok := g.ShortestPath(1, 6, 5, Filter{})
+	if !ok || path.Hops != 3 {
+		t.Fatalf("path = %+v, want 3 hops", path)
+	}
+	if ids := nodeIDs(path.Nodes); !equalIDs(ids, []uint{1, 3, 4, 6}) {
+		t.Fatalf("path nodes = %v", ids)
+	}
+	if math.Abs(path.Strength-0.15) > 1e-9 {
+		t.Fatalf("strength = %v, want 0.15", path.Strength)
+	}
+
+	// 反向遍历时边保持原始方向
+	path, ok = g.ShortestPath(6, 3, 5, Filter{})
+	if !ok || path.Edges[len(path.Edges)-1] != (Edge{From: 3, To: 4, Type: "供应", Weight: 0.5}) {
+		t.Fatalf("path edges = %+v", path)
+	}
+
+	if _, ok := g.ShortestPath(1, 6, 2, Filter{}); ok {
+		t.Fatal("expected no path within 2 hops")
+	}
+	if _, ok := g.ShortestPath(6, 1, 5, Filter{Direction: Outgoing}); ok {
+		t.Fatal("expected no outgoing path from 6 to 1")
+	}
+	if _, ok := g.ShortestPath(1, 6, 5, Filter{Types: []string{"合作"}}); ok {
+		t.Fatal("expected no path using only 合作 edges")
+	}
+}
+
+func TestShortestPathPrefersStrongerTie(t *testing.T) {
+	g := New()
+	g.AddEdge(Edge{From: 1, To: 2, Type: "投资", Weight: 0.2})
+	g.AddEdge(Edge{From: 2, To: 4, Type: "投资", Weight: 0.9})
+	g.AddEdge(Edge{From: 1, To: 3, Type: "投资", Weight: 0.8})
+	g.AddEdge(Edge{From: 3, To: 4, Type: "投资", Weight: 0.9})
+
+	path, ok := g.ShortestPath(1, 4, 3, Filter{Direction: Outgoing})
+	if !ok || !equalIDs(nodeIDs(path.Nodes), []uint{1, 3, 4}) {
+		t.Fatalf("path = %+v, want the stronger route via 3", path)
+	}
+}
+
+func TestTraverseDirections(t *testing.T) {
+	g := testGraph()
+	filter := Filter{Types: []string{"供应", "控股", "参股"}, Direction: Outgoing}
+
+	reached := g.Traverse(1, 3, filter)
+	if ids := reachedIDs(reached); !equalIDs(ids, []uint{3, 4, 5, 6}) {
+		t.Fatalf("downstream = %v", ids)
+	}
+	if reached[len(reached)-1].Depth != 3 || !equalIDs(reached[len(reached)-1].Path, []uint{1, 3, 4, 6}) {
+		t.Fatalf("last reached = %+v", reached[len(reached)-1])
+	}
+
+	filter.Direction = Incoming
+	if ids := reachedIDs(g.Traverse(6, 2, filter)); !equalIDs(ids, []uint{4, 3}) {
+		t.Fatalf("upstream = %v", ids)
+	}
+	if ids := reachedIDs(g.Traverse(1, 1, Filter{})); !equalIDs(ids, []uint{2, 3}) {
+		t.Fatalf("depth 1 = %v", ids)
+	}
+
+	sub := g.Neighborhood(1, 2, Filter{})
+	if sub.Len() != 4 || len(sub.Edges()) != 4 {
+		t.Fatalf("neighborhood has %d nodes, %d edges", sub.Len(), len(sub.Edges()))
+	}
+}
+
+func TestCommunities(t *testing.T) {
+	result := testGraph().Communities()
+	if len(result.Communities) != 2 {
+		t.Fatalf("communities = %+v", result.Communities)
+	}
+	if ids := nodeIDs(result.Communities[0].Members); !equalIDs(ids, []uint{1, 2, 3}) {
+		t.Fatalf("first community = %v", ids)
+	}
+	if ids := nodeIDs(result.Communities[1].Members); !equalIDs(ids, []uint{4, 5, 6}) {
+		t.Fatalf("second community = %v", ids)
+	}
+	if result.Modularity < 0.3 {
+		t.Fatalf("modularity = %v, want a clear community structure", result.Modularity)
+	}
+
+	// 孤立节点自成社区
+	g := testGraph()
+	g.AddNode(Node{ID: 9})
+	if n := len(g.Communities().Communities); n != 3 {
+		t.Fatalf("got %d communities with an isolated node", n)
+	}
+}
+
+func TestCentralities(t *testing.T) {
+	g := testGraph()
+
+	ranked := g.Centralities(MetricBetweenness)
+	if top := ranked[0].Node.ID; top != 3 && top != 4 {
+		t.Fatalf("top betweenness = %d, want a bridge node", top)
+	}
+	// 3和4各有6条最短路径经过，共10对节点
+	if math.Abs(ranked[0].Betweenness-0.6) > 1e-9 {
+		t.Fatalf("betweenness = %v, want 0.6", ranked[0].Betweenness)
+	}
+
+	var total float64
+	for _, c := range g.Centralities(MetricPageRank) {
+		total += c.PageRank
+	}
+	if math.Abs(total-1) > 1e-6 {
+		t.Fatalf("pagerank sum = %v", total)
+	}
+
+	ranked = g.Centralities(MetricDegree)
+	if ranked[0].Degree != 1 || ranked[len(ranked)-1].Degree >= 1 {
+		t.Fatalf("degree ranking = %+v", ranked)
+	}
+	if _, err := ParseMetric("closeness"); err == nil {
+		t.Fatal("expected unsupported metric error")
+	}
+}
+
+func TestRecommend(t *testing.T) {
+	g := testGraph()
+
+	recs := g.Recommend(1, 3, 10, nil)
+	if ids := recommendationIDs(recs); !equalIDs(ids, []uint{4, 5, 6}) {
+		t.Fatalf("recommendations = %v", ids)
+	}
+	if recs[0].Hops != 2 || len(recs[0].Via) != 1 || recs[0].Via[0].ID != 3 {
+		t.Fatalf("first recommendation = %+v", recs[0])
+	}
+
+	recs = g.Recommend(1, 3, 1, func(n Node) bool { return n.ID == 4 })
+	if len(recs) != 1 || recs[0].Node.ID == 4 {
+		t.Fatalf("excluded recommendation = %+v", recs)
+	}
+	if recs := g.Recommend(1, 1, 10, nil); len(recs) != 0 {
+		t.Fatalf("depth 1 should not recommend direct partners: %+v", recs)
+	}
+}
+
+func TestRemoveNode(t *testing.T) {
+	g := testGraph()
+	g.RemoveNode(3)
+	if _, ok := g.ShortestPath(1, 4, 5, Filter{}); ok {
+		t.Fatal("expected graph to be split after removing the bridge")
+	}
+	if len(g.Edges()) != 4 {
+		t.Fatalf("edges = %+v", g.Edges())
+	}
+}
+
+func nodeIDs(nodes []Node) []uint {
+	ids := make([]uint, len(nodes))
+	for i, n := range nodes {
+		ids[i] = n.ID
+	}
+	return ids
+}
+
+func reachedIDs(reached []Reached) []uint {
+	ids := make([]uint, len(reached))
+	for i, r := range reached {
+		ids[i] = r.Node.ID
+	}
+	return ids
+}
+
+func recommendationIDs(recs []Recommendation) []uint {
+	ids := make([]uint, len(recs))
+	for i, r := range recs {
+		ids[i] = r.Node.ID
+	}
+	return ids
+}
+
+func equalIDs(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+package graph
+
+import "sort"
+
+// Path 两个节点之间的一条路径，Edges保持边的原始方向
+type Path struct {
+	Nodes    []Node  `json:"nodes"`
+	Edges    []Edge  `json:"edges"`
+	Hops     int     `json:"hops"`
+	Strength float64 `json:"strength"` // 沿途边权重的乘积
+}
+
+// Reached 遍历到的节点
+type Reached struct {
+	Node     Node    `json:"node"`
+	Depth    int     `json:"depth"`
+	Path     []uint  `json:"path"` // 从起点到该节点（含两端）
+	Via      Edge    `json:"via"`  // 到达该节点的最后一条边，保持原始方向
+	Strength float64 `json:"strength"`
+}
+
+type bfsVisit struct {
+	depth    int
+	parent   uint
+	via      Edge
+	strength float64
+}
+
+// bfs 按层广度优先遍历。同一层可以从多个父节点到达时选路径强度最大的父节点，
+// 因此结果是跳数最少的路径中最强的一条。stop返回true时遍历完当前层后停止
+func (g *Graph) bfs(start uint, depth int, filter Filter, stop func(uint) bool) map[uint]bfsVisit {
+	visits := map[uint]bfsVisit{start: {strength: 1}}
+	if _, ok := g.nodes[start]; !ok {
+		return visits
+	}
+	frontier := []uint{start}
+	for d := 1; d <= depth && len(frontier) > 0; d++ {
+		next := make(map[uint]bfsVisit)
+		var order []uint
+		for _, id := range frontier {
+			for _, step := range g.steps(id, filter) {
+				if _, seen := visits[step.to]; seen {
+					continue
+				}
+				strength := visits[id].strength * edgeWeight(step.edge)
+				if current, ok := next[step.to]; !ok {
+					order = append(order, step.to)
+				} else if current.strength >= strength {
+					continue
+				}
+				next[step.to] = bfsVisit{depth: d, parent: id, via: step.edge, strength: strength}
+			}
+		}
+		done := false
+		for _, id := range order {
+			visits[id] = next[id]
+			if stop != nil && stop(id) {
+				done = true
+			}
+		}
+		if done {
+			break
+		}
+		frontier = order
+	}
+	return visits
+}
+
+func (g *Graph) pathTo(visits map[uint]bfsVisit, start, target uint) []uint {
+	var ids []uint
+	for id := target; ; id = visits[id].parent {
+		ids = append(ids, id)
+		if id == start {
+			break
+		}
+	}
+	for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+	return ids
+}
+
+// ShortestPath 查找跳数最少（同跳数中强度最大）的路径，maxDepth跳内不可达时返回false
+func (g *Graph) ShortestPath(from, to uint, maxDepth int, filter Filter) (*Path, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if _, ok := g.nodes[from]; !ok {
+		return nil, false
+	}
+	if _, ok := g.nodes[to]; !ok {
+		return nil, false
+	}
+	visits := g.bfs(from, maxDepth, filter, func(id uint) bool { return id == to })
+	visit, ok := visits[to]
+	if !ok {
+		return nil, false
+	}
+	path := &Path{Hops: visit.depth, Strength: visit.strength}
+	for _, id := range g.pathTo(visits, from, to) {
+		path.Nodes = append(path.Nodes, g.nodes[id])
+		if id != from {
+			path.Edges = append(path.Edges, visits[id].via)
+		}
+	}
+	return path, true
+}
+
+// Traverse 返回距离start在1~depth跳之间的节点，按跳数、强度降序、ID排序
+func (g *Graph) Traverse(start uint, depth int, filter Filter) []Reached {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	visits := g.bfs(start, depth, filter, nil)
+	reached := make([]Reached, 0, len(visits))
+	for id, visit := range visits {
+		if id == start {
+			continue
+		}
+		reached = append(reached, Reached{
+			Node:     g.nodes[id],
+			Depth:    visit.depth,
+			Path:     g.pathTo(visits, start, id),
+			Via:      visit.via,
+			Strength: visit.strength,
+		})
+	}
+	sortReached(reached)
+	return reached
+}
+
+func sortReached(reached []Reached) {
+	sort.Slice(reached, func(i, j int) bool {
+		a, b := reached[i], reached[j]
+		if a.Depth != b.Depth {
+			return a.Depth < b.Depth
+		}
+		if a.Strength != b.Strength {
+			return a.Strength > b.Strength
+		}
+		return a.Node.ID < b.Node.ID
+	})
+}
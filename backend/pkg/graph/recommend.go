@@ -0,0 +1,103 @@
+package graph
+
+import (
+	"math"
+	"sort"
+)
+
+// restartProbability 带重启随机游走每一步回到起点的概率
+const restartProbability = 0.15
+
+// Recommendation 通过关系网络推荐的节点
+type Recommendation struct {
+	Node  Node    `json:"node"`
+	Score float64 `json:"score"`
+	Hops  int     `json:"hops"`
+	// Via 起点的直接关联方中与推荐节点直接相连的节点，即“共同关联”
+	Via []Node `json:"via,omitempty"`
+}
+
+// Recommend 推荐与start没有直接关系、但在maxDepth跳内间接相连的节点。
+// 在无向带权图上从start做带重启随机游走（个性化PageRank），按访问概率排序；
+// exclude返回true的节点不会被推荐，但仍参与游走
+func (g *Graph) Recommend(start uint, maxDepth, limit int, exclude func(Node) bool) []Recommendation {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if _, ok := g.nodes[start]; !ok || maxDepth < 2 {
+		return nil
+	}
+	visits := g.bfs(start, maxDepth, Filter{}, nil)
+	adj := g.undirectedWeights()
+	for id := range adj {
+		if _, ok := visits[id]; !ok {
+			delete(adj, id)
+		}
+	}
+	for id, peers := range adj {
+		for peer := range peers {
+			if _, ok := adj[peer]; !ok {
+				delete(adj[id], peer)
+			}
+		}
+	}
+	scores := personalizedPageRank(adj, start)
+
+	var result []Recommendation
+	for id, visit := range visits {
+		if visit.depth < 2 || exclude != nil && exclude(g.nodes[id]) {
+			continue
+		}
+		r := Recommendation{Node: g.nodes[id], Score: scores[id], Hops: visit.depth}
+		for _, peer := range sortedPeers(adj[id]) {
+			if _, direct := adj[start][peer]; direct {
+				r.Via = append(r.Via, g.nodes[peer])
+			}
+		}
+		result = append(result, r)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Score != result[j].Score {
+			return result[i].Score > result[j].Score
+		}
+		return result[i].Node.ID < result[j].Node.ID
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+func personalizedPageRank(adj map[uint]map[uint]float64, start uint) map[uint]float64 {
+	ids := sortedIDs(adj)
+	degree := make(map[uint]float64, len(ids))
+	for _, id := range ids {
+		for _, w := range adj[id] {
+			degree[id] += w
+		}
+	}
+	rank := map[uint]float64{start: 1}
+	for iter := 0; iter < pageRankIterations; iter++ {
+		next := map[uint]float64{start: restartProbability}
+		for _, id := range ids {
+			if rank[id] == 0 {
+				continue
+			}
+			if degree[id] == 0 {
+				next[start] += (1 - restartProbability) * rank[id]
+				continue
+			}
+			for peer, w := range adj[id] {
+				next[peer] += (1 - restartProbability) * rank[id] * w / degree[id]
+			}
+		}
+		var delta float64
+		for _, id := range ids {
+			delta += math.Abs(next[id] - rank[id])
+		}
+		rank = next
+		if delta < pageRankTolerance {
+			break
+		}
+	}
+	return rank
+}
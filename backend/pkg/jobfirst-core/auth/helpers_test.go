@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestAuthManager 基于内存SQLite的认证管理器。users和oauth_clients表的enum列SQLite不支持，按测试需要的列手工建表
+func newTestAuthManager(t *testing.T) *AuthManager {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.Exec(`CREATE TABLE users (
+		id integer PRIMARY KEY AUTOINCREMENT,
+		username varchar(100) UNIQUE,
+		email varchar(255),
+		password_hash varchar(255),
+		role varchar(20) DEFAULT 'guest',
+		status varchar(20) DEFAULT 'active',
+		uuid varchar(36),
+		created_at datetime,
+		updated_at datetime
+	)`).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec(`CREATE TABLE oauth_clients (
+		id integer PRIMARY KEY AUTOINCREMENT,
+		client_id varchar(64) UNIQUE,
+		client_secret_hash varchar(255),
+		name varchar(100),
+		redirect_uris text,
+		grant_types varchar(255),
+		scopes varchar(500),
+		public numeric DEFAULT false,
+		owner_user_id integer,
+		status varchar(20) DEFAULT 'active',
+		created_at datetime,
+		updated_at datetime
+	)`).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&UserMFA{}, &OAuthAuthorizationCode{}, &OAuthToken{}, &OAuthConsent{}); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewAuthManager(db, AuthConfig{JWTSecret: "test-secret", TokenExpiry: time.Hour})
+}
+
+// createTestUser 创建启用状态的测试用户
+func createTestUser(t *testing.T, am *AuthManager, username, role string) *User {
+	t.Helper()
+	if err := am.db.Exec("INSERT INTO users (username, email, role, status, uuid) VALUES (?, ?, ?, 'active', ?)",
+		username, username+"@example.com", role, username+"-uuid").Error; err != nil {
+		t.Fatal(err)
+	}
+	var user User
+	if err := am.db.Select("id, username, email, role, status, uuid").Where("username = ?", username).First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
@@ -0,0 +1,601 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 登录防护结果
+const (
+	LoginAllowed         = "allowed"
+	LoginLocked          = "locked"
+	LoginThrottled       = "throttled"
+	LoginCaptchaRequired = "captcha_required"
+)
+
+// 统一的登录失败错误码，避免通过错误码枚举用户名
+const (
+	ErrorCodeInvalidCredentials = "INVALID_CREDENTIALS"
+	ErrorCodeAccountLocked      = "ACCOUNT_LOCKED"
+	ErrorCodeTooManyAttempts    = "TOO_MANY_ATTEMPTS"
+	ErrorCodeCaptchaRequired    = "CAPTCHA_REQUIRED"
+)
+
+// LoginGuardConfig 登录防护配置
+type LoginGuardConfig struct {
+	MaxAccountFailures int64         `json:"max_account_failures"` // 单账户失败次数上限，达到后锁定
+	MaxIPFailures      int64         `json:"max_ip_failures"`      // 单IP失败次数上限，达到后锁定
+	FailureWindow      time.Duration `json:"failure_window"`       // 失败计数窗口
+	LockoutDuration    time.Duration `json:"lockout_duration"`     // 锁定时长
+	DelayAfter         int64         `json:"delay_after"`          // 超过该失败次数后开始递增延迟
+	BaseDelay          time.Duration `json:"base_delay"`           // 初始延迟
+	MaxDelay           time.Duration `json:"max_delay"`            // 最大延迟
+	CaptchaThreshold   int64         `json:"captcha_threshold"`    // 失败次数达到后要求验证码，0表示不启用
+	BurstThreshold     int64         `json:"burst_threshold"`      // 窗口内失败次数达到后通知账户所有者，0表示不启用
+	KeyPrefix          string        `json:"key_prefix"`
+}
+
+// DefaultLoginGuardConfig 默认登录防护配置
+func DefaultLoginGuardConfig() LoginGuardConfig {
+	return LoginGuardConfig{
+		MaxAccountFailures: 5,
+		MaxIPFailures:      50,
+		FailureWindow:      15 * time.Minute,
+		LockoutDuration:    15 * time.Minute,
+		DelayAfter:         2,
+		BaseDelay:          time.Second,
+		MaxDelay:           30 * time.Second,
+		CaptchaThreshold:   0,
+		BurstThreshold:     3,
+		KeyPrefix:          "auth:login:",
+	}
+}
+
+// LoginDecision 登录尝试的防护决策
+type LoginDecision struct {
+	Result          string        `json:"result"`
+	AccountFailures int64         `json:"account_failures"`
+	IPFailures      int64         `json:"ip_failures"`
+	RetryAfter      time.Duration `json:"retry_after"`
+	CaptchaRequired bool          `json:"captcha_required"`
+}
+
+// Allowed 是否允许继续校验密码
+func (d *LoginDecision) Allowed() bool {
+	return d.Result == LoginAllowed
+}
+
+// LockoutStatus 账户锁定状态
+type LockoutStatus struct {
+	Username        string `json:"username"`
+	Failures        int64  `json:"failures"`
+	Locked          bool   `json:"locked"`
+	RetryAfter      int    `json:"retry_after_seconds"`
+	CaptchaRequired bool   `json:"captcha_required"`
+}
+
+// LoginAlert 可疑登录告警
+type LoginAlert struct {
+	Username   string    `json:"username"`
+	ClientIP   string    `json:"client_ip"`
+	Failures   int64     `json:"failures"`
+	Locked     bool      `json:"locked"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// LoginAlertNotifier 可疑登录告警通知（通知账户所有者）
+type LoginAlertNotifier interface {
+	NotifySuspiciousLogin(ctx context.Context, alert LoginAlert) error
+}
+
+// LogAlertNotifier 仅写日志的告警通知器
+type LogAlertNotifier struct{}
+
+// NotifySuspiciousLogin 记录可疑登录告警
+func (LogAlertNotifier) NotifySuspiciousLogin(ctx context.Context, alert LoginAlert) error {
+	log.Printf("⚠️ [Login Guard] 账户 %s 出现可疑登录: 失败次数=%d, IP=%s, 已锁定=%v",
+		alert.Username, alert.Failures, alert.ClientIP, alert.Locked)
+	return nil
+}
+
+// UserResolver 按用户名查询用户ID，用户不存在时返回0
+type UserResolver func(ctx context.Context, username string) (uint, error)
+
+// NotificationAlertNotifier 通过notification-service通知账户所有者的告警通知器
+type NotificationAlertNotifier struct {
+	baseURL     string
+	client      *http.Client
+	resolveUser UserResolver
+}
+
+// NewNotificationAlertNotifier 创建notification-service告警通知器
+func NewNotificationAlertNotifier(baseURL string, resolveUser UserResolver) *NotificationAlertNotifier {
+	return &NotificationAlertNotifier{
+		baseURL:     baseURL,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		resolveUser: resolveUser,
+	}
+}
+
+// NotifySuspiciousLogin 向账户所有者发送可疑登录通知；用户名不存在时没有可通知的对象，仅记录日志
+func (n *NotificationAlertNotifier) NotifySuspiciousLogin(ctx context.Context, alert LoginAlert) error {
+	userID, err := n.resolveUser(ctx, alert.Username)
+	if err != nil {
+		return fmt.Errorf("查询告警用户失败: %w", err)
+	}
+	if userID == 0 {
+		return LogAlertNotifier{}.NotifySuspiciousLogin(ctx, alert)
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"user_id":     userID,
+		"username":    alert.Username,
+		"client_ip":   alert.ClientIP,
+		"failures":    alert.Failures,
+		"locked":      alert.Locked,
+		"occurred_at": alert.OccurredAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.baseURL+"/api/v1/events/suspicious-login", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("调用通知服务失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("通知服务返回状态码: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// CaptchaVerifier 验证码校验函数
+type CaptchaVerifier func(ctx context.Context, token, clientIP string) bool
+
+// AttemptStore 登录尝试计数存储
+type AttemptStore interface {
+	// Incr 原子递增计数，首次创建时设置过期时间
+	Incr(ctx context.Context, key string, window time.Duration) (int64, error)
+	// Decr 撤销一次计数，键不存在或已为0时不做任何操作
+	Decr(ctx context.Context, key string) error
+	// Get 获取计数，不存在时返回0
+	Get(ctx context.Context, key string) (int64, error)
+	// SetTTL 设置标记键及其过期时间
+	SetTTL(ctx context.Context, key string, ttl time.Duration) error
+	// SetNX 标记键不存在时设置，返回是否设置成功
+	SetNX(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// TTL 获取剩余过期时间，键不存在时返回0
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	// Del 删除键
+	Del(ctx context.Context, keys ...string) error
+}
+
+// incrWithExpireScript 递增并在首次创建时设置过期时间
+var incrWithExpireScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// decrIfPositiveScript 计数大于0时递减，不创建新键、不改变过期时间
+var decrIfPositiveScript = redis.NewScript(`
+local n = tonumber(redis.call('GET', KEYS[1]) or '0')
+if n > 0 then
+	return redis.call('DECR', KEYS[1])
+end
+return 0
+`)
+
+// RedisAttemptStore 基于Redis的登录尝试存储，多实例共享
+type RedisAttemptStore struct {
+	client *redis.Client
+}
+
+// NewRedisAttemptStore 创建Redis登录尝试存储
+func NewRedisAttemptStore(client *redis.Client) *RedisAttemptStore {
+	return &RedisAttemptStore{client: client}
+}
+
+// Incr 原子递增计数
+func (s *RedisAttemptStore) Incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	return incrWithExpireScript.Run(ctx, s.client, []string{key}, window.Milliseconds()).Int64()
+}
+
+// Decr 撤销一次计数
+func (s *RedisAttemptStore) Decr(ctx context.Context, key string) error {
+	return decrIfPositiveScript.Run(ctx, s.client, []string{key}).Err()
+}
+
+// Get 获取计数
+func (s *RedisAttemptStore) Get(ctx context.Context, key string) (int64, error) {
+	n, err := s.client.Get(ctx, key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return n, err
+}
+
+// SetTTL 设置标记键
+func (s *RedisAttemptStore) SetTTL(ctx context.Context, key string, ttl time.Duration) error {
+	return s.client.Set(ctx, key, 1, ttl).Err()
+}
+
+// SetNX 标记键不存在时设置
+func (s *RedisAttemptStore) SetNX(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, key, 1, ttl).Result()
+}
+
+// TTL 获取剩余过期时间
+func (s *RedisAttemptStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// Del 删除键
+func (s *RedisAttemptStore) Del(ctx context.Context, keys ...string) error {
+	return s.client.Del(ctx, keys...).Err()
+}
+
+// memoryAttemptStore 进程内登录尝试存储（未配置Redis时使用）
+type memoryAttemptStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryAttemptEntry
+}
+
+type memoryAttemptEntry struct {
+	value     int64
+	expiresAt time.Time
+}
+
+// NewMemoryAttemptStore 创建进程内登录尝试存储
+func NewMemoryAttemptStore() AttemptStore {
+	return &memoryAttemptStore{entries: make(map[string]memoryAttemptEntry)}
+}
+
+func (s *memoryAttemptStore) load(key string, now time.Time) (memoryAttemptEntry, bool) {
+	entry, ok := s.entries[key]
+	if ok && !entry.expiresAt.After(now) {
+		delete(s.entries, key)
+		return memoryAttemptEntry{}, false
+	}
+	return entry, ok
+}
+
+func (s *memoryAttemptStore) Incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	entry, ok := s.load(key, now)
+	if !ok {
+		entry = memoryAttemptEntry{expiresAt: now.Add(window)}
+	}
+	entry.value++
+	s.entries[key] = entry
+	return entry.value, nil
+}
+
+func (s *memoryAttemptStore) Decr(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.load(key, time.Now()); ok && entry.value > 0 {
+		entry.value--
+		s.entries[key] = entry
+	}
+	return nil
+}
+
+func (s *memoryAttemptStore) Get(ctx context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, _ := s.load(key, time.Now())
+	return entry.value, nil
+}
+
+func (s *memoryAttemptStore) SetTTL(ctx context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = memoryAttemptEntry{value: 1, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *memoryAttemptStore) SetNX(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if _, ok := s.load(key, now); ok {
+		return false, nil
+	}
+	s.entries[key] = memoryAttemptEntry{value: 1, expiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+func (s *memoryAttemptStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	entry, ok := s.load(key, now)
+	if !ok {
+		return 0, nil
+	}
+	return entry.expiresAt.Sub(now), nil
+}
+
+func (s *memoryAttemptStore) Del(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// LoginGuard 登录防暴力破解：按账户和IP计数，递增延迟、临时锁定、验证码要求和可疑登录告警
+type LoginGuard struct {
+	store    AttemptStore
+	config   LoginGuardConfig
+	notifier LoginAlertNotifier
+	captcha  CaptchaVerifier
+}
+
+// NewLoginGuard 创建登录防护器
+func NewLoginGuard(store AttemptStore, config LoginGuardConfig) *LoginGuard {
+	if store == nil {
+		store = NewMemoryAttemptStore()
+	}
+	if config.KeyPrefix == "" {
+		config.KeyPrefix = DefaultLoginGuardConfig().KeyPrefix
+	}
+	return &LoginGuard{
+		store:    store,
+		config:   config,
+		notifier: LogAlertNotifier{},
+	}
+}
+
+// SetNotifier 设置可疑登录告警通知器
+func (g *LoginGuard) SetNotifier(notifier LoginAlertNotifier) {
+	g.notifier = notifier
+}
+
+// SetCaptchaVerifier 设置验证码校验函数
+func (g *LoginGuard) SetCaptchaVerifier(verifier CaptchaVerifier) {
+	g.captcha = verifier
+}
+
+func (g *LoginGuard) accountKey(kind, username string) string {
+	return g.config.KeyPrefix + kind + ":account:" + username
+}
+
+func (g *LoginGuard) ipKey(kind, ip string) string {
+	return g.config.KeyPrefix + kind + ":ip:" + ip
+}
+
+// Begin 登录尝试开始前调用。每次尝试都会预先计入失败次数，
+// 这样并发请求无法在计数更新前绕过上限；登录成功后由Succeed清零账户计数并撤销本次IP计数，
+// 因验证码未通过而拒绝的尝试不计入失败。
+func (g *LoginGuard) Begin(ctx context.Context, username, clientIP, captchaToken string) (*LoginDecision, error) {
+	decision := &LoginDecision{Result: LoginAllowed}
+
+	// 1. 检查账户和IP锁定
+	if ttl, err := g.store.TTL(ctx, g.accountKey("lock", username)); err != nil {
+		return nil, fmt.Errorf("查询账户锁定状态失败: %w", err)
+	} else if ttl > 0 {
+		decision.Result, decision.RetryAfter = LoginLocked, ttl
+		return decision, nil
+	}
+	if clientIP != "" {
+		if ttl, err := g.store.TTL(ctx, g.ipKey("lock", clientIP)); err != nil {
+			return nil, fmt.Errorf("查询IP锁定状态失败: %w", err)
+		} else if ttl > 0 {
+			decision.Result, decision.RetryAfter = LoginLocked, ttl
+			return decision, nil
+		}
+	}
+
+	// 2. 检查递增延迟
+	if ttl, err := g.store.TTL(ctx, g.accountKey("delay", username)); err != nil {
+		return nil, fmt.Errorf("查询登录延迟失败: %w", err)
+	} else if ttl > 0 {
+		decision.Result, decision.RetryAfter = LoginThrottled, ttl
+		return decision, nil
+	}
+
+	// 3. 原子计数
+	accountFailures, err := g.store.Incr(ctx, g.accountKey("fail", username), g.config.FailureWindow)
+	if err != nil {
+		return nil, fmt.Errorf("记录登录尝试失败: %w", err)
+	}
+	decision.AccountFailures = accountFailures
+	if clientIP != "" {
+		ipFailures, err := g.store.Incr(ctx, g.ipKey("fail", clientIP), g.config.FailureWindow)
+		if err != nil {
+			return nil, fmt.Errorf("记录登录尝试失败: %w", err)
+		}
+		decision.IPFailures = ipFailures
+	}
+
+	if g.config.MaxAccountFailures > 0 && accountFailures > g.config.MaxAccountFailures {
+		g.store.SetTTL(ctx, g.accountKey("lock", username), g.config.LockoutDuration)
+		decision.Result, decision.RetryAfter = LoginLocked, g.config.LockoutDuration
+		return decision, nil
+	}
+	if g.config.MaxIPFailures > 0 && decision.IPFailures > g.config.MaxIPFailures {
+		g.store.SetTTL(ctx, g.ipKey("lock", clientIP), g.config.LockoutDuration)
+		decision.Result, decision.RetryAfter = LoginLocked, g.config.LockoutDuration
+		return decision, nil
+	}
+
+	// 4. 验证码要求（本次尝试之前的失败次数达到阈值）
+	if g.config.CaptchaThreshold > 0 && accountFailures > g.config.CaptchaThreshold {
+		decision.CaptchaRequired = true
+		if captchaToken == "" || g.captcha == nil || !g.captcha(ctx, captchaToken, clientIP) {
+			g.undo(ctx, username, clientIP)
+			decision.AccountFailures--
+			if decision.IPFailures > 0 {
+				decision.IPFailures--
+			}
+			decision.Result = LoginCaptchaRequired
+			return decision, nil
+		}
+	}
+
+	return decision, nil
+}
+
+// Fail 密码校验失败后调用，设置递增延迟，达到上限时锁定并通知账户所有者
+func (g *LoginGuard) Fail(ctx context.Context, username, clientIP string, decision *LoginDecision) {
+	failures := decision.AccountFailures
+	locked := false
+
+	if delay := g.delayFor(failures); delay > 0 {
+		g.store.SetTTL(ctx, g.accountKey("delay", username), delay)
+	}
+	if g.config.MaxAccountFailures > 0 && failures >= g.config.MaxAccountFailures {
+		g.store.SetTTL(ctx, g.accountKey("lock", username), g.config.LockoutDuration)
+		locked = true
+	}
+	if clientIP != "" && g.config.MaxIPFailures > 0 && decision.IPFailures >= g.config.MaxIPFailures {
+		g.store.SetTTL(ctx, g.ipKey("lock", clientIP), g.config.LockoutDuration)
+	}
+
+	if g.config.BurstThreshold > 0 && failures >= g.config.BurstThreshold && g.notifier != nil {
+		// 同一窗口内每个账户只告警一次
+		first, err := g.store.SetNX(ctx, g.accountKey("alert", username), g.config.FailureWindow)
+		if err == nil && first {
+			alert := LoginAlert{
+				Username:   username,
+				ClientIP:   clientIP,
+				Failures:   failures,
+				Locked:     locked,
+				OccurredAt: time.Now(),
+			}
+			if err := g.notifier.NotifySuspiciousLogin(ctx, alert); err != nil {
+				log.Printf("发送可疑登录告警失败: %v", err)
+			}
+		}
+	}
+}
+
+// Succeed 登录成功后清除账户失败计数和延迟，并撤销Begin预先计入的本次IP计数。
+// IP上已有的失败计数保留，防止用一个有效账户重置IP限制
+func (g *LoginGuard) Succeed(ctx context.Context, username, clientIP string) {
+	g.store.Del(ctx, g.accountKey("fail", username), g.accountKey("delay", username))
+	if clientIP != "" {
+		g.store.Decr(ctx, g.ipKey("fail", clientIP))
+	}
+}
+
+// undo 撤销Begin预先计入的本次尝试
+func (g *LoginGuard) undo(ctx context.Context, username, clientIP string) {
+	g.store.Decr(ctx, g.accountKey("fail", username))
+	if clientIP != "" {
+		g.store.Decr(ctx, g.ipKey("fail", clientIP))
+	}
+}
+
+// Unlock 管理员解锁账户
+func (g *LoginGuard) Unlock(ctx context.Context, username string) error {
+	return g.store.Del(ctx,
+		g.accountKey("lock", username),
+		g.accountKey("fail", username),
+		g.accountKey("delay", username),
+		g.accountKey("alert", username),
+	)
+}
+
+// UnlockIP 管理员解锁IP
+func (g *LoginGuard) UnlockIP(ctx context.Context, clientIP string) error {
+	return g.store.Del(ctx, g.ipKey("lock", clientIP), g.ipKey("fail", clientIP))
+}
+
+// Status 查询账户锁定状态
+func (g *LoginGuard) Status(ctx context.Context, username string) (*LockoutStatus, error) {
+	failures, err := g.store.Get(ctx, g.accountKey("fail", username))
+	if err != nil {
+		return nil, err
+	}
+	lockTTL, err := g.store.TTL(ctx, g.accountKey("lock", username))
+	if err != nil {
+		return nil, err
+	}
+	delayTTL, err := g.store.TTL(ctx, g.accountKey("delay", username))
+	if err != nil {
+		return nil, err
+	}
+
+	retryAfter := lockTTL
+	if delayTTL > retryAfter {
+		retryAfter = delayTTL
+	}
+
+	return &LockoutStatus{
+		Username:        username,
+		Failures:        failures,
+		Locked:          lockTTL > 0,
+		RetryAfter:      retrySeconds(retryAfter),
+		CaptchaRequired: g.config.CaptchaThreshold > 0 && failures >= g.config.CaptchaThreshold,
+	}, nil
+}
+
+// delayFor 计算失败次数对应的递增延迟
+func (g *LoginGuard) delayFor(failures int64) time.Duration {
+	if g.config.BaseDelay <= 0 || failures <= g.config.DelayAfter {
+		return 0
+	}
+	delay := g.config.BaseDelay
+	for i := g.config.DelayAfter + 1; i < failures; i++ {
+		delay *= 2
+		if g.config.MaxDelay > 0 && delay >= g.config.MaxDelay {
+			return g.config.MaxDelay
+		}
+	}
+	if g.config.MaxDelay > 0 && delay > g.config.MaxDelay {
+		return g.config.MaxDelay
+	}
+	return delay
+}
+
+// retrySeconds 将等待时长转换为向上取整的秒数
+func retrySeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// loginFailureMessage 登录被拒绝时的统一提示
+func loginFailureMessage(decision *LoginDecision) (string, string) {
+	switch decision.Result {
+	case LoginLocked:
+		return "登录尝试次数过多，账户已临时锁定，请" + strconv.Itoa(retrySeconds(decision.RetryAfter)) + "秒后重试", ErrorCodeAccountLocked
+	case LoginThrottled:
+		return "登录过于频繁，请" + strconv.Itoa(retrySeconds(decision.RetryAfter)) + "秒后重试", ErrorCodeTooManyAttempts
+	case LoginCaptchaRequired:
+		return "请完成验证码验证后重试", ErrorCodeCaptchaRequired
+	default:
+		return "用户名或密码错误", ErrorCodeInvalidCredentials
+	}
+}
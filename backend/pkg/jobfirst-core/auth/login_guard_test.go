@@ -0,0 +1,331 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+type recordingNotifier struct {
+	mu     sync.Mutex
+	alerts []LoginAlert
+}
+
+func (n *recordingNotifier) NotifySuspiciousLogin(ctx context.Context, alert LoginAlert) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+func testGuardConfig() LoginGuardConfig {
+	config := DefaultLoginGuardConfig()
+	config.MaxAccountFailures = 5
+	config.MaxIPFailures = 100
+	config.BaseDelay = 0
+	config.BurstThreshold = 3
+	return config
+}
+
+// TestLoginGuardConcurrentAttempts 并发尝试时密码校验次数不超过上限
+func TestLoginGuardConcurrentAttempts(t *testing.T) {
+	guard := NewLoginGuard(NewMemoryAttemptStore(), testGuardConfig())
+	ctx := context.Background()
+
+	var evaluated, locked int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			decision, err := guard.Begin(ctx, "alice", "10.0.0.1", "")
+			if err != nil {
+				t.Errorf("Begin失败: %v", err)
+				return
+			}
+			if !decision.Allowed() {
+				if decision.Result == LoginLocked {
+					atomic.AddInt64(&locked, 1)
+				}
+				return
+			}
+			atomic.AddInt64(&evaluated, 1)
+			guard.Fail(ctx, "alice", "10.0.0.1", decision)
+		}()
+	}
+	wg.Wait()
+
+	if evaluated != 5 {
+		t.Fatalf("期望最多校验5次密码，实际 %d 次", evaluated)
+	}
+	if locked != 45 {
+		t.Fatalf("期望45次被锁定拒绝，实际 %d 次", locked)
+	}
+
+	status, err := guard.Status(ctx, "alice")
+	if err != nil {
+		t.Fatalf("查询状态失败: %v", err)
+	}
+	if !status.Locked || status.RetryAfter <= 0 {
+		t.Fatalf("账户应处于锁定状态: %+v", status)
+	}
+}
+
+// TestLoginGuardUnlock 管理员解锁后可以重新登录
+func TestLoginGuardUnlock(t *testing.T) {
+	guard := NewLoginGuard(NewMemoryAttemptStore(), testGuardConfig())
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		decision, _ := guard.Begin(ctx, "bob", "10.0.0.2", "")
+		guard.Fail(ctx, "bob", "10.0.0.2", decision)
+	}
+	if decision, _ := guard.Begin(ctx, "bob", "10.0.0.2", ""); decision.Result != LoginLocked {
+		t.Fatalf("期望账户被锁定，实际 %s", decision.Result)
+	}
+
+	if err := guard.Unlock(ctx, "bob"); err != nil {
+		t.Fatalf("解锁失败: %v", err)
+	}
+	decision, _ := guard.Begin(ctx, "bob", "10.0.0.2", "")
+	if !decision.Allowed() {
+		t.Fatalf("解锁后应允许登录，实际 %s", decision.Result)
+	}
+	guard.Succeed(ctx, "bob", "10.0.0.2")
+
+	status, _ := guard.Status(ctx, "bob")
+	if status.Failures != 0 || status.Locked {
+		t.Fatalf("登录成功后计数应清零: %+v", status)
+	}
+}
+
+// TestLoginGuardIPLockout 同一IP尝试多个账户时按IP锁定
+func TestLoginGuardIPLockout(t *testing.T) {
+	config := testGuardConfig()
+	config.MaxIPFailures = 3
+	guard := NewLoginGuard(NewMemoryAttemptStore(), config)
+	ctx := context.Background()
+
+	for _, username := range []string{"u1", "u2", "u3"} {
+		decision, _ := guard.Begin(ctx, username, "10.0.0.3", "")
+		guard.Fail(ctx, username, "10.0.0.3", decision)
+	}
+	if decision, _ := guard.Begin(ctx, "u4", "10.0.0.3", ""); decision.Result != LoginLocked {
+		t.Fatalf("期望IP被锁定，实际 %s", decision.Result)
+	}
+	if decision, _ := guard.Begin(ctx, "u4", "10.0.0.4", ""); !decision.Allowed() {
+		t.Fatalf("其他IP不应受影响，实际 %s", decision.Result)
+	}
+}
+
+// TestLoginGuardProgressiveDelay 失败次数超过阈值后递增延迟
+func TestLoginGuardProgressiveDelay(t *testing.T) {
+	config := testGuardConfig()
+	config.DelayAfter = 1
+	config.BaseDelay = time.Second
+	config.MaxDelay = 3 * time.Second
+	guard := NewLoginGuard(NewMemoryAttemptStore(), config)
+
+	expected := map[int64]time.Duration{1: 0, 2: time.Second, 3: 2 * time.Second, 4: 3 * time.Second, 10: 3 * time.Second}
+	for failures, want := range expected {
+		if got := guard.delayFor(failures); got != want {
+			t.Errorf("失败%d次: 期望延迟 %v，实际 %v", failures, want, got)
+		}
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		decision, _ := guard.Begin(ctx, "carol", "", "")
+		guard.Fail(ctx, "carol", "", decision)
+	}
+	decision, _ := guard.Begin(ctx, "carol", "", "")
+	if decision.Result != LoginThrottled || decision.RetryAfter <= 0 {
+		t.Fatalf("期望被延迟，实际 %+v", decision)
+	}
+}
+
+// TestLoginGuardCaptchaAndAlert 达到阈值后要求验证码并只告警一次
+func TestLoginGuardCaptchaAndAlert(t *testing.T) {
+	config := testGuardConfig()
+	config.CaptchaThreshold = 2
+	config.MaxAccountFailures = 10
+	guard := NewLoginGuard(NewMemoryAttemptStore(), config)
+	notifier := &recordingNotifier{}
+	guard.SetNotifier(notifier)
+	guard.SetCaptchaVerifier(func(ctx context.Context, token, clientIP string) bool {
+		return token == "ok"
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		decision, _ := guard.Begin(ctx, "dave", "10.0.0.5", "")
+		guard.Fail(ctx, "dave", "10.0.0.5", decision)
+	}
+
+	decision, _ := guard.Begin(ctx, "dave", "10.0.0.5", "")
+	if decision.Result != LoginCaptchaRequired {
+		t.Fatalf("期望要求验证码，实际 %s", decision.Result)
+	}
+
+	decision, _ = guard.Begin(ctx, "dave", "10.0.0.5", "ok")
+	if !decision.Allowed() {
+		t.Fatalf("验证码通过后应允许登录，实际 %s", decision.Result)
+	}
+	guard.Fail(ctx, "dave", "10.0.0.5", decision)
+
+	decision, _ = guard.Begin(ctx, "dave", "10.0.0.5", "ok")
+	guard.Fail(ctx, "dave", "10.0.0.5", decision)
+
+	if len(notifier.alerts) != 1 {
+		t.Fatalf("期望只发送1次告警，实际 %d 次", len(notifier.alerts))
+	}
+	if notifier.alerts[0].Username != "dave" {
+		t.Fatalf("告警账户错误: %+v", notifier.alerts[0])
+	}
+}
+
+// TestNotificationAlertNotifier 可疑登录告警通过通知服务发送给账户所有者，未知用户名不发送
+func TestNotificationAlertNotifier(t *testing.T) {
+	var mu sync.Mutex
+	var events []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/events/suspicious-login" {
+			t.Errorf("通知路径错误: %s", r.URL.Path)
+		}
+		var event map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&event)
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	am := newTestAuthManager(t)
+	owner := createTestUser(t, am, "grace", "guest")
+	am.config.NotificationURL = server.URL
+	guard := am.NewRedisLoginGuard(NewMemoryAttemptStore())
+	if _, ok := guard.notifier.(*NotificationAlertNotifier); !ok {
+		t.Fatalf("配置通知服务后应使用通知服务告警，实际 %T", guard.notifier)
+	}
+	guard.config = testGuardConfig()
+	ctx := context.Background()
+
+	for _, username := range []string{"grace", "nobody"} {
+		for i := 0; i < 3; i++ {
+			decision, _ := guard.Begin(ctx, username, "10.0.0.9", "")
+			guard.Fail(ctx, username, "10.0.0.9", decision)
+		}
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("期望只通知已存在的账户1次，实际 %d 次", len(events))
+	}
+	if events[0]["user_id"] != float64(owner.ID) || events[0]["username"] != "grace" || events[0]["failures"] != float64(3) {
+		t.Fatalf("通知内容错误: %+v", events[0])
+	}
+}
+
+// TestLoginGuardSuccessNotCountedAgainstIP 成功登录和验证码拒绝不计入IP失败次数
+func TestLoginGuardSuccessNotCountedAgainstIP(t *testing.T) {
+	config := testGuardConfig()
+	config.MaxIPFailures = 3
+	config.CaptchaThreshold = 1
+	guard := NewLoginGuard(NewMemoryAttemptStore(), config)
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		decision, _ := guard.Begin(ctx, "erin", "10.0.0.6", "")
+		if !decision.Allowed() {
+			t.Fatalf("第%d次正常登录被拒绝: %+v", i+1, decision)
+		}
+		guard.Succeed(ctx, "erin", "10.0.0.6")
+	}
+
+	decision, _ := guard.Begin(ctx, "frank", "10.0.0.6", "")
+	guard.Fail(ctx, "frank", "10.0.0.6", decision)
+	for i := 0; i < 5; i++ {
+		if decision, _ := guard.Begin(ctx, "frank", "10.0.0.6", ""); decision.Result != LoginCaptchaRequired {
+			t.Fatalf("期望要求验证码，实际 %s", decision.Result)
+		}
+	}
+	if n, _ := guard.store.Get(ctx, guard.ipKey("fail", "10.0.0.6")); n != 1 {
+		t.Fatalf("IP失败计数应只包含1次密码错误，实际 %d", n)
+	}
+	if status, _ := guard.Status(ctx, "frank"); status.Failures != 1 || status.Locked {
+		t.Fatalf("验证码拒绝不应计入账户失败: %+v", status)
+	}
+}
+
+// TestRedisAttemptStoreConcurrentAttempts Redis存储下并发尝试共享计数，计数键带过期时间
+func TestRedisAttemptStoreConcurrentAttempts(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	config := testGuardConfig()
+	config.MaxIPFailures = 20
+	// 两个实例共享同一个Redis
+	guards := []*LoginGuard{
+		NewLoginGuard(NewRedisAttemptStore(client), config),
+		NewLoginGuard(NewRedisAttemptStore(client), config),
+	}
+	ctx := context.Background()
+
+	var evaluated int64
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(guard *LoginGuard) {
+			defer wg.Done()
+			decision, err := guard.Begin(ctx, "grace", "10.0.0.7", "")
+			if err != nil {
+				t.Errorf("Begin失败: %v", err)
+				return
+			}
+			if decision.Allowed() {
+				atomic.AddInt64(&evaluated, 1)
+				guard.Fail(ctx, "grace", "10.0.0.7", decision)
+			}
+		}(guards[i%2])
+	}
+	wg.Wait()
+
+	if evaluated != 5 {
+		t.Fatalf("期望最多校验5次密码，实际 %d 次", evaluated)
+	}
+	failKey := config.KeyPrefix + "fail:account:grace"
+	if n, _ := server.Get(failKey); n != "40" {
+		t.Fatalf("期望账户计数为40，实际 %s", n)
+	}
+	if ttl := server.TTL(failKey); ttl <= 0 || ttl > config.FailureWindow {
+		t.Fatalf("计数键应在首次递增时设置过期时间，实际 %v", ttl)
+	}
+	if status, _ := guards[1].Status(ctx, "grace"); !status.Locked {
+		t.Fatalf("另一实例应看到锁定状态: %+v", status)
+	}
+
+	// 成功登录撤销本次IP计数，但不会创建不存在的键
+	decision, _ := guards[0].Begin(ctx, "heidi", "10.0.0.8", "")
+	guards[0].Succeed(ctx, "heidi", "10.0.0.8")
+	if n, _ := server.Get(config.KeyPrefix + "fail:ip:10.0.0.8"); !decision.Allowed() || n != "0" {
+		t.Fatalf("成功登录不应留下IP失败计数，实际 %s", n)
+	}
+	guards[0].Succeed(ctx, "heidi", "10.0.0.9")
+	if server.Exists(config.KeyPrefix + "fail:ip:10.0.0.9") {
+		t.Fatal("撤销计数不应创建新键")
+	}
+
+	server.FastForward(config.LockoutDuration + config.FailureWindow)
+	if decision, _ := guards[0].Begin(ctx, "grace", "10.0.0.7", ""); !decision.Allowed() {
+		t.Fatalf("窗口过期后应允许登录，实际 %+v", decision)
+	}
+}
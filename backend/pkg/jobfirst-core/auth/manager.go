@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"context"
+	"crypto/rsa"
 	"errors"
 	"fmt"
 	"log"
@@ -14,16 +16,119 @@ import (
 
 // AuthManager 认证管理器
 type AuthManager struct {
-	db     *gorm.DB
-	config AuthConfig
+	db         *gorm.DB
+	config     AuthConfig
+	loginGuard *LoginGuard
+	mfaPolicy  MFAPolicy
+
+	oauthConfig     OAuthConfig
+	oauthSigningKey *rsa.PrivateKey
+	oauthKeyID      string
 }
 
 // NewAuthManager 创建认证管理器
 func NewAuthManager(db *gorm.DB, config AuthConfig) *AuthManager {
-	return &AuthManager{
-		db:     db,
-		config: config,
+	am := &AuthManager{
+		db:          db,
+		config:      config,
+		mfaPolicy:   DefaultMFAPolicy(),
+		oauthConfig: DefaultOAuthConfig(),
 	}
+	am.loginGuard = am.newLoginGuard(NewMemoryAttemptStore())
+	return am
+}
+
+// newLoginGuard 使用认证配置创建登录防护器，配置了通知服务时告警发送给账户所有者
+func (am *AuthManager) newLoginGuard(store AttemptStore) *LoginGuard {
+	guard := NewLoginGuard(store, loginGuardConfigFrom(am.config))
+	if am.config.NotificationURL != "" {
+		guard.SetNotifier(NewNotificationAlertNotifier(am.config.NotificationURL, am.resolveUserID))
+	}
+	return guard
+}
+
+// resolveUserID 按用户名查询用户ID，用户不存在时返回0
+func (am *AuthManager) resolveUserID(ctx context.Context, username string) (uint, error) {
+	var user User
+	err := am.db.WithContext(ctx).Select("id").Where("username = ?", username).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return user.ID, nil
+}
+
+// loginGuardConfigFrom 根据认证配置生成登录防护配置
+func loginGuardConfigFrom(config AuthConfig) LoginGuardConfig {
+	guardConfig := DefaultLoginGuardConfig()
+	if config.MaxLoginAttempts > 0 {
+		guardConfig.MaxAccountFailures = int64(config.MaxLoginAttempts)
+	}
+	if config.LockoutDuration > 0 {
+		guardConfig.LockoutDuration = config.LockoutDuration
+		guardConfig.FailureWindow = config.LockoutDuration
+	}
+	return guardConfig
+}
+
+// SetLoginGuard 设置登录防护器（多实例部署时应使用Redis存储）
+func (am *AuthManager) SetLoginGuard(guard *LoginGuard) {
+	am.loginGuard = guard
+}
+
+// NewRedisLoginGuard 使用认证配置创建基于Redis的登录防护器
+func (am *AuthManager) NewRedisLoginGuard(store AttemptStore) *LoginGuard {
+	return am.newLoginGuard(store)
+}
+
+// UnlockAccount 管理员解锁账户
+func (am *AuthManager) UnlockAccount(username string) error {
+	return am.loginGuard.Unlock(context.Background(), username)
+}
+
+// UnlockIP 管理员解锁IP
+func (am *AuthManager) UnlockIP(clientIP string) error {
+	return am.loginGuard.UnlockIP(context.Background(), clientIP)
+}
+
+// GetLockoutStatus 查询账户锁定状态
+func (am *AuthManager) GetLockoutStatus(username string) (*LockoutStatus, error) {
+	return am.loginGuard.Status(context.Background(), username)
+}
+
+// checkCredentials 带防暴力破解的凭证校验，所有凭证错误统一返回同一错误
+func (am *AuthManager) checkCredentials(req LoginRequest, clientIP, userAgent string) (*User, error) {
+	ctx := context.Background()
+	decision, err := am.loginGuard.Begin(ctx, req.Username, clientIP, req.CaptchaToken)
+	if err != nil {
+		return nil, fmt.Errorf("登录防护检查失败: %w", err)
+	}
+	if !decision.Allowed() {
+		message, _ := loginFailureMessage(decision)
+		am.logLoginAttempt(0, clientIP, userAgent, "blocked", message)
+		return nil, errors.New(message)
+	}
+
+	// 用户不存在时仍执行一次哈希比较，保持响应时间一致
+	var user User
+	found := am.db.Where("username = ? AND status = 'active'", req.Username).First(&user).Error == nil
+	passwordHash := dummyPasswordHash()
+	if found {
+		passwordHash = user.PasswordHash
+	}
+	valid := am.validatePassword(req.Password, passwordHash)
+
+	if !found || !valid {
+		am.loginGuard.Fail(ctx, req.Username, clientIP, decision)
+		am.logLoginAttempt(user.ID, clientIP, userAgent, "failed", "用户名或密码错误")
+		message, _ := loginFailureMessage(&LoginDecision{Result: LoginAllowed})
+		return nil, errors.New(message)
+	}
+
+	am.loginGuard.Succeed(ctx, req.Username, clientIP)
+	return &user, nil
 }
 
 // Register 用户注册
@@ -72,16 +177,16 @@ func (am *AuthManager) Register(req RegisterRequest) (*RegisterResponse, error)
 
 // Login 用户登录
 func (am *AuthManager) Login(req LoginRequest, clientIP, userAgent string) (*LoginResponse, error) {
-	// 查找用户
-	var user User
-	if err := am.db.Where("username = ? AND status = 'active'", req.Username).First(&user).Error; err != nil {
-		return nil, errors.New("用户不存在或已被禁用")
+	// 校验凭证
+	userPtr, err := am.checkCredentials(req, clientIP, userAgent)
+	if err != nil {
+		return nil, err
 	}
+	user := *userPtr
 
-	// 验证密码
-	if !am.validatePassword(req.Password, user.PasswordHash) {
-		am.logLoginAttempt(user.ID, clientIP, userAgent, "failed", "密码错误")
-		return nil, errors.New("密码错误")
+	// 已启用MFA或角色要求MFA时，只签发MFA待验证token
+	if required, enrolled := am.requiresMFA(user.ID, user.Role); required {
+		return am.pendingMFAResponse(user, "user", enrolled)
 	}
 
 	// 生成JWT token
@@ -116,17 +221,12 @@ func (am *AuthManager) Login(req LoginRequest, clientIP, userAgent string) (*Log
 
 // SuperAdminLogin 超级管理员登录
 func (am *AuthManager) SuperAdminLogin(req LoginRequest, clientIP, userAgent string) (*LoginResponse, error) {
-	// 查找用户
-	var user User
-	if err := am.db.Where("username = ? AND status = 'active'", req.Username).First(&user).Error; err != nil {
-		return nil, errors.New("用户不存在或已被禁用")
-	}
-
-	// 验证密码
-	if !am.validatePassword(req.Password, user.PasswordHash) {
-		am.logLoginAttempt(user.ID, clientIP, userAgent, "failed", "密码错误")
-		return nil, errors.New("密码错误")
+	// 校验凭证
+	userPtr, err := am.checkCredentials(req, clientIP, userAgent)
+	if err != nil {
+		return nil, err
 	}
+	user := *userPtr
 
 	// 检查是否为超级管理员
 	var devTeam DevTeamUser
@@ -134,6 +234,11 @@ func (am *AuthManager) SuperAdminLogin(req LoginRequest, clientIP, userAgent str
 		return nil, errors.New("您不是超级管理员")
 	}
 
+	// 超级管理员按策略必须完成MFA
+	if required, enrolled := am.requiresMFA(user.ID, "super_admin"); required {
+		return am.pendingMFAResponse(user, "super_admin", enrolled)
+	}
+
 	// 生成JWT token
 	token, expiresAt, err := am.generateToken(user.ID, user.Username, "super_admin")
 	if err != nil {
@@ -289,20 +394,31 @@ func (am *AuthManager) validatePassword(password, hash string) bool {
 
 // generateToken 生成JWT token（支持量子认证格式）
 func (am *AuthManager) generateToken(userID uint, username, role string) (string, time.Time, error) {
+	return am.issueToken(userID, username, role, am.config.TokenExpiry, false, 0)
+}
+
+// issueToken 签发JWT token，mfaPending表示仅可用于完成MFA，mfaAt为最近一次MFA验证时间
+func (am *AuthManager) issueToken(userID uint, username, role string, expiry time.Duration, mfaPending bool, mfaAt int64) (string, time.Time, error) {
 	now := time.Now()
-	expiresAt := now.Add(am.config.TokenExpiry)
+	expiresAt := now.Add(expiry)
 
 	claims := &Claims{
-		UserID:   userID,
-		Username: username,
-		Role:     role,
-		Quantum:  false, // 本地生成的是标准Token
+		UserID:     userID,
+		Username:   username,
+		Role:       role,
+		Quantum:    false, // 本地生成的是标准Token
+		MFAPending: mfaPending,
+		MFAAt:      mfaAt,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(now),
 			NotBefore: jwt.NewNumericDate(now),
 		},
 	}
+	// 待验证token按token计数和作废，同一秒内签发的两个token必须不同
+	if mfaPending {
+		claims.ID = uuid.New().String()
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString([]byte(am.config.JWTSecret))
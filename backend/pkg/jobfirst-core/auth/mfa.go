@@ -0,0 +1,589 @@
+package auth
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MFA 要求级别
+const (
+	MFAOptional = "optional"
+	MFARequired = "required"
+)
+
+// TOTP 参数（RFC 6238，兼容主流验证器应用）
+const (
+	totpPeriod  = 30
+	totpDigits  = 6
+	totpSkew    = 1
+	secretBytes = 20
+)
+
+// MFA 相关错误
+var (
+	ErrMFANotEnrolled     = errors.New("未启用多因素认证")
+	ErrMFAAlreadyEnabled  = errors.New("多因素认证已启用")
+	ErrInvalidMFACode     = errors.New("验证码错误")
+	ErrMFAPendingRequired = errors.New("需要有效的多因素认证临时token")
+	ErrMFATooManyAttempts = errors.New("多因素认证失败次数过多，请稍后重试")
+)
+
+// MFAPolicy 多因素认证策略
+type MFAPolicy struct {
+	RoleRequirements   map[string]string `json:"role_requirements"`    // 角色 -> optional/required
+	StepUpWindow       time.Duration     `json:"step_up_window"`       // 敏感操作要求的最近一次MFA验证时间窗口
+	PendingTokenExpiry time.Duration     `json:"pending_token_expiry"` // MFA待验证token有效期
+	Issuer             string            `json:"issuer"`
+	RecoveryCodeCount  int               `json:"recovery_code_count"`
+	MaxTokenAttempts   int64             `json:"max_token_attempts"` // 单个MFA待验证token允许的验证次数，用完后token作废
+	MaxUserFailures    int64             `json:"max_user_failures"`  // 窗口内单用户MFA失败次数上限，达到后临时锁定
+	FailureWindow      time.Duration     `json:"failure_window"`     // 失败计数窗口
+	LockoutDuration    time.Duration     `json:"lockout_duration"`   // 锁定时长
+}
+
+// DefaultMFAPolicy 默认MFA策略：管理员登录必须MFA，其他角色可选
+func DefaultMFAPolicy() MFAPolicy {
+	return MFAPolicy{
+		RoleRequirements: map[string]string{
+			"super_admin":  MFARequired,
+			"system_admin": MFARequired,
+		},
+		StepUpWindow:       10 * time.Minute,
+		PendingTokenExpiry: 5 * time.Minute,
+		Issuer:             "JobFirst",
+		RecoveryCodeCount:  10,
+		MaxTokenAttempts:   5,
+		MaxUserFailures:    10,
+		FailureWindow:      15 * time.Minute,
+		LockoutDuration:    15 * time.Minute,
+	}
+}
+
+// Requirement 获取角色的MFA要求
+func (p MFAPolicy) Requirement(role string) string {
+	if requirement, exists := p.RoleRequirements[role]; exists {
+		return requirement
+	}
+	return MFAOptional
+}
+
+// UserMFA 用户多因素认证配置
+type UserMFA struct {
+	ID               uint       `json:"id" gorm:"primaryKey"`
+	UserID           uint       `json:"user_id" gorm:"uniqueIndex"`
+	SecretCiphertext string     `json:"-" gorm:"column:secret_ciphertext;type:varchar(255)"`
+	Enabled          bool       `json:"enabled" gorm:"default:false"`
+	ConfirmedAt      *time.Time `json:"confirmed_at"`
+	LastUsedStep     int64      `json:"-" gorm:"default:0"`
+	RecoveryCodes    string     `json:"-" gorm:"type:text"` // bcrypt哈希的JSON数组，使用后移除
+	CreatedAt        time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt        time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// TableName 指定表名
+func (UserMFA) TableName() string {
+	return "user_mfa"
+}
+
+// MFAEnrollment MFA注册信息
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"` // 前端据此生成二维码
+}
+
+// GenerateTOTPSecret 生成Base32编码的TOTP密钥
+func GenerateTOTPSecret() (string, error) {
+	buf := make([]byte, secretBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf), nil
+}
+
+// TOTPCode 计算指定时间的TOTP验证码
+func TOTPCode(secret string, t time.Time) (string, error) {
+	return totpCodeAt(secret, t.Unix()/totpPeriod, totpDigits)
+}
+
+// ValidateTOTP 校验TOTP验证码，允许前后一个时间步的偏差，返回匹配的时间步
+func ValidateTOTP(secret, code string, t time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := t.Unix() / totpPeriod
+	for offset := int64(-totpSkew); offset <= totpSkew; offset++ {
+		expected, err := totpCodeAt(secret, current+offset, totpDigits)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return current + offset, true
+		}
+	}
+	return 0, false
+}
+
+// ProvisioningURI 生成otpauth://注册URI
+func ProvisioningURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", totpDigits))
+	params.Set("period", fmt.Sprintf("%d", totpPeriod))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// totpCodeAt 按RFC 4226计算HOTP值
+func totpCodeAt(secret string, counter int64, digits int) (string, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", fmt.Errorf("无效的TOTP密钥: %w", err)
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod), nil
+}
+
+// generateRecoveryCodes 生成一次性恢复码及其哈希
+func generateRecoveryCodes(count int) ([]string, string, error) {
+	codes := make([]string, 0, count)
+	hashes := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, "", err
+		}
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(buf))
+		code := raw[:4] + "-" + raw[4:]
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, "", err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, string(hash))
+	}
+	encoded, err := json.Marshal(hashes)
+	if err != nil {
+		return nil, "", err
+	}
+	return codes, string(encoded), nil
+}
+
+// consumeRecoveryCode 校验并移除恢复码，返回剩余哈希
+func consumeRecoveryCode(stored, code string) (string, bool) {
+	var hashes []string
+	if err := json.Unmarshal([]byte(stored), &hashes); err != nil {
+		return stored, false
+	}
+	code = strings.ToLower(strings.TrimSpace(code))
+	for i, hash := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(code)) == nil {
+			remaining := append(hashes[:i:i], hashes[i+1:]...)
+			encoded, _ := json.Marshal(remaining)
+			return string(encoded), true
+		}
+	}
+	return stored, false
+}
+
+// encryptSecret 使用AES-GCM加密TOTP密钥
+func encryptSecret(secret, key string) (string, error) {
+	gcm, err := newSecretCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret 解密TOTP密钥
+func decryptSecret(ciphertext, key string) (string, error) {
+	gcm, err := newSecretCipher(key)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("密文长度错误")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func newSecretCipher(key string) (cipher.AEAD, error) {
+	sum := sha256.Sum256([]byte("mfa:" + key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SetMFAPolicy 设置MFA策略
+func (am *AuthManager) SetMFAPolicy(policy MFAPolicy) {
+	am.mfaPolicy = policy
+}
+
+// MFAPolicy 获取MFA策略
+func (am *AuthManager) MFAPolicy() MFAPolicy {
+	return am.mfaPolicy
+}
+
+// getUserMFA 获取用户MFA配置
+func (am *AuthManager) getUserMFA(userID uint) (*UserMFA, error) {
+	var mfa UserMFA
+	if err := am.db.Where("user_id = ?", userID).First(&mfa).Error; err != nil {
+		return nil, err
+	}
+	return &mfa, nil
+}
+
+// IsMFAEnabled 用户是否已启用MFA
+func (am *AuthManager) IsMFAEnabled(userID uint) bool {
+	mfa, err := am.getUserMFA(userID)
+	return err == nil && mfa.Enabled
+}
+
+// EnrollMFA 开始MFA注册，返回密钥和注册URI（确认前不生效）
+func (am *AuthManager) EnrollMFA(userID uint) (*MFAEnrollment, error) {
+	user, err := am.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := am.getUserMFA(userID)
+	if err == nil && existing.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return nil, fmt.Errorf("生成MFA密钥失败: %w", err)
+	}
+	ciphertext, err := encryptSecret(secret, am.config.JWTSecret)
+	if err != nil {
+		return nil, fmt.Errorf("加密MFA密钥失败: %w", err)
+	}
+
+	if existing != nil {
+		existing.SecretCiphertext = ciphertext
+		existing.LastUsedStep = 0
+		err = am.db.Save(existing).Error
+	} else {
+		err = am.db.Create(&UserMFA{UserID: userID, SecretCiphertext: ciphertext}).Error
+	}
+	if err != nil {
+		return nil, fmt.Errorf("保存MFA配置失败: %w", err)
+	}
+
+	return &MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: ProvisioningURI(am.mfaPolicy.Issuer, user.Username, secret),
+	}, nil
+}
+
+// ConfirmMFA 使用首个验证码确认MFA注册，返回一次性恢复码（仅展示一次）
+func (am *AuthManager) ConfirmMFA(userID uint, code string) ([]string, error) {
+	mfa, err := am.getUserMFA(userID)
+	if err != nil {
+		return nil, ErrMFANotEnrolled
+	}
+	if mfa.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := decryptSecret(mfa.SecretCiphertext, am.config.JWTSecret)
+	if err != nil {
+		return nil, fmt.Errorf("读取MFA密钥失败: %w", err)
+	}
+	step, ok := ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes(am.mfaPolicy.RecoveryCodeCount)
+	if err != nil {
+		return nil, fmt.Errorf("生成恢复码失败: %w", err)
+	}
+
+	now := time.Now()
+	mfa.Enabled = true
+	mfa.ConfirmedAt = &now
+	mfa.LastUsedStep = step
+	mfa.RecoveryCodes = hashes
+	if err := am.db.Save(mfa).Error; err != nil {
+		return nil, fmt.Errorf("保存MFA配置失败: %w", err)
+	}
+
+	am.logMFAEvent(userID, "mfa_enabled")
+	return codes, nil
+}
+
+// DisableMFA 关闭MFA
+func (am *AuthManager) DisableMFA(userID uint) error {
+	if err := am.db.Where("user_id = ?", userID).Delete(&UserMFA{}).Error; err != nil {
+		return fmt.Errorf("关闭MFA失败: %w", err)
+	}
+	am.logMFAEvent(userID, "mfa_disabled")
+	return nil
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，旧恢复码全部失效
+func (am *AuthManager) RegenerateRecoveryCodes(userID uint) ([]string, error) {
+	mfa, err := am.getUserMFA(userID)
+	if err != nil || !mfa.Enabled {
+		return nil, ErrMFANotEnrolled
+	}
+
+	codes, hashes, err := generateRecoveryCodes(am.mfaPolicy.RecoveryCodeCount)
+	if err != nil {
+		return nil, fmt.Errorf("生成恢复码失败: %w", err)
+	}
+	if err := am.db.Model(mfa).Update("recovery_codes", hashes).Error; err != nil {
+		return nil, fmt.Errorf("保存恢复码失败: %w", err)
+	}
+	am.logMFAEvent(userID, "mfa_recovery_codes_regenerated")
+	return codes, nil
+}
+
+// verifyMFACode 校验TOTP验证码或恢复码（同一时间步的验证码不能重复使用）
+func (am *AuthManager) verifyMFACode(userID uint, code string) error {
+	mfa, err := am.getUserMFA(userID)
+	if err != nil || !mfa.Enabled {
+		return ErrMFANotEnrolled
+	}
+
+	secret, err := decryptSecret(mfa.SecretCiphertext, am.config.JWTSecret)
+	if err != nil {
+		return fmt.Errorf("读取MFA密钥失败: %w", err)
+	}
+
+	if step, ok := ValidateTOTP(secret, code, time.Now()); ok {
+		result := am.db.Model(&UserMFA{}).
+			Where("id = ? AND last_used_step < ?", mfa.ID, step).
+			Update("last_used_step", step)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	if remaining, ok := consumeRecoveryCode(mfa.RecoveryCodes, code); ok {
+		result := am.db.Model(&UserMFA{}).
+			Where("id = ? AND recovery_codes = ?", mfa.ID, mfa.RecoveryCodes).
+			Update("recovery_codes", remaining)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return ErrInvalidMFACode
+		}
+		am.logMFAEvent(userID, "mfa_recovery_code_used")
+		return nil
+	}
+
+	return ErrInvalidMFACode
+}
+
+// requiresMFA 登录时是否需要MFA：已启用MFA的用户，或角色策略要求MFA
+func (am *AuthManager) requiresMFA(userID uint, role string) (required bool, enrolled bool) {
+	enrolled = am.IsMFAEnabled(userID)
+	return enrolled || am.mfaPolicy.Requirement(role) == MFARequired, enrolled
+}
+
+// pendingMFAResponse 密码校验通过但需要MFA时，签发仅可用于MFA流程的临时token
+func (am *AuthManager) pendingMFAResponse(user User, role string, enrolled bool) (*LoginResponse, error) {
+	token, expiresAt, err := am.issueToken(user.ID, user.Username, role, am.mfaPolicy.PendingTokenExpiry, true, 0)
+	if err != nil {
+		return nil, fmt.Errorf("生成token失败: %w", err)
+	}
+
+	message := "请输入多因素认证验证码"
+	if !enrolled {
+		message = "该角色要求启用多因素认证，请先完成注册"
+	}
+
+	return &LoginResponse{
+		Success:               true,
+		MFARequired:           true,
+		MFAEnrollmentRequired: !enrolled,
+		MFAToken:              token,
+		User:                  user,
+		ExpiresAt:             expiresAt.Format(time.RFC3339),
+		Message:               message,
+	}, nil
+}
+
+// mfaAttemptKey MFA尝试计数键，与登录防护共用计数存储
+func (am *AuthManager) mfaAttemptKey(kind, id string) string {
+	return am.loginGuard.config.KeyPrefix + "mfa:" + kind + ":" + id
+}
+
+// beginPendingTokenAttempt 校验前预先计入一次token使用次数，
+// 达到上限的token作废，需要重新输入密码登录
+func (am *AuthManager) beginPendingTokenAttempt(ctx context.Context, mfaToken string) (string, error) {
+	store := am.loginGuard.store
+	sum := sha256.Sum256([]byte(mfaToken))
+	tokenID := hex.EncodeToString(sum[:])
+
+	if ttl, err := store.TTL(ctx, am.mfaAttemptKey("revoked", tokenID)); err != nil {
+		return "", fmt.Errorf("查询MFA token状态失败: %w", err)
+	} else if ttl > 0 {
+		return "", ErrMFAPendingRequired
+	}
+	attempts, err := store.Incr(ctx, am.mfaAttemptKey("token", tokenID), am.mfaPolicy.PendingTokenExpiry)
+	if err != nil {
+		return "", fmt.Errorf("记录MFA尝试失败: %w", err)
+	}
+	if am.mfaPolicy.MaxTokenAttempts > 0 && attempts > am.mfaPolicy.MaxTokenAttempts {
+		am.revokePendingToken(ctx, tokenID)
+		return "", ErrMFAPendingRequired
+	}
+	return tokenID, nil
+}
+
+// revokePendingToken 作废MFA待验证token，直到其自然过期
+func (am *AuthManager) revokePendingToken(ctx context.Context, tokenID string) {
+	am.loginGuard.store.SetTTL(ctx, am.mfaAttemptKey("revoked", tokenID), am.mfaPolicy.PendingTokenExpiry)
+}
+
+// beginUserAttempt 校验前预先计入一次用户失败次数（与登录防护相同，防止并发请求绕过上限），
+// 超过上限时锁定该用户的MFA验证，登录和敏感操作验证共用同一计数
+func (am *AuthManager) beginUserAttempt(ctx context.Context, userID uint) error {
+	store := am.loginGuard.store
+	id := fmt.Sprintf("%d", userID)
+	if ttl, err := store.TTL(ctx, am.mfaAttemptKey("lock", id)); err != nil {
+		return fmt.Errorf("查询MFA锁定状态失败: %w", err)
+	} else if ttl > 0 {
+		return ErrMFATooManyAttempts
+	}
+	failures, err := store.Incr(ctx, am.mfaAttemptKey("fail", id), am.mfaPolicy.FailureWindow)
+	if err != nil {
+		return fmt.Errorf("记录MFA尝试失败: %w", err)
+	}
+	if am.mfaPolicy.MaxUserFailures > 0 && failures > am.mfaPolicy.MaxUserFailures {
+		// 锁定期间不再计数，解锁后重新开始计数
+		store.SetTTL(ctx, am.mfaAttemptKey("lock", id), am.mfaPolicy.LockoutDuration)
+		store.Del(ctx, am.mfaAttemptKey("fail", id))
+		am.logMFAEvent(userID, "mfa_locked")
+		return ErrMFATooManyAttempts
+	}
+	return nil
+}
+
+// verifyMFACodeLimited 计入失败次数的验证码校验，成功后清零用户失败计数
+func (am *AuthManager) verifyMFACodeLimited(ctx context.Context, userID uint, code string) error {
+	if err := am.beginUserAttempt(ctx, userID); err != nil {
+		return err
+	}
+	if err := am.verifyMFACode(userID, code); err != nil {
+		return err
+	}
+	am.loginGuard.store.Del(ctx, am.mfaAttemptKey("fail", fmt.Sprintf("%d", userID)))
+	return nil
+}
+
+// VerifyMFALogin 使用MFA待验证token和验证码完成登录。
+// 每个待验证token只能成功使用一次，失败次数达到上限后作废
+func (am *AuthManager) VerifyMFALogin(mfaToken, code, clientIP, userAgent string) (*LoginResponse, error) {
+	claims, err := am.ValidateToken(mfaToken)
+	if err != nil || !claims.MFAPending {
+		return nil, ErrMFAPendingRequired
+	}
+
+	ctx := context.Background()
+	tokenID, err := am.beginPendingTokenAttempt(ctx, mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := am.verifyMFACodeLimited(ctx, claims.UserID, code); err != nil {
+		am.logLoginAttempt(claims.UserID, clientIP, userAgent, "failed", "MFA验证失败")
+		return nil, err
+	}
+	am.revokePendingToken(ctx, tokenID)
+
+	user, err := am.GetUserByID(claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, expiresAt, err := am.issueToken(user.ID, user.Username, claims.Role, am.config.TokenExpiry, false, time.Now().Unix())
+	if err != nil {
+		return nil, fmt.Errorf("生成token失败: %w", err)
+	}
+
+	am.logLoginAttempt(user.ID, clientIP, userAgent, "success", "MFA验证成功")
+
+	response := &LoginResponse{
+		Success:   true,
+		Token:     token,
+		User:      *user,
+		ExpiresAt: expiresAt.Format(time.RFC3339),
+		Message:   "登录成功",
+	}
+	if devTeam, err := am.GetDevTeamUser(user.ID); err == nil {
+		response.DevTeam = *devTeam
+	}
+	return response, nil
+}
+
+// StepUpMFA 敏感操作前重新验证MFA，返回带新验证时间的token
+func (am *AuthManager) StepUpMFA(claims *Claims, code string) (string, time.Time, error) {
+	if err := am.verifyMFACodeLimited(context.Background(), claims.UserID, code); err != nil {
+		return "", time.Time{}, err
+	}
+	am.logMFAEvent(claims.UserID, "mfa_step_up")
+	return am.issueToken(claims.UserID, claims.Username, claims.Role, am.config.TokenExpiry, false, time.Now().Unix())
+}
+
+// logMFAEvent 记录MFA操作
+func (am *AuthManager) logMFAEvent(userID uint, event string) {
+	am.db.Create(&DevOperationLog{
+		UserID:           userID,
+		OperationType:    event,
+		OperationTarget:  "auth",
+		OperationDetails: "{}",
+		Status:           "success",
+		CreatedAt:        time.Now(),
+	})
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"encoding/base32"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestTOTPRFC6238Vectors 使用RFC 6238附录B的SHA1测试向量（取后6位）
+func TestTOTPRFC6238Vectors(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for unix, want := range vectors {
+		got, err := TOTPCode(secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("计算TOTP失败: %v", err)
+		}
+		if got != want {
+			t.Errorf("T=%d: 期望 %s，实际 %s", unix, want, got)
+		}
+	}
+}
+
+// TestValidateTOTPSkew 允许前后一个时间步的偏差
+func TestValidateTOTPSkew(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	previous, _ := TOTPCode(secret, now.Add(-30*time.Second))
+	if _, ok := ValidateTOTP(secret, previous, now); !ok {
+		t.Fatal("上一个时间步的验证码应通过")
+	}
+	stale, _ := TOTPCode(secret, now.Add(-90*time.Second))
+	if _, ok := ValidateTOTP(secret, stale, now); ok {
+		t.Fatal("过期的验证码不应通过")
+	}
+}
+
+// TestRecoveryCodesSingleUse 恢复码只能使用一次
+func TestRecoveryCodesSingleUse(t *testing.T) {
+	codes, stored, err := generateRecoveryCodes(3)
+	if err != nil {
+		t.Fatalf("生成恢复码失败: %v", err)
+	}
+	remaining, ok := consumeRecoveryCode(stored, strings.ToUpper(codes[1]))
+	if !ok {
+		t.Fatal("有效恢复码应通过")
+	}
+	if _, ok := consumeRecoveryCode(remaining, codes[1]); ok {
+		t.Fatal("恢复码不应重复使用")
+	}
+	if _, ok := consumeRecoveryCode(remaining, codes[0]); !ok {
+		t.Fatal("其他恢复码应仍然有效")
+	}
+}
+
+// TestSecretEncryptionRoundTrip TOTP密钥加密存储
+func TestSecretEncryptionRoundTrip(t *testing.T) {
+	ciphertext, err := encryptSecret("JBSWY3DPEHPK3PXP", "jwt-secret")
+	if err != nil {
+		t.Fatalf("加密失败: %v", err)
+	}
+	plain, err := decryptSecret(ciphertext, "jwt-secret")
+	if err != nil || plain != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("解密结果错误: %q, %v", plain, err)
+	}
+	if _, err := decryptSecret(ciphertext, "other-secret"); err == nil {
+		t.Fatal("使用错误密钥解密应失败")
+	}
+}
+
+// enrollTestMFA 为用户启用MFA，返回密钥、确认时使用的时间和恢复码
+func enrollTestMFA(t *testing.T, am *AuthManager, userID uint) (string, time.Time, []string) {
+	t.Helper()
+	enrollment, err := am.EnrollMFA(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirmedAt := time.Now()
+	code, _ := TOTPCode(enrollment.Secret, confirmedAt)
+	codes, err := am.ConfirmMFA(userID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enrollment.Secret, confirmedAt, codes
+}
+
+// TestMFALoginAndStepUp 注册、登录验证、重放拒绝和敏感操作二次验证
+func TestMFALoginAndStepUp(t *testing.T) {
+	am := newTestAuthManager(t)
+	policy := am.MFAPolicy()
+	policy.RecoveryCodeCount = 2
+	am.SetMFAPolicy(policy)
+	user := createTestUser(t, am, "mallory", "dev_lead")
+
+	secret, confirmedAt, recoveryCodes := enrollTestMFA(t, am, user.ID)
+	if !am.IsMFAEnabled(user.ID) || len(recoveryCodes) != 2 {
+		t.Fatalf("MFA应已启用并返回2个恢复码: %v", recoveryCodes)
+	}
+	if _, err := am.EnrollMFA(user.ID); !errors.Is(err, ErrMFAAlreadyEnabled) {
+		t.Fatalf("重复注册应被拒绝: %v", err)
+	}
+
+	pending, err := am.pendingMFAResponse(*user, user.Role, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirmCode, _ := TOTPCode(secret, confirmedAt)
+	if _, err := am.VerifyMFALogin(pending.MFAToken, confirmCode, "10.0.0.1", "test"); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("确认注册时用过的验证码不能再次使用: %v", err)
+	}
+	nextCode, _ := TOTPCode(secret, confirmedAt.Add(totpPeriod*time.Second))
+	resp, err := am.VerifyMFALogin(pending.MFAToken, nextCode, "10.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("MFA登录失败: %v", err)
+	}
+	claims, err := am.ValidateToken(resp.Token)
+	if err != nil || claims.MFAPending || claims.MFAAt == 0 {
+		t.Fatalf("应签发完成MFA的token: %+v, %v", claims, err)
+	}
+	if _, err := am.VerifyMFALogin(pending.MFAToken, recoveryCodes[0], "10.0.0.1", "test"); !errors.Is(err, ErrMFAPendingRequired) {
+		t.Fatalf("待验证token只能成功使用一次: %v", err)
+	}
+
+	if _, _, err := am.StepUpMFA(claims, nextCode); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("二次验证不能重放登录时的验证码: %v", err)
+	}
+	token, _, err := am.StepUpMFA(claims, recoveryCodes[0])
+	if err != nil {
+		t.Fatalf("使用恢复码二次验证失败: %v", err)
+	}
+	if stepped, err := am.ValidateToken(token); err != nil || stepped.MFAAt == 0 {
+		t.Fatalf("二次验证应签发带验证时间的token: %+v, %v", stepped, err)
+	}
+	if _, _, err := am.StepUpMFA(claims, recoveryCodes[0]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("恢复码只能使用一次: %v", err)
+	}
+}
+
+// TestMFAAttemptLimits 单个待验证token和单个用户的失败次数上限
+func TestMFAAttemptLimits(t *testing.T) {
+	am := newTestAuthManager(t)
+	policy := am.MFAPolicy()
+	policy.RecoveryCodeCount = 2
+	policy.MaxTokenAttempts = 3
+	policy.MaxUserFailures = 5
+	policy.LockoutDuration = 100 * time.Millisecond
+	am.SetMFAPolicy(policy)
+	user := createTestUser(t, am, "niaj", "dev_lead")
+	_, _, recoveryCodes := enrollTestMFA(t, am, user.ID)
+
+	// 并发猜测同一个token，最多校验3次，之后token作废
+	first, _ := am.pendingMFAResponse(*user, user.Role, true)
+	var evaluated, rejected int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := am.VerifyMFALogin(first.MFAToken, "abcdef", "10.0.0.1", "test")
+			switch {
+			case errors.Is(err, ErrInvalidMFACode):
+				atomic.AddInt64(&evaluated, 1)
+			case errors.Is(err, ErrMFAPendingRequired):
+				atomic.AddInt64(&rejected, 1)
+			default:
+				t.Errorf("意外的错误: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if evaluated != 3 || rejected != 5 {
+		t.Fatalf("期望校验3次、拒绝5次，实际 %d/%d", evaluated, rejected)
+	}
+	if _, err := am.VerifyMFALogin(first.MFAToken, recoveryCodes[0], "10.0.0.1", "test"); !errors.Is(err, ErrMFAPendingRequired) {
+		t.Fatalf("作废的token即使验证码正确也应被拒绝: %v", err)
+	}
+
+	// 换新token继续猜测时按用户累计，超过5次后登录和二次验证都被锁定
+	second, _ := am.pendingMFAResponse(*user, user.Role, true)
+	for i := 0; i < 2; i++ {
+		if _, err := am.VerifyMFALogin(second.MFAToken, "abcdef", "10.0.0.1", "test"); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("第%d次猜测: %v", i+1, err)
+		}
+	}
+	if _, err := am.VerifyMFALogin(second.MFAToken, recoveryCodes[0], "10.0.0.1", "test"); !errors.Is(err, ErrMFATooManyAttempts) {
+		t.Fatalf("期望用户被锁定: %v", err)
+	}
+	claims := &Claims{UserID: user.ID, Username: user.Username, Role: user.Role}
+	if _, _, err := am.StepUpMFA(claims, recoveryCodes[0]); !errors.Is(err, ErrMFATooManyAttempts) {
+		t.Fatalf("锁定期间二次验证也应被拒绝: %v", err)
+	}
+
+	time.Sleep(policy.LockoutDuration + 20*time.Millisecond)
+	if _, _, err := am.StepUpMFA(claims, recoveryCodes[0]); err != nil {
+		t.Fatalf("锁定到期后应允许验证: %v", err)
+	}
+}
@@ -0,0 +1,1061 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// OAuth2 授权类型
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+	GrantRefreshToken      = "refresh_token"
+)
+
+// OAuth2 作用域
+const (
+	ScopeOpenID           = "openid"
+	ScopeProfile          = "profile"
+	ScopeEmail            = "email"
+	ScopeJobsRead         = "jobs:read"
+	ScopeJobsWrite        = "jobs:write"
+	ScopeApplicationsRead = "applications:read"
+)
+
+// PKCEMethodS256 仅支持S256方式的PKCE（RFC 7636）
+const PKCEMethodS256 = "S256"
+
+// OAuth2 令牌类型
+const (
+	oauthTokenAccess  = "access"
+	oauthTokenRefresh = "refresh"
+)
+
+// OAuth2 错误码（RFC 6749 第4.1.2.1节、第5.2节）
+const (
+	OAuthErrInvalidRequest          = "invalid_request"
+	OAuthErrInvalidClient           = "invalid_client"
+	OAuthErrInvalidGrant            = "invalid_grant"
+	OAuthErrUnauthorizedClient      = "unauthorized_client"
+	OAuthErrUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthErrUnsupportedResponseType = "unsupported_response_type"
+	OAuthErrInvalidScope            = "invalid_scope"
+	OAuthErrAccessDenied            = "access_denied"
+)
+
+// OAuthError OAuth2协议错误，序列化后可直接作为令牌端点的错误响应
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func newOAuthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// OAuthScope 作用域定义，Permissions 为映射到的现有权限（resource:action）
+type OAuthScope struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions,omitempty"`
+	UserOnly    bool     `json:"-"` // 仅用户授权可用，客户端凭证模式不可申请
+}
+
+var oauthScopes = []OAuthScope{
+	{Name: ScopeOpenID, Description: "使用您的账号登录", UserOnly: true},
+	{Name: ScopeProfile, Description: "读取您的基本资料", Permissions: []string{"profile:read"}, UserOnly: true},
+	{Name: ScopeEmail, Description: "读取您的邮箱地址", Permissions: []string{"profile:read"}, UserOnly: true},
+	{Name: ScopeJobsRead, Description: "查看职位信息", Permissions: []string{"job:read"}},
+	{Name: ScopeJobsWrite, Description: "代表您发布和管理职位", Permissions: []string{"job:read", "job:write"}},
+	{Name: ScopeApplicationsRead, Description: "查看职位收到的候选人申请", Permissions: []string{"application:read"}},
+}
+
+// SupportedOAuthScopes 获取支持的作用域
+func SupportedOAuthScopes() []OAuthScope {
+	return append([]OAuthScope(nil), oauthScopes...)
+}
+
+// LookupOAuthScope 查找作用域定义
+func LookupOAuthScope(name string) (OAuthScope, bool) {
+	for _, scope := range oauthScopes {
+		if scope.Name == name {
+			return scope, true
+		}
+	}
+	return OAuthScope{}, false
+}
+
+// ParseScope 解析空格分隔的作用域字符串（去重并保持顺序）
+func ParseScope(scope string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, s := range strings.Fields(scope) {
+		if !seen[s] {
+			seen[s] = true
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// ScopePermissions 将作用域映射为现有权限
+func ScopePermissions(scopes []string) map[string]interface{} {
+	permissions := make(map[string]interface{})
+	for _, name := range scopes {
+		if scope, ok := LookupOAuthScope(name); ok {
+			for _, permission := range scope.Permissions {
+				permissions[permission] = true
+			}
+		}
+	}
+	return permissions
+}
+
+// HasScope 作用域字符串中是否包含指定作用域
+func HasScope(scope, required string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == required {
+			return true
+		}
+	}
+	return false
+}
+
+// OAuthConfig OAuth2/OIDC 授权服务配置
+type OAuthConfig struct {
+	Issuer                  string        `json:"issuer"`
+	AuthorizationEndpoint   string        `json:"authorization_endpoint"` // 用户同意页面地址，默认 {issuer}/oauth/authorize
+	AccessTokenExpiry       time.Duration `json:"access_token_expiry"`
+	RefreshTokenExpiry      time.Duration `json:"refresh_token_expiry"`
+	AuthorizationCodeExpiry time.Duration `json:"authorization_code_expiry"`
+	IDTokenExpiry           time.Duration `json:"id_token_expiry"`
+}
+
+// DefaultOAuthConfig 默认OAuth2配置
+func DefaultOAuthConfig() OAuthConfig {
+	return OAuthConfig{
+		Issuer:                  "http://localhost:8081",
+		AccessTokenExpiry:       time.Hour,
+		RefreshTokenExpiry:      30 * 24 * time.Hour,
+		AuthorizationCodeExpiry: 10 * time.Minute,
+		IDTokenExpiry:           time.Hour,
+	}
+}
+
+// OAuthClient 第三方应用
+type OAuthClient struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	ClientID         string    `json:"client_id" gorm:"type:varchar(64);uniqueIndex"`
+	ClientSecretHash string    `json:"-" gorm:"column:client_secret_hash;type:varchar(255)"`
+	Name             string    `json:"name" gorm:"type:varchar(100)"`
+	RedirectURIs     string    `json:"-" gorm:"column:redirect_uris;type:text"` // JSON数组
+	GrantTypes       string    `json:"grant_types" gorm:"type:varchar(255)"`    // 空格分隔
+	Scopes           string    `json:"scopes" gorm:"type:varchar(500)"`         // 空格分隔，允许申请的作用域
+	Public           bool      `json:"public" gorm:"default:false"`             // 公开客户端（无密钥，必须使用PKCE）
+	OwnerUserID      uint      `json:"owner_user_id" gorm:"index"`
+	Status           string    `json:"status" gorm:"type:enum('active','disabled');default:active"`
+	CreatedAt        time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt        time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// TableName 指定表名
+func (OAuthClient) TableName() string {
+	return "oauth_clients"
+}
+
+// GetRedirectURIs 获取已注册的回调地址
+func (c *OAuthClient) GetRedirectURIs() []string {
+	var uris []string
+	if c.RedirectURIs != "" {
+		json.Unmarshal([]byte(c.RedirectURIs), &uris)
+	}
+	return uris
+}
+
+// AllowsGrant 客户端是否允许使用指定授权类型
+func (c *OAuthClient) AllowsGrant(grantType string) bool {
+	return HasScope(c.GrantTypes, grantType)
+}
+
+// MarshalJSON 输出时展开回调地址
+func (c OAuthClient) MarshalJSON() ([]byte, error) {
+	type alias OAuthClient
+	return json.Marshal(struct {
+		alias
+		RedirectURIs []string `json:"redirect_uris"`
+	}{alias: alias(c), RedirectURIs: c.GetRedirectURIs()})
+}
+
+// OAuthAuthorizationCode 授权码（仅保存哈希，一次性使用）
+type OAuthAuthorizationCode struct {
+	ID                  uint       `json:"id" gorm:"primaryKey"`
+	CodeHash            string     `json:"-" gorm:"type:varchar(64);uniqueIndex"`
+	ClientID            string     `json:"client_id" gorm:"type:varchar(64);index"`
+	UserID              uint       `json:"user_id" gorm:"index"`
+	RedirectURI         string     `json:"redirect_uri" gorm:"type:varchar(500)"`
+	RedirectURIRequired bool       `json:"-" gorm:"default:false"` // 授权请求显式携带了redirect_uri，兑换时必须提供相同的值
+	Scope               string     `json:"scope" gorm:"type:varchar(500)"`
+	Nonce               string     `json:"-" gorm:"type:varchar(255)"`
+	CodeChallenge       string     `json:"-" gorm:"type:varchar(128)"`
+	CodeChallengeMethod string     `json:"-" gorm:"type:varchar(10)"`
+	GrantID             string     `json:"-" gorm:"type:varchar(36)"` // 兑换后生成的令牌链ID，重复使用时据此吊销
+	ExpiresAt           time.Time  `json:"expires_at"`
+	UsedAt              *time.Time `json:"used_at"`
+	CreatedAt           time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName 指定表名
+func (OAuthAuthorizationCode) TableName() string {
+	return "oauth_authorization_codes"
+}
+
+// OAuthToken 已签发的访问令牌/刷新令牌记录，用于内省和吊销
+type OAuthToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	TokenID   string     `json:"-" gorm:"type:varchar(64);uniqueIndex"` // 访问令牌为jti，刷新令牌为哈希
+	TokenType string     `json:"token_type" gorm:"type:varchar(16)"`
+	GrantID   string     `json:"grant_id" gorm:"type:varchar(36);index"` // 同一次授权及其刷新产生的令牌共享
+	ClientID  string     `json:"client_id" gorm:"type:varchar(64);index"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	Scope     string     `json:"scope" gorm:"type:varchar(500)"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName 指定表名
+func (OAuthToken) TableName() string {
+	return "oauth_tokens"
+}
+
+// OAuthConsent 用户对第三方应用的授权记录
+type OAuthConsent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex:idx_oauth_consent"`
+	ClientID  string    `json:"client_id" gorm:"type:varchar(64);uniqueIndex:idx_oauth_consent"`
+	Scope     string    `json:"scope" gorm:"type:varchar(500)"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// TableName 指定表名
+func (OAuthConsent) TableName() string {
+	return "oauth_consents"
+}
+
+// OAuthClientRequest 注册第三方应用请求
+type OAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types"`
+	Scopes       []string `json:"scopes" binding:"required"`
+	Public       bool     `json:"public"`
+}
+
+// OAuthClientRegistration 注册结果（密钥仅返回一次）
+type OAuthClientRegistration struct {
+	Client       *OAuthClient `json:"client"`
+	ClientSecret string       `json:"client_secret,omitempty"`
+}
+
+// AuthorizeRequest 授权请求参数
+type AuthorizeRequest struct {
+	ResponseType        string `json:"response_type" form:"response_type"`
+	ClientID            string `json:"client_id" form:"client_id"`
+	RedirectURI         string `json:"redirect_uri" form:"redirect_uri"`
+	Scope               string `json:"scope" form:"scope"`
+	State               string `json:"state" form:"state"`
+	Nonce               string `json:"nonce" form:"nonce"`
+	CodeChallenge       string `json:"code_challenge" form:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method" form:"code_challenge_method"`
+}
+
+// ConsentInfo 同意页面展示信息
+type ConsentInfo struct {
+	ClientID       string       `json:"client_id"`
+	ClientName     string       `json:"client_name"`
+	RedirectURI    string       `json:"redirect_uri"`
+	Scopes         []OAuthScope `json:"scopes"`
+	State          string       `json:"state,omitempty"`
+	AlreadyGranted bool         `json:"already_granted"` // 用户此前已同意全部作用域
+}
+
+// OAuthTokenResponse 令牌端点响应（RFC 6749 第5.1节）
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// TokenIntrospection 令牌内省结果（RFC 7662）
+type TokenIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+}
+
+// SetOAuthConfig 设置OAuth2配置
+func (am *AuthManager) SetOAuthConfig(config OAuthConfig) {
+	am.oauthConfig = config
+}
+
+// OAuthConfig 获取OAuth2配置
+func (am *AuthManager) OAuthConfig() OAuthConfig {
+	return am.oauthConfig
+}
+
+// RegisterOAuthClient 注册第三方应用
+func (am *AuthManager) RegisterOAuthClient(ownerUserID uint, req OAuthClientRequest) (*OAuthClientRegistration, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, errors.New("应用名称不能为空")
+	}
+
+	grantTypes := req.GrantTypes
+	if len(grantTypes) == 0 {
+		grantTypes = []string{GrantAuthorizationCode, GrantRefreshToken}
+	}
+	for _, grantType := range grantTypes {
+		switch grantType {
+		case GrantAuthorizationCode, GrantRefreshToken:
+		case GrantClientCredentials:
+			if req.Public {
+				return nil, errors.New("公开客户端不能使用client_credentials授权")
+			}
+		default:
+			return nil, fmt.Errorf("不支持的授权类型: %s", grantType)
+		}
+	}
+
+	needsRedirect := false
+	for _, grantType := range grantTypes {
+		if grantType == GrantAuthorizationCode {
+			needsRedirect = true
+		}
+	}
+	if needsRedirect && len(req.RedirectURIs) == 0 {
+		return nil, errors.New("授权码模式至少需要一个回调地址")
+	}
+	for _, uri := range req.RedirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range req.Scopes {
+		if _, ok := LookupOAuthScope(name); !ok {
+			return nil, fmt.Errorf("不支持的作用域: %s", name)
+		}
+	}
+
+	redirectURIs, _ := json.Marshal(req.RedirectURIs)
+	client := &OAuthClient{
+		ClientID:     uuid.New().String(),
+		Name:         req.Name,
+		RedirectURIs: string(redirectURIs),
+		GrantTypes:   strings.Join(grantTypes, " "),
+		Scopes:       strings.Join(ParseScope(strings.Join(req.Scopes, " ")), " "),
+		Public:       req.Public,
+		OwnerUserID:  ownerUserID,
+		Status:       "active",
+	}
+
+	var secret string
+	if !req.Public {
+		var err error
+		secret, err = randomToken(32)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		client.ClientSecretHash = string(hash)
+	}
+
+	if err := am.db.Create(client).Error; err != nil {
+		return nil, fmt.Errorf("注册应用失败: %w", err)
+	}
+	am.logOAuthEvent(ownerUserID, "oauth_client_registered", client.ClientID)
+
+	return &OAuthClientRegistration{Client: client, ClientSecret: secret}, nil
+}
+
+// ListOAuthClients 获取用户注册的应用
+func (am *AuthManager) ListOAuthClients(ownerUserID uint) ([]OAuthClient, error) {
+	var clients []OAuthClient
+	if err := am.db.Where("owner_user_id = ?", ownerUserID).Order("id DESC").Find(&clients).Error; err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// DeleteOAuthClient 删除应用并吊销其全部令牌
+func (am *AuthManager) DeleteOAuthClient(ownerUserID uint, clientID string) error {
+	result := am.db.Where("client_id = ? AND owner_user_id = ?", clientID, ownerUserID).Delete(&OAuthClient{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("应用不存在")
+	}
+
+	now := time.Now()
+	am.db.Model(&OAuthToken{}).Where("client_id = ? AND revoked_at IS NULL", clientID).Update("revoked_at", &now)
+	am.db.Where("client_id = ?", clientID).Delete(&OAuthConsent{})
+	am.logOAuthEvent(ownerUserID, "oauth_client_deleted", clientID)
+	return nil
+}
+
+// AuthenticateOAuthClient 校验客户端身份（公开客户端不允许携带密钥）
+func (am *AuthManager) AuthenticateOAuthClient(clientID, clientSecret string) (*OAuthClient, error) {
+	if clientID == "" {
+		return nil, newOAuthError(OAuthErrInvalidClient, "缺少client_id")
+	}
+
+	var client OAuthClient
+	if err := am.db.Where("client_id = ? AND status = ?", clientID, "active").First(&client).Error; err != nil {
+		return nil, newOAuthError(OAuthErrInvalidClient, "客户端认证失败")
+	}
+
+	if client.Public {
+		if clientSecret != "" {
+			return nil, newOAuthError(OAuthErrInvalidClient, "客户端认证失败")
+		}
+		return &client, nil
+	}
+
+	if clientSecret == "" || bcrypt.CompareHashAndPassword([]byte(client.ClientSecretHash), []byte(clientSecret)) != nil {
+		return nil, newOAuthError(OAuthErrInvalidClient, "客户端认证失败")
+	}
+	return &client, nil
+}
+
+// resolveAuthorizeRequest 校验授权请求，返回客户端、回调地址和最终作用域
+func (am *AuthManager) resolveAuthorizeRequest(req AuthorizeRequest) (*OAuthClient, string, []string, error) {
+	var client OAuthClient
+	if err := am.db.Where("client_id = ? AND status = ?", req.ClientID, "active").First(&client).Error; err != nil {
+		return nil, "", nil, newOAuthError(OAuthErrInvalidClient, "客户端不存在")
+	}
+
+	// 回调地址必须与注册值完全一致；仅注册一个时可省略
+	registered := client.GetRedirectURIs()
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(registered) == 1 {
+		redirectURI = registered[0]
+	}
+	matched := false
+	for _, uri := range registered {
+		if uri == redirectURI {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return nil, "", nil, newOAuthError(OAuthErrInvalidRequest, "回调地址未注册")
+	}
+
+	if req.ResponseType != "code" {
+		return nil, "", nil, newOAuthError(OAuthErrUnsupportedResponseType, "仅支持授权码模式")
+	}
+	if !client.AllowsGrant(GrantAuthorizationCode) {
+		return nil, "", nil, newOAuthError(OAuthErrUnauthorizedClient, "客户端未开通授权码模式")
+	}
+
+	if req.CodeChallenge != "" && req.CodeChallengeMethod != PKCEMethodS256 {
+		return nil, "", nil, newOAuthError(OAuthErrInvalidRequest, "code_challenge_method仅支持S256")
+	}
+	if client.Public && req.CodeChallenge == "" {
+		return nil, "", nil, newOAuthError(OAuthErrInvalidRequest, "公开客户端必须使用PKCE")
+	}
+
+	scopes, err := resolveScopes(&client, req.Scope, false)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return &client, redirectURI, scopes, nil
+}
+
+// resolveScopes 校验申请的作用域是否在客户端允许范围内，未指定时使用客户端全部作用域
+func resolveScopes(client *OAuthClient, requested string, clientCredentials bool) ([]string, error) {
+	scopes := ParseScope(requested)
+	if len(scopes) == 0 {
+		for _, name := range ParseScope(client.Scopes) {
+			if scope, ok := LookupOAuthScope(name); ok && !(clientCredentials && scope.UserOnly) {
+				scopes = append(scopes, name)
+			}
+		}
+		return scopes, nil
+	}
+
+	for _, name := range scopes {
+		scope, ok := LookupOAuthScope(name)
+		if !ok || !HasScope(client.Scopes, name) {
+			return nil, newOAuthError(OAuthErrInvalidScope, fmt.Sprintf("作用域不可用: %s", name))
+		}
+		if clientCredentials && scope.UserOnly {
+			return nil, newOAuthError(OAuthErrInvalidScope, fmt.Sprintf("客户端凭证模式不能申请作用域: %s", name))
+		}
+	}
+	return scopes, nil
+}
+
+// GetConsentInfo 获取同意页面信息
+func (am *AuthManager) GetConsentInfo(userID uint, req AuthorizeRequest) (*ConsentInfo, error) {
+	client, redirectURI, scopes, err := am.resolveAuthorizeRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ConsentInfo{
+		ClientID:    client.ClientID,
+		ClientName:  client.Name,
+		RedirectURI: redirectURI,
+		State:       req.State,
+	}
+	for _, name := range scopes {
+		scope, _ := LookupOAuthScope(name)
+		info.Scopes = append(info.Scopes, scope)
+	}
+
+	var consent OAuthConsent
+	if err := am.db.Where("user_id = ? AND client_id = ?", userID, client.ClientID).First(&consent).Error; err == nil {
+		info.AlreadyGranted = true
+		for _, name := range scopes {
+			if !HasScope(consent.Scope, name) {
+				info.AlreadyGranted = false
+				break
+			}
+		}
+	}
+	return info, nil
+}
+
+// ApproveAuthorization 用户同意授权，记录授权并返回携带授权码的回调地址
+func (am *AuthManager) ApproveAuthorization(userID uint, req AuthorizeRequest) (string, error) {
+	client, redirectURI, scopes, err := am.resolveAuthorizeRequest(req)
+	if err != nil {
+		return "", err
+	}
+
+	if err := am.saveConsent(userID, client.ClientID, scopes); err != nil {
+		return "", err
+	}
+
+	code, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	record := OAuthAuthorizationCode{
+		CodeHash:            hashOAuthToken(code),
+		ClientID:            client.ClientID,
+		UserID:              userID,
+		RedirectURI:         redirectURI,
+		RedirectURIRequired: req.RedirectURI != "",
+		Scope:               strings.Join(scopes, " "),
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		ExpiresAt:           time.Now().Add(am.oauthConfig.AuthorizationCodeExpiry),
+	}
+	if err := am.db.Create(&record).Error; err != nil {
+		return "", fmt.Errorf("生成授权码失败: %w", err)
+	}
+	am.logOAuthEvent(userID, "oauth_consent_granted", client.ClientID)
+
+	return am.buildRedirect(redirectURI, map[string]string{"code": code, "state": req.State})
+}
+
+// DenyAuthorization 用户拒绝授权，返回携带错误信息的回调地址
+func (am *AuthManager) DenyAuthorization(req AuthorizeRequest) (string, error) {
+	_, redirectURI, _, err := am.resolveAuthorizeRequest(req)
+	if err != nil {
+		return "", err
+	}
+	return am.buildRedirect(redirectURI, map[string]string{
+		"error":             OAuthErrAccessDenied,
+		"error_description": "用户拒绝授权",
+		"state":             req.State,
+	})
+}
+
+// buildRedirect 拼接回调参数（附带iss，RFC 9207）
+func (am *AuthManager) buildRedirect(redirectURI string, params map[string]string) (string, error) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	for key, value := range params {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	query.Set("iss", am.oauthConfig.Issuer)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// saveConsent 合并保存用户授权的作用域
+func (am *AuthManager) saveConsent(userID uint, clientID string, scopes []string) error {
+	var consent OAuthConsent
+	err := am.db.Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		consent = OAuthConsent{UserID: userID, ClientID: clientID, Scope: strings.Join(scopes, " ")}
+		return am.db.Create(&consent).Error
+	}
+	consent.Scope = strings.Join(ParseScope(consent.Scope+" "+strings.Join(scopes, " ")), " ")
+	return am.db.Save(&consent).Error
+}
+
+// ListOAuthConsents 获取用户已授权的应用
+func (am *AuthManager) ListOAuthConsents(userID uint) ([]OAuthConsent, error) {
+	var consents []OAuthConsent
+	if err := am.db.Where("user_id = ?", userID).Order("updated_at DESC").Find(&consents).Error; err != nil {
+		return nil, err
+	}
+	return consents, nil
+}
+
+// RevokeOAuthConsent 撤销对应用的授权并吊销相关令牌
+func (am *AuthManager) RevokeOAuthConsent(userID uint, clientID string) error {
+	if err := am.db.Where("user_id = ? AND client_id = ?", userID, clientID).Delete(&OAuthConsent{}).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := am.db.Model(&OAuthToken{}).
+		Where("user_id = ? AND client_id = ? AND revoked_at IS NULL", userID, clientID).
+		Update("revoked_at", &now).Error; err != nil {
+		return err
+	}
+	am.logOAuthEvent(userID, "oauth_consent_revoked", clientID)
+	return nil
+}
+
+// ExchangeAuthorizationCode 使用授权码换取令牌
+func (am *AuthManager) ExchangeAuthorizationCode(client *OAuthClient, code, redirectURI, codeVerifier string) (*OAuthTokenResponse, error) {
+	if !client.AllowsGrant(GrantAuthorizationCode) {
+		return nil, newOAuthError(OAuthErrUnauthorizedClient, "客户端未开通授权码模式")
+	}
+
+	var record OAuthAuthorizationCode
+	if err := am.db.Where("code_hash = ?", hashOAuthToken(code)).First(&record).Error; err != nil {
+		return nil, newOAuthError(OAuthErrInvalidGrant, "授权码无效")
+	}
+
+	// 先校验客户端和回调地址，其他客户端拿到授权码也无法使其失效或吊销令牌
+	if record.ClientID != client.ClientID {
+		return nil, newOAuthError(OAuthErrInvalidGrant, "授权码不属于该客户端")
+	}
+	// 授权请求携带了redirect_uri时兑换必须提供完全相同的值（RFC 6749 第4.1.3节）
+	if (record.RedirectURIRequired || redirectURI != "") && redirectURI != record.RedirectURI {
+		return nil, newOAuthError(OAuthErrInvalidGrant, "回调地址不匹配")
+	}
+
+	// 授权码重复使用视为泄露，吊销此前由该授权码签发的令牌
+	if record.UsedAt != nil {
+		am.revokeGrant(record.GrantID)
+		return nil, newOAuthError(OAuthErrInvalidGrant, "授权码已使用")
+	}
+
+	now := time.Now()
+	if now.After(record.ExpiresAt) {
+		return nil, newOAuthError(OAuthErrInvalidGrant, "授权码已过期")
+	}
+	if record.CodeChallenge != "" {
+		if !VerifyPKCE(codeVerifier, record.CodeChallenge, record.CodeChallengeMethod) {
+			return nil, newOAuthError(OAuthErrInvalidGrant, "code_verifier校验失败")
+		}
+	} else if client.Public {
+		return nil, newOAuthError(OAuthErrInvalidGrant, "公开客户端必须使用PKCE")
+	}
+
+	grantID := uuid.New().String()
+	result := am.db.Model(&OAuthAuthorizationCode{}).
+		Where("id = ? AND used_at IS NULL", record.ID).
+		Updates(map[string]interface{}{"used_at": &now, "grant_id": grantID})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, newOAuthError(OAuthErrInvalidGrant, "授权码已使用")
+	}
+
+	user, err := am.activeOAuthUser(record.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return am.issueOAuthTokens(client, user, ParseScope(record.Scope), grantID, record.Nonce)
+}
+
+// ClientCredentialsGrant 客户端凭证模式签发令牌（不代表任何用户）
+func (am *AuthManager) ClientCredentialsGrant(client *OAuthClient, scope string) (*OAuthTokenResponse, error) {
+	if client.Public || !client.AllowsGrant(GrantClientCredentials) {
+		return nil, newOAuthError(OAuthErrUnauthorizedClient, "客户端未开通客户端凭证模式")
+	}
+	scopes, err := resolveScopes(client, scope, true)
+	if err != nil {
+		return nil, err
+	}
+	return am.issueOAuthTokens(client, nil, scopes, uuid.New().String(), "")
+}
+
+// RefreshTokenGrant 使用刷新令牌换取新令牌（刷新令牌轮换，旧令牌立即失效）
+func (am *AuthManager) RefreshTokenGrant(client *OAuthClient, refreshToken, scope string) (*OAuthTokenResponse, error) {
+	if !client.AllowsGrant(GrantRefreshToken) {
+		return nil, newOAuthError(OAuthErrUnauthorizedClient, "客户端未开通刷新令牌")
+	}
+
+	var record OAuthToken
+	if err := am.db.Where("token_id = ? AND token_type = ?", hashOAuthToken(refreshToken), oauthTokenRefresh).First(&record).Error; err != nil {
+		return nil, newOAuthError(OAuthErrInvalidGrant, "刷新令牌无效")
+	}
+	if record.ClientID != client.ClientID {
+		return nil, newOAuthError(OAuthErrInvalidGrant, "刷新令牌不属于该客户端")
+	}
+
+	// 已轮换的刷新令牌再次出现视为泄露，吊销整条令牌链
+	if record.RevokedAt != nil {
+		am.revokeGrant(record.GrantID)
+		return nil, newOAuthError(OAuthErrInvalidGrant, "刷新令牌已失效")
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return nil, newOAuthError(OAuthErrInvalidGrant, "刷新令牌已过期")
+	}
+
+	// 新作用域只能缩小，不能扩大；校验失败不消耗刷新令牌
+	scopes := ParseScope(record.Scope)
+	if requested := ParseScope(scope); len(requested) > 0 {
+		for _, name := range requested {
+			if !HasScope(record.Scope, name) {
+				return nil, newOAuthError(OAuthErrInvalidScope, fmt.Sprintf("作用域超出原授权范围: %s", name))
+			}
+		}
+		scopes = requested
+	}
+
+	now := time.Now()
+	result := am.db.Model(&OAuthToken{}).Where("id = ? AND revoked_at IS NULL", record.ID).Update("revoked_at", &now)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, newOAuthError(OAuthErrInvalidGrant, "刷新令牌已失效")
+	}
+
+	var user *User
+	if record.UserID != 0 {
+		var err error
+		if user, err = am.activeOAuthUser(record.UserID); err != nil {
+			return nil, err
+		}
+	}
+	return am.issueOAuthTokens(client, user, scopes, record.GrantID, "")
+}
+
+// activeOAuthUser 获取状态正常的授权用户
+func (am *AuthManager) activeOAuthUser(userID uint) (*User, error) {
+	var user User
+	if err := am.db.First(&user, userID).Error; err != nil {
+		return nil, newOAuthError(OAuthErrInvalidGrant, "用户不存在")
+	}
+	if user.Status != "active" {
+		return nil, newOAuthError(OAuthErrInvalidGrant, "用户账户已被禁用")
+	}
+	return &user, nil
+}
+
+// issueOAuthTokens 签发访问令牌，并按需签发刷新令牌和ID令牌；user为空表示客户端凭证模式
+func (am *AuthManager) issueOAuthTokens(client *OAuthClient, user *User, scopes []string, grantID, nonce string) (*OAuthTokenResponse, error) {
+	now := time.Now()
+	expiresAt := now.Add(am.oauthConfig.AccessTokenExpiry)
+	scope := strings.Join(scopes, " ")
+	jti := uuid.New().String()
+
+	claims := &Claims{
+		Permissions: ScopePermissions(scopes),
+		ClientID:    client.ClientID,
+		Scope:       scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    am.oauthConfig.Issuer,
+			Audience:  jwt.ClaimStrings{client.ClientID},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+	var userID uint
+	if user != nil {
+		userID = user.ID
+		claims.UserID = user.ID
+		claims.Username = user.Username
+		claims.Role = user.Role
+		claims.Subject = oidcSubject(user)
+	} else {
+		claims.Role = "oauth_client"
+		claims.Subject = "client:" + client.ClientID
+	}
+
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(am.config.JWTSecret))
+	if err != nil {
+		return nil, err
+	}
+
+	records := []OAuthToken{{
+		TokenID:   jti,
+		TokenType: oauthTokenAccess,
+		GrantID:   grantID,
+		ClientID:  client.ClientID,
+		UserID:    userID,
+		Scope:     scope,
+		ExpiresAt: expiresAt,
+	}}
+
+	response := &OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(am.oauthConfig.AccessTokenExpiry.Seconds()),
+		Scope:       scope,
+	}
+
+	// 客户端凭证模式可随时重新申请，不签发刷新令牌
+	if user != nil && client.AllowsGrant(GrantRefreshToken) {
+		refreshToken, err := randomToken(32)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, OAuthToken{
+			TokenID:   hashOAuthToken(refreshToken),
+			TokenType: oauthTokenRefresh,
+			GrantID:   grantID,
+			ClientID:  client.ClientID,
+			UserID:    userID,
+			Scope:     scope,
+			ExpiresAt: now.Add(am.oauthConfig.RefreshTokenExpiry),
+		})
+		response.RefreshToken = refreshToken
+	}
+
+	if user != nil && HasScope(scope, ScopeOpenID) {
+		idToken, err := am.signIDToken(client, user, scopes, nonce, now)
+		if err != nil {
+			return nil, err
+		}
+		response.IDToken = idToken
+	}
+
+	if err := am.db.Create(&records).Error; err != nil {
+		return nil, fmt.Errorf("保存令牌失败: %w", err)
+	}
+	return response, nil
+}
+
+// revokeGrant 吊销整条令牌链
+func (am *AuthManager) revokeGrant(grantID string) {
+	if grantID == "" {
+		return
+	}
+	now := time.Now()
+	am.db.Model(&OAuthToken{}).Where("grant_id = ? AND revoked_at IS NULL", grantID).Update("revoked_at", &now)
+}
+
+// parseOAuthAccessToken 解析本服务签发的OAuth访问令牌（不含吊销检查）
+func (am *AuthManager) parseOAuthAccessToken(token string) (*Claims, error) {
+	claims := &Claims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return []byte(am.config.JWTSecret), nil
+	})
+	if err != nil || !parsed.Valid || claims.ClientID == "" || claims.ID == "" {
+		return nil, errors.New("无效的访问令牌")
+	}
+	return claims, nil
+}
+
+// CheckOAuthAccessToken 检查OAuth访问令牌是否已被吊销
+func (am *AuthManager) CheckOAuthAccessToken(claims *Claims) error {
+	if claims.ClientID == "" {
+		return nil
+	}
+	var record OAuthToken
+	if err := am.db.Where("token_id = ? AND token_type = ?", claims.ID, oauthTokenAccess).First(&record).Error; err != nil {
+		return errors.New("访问令牌不存在")
+	}
+	if record.RevokedAt != nil {
+		return errors.New("访问令牌已被吊销")
+	}
+	return nil
+}
+
+// IntrospectToken 令牌内省，客户端只能查询签发给自己的令牌
+func (am *AuthManager) IntrospectToken(client *OAuthClient, token string) *TokenIntrospection {
+	inactive := &TokenIntrospection{Active: false}
+
+	if claims, err := am.parseOAuthAccessToken(token); err == nil {
+		if claims.ClientID != client.ClientID || am.CheckOAuthAccessToken(claims) != nil {
+			return inactive
+		}
+		return &TokenIntrospection{
+			Active:    true,
+			Scope:     claims.Scope,
+			ClientID:  claims.ClientID,
+			Username:  claims.Username,
+			TokenType: "Bearer",
+			Subject:   claims.Subject,
+			ExpiresAt: claims.ExpiresAt.Unix(),
+			IssuedAt:  claims.IssuedAt.Unix(),
+			Issuer:    claims.Issuer,
+		}
+	}
+
+	var record OAuthToken
+	if err := am.db.Where("token_id = ? AND token_type = ?", hashOAuthToken(token), oauthTokenRefresh).First(&record).Error; err != nil {
+		return inactive
+	}
+	if record.ClientID != client.ClientID || record.RevokedAt != nil || time.Now().After(record.ExpiresAt) {
+		return inactive
+	}
+	introspection := &TokenIntrospection{
+		Active:    true,
+		Scope:     record.Scope,
+		ClientID:  record.ClientID,
+		TokenType: "refresh_token",
+		ExpiresAt: record.ExpiresAt.Unix(),
+		IssuedAt:  record.CreatedAt.Unix(),
+		Issuer:    am.oauthConfig.Issuer,
+	}
+	if user, err := am.GetUserByID(record.UserID); err == nil {
+		introspection.Username = user.Username
+		introspection.Subject = oidcSubject(user)
+	}
+	return introspection
+}
+
+// RevokeOAuthToken 吊销令牌（RFC 7009）；吊销刷新令牌时同时吊销同一授权下的访问令牌。
+// 无效或不属于该客户端的令牌按规范静默忽略
+func (am *AuthManager) RevokeOAuthToken(client *OAuthClient, token string) error {
+	now := time.Now()
+
+	if claims, err := am.parseOAuthAccessToken(token); err == nil {
+		if claims.ClientID != client.ClientID {
+			return nil
+		}
+		return am.db.Model(&OAuthToken{}).
+			Where("token_id = ? AND revoked_at IS NULL", claims.ID).
+			Update("revoked_at", &now).Error
+	}
+
+	var record OAuthToken
+	if err := am.db.Where("token_id = ? AND token_type = ?", hashOAuthToken(token), oauthTokenRefresh).First(&record).Error; err != nil {
+		return nil
+	}
+	if record.ClientID != client.ClientID {
+		return nil
+	}
+	am.revokeGrant(record.GrantID)
+	am.logOAuthEvent(record.UserID, "oauth_token_revoked", client.ClientID)
+	return nil
+}
+
+// VerifyPKCE 校验PKCE code_verifier（仅支持S256）
+func VerifyPKCE(verifier, challenge, method string) bool {
+	if method != PKCEMethodS256 || len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// validateRedirectURI 回调地址必须是https，本机调试允许http回环地址
+func validateRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("无效的回调地址: %s", raw)
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("回调地址不能包含片段: %s", raw)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := u.Hostname()
+		if host == "localhost" {
+			return nil
+		}
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+			return nil
+		}
+	}
+	return fmt.Errorf("回调地址必须使用https: %s", raw)
+}
+
+// oidcSubject 用户的OIDC主体标识
+func oidcSubject(user *User) string {
+	if user.UUID != "" {
+		return user.UUID
+	}
+	return strconv.FormatUint(uint64(user.ID), 10)
+}
+
+// randomToken 生成URL安全的随机令牌
+func randomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashOAuthToken 令牌只保存SHA-256哈希
+func hashOAuthToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// logOAuthEvent 记录OAuth操作
+func (am *AuthManager) logOAuthEvent(userID uint, event, clientID string) {
+	details, _ := json.Marshal(map[string]string{"client_id": clientID})
+	am.db.Create(&DevOperationLog{
+		UserID:           userID,
+		OperationType:    event,
+		OperationTarget:  "oauth",
+		OperationDetails: string(details),
+		Status:           "success",
+		CreatedAt:        time.Now(),
+	})
+}
@@ -0,0 +1,319 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TestVerifyPKCE 校验S256 PKCE，拒绝plain方式和错误的verifier
+func TestVerifyPKCE(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mJ92K1qAd9R4JYk7DIxSgwYjNz6ZQk"
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	if !VerifyPKCE(verifier, challenge, PKCEMethodS256) {
+		t.Fatal("正确的verifier应校验通过")
+	}
+	if VerifyPKCE(verifier+"x", challenge, PKCEMethodS256) {
+		t.Error("错误的verifier不应通过")
+	}
+	if VerifyPKCE(verifier, verifier, "plain") {
+		t.Error("不应支持plain方式")
+	}
+	if VerifyPKCE("short", challenge, PKCEMethodS256) {
+		t.Error("长度不足43的verifier不应通过")
+	}
+}
+
+// TestValidateRedirectURI 回调地址必须是https或本机回环地址
+func TestValidateRedirectURI(t *testing.T) {
+	valid := []string{
+		"https://partner.example.com/callback",
+		"http://localhost:3000/callback",
+		"http://127.0.0.1:8080/cb",
+	}
+	for _, uri := range valid {
+		if err := validateRedirectURI(uri); err != nil {
+			t.Errorf("%s 应为有效回调地址: %v", uri, err)
+		}
+	}
+
+	invalid := []string{
+		"http://partner.example.com/callback",
+		"https://partner.example.com/callback#frag",
+		"/relative/callback",
+		"javascript:alert(1)",
+	}
+	for _, uri := range invalid {
+		if err := validateRedirectURI(uri); err == nil {
+			t.Errorf("%s 应为无效回调地址", uri)
+		}
+	}
+}
+
+// TestResolveScopes 作用域必须在客户端允许范围内，客户端凭证模式不能申请用户作用域
+func TestResolveScopes(t *testing.T) {
+	client := &OAuthClient{Scopes: "openid profile jobs:read jobs:write"}
+
+	scopes, err := resolveScopes(client, "jobs:read jobs:read openid", false)
+	if err != nil || len(scopes) != 2 {
+		t.Fatalf("期望去重后2个作用域，实际 %v, err=%v", scopes, err)
+	}
+
+	if _, err := resolveScopes(client, "applications:read", false); err == nil {
+		t.Error("未授权给客户端的作用域应被拒绝")
+	}
+
+	if _, err := resolveScopes(client, "openid jobs:read", true); err == nil {
+		t.Error("客户端凭证模式不能申请openid")
+	}
+
+	scopes, err = resolveScopes(client, "", true)
+	if err != nil || len(scopes) != 2 || scopes[0] != ScopeJobsRead {
+		t.Errorf("默认作用域应排除用户作用域，实际 %v", scopes)
+	}
+}
+
+// TestScopePermissions 作用域映射为现有权限
+func TestScopePermissions(t *testing.T) {
+	permissions := ScopePermissions([]string{ScopeJobsWrite, ScopeApplicationsRead, "unknown"})
+	for _, want := range []string{"job:read", "job:write", "application:read"} {
+		if permissions[want] != true {
+			t.Errorf("缺少权限 %s", want)
+		}
+	}
+	if len(permissions) != 3 {
+		t.Errorf("期望3个权限，实际 %v", permissions)
+	}
+}
+
+// TestSignIDToken ID令牌可使用JWKS公开的公钥验签
+func TestSignIDToken(t *testing.T) {
+	key, err := GenerateOAuthSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	am := &AuthManager{oauthConfig: DefaultOAuthConfig()}
+	am.SetOAuthSigningKey(key)
+
+	user := &User{ID: 7, Username: "alice", Email: "alice@example.com", UUID: "u-7"}
+	client := &OAuthClient{ClientID: "partner"}
+	token, err := am.signIDToken(client, user, []string{ScopeOpenID, ScopeEmail}, "n-1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := &IDTokenClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(tk *jwt.Token) (interface{}, error) {
+		if tk.Header["kid"] != am.JWKS()["keys"].([]map[string]string)[0]["kid"] {
+			t.Error("kid与JWKS不一致")
+		}
+		return &key.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithAudience("partner"), jwt.WithIssuer(DefaultOAuthConfig().Issuer))
+	if err != nil || !parsed.Valid {
+		t.Fatalf("ID令牌验签失败: %v", err)
+	}
+	if claims.Subject != "u-7" || claims.Nonce != "n-1" || claims.Email != "alice@example.com" {
+		t.Errorf("ID令牌声明错误: %+v", claims)
+	}
+	if claims.PreferredUsername != "" {
+		t.Error("未申请profile作用域不应包含用户名")
+	}
+}
+
+const testRedirectURI = "https://partner.example.com/callback"
+
+// registerTestClient 注册应用并通过客户端认证
+func registerTestClient(t *testing.T, am *AuthManager, req OAuthClientRequest) *OAuthClient {
+	t.Helper()
+	registration, err := am.RegisterOAuthClient(1, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := am.AuthenticateOAuthClient(registration.Client.ClientID, registration.ClientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// authorizeTestCode 用户同意授权，返回回调地址中的授权码
+func authorizeTestCode(t *testing.T, am *AuthManager, userID uint, req AuthorizeRequest) string {
+	t.Helper()
+	req.ResponseType = "code"
+	redirect, err := am.ApproveAuthorization(userID, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(redirect)
+	return u.Query().Get("code")
+}
+
+func oauthErrorCode(err error) string {
+	var oauthErr *OAuthError
+	if errors.As(err, &oauthErr) {
+		return oauthErr.Code
+	}
+	return ""
+}
+
+// TestExchangeAuthorizationCode 授权码兑换：客户端和回调地址校验、PKCE、重复使用吊销令牌
+func TestExchangeAuthorizationCode(t *testing.T) {
+	am := newTestAuthManager(t)
+	user := createTestUser(t, am, "olivia", "guest")
+	clientReq := OAuthClientRequest{Name: "招聘助手", RedirectURIs: []string{testRedirectURI}, Scopes: []string{ScopeProfile, ScopeJobsRead}}
+	client := registerTestClient(t, am, clientReq)
+	other := registerTestClient(t, am, clientReq)
+
+	verifier := strings.Repeat("v", 43)
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	code := authorizeTestCode(t, am, user.ID, AuthorizeRequest{
+		ClientID: client.ClientID, RedirectURI: testRedirectURI, Scope: ScopeJobsRead,
+		CodeChallenge: challenge, CodeChallengeMethod: PKCEMethodS256,
+	})
+
+	// 以下失败都不会使授权码失效
+	if _, err := am.ExchangeAuthorizationCode(other, code, testRedirectURI, verifier); oauthErrorCode(err) != OAuthErrInvalidGrant {
+		t.Fatalf("其他客户端兑换: %v", err)
+	}
+	if _, err := am.ExchangeAuthorizationCode(client, code, "", verifier); oauthErrorCode(err) != OAuthErrInvalidGrant {
+		t.Fatalf("授权时携带了redirect_uri，兑换时不能省略: %v", err)
+	}
+	if _, err := am.ExchangeAuthorizationCode(client, code, testRedirectURI, strings.Repeat("x", 43)); oauthErrorCode(err) != OAuthErrInvalidGrant {
+		t.Fatalf("PKCE不匹配: %v", err)
+	}
+
+	tokens, err := am.ExchangeAuthorizationCode(client, code, testRedirectURI, verifier)
+	if err != nil {
+		t.Fatalf("兑换失败: %v", err)
+	}
+	if tokens.RefreshToken == "" || tokens.Scope != ScopeJobsRead {
+		t.Fatalf("令牌响应错误: %+v", tokens)
+	}
+	claims, err := am.parseOAuthAccessToken(tokens.AccessToken)
+	if err != nil || claims.UserID != user.ID || am.CheckOAuthAccessToken(claims) != nil {
+		t.Fatalf("访问令牌无效: %+v, %v", claims, err)
+	}
+
+	// 其他客户端重放不会吊销，本客户端重复兑换吊销整条令牌链
+	am.ExchangeAuthorizationCode(other, code, testRedirectURI, verifier)
+	if am.CheckOAuthAccessToken(claims) != nil {
+		t.Fatal("其他客户端重放授权码不应吊销令牌")
+	}
+	if _, err := am.ExchangeAuthorizationCode(client, code, testRedirectURI, verifier); oauthErrorCode(err) != OAuthErrInvalidGrant {
+		t.Fatalf("重复兑换: %v", err)
+	}
+	if am.CheckOAuthAccessToken(claims) == nil || am.IntrospectToken(client, tokens.RefreshToken).Active {
+		t.Fatal("授权码重复使用后应吊销已签发的令牌")
+	}
+
+	// 授权请求未携带redirect_uri时（仅注册一个回调地址），兑换时可以省略
+	code = authorizeTestCode(t, am, user.ID, AuthorizeRequest{ClientID: client.ClientID, Scope: ScopeJobsRead})
+	if _, err := am.ExchangeAuthorizationCode(client, code, "", ""); err != nil {
+		t.Fatalf("省略redirect_uri的兑换失败: %v", err)
+	}
+}
+
+// TestRefreshTokenRotation 刷新令牌轮换、作用域只能缩小、旧令牌重用吊销整条令牌链
+func TestRefreshTokenRotation(t *testing.T) {
+	am := newTestAuthManager(t)
+	user := createTestUser(t, am, "peggy", "guest")
+	clientReq := OAuthClientRequest{Name: "招聘助手", RedirectURIs: []string{testRedirectURI}, Scopes: []string{ScopeProfile, ScopeJobsRead}}
+	client := registerTestClient(t, am, clientReq)
+	other := registerTestClient(t, am, clientReq)
+
+	code := authorizeTestCode(t, am, user.ID, AuthorizeRequest{ClientID: client.ClientID, RedirectURI: testRedirectURI})
+	first, err := am.ExchangeAuthorizationCode(client, code, testRedirectURI, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := am.RefreshTokenGrant(other, first.RefreshToken, ""); oauthErrorCode(err) != OAuthErrInvalidGrant {
+		t.Fatalf("其他客户端刷新: %v", err)
+	}
+	if _, err := am.RefreshTokenGrant(client, first.RefreshToken, ScopeJobsWrite); oauthErrorCode(err) != OAuthErrInvalidScope {
+		t.Fatalf("扩大作用域: %v", err)
+	}
+
+	second, err := am.RefreshTokenGrant(client, first.RefreshToken, ScopeJobsRead)
+	if err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+	if second.Scope != ScopeJobsRead || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("刷新结果错误: %+v", second)
+	}
+	if am.IntrospectToken(client, first.RefreshToken).Active || !am.IntrospectToken(client, second.RefreshToken).Active {
+		t.Fatal("旧刷新令牌应失效，新刷新令牌应有效")
+	}
+
+	// 已轮换的刷新令牌被重用，整条令牌链（包括新令牌）都被吊销
+	if _, err := am.RefreshTokenGrant(client, first.RefreshToken, ""); oauthErrorCode(err) != OAuthErrInvalidGrant {
+		t.Fatalf("重用旧刷新令牌: %v", err)
+	}
+	if am.IntrospectToken(client, second.RefreshToken).Active || am.IntrospectToken(client, second.AccessToken).Active {
+		t.Fatal("刷新令牌重用后应吊销整条令牌链")
+	}
+	if _, err := am.RefreshTokenGrant(client, second.RefreshToken, ""); oauthErrorCode(err) != OAuthErrInvalidGrant {
+		t.Fatalf("吊销后刷新: %v", err)
+	}
+}
+
+// TestClientCredentialsAndRevocation 客户端凭证模式和令牌吊销
+func TestClientCredentialsAndRevocation(t *testing.T) {
+	am := newTestAuthManager(t)
+	user := createTestUser(t, am, "rupert", "guest")
+	service := registerTestClient(t, am, OAuthClientRequest{
+		Name: "职位同步", GrantTypes: []string{GrantClientCredentials}, Scopes: []string{ScopeProfile, ScopeJobsRead},
+	})
+	if _, err := am.RegisterOAuthClient(1, OAuthClientRequest{Name: "公开应用", GrantTypes: []string{GrantClientCredentials}, Scopes: []string{ScopeJobsRead}, Public: true}); err == nil {
+		t.Fatal("公开客户端不能注册客户端凭证模式")
+	}
+
+	if _, err := am.ClientCredentialsGrant(service, ScopeProfile); oauthErrorCode(err) != OAuthErrInvalidScope {
+		t.Fatalf("客户端凭证模式申请用户作用域: %v", err)
+	}
+	tokens, err := am.ClientCredentialsGrant(service, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.RefreshToken != "" || tokens.Scope != ScopeJobsRead {
+		t.Fatalf("客户端凭证令牌应只含非用户作用域且不带刷新令牌: %+v", tokens)
+	}
+	introspection := am.IntrospectToken(service, tokens.AccessToken)
+	if !introspection.Active || introspection.Subject != "client:"+service.ClientID {
+		t.Fatalf("内省结果错误: %+v", introspection)
+	}
+
+	// 其他客户端吊销无效，本客户端吊销后立即失效
+	partner := registerTestClient(t, am, OAuthClientRequest{Name: "招聘助手", RedirectURIs: []string{testRedirectURI}, Scopes: []string{ScopeJobsRead}})
+	if err := am.RevokeOAuthToken(partner, tokens.AccessToken); err != nil || !am.IntrospectToken(service, tokens.AccessToken).Active {
+		t.Fatalf("其他客户端不能吊销令牌: %v", err)
+	}
+	if err := am.RevokeOAuthToken(service, tokens.AccessToken); err != nil || am.IntrospectToken(service, tokens.AccessToken).Active {
+		t.Fatalf("吊销访问令牌失败: %v", err)
+	}
+
+	// 吊销刷新令牌时同一授权下的访问令牌一起失效
+	code := authorizeTestCode(t, am, user.ID, AuthorizeRequest{ClientID: partner.ClientID})
+	userTokens, err := am.ExchangeAuthorizationCode(partner, code, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := am.RevokeOAuthToken(partner, userTokens.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if am.IntrospectToken(partner, userTokens.AccessToken).Active || am.IntrospectToken(partner, userTokens.RefreshToken).Active {
+		t.Fatal("吊销刷新令牌后同一授权的令牌都应失效")
+	}
+	if err := am.RevokeOAuthToken(partner, "not-a-token"); err != nil {
+		t.Fatalf("无效令牌应静默忽略: %v", err)
+	}
+}
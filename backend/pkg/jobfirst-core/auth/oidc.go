@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IDTokenClaims OIDC ID令牌声明
+type IDTokenClaims struct {
+	Nonce             string `json:"nonce,omitempty"`
+	AuthTime          int64  `json:"auth_time,omitempty"`
+	Name              string `json:"name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// GenerateOAuthSigningKey 生成ID令牌签名密钥（仅适用于单实例或开发环境，多实例应配置共享密钥文件）
+func GenerateOAuthSigningKey() (*rsa.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, 2048)
+}
+
+// LoadOAuthSigningKey 从PEM文件加载RSA私钥（支持PKCS#1和PKCS#8）
+func LoadOAuthSigningKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取签名密钥失败: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("签名密钥不是有效的PEM格式")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析签名密钥失败: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("签名密钥必须是RSA私钥")
+	}
+	return key, nil
+}
+
+// SetOAuthSigningKey 设置ID令牌签名密钥
+func (am *AuthManager) SetOAuthSigningKey(key *rsa.PrivateKey) {
+	am.oauthSigningKey = key
+	am.oauthKeyID = ""
+	if key != nil {
+		sum := sha256.Sum256(key.PublicKey.N.Bytes())
+		am.oauthKeyID = base64.RawURLEncoding.EncodeToString(sum[:8])
+	}
+}
+
+// signIDToken 签发ID令牌（RS256）
+func (am *AuthManager) signIDToken(client *OAuthClient, user *User, scopes []string, nonce string, now time.Time) (string, error) {
+	if am.oauthSigningKey == nil {
+		return "", errors.New("未配置OIDC签名密钥")
+	}
+
+	scope := strings.Join(scopes, " ")
+	claims := IDTokenClaims{
+		Nonce: nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    am.oauthConfig.Issuer,
+			Subject:   oidcSubject(user),
+			Audience:  jwt.ClaimStrings{client.ClientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(am.oauthConfig.IDTokenExpiry)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	if user.LastLoginAt != nil {
+		claims.AuthTime = user.LastLoginAt.Unix()
+	}
+	if HasScope(scope, ScopeProfile) {
+		claims.Name = strings.TrimSpace(user.FirstName + " " + user.LastName)
+		claims.PreferredUsername = user.Username
+	}
+	if HasScope(scope, ScopeEmail) {
+		verified := user.EmailVerified
+		claims.Email = user.Email
+		claims.EmailVerified = &verified
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = am.oauthKeyID
+	return token.SignedString(am.oauthSigningKey)
+}
+
+// JWKS 公开ID令牌验签公钥（RFC 7517）
+func (am *AuthManager) JWKS() map[string]interface{} {
+	keys := []map[string]string{}
+	if am.oauthSigningKey != nil {
+		pub := am.oauthSigningKey.PublicKey
+		keys = append(keys, map[string]string{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": am.oauthKeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		})
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+// OIDCDiscovery OIDC发现文档（/.well-known/openid-configuration）
+func (am *AuthManager) OIDCDiscovery() map[string]interface{} {
+	issuer := strings.TrimSuffix(am.oauthConfig.Issuer, "/")
+	authorizationEndpoint := am.oauthConfig.AuthorizationEndpoint
+	if authorizationEndpoint == "" {
+		authorizationEndpoint = issuer + "/oauth/authorize"
+	}
+
+	scopes := make([]string, 0, len(oauthScopes))
+	for _, scope := range oauthScopes {
+		scopes = append(scopes, scope.Name)
+	}
+
+	return map[string]interface{}{
+		"issuer":                                         issuer,
+		"authorization_endpoint":                         authorizationEndpoint,
+		"token_endpoint":                                 issuer + "/oauth/token",
+		"introspection_endpoint":                         issuer + "/oauth/introspect",
+		"revocation_endpoint":                            issuer + "/oauth/revoke",
+		"userinfo_endpoint":                              issuer + "/oauth/userinfo",
+		"jwks_uri":                                       issuer + "/oauth/jwks",
+		"scopes_supported":                               scopes,
+		"response_types_supported":                       []string{"code"},
+		"grant_types_supported":                          []string{GrantAuthorizationCode, GrantClientCredentials, GrantRefreshToken},
+		"code_challenge_methods_supported":               []string{PKCEMethodS256},
+		"token_endpoint_auth_methods_supported":          []string{"client_secret_basic", "client_secret_post", "none"},
+		"subject_types_supported":                        []string{"public"},
+		"id_token_signing_alg_values_supported":          []string{"RS256"},
+		"claims_supported":                               []string{"sub", "iss", "aud", "exp", "iat", "nonce", "name", "preferred_username", "email", "email_verified"},
+		"authorization_response_iss_parameter_supported": true,
+	}
+}
+
+// OIDCUserInfo 获取OIDC用户信息，返回内容取决于令牌的作用域
+func (am *AuthManager) OIDCUserInfo(claims *Claims) (map[string]interface{}, error) {
+	if claims.UserID == 0 || (claims.ClientID != "" && !HasScope(claims.Scope, ScopeOpenID)) {
+		return nil, newOAuthError("insufficient_scope", "需要openid作用域")
+	}
+
+	user, err := am.GetUserByID(claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 第一方登录token视为拥有全部用户信息作用域
+	firstParty := claims.ClientID == ""
+	info := map[string]interface{}{"sub": oidcSubject(user)}
+	if firstParty || HasScope(claims.Scope, ScopeProfile) {
+		info["name"] = strings.TrimSpace(user.FirstName + " " + user.LastName)
+		info["preferred_username"] = user.Username
+		info["given_name"] = user.FirstName
+		info["family_name"] = user.LastName
+		if user.AvatarURL != "" {
+			info["picture"] = user.AvatarURL
+		}
+		info["updated_at"] = user.UpdatedAt.Unix()
+	}
+	if firstParty || HasScope(claims.Scope, ScopeEmail) {
+		info["email"] = user.Email
+		info["email_verified"] = user.EmailVerified
+	}
+	return info, nil
+}
@@ -76,6 +76,10 @@ type Claims struct {
 	Permissions map[string]interface{} `json:"permissions,omitempty"` // 天翼云量子Token的权限字段
 	Quantum     bool                   `json:"quantum,omitempty"`     // 是否为量子Token
 	QSeed       string                 `json:"qseed,omitempty"`       // 量子种子（用于密钥增强）
+	MFAPending  bool                   `json:"mfa_pending,omitempty"` // 密码已验证但尚未完成MFA，仅可访问MFA接口
+	MFAAt       int64                  `json:"mfa_at,omitempty"`      // 最近一次MFA验证的Unix时间，用于敏感操作二次验证
+	ClientID    string                 `json:"client_id,omitempty"`   // OAuth2访问令牌所属的第三方应用，第一方登录token为空
+	Scope       string                 `json:"scope,omitempty"`       // OAuth2访问令牌的作用域（空格分隔）
 	// 移除硬编码的 Exp 和 Iat，使用 jwt.RegisteredClaims 自动处理
 	// jwt.RegisteredClaims 可以正确解析 Python 的浮点数时间戳
 	jwt.RegisteredClaims
@@ -83,18 +87,22 @@ type Claims struct {
 
 // LoginRequest 登录请求
 type LoginRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Username     string `json:"username" binding:"required"`
+	Password     string `json:"password" binding:"required"`
+	CaptchaToken string `json:"captcha_token,omitempty"`
 }
 
 // LoginResponse 登录响应
 type LoginResponse struct {
-	Success   bool        `json:"success"`
-	Token     string      `json:"token"`
-	User      User        `json:"user"`
-	DevTeam   DevTeamUser `json:"dev_team,omitempty"`
-	ExpiresAt string      `json:"expires_at"`
-	Message   string      `json:"message"`
+	Success               bool        `json:"success"`
+	Token                 string      `json:"token"`
+	User                  User        `json:"user"`
+	DevTeam               DevTeamUser `json:"dev_team,omitempty"`
+	ExpiresAt             string      `json:"expires_at"`
+	Message               string      `json:"message"`
+	MFARequired           bool        `json:"mfa_required,omitempty"`
+	MFAEnrollmentRequired bool        `json:"mfa_enrollment_required,omitempty"`
+	MFAToken              string      `json:"mfa_token,omitempty"`
 }
 
 // RegisterRequest 注册请求
@@ -136,4 +144,5 @@ type AuthConfig struct {
 	PasswordMin      int           `json:"password_min_length"`
 	MaxLoginAttempts int           `json:"max_login_attempts"`
 	LockoutDuration  time.Duration `json:"lockout_duration"`
+	NotificationURL  string        `json:"notification_service_url"` // 可疑登录告警通过该通知服务发送，为空时仅记录日志
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -33,6 +34,8 @@ func (api *UnifiedAuthAPI) Start() error {
 	http.HandleFunc("/api/v1/auth/log", api.handleLogAccess)
 	http.HandleFunc("/api/v1/auth/roles", api.handleGetRoles)
 	http.HandleFunc("/api/v1/auth/permissions", api.handleGetPermissions)
+	http.HandleFunc("/api/v1/auth/lockout/status", api.handleLockoutStatus)
+	http.HandleFunc("/api/v1/auth/lockout/unlock", api.handleUnlock)
 	http.HandleFunc("/health", api.handleHealth)
 
 	// 启动服务器
@@ -49,8 +52,9 @@ func (api *UnifiedAuthAPI) handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
+		Username     string `json:"username"`
+		Password     string `json:"password"`
+		CaptchaToken string `json:"captcha_token"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -63,18 +67,29 @@ func (api *UnifiedAuthAPI) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := api.authSystem.Authenticate(req.Username, req.Password)
+	result, err := api.authSystem.AuthenticateAttempt(r.Context(), LoginAttempt{
+		Username:     req.Username,
+		Password:     req.Password,
+		ClientIP:     getClientIP(r),
+		UserAgent:    getUserAgent(r),
+		CaptchaToken: req.CaptchaToken,
+	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// 记录访问日志
-	api.authSystem.logAccess(0, "login", "auth",
-		map[bool]string{true: "success", false: "failed"}[result.Success],
-		getClientIP(r), getUserAgent(r))
-
 	w.Header().Set("Content-Type", "application/json")
+	if !result.Success {
+		// 成功登录的日志已在认证时记录
+		status := "failed"
+		if result.ErrorCode == ErrorCodeAccountLocked || result.ErrorCode == ErrorCodeTooManyAttempts {
+			status = "blocked"
+			w.Header().Set("Retry-After", strconv.Itoa(result.RetryAfter))
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+		api.authSystem.logAccess(0, "login", "auth", status, getClientIP(r), getUserAgent(r))
+	}
 	json.NewEncoder(w).Encode(result)
 }
 
@@ -297,6 +312,103 @@ func (api *UnifiedAuthAPI) handleGetPermissions(w http.ResponseWriter, r *http.R
 	json.NewEncoder(w).Encode(response)
 }
 
+// handleLockoutStatus 处理账户锁定状态查询请求（管理员）
+func (api *UnifiedAuthAPI) handleLockoutStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !api.requireAdmin(w, r) {
+		return
+	}
+
+	username := r.URL.Query().Get("username")
+	if username == "" {
+		http.Error(w, "username is required", http.StatusBadRequest)
+		return
+	}
+
+	status, err := api.authSystem.LoginGuard().Status(r.Context(), username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleUnlock 处理账户/IP解锁请求（管理员）
+func (api *UnifiedAuthAPI) handleUnlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !api.requireAdmin(w, r) {
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		IP       string `json:"ip"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Username == "" && req.IP == "" {
+		http.Error(w, "username or ip is required", http.StatusBadRequest)
+		return
+	}
+
+	guard := api.authSystem.LoginGuard()
+	if req.Username != "" {
+		if err := guard.Unlock(r.Context(), req.Username); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.IP != "" {
+		if err := guard.UnlockIP(r.Context(), req.IP); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	response := map[string]interface{}{
+		"success":   true,
+		"username":  req.Username,
+		"ip":        req.IP,
+		"timestamp": time.Now(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// requireAdmin 校验请求携带管理员token
+func (api *UnifiedAuthAPI) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if tokenString == "" {
+		http.Error(w, "Authorization required", http.StatusUnauthorized)
+		return false
+	}
+
+	result, err := api.authSystem.ValidateJWT(tokenString)
+	if err != nil || !result.Success {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return false
+	}
+
+	if result.User.Role != "admin" && result.User.Role != "super_admin" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
 // handleHealth 处理健康检查请求
 func (api *UnifiedAuthAPI) handleHealth(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
@@ -314,6 +426,7 @@ func (api *UnifiedAuthAPI) handleHealth(w http.ResponseWriter, r *http.Request)
 			"complete_jwt_validation",
 			"permission_management",
 			"access_logging",
+			"login_guard",
 			"database_optimization",
 		},
 	}
@@ -1,9 +1,12 @@
 package auth
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -15,6 +18,7 @@ type UnifiedAuthSystem struct {
 	db         *sql.DB
 	jwtSecret  string
 	roleConfig *RoleConfig
+	loginGuard *LoginGuard
 }
 
 // RoleConfig 角色配置
@@ -64,6 +68,18 @@ type AuthResult struct {
 	Permissions []string  `json:"permissions,omitempty"`
 	Error       string    `json:"error,omitempty"`
 	ErrorCode   string    `json:"error_code,omitempty"`
+	// 登录被限制时的附加信息
+	RetryAfter      int  `json:"retry_after_seconds,omitempty"`
+	CaptchaRequired bool `json:"captcha_required,omitempty"`
+}
+
+// LoginAttempt 登录尝试上下文
+type LoginAttempt struct {
+	Username     string
+	Password     string
+	ClientIP     string
+	UserAgent    string
+	CaptchaToken string
 }
 
 // NewUnifiedAuthSystem 创建统一认证系统
@@ -97,11 +113,47 @@ func NewUnifiedAuthSystem(db *sql.DB, jwtSecret string) *UnifiedAuthSystem {
 		},
 	}
 
-	return &UnifiedAuthSystem{
+	uas := &UnifiedAuthSystem{
 		db:         db,
 		jwtSecret:  jwtSecret,
 		roleConfig: roleConfig,
 	}
+	uas.loginGuard = uas.newLoginGuard(NewMemoryAttemptStore())
+	return uas
+}
+
+// newLoginGuard 创建登录防护器，配置了NOTIFICATION_SERVICE_URL时告警发送给账户所有者
+func (uas *UnifiedAuthSystem) newLoginGuard(store AttemptStore) *LoginGuard {
+	guard := NewLoginGuard(store, DefaultLoginGuardConfig())
+	if notificationURL := os.Getenv("NOTIFICATION_SERVICE_URL"); notificationURL != "" {
+		guard.SetNotifier(NewNotificationAlertNotifier(notificationURL, uas.resolveUserID))
+	}
+	return guard
+}
+
+// NewRedisLoginGuard 创建基于Redis的登录防护器
+func (uas *UnifiedAuthSystem) NewRedisLoginGuard(store AttemptStore) *LoginGuard {
+	return uas.newLoginGuard(store)
+}
+
+// resolveUserID 按用户名查询用户ID，用户不存在时返回0
+func (uas *UnifiedAuthSystem) resolveUserID(ctx context.Context, username string) (uint, error) {
+	var id uint
+	err := uas.db.QueryRowContext(ctx, "SELECT id FROM users WHERE username = ?", username).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// SetLoginGuard 设置登录防护器（多实例部署时应使用Redis存储）
+func (uas *UnifiedAuthSystem) SetLoginGuard(guard *LoginGuard) {
+	uas.loginGuard = guard
+}
+
+// LoginGuard 获取登录防护器
+func (uas *UnifiedAuthSystem) LoginGuard() *LoginGuard {
+	return uas.loginGuard
 }
 
 // InitializeDatabase 初始化数据库表结构
@@ -300,33 +352,33 @@ func (uas *UnifiedAuthSystem) createDefaultSuperAdmin() error {
 
 // Authenticate 用户认证
 func (uas *UnifiedAuthSystem) Authenticate(username, password string) (*AuthResult, error) {
-	// 查询用户信息
-	user, err := uas.getUserByUsername(username)
+	return uas.AuthenticateAttempt(context.Background(), LoginAttempt{Username: username, Password: password})
+}
+
+// AuthenticateAttempt 带防暴力破解的用户认证。
+// 用户不存在、账户禁用和密码错误返回相同的错误码，避免用户名枚举。
+func (uas *UnifiedAuthSystem) AuthenticateAttempt(ctx context.Context, attempt LoginAttempt) (*AuthResult, error) {
+	decision, err := uas.loginGuard.Begin(ctx, attempt.Username, attempt.ClientIP, attempt.CaptchaToken)
 	if err != nil {
-		return &AuthResult{
-			Success:   false,
-			Error:     "用户不存在",
-			ErrorCode: "USER_NOT_FOUND",
-		}, nil
+		return nil, err
+	}
+	if !decision.Allowed() {
+		return rejectedAuthResult(decision), nil
 	}
 
-	// 检查用户状态
-	if user.Status != "active" {
-		return &AuthResult{
-			Success:   false,
-			Error:     "用户账户已被禁用",
-			ErrorCode: "USER_DISABLED",
-		}, nil
+	// 查询用户信息（用户不存在时仍执行一次哈希比较，保持响应时间一致）
+	user, err := uas.getUserByUsername(attempt.Username)
+	passwordHash := dummyPasswordHash()
+	if err == nil {
+		passwordHash = user.PasswordHash
 	}
+	passwordErr := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(attempt.Password))
 
-	// 验证密码
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return &AuthResult{
-			Success:   false,
-			Error:     "密码错误",
-			ErrorCode: "INVALID_PASSWORD",
-		}, nil
+	if err != nil || user.Status != "active" || passwordErr != nil {
+		uas.loginGuard.Fail(ctx, attempt.Username, attempt.ClientIP, decision)
+		return rejectedAuthResult(decision), nil
 	}
+	uas.loginGuard.Succeed(ctx, attempt.Username, attempt.ClientIP)
 
 	// 获取用户权限
 	permissions, err := uas.getUserPermissions(user.Role)
@@ -352,7 +404,7 @@ func (uas *UnifiedAuthSystem) Authenticate(username, password string) (*AuthResu
 	uas.updateLastLogin(user.ID)
 
 	// 记录访问日志
-	uas.logAccess(user.ID, "login", "auth", "success", "", "")
+	uas.logAccess(user.ID, "login", "auth", "success", attempt.ClientIP, attempt.UserAgent)
 
 	return &AuthResult{
 		Success:     true,
@@ -362,6 +414,31 @@ func (uas *UnifiedAuthSystem) Authenticate(username, password string) (*AuthResu
 	}, nil
 }
 
+// rejectedAuthResult 构造登录失败结果
+func rejectedAuthResult(decision *LoginDecision) *AuthResult {
+	message, code := loginFailureMessage(decision)
+	return &AuthResult{
+		Success:         false,
+		Error:           message,
+		ErrorCode:       code,
+		RetryAfter:      retrySeconds(decision.RetryAfter),
+		CaptchaRequired: decision.CaptchaRequired,
+	}
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// dummyPasswordHash 用户不存在时用于比较的哈希
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("jobfirst-login-guard"), bcrypt.DefaultCost)
+	})
+	return string(dummyHash)
+}
+
 // ValidateJWT 验证JWT token
 func (uas *UnifiedAuthSystem) ValidateJWT(tokenString string) (*AuthResult, error) {
 	// 解析JWT token
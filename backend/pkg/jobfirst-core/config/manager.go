@@ -171,6 +171,9 @@ type AuthConfig struct {
 	PasswordMin      int    `mapstructure:"password_min_length"`
 	MaxLoginAttempts int    `mapstructure:"max_login_attempts"`
 	LockoutDuration  string `mapstructure:"lockout_duration"`
+	OAuthIssuer      string `mapstructure:"oauth_issuer"`
+	OAuthKeyFile     string `mapstructure:"oauth_signing_key_file"`
+	NotificationURL  string `mapstructure:"notification_service_url"`
 }
 
 // LogConfig 日志配置
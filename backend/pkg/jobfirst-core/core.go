@@ -114,7 +114,8 @@ func NewCore(configPath string) (*Core, error) {
 	}
 
 	// 5. 执行数据库迁移（迁移失败时继续启动服务）
-	if err := dbManager.Migrate(&auth.User{}, &auth.DevTeamUser{}, &auth.DevOperationLog{}); err != nil {
+	if err := dbManager.Migrate(&auth.User{}, &auth.DevTeamUser{}, &auth.DevOperationLog{}, &auth.UserMFA{},
+		&auth.OAuthClient{}, &auth.OAuthAuthorizationCode{}, &auth.OAuthToken{}, &auth.OAuthConsent{}); err != nil {
 		// 记录迁移错误但不中断服务启动
 		fmt.Printf("警告: 数据库迁移失败，但服务将继续启动: %v\n", err)
 	}
@@ -127,10 +128,37 @@ func NewCore(configPath string) (*Core, error) {
 		PasswordMin:      appConfig.Auth.PasswordMin,
 		MaxLoginAttempts: appConfig.Auth.MaxLoginAttempts,
 		LockoutDuration:  parseDuration(appConfig.Auth.LockoutDuration),
+		NotificationURL:  appConfig.Auth.NotificationURL,
+	}
+	if authConfig.NotificationURL == "" {
+		authConfig.NotificationURL = config.GetEnv("NOTIFICATION_SERVICE_URL", "http://localhost:8084")
 	}
 
 	authManager := auth.NewAuthManager(dbManager.GetDB(), authConfig)
 
+	// 登录防护计数使用Redis，保证多实例共享锁定状态
+	if redisManager := dbManager.GetRedis(); redisManager != nil {
+		store := auth.NewRedisAttemptStore(redisManager.GetClient())
+		authManager.SetLoginGuard(authManager.NewRedisLoginGuard(store))
+	}
+
+	// OAuth2/OIDC授权服务；多实例部署需配置共享的ID令牌签名密钥
+	oauthConfig := auth.DefaultOAuthConfig()
+	if appConfig.Auth.OAuthIssuer != "" {
+		oauthConfig.Issuer = appConfig.Auth.OAuthIssuer
+	}
+	authManager.SetOAuthConfig(oauthConfig)
+	if appConfig.Auth.OAuthKeyFile != "" {
+		signingKey, err := auth.LoadOAuthSigningKey(appConfig.Auth.OAuthKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载OIDC签名密钥失败: %w", err)
+		}
+		authManager.SetOAuthSigningKey(signingKey)
+	} else if signingKey, err := auth.GenerateOAuthSigningKey(); err == nil {
+		logManager.Warn("未配置OIDC签名密钥，使用临时密钥（重启后已签发的ID令牌将无法验签）")
+		authManager.SetOAuthSigningKey(signingKey)
+	}
+
 	// 7. 初始化团队管理器
 	teamManager := team.NewManager(dbManager.GetDB())
 
@@ -4,6 +4,7 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jobfirst/jobfirst-core/auth"
@@ -21,8 +22,57 @@ func NewAuthMiddleware(authManager *auth.AuthManager) *AuthMiddleware {
 	}
 }
 
-// RequireAuth 需要登录的中间件
+// RequireAuth 需要登录的中间件（拒绝尚未完成MFA的临时token）
 func (am *AuthMiddleware) RequireAuth() gin.HandlerFunc {
+	return am.authenticate(false)
+}
+
+// RequireAuthAllowMFAPending 允许MFA待验证token的登录中间件，仅用于MFA注册/验证接口
+func (am *AuthMiddleware) RequireAuthAllowMFAPending() gin.HandlerFunc {
+	return am.authenticate(true)
+}
+
+// RequireMFA 敏感操作二次验证中间件，要求在策略时间窗口内完成过MFA验证
+func (am *AuthMiddleware) RequireMFA() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   "未登录",
+			})
+			c.Abort()
+			return
+		}
+
+		if !am.authManager.IsMFAEnabled(userID.(uint)) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success":    false,
+				"error":      "该操作需要先启用多因素认证",
+				"error_code": "MFA_ENROLLMENT_REQUIRED",
+			})
+			c.Abort()
+			return
+		}
+
+		mfaAt := c.GetInt64("mfa_at")
+		window := am.authManager.MFAPolicy().StepUpWindow
+		if mfaAt == 0 || time.Since(time.Unix(mfaAt, 0)) > window {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success":    false,
+				"error":      "该操作需要重新进行多因素认证",
+				"error_code": "MFA_STEP_UP_REQUIRED",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// authenticate 校验token并设置用户上下文
+func (am *AuthMiddleware) authenticate(allowMFAPending bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log.Printf("DEBUG: 认证中间件 - 开始处理请求: %s %s", c.Request.Method, c.Request.URL.Path)
 		
@@ -60,17 +110,124 @@ func (am *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 		}
 
 		log.Printf("DEBUG: 认证中间件 - token验证成功，用户ID: %d, 用户名: %s, 角色: %s", claims.UserID, claims.Username, claims.Role)
-		
+
+		// OAuth2访问令牌只能访问声明了作用域的接口（见RequireScope）
+		if claims.ClientID != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success":    false,
+				"error":      "第三方应用令牌无权访问该接口",
+				"error_code": "OAUTH_TOKEN_NOT_ALLOWED",
+			})
+			c.Abort()
+			return
+		}
+
+		if claims.MFAPending && !allowMFAPending {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success":    false,
+				"error":      "请先完成多因素认证",
+				"error_code": "MFA_REQUIRED",
+			})
+			c.Abort()
+			return
+		}
+
 		// 设置用户信息到上下文
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("role", claims.Role)
+		c.Set("mfa_pending", claims.MFAPending)
+		c.Set("mfa_at", claims.MFAAt)
+		c.Set("claims", claims)
 
 		log.Printf("DEBUG: 认证中间件 - 用户信息已设置到上下文，继续处理请求")
 		c.Next()
 	}
 }
 
+// OptionalAuth 可选登录的中间件：携带有效的第一方token时设置用户上下文，
+// 未携带、token无效、MFA未完成或为第三方应用令牌时按匿名请求继续处理
+func (am *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := am.extractToken(c)
+		if token == "" {
+			c.Next()
+			return
+		}
+
+		claims, err := am.authManager.ValidateToken(token)
+		if err != nil || claims.ClientID != "" || claims.MFAPending {
+			c.Next()
+			return
+		}
+
+		c.Set("user_id", claims.UserID)
+		c.Set("username", claims.Username)
+		c.Set("role", claims.Role)
+		c.Set("mfa_at", claims.MFAAt)
+		c.Set("claims", claims)
+		c.Next()
+	}
+}
+
+// RequireScope 允许第三方应用访问的接口：第一方登录token直接放行，
+// OAuth2访问令牌需未被吊销且包含全部所需作用域
+func (am *AuthMiddleware) RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := am.extractToken(c)
+		if token == "" {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   "未登录",
+			})
+			c.Abort()
+			return
+		}
+
+		claims, err := am.authManager.ValidateToken(token)
+		if err == nil {
+			err = am.authManager.CheckOAuthAccessToken(claims)
+		}
+		if err != nil || claims.MFAPending {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   "无效的token",
+			})
+			c.Abort()
+			return
+		}
+
+		if claims.ClientID != "" {
+			for _, scope := range scopes {
+				if !auth.HasScope(claims.Scope, scope) {
+					c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+					c.JSON(http.StatusForbidden, gin.H{
+						"success":    false,
+						"error":      "令牌作用域不足",
+						"error_code": "INSUFFICIENT_SCOPE",
+					})
+					c.Abort()
+					return
+				}
+			}
+		}
+
+		// 客户端凭证模式的令牌不代表任何用户，不设置user_id，依赖用户身份的接口会拒绝
+		if claims.UserID != 0 {
+			c.Set("user_id", claims.UserID)
+			c.Set("username", claims.Username)
+		}
+		c.Set("role", claims.Role)
+		c.Set("oauth_client_id", claims.ClientID)
+		c.Set("oauth_scope", claims.Scope)
+		c.Set("permissions", claims.Permissions)
+		c.Set("claims", claims)
+		c.Next()
+	}
+}
+
 // RequireDevTeam 需要开发团队权限的中间件
 func (am *AuthMiddleware) RequireDevTeam() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,138 @@
+package rbac
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CasbinRule 策略规则持久化表
+type CasbinRule struct {
+	ID    uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	Ptype string `json:"ptype" gorm:"size:16;uniqueIndex:idx_casbin_rule"`
+	V0    string `json:"v0" gorm:"size:100;uniqueIndex:idx_casbin_rule"`
+	V1    string `json:"v1" gorm:"size:100;uniqueIndex:idx_casbin_rule"`
+	V2    string `json:"v2" gorm:"size:100;uniqueIndex:idx_casbin_rule"`
+	V3    string `json:"v3" gorm:"size:100;uniqueIndex:idx_casbin_rule"`
+	V4    string `json:"v4" gorm:"size:100;uniqueIndex:idx_casbin_rule"`
+	V5    string `json:"v5" gorm:"size:100;uniqueIndex:idx_casbin_rule"`
+}
+
+// TableName 指定表名
+func (CasbinRule) TableName() string {
+	return "casbin_rules"
+}
+
+// toSlice 转换为策略字段（去掉尾部空字段）
+func (r CasbinRule) toSlice() []string {
+	values := []string{r.Ptype, r.V0, r.V1, r.V2, r.V3, r.V4, r.V5}
+	end := len(values)
+	for end > 1 && values[end-1] == "" {
+		end--
+	}
+	return values[:end]
+}
+
+// GormAdapter 基于GORM的Casbin策略适配器
+type GormAdapter struct {
+	db *gorm.DB
+}
+
+// NewGormAdapter 创建GORM策略适配器并迁移策略表
+func NewGormAdapter(db *gorm.DB) (*GormAdapter, error) {
+	if err := db.AutoMigrate(&CasbinRule{}, &PolicyAuditLog{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate casbin tables: %w", err)
+	}
+	return &GormAdapter{db: db}, nil
+}
+
+var _ persist.Adapter = (*GormAdapter)(nil)
+
+// newRule 根据策略类型和字段构造规则
+func newRule(ptype string, rule []string) CasbinRule {
+	line := CasbinRule{Ptype: ptype}
+	fields := []*string{&line.V0, &line.V1, &line.V2, &line.V3, &line.V4, &line.V5}
+	for i, value := range rule {
+		if i >= len(fields) {
+			break
+		}
+		*fields[i] = value
+	}
+	return line
+}
+
+// LoadPolicy 从数据库加载全部策略
+func (a *GormAdapter) LoadPolicy(m model.Model) error {
+	var rules []CasbinRule
+	if err := a.db.Order("id").Find(&rules).Error; err != nil {
+		return fmt.Errorf("failed to load policies: %w", err)
+	}
+	for _, rule := range rules {
+		if err := persist.LoadPolicyArray(rule.toSlice(), m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SavePolicy 用模型中的策略覆盖数据库
+func (a *GormAdapter) SavePolicy(m model.Model) error {
+	var rules []CasbinRule
+	for _, sec := range []string{"p", "g"} {
+		assertions, ok := m[sec]
+		if !ok {
+			continue
+		}
+		for ptype, ast := range assertions {
+			for _, rule := range ast.Policy {
+				rules = append(rules, newRule(ptype, rule))
+			}
+		}
+	}
+
+	return a.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&CasbinRule{}).Error; err != nil {
+			return err
+		}
+		if len(rules) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(rules, 100).Error
+	})
+}
+
+// AddPolicy 保存单条策略（已存在时忽略，允许多实例并发初始化默认策略）
+func (a *GormAdapter) AddPolicy(sec string, ptype string, rule []string) error {
+	line := newRule(ptype, rule)
+	return a.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&line).Error
+}
+
+// RemovePolicy 删除单条策略
+func (a *GormAdapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	line := newRule(ptype, rule)
+	return a.db.Where("ptype = ? AND v0 = ? AND v1 = ? AND v2 = ? AND v3 = ? AND v4 = ? AND v5 = ?",
+		line.Ptype, line.V0, line.V1, line.V2, line.V3, line.V4, line.V5).
+		Delete(&CasbinRule{}).Error
+}
+
+// RemoveFilteredPolicy 按字段过滤删除策略
+func (a *GormAdapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	query := a.db.Where("ptype = ?", ptype)
+	for i, value := range fieldValues {
+		idx := fieldIndex + i
+		if value == "" || idx > 5 {
+			continue
+		}
+		query = query.Where(fmt.Sprintf("v%d = ?", idx), value)
+	}
+	return query.Delete(&CasbinRule{}).Error
+}
+
+// formatRule 将规则格式化为日志字符串
+func formatRule(ptype string, rule []string) string {
+	return ptype + ", " + strings.Join(rule, ", ")
+}
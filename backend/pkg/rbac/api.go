@@ -0,0 +1,202 @@
+package rbac
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAPI 策略管理API
+type AdminAPI struct {
+	manager *Manager
+}
+
+// NewAdminAPI 创建策略管理API
+func NewAdminAPI(manager *Manager) *AdminAPI {
+	return &AdminAPI{manager: manager}
+}
+
+// RegisterRoutes 注册策略管理路由（调用方负责挂载管理员鉴权中间件）
+func (api *AdminAPI) RegisterRoutes(r *gin.RouterGroup) {
+	rbacGroup := r.Group("/rbac")
+	{
+		rbacGroup.GET("/policies", api.listPolicies)
+		rbacGroup.POST("/policies", api.addPolicy)
+		rbacGroup.DELETE("/policies", api.removePolicy)
+		rbacGroup.GET("/roles", api.listRoles)
+		rbacGroup.POST("/roles", api.addRole)
+		rbacGroup.DELETE("/roles", api.removeRole)
+		rbacGroup.GET("/users/:user/permissions", api.getUserPermissions)
+		rbacGroup.POST("/reload", api.reload)
+		rbacGroup.GET("/audit", api.listAuditLogs)
+	}
+}
+
+type policyRequest struct {
+	Subject string `json:"subject" binding:"required"`
+	Domain  string `json:"domain"`
+	Object  string `json:"object" binding:"required"`
+	Action  string `json:"action" binding:"required"`
+}
+
+type roleRequest struct {
+	User   string `json:"user" binding:"required"`
+	Role   string `json:"role" binding:"required"`
+	Domain string `json:"domain"`
+}
+
+// domainOrDefault 未指定域时使用平台域
+func domainOrDefault(domain string) string {
+	if domain == "" {
+		return PlatformDomain
+	}
+	return domain
+}
+
+// operatorID 从上下文获取操作人
+func operatorID(c *gin.Context) string {
+	if userID, exists := c.Get("user_id"); exists {
+		return fmt.Sprintf("%v", userID)
+	}
+	return ""
+}
+
+func (api *AdminAPI) listPolicies(c *gin.Context) {
+	policies, err := api.manager.ListPolicies(c.Query("domain"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": policies})
+}
+
+func (api *AdminAPI) addPolicy(c *gin.Context) {
+	var req policyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	domain := domainOrDefault(req.Domain)
+
+	if err := api.manager.AddPolicyInDomain(req.Subject, domain, req.Object, req.Action); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	api.manager.RecordAudit(operatorID(c), AuditActionAddPolicy, domain,
+		[]string{req.Subject, domain, req.Object, req.Action}, c.ClientIP())
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "策略已添加"})
+}
+
+func (api *AdminAPI) removePolicy(c *gin.Context) {
+	var req policyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	domain := domainOrDefault(req.Domain)
+
+	if err := api.manager.RemovePolicyInDomain(req.Subject, domain, req.Object, req.Action); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	api.manager.RecordAudit(operatorID(c), AuditActionRemovePolicy, domain,
+		[]string{req.Subject, domain, req.Object, req.Action}, c.ClientIP())
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "策略已删除"})
+}
+
+func (api *AdminAPI) listRoles(c *gin.Context) {
+	roles, err := api.manager.ListGroupingPolicies(c.Query("domain"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": roles})
+}
+
+func (api *AdminAPI) addRole(c *gin.Context) {
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	domain := domainOrDefault(req.Domain)
+
+	if err := api.manager.AddRoleForUserInDomain(req.User, req.Role, domain); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	api.manager.RecordAudit(operatorID(c), AuditActionAddRole, domain,
+		[]string{req.User, req.Role, domain}, c.ClientIP())
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "角色已分配"})
+}
+
+func (api *AdminAPI) removeRole(c *gin.Context) {
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	domain := domainOrDefault(req.Domain)
+
+	if err := api.manager.RemoveRoleForUserInDomain(req.User, req.Role, domain); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	api.manager.RecordAudit(operatorID(c), AuditActionRemoveRole, domain,
+		[]string{req.User, req.Role, domain}, c.ClientIP())
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "角色已移除"})
+}
+
+func (api *AdminAPI) getUserPermissions(c *gin.Context) {
+	user := c.Param("user")
+	domain := domainOrDefault(c.Query("domain"))
+
+	permissions, err := api.manager.GetPermissionsForUserInDomain(user, domain)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"user":        user,
+			"domain":      domain,
+			"roles":       api.manager.GetRolesForUserInDomain(user, domain),
+			"permissions": permissions,
+		},
+	})
+}
+
+func (api *AdminAPI) reload(c *gin.Context) {
+	if err := api.manager.ReloadPolicy(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	api.manager.RecordAudit(operatorID(c), AuditActionReload, "", nil, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "策略已重新加载"})
+}
+
+func (api *AdminAPI) listAuditLogs(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	logs, total, err := api.manager.ListAuditLogs(c.Query("domain"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   logs,
+		"total":  total,
+	})
+}
@@ -0,0 +1,83 @@
+package rbac
+
+import (
+	"fmt"
+	"time"
+)
+
+// 策略变更操作
+const (
+	AuditActionAddPolicy    = "add_policy"
+	AuditActionRemovePolicy = "remove_policy"
+	AuditActionAddRole      = "add_role"
+	AuditActionRemoveRole   = "remove_role"
+	AuditActionReload       = "reload"
+)
+
+// PolicyAuditLog 策略变更审计日志
+type PolicyAuditLog struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	OperatorID string    `json:"operator_id" gorm:"size:64;index"`
+	Action     string    `json:"action" gorm:"size:32;index"`
+	Domain     string    `json:"domain" gorm:"size:100;index"`
+	Rule       string    `json:"rule" gorm:"size:512"`
+	IPAddress  string    `json:"ip_address" gorm:"size:45"`
+	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+// TableName 指定表名
+func (PolicyAuditLog) TableName() string {
+	return "rbac_policy_audit_logs"
+}
+
+// RecordAudit 记录策略变更（未配置数据库时忽略）
+func (m *Manager) RecordAudit(operatorID, action, domain string, rule []string, ipAddress string) error {
+	if m.db == nil {
+		return nil
+	}
+	entry := PolicyAuditLog{
+		OperatorID: operatorID,
+		Action:     action,
+		Domain:     domain,
+		Rule:       formatRule(ruleType(action), rule),
+		IPAddress:  ipAddress,
+		CreatedAt:  time.Now(),
+	}
+	if err := m.db.Create(&entry).Error; err != nil {
+		return fmt.Errorf("failed to record policy audit log: %w", err)
+	}
+	return nil
+}
+
+// ListAuditLogs 查询策略变更审计日志
+func (m *Manager) ListAuditLogs(domain string, limit, offset int) ([]PolicyAuditLog, int64, error) {
+	if m.db == nil {
+		return nil, 0, nil
+	}
+
+	query := m.db.Model(&PolicyAuditLog{})
+	if domain != "" {
+		query = query.Where("domain = ?", domain)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var logs []PolicyAuditLog
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
+
+// ruleType 操作对应的策略类型
+func ruleType(action string) string {
+	switch action {
+	case AuditActionAddRole, AuditActionRemoveRole:
+		return "g"
+	default:
+		return "p"
+	}
+}
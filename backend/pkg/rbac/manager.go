@@ -2,43 +2,83 @@ package rbac
 
 import (
 	"fmt"
+	"log"
+	"strings"
 
 	"github.com/casbin/casbin/v2"
 	"github.com/casbin/casbin/v2/model"
+	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
 )
 
-type Manager struct {
-	enforcer *casbin.Enforcer
-	db       *gorm.DB
+// 域定义：平台角色使用 platform 域，企业角色使用 company:<id> 域，
+// 企业角色模板定义在 company:* 域，对所有企业生效
+const (
+	PlatformDomain        = "platform"
+	CompanyTemplateDomain = "company:*"
+)
+
+// 企业角色（与 company-service 的 CompanyRole 取值一致）
+const (
+	CompanyRoleLegalRep       = "legal_rep"
+	CompanyRoleAuthorizedUser = "authorized_user"
+	CompanyRoleAdmin          = "admin"
+)
+
+// CompanyDomain 企业域名称
+func CompanyDomain(companyID uint) string {
+	return fmt.Sprintf("company:%d", companyID)
 }
 
-func NewManager(db *gorm.DB) (*Manager, error) {
-	// 创建Casbin模型
-	m, err := model.NewModelFromString(`
+// modelText 域RBAC模型：角色分配只在所属域内生效，company:* 模板策略通过keyMatch作用于所有企业域。
+// 平台角色（包括super_admin）不会自动获得企业域权限
+const modelText = `
 [request_definition]
-r = sub, obj, act
+r = sub, dom, obj, act
 
 [policy_definition]
-p = sub, obj, act
+p = sub, dom, obj, act
 
 [role_definition]
-g = _, _
+g = _, _, _
 
 [policy_effect]
 e = some(where (p.eft == allow))
 
 [matchers]
-m = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act
-`)
+m = g(r.sub, p.sub, r.dom) && keyMatch(r.dom, p.dom) && r.obj == p.obj && r.act == p.act
+`
+
+type Manager struct {
+	enforcer *casbin.SyncedEnforcer
+	db       *gorm.DB
+	watcher  *RedisWatcher
+}
+
+// NewManager 创建RBAC管理器；db不为空时策略持久化到数据库，所有实例共享
+func NewManager(db *gorm.DB) (*Manager, error) {
+	// 创建Casbin模型
+	m, err := model.NewModelFromString(modelText)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create casbin model: %w", err)
 	}
 
 	// 创建enforcer
-	enforcer, err := casbin.NewEnforcer(m)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create casbin enforcer: %w", err)
+	var enforcer *casbin.SyncedEnforcer
+	if db != nil {
+		adapter, err := NewGormAdapter(db)
+		if err != nil {
+			return nil, err
+		}
+		enforcer, err = casbin.NewSyncedEnforcer(m, adapter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create casbin enforcer: %w", err)
+		}
+	} else {
+		enforcer, err = casbin.NewSyncedEnforcer(m)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create casbin enforcer: %w", err)
+		}
 	}
 
 	manager := &Manager{
@@ -54,30 +94,60 @@ m = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act
 	return manager, nil
 }
 
+// EnableWatcher 启用Redis策略变更通知，其他实例修改策略后本实例自动重新加载
+func (m *Manager) EnableWatcher(client *redis.Client, channel string) error {
+	watcher, err := NewRedisWatcher(client, channel)
+	if err != nil {
+		return fmt.Errorf("failed to create policy watcher: %w", err)
+	}
+	if err := m.enforcer.SetWatcher(watcher); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to set policy watcher: %w", err)
+	}
+	// casbin默认回调直接调用内部Enforcer加载策略，不持有SyncedEnforcer的锁，改为加锁的重新加载
+	watcher.SetUpdateCallback(func(string) {
+		if err := m.enforcer.LoadPolicy(); err != nil {
+			log.Printf("failed to reload policies after update notification: %v", err)
+		}
+	})
+	m.watcher = watcher
+	return nil
+}
+
+// ReloadPolicy 从数据库重新加载策略
+func (m *Manager) ReloadPolicy() error {
+	return m.enforcer.LoadPolicy()
+}
+
+// Close 释放资源
+func (m *Manager) Close() {
+	if m.watcher != nil {
+		m.watcher.Close()
+	}
+}
+
 func (m *Manager) HasPermission(sub, obj, act string) (bool, error) {
-	return m.enforcer.Enforce(sub, obj, act)
+	return m.HasPermissionInDomain(sub, PlatformDomain, obj, act)
 }
 
 func (m *Manager) HasRole(user, role string) (bool, error) {
-	return m.enforcer.HasRoleForUser(user, role)
+	return m.HasRoleInDomain(user, role, PlatformDomain), nil
 }
 
 func (m *Manager) AddPolicy(sub, obj, act string) error {
-	_, err := m.enforcer.AddPolicy(sub, obj, act)
-	return err
+	return m.AddPolicyInDomain(sub, PlatformDomain, obj, act)
 }
 
 func (m *Manager) AddGroupingPolicy(user, role string) error {
-	_, err := m.enforcer.AddGroupingPolicy(user, role)
-	return err
+	return m.AddRoleForUserInDomain(user, role, PlatformDomain)
 }
 
 func (m *Manager) GetRolesForUser(user string) ([]string, error) {
-	return m.enforcer.GetRolesForUser(user)
+	return m.GetRolesForUserInDomain(user, PlatformDomain), nil
 }
 
 func (m *Manager) GetPermissionsForUser(user string) ([]string, error) {
-	permissions, err := m.enforcer.GetPermissionsForUser(user)
+	permissions, err := m.GetPermissionsForUserInDomain(user, PlatformDomain)
 	if err != nil {
 		return nil, err
 	}
@@ -85,13 +155,104 @@ func (m *Manager) GetPermissionsForUser(user string) ([]string, error) {
 	// 将 [][]string 转换为 []string
 	var result []string
 	for _, perm := range permissions {
-		if len(perm) >= 3 {
-			result = append(result, perm[1]+":"+perm[2]) // resource:action
+		if len(perm) >= 4 {
+			result = append(result, perm[2]+":"+perm[3]) // resource:action
+		}
+	}
+	return result, nil
+}
+
+// HasPermissionInDomain 检查主体在指定域内的权限
+func (m *Manager) HasPermissionInDomain(sub, dom, obj, act string) (bool, error) {
+	return m.enforcer.Enforce(sub, dom, obj, act)
+}
+
+// HasRoleInDomain 检查用户在指定域内是否拥有角色
+func (m *Manager) HasRoleInDomain(user, role, dom string) bool {
+	for _, r := range m.enforcer.GetRolesForUserInDomain(user, dom) {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// AddPolicyInDomain 添加域内权限策略
+func (m *Manager) AddPolicyInDomain(sub, dom, obj, act string) error {
+	_, err := m.enforcer.AddPolicy(sub, dom, obj, act)
+	return err
+}
+
+// RemovePolicyInDomain 删除域内权限策略
+func (m *Manager) RemovePolicyInDomain(sub, dom, obj, act string) error {
+	_, err := m.enforcer.RemovePolicy(sub, dom, obj, act)
+	return err
+}
+
+// AddRoleForUserInDomain 为用户分配域内角色
+func (m *Manager) AddRoleForUserInDomain(user, role, dom string) error {
+	_, err := m.enforcer.AddGroupingPolicy(user, role, dom)
+	return err
+}
+
+// RemoveRoleForUserInDomain 移除用户的域内角色
+func (m *Manager) RemoveRoleForUserInDomain(user, role, dom string) error {
+	_, err := m.enforcer.RemoveGroupingPolicy(user, role, dom)
+	return err
+}
+
+// GetRolesForUserInDomain 获取用户在域内的角色
+func (m *Manager) GetRolesForUserInDomain(user, dom string) []string {
+	return m.enforcer.GetRolesForUserInDomain(user, dom)
+}
+
+// GetPermissionsForUserInDomain 获取用户在域内的全部权限（包括角色模板继承的权限）
+func (m *Manager) GetPermissionsForUserInDomain(user, dom string) ([][]string, error) {
+	subjects := append([]string{user}, m.enforcer.GetRolesForUserInDomain(user, dom)...)
+	policies, err := m.enforcer.GetPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	var result [][]string
+	for _, policy := range policies {
+		if len(policy) < 4 || !domainMatches(dom, policy[1]) {
+			continue
+		}
+		for _, subject := range subjects {
+			if policy[0] == subject {
+				result = append(result, policy)
+				break
+			}
 		}
 	}
 	return result, nil
 }
 
+// ListPolicies 列出权限策略，dom为空时返回全部
+func (m *Manager) ListPolicies(dom string) ([][]string, error) {
+	if dom == "" {
+		return m.enforcer.GetPolicy()
+	}
+	return m.enforcer.GetFilteredPolicy(1, dom)
+}
+
+// ListGroupingPolicies 列出角色分配，dom为空时返回全部
+func (m *Manager) ListGroupingPolicies(dom string) ([][]string, error) {
+	if dom == "" {
+		return m.enforcer.GetGroupingPolicy()
+	}
+	return m.enforcer.GetFilteredGroupingPolicy(2, dom)
+}
+
+// domainMatches 请求域是否匹配策略域（支持 company:* 模板）
+func domainMatches(requestDomain, policyDomain string) bool {
+	if strings.HasSuffix(policyDomain, "*") {
+		return strings.HasPrefix(requestDomain, strings.TrimSuffix(policyDomain, "*"))
+	}
+	return requestDomain == policyDomain
+}
+
 func (m *Manager) InitializeDefaultPolicies() error {
 	// 添加角色
 	roles := []string{"super_admin", "admin", "dev_team", "user"}
@@ -142,5 +303,36 @@ func (m *Manager) InitializeDefaultPolicies() error {
 		}
 	}
 
+	// 企业角色模板（对所有企业域生效）
+	companyPolicies := [][]string{
+		{CompanyRoleLegalRep, "company", "read"},
+		{CompanyRoleLegalRep, "company", "write"},
+		{CompanyRoleLegalRep, "company_user", "read"},
+		{CompanyRoleLegalRep, "company_user", "write"},
+		{CompanyRoleLegalRep, "company_user", "delete"},
+		{CompanyRoleLegalRep, "document", "read"},
+		{CompanyRoleLegalRep, "document", "write"},
+		{CompanyRoleLegalRep, "job", "read"},
+		{CompanyRoleLegalRep, "job", "write"},
+
+		{CompanyRoleAdmin, "company", "read"},
+		{CompanyRoleAdmin, "company", "write"},
+		{CompanyRoleAdmin, "company_user", "read"},
+		{CompanyRoleAdmin, "document", "read"},
+		{CompanyRoleAdmin, "document", "write"},
+		{CompanyRoleAdmin, "job", "read"},
+		{CompanyRoleAdmin, "job", "write"},
+
+		{CompanyRoleAuthorizedUser, "company", "read"},
+		{CompanyRoleAuthorizedUser, "document", "read"},
+		{CompanyRoleAuthorizedUser, "job", "read"},
+	}
+
+	for _, policy := range companyPolicies {
+		if err := m.AddPolicyInDomain(policy[0], CompanyTemplateDomain, policy[1], policy[2]); err != nil {
+			return fmt.Errorf("failed to add company policy %v: %w", policy, err)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,266 @@
+package rbac
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB 基于临时文件的SQLite，多个Manager共用时模拟多个服务实例连接同一个库
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "rbac.db") + "?_busy_timeout=5000"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+func newTestManager(t *testing.T, db *gorm.DB) *Manager {
+	t.Helper()
+	manager, err := NewManager(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(manager.Close)
+	return manager
+}
+
+func mustEnforce(t *testing.T, m *Manager, sub, dom, obj, act string) bool {
+	t.Helper()
+	allowed, err := m.HasPermissionInDomain(sub, dom, obj, act)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return allowed
+}
+
+func countRules(t *testing.T, db *gorm.DB) int64 {
+	t.Helper()
+	var count int64
+	if err := db.Model(&CasbinRule{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestManagerPersistsPoliciesAcrossRestart(t *testing.T) {
+	db := newTestDB(t)
+	first := newTestManager(t, db)
+	defaults := countRules(t, db)
+
+	if err := first.AddPolicyInDomain("auditor", PlatformDomain, "report", "read"); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.AddRoleForUserInDomain("42", CompanyRoleAdmin, CompanyDomain(7)); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.AddRoleForUserInDomain("43", CompanyRoleAdmin, CompanyDomain(7)); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.RemoveRoleForUserInDomain("43", CompanyRoleAdmin, CompanyDomain(7)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启后从数据库加载，默认策略不会重复写入
+	second := newTestManager(t, db)
+	if got := countRules(t, db); got != defaults+2 {
+		t.Fatalf("rules = %d, want %d", got, defaults+2)
+	}
+	if !mustEnforce(t, second, "auditor", PlatformDomain, "report", "read") {
+		t.Fatal("platform policy lost after restart")
+	}
+	if !second.HasRoleInDomain("42", CompanyRoleAdmin, CompanyDomain(7)) || second.HasRoleInDomain("43", CompanyRoleAdmin, CompanyDomain(7)) {
+		t.Fatalf("company roles after restart = %v", second.GetRolesForUserInDomain("42", CompanyDomain(7)))
+	}
+	if !mustEnforce(t, second, "42", CompanyDomain(7), "job", "write") {
+		t.Fatal("company role lost after restart")
+	}
+}
+
+func TestCompanyTemplateInheritance(t *testing.T) {
+	manager := newTestManager(t, newTestDB(t))
+	manager.AddRoleForUserInDomain("42", CompanyRoleLegalRep, CompanyDomain(7))
+	manager.AddRoleForUserInDomain("43", CompanyRoleAuthorizedUser, CompanyDomain(7))
+	manager.AddGroupingPolicy("1", "super_admin")
+
+	cases := []struct {
+		sub, dom, obj, act string
+		want               bool
+	}{
+		{"42", CompanyDomain(7), "company_user", "delete", true},
+		{"42", CompanyDomain(8), "company_user", "delete", false},
+		{"43", CompanyDomain(7), "document", "read", true},
+		{"43", CompanyDomain(7), "document", "write", false},
+		// 企业角色不带入平台域，平台角色也不带入企业域
+		{"42", PlatformDomain, "company", "read", false},
+		{"1", PlatformDomain, "system", "delete", true},
+		{"1", CompanyDomain(7), "company", "read", false},
+	}
+	for _, tc := range cases {
+		if got := mustEnforce(t, manager, tc.sub, tc.dom, tc.obj, tc.act); got != tc.want {
+			t.Errorf("%s %s %s %s = %v, want %v", tc.sub, tc.dom, tc.obj, tc.act, got, tc.want)
+		}
+	}
+
+	// 企业专属策略只作用于该企业
+	manager.AddPolicyInDomain(CompanyRoleAuthorizedUser, CompanyDomain(7), "document", "write")
+	if !mustEnforce(t, manager, "43", CompanyDomain(7), "document", "write") {
+		t.Fatal("company-specific policy not applied")
+	}
+	manager.AddRoleForUserInDomain("43", CompanyRoleAuthorizedUser, CompanyDomain(8))
+	if mustEnforce(t, manager, "43", CompanyDomain(8), "document", "write") {
+		t.Fatal("company-specific policy leaked into another company")
+	}
+
+	permissions, err := manager.GetPermissionsForUserInDomain("43", CompanyDomain(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range permissions {
+		got = append(got, p[1]+" "+p[2]+":"+p[3])
+	}
+	sort.Strings(got)
+	want := []string{"company:* company:read", "company:* document:read", "company:* job:read", "company:7 document:write"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("permissions = %v, want %v", got, want)
+	}
+}
+
+func TestRemoveFilteredPolicy(t *testing.T) {
+	db := newTestDB(t)
+	manager := newTestManager(t, db)
+	for _, dom := range []string{CompanyDomain(7), CompanyDomain(8)} {
+		manager.AddPolicyInDomain("temp", dom, "document", "read")
+		manager.AddPolicyInDomain("temp", dom, "job", "read")
+	}
+
+	if _, err := manager.enforcer.RemoveFilteredPolicy(0, "temp", CompanyDomain(7)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.enforcer.RemoveFilteredPolicy(0, "temp", "", "job"); err != nil {
+		t.Fatal(err)
+	}
+
+	var rules []CasbinRule
+	db.Where("v0 = ?", "temp").Find(&rules)
+	if len(rules) != 1 || rules[0].V1 != CompanyDomain(8) || rules[0].V2 != "document" {
+		t.Fatalf("remaining rules = %+v", rules)
+	}
+	reloaded := newTestManager(t, db)
+	if mustEnforce(t, reloaded, "temp", CompanyDomain(7), "document", "read") || !mustEnforce(t, reloaded, "temp", CompanyDomain(8), "document", "read") {
+		t.Fatal("filtered removal not persisted")
+	}
+}
+
+func TestAdminAPIRecordsAudit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	manager := newTestManager(t, db)
+	r := gin.New()
+	group := r.Group("/api/v1/admin", func(c *gin.Context) { c.Set("user_id", uint(9)) })
+	NewAdminAPI(manager).RegisterRoutes(group)
+
+	send := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send(http.MethodPost, "/api/v1/admin/rbac/policies", policyRequest{Subject: "auditor", Object: "report", Action: "read"}); w.Code != http.StatusOK {
+		t.Fatalf("add policy = %d %s", w.Code, w.Body)
+	}
+	if w := send(http.MethodPost, "/api/v1/admin/rbac/roles", roleRequest{User: "42", Role: CompanyRoleAdmin, Domain: CompanyDomain(7)}); w.Code != http.StatusOK {
+		t.Fatalf("add role = %d %s", w.Code, w.Body)
+	}
+	if w := send(http.MethodDelete, "/api/v1/admin/rbac/roles", roleRequest{User: "42", Role: CompanyRoleAdmin, Domain: CompanyDomain(7)}); w.Code != http.StatusOK {
+		t.Fatalf("remove role = %d %s", w.Code, w.Body)
+	}
+	if w := send(http.MethodPost, "/api/v1/admin/rbac/policies", gin.H{"subject": "auditor"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid request = %d", w.Code)
+	}
+
+	var logs []PolicyAuditLog
+	db.Order("id").Find(&logs)
+	if len(logs) != 3 {
+		t.Fatalf("audit rows = %+v", logs)
+	}
+	want := []PolicyAuditLog{
+		{OperatorID: "9", Action: AuditActionAddPolicy, Domain: PlatformDomain, Rule: "p, auditor, platform, report, read"},
+		{OperatorID: "9", Action: AuditActionAddRole, Domain: "company:7", Rule: "g, 42, admin, company:7"},
+		{OperatorID: "9", Action: AuditActionRemoveRole, Domain: "company:7", Rule: "g, 42, admin, company:7"},
+	}
+	for i, log := range logs {
+		if log.OperatorID != want[i].OperatorID || log.Action != want[i].Action || log.Domain != want[i].Domain || log.Rule != want[i].Rule {
+			t.Errorf("audit[%d] = %+v, want %+v", i, log, want[i])
+		}
+	}
+
+	w := send(http.MethodGet, "/api/v1/admin/rbac/audit?domain=company:7", nil)
+	var resp struct {
+		Total int64 `json:"total"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Total != 2 {
+		t.Fatalf("audit query total = %d", resp.Total)
+	}
+}
+
+func TestWatcherReloadsOtherInstances(t *testing.T) {
+	server := miniredis.RunT(t)
+	db := newTestDB(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	first := newTestManager(t, db)
+	second := newTestManager(t, db)
+	for _, m := range []*Manager{first, second} {
+		if err := m.EnableWatcher(client, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 另一实例在收到通知前看不到新策略，收到通知后重新加载
+	if err := first.AddRoleForUserInDomain("42", CompanyRoleLegalRep, CompanyDomain(7)); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !mustEnforce(t, second, "42", CompanyDomain(7), "company_user", "delete") {
+		if time.Now().After(deadline) {
+			t.Fatal("second instance did not reload after update notification")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := second.RemoveRoleForUserInDomain("42", CompanyRoleLegalRep, CompanyDomain(7)); err != nil {
+		t.Fatal(err)
+	}
+	deadline = time.Now().Add(2 * time.Second)
+	for mustEnforce(t, first, "42", CompanyDomain(7), "company_user", "delete") {
+		if time.Now().After(deadline) {
+			t.Fatal("first instance did not reload after removal notification")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
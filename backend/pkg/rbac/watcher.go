@@ -0,0 +1,101 @@
+package rbac
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// DefaultPolicyChannel 策略变更通知频道
+const DefaultPolicyChannel = "rbac:policy:updates"
+
+// RedisWatcher 基于Redis Pub/Sub的策略变更通知，保证多实例策略视图一致
+type RedisWatcher struct {
+	client     *redis.Client
+	channel    string
+	instanceID string
+	pubsub     *redis.PubSub
+	cancel     context.CancelFunc
+
+	mu       sync.RWMutex
+	callback func(string)
+}
+
+var _ persist.Watcher = (*RedisWatcher)(nil)
+
+// NewRedisWatcher 创建Redis策略变更通知器并开始订阅
+func NewRedisWatcher(client *redis.Client, channel string) (*RedisWatcher, error) {
+	if channel == "" {
+		channel = DefaultPolicyChannel
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pubsub := client.Subscribe(ctx, channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		cancel()
+		pubsub.Close()
+		return nil, err
+	}
+
+	w := &RedisWatcher{
+		client:     client,
+		channel:    channel,
+		instanceID: uuid.New().String(),
+		pubsub:     pubsub,
+		cancel:     cancel,
+	}
+	go w.listen(ctx)
+	return w, nil
+}
+
+// listen 接收其他实例发布的变更通知
+func (w *RedisWatcher) listen(ctx context.Context) {
+	ch := w.pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			// 忽略本实例发布的通知
+			if msg.Payload == w.instanceID {
+				continue
+			}
+			w.mu.RLock()
+			callback := w.callback
+			w.mu.RUnlock()
+			if callback != nil {
+				callback(msg.Payload)
+			}
+		}
+	}
+}
+
+// SetUpdateCallback 设置收到通知时的回调（通常为重新加载策略）
+func (w *RedisWatcher) SetUpdateCallback(callback func(string)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.callback = callback
+	return nil
+}
+
+// Update 通知其他实例重新加载策略
+func (w *RedisWatcher) Update() error {
+	if err := w.client.Publish(context.Background(), w.channel, w.instanceID).Err(); err != nil {
+		log.Printf("failed to publish policy update: %v", err)
+		return err
+	}
+	return nil
+}
+
+// Close 停止订阅
+func (w *RedisWatcher) Close() {
+	w.cancel()
+	w.pubsub.Close()
+}